@@ -0,0 +1,197 @@
+package dcerpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gentlemanautomaton/dcerpc/protocol"
+	"github.com/gentlemanautomaton/dcerpc/uuid"
+)
+
+// Protocol sequences that identify the RPC protocol, network address format
+// and transport of a binding.
+const (
+	ProtSeqTCP       = "ncacn_ip_tcp" // Connection-oriented RPC over TCP/IP
+	ProtSeqNamedPipe = "ncacn_np"     // Connection-oriented RPC over SMB named pipes
+	ProtSeqHTTP      = "ncacn_http"   // Connection-oriented RPC over HTTP
+)
+
+var (
+	// ErrInvalidBinding is returned when a string binding cannot be parsed.
+	ErrInvalidBinding = errors.New("dcerpc: invalid string binding")
+
+	// ErrUnsupportedTower is returned when a protocol tower describes a
+	// protocol sequence that is not supported.
+	ErrUnsupportedTower = errors.New("dcerpc: unsupported protocol tower")
+)
+
+// Binding is a binding handle, which identifies the server that remote
+// procedure calls are sent to.
+//
+// A binding is usually created from a string binding of the form:
+//
+//	[object-uuid@]protseq:[network-addr][[endpoint][,option=value...]]
+//
+// For example:
+//
+//	ncacn_ip_tcp:192.168.1.1[135]
+//	ncacn_np:server[\pipe\svcctl]
+type Binding struct {
+	Object      uuid.UUID
+	ProtSeq     string
+	NetworkAddr string
+	Endpoint    string
+	Options     map[string]string
+}
+
+// ParseBinding parses a string binding.
+func ParseBinding(s string) (b Binding, err error) {
+	if i := strings.IndexByte(s, '@'); i >= 0 {
+		if b.Object, err = uuid.Parse(s[:i]); err != nil {
+			return Binding{}, ErrInvalidBinding
+		}
+		s = s[i+1:]
+	}
+
+	i := strings.IndexByte(s, ':')
+	if i <= 0 {
+		return Binding{}, ErrInvalidBinding
+	}
+	b.ProtSeq, s = s[:i], s[i+1:]
+
+	if i := strings.IndexByte(s, '['); i >= 0 {
+		if !strings.HasSuffix(s, "]") {
+			return Binding{}, ErrInvalidBinding
+		}
+		if err := b.parseOptions(s[i+1 : len(s)-1]); err != nil {
+			return Binding{}, err
+		}
+		s = s[:i]
+	}
+	b.NetworkAddr = s
+	return b, nil
+}
+
+// parseOptions parses the bracketed portion of a string binding, which holds
+// the endpoint and any network options.
+func (b *Binding) parseOptions(s string) error {
+	if s == "" {
+		return nil
+	}
+	for i, field := range strings.Split(s, ",") {
+		key, value := "", field
+		if eq := strings.IndexByte(field, '='); eq >= 0 {
+			key, value = field[:eq], field[eq+1:]
+		}
+		switch {
+		case key == "endpoint" || (key == "" && i == 0):
+			b.Endpoint = value
+		case key == "":
+			return ErrInvalidBinding
+		default:
+			if b.Options == nil {
+				b.Options = make(map[string]string)
+			}
+			b.Options[key] = value
+		}
+	}
+	return nil
+}
+
+// String returns the string binding for b.
+func (b Binding) String() string {
+	var s strings.Builder
+	if !b.Object.IsNil() {
+		s.WriteString(b.Object.String())
+		s.WriteByte('@')
+	}
+	s.WriteString(b.ProtSeq)
+	s.WriteByte(':')
+	s.WriteString(b.NetworkAddr)
+	if b.Endpoint != "" || len(b.Options) > 0 {
+		s.WriteByte('[')
+		s.WriteString(b.Endpoint)
+		for _, key := range sortedKeys(b.Options) {
+			s.WriteByte(',')
+			s.WriteString(key)
+			s.WriteByte('=')
+			s.WriteString(b.Options[key])
+		}
+		s.WriteByte(']')
+	}
+	return s.String()
+}
+
+// address returns the portion of the binding that identifies the server
+// endpoint, which is used to pool associations.
+func (b Binding) address() string {
+	return fmt.Sprintf("%s:%s[%s]", b.ProtSeq, b.NetworkAddr, b.Endpoint)
+}
+
+// BindingFromTower returns the binding described by the given protocol tower,
+// such as one returned by the endpoint mapper.
+func BindingFromTower(t protocol.Tower) (b Binding, err error) {
+	var rpc, transport, host *protocol.Floor
+	for i := range t {
+		f := &t[i]
+		switch f.Protocol() {
+		case protocol.IdentifierConnectionOriented:
+			rpc = f
+		case protocol.IdentifierTCP, protocol.IdentifierNamedPipe, protocol.IdentifierHTTP:
+			transport = f
+		case protocol.IdentifierIP, protocol.IdentifierNetBIOS:
+			host = f
+		}
+	}
+	if rpc == nil || transport == nil {
+		return Binding{}, ErrUnsupportedTower
+	}
+
+	switch transport.Protocol() {
+	case protocol.IdentifierTCP, protocol.IdentifierHTTP:
+		if len(transport.AddressData) != 2 {
+			return Binding{}, protocol.ErrMalformedTower
+		}
+		b.ProtSeq = ProtSeqTCP
+		if transport.Protocol() == protocol.IdentifierHTTP {
+			b.ProtSeq = ProtSeqHTTP
+		}
+		b.Endpoint = strconv.Itoa(int(binary.BigEndian.Uint16(transport.AddressData)))
+		if host != nil && host.Protocol() == protocol.IdentifierIP && len(host.AddressData) == 4 {
+			if ip := net.IP(host.AddressData); !ip.IsUnspecified() {
+				b.NetworkAddr = ip.String()
+			}
+		}
+	case protocol.IdentifierNamedPipe:
+		b.ProtSeq = ProtSeqNamedPipe
+		b.Endpoint = nullTerminated(transport.AddressData)
+		if host != nil && host.Protocol() == protocol.IdentifierNetBIOS {
+			b.NetworkAddr = nullTerminated(host.AddressData)
+		}
+	}
+	return b, nil
+}
+
+// nullTerminated returns the string stored in p up to its first null octet.
+func nullTerminated(p []byte) string {
+	for i, c := range p {
+		if c == 0 {
+			return string(p[:i])
+		}
+	}
+	return string(p)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,122 @@
+package dcerpc
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gentlemanautomaton/dcerpc/protocol"
+	"github.com/gentlemanautomaton/dcerpc/uuid"
+)
+
+func TestParseBinding(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Binding
+	}{
+		{`ncacn_ip_tcp:192.168.1.1[135]`, Binding{ProtSeq: ProtSeqTCP, NetworkAddr: "192.168.1.1", Endpoint: "135"}},
+		{`ncacn_np:server[\pipe\svcctl]`, Binding{ProtSeq: ProtSeqNamedPipe, NetworkAddr: "server", Endpoint: `\pipe\svcctl`}},
+		{`ncacn_ip_tcp:host`, Binding{ProtSeq: ProtSeqTCP, NetworkAddr: "host"}},
+		{`ncacn_ip_tcp:`, Binding{ProtSeq: ProtSeqTCP}},
+		{
+			`12345678-1234-abcd-ef00-0123456789ab@ncacn_ip_tcp:host[135,a=1,b=2]`,
+			Binding{
+				Object:      uuid.MustParse("12345678-1234-abcd-ef00-0123456789ab"),
+				ProtSeq:     ProtSeqTCP,
+				NetworkAddr: "host",
+				Endpoint:    "135",
+				Options:     map[string]string{"a": "1", "b": "2"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			b, err := ParseBinding(tt.s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(b, tt.want) {
+				t.Fatalf("ParseBinding returned %+v, want %+v", b, tt.want)
+			}
+			if s := b.String(); s != tt.s {
+				t.Fatalf("String returned %q, want %q", s, tt.s)
+			}
+		})
+	}
+
+	// The endpoint may also be given as an option.
+	b, err := ParseBinding(`ncacn_ip_tcp:host[a=1,endpoint=135]`)
+	if err != nil || b.Endpoint != "135" || b.Options["a"] != "1" {
+		t.Fatalf("ParseBinding returned %+v, %v", b, err)
+	}
+
+	for _, s := range []string{
+		`ncacn_ip_tcp`,
+		`:host[135]`,
+		`bad-uuid@ncacn_ip_tcp:host`,
+		`ncacn_ip_tcp:host[135`,
+		`ncacn_ip_tcp:host[135,extra]`,
+	} {
+		if _, err := ParseBinding(s); err != ErrInvalidBinding {
+			t.Errorf("ParseBinding(%q) returned %v, want %v", s, err, ErrInvalidBinding)
+		}
+	}
+}
+
+func TestBindingFromTower(t *testing.T) {
+	rpc := protocol.Floor{ProtocolIdentifier: []byte{protocol.IdentifierConnectionOriented}, AddressData: []byte{0, 0}}
+	tests := []struct {
+		name  string
+		tower protocol.Tower
+		want  Binding
+		err   error
+	}{
+		{
+			name: "tcp",
+			tower: protocol.Tower{
+				rpc,
+				{ProtocolIdentifier: []byte{protocol.IdentifierTCP}, AddressData: []byte{0xc0, 0x01}},
+				{ProtocolIdentifier: []byte{protocol.IdentifierIP}, AddressData: []byte{10, 0, 0, 1}},
+			},
+			want: Binding{ProtSeq: ProtSeqTCP, NetworkAddr: "10.0.0.1", Endpoint: "49153"},
+		},
+		{
+			name: "tcp-unspecified",
+			tower: protocol.Tower{
+				rpc,
+				{ProtocolIdentifier: []byte{protocol.IdentifierTCP}, AddressData: []byte{0, 135}},
+				{ProtocolIdentifier: []byte{protocol.IdentifierIP}, AddressData: []byte{0, 0, 0, 0}},
+			},
+			want: Binding{ProtSeq: ProtSeqTCP, Endpoint: "135"},
+		},
+		{
+			name: "named-pipe",
+			tower: protocol.Tower{
+				rpc,
+				{ProtocolIdentifier: []byte{protocol.IdentifierNamedPipe}, AddressData: []byte("\\pipe\\lsass\x00")},
+				{ProtocolIdentifier: []byte{protocol.IdentifierNetBIOS}, AddressData: []byte("SERVER\x00")},
+			},
+			want: Binding{ProtSeq: ProtSeqNamedPipe, NetworkAddr: "SERVER", Endpoint: `\pipe\lsass`},
+		},
+		{
+			name:  "connectionless",
+			tower: protocol.Tower{{ProtocolIdentifier: []byte{protocol.IdentifierUDP}, AddressData: []byte{0, 135}}},
+			err:   ErrUnsupportedTower,
+		},
+		{
+			name:  "malformed-port",
+			tower: protocol.Tower{rpc, {ProtocolIdentifier: []byte{protocol.IdentifierTCP}, AddressData: []byte{135}}},
+			err:   protocol.ErrMalformedTower,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := BindingFromTower(tt.tower)
+			if err != tt.err {
+				t.Fatalf("BindingFromTower returned %v, want %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(b, tt.want) {
+				t.Fatalf("BindingFromTower returned %+v, want %+v", b, tt.want)
+			}
+		})
+	}
+}
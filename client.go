@@ -1,6 +1,46 @@
 package dcerpc
 
-import "context"
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+
+	"github.com/gentlemanautomaton/dcerpc/ndr"
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationsyntax"
+	"github.com/gentlemanautomaton/dcerpc/protocol/coproto"
+	"github.com/gentlemanautomaton/dcerpc/security"
+	"github.com/gentlemanautomaton/dcerpc/transfersyntax"
+)
+
+var (
+	// ErrUnsupportedProtSeq is returned when a client has no dialer for the
+	// protocol sequence of a binding.
+	ErrUnsupportedProtSeq = errors.New("dcerpc: unsupported protocol sequence")
+
+	// ErrNoEndpoint is returned when a binding does not specify an endpoint.
+	ErrNoEndpoint = errors.New("dcerpc: binding has no endpoint")
+)
+
+// Fault is an error returned by Invoke when the server reports a fault
+// condition.
+type Fault = coproto.Fault
+
+// Dialer establishes connections to the server identified by a binding.
+type Dialer interface {
+	Dial(ctx context.Context, b Binding) (io.ReadWriteCloser, error)
+}
+
+// DialerFunc is a function that implements the Dialer interface.
+type DialerFunc func(ctx context.Context, b Binding) (io.ReadWriteCloser, error)
+
+// Dial calls f(ctx, b).
+func (f DialerFunc) Dial(ctx context.Context, b Binding) (io.ReadWriteCloser, error) {
+	return f(ctx, b)
+}
 
 // Client is a DCE / RPC client that is capable of making procedure calls to
 // one or more remote servers.
@@ -8,15 +48,278 @@ import "context"
 // Client implements the client side of the protocol described in the
 // "DCE 1.1: Remote Procedure Call" technical standard.
 type Client struct {
+	// Dialers maps protocol sequences to the dialers that establish
+	// connections for them. If no dialer is present for ncacn_ip_tcp a
+	// net.Dialer will be used.
+	Dialers map[string]Dialer
+
+	// SecurityProvider authenticates the associations established by the
+	// client. If it is nil associations are not authenticated.
+	SecurityProvider security.Provider
+
+	// AuthLevel is the level of protection applied to calls when
+	// SecurityProvider is set. If it is zero security.LevelIntegrity
+	// is used.
+	AuthLevel security.Level
+
+	pool coproto.ClientPool
+}
+
+// Handle returns a handle for making calls on the interface iface of the
+// server identified by b.
+func (c *Client) Handle(b Binding, iface Interface) *Handle {
+	return &Handle{client: c, binding: b, iface: iface}
+}
+
+// Close closes all of the associations maintained by the client.
+func (c *Client) Close() {
+	c.pool.Close()
+}
+
+// address returns the key used to pool the associations for b. Associations
+// are only shared by handles with the same security requirements.
+func (c *Client) address(b Binding) string {
+	if c.SecurityProvider == nil {
+		return b.address()
+	}
+	return fmt.Sprintf("%s?auth=%d,%d", b.address(), c.SecurityProvider.Type(), c.authLevel())
+}
+
+func (c *Client) authLevel() security.Level {
+	if c.AuthLevel == security.LevelDefault {
+		return security.LevelIntegrity
+	}
+	return c.AuthLevel
+}
+
+// dial establishes a new association with the server identified by b using
+// the dialer d.
+func (c *Client) dial(ctx context.Context, d Dialer, b Binding) (*coproto.Client, error) {
+	conn, err := d.Dial(ctx, b)
+	if err != nil {
+		return nil, err
+	}
+	client := coproto.NewClient(conn)
+	if c.SecurityProvider != nil {
+		if err := client.Authenticate(c.SecurityProvider, b.NetworkAddr, c.authLevel()); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+func (c *Client) dialer(protseq string) Dialer {
+	if d, ok := c.Dialers[protseq]; ok {
+		return d
+	}
+	if protseq == ProtSeqTCP {
+		return DialerFunc(dialTCP)
+	}
+	return nil
+}
+
+func dialTCP(ctx context.Context, b Binding) (io.ReadWriteCloser, error) {
+	if b.Endpoint == "" {
+		return nil, ErrNoEndpoint
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", net.JoinHostPort(b.NetworkAddr, b.Endpoint))
+}
+
+// Handle is used to make calls on an interface of a particular server.
+type Handle struct {
+	client  *Client
+	binding Binding
+	iface   Interface
+
+	// An additional security context for the handle's calls
+	provider security.Provider
+	level    security.Level
+}
+
+// Binding returns the binding of the handle.
+func (h *Handle) Binding() Binding {
+	return h.binding
+}
+
+// Interface returns the interface of the handle.
+func (h *Handle) Interface() Interface {
+	return h.iface
+}
+
+// WithSecurity returns a copy of the handle whose calls are protected by a
+// security context established with provider at the given level, instead of
+// the client's SecurityProvider. If level is zero security.LevelIntegrity is
+// used.
+//
+// The calls share the client's associations. When an association is already
+// authenticated, the additional security context is only available if the
+// server agreed to security context multiplexing during bind time feature
+// negotiation.
+func (h *Handle) WithSecurity(provider security.Provider, level security.Level) *Handle {
+	if level == security.LevelDefault {
+		level = security.LevelIntegrity
+	}
+	clone := *h
+	clone.provider = provider
+	clone.level = level
+	return &clone
 }
 
 // Invoke will run the requested remote procedure.
 //
-// TODO: Figure out a good way to pass binding and interface information in.
+// All of the interface's transfer syntaxes are offered to the server in
+// order of preference. The input parameters in are marshaled with the
+// transfer syntax that was negotiated and the output parameters are
+// unmarshaled into out, which must be a pointer. Either may be nil if the
+// operation has no parameters in that direction.
+//
+// Pipes are represented by channel fields. The elements of [in] pipes are
+// received from their channels and transmitted as they arrive, until the
+// channels are closed. The elements of [out] pipes are sent on their channels
+// as they are received, so the caller must receive them concurrently unless
+// the channels are nil, in which case they are set to buffered channels that
+// hold all of the elements.
+//
+// If the server reports a fault, Invoke returns a *Fault.
+func (h *Handle) Invoke(ctx context.Context, opnum uint16, in, out interface{}) error {
+	call := coproto.Call{OpNum: opnum}
+	return h.call(ctx, &call, h.iface.transferSyntaxes(), func(syntax transfersyntax.Syntax) error {
+		if out != nil && hasPipes(out) {
+			call.ResponseStream = func(r io.Reader) error {
+				dec, err := syntax.NewDecoder(r, call.ResponseFormat)
+				if err != nil {
+					return err
+				}
+				return dec.Decode(out)
+			}
+		}
+		if in == nil {
+			return nil
+		}
+		if hasPipes(in) {
+			call.RequestStream = func(w io.Writer) error {
+				enc, err := syntax.NewEncoder(w, call.RequestFormat)
+				if err != nil {
+					return err
+				}
+				return enc.Encode(in)
+			}
+			return nil
+		}
+		var buf bytes.Buffer
+		enc, err := syntax.NewEncoder(&buf, call.RequestFormat)
+		if err != nil {
+			return err
+		}
+		if err := enc.Encode(in); err != nil {
+			return err
+		}
+		call.Request = buf.Bytes()
+		return nil
+	}, func(syntax transfersyntax.Syntax) error {
+		if out == nil || call.ResponseStream != nil {
+			return nil
+		}
+		dec, err := syntax.NewDecoder(bytes.NewReader(call.Response), call.ResponseFormat)
+		if err != nil {
+			return err
+		}
+		return dec.Decode(out)
+	})
+}
+
+// Call sends a call with pre-marshaled stub data, which is useful for stubs
+// that perform their own marshaling. The caller supplies the operation
+// number, object, transfer syntax and request stub data of call; the
+// remaining fields are filled in by the handle. The request stub data must be
+// encoded in call.TransferSyntax with the format label of the association
+// that carries the call, which the handle records in call.RequestFormat.
+// Associations dialed by the client keep the default format label of
+// coproto.NewClient, formatlabel.LEAIEEE.
 //
-// TODO: Figure out a good way to pass the RPC parameters in.
+// If call.TransferSyntax is zero the interface's preferred transfer syntax
+// is used.
 //
-// TODO: Return some sort of call struct (or interface)?
-func (c Client) Invoke(ctx context.Context) {
+// Most callers should use Invoke instead.
+func (h *Handle) Call(ctx context.Context, call *coproto.Call) error {
+	offer := h.iface.transferSyntaxes()[:1]
+	if call.TransferSyntax != (presentationsyntax.ID{}) {
+		syntax, ok := transfersyntax.Lookup(call.TransferSyntax, h.iface.TransferSyntaxes...)
+		if !ok {
+			return errors.New("dcerpc: transfer syntax not supported by interface")
+		}
+		offer = []transfersyntax.Syntax{syntax}
+	}
+	return h.call(ctx, call, offer, nil, nil)
+}
+
+// call negotiates a presentation context for the interface that uses one of
+// the offered transfer syntaxes and makes the call on an association
+// allocated from the client's pool. The encode function is called once the
+// transfer syntax has been negotiated and decode is called once a response
+// has been received.
+func (h *Handle) call(ctx context.Context, call *coproto.Call, offer []transfersyntax.Syntax, encode, decode func(transfersyntax.Syntax) error) error {
+	d := h.client.dialer(h.binding.ProtSeq)
+	if d == nil {
+		return ErrUnsupportedProtSeq
+	}
+	client, err := h.client.pool.Allocate(ctx, h.client.address(h.binding), func(ctx context.Context) (*coproto.Client, error) {
+		return h.client.dial(ctx, d, h.binding)
+	})
+	if err != nil {
+		return err
+	}
+	defer h.client.pool.Release(client)
+
+	ids := make([]presentationsyntax.ID, len(offer))
+	for i := range offer {
+		ids[i] = offer[i].ID()
+	}
+	abstract := h.iface.SyntaxID()
+	id, chosen, err := client.Negotiate(ctx, abstract, ids)
+	if err != nil {
+		return err
+	}
+	syntax, ok := transfersyntax.Lookup(chosen, offer...)
+	if !ok {
+		return errors.New("dcerpc: server selected a transfer syntax that was not offered")
+	}
+
+	if h.provider != nil && (h.provider != h.client.SecurityProvider || h.level != h.client.authLevel()) {
+		if call.AuthContextID, err = client.SecurityContext(ctx, h.provider, h.binding.NetworkAddr, h.level); err != nil {
+			return err
+		}
+	}
+
+	call.ContextID = id
+	call.AbstractSyntax = abstract
+	call.TransferSyntax = syntax.ID()
+	call.RequestFormat = client.Format()
+	if call.Object.IsNil() {
+		call.Object = h.binding.Object
+	}
+	if encode != nil {
+		if err := encode(syntax); err != nil {
+			return err
+		}
+	}
+	if err := client.Invoke(ctx, call); err != nil {
+		return err
+	}
+	if decode != nil {
+		return decode(syntax)
+	}
+	return nil
+}
 
+// hasPipes returns true if the parameters held by v, which may be a pointer,
+// include pipes.
+func hasPipes(v interface{}) bool {
+	rt := reflect.TypeOf(v)
+	if rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	return ndr.HasPipes(rt)
 }
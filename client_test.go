@@ -0,0 +1,150 @@
+package dcerpc
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/gentlemanautomaton/dcerpc/pdu"
+	"github.com/gentlemanautomaton/dcerpc/protocol/coproto"
+	"github.com/gentlemanautomaton/dcerpc/security"
+	"github.com/gentlemanautomaton/dcerpc/transfersyntax"
+)
+
+type testSumRequest struct {
+	Count  uint32
+	Values []int32 `idl:"size_is(Count)"`
+}
+
+type testSumResponse struct {
+	Sum   int64
+	Count uint16
+}
+
+func testSum(ctx context.Context, call *Call) error {
+	var req testSumRequest
+	if err := call.DecodeRequest(&req); err != nil {
+		return err
+	}
+	resp := testSumResponse{Count: uint16(len(req.Values))}
+	for _, v := range req.Values {
+		resp.Sum += int64(v)
+	}
+	return call.EncodeResponse(&resp)
+}
+
+func TestInvoke(t *testing.T) {
+	var srv Server
+	if err := srv.Register(testInterface, OperationTable{testSum}); err != nil {
+		t.Fatal(err)
+	}
+	c := testClient(&srv)
+	defer c.Close()
+	h := c.Handle(testBinding, testInterface)
+	if !reflect.DeepEqual(h.Binding(), testBinding) || !reflect.DeepEqual(h.Interface(), testInterface) {
+		t.Fatalf("handle has binding %v and interface %v", h.Binding(), h.Interface())
+	}
+
+	// The handle may be used for more than one call.
+	for i := 0; i < 2; i++ {
+		var resp testSumResponse
+		req := testSumRequest{Count: 3, Values: []int32{1, -20, 300}}
+		if err := h.Invoke(context.Background(), 0, &req, &resp); err != nil {
+			t.Fatal(err)
+		}
+		if want := (testSumResponse{Sum: 281, Count: 3}); resp != want {
+			t.Fatalf("Invoke returned %+v, want %+v", resp, want)
+		}
+	}
+
+	// Stub data that cannot be decoded fails on the server.
+	var resp testSumResponse
+	err := h.Invoke(context.Background(), 0, nil, &resp)
+	if _, ok := err.(*Fault); !ok {
+		t.Fatalf("Invoke with missing stub data returned %v, want a fault", err)
+	}
+}
+
+func TestInvokeErrors(t *testing.T) {
+	var srv Server
+	if err := srv.Register(testInterface, OperationTable{testEcho}); err != nil {
+		t.Fatal(err)
+	}
+	c := testClient(&srv)
+	defer c.Close()
+	ctx := context.Background()
+
+	b := testBinding
+	b.ProtSeq = ProtSeqHTTP
+	if err := c.Handle(b, testInterface).Invoke(ctx, 0, nil, nil); err != ErrUnsupportedProtSeq {
+		t.Fatalf("Invoke returned %v, want %v", err, ErrUnsupportedProtSeq)
+	}
+
+	var direct Client
+	b = testBinding
+	b.Endpoint = ""
+	if err := direct.Handle(b, testInterface).Invoke(ctx, 0, nil, nil); err != ErrNoEndpoint {
+		t.Fatalf("Invoke returned %v, want %v", err, ErrNoEndpoint)
+	}
+
+	// The transfer syntax of a pre-marshaled call must belong to the
+	// interface.
+	call := coproto.Call{TransferSyntax: transfersyntax.NDR64.ID()}
+	if err := c.Handle(testBinding, testInterface).Call(ctx, &call); err == nil {
+		t.Fatal("Call with an unsupported transfer syntax succeeded")
+	}
+
+	err := c.Handle(testBinding, testInterface).Invoke(ctx, 1, nil, nil)
+	if fault, ok := err.(*Fault); !ok || fault.Status != pdu.StatusOpRangeError || !fault.DidNotExecute {
+		t.Fatalf("Invoke returned %v, want an op range error", err)
+	}
+}
+
+func TestWithSecurity(t *testing.T) {
+	srv := &Server{SecurityProviders: []security.Provider{testProvider{}}}
+	levels := make(chan security.Level, 1)
+	err := srv.Register(testInterface, OperationTable{func(ctx context.Context, call *Call) error {
+		if call.Auth == nil {
+			levels <- security.LevelNone
+		} else {
+			levels <- call.Auth.Level
+		}
+		return nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		client security.Provider
+		handle security.Level
+		want   security.Level
+	}{
+		{name: "unauthenticated", want: security.LevelNone},
+		{name: "handle", handle: security.LevelPrivacy, want: security.LevelPrivacy},
+		{name: "client", client: testProvider{}, want: security.LevelIntegrity},
+		{name: "client-and-handle", client: testProvider{}, handle: security.LevelPrivacy, want: security.LevelPrivacy},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testClient(srv)
+			c.SecurityProvider = tt.client
+			defer c.Close()
+			h := c.Handle(testBinding, testInterface)
+			if tt.handle != security.LevelDefault {
+				h = h.WithSecurity(testProvider{}, tt.handle)
+			}
+			// The first call establishes the association, and the second
+			// reuses it.
+			for i := 0; i < 2; i++ {
+				if err := h.Invoke(context.Background(), 0, nil, nil); err != nil {
+					t.Fatal(err)
+				}
+				if level := <-levels; level != tt.want {
+					t.Fatalf("call %d made at level %d, want %d", i, level, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,1443 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gentlemanautomaton/dcerpc/idl"
+	"github.com/gentlemanautomaton/dcerpc/idl/types"
+)
+
+// baseTypes maps the names of IDL base types to Go types.
+var baseTypes = map[string]string{
+	"boolean":            "bool",
+	"byte":               "byte",
+	"char":               "byte",
+	"unsigned char":      "byte",
+	"signed char":        "int8",
+	"small":              "int8",
+	"unsigned small":     "uint8",
+	"__int8":             "int8",
+	"unsigned __int8":    "uint8",
+	"wchar_t":            "uint16",
+	"short":              "int16",
+	"unsigned short":     "uint16",
+	"__int16":            "int16",
+	"unsigned __int16":   "uint16",
+	"int":                "int32",
+	"unsigned int":       "uint32",
+	"long":               "int32",
+	"unsigned long":      "uint32",
+	"__int32":            "int32",
+	"unsigned __int32":   "uint32",
+	"__int3264":          "int32",
+	"unsigned __int3264": "uint32",
+	"error_status_t":     "uint32",
+	"hyper":              "int64",
+	"unsigned hyper":     "uint64",
+	"long long":          "int64",
+	"unsigned long long": "uint64",
+	"__int64":            "int64",
+	"unsigned __int64":   "uint64",
+	"float":              "float32",
+	"double":             "float64",
+}
+
+// arrayAttrs are the attributes that describe the bounds of an array.
+var arrayAttrs = []string{"size_is", "max_is", "min_is", "length_is", "first_is", "last_is"}
+
+// pointerAttrs are the attributes that select the kind of a pointer.
+var pointerAttrs = []string{"ref", "unique", "ptr"}
+
+// exprAttrs are the attributes whose expressions refer to other fields.
+var exprAttrs = append([]string{"switch_is"}, arrayAttrs...)
+
+// generator translates parsed IDL files into Go source code.
+type generator struct {
+	include  []string
+	loaded   map[string]bool
+	files    []*types.File // Files whose declarations are generated
+	warnings []string
+	errors   errorList // Declarations that cannot be generated
+
+	// Declarations of all loaded files, by name
+	typedefs map[string]*types.Typedef
+	tags     map[string]string // Struct, union and enum tags to Go names
+	consts   map[string]string // Constants and enumerators to their values
+	warned   map[string]bool
+
+	buf        bytes.Buffer
+	pending    bytes.Buffer // Anonymous types to be generated
+	usesPDU    bool         // The generated code refers to the pdu package
+	usesDCERPC bool         // Declarations outside of interfaces refer to the dcerpc package
+	strict     bool         // The interface being generated has strict context handles
+	ptrDefault string       // The pointer_default of the interface being generated
+}
+
+func newGenerator(include []string) *generator {
+	return &generator{
+		include:  include,
+		loaded:   make(map[string]bool),
+		typedefs: make(map[string]*types.Typedef),
+		tags:     make(map[string]string),
+		consts:   make(map[string]string),
+		warned:   make(map[string]bool),
+	}
+}
+
+// load parses the IDL file at path and the files that it imports. If emit
+// is true the declarations of the file will be generated.
+func (g *generator) load(path string, emit bool) error {
+	if abs, err := filepath.Abs(path); err == nil {
+		if g.loaded[abs] {
+			return nil
+		}
+		g.loaded[abs] = true
+	}
+	f, err := idl.ParseFile(path)
+	if err != nil {
+		return err
+	}
+	if emit {
+		g.files = append(g.files, f)
+
+		// Like MIDL, use the configuration file with the same base name
+		// as the IDL file if there is one.
+		acf := strings.TrimSuffix(path, filepath.Ext(path)) + ".acf"
+		if _, err := os.Stat(acf); err == nil {
+			if err := g.configure(acf); err != nil {
+				return err
+			}
+		}
+	}
+
+	imports := f.Imports
+	for _, iface := range f.Interfaces {
+		imports = append(imports, iface.Imports...)
+	}
+	for _, name := range imports {
+		found, ok := g.find(name, filepath.Dir(path))
+		if !ok {
+			g.warn("imported file %s not found", name)
+			continue
+		}
+		if err := g.load(found, false); err != nil {
+			return err
+		}
+	}
+
+	g.declare(f.Typedefs, f.Consts)
+	for _, iface := range f.Interfaces {
+		g.declare(iface.Typedefs, iface.Consts)
+	}
+	return nil
+}
+
+// configure parses the application configuration file at path and applies
+// each of its interfaces to the generated file that declares it.
+func (g *generator) configure(path string) error {
+	if abs, err := filepath.Abs(path); err == nil {
+		if g.loaded[abs] {
+			return nil
+		}
+		g.loaded[abs] = true
+	}
+	acf, err := idl.ParseACFFile(path)
+	if err != nil {
+		return err
+	}
+	for _, ai := range acf.Interfaces {
+		var f *types.File
+		for _, candidate := range g.files {
+			for _, iface := range candidate.Interfaces {
+				if iface.Name == ai.Name {
+					f = candidate
+				}
+			}
+		}
+		if f == nil {
+			return fmt.Errorf("%s: interface %s is not declared by any of the named IDL files", path, ai.Name)
+		}
+		part := &types.ACF{Name: acf.Name, Interfaces: []*types.ACFInterface{ai}}
+		if err := idl.Configure(f, part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// find locates an imported file.
+func (g *generator) find(name, dir string) (string, bool) {
+	for _, d := range append([]string{dir}, g.include...) {
+		path := filepath.Join(d, name)
+		if _, err := os.Stat(path); err == nil {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// declare records the names declared by typedefs and constants.
+func (g *generator) declare(typedefs []*types.Typedef, consts []*types.Const) {
+	for _, td := range typedefs {
+		if td.Name != "" {
+			g.typedefs[td.Name] = td
+		}
+		// The first name declared for a tag is used for the type.
+		t := td.Type
+		if t.Tag != "" && isDefinition(t) {
+			if _, ok := g.tags[t.Tag]; !ok {
+				name := td.Name
+				if name == "" {
+					name = t.Tag
+				}
+				g.tags[t.Tag] = goName(name)
+			}
+		}
+		if t.Kind == types.Enum {
+			g.declareEnumerators(t)
+		}
+	}
+	for _, c := range consts {
+		g.consts[c.Name] = g.expr(c.Value, true)
+	}
+}
+
+// declareEnumerators records the values of the enumerators of t. An
+// enumerator without a value is one greater than the previous one.
+func (g *generator) declareEnumerators(t *types.Type) {
+	base, offset := "0", int64(0)
+	for _, e := range t.Enumerators {
+		if e.Value != "" {
+			base, offset = g.expr(e.Value, true), 0
+		}
+		switch n, err := parseInt(base); {
+		case err == nil:
+			g.consts[e.Name] = strconv.FormatInt(n+offset, 10)
+		case offset == 0:
+			g.consts[e.Name] = base
+		default:
+			g.consts[e.Name] = fmt.Sprintf("(%s) + %d", base, offset)
+		}
+		offset++
+	}
+}
+
+// errorList is the error returned by generate when declarations cannot be
+// generated. Each of its elements describes one of them.
+type errorList []string
+
+func (e errorList) Error() string {
+	return strings.Join(e, "\n")
+}
+
+// fail records an error, unless it has already been recorded. The bindings
+// are not generated if any errors are recorded, but generation continues so
+// that all of them are reported.
+func (g *generator) fail(format string, args ...interface{}) {
+	e := fmt.Sprintf(format, args...)
+	if !g.warned[e] {
+		g.warned[e] = true
+		g.errors = append(g.errors, e)
+	}
+}
+
+// warn records a warning, unless it has already been recorded.
+func (g *generator) warn(format string, args ...interface{}) {
+	w := fmt.Sprintf(format, args...)
+	if !g.warned[w] {
+		g.warned[w] = true
+		g.warnings = append(g.warnings, w)
+	}
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+// generate returns the formatted Go source code for the loaded files.
+func (g *generator) generate(pkg string) ([]byte, error) {
+	if pkg == "" {
+		for _, f := range g.files {
+			if len(f.Interfaces) > 0 {
+				pkg = strings.ToLower(goName(f.Interfaces[0].Name))
+				break
+			}
+		}
+		if pkg == "" {
+			pkg = "idl"
+		}
+	}
+
+	var names []string
+	for _, f := range g.files {
+		names = append(names, filepath.Base(f.Name))
+	}
+	g.printf("// Code generated by idl2go from %s. DO NOT EDIT.\n\n", strings.Join(names, ", "))
+	g.printf("package %s\n\n", pkg)
+
+	var body bytes.Buffer
+	g.buf, body = body, g.buf
+	hasInterfaces := false
+	for _, f := range g.files {
+		g.genConsts(f.Consts)
+		g.genTypedefs(f.Typedefs)
+		for _, iface := range f.Interfaces {
+			g.genConsts(iface.Consts)
+			g.strict = iface.Attrs.Contains("strict_context_handle")
+			g.ptrDefault = iface.PointerDefault
+			g.genTypedefs(iface.Typedefs)
+			g.strict = false
+			if g.iface(iface) {
+				hasInterfaces = true
+			}
+			g.ptrDefault = ""
+		}
+	}
+	g.buf, body = body, g.buf
+	if len(g.errors) > 0 {
+		return nil, g.errors
+	}
+
+	if hasInterfaces {
+		g.printf("import (\n\t\"context\"\n\n")
+		g.printf("\t\"github.com/gentlemanautomaton/dcerpc\"\n")
+		if g.usesPDU {
+			g.printf("\t\"github.com/gentlemanautomaton/dcerpc/pdu\"\n")
+		}
+		g.printf("\t\"github.com/gentlemanautomaton/dcerpc/uuid\"\n)\n\n")
+	} else if g.usesDCERPC {
+		g.printf("import \"github.com/gentlemanautomaton/dcerpc\"\n\n")
+	}
+	g.buf.Write(body.Bytes())
+
+	src, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		return g.buf.Bytes(), fmt.Errorf("formatting generated code: %v", err)
+	}
+	return src, nil
+}
+
+// genConsts generates constant declarations.
+func (g *generator) genConsts(consts []*types.Const) {
+	if len(consts) == 0 {
+		return
+	}
+	g.printf("const (\n")
+	for _, c := range consts {
+		g.printf("\t%s = %s\n", goName(c.Name), g.expr(c.Value, true))
+	}
+	g.printf(")\n\n")
+}
+
+// genTypedefs generates type declarations.
+func (g *generator) genTypedefs(typedefs []*types.Typedef) {
+	defined := make(map[*types.Type]string)
+	for _, td := range typedefs {
+		g.genTypedef(td, defined)
+		g.flush()
+	}
+}
+
+// genTypedef generates the declaration of a single typedef. The names of the
+// structs, unions and enums that have been defined are recorded in defined.
+func (g *generator) genTypedef(td *types.Typedef, defined map[*types.Type]string) {
+
+	t := td.Type
+	if td.Name == "" {
+		// A tagged declaration without a typedef.
+		if isDefinition(t) && g.tags[t.Tag] == goName(t.Tag) {
+			g.define(goName(t.Tag), t, td.Attrs)
+		}
+		return
+	}
+	name := goName(td.Name)
+	switch {
+	case td.Attrs.Contains("context_handle"):
+		g.usesDCERPC = true
+		g.printf("// %s is a context handle.\n", name)
+		g.printf("type %s struct {\n\tdcerpc.ContextHandle\n}\n\n", name)
+		g.printf("// %sContextType validates %s handles received by a server.\n", name, name)
+		g.printf("var %sContextType = dcerpc.ContextType{Name: %q", name, td.Name)
+		if g.strict {
+			g.printf(", Strict: true")
+		}
+		if td.Attrs.Contains("type_strict_context_handle") {
+			g.printf(", TypeStrict: true")
+		}
+		g.printf("}\n\n")
+	case isDefinition(t):
+		if _, ok := defined[t]; ok {
+			g.printf("type %s = %s\n\n", name, defined[t])
+			return
+		}
+		defined[t] = name
+		g.define(name, t, td.Attrs)
+	case t.Kind == types.Pointer:
+		// Pointer typedefs are aliases, so that *T and PT may be used
+		// interchangeably.
+		if base, ok := defined[derefDefinition(t)]; ok {
+			g.printf("type %s = %s%s\n\n", name, strings.Repeat("*", pointerDepth(t)), base)
+			return
+		}
+		g.printf("type %s = %s\n\n", name, g.goType(name, t, td.Attrs))
+	default:
+		g.printf("type %s %s\n\n", name, g.goType(name, t, td.Attrs))
+	}
+}
+
+// flush writes the anonymous types generated for the previous declaration.
+func (g *generator) flush() {
+	g.buf.Write(g.pending.Bytes())
+	g.pending.Reset()
+}
+
+// define generates the declaration of a struct, union or enum named name.
+func (g *generator) define(name string, t *types.Type, attrs types.FieldAttrList) {
+	switch t.Kind {
+	case types.Struct:
+		g.printf("type %s struct {\n", name)
+		for _, f := range t.Fields {
+			g.field(name, f, true)
+		}
+		g.printf("}\n\n")
+	case types.Union:
+		// The discriminant is the first field, and is followed by the
+		// arms. The discriminant of a union that is not encapsulated is
+		// given by the switch_is attribute of the field that holds it.
+		discriminant := t.Switch
+		if discriminant != nil {
+			g.printf("// %s is an encapsulated union discriminated by %s.\n", name, goName(t.Switch.Name))
+		} else if st, ok := attrs.Lookup("switch_type"); ok {
+			g.printf("// %s is a union discriminated by a value of type %s, which is held by Switch.\n", name, st)
+			discriminant = &types.Field{Name: "Switch", Type: &types.Type{Kind: types.Named, Name: strings.Join(strings.Fields(st), " ")}}
+		} else {
+			g.fail("%s is a union without a switch_type attribute", name)
+		}
+		g.printf("type %s struct {\n", name)
+		if discriminant != nil {
+			g.field(name, discriminant, true)
+		}
+		for _, arm := range t.Arms {
+			sel := types.FieldAttr{Type: "default"}
+			if !arm.Default {
+				sel = types.FieldAttr{Type: "case", Value: strings.Join(arm.Cases, ",")}
+			}
+			if arm.Field == nil {
+				g.printf("\t_ struct{}%s\n", g.tag(types.FieldAttrList{sel}))
+				continue
+			}
+			f := *arm.Field
+			f.Attrs = append(types.FieldAttrList{sel}, f.Attrs...)
+			g.field(name, &f, true)
+		}
+		g.printf("}\n\n")
+	case types.Enum:
+		g.declareEnumerators(t)
+		base := "int16"
+		if attrs.Contains("v1_enum") {
+			base = "int32"
+		}
+		g.printf("type %s %s\n\n", name, base)
+		if len(t.Enumerators) > 0 {
+			g.printf("const (\n")
+			for _, e := range t.Enumerators {
+				g.printf("\t%s %s = %s\n", goName(e.Name), name, g.consts[e.Name])
+			}
+			g.printf(")\n\n")
+		}
+	}
+}
+
+// field generates a struct field within the type named parent. Fields that
+// hold enums are marked with the attribute that selects their representation,
+// and fields that hold characters are marked with the char attribute.
+//
+// Fields that hold pointers are marked with their pointer attribute. If
+// embedded is false the field is a parameter that holds a top-level pointer,
+// which is a reference pointer unless it has another pointer attribute. A
+// top-level reference pointer is not transmitted, so such fields are left
+// unmarked.
+func (g *generator) field(parent string, f *types.Field, embedded bool) {
+	name := fieldName(f)
+	attrs := g.typedefAttrs(f.Type, f.Attrs)
+	if enum := g.enumAttr(f.Type); enum != "" && !attrs.Contains(enum) {
+		attrs = append(attrs[:len(attrs):len(attrs)], types.FieldAttr{Type: enum})
+	}
+	if g.isChars(f.Type, f.Attrs) && !attrs.Contains("char") {
+		attrs = append(attrs[:len(attrs):len(attrs)], types.FieldAttr{Type: "char"})
+	}
+	def := ""
+	if !embedded {
+		def = "ref"
+	}
+	switch kind := g.pointerKind(f.Type, f.Attrs, def); {
+	case kind == "ref" && !embedded:
+		attrs = withoutPointerAttrs(attrs)
+	case kind != "" && !attrs.Contains(pointerAttrs...):
+		attrs = append(attrs[:len(attrs):len(attrs)], types.FieldAttr{Type: kind})
+	}
+	if u := g.union(f.Type); u != nil && u.Switch == nil && !f.Attrs.Contains("switch_is") {
+		g.fail("%s holds a union that is not encapsulated and has no switch_is attribute", parent+name)
+	}
+	g.printf("\t%s %s%s\n", name, g.goType(parent+name, f.Type, g.typedefAttrs(f.Type, f.Attrs)), g.tag(attrs))
+}
+
+// typedefAttrs returns attrs followed by the attributes of the typedefs that
+// t refers to which apply to the fields and parameters declared with them,
+// such as range and string, unless attrs already includes them.
+func (g *generator) typedefAttrs(t *types.Type, attrs types.FieldAttrList) types.FieldAttrList {
+	_, all := g.resolve(t, nil)
+	for _, attr := range all {
+		if attr.Type != "range" && attr.Type != "string" || attrs.Contains(attr.Type) {
+			continue
+		}
+		attrs = append(attrs[:len(attrs):len(attrs)], attr)
+	}
+	return attrs
+}
+
+// resolve follows t through typedefs to its definition. It returns the
+// definition and the given attributes followed by those of the typedefs.
+func (g *generator) resolve(t *types.Type, attrs types.FieldAttrList) (*types.Type, types.FieldAttrList) {
+	for t.Kind == types.Named {
+		td, ok := g.typedefs[t.Name]
+		if !ok {
+			break
+		}
+		attrs = append(attrs[:len(attrs):len(attrs)], td.Attrs...)
+		t = td.Type
+	}
+	return t, attrs
+}
+
+// pointerKind returns ref, unique or ptr if t, which is declared with the
+// given attributes, is a pointer, or an empty string if it is not. Typedefs
+// are followed to their definitions, and the attributes of the declaration
+// take precedence over those of the typedefs. A pointer without a pointer
+// attribute is of the kind def, or of the pointer_default of the interface
+// if def is empty. Context handles are not pointers.
+func (g *generator) pointerKind(t *types.Type, attrs types.FieldAttrList, def string) string {
+	t, attrs = g.resolve(t, attrs)
+	if t.Kind != types.Pointer || attrs.Contains("context_handle") {
+		return ""
+	}
+	for _, attr := range attrs {
+		for _, kind := range pointerAttrs {
+			if attr.Type == kind {
+				return kind
+			}
+		}
+	}
+	if def == "" {
+		def = g.ptrDefault
+	}
+	if def == "" {
+		def = "unique"
+	}
+	return def
+}
+
+// union returns the definition of the union held by t, or referred to by a
+// pointer held by t, or nil if t does not hold a union.
+func (g *generator) union(t *types.Type) *types.Type {
+	t, _ = g.resolve(t, nil)
+	if t.Kind == types.Pointer {
+		t, _ = g.resolve(t.Elem, nil)
+	}
+	if t.Kind != types.Union {
+		return nil
+	}
+	if isDefinition(t) {
+		return t
+	}
+	for _, td := range g.typedefs {
+		if td.Type.Kind == types.Union && td.Type.Tag == t.Tag && isDefinition(td.Type) {
+			return td.Type
+		}
+	}
+	return nil
+}
+
+// enumAttr returns v1_enum or enum16 if t is an enum, depending on whether
+// the enum is declared with the v1_enum attribute, or an empty string if t is
+// not an enum.
+func (g *generator) enumAttr(t *types.Type) string {
+	var attrs types.FieldAttrList
+	for t.Kind == types.Named {
+		td, ok := g.typedefs[t.Name]
+		if !ok {
+			return ""
+		}
+		attrs = append(attrs, td.Attrs...)
+		t = td.Type
+	}
+	if t.Kind != types.Enum {
+		return ""
+	}
+	if !isDefinition(t) {
+		// The attributes of a tagged enum belong to the typedef that
+		// defines it.
+		for _, td := range g.typedefs {
+			if td.Type.Kind == types.Enum && td.Type.Tag == t.Tag && isDefinition(td.Type) {
+				attrs = append(attrs, td.Attrs...)
+				break
+			}
+		}
+	}
+	if attrs.Contains("v1_enum") {
+		return "v1_enum"
+	}
+	return "enum16"
+}
+
+// isChars returns true if t, which is declared with the given attributes,
+// holds narrow characters that are translated to the character representation
+// of the format label. Arrays and pointers are followed to their elements and
+// typedefs to their definitions.
+//
+// Interfaces commonly use unsigned char for octets, so only char holds
+// characters, unless the attributes include string.
+func (g *generator) isChars(t *types.Type, attrs types.FieldAttrList) bool {
+	for {
+		switch t.Kind {
+		case types.Pointer, types.Array:
+			t = t.Elem
+			continue
+		case types.Named:
+		default:
+			return false
+		}
+		switch t.Name {
+		case "char", "CHAR":
+			return true
+		case "unsigned char":
+			return attrs.Contains("string")
+		}
+		td, ok := g.typedefs[t.Name]
+		if !ok {
+			return false
+		}
+		attrs = append(attrs[:len(attrs):len(attrs)], td.Attrs...)
+		t = td.Type
+	}
+}
+
+// tag returns the idl struct tag for the given attributes.
+func (g *generator) tag(attrs types.FieldAttrList) string {
+	var parts []string
+	for _, attr := range attrs {
+		if strings.ContainsAny(attr.Value, "\"`") {
+			continue
+		}
+		if attr.Value == "" {
+			parts = append(parts, attr.Type)
+		} else {
+			parts = append(parts, attr.Type+"("+g.expr(attr.Value, true)+")")
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " `idl:\"" + strings.Join(parts, ",") + "\"`"
+}
+
+// goType returns the Go type of t, which is declared with the given
+// attributes. Anonymous structs, unions and enums are generated as types
+// with the given name.
+func (g *generator) goType(name string, t *types.Type, attrs types.FieldAttrList) string {
+	if attrs.Contains("context_handle") {
+		// A context handle declared by a parameter rather than a typedef.
+		g.usesDCERPC = true
+		return "dcerpc.ContextHandle"
+	}
+	switch t.Kind {
+	case types.Named:
+		if goType, ok := baseTypes[t.Name]; ok {
+			return goType
+		}
+		if t.Name == "void" || t.Name == "handle_t" {
+			g.fail("%s has type %s, which cannot be transmitted", name, t.Name)
+			return "struct{}"
+		}
+		if _, ok := g.typedefs[t.Name]; !ok {
+			g.fail("%s has unknown type %s", name, t.Name)
+		} else if rt, _ := g.resolve(t, nil); hasArrayAttrs(attrs) && rt.Kind == types.Pointer {
+			// A pointer typedef that refers to a conformant or varying
+			// array.
+			return "[]" + g.goType(name, rt.Elem, nil)
+		}
+		return goName(t.Name)
+	case types.Pointer:
+		if hasArrayAttrs(attrs) {
+			// The pointer refers to a conformant or varying array.
+			return "[]" + g.goType(name, t.Elem, nil)
+		}
+		if attrs.Contains("string") && g.isCharType(t.Elem) {
+			return "string"
+		}
+		if t.Elem.Kind == types.Named && t.Elem.Name == "void" {
+			g.fail("%s is an untyped pointer, which cannot be transmitted", name)
+			return "[]byte"
+		}
+		return "*" + g.goType(name, t.Elem, nil)
+	case types.Array:
+		elem := g.goType(name, t.Elem, nil)
+		if t.Size == "" {
+			if attrs.Contains("string") {
+				g.fail("%s is a conformant string held within a structure, which is not supported", name)
+			}
+			return "[]" + elem
+		}
+		// A fixed array with the string attribute is held as an array,
+		// whose characters are transmitted through the first null.
+		return "[" + g.expr(t.Size, true) + "]" + elem
+	case types.Pipe:
+		return "chan " + g.goType(name, t.Elem, nil)
+	}
+
+	if !isDefinition(t) {
+		if n, ok := g.tags[t.Tag]; ok {
+			return n
+		}
+		g.fail("%s has unknown type %s %s", name, t.Kind, t.Tag)
+		return goName(t.Tag)
+	}
+	if t.Tag != "" {
+		if n, ok := g.tags[t.Tag]; ok && n != name {
+			// Defined by its own declaration elsewhere.
+			return n
+		}
+	}
+
+	// An anonymous definition within a field or parameter is generated
+	// after the current declaration.
+	var nested bytes.Buffer
+	g.buf, nested = nested, g.buf
+	g.define(name, t, attrs)
+	g.buf, nested = nested, g.buf
+	g.pending.Write(nested.Bytes())
+	return name
+}
+
+// iface generates the bindings of an interface. It returns false if the
+// interface has no bindings.
+func (g *generator) iface(iface *types.Interface) bool {
+	if iface.Base != "" || iface.Attrs.Contains("object") {
+		g.warn("operations of object interface %s are not generated", iface.Name)
+		return false
+	}
+	if iface.Attrs.Contains("local") {
+		return false
+	}
+	name := goName(iface.Name)
+
+	g.printf("// %sInterface identifies the %s interface.\n", name, iface.Name)
+	g.printf("var %sInterface = dcerpc.Interface{\n", name)
+	g.printf("\tUUID: uuid.MustParse(%q),\n", iface.UUID.String())
+	g.printf("\tVersionMajor: %d,\n\tVersionMinor: %d,\n}\n\n", iface.VersionMajor, iface.VersionMinor)
+
+	ops := make([]*operation, len(iface.Operations))
+	for i, op := range iface.Operations {
+		ops[i] = g.operation(iface, op)
+		g.flush()
+	}
+
+	g.client(iface, ops)
+
+	// Server skeleton
+	g.printf("// %sServer is implemented by servers of the %s interface.\n", name, iface.Name)
+	g.printf("type %sServer interface {\n", name)
+	for _, op := range ops {
+		g.printf("\t%s(ctx context.Context, req *%s) (*%s, error)\n", op.name, op.request, op.response)
+	}
+	g.printf("}\n\n")
+	g.printf("// Register%sServer registers an implementation of the %s interface with s.\n", name, iface.Name)
+	g.printf("func Register%sServer(s *dcerpc.Server, srv %sServer) error {\n", name, name)
+	g.printf("\treturn s.Register(%sInterface, dcerpc.OperationTable{\n", name)
+	for _, op := range ops {
+		g.printf("\t\t%d: func(ctx context.Context, call *dcerpc.Call) error {\n", op.opnum)
+		if !op.wire {
+			g.printf("\t\t\tvar req %s\n", op.request)
+			g.printf("\t\t\tif err := call.DecodeRequest(&req); err != nil {\n\t\t\t\treturn err\n\t\t\t}\n")
+			g.printf("\t\t\tresp, err := srv.%s(ctx, &req)\n", op.name)
+			g.printf("\t\t\tif err != nil {\n\t\t\t\treturn err\n\t\t\t}\n")
+			for _, v := range op.hidden {
+				g.printf("\t\t\tresp.%s = req.%s\n", v.name, v.name)
+			}
+			g.printf("\t\t\treturn call.EncodeResponse(resp)\n\t\t},\n")
+			continue
+		}
+		g.printf("\t\t\tvar wreq %s\n", wireName(op.request))
+		g.printf("\t\t\tif err := call.DecodeRequest(&wreq); err != nil {\n\t\t\t\treturn err\n\t\t\t}\n")
+		g.printf("\t\t\tresp, err := srv.%s(ctx, &%s)\n", op.name, convert(op.request, "wreq", op.in, true))
+		g.printf("\t\t\tif err != nil {\n\t\t\t\treturn err\n\t\t\t}\n")
+		for _, v := range op.hidden {
+			g.printf("\t\t\tresp.%s = %s\n", v.name, v.convert("wreq", true))
+		}
+		g.printf("\t\t\treturn call.EncodeResponse(&%s)\n\t\t},\n", convert(wireName(op.response), "resp", op.out, false))
+	}
+	g.printf("\t})\n}\n\n")
+	return true
+}
+
+// client generates the client type and stubs of an interface. Operations
+// with the nocode attribute, or without the code attribute when the
+// interface has the nocode attribute, have no client stub.
+func (g *generator) client(iface *types.Interface, ops []*operation) {
+	name := goName(iface.Name)
+	var stubs []*operation
+	for _, op := range ops {
+		if op.code {
+			stubs = append(stubs, op)
+		}
+	}
+	if len(stubs) == 0 {
+		return
+	}
+
+	g.printf("// %sClient makes calls on the %s interface.\n", name, iface.Name)
+	g.printf("type %sClient struct {\n\tHandle *dcerpc.Handle\n}\n\n", name)
+	g.printf("// New%sClient returns a client for the %s interface of the server identified by b.\n", name, iface.Name)
+	g.printf("func New%sClient(c *dcerpc.Client, b dcerpc.Binding) *%sClient {\n", name, name)
+	g.printf("\treturn &%sClient{Handle: c.Handle(b, %sInterface)}\n}\n\n", name, name)
+	for _, op := range stubs {
+		g.stub(name, iface, op)
+	}
+
+	// An implicit binding handle is a package variable that is used by
+	// package level stubs, and an explicit one is their first argument.
+	implicit := ""
+	if v, ok := iface.Attrs.Lookup("implicit_handle"); ok {
+		words := strings.Fields(v)
+		if len(words) < 2 {
+			g.warn("implicit_handle of interface %s does not name a handle", iface.Name)
+		} else {
+			if typ := strings.Join(words[:len(words)-1], " "); typ != "handle_t" {
+				g.warn("implicit handle %s of interface %s has type %s and is bound with a dcerpc.Handle", words[len(words)-1], iface.Name, typ)
+			}
+			implicit = goName(words[len(words)-1])
+			g.printf("// %s is the implicit binding handle of the %s interface.\n", implicit, iface.Name)
+			g.printf("var %s *dcerpc.Handle\n\n", implicit)
+		}
+	}
+	for _, op := range stubs {
+		params, results := op.signature()
+		switch {
+		case op.explicit:
+			g.printf("// %s calls operation %d of the %s interface with the binding handle h.\n", op.name, op.opnum, iface.Name)
+			g.printf("func %s(ctx context.Context, h *dcerpc.Handle, %s) %s {\n", op.name, params, results)
+			g.printf("\treturn (&%sClient{Handle: h}).%s(ctx, req)\n}\n\n", name, op.name)
+		case implicit != "":
+			g.printf("// %s calls operation %d of the %s interface with the binding handle %s.\n", op.name, op.opnum, iface.Name, implicit)
+			g.printf("func %s(ctx context.Context, %s) %s {\n", op.name, params, results)
+			g.printf("\treturn (&%sClient{Handle: %s}).%s(ctx, req)\n}\n\n", name, implicit, op.name)
+		}
+	}
+}
+
+// stub generates the client stub of an operation.
+func (g *generator) stub(client string, iface *types.Interface, op *operation) {
+	params, results := op.signature()
+	g.printf("// %s calls operation %d of the %s interface.\n", op.name, op.opnum, iface.Name)
+	switch {
+	case op.fault.name != "" && op.fault == op.comm:
+		g.printf("// Faults and communication failures are returned in %s.\n", op.fault.describe())
+	case op.fault.name != "" || op.comm.name != "":
+		if op.fault.name != "" {
+			g.printf("// Faults are returned in %s.\n", op.fault.describe())
+		}
+		if op.comm.name != "" {
+			g.printf("// Communication failures are returned in %s.\n", op.comm.describe())
+		}
+	}
+	g.printf("func (c *%sClient) %s(ctx context.Context, %s) %s {\n", client, op.name, params, results)
+
+	var statuses []string
+	for _, p := range op.added {
+		g.printf("\tvar %s uint32\n", p)
+		statuses = append(statuses, ", "+p)
+	}
+	status := strings.Join(statuses, "")
+	req, resp := "req", "resp"
+	g.printf("\tvar resp %s\n", op.response)
+	if op.wire {
+		g.printf("\twreq := %s\n", convert(wireName(op.request), "req", op.in, false))
+		g.printf("\tvar wresp %s\n", wireName(op.response))
+		req, resp = "wreq", "wresp"
+	}
+	// The attributes of the response refer to the hidden parameters, which
+	// are not transmitted in it.
+	for _, v := range op.hidden {
+		g.printf("\t%s.%s = %s.%s\n", resp, v.name, req, v.name)
+	}
+	if op.wire {
+		req = "&" + req
+	}
+	resp = "&" + resp
+	g.printf("\tif err := c.Handle.Invoke(ctx, %d, %s, %s); err != nil {\n", op.opnum, req, resp)
+	switch {
+	case op.fault.name != "":
+		g.printf("\t\tif fault, ok := err.(*dcerpc.Fault); ok {\n")
+		g.printf("\t\t\t%s = fault.Status\n", op.fault.ref())
+		g.printf("\t\t\treturn &resp%s, nil\n\t\t}\n", status)
+	case op.comm.name != "":
+		g.printf("\t\tif _, ok := err.(*dcerpc.Fault); ok {\n")
+		g.printf("\t\t\treturn nil%s, err\n\t\t}\n", strings.Repeat(", 0", len(op.added)))
+	}
+	if op.comm.name != "" {
+		g.usesPDU = true
+		g.printf("\t\t%s = pdu.StatusCommFailure\n", op.comm.ref())
+		g.printf("\t\treturn &resp%s, nil\n\t}\n", status)
+	} else {
+		g.printf("\t\treturn nil%s, err\n\t}\n", strings.Repeat(", 0", len(op.added)))
+	}
+	if op.wire {
+		g.printf("\tresp = %s\n", convert(op.response, "wresp", op.out, true))
+	}
+	g.printf("\treturn &resp%s, nil\n}\n\n", status)
+}
+
+// operation describes the generated declarations of an operation.
+type operation struct {
+	name     string
+	opnum    uint16
+	request  string
+	response string
+
+	in  []value // Fields of the request
+	out []value // Fields of the response
+
+	// hidden are the [in] parameters that are held by the response, but
+	// not transmitted in it, because the attributes of [out] parameters
+	// refer to them.
+	hidden []value
+
+	// wire is true if the request or response has a field with a local
+	// representation, which requires separate structures for transmission.
+	wire bool
+
+	code     bool // A client stub is generated
+	explicit bool // The binding handle is an explicit argument
+
+	comm  status   // The value that receives communication failures
+	fault status   // The value that receives server faults
+	added []string // Status parameters added by the configuration file
+}
+
+// value is a field of a request or response.
+type value struct {
+	name string
+
+	// When the field has a local representation, fromLocal and toLocal
+	// name the functions that convert it to and from its transmitted type.
+	fromLocal string
+	toLocal   string
+}
+
+// status identifies a status value of a client stub, which is either a
+// field of the response or a result that was added by an application
+// configuration file.
+type status struct {
+	name   string
+	result int // The position of an added result, or zero for a field
+}
+
+// ordinals describe the positions of the results of a client stub.
+var ordinals = []string{"first", "second", "third", "fourth"}
+
+func (s status) ref() string {
+	if s.result > 0 {
+		return s.name
+	}
+	return "resp." + s.name
+}
+
+func (s status) describe() string {
+	if s.result > 0 {
+		return "the " + ordinals[s.result] + " result"
+	}
+	return "the " + s.name + " field of the response"
+}
+
+// signature returns the parameters following the context of the client stub
+// and its results.
+func (o *operation) signature() (params, results string) {
+	results = "(*" + o.response
+	for range o.added {
+		results += ", uint32"
+	}
+	return "req *" + o.request, results + ", error)"
+}
+
+// convert returns a composite literal of the struct typ that copies the
+// given fields of the variable v. If toLocal is true the transmitted fields
+// of v are converted to their local representation, otherwise local fields
+// are converted to the transmitted types.
+func convert(typ, v string, fields []value, toLocal bool) string {
+	var b strings.Builder
+	b.WriteString(typ + "{")
+	for i, f := range fields {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "%s: %s", f.name, f.convert(v, toLocal))
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// convert returns an expression that converts the field of the variable v
+// to its local representation, if toLocal is true, or to its transmitted
+// type.
+func (f value) convert(v string, toLocal bool) string {
+	fn := f.fromLocal
+	if toLocal {
+		fn = f.toLocal
+	}
+	if fn == "" {
+		return v + "." + f.name
+	}
+	return fn + "(" + v + "." + f.name + ")"
+}
+
+// wireName returns the name of the structure that transmits the request or
+// response named name.
+func wireName(name string) string {
+	return "wire" + name
+}
+
+// operation generates the request and response structures of an operation.
+func (g *generator) operation(iface *types.Interface, op *types.Operation) *operation {
+	o := &operation{
+		name:     goName(op.Name),
+		opnum:    op.OpNum,
+		request:  goName(op.Name) + "Request",
+		response: goName(op.Name) + "Response",
+		code:     op.Attrs.Contains("code") || !op.Attrs.Contains("nocode") && !iface.Attrs.Contains("nocode"),
+		explicit: op.Attrs.Contains("explicit_handle") || iface.Attrs.Contains("explicit_handle"),
+	}
+
+	var in, out []param
+	inOnly := make(map[string]param)
+	for _, p := range op.Params {
+		if isHandle(p.Type) {
+			// Primitive binding handles are not transmitted.
+			continue
+		}
+		f := g.param(p)
+		if !p.In() && !p.Out() {
+			// A status parameter added by the configuration file.
+			o.added = append(o.added, localName(p.Name))
+			o.setStatus(p.Attrs, status{name: localName(p.Name), result: len(o.added)})
+			continue
+		}
+		if p.In() {
+			in = append(in, f)
+			if !p.Out() {
+				inOnly[p.Name] = f
+			}
+		}
+		if p.Out() {
+			out = append(out, f)
+			o.setStatus(p.Attrs, status{name: fieldName(f.Field)})
+		}
+	}
+	if ret := op.Return; ret != nil && !(ret.Kind == types.Named && ret.Name == "void") {
+		out = append(out, param{Field: &types.Field{Name: "Return", Attrs: types.FieldAttrList{{Type: "out"}}, Type: ret}, embedded: true})
+		o.setStatus(op.Attrs, status{name: "Return"})
+	}
+
+	// Pipes are transmitted after the other [in] parameters and before the
+	// other [out] parameters.
+	in = g.orderPipes(in, false)
+	out = g.orderPipes(out, true)
+
+	// The [in] parameters that the attributes of [out] parameters refer to
+	// precede the [out] parameters in the response.
+	var hidden []param
+	for _, f := range out {
+		for _, attr := range f.Attrs {
+			if !isExprAttr(attr.Type) {
+				continue
+			}
+			for _, id := range identifiers(attr.Value) {
+				if h, ok := inOnly[id]; ok {
+					h.hidden = true
+					hidden = append(hidden, h)
+					delete(inOnly, id)
+				}
+			}
+		}
+	}
+	out = append(hidden, out...)
+
+	o.in = g.values(in)
+	o.out = g.values(out)
+	o.hidden = o.out[:len(hidden)]
+	for _, v := range append(o.in, o.out...) {
+		if v.fromLocal != "" {
+			o.wire = true
+		}
+	}
+
+	g.params(o.request, "holds the input parameters of "+op.Name, in, o.wire)
+	g.params(o.response, "holds the output parameters of "+op.Name, out, o.wire)
+	if o.wire {
+		g.params(wireName(o.request), "transmits the input parameters of "+op.Name, in, false)
+		g.params(wireName(o.response), "transmits the output parameters of "+op.Name, out, false)
+	}
+	return o
+}
+
+// orderPipes returns the given fields with the pipes moved to the start, if
+// first is true, or to the end. The fields are otherwise kept in order.
+func (g *generator) orderPipes(fields []param, first bool) []param {
+	var pipes, others []param
+	for _, f := range fields {
+		if g.isPipe(f.Type) {
+			pipes = append(pipes, f)
+		} else {
+			others = append(others, f)
+		}
+	}
+	if first {
+		return append(pipes, others...)
+	}
+	return append(others, pipes...)
+}
+
+// isPipe returns true if t is a pipe, following typedefs to their
+// definitions.
+func (g *generator) isPipe(t *types.Type) bool {
+	for t.Kind == types.Named {
+		td, ok := g.typedefs[t.Name]
+		if !ok {
+			return false
+		}
+		t = td.Type
+	}
+	return t.Kind == types.Pipe
+}
+
+// setStatus records v as the status value for the comm_status and
+// fault_status attributes in attrs.
+func (o *operation) setStatus(attrs types.FieldAttrList, v status) {
+	if attrs.Contains("comm_status") {
+		o.comm = v
+	}
+	if attrs.Contains("fault_status") {
+		o.fault = v
+	}
+}
+
+// values describes the given fields of a request or response, and the
+// conversions of those with a local representation.
+func (g *generator) values(fields []param) []value {
+	values := make([]value, len(fields))
+	for i, f := range fields {
+		values[i].name = fieldName(f.Field)
+		if td, local := g.represent(f.Type); local != "" {
+			values[i].fromLocal = goName(td.Name) + "FromLocal"
+			values[i].toLocal = goName(td.Name) + "ToLocal"
+		}
+	}
+	return values
+}
+
+// represent returns the typedef of t and the Go name of its local type if
+// the typedef has the represent_as attribute.
+func (g *generator) represent(t *types.Type) (*types.Typedef, string) {
+	if t.Kind != types.Named {
+		return nil, ""
+	}
+	td, ok := g.typedefs[t.Name]
+	if !ok {
+		return nil, ""
+	}
+	local, ok := td.Attrs.Lookup("represent_as")
+	if !ok {
+		return nil, ""
+	}
+	return td, goName(strings.TrimSpace(local))
+}
+
+// params generates a structure that holds the given parameters. If local is
+// true, fields are declared with their local representation.
+func (g *generator) params(name, doc string, fields []param, local bool) {
+	g.printf("// %s %s.\n", name, doc)
+	g.printf("type %s struct {\n", name)
+	for _, f := range fields {
+		_, typ := g.represent(f.Type)
+		switch {
+		case local && typ != "":
+			g.printf("\t%s %s\n", fieldName(f.Field), typ)
+		case f.hidden:
+			g.printf("\t%s %s `idl:\"-\"`\n", fieldName(f.Field), g.goType(name+fieldName(f.Field), f.Type, f.Attrs))
+		default:
+			g.field(name, f.Field, f.embedded)
+		}
+	}
+	g.printf("}\n\n")
+}
+
+// param is a field of a request or response structure.
+type param struct {
+	*types.Field
+
+	// embedded is false if the field holds the top-level pointer of the
+	// parameter, rather than a pointer embedded within its referent.
+	embedded bool
+
+	// hidden is true if the field holds an [in] parameter within the
+	// response. Its value is copied from the request.
+	hidden bool
+}
+
+// param returns the field that holds the parameter p as it is transmitted,
+// with the type given by paramType. The pointers that remain after the
+// top-level pointer is removed are embedded within its referent.
+func (g *generator) param(p *types.Param) param {
+	f := &types.Field{Name: p.Name, Attrs: p.Attrs, Type: paramType(p)}
+	if f.Type != p.Type {
+		f.Attrs = withoutPointerAttrs(g.typedefAttrs(f.Type, f.Attrs))
+		return param{Field: f, embedded: true}
+	}
+	if t := f.Type; t.Kind == types.Array && t.Size == "" && f.Attrs.Contains("string") {
+		// A conformant string is passed as a pointer to its characters.
+		f.Type = &types.Type{Kind: types.Pointer, Elem: t.Elem}
+	}
+	if f.Type.Kind == types.Named && !hasArrayAttrs(f.Attrs) {
+		// A typedef of a top-level reference pointer is replaced by its
+		// referent, unless it refers to a string.
+		rt, attrs := g.resolve(f.Type, f.Attrs)
+		if g.pointerKind(f.Type, f.Attrs, "ref") == "ref" && !attrs.Contains("string") {
+			// The attributes of the typedefs, such as range, apply to
+			// the referent.
+			f.Type = rt.Elem
+			f.Attrs = withoutPointerAttrs(g.typedefAttrs(f.Type, attrs))
+			return param{Field: f, embedded: true}
+		}
+	}
+	return param{Field: f}
+}
+
+// fieldName returns the Go name of a field.
+func fieldName(f *types.Field) string {
+	if name := goName(f.Name); name != "" {
+		return name
+	}
+	return "Value"
+}
+
+// localName returns the name of a local variable for an IDL identifier, which
+// is unexported and does not collide with the variables of a client stub.
+func localName(s string) string {
+	s = strings.TrimLeft(s, "_")
+	if c := s[0]; c >= 'A' && c <= 'Z' {
+		s = string(c-'A'+'a') + s[1:]
+	}
+	switch s {
+	case "c", "ctx", "req", "resp", "wreq", "wresp", "err", "fault", "ok":
+		s += "Status"
+	}
+	return s
+}
+
+// paramType returns the type of a parameter as it is transmitted. The
+// top-level pointer of an [out]-only parameter or of a reference pointer is
+// not transmitted, so it is removed, unless it refers to an array or a
+// string. The top-level unique or full pointer of an [in] parameter is
+// transmitted, so that it may be null.
+func paramType(p *types.Param) *types.Type {
+	t := p.Type
+	if t.Kind != types.Pointer || hasArrayAttrs(p.Attrs) || p.Attrs.Contains("string") {
+		return t
+	}
+	if !p.In() || !p.Attrs.Contains("unique", "ptr") {
+		return t.Elem
+	}
+	return t
+}
+
+// expr translates an IDL expression into Go. Numeric suffixes and the L
+// prefix of wide literals are removed and identifiers are translated with
+// goName. If inline is true, constants with known values are replaced by
+// their values.
+func (g *generator) expr(s string, inline bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(s) && s[j] != c {
+				if s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j < len(s) {
+				j++
+			}
+			b.WriteString(s[i:j])
+			i = j
+		case isIdentPart(c):
+			j := i
+			for j < len(s) && (isIdentPart(s[j]) || s[j] == '.' && isDigit(c)) {
+				j++
+			}
+			if w := s[i:j]; w == "L" && j < len(s) && (s[j] == '"' || s[j] == '\'') {
+				// A wide character or string literal.
+			} else {
+				b.WriteString(g.word(w, inline))
+			}
+			i = j
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+// word translates a single identifier or number of an expression.
+func (g *generator) word(w string, inline bool) string {
+	if isDigit(w[0]) {
+		return strings.TrimRight(w, "uUlL")
+	}
+	if v, ok := g.consts[w]; ok && inline {
+		return v
+	}
+	return goName(w)
+}
+
+// goName returns the Go identifier for an IDL identifier, which is exported
+// and has no leading underscores.
+func goName(s string) string {
+	s = strings.TrimLeft(s, "_")
+	if s == "" {
+		return s
+	}
+	if c := s[0]; c >= 'a' && c <= 'z' {
+		return string(c-'a'+'A') + s[1:]
+	}
+	return s
+}
+
+// parseInt parses an integer constant expression that consists of a single
+// literal, possibly parenthesized.
+func parseInt(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	for len(s) > 1 && s[0] == '(' && s[len(s)-1] == ')' {
+		s = strings.TrimSpace(s[1 : len(s)-1])
+	}
+	return strconv.ParseInt(s, 0, 64)
+}
+
+// isDefinition returns true if t is a struct, union or enum with a body.
+func isDefinition(t *types.Type) bool {
+	switch t.Kind {
+	case types.Struct:
+		return t.Fields != nil
+	case types.Union:
+		return t.Arms != nil
+	case types.Enum:
+		return t.Enumerators != nil
+	}
+	return false
+}
+
+// derefDefinition returns the type that t points to through one or more
+// pointers.
+func derefDefinition(t *types.Type) *types.Type {
+	for t.Kind == types.Pointer {
+		t = t.Elem
+	}
+	return t
+}
+
+func pointerDepth(t *types.Type) (n int) {
+	for ; t.Kind == types.Pointer; t = t.Elem {
+		n++
+	}
+	return
+}
+
+func hasArrayAttrs(attrs types.FieldAttrList) bool {
+	return attrs.Contains(arrayAttrs...)
+}
+
+func isExprAttr(name string) bool {
+	for _, attr := range exprAttrs {
+		if attr == name {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutPointerAttrs returns attrs without their pointer attributes.
+func withoutPointerAttrs(attrs types.FieldAttrList) types.FieldAttrList {
+	var out types.FieldAttrList
+	for _, attr := range attrs {
+		if attr.Type != "ref" && attr.Type != "unique" && attr.Type != "ptr" {
+			out = append(out, attr)
+		}
+	}
+	return out
+}
+
+// identifiers returns the identifiers that appear in the expression s.
+func identifiers(s string) []string {
+	var ids []string
+	for i := 0; i < len(s); {
+		if !isIdentPart(s[i]) {
+			i++
+			continue
+		}
+		j := i
+		for j < len(s) && isIdentPart(s[j]) {
+			j++
+		}
+		if !isDigit(s[i]) {
+			ids = append(ids, s[i:j])
+		}
+		i = j
+	}
+	return ids
+}
+
+// isCharType returns true if t is a character type that may hold a string.
+// Typedefs are followed to their definitions.
+func (g *generator) isCharType(t *types.Type) bool {
+	for t.Kind == types.Named {
+		switch t.Name {
+		case "char", "unsigned char", "wchar_t", "unsigned short", "WCHAR", "CHAR":
+			return true
+		}
+		td, ok := g.typedefs[t.Name]
+		if !ok {
+			return false
+		}
+		t = td.Type
+	}
+	return false
+}
+
+func isHandle(t *types.Type) bool {
+	return t.Kind == types.Named && t.Name == "handle_t"
+}
+
+func isIdentPart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || isDigit(c)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
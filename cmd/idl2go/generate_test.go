@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// goldenDir holds a package for each golden file, with the IDL file that
+// it is generated from.
+const goldenDir = "internal/golden"
+
+func TestGolden(t *testing.T) {
+	idls, err := filepath.Glob(filepath.Join(goldenDir, "*", "*.idl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idls) == 0 {
+		t.Fatal("no golden files found")
+	}
+	for _, idl := range idls {
+		name := strings.TrimSuffix(filepath.Base(idl), ".idl")
+		t.Run(name, func(t *testing.T) {
+			g := newGenerator(nil)
+			if err := g.load(idl, true); err != nil {
+				t.Fatal(err)
+			}
+			src, err := g.generate("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden := filepath.Join(filepath.Dir(idl), name+".go")
+			if *update {
+				if err := os.WriteFile(golden, src, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(src, want) {
+				t.Errorf("generated code differs from %s; run go test -update to update it", golden)
+			}
+		})
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		idl  string
+		want string
+	}{
+		{
+			name: "unknown-type",
+			idl:  "long F([in] WCHAR c, [out] NTSTATUS *s);",
+			want: "FRequestC has unknown type WCHAR",
+		},
+		{
+			name: "unknown-struct",
+			idl:  "typedef struct { struct _MISSING *m; } S;",
+			want: "SM has unknown type struct _MISSING",
+		},
+		{
+			name: "handle-field",
+			idl:  "typedef struct { handle_t h; } S;",
+			want: "SH has type handle_t, which cannot be transmitted",
+		},
+		{
+			name: "untyped-pointer",
+			idl:  "typedef struct { void *p; } S;",
+			want: "SP is an untyped pointer",
+		},
+		{
+			name: "union-without-switch-type",
+			idl:  "typedef union { [case(1)] long a; } U;",
+			want: "U is a union without a switch_type attribute",
+		},
+		{
+			name: "union-without-switch-is",
+			idl:  "typedef [switch_type(short)] union { [case(1)] long a; } U;\ntypedef struct { U u; } S;",
+			want: "SU holds a union that is not encapsulated and has no switch_is attribute",
+		},
+		{
+			name: "conformant-string",
+			idl:  "typedef struct { long n; [string] wchar_t s[]; } S;",
+			want: "SS is a conformant string",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.idl")
+			src := "[uuid(11111111-2222-3333-4444-555555555555), version(1.0)]\ninterface test\n{\n" + tt.idl + "\n}\n"
+			if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			g := newGenerator(nil)
+			if err := g.load(path, true); err != nil {
+				t.Fatal(err)
+			}
+			src2, err := g.generate("")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("generate returned %v, want an error containing %q", err, tt.want)
+			}
+			if src2 != nil {
+				t.Fatal("generate returned code along with its error")
+			}
+		})
+	}
+}
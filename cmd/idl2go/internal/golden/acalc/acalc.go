@@ -0,0 +1,210 @@
+// Code generated by idl2go from acalc.idl. DO NOT EDIT.
+
+package acalc
+
+import (
+	"context"
+
+	"github.com/gentlemanautomaton/dcerpc"
+	"github.com/gentlemanautomaton/dcerpc/pdu"
+	"github.com/gentlemanautomaton/dcerpc/uuid"
+)
+
+type PAIR struct {
+	Hi int32
+	Lo int32
+}
+
+// AcalcInterface identifies the acalc interface.
+var AcalcInterface = dcerpc.Interface{
+	UUID:         uuid.MustParse("11111111-2222-3333-4444-666666666666"),
+	VersionMajor: 1,
+	VersionMinor: 0,
+}
+
+// DivRequest holds the input parameters of Div.
+type DivRequest struct {
+	A int32 `idl:"in"`
+	B int32 `idl:"in"`
+}
+
+// DivResponse holds the output parameters of Div.
+type DivResponse struct {
+	Q      int32  `idl:"out"`
+	Return uint32 `idl:"out"`
+}
+
+// SwapRequest holds the input parameters of Swap.
+type SwapRequest struct {
+	P Local
+}
+
+// SwapResponse holds the output parameters of Swap.
+type SwapResponse struct {
+	R  Local
+	St uint32 `idl:"out,fault_status"`
+}
+
+// wireSwapRequest transmits the input parameters of Swap.
+type wireSwapRequest struct {
+	P PAIR `idl:"in"`
+}
+
+// wireSwapResponse transmits the output parameters of Swap.
+type wireSwapResponse struct {
+	R  PAIR   `idl:"out"`
+	St uint32 `idl:"out,fault_status"`
+}
+
+// FailRequest holds the input parameters of Fail.
+type FailRequest struct {
+	A int32 `idl:"in"`
+}
+
+// FailResponse holds the output parameters of Fail.
+type FailResponse struct {
+}
+
+// HiddenRequest holds the input parameters of Hidden.
+type HiddenRequest struct {
+}
+
+// HiddenResponse holds the output parameters of Hidden.
+type HiddenResponse struct {
+}
+
+// AcalcClient makes calls on the acalc interface.
+type AcalcClient struct {
+	Handle *dcerpc.Handle
+}
+
+// NewAcalcClient returns a client for the acalc interface of the server identified by b.
+func NewAcalcClient(c *dcerpc.Client, b dcerpc.Binding) *AcalcClient {
+	return &AcalcClient{Handle: c.Handle(b, AcalcInterface)}
+}
+
+// Div calls operation 0 of the acalc interface.
+// Faults and communication failures are returned in the Return field of the response.
+func (c *AcalcClient) Div(ctx context.Context, req *DivRequest) (*DivResponse, error) {
+	var resp DivResponse
+	if err := c.Handle.Invoke(ctx, 0, req, &resp); err != nil {
+		if fault, ok := err.(*dcerpc.Fault); ok {
+			resp.Return = fault.Status
+			return &resp, nil
+		}
+		resp.Return = pdu.StatusCommFailure
+		return &resp, nil
+	}
+	return &resp, nil
+}
+
+// Swap calls operation 1 of the acalc interface.
+// Faults are returned in the St field of the response.
+func (c *AcalcClient) Swap(ctx context.Context, req *SwapRequest) (*SwapResponse, error) {
+	var resp SwapResponse
+	wreq := wireSwapRequest{P: PAIRFromLocal(req.P)}
+	var wresp wireSwapResponse
+	if err := c.Handle.Invoke(ctx, 1, &wreq, &wresp); err != nil {
+		if fault, ok := err.(*dcerpc.Fault); ok {
+			resp.St = fault.Status
+			return &resp, nil
+		}
+		return nil, err
+	}
+	resp = SwapResponse{R: PAIRToLocal(wresp.R), St: wresp.St}
+	return &resp, nil
+}
+
+// Fail calls operation 2 of the acalc interface.
+// Faults are returned in the second result.
+// Communication failures are returned in the third result.
+func (c *AcalcClient) Fail(ctx context.Context, req *FailRequest) (*FailResponse, uint32, uint32, error) {
+	var fst uint32
+	var cst uint32
+	var resp FailResponse
+	if err := c.Handle.Invoke(ctx, 2, req, &resp); err != nil {
+		if fault, ok := err.(*dcerpc.Fault); ok {
+			fst = fault.Status
+			return &resp, fst, cst, nil
+		}
+		cst = pdu.StatusCommFailure
+		return &resp, fst, cst, nil
+	}
+	return &resp, fst, cst, nil
+}
+
+// HAcalc is the implicit binding handle of the acalc interface.
+var HAcalc *dcerpc.Handle
+
+// Div calls operation 0 of the acalc interface with the binding handle HAcalc.
+func Div(ctx context.Context, req *DivRequest) (*DivResponse, error) {
+	return (&AcalcClient{Handle: HAcalc}).Div(ctx, req)
+}
+
+// Swap calls operation 1 of the acalc interface with the binding handle HAcalc.
+func Swap(ctx context.Context, req *SwapRequest) (*SwapResponse, error) {
+	return (&AcalcClient{Handle: HAcalc}).Swap(ctx, req)
+}
+
+// Fail calls operation 2 of the acalc interface with the binding handle HAcalc.
+func Fail(ctx context.Context, req *FailRequest) (*FailResponse, uint32, uint32, error) {
+	return (&AcalcClient{Handle: HAcalc}).Fail(ctx, req)
+}
+
+// AcalcServer is implemented by servers of the acalc interface.
+type AcalcServer interface {
+	Div(ctx context.Context, req *DivRequest) (*DivResponse, error)
+	Swap(ctx context.Context, req *SwapRequest) (*SwapResponse, error)
+	Fail(ctx context.Context, req *FailRequest) (*FailResponse, error)
+	Hidden(ctx context.Context, req *HiddenRequest) (*HiddenResponse, error)
+}
+
+// RegisterAcalcServer registers an implementation of the acalc interface with s.
+func RegisterAcalcServer(s *dcerpc.Server, srv AcalcServer) error {
+	return s.Register(AcalcInterface, dcerpc.OperationTable{
+		0: func(ctx context.Context, call *dcerpc.Call) error {
+			var req DivRequest
+			if err := call.DecodeRequest(&req); err != nil {
+				return err
+			}
+			resp, err := srv.Div(ctx, &req)
+			if err != nil {
+				return err
+			}
+			return call.EncodeResponse(resp)
+		},
+		1: func(ctx context.Context, call *dcerpc.Call) error {
+			var wreq wireSwapRequest
+			if err := call.DecodeRequest(&wreq); err != nil {
+				return err
+			}
+			resp, err := srv.Swap(ctx, &SwapRequest{P: PAIRToLocal(wreq.P)})
+			if err != nil {
+				return err
+			}
+			return call.EncodeResponse(&wireSwapResponse{R: PAIRFromLocal(resp.R), St: resp.St})
+		},
+		2: func(ctx context.Context, call *dcerpc.Call) error {
+			var req FailRequest
+			if err := call.DecodeRequest(&req); err != nil {
+				return err
+			}
+			resp, err := srv.Fail(ctx, &req)
+			if err != nil {
+				return err
+			}
+			return call.EncodeResponse(resp)
+		},
+		3: func(ctx context.Context, call *dcerpc.Call) error {
+			var req HiddenRequest
+			if err := call.DecodeRequest(&req); err != nil {
+				return err
+			}
+			resp, err := srv.Hidden(ctx, &req)
+			if err != nil {
+				return err
+			}
+			return call.EncodeResponse(resp)
+		},
+	})
+}
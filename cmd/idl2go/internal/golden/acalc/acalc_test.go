@@ -0,0 +1,92 @@
+package acalc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/gentlemanautomaton/dcerpc"
+	"github.com/gentlemanautomaton/dcerpc/pdu"
+)
+
+type server struct{}
+
+func (server) Div(ctx context.Context, req *DivRequest) (*DivResponse, error) {
+	if req.B == 0 {
+		return nil, &dcerpc.Fault{Status: pdu.StatusIntDivByZero}
+	}
+	return &DivResponse{Q: req.A / req.B}, nil
+}
+
+func (server) Swap(ctx context.Context, req *SwapRequest) (*SwapResponse, error) {
+	return &SwapResponse{R: Local{A: req.P.B, B: req.P.A}}, nil
+}
+
+func (server) Fail(ctx context.Context, req *FailRequest) (*FailResponse, error) {
+	return nil, &dcerpc.Fault{Status: uint32(req.A)}
+}
+
+func (server) Hidden(ctx context.Context, req *HiddenRequest) (*HiddenResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+// connect returns a client whose connections are served by srv.
+func connect(srv *dcerpc.Server) *dcerpc.Client {
+	dial := dcerpc.DialerFunc(func(ctx context.Context, b dcerpc.Binding) (io.ReadWriteCloser, error) {
+		client, server := net.Pipe()
+		go srv.ServeConn(context.Background(), server)
+		return client, nil
+	})
+	return &dcerpc.Client{Dialers: map[string]dcerpc.Dialer{dcerpc.ProtSeqTCP: dial}}
+}
+
+var binding = dcerpc.Binding{ProtSeq: dcerpc.ProtSeqTCP, NetworkAddr: "server", Endpoint: "135"}
+
+func TestConfiguration(t *testing.T) {
+	var srv dcerpc.Server
+	if err := RegisterAcalcServer(&srv, server{}); err != nil {
+		t.Fatal(err)
+	}
+	c := connect(&srv)
+	defer c.Close()
+	HAcalc = NewAcalcClient(c, binding).Handle
+	ctx := context.Background()
+
+	// The implicit handle is used by the package level stubs, and faults
+	// are returned in the status values.
+	div, err := Div(ctx, &DivRequest{A: 9, B: 3})
+	if err != nil || div.Q != 3 || div.Return != 0 {
+		t.Fatalf("Div(9, 3) returned %+v, %v", div, err)
+	}
+	div, err = Div(ctx, &DivRequest{A: 9, B: 0})
+	if err != nil || div.Return != pdu.StatusIntDivByZero {
+		t.Fatalf("Div(9, 0) returned %+v, %v", div, err)
+	}
+
+	// PAIR is converted to and from its local representation.
+	swap, err := Swap(ctx, &SwapRequest{P: Local{A: 1, B: 2}})
+	if err != nil || swap.R != (Local{A: 2, B: 1}) || swap.St != 0 {
+		t.Fatalf("Swap returned %+v, %v", swap, err)
+	}
+
+	// Status parameters added by the configuration file are results.
+	_, fst, cst, err := Fail(ctx, &FailRequest{A: 5})
+	if err != nil || fst != 5 || cst != 0 {
+		t.Fatalf("Fail returned %d, %d, %v", fst, cst, err)
+	}
+	failing := &dcerpc.Client{}
+	defer failing.Close()
+	_, fst, cst, err = NewAcalcClient(failing, dcerpc.Binding{ProtSeq: dcerpc.ProtSeqNamedPipe}).Fail(ctx, &FailRequest{A: 5})
+	if err != nil || fst != 0 || cst != pdu.StatusCommFailure {
+		t.Fatalf("Fail without a connection returned %d, %#x, %v", fst, cst, err)
+	}
+
+	// Hidden has the nocode attribute, so it has no client stub.
+	if _, ok := interface{}(&AcalcClient{}).(interface {
+		Hidden(context.Context, *HiddenRequest) (*HiddenResponse, error)
+	}); ok {
+		t.Fatal("Hidden has a client stub")
+	}
+}
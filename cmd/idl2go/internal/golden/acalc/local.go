@@ -0,0 +1,16 @@
+package acalc
+
+// Local is the local representation of PAIR, as configured by acalc.acf.
+type Local struct {
+	A, B int32
+}
+
+// PAIRFromLocal converts l to the transmitted type.
+func PAIRFromLocal(l Local) PAIR {
+	return PAIR{Hi: l.A, Lo: l.B}
+}
+
+// PAIRToLocal converts p to the local type.
+func PAIRToLocal(p PAIR) Local {
+	return Local{A: p.Hi, B: p.Lo}
+}
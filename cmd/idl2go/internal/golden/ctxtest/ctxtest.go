@@ -0,0 +1,179 @@
+// Code generated by idl2go from ctxtest.idl. DO NOT EDIT.
+
+package ctxtest
+
+import (
+	"context"
+
+	"github.com/gentlemanautomaton/dcerpc"
+	"github.com/gentlemanautomaton/dcerpc/uuid"
+)
+
+// PCOUNTER is a context handle.
+type PCOUNTER struct {
+	dcerpc.ContextHandle
+}
+
+// PCOUNTERContextType validates PCOUNTER handles received by a server.
+var PCOUNTERContextType = dcerpc.ContextType{Name: "PCOUNTER", Strict: true, TypeStrict: true}
+
+// PREADER is a context handle.
+type PREADER struct {
+	dcerpc.ContextHandle
+}
+
+// PREADERContextType validates PREADER handles received by a server.
+var PREADERContextType = dcerpc.ContextType{Name: "PREADER", Strict: true}
+
+// CtxtestInterface identifies the ctxtest interface.
+var CtxtestInterface = dcerpc.Interface{
+	UUID:         uuid.MustParse("12345678-1234-abcd-ef00-0123456789ac"),
+	VersionMajor: 1,
+	VersionMinor: 0,
+}
+
+// OpenRequest holds the input parameters of Open.
+type OpenRequest struct {
+	Start int32 `idl:"in"`
+}
+
+// OpenResponse holds the output parameters of Open.
+type OpenResponse struct {
+	Counter PCOUNTER `idl:"out"`
+	Return  int32    `idl:"out"`
+}
+
+// NextRequest holds the input parameters of Next.
+type NextRequest struct {
+	Counter PCOUNTER `idl:"in"`
+}
+
+// NextResponse holds the output parameters of Next.
+type NextResponse struct {
+	Value  int32 `idl:"out"`
+	Return int32 `idl:"out"`
+}
+
+// CloseRequest holds the input parameters of Close.
+type CloseRequest struct {
+	Counter PCOUNTER `idl:"in,out"`
+}
+
+// CloseResponse holds the output parameters of Close.
+type CloseResponse struct {
+	Counter PCOUNTER `idl:"in,out"`
+}
+
+// RawRequest holds the input parameters of Raw.
+type RawRequest struct {
+	H dcerpc.ContextHandle `idl:"in,context_handle"`
+}
+
+// RawResponse holds the output parameters of Raw.
+type RawResponse struct {
+	Return int32 `idl:"out"`
+}
+
+// CtxtestClient makes calls on the ctxtest interface.
+type CtxtestClient struct {
+	Handle *dcerpc.Handle
+}
+
+// NewCtxtestClient returns a client for the ctxtest interface of the server identified by b.
+func NewCtxtestClient(c *dcerpc.Client, b dcerpc.Binding) *CtxtestClient {
+	return &CtxtestClient{Handle: c.Handle(b, CtxtestInterface)}
+}
+
+// Open calls operation 0 of the ctxtest interface.
+func (c *CtxtestClient) Open(ctx context.Context, req *OpenRequest) (*OpenResponse, error) {
+	var resp OpenResponse
+	if err := c.Handle.Invoke(ctx, 0, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Next calls operation 1 of the ctxtest interface.
+func (c *CtxtestClient) Next(ctx context.Context, req *NextRequest) (*NextResponse, error) {
+	var resp NextResponse
+	if err := c.Handle.Invoke(ctx, 1, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Close calls operation 2 of the ctxtest interface.
+func (c *CtxtestClient) Close(ctx context.Context, req *CloseRequest) (*CloseResponse, error) {
+	var resp CloseResponse
+	if err := c.Handle.Invoke(ctx, 2, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Raw calls operation 3 of the ctxtest interface.
+func (c *CtxtestClient) Raw(ctx context.Context, req *RawRequest) (*RawResponse, error) {
+	var resp RawResponse
+	if err := c.Handle.Invoke(ctx, 3, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// CtxtestServer is implemented by servers of the ctxtest interface.
+type CtxtestServer interface {
+	Open(ctx context.Context, req *OpenRequest) (*OpenResponse, error)
+	Next(ctx context.Context, req *NextRequest) (*NextResponse, error)
+	Close(ctx context.Context, req *CloseRequest) (*CloseResponse, error)
+	Raw(ctx context.Context, req *RawRequest) (*RawResponse, error)
+}
+
+// RegisterCtxtestServer registers an implementation of the ctxtest interface with s.
+func RegisterCtxtestServer(s *dcerpc.Server, srv CtxtestServer) error {
+	return s.Register(CtxtestInterface, dcerpc.OperationTable{
+		0: func(ctx context.Context, call *dcerpc.Call) error {
+			var req OpenRequest
+			if err := call.DecodeRequest(&req); err != nil {
+				return err
+			}
+			resp, err := srv.Open(ctx, &req)
+			if err != nil {
+				return err
+			}
+			return call.EncodeResponse(resp)
+		},
+		1: func(ctx context.Context, call *dcerpc.Call) error {
+			var req NextRequest
+			if err := call.DecodeRequest(&req); err != nil {
+				return err
+			}
+			resp, err := srv.Next(ctx, &req)
+			if err != nil {
+				return err
+			}
+			return call.EncodeResponse(resp)
+		},
+		2: func(ctx context.Context, call *dcerpc.Call) error {
+			var req CloseRequest
+			if err := call.DecodeRequest(&req); err != nil {
+				return err
+			}
+			resp, err := srv.Close(ctx, &req)
+			if err != nil {
+				return err
+			}
+			return call.EncodeResponse(resp)
+		},
+		3: func(ctx context.Context, call *dcerpc.Call) error {
+			var req RawRequest
+			if err := call.DecodeRequest(&req); err != nil {
+				return err
+			}
+			resp, err := srv.Raw(ctx, &req)
+			if err != nil {
+				return err
+			}
+			return call.EncodeResponse(resp)
+		},
+	})
+}
@@ -0,0 +1,122 @@
+package ctxtest
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gentlemanautomaton/dcerpc"
+)
+
+// server counts from the value given to Open, and records the values of the
+// counters that are run down.
+type server struct {
+	mutex   sync.Mutex
+	rundown []interface{}
+}
+
+func (s *server) Open(ctx context.Context, req *OpenRequest) (*OpenResponse, error) {
+	call, _ := dcerpc.CallFromContext(ctx)
+	counter := req.Start
+	h, err := call.NewContext(PCOUNTERContextType, &counter, func(value interface{}) {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		s.rundown = append(s.rundown, value)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &OpenResponse{Counter: PCOUNTER{h}}, nil
+}
+
+func (s *server) Next(ctx context.Context, req *NextRequest) (*NextResponse, error) {
+	call, _ := dcerpc.CallFromContext(ctx)
+	v, err := call.Context(PCOUNTERContextType, req.Counter.ContextHandle)
+	if err != nil {
+		return nil, err
+	}
+	counter := v.(*int32)
+	*counter++
+	return &NextResponse{Value: *counter}, nil
+}
+
+func (s *server) Close(ctx context.Context, req *CloseRequest) (*CloseResponse, error) {
+	call, _ := dcerpc.CallFromContext(ctx)
+	if _, err := call.CloseContext(PCOUNTERContextType, req.Counter.ContextHandle); err != nil {
+		return nil, err
+	}
+	return &CloseResponse{}, nil
+}
+
+func (s *server) Raw(ctx context.Context, req *RawRequest) (*RawResponse, error) {
+	call, _ := dcerpc.CallFromContext(ctx)
+	_, err := call.Context(PREADERContextType, req.H)
+	return &RawResponse{}, err
+}
+
+func (s *server) rundowns() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.rundown)
+}
+
+func TestContextHandles(t *testing.T) {
+	var srv dcerpc.Server
+	s := &server{}
+	if err := RegisterCtxtestServer(&srv, s); err != nil {
+		t.Fatal(err)
+	}
+	dial := dcerpc.DialerFunc(func(ctx context.Context, b dcerpc.Binding) (io.ReadWriteCloser, error) {
+		client, server := net.Pipe()
+		go func() {
+			srv.ServeConn(context.Background(), server)
+			server.Close()
+		}()
+		return client, nil
+	})
+	c := &dcerpc.Client{Dialers: map[string]dcerpc.Dialer{dcerpc.ProtSeqTCP: dial}}
+	client := NewCtxtestClient(c, dcerpc.Binding{ProtSeq: dcerpc.ProtSeqTCP, NetworkAddr: "server", Endpoint: "135"})
+	ctx := context.Background()
+
+	open, err := client.Open(ctx, &OpenRequest{Start: 10})
+	if err != nil || open.Counter.IsNil() {
+		t.Fatalf("Open returned %+v, %v", open, err)
+	}
+	next, err := client.Next(ctx, &NextRequest{Counter: open.Counter})
+	if err != nil || next.Value != 11 {
+		t.Fatalf("Next returned %+v, %v", next, err)
+	}
+
+	// PCOUNTER is type strict by its configuration, so it cannot be used
+	// as a PREADER.
+	if _, err := client.Raw(ctx, &RawRequest{H: open.Counter.ContextHandle}); !dcerpc.IsContextMismatch(err) {
+		t.Fatalf("using a PCOUNTER as a PREADER returned %v", err)
+	}
+	if _, err := client.Next(ctx, &NextRequest{}); !dcerpc.IsContextMismatch(err) {
+		t.Fatalf("using a nil handle returned %v", err)
+	}
+
+	if _, err := client.Close(ctx, &CloseRequest{Counter: open.Counter}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Next(ctx, &NextRequest{Counter: open.Counter}); !dcerpc.IsContextMismatch(err) {
+		t.Fatalf("using a closed handle returned %v", err)
+	}
+
+	// The contexts that remain open are run down when the association is
+	// closed.
+	if _, err := client.Open(ctx, &OpenRequest{Start: 5}); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	deadline := time.Now().Add(time.Second)
+	for s.rundowns() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d contexts were run down, want 1", s.rundowns())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
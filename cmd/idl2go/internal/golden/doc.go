@@ -0,0 +1,8 @@
+// Package golden holds packages generated by idl2go from the IDL files that
+// accompany them. The generated files are compared with the output of
+// idl2go by its tests, and the tests of each package verify that the
+// generated types are transmitted as their IDL declarations require.
+//
+// Run "go test ./cmd/idl2go -update" to regenerate the files after changing
+// idl2go.
+package golden
@@ -0,0 +1,285 @@
+// Code generated by idl2go from lsatest.idl. DO NOT EDIT.
+
+package lsatest
+
+import (
+	"context"
+
+	"github.com/gentlemanautomaton/dcerpc"
+	"github.com/gentlemanautomaton/dcerpc/uuid"
+)
+
+type NTSTATUS int32
+
+type WCHAR uint16
+
+type LPWSTR = string
+
+type WORD uint16
+
+type DWORD uint32
+
+type BOUNDED_DWORD_256K DWORD
+
+type LPBOUNDED_DWORD_256K = *DWORD
+
+type RPC_UNICODE_STRING struct {
+	Length        uint16
+	MaximumLength uint16
+	Buffer        []WCHAR `idl:"size_is(MaximumLength/2),length_is(Length/2),unique"`
+}
+
+type PRPC_UNICODE_STRING = *RPC_UNICODE_STRING
+
+type RPC_SID struct {
+	Revision            byte
+	SubAuthorityCount   byte
+	IdentifierAuthority [6]byte
+	SubAuthority        []uint32 `idl:"size_is(SubAuthorityCount)"`
+}
+
+type PRPC_SID = *RPC_SID
+
+type POLICY_INFORMATION_CLASS int16
+
+const (
+	PolicyAuditEventsInformation   POLICY_INFORMATION_CLASS = 2
+	PolicyAccountDomainInformation POLICY_INFORMATION_CLASS = 5
+	PolicyDnsDomainInformation     POLICY_INFORMATION_CLASS = 12
+)
+
+type POLICY_AUDIT_EVENTS_INFO struct {
+	AuditingMode           byte
+	EventAuditingOptions   []uint32 `idl:"size_is(MaximumAuditEventCount),unique"`
+	MaximumAuditEventCount uint32
+}
+
+type LSAPR_POLICY_ACCOUNT_DOM_INFO struct {
+	DomainName RPC_UNICODE_STRING
+	DomainSid  PRPC_SID `idl:"unique"`
+}
+
+// LSAPR_POLICY_INFORMATION is a union discriminated by a value of type POLICY_INFORMATION_CLASS, which is held by Switch.
+type LSAPR_POLICY_INFORMATION struct {
+	Switch                  POLICY_INFORMATION_CLASS      `idl:"enum16"`
+	PolicyAuditEventsInfo   POLICY_AUDIT_EVENTS_INFO      `idl:"case(2)"`
+	PolicyAccountDomainInfo LSAPR_POLICY_ACCOUNT_DOM_INFO `idl:"case(5)"`
+	_                       struct{}                      `idl:"default"`
+}
+
+type PLSAPR_POLICY_INFORMATION = *LSAPR_POLICY_INFORMATION
+
+// VALUE is an encapsulated union discriminated by Kind.
+type VALUE struct {
+	Kind   uint16
+	Number int32    `idl:"case(1)"`
+	Text   string   `idl:"case(2),string,unique"`
+	_      struct{} `idl:"default"`
+}
+
+type TRUST_INFO struct {
+	Name  LPWSTR     `idl:"string,unique"`
+	Flat  [16]uint16 `idl:"string"`
+	Value VALUE
+	Sid   PRPC_SID `idl:"ref"`
+}
+
+// LsatestInterface identifies the lsatest interface.
+var LsatestInterface = dcerpc.Interface{
+	UUID:         uuid.MustParse("12345778-1234-abcd-ef00-0123456789ac"),
+	VersionMajor: 0,
+	VersionMinor: 0,
+}
+
+// LsarQueryInformationPolicyRequest holds the input parameters of LsarQueryInformationPolicy.
+type LsarQueryInformationPolicyRequest struct {
+	PolicyHandle     uint32                   `idl:"in"`
+	InformationClass POLICY_INFORMATION_CLASS `idl:"in,enum16"`
+}
+
+// LsarQueryInformationPolicyResponse holds the output parameters of LsarQueryInformationPolicy.
+type LsarQueryInformationPolicyResponse struct {
+	InformationClass  POLICY_INFORMATION_CLASS  `idl:"-"`
+	PolicyInformation PLSAPR_POLICY_INFORMATION `idl:"out,switch_is(InformationClass),unique"`
+	Return            NTSTATUS                  `idl:"out"`
+}
+
+// LsarLookupNameRequest holds the input parameters of LsarLookupName.
+type LsarLookupNameRequest struct {
+	Name   RPC_UNICODE_STRING `idl:"in"`
+	System string             `idl:"in,unique,string"`
+	Domain LPWSTR             `idl:"in,string"`
+}
+
+// LsarLookupNameResponse holds the output parameters of LsarLookupName.
+type LsarLookupNameResponse struct {
+	Sid    PRPC_SID `idl:"out,unique"`
+	Return NTSTATUS `idl:"out"`
+}
+
+// LsarGetBlobRequest holds the input parameters of LsarGetBlob.
+type LsarGetBlobRequest struct {
+	Size uint32 `idl:"in"`
+}
+
+// LsarGetBlobResponse holds the output parameters of LsarGetBlob.
+type LsarGetBlobResponse struct {
+	Size   uint32   `idl:"-"`
+	Count  uint32   `idl:"out"`
+	Data   []byte   `idl:"out,size_is(Size),length_is(*Count)"`
+	Return NTSTATUS `idl:"out"`
+}
+
+// LsarSetTrustRequest holds the input parameters of LsarSetTrust.
+type LsarSetTrustRequest struct {
+	Info TRUST_INFO `idl:"in"`
+}
+
+// LsarSetTrustResponse holds the output parameters of LsarSetTrust.
+type LsarSetTrustResponse struct {
+	Previous TRUST_INFO `idl:"out"`
+	Return   NTSTATUS   `idl:"out"`
+}
+
+// LsarEnumerateRequest holds the input parameters of LsarEnumerate.
+type LsarEnumerateRequest struct {
+	Server                string `idl:"in,string,unique"`
+	PreferedMaximumLength DWORD  `idl:"in,range(0, 262144)"`
+	ResumeHandle          *DWORD `idl:"in,out,unique"`
+}
+
+// LsarEnumerateResponse holds the output parameters of LsarEnumerate.
+type LsarEnumerateResponse struct {
+	ResumeHandle *DWORD   `idl:"in,out,unique"`
+	Count        DWORD    `idl:"out"`
+	Return       NTSTATUS `idl:"out"`
+}
+
+// LsatestClient makes calls on the lsatest interface.
+type LsatestClient struct {
+	Handle *dcerpc.Handle
+}
+
+// NewLsatestClient returns a client for the lsatest interface of the server identified by b.
+func NewLsatestClient(c *dcerpc.Client, b dcerpc.Binding) *LsatestClient {
+	return &LsatestClient{Handle: c.Handle(b, LsatestInterface)}
+}
+
+// LsarQueryInformationPolicy calls operation 0 of the lsatest interface.
+func (c *LsatestClient) LsarQueryInformationPolicy(ctx context.Context, req *LsarQueryInformationPolicyRequest) (*LsarQueryInformationPolicyResponse, error) {
+	var resp LsarQueryInformationPolicyResponse
+	resp.InformationClass = req.InformationClass
+	if err := c.Handle.Invoke(ctx, 0, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// LsarLookupName calls operation 1 of the lsatest interface.
+func (c *LsatestClient) LsarLookupName(ctx context.Context, req *LsarLookupNameRequest) (*LsarLookupNameResponse, error) {
+	var resp LsarLookupNameResponse
+	if err := c.Handle.Invoke(ctx, 1, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// LsarGetBlob calls operation 2 of the lsatest interface.
+func (c *LsatestClient) LsarGetBlob(ctx context.Context, req *LsarGetBlobRequest) (*LsarGetBlobResponse, error) {
+	var resp LsarGetBlobResponse
+	resp.Size = req.Size
+	if err := c.Handle.Invoke(ctx, 2, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// LsarSetTrust calls operation 3 of the lsatest interface.
+func (c *LsatestClient) LsarSetTrust(ctx context.Context, req *LsarSetTrustRequest) (*LsarSetTrustResponse, error) {
+	var resp LsarSetTrustResponse
+	if err := c.Handle.Invoke(ctx, 3, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// LsarEnumerate calls operation 4 of the lsatest interface.
+func (c *LsatestClient) LsarEnumerate(ctx context.Context, req *LsarEnumerateRequest) (*LsarEnumerateResponse, error) {
+	var resp LsarEnumerateResponse
+	if err := c.Handle.Invoke(ctx, 4, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// LsatestServer is implemented by servers of the lsatest interface.
+type LsatestServer interface {
+	LsarQueryInformationPolicy(ctx context.Context, req *LsarQueryInformationPolicyRequest) (*LsarQueryInformationPolicyResponse, error)
+	LsarLookupName(ctx context.Context, req *LsarLookupNameRequest) (*LsarLookupNameResponse, error)
+	LsarGetBlob(ctx context.Context, req *LsarGetBlobRequest) (*LsarGetBlobResponse, error)
+	LsarSetTrust(ctx context.Context, req *LsarSetTrustRequest) (*LsarSetTrustResponse, error)
+	LsarEnumerate(ctx context.Context, req *LsarEnumerateRequest) (*LsarEnumerateResponse, error)
+}
+
+// RegisterLsatestServer registers an implementation of the lsatest interface with s.
+func RegisterLsatestServer(s *dcerpc.Server, srv LsatestServer) error {
+	return s.Register(LsatestInterface, dcerpc.OperationTable{
+		0: func(ctx context.Context, call *dcerpc.Call) error {
+			var req LsarQueryInformationPolicyRequest
+			if err := call.DecodeRequest(&req); err != nil {
+				return err
+			}
+			resp, err := srv.LsarQueryInformationPolicy(ctx, &req)
+			if err != nil {
+				return err
+			}
+			resp.InformationClass = req.InformationClass
+			return call.EncodeResponse(resp)
+		},
+		1: func(ctx context.Context, call *dcerpc.Call) error {
+			var req LsarLookupNameRequest
+			if err := call.DecodeRequest(&req); err != nil {
+				return err
+			}
+			resp, err := srv.LsarLookupName(ctx, &req)
+			if err != nil {
+				return err
+			}
+			return call.EncodeResponse(resp)
+		},
+		2: func(ctx context.Context, call *dcerpc.Call) error {
+			var req LsarGetBlobRequest
+			if err := call.DecodeRequest(&req); err != nil {
+				return err
+			}
+			resp, err := srv.LsarGetBlob(ctx, &req)
+			if err != nil {
+				return err
+			}
+			resp.Size = req.Size
+			return call.EncodeResponse(resp)
+		},
+		3: func(ctx context.Context, call *dcerpc.Call) error {
+			var req LsarSetTrustRequest
+			if err := call.DecodeRequest(&req); err != nil {
+				return err
+			}
+			resp, err := srv.LsarSetTrust(ctx, &req)
+			if err != nil {
+				return err
+			}
+			return call.EncodeResponse(resp)
+		},
+		4: func(ctx context.Context, call *dcerpc.Call) error {
+			var req LsarEnumerateRequest
+			if err := call.DecodeRequest(&req); err != nil {
+				return err
+			}
+			resp, err := srv.LsarEnumerate(ctx, &req)
+			if err != nil {
+				return err
+			}
+			return call.EncodeResponse(resp)
+		},
+	})
+}
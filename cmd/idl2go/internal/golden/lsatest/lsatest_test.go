@@ -0,0 +1,333 @@
+package lsatest
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/gentlemanautomaton/dcerpc"
+	"github.com/gentlemanautomaton/dcerpc/formatlabel"
+	"github.com/gentlemanautomaton/dcerpc/ndr"
+)
+
+func unicodeString(s string) RPC_UNICODE_STRING {
+	var buf []WCHAR
+	for _, c := range s {
+		buf = append(buf, WCHAR(c))
+	}
+	return RPC_UNICODE_STRING{Length: uint16(2 * len(buf)), MaximumLength: uint16(2 * len(buf)), Buffer: buf}
+}
+
+var domainSid = &RPC_SID{
+	Revision:            1,
+	SubAuthorityCount:   1,
+	IdentifierAuthority: [6]byte{0, 0, 0, 0, 0, 5},
+	SubAuthority:        []uint32{21},
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name string
+		in   interface{}
+		want []byte
+	}{
+		{
+			name: "query-information-policy",
+			in: &LsarQueryInformationPolicyResponse{
+				InformationClass: PolicyAccountDomainInformation,
+				PolicyInformation: &LSAPR_POLICY_INFORMATION{
+					Switch: PolicyAccountDomainInformation,
+					PolicyAccountDomainInfo: LSAPR_POLICY_ACCOUNT_DOM_INFO{
+						DomainName: RPC_UNICODE_STRING{Length: 4, MaximumLength: 6, Buffer: []WCHAR{'h', 'i'}},
+						DomainSid:  domainSid,
+					},
+				},
+			},
+			want: []byte{
+				0, 0, 2, 0, // Referent ID of PolicyInformation
+				5, 0, // Discriminant
+				0, 0, // Padding
+				4, 0, 6, 0, // Length and MaximumLength of DomainName
+				4, 0, 2, 0, // Referent ID of DomainName.Buffer
+				8, 0, 2, 0, // Referent ID of DomainSid
+				3, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, // Bounds of DomainName.Buffer
+				'h', 0, 'i', 0,
+				1, 0, 0, 0, // Max count of SubAuthority
+				1, 1, 0, 0, 0, 0, 0, 5, // Revision, SubAuthorityCount and IdentifierAuthority
+				21, 0, 0, 0, // SubAuthority
+				0, 0, 0, 0, // Return
+			},
+		},
+		{
+			name: "query-information-policy-default",
+			in:   &LsarQueryInformationPolicyResponse{InformationClass: PolicyDnsDomainInformation, PolicyInformation: &LSAPR_POLICY_INFORMATION{}},
+			want: []byte{
+				0, 0, 2, 0, // Referent ID of PolicyInformation
+				12, 0, // Discriminant of the empty default arm
+				0, 0, // Padding
+				0, 0, 0, 0, // Return
+			},
+		},
+		{
+			name: "lookup-name",
+			in:   &LsarLookupNameRequest{Name: unicodeString("a"), System: "S", Domain: "D"},
+			want: []byte{
+				2, 0, 2, 0, // Length and MaximumLength of Name
+				0, 0, 2, 0, // Referent ID of Name.Buffer
+				1, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 'a', 0,
+				0, 0, // Padding
+				4, 0, 2, 0, // Referent ID of System
+				2, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 'S', 0, 0, 0,
+				2, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 'D', 0, 0, 0, // Domain
+			},
+		},
+		{
+			name: "lookup-name-null",
+			in:   &LsarLookupNameRequest{Domain: "D"},
+			want: []byte{
+				0, 0, 0, 0, // Length and MaximumLength of Name
+				0, 0, 0, 0, // Null Name.Buffer
+				0, 0, 0, 0, // Null System
+				2, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 'D', 0, 0, 0, // Domain
+			},
+		},
+		{
+			name: "get-blob",
+			in:   &LsarGetBlobResponse{Size: 4, Count: 2, Data: []byte{0xaa, 0xbb}},
+			want: []byte{
+				2, 0, 0, 0, // Count
+				4, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 0xaa, 0xbb, // Data
+				0, 0, // Padding
+				0, 0, 0, 0, // Return
+			},
+		},
+		{
+			name: "set-trust",
+			in: &LsarSetTrustRequest{Info: TRUST_INFO{
+				Name:  "N",
+				Flat:  [16]uint16{'F'},
+				Value: VALUE{Kind: 2, Text: "T"},
+				Sid:   domainSid,
+			}},
+			want: []byte{
+				0, 0, 2, 0, // Referent ID of Name
+				0, 0, 0, 0, 2, 0, 0, 0, 'F', 0, 0, 0, // Flat
+				2, 0, // Kind
+				0, 0, // Padding
+				4, 0, 2, 0, // Referent ID of Text
+				8, 0, 2, 0, // Referent ID of Sid
+				2, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 'N', 0, 0, 0,
+				2, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 'T', 0, 0, 0,
+				1, 0, 0, 0, 1, 1, 0, 0, 0, 0, 0, 5, 21, 0, 0, 0, // Sid
+			},
+		},
+		{
+			name: "enumerate",
+			in:   &LsarEnumerateRequest{Server: "S", PreferedMaximumLength: 10, ResumeHandle: dword(5)},
+			want: []byte{
+				0, 0, 2, 0, // Referent ID of Server
+				2, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 'S', 0, 0, 0,
+				10, 0, 0, 0, // PreferedMaximumLength
+				4, 0, 2, 0, // Referent ID of ResumeHandle
+				5, 0, 0, 0, // *ResumeHandle
+			},
+		},
+		{
+			name: "enumerate-null",
+			in:   &LsarEnumerateRequest{PreferedMaximumLength: 10},
+			want: []byte{
+				0, 0, 0, 0, // Null Server
+				10, 0, 0, 0, // PreferedMaximumLength
+				0, 0, 0, 0, // Null ResumeHandle
+			},
+		},
+		{
+			name: "enumerate-response",
+			in:   &LsarEnumerateResponse{ResumeHandle: dword(7), Count: 3},
+			want: []byte{
+				0, 0, 2, 0, // Referent ID of ResumeHandle
+				7, 0, 0, 0, // *ResumeHandle
+				3, 0, 0, 0, // Count
+				0, 0, 0, 0, // Return
+			},
+		},
+		{
+			name: "enumerate-response-null",
+			in:   &LsarEnumerateResponse{Count: 3},
+			want: []byte{
+				0, 0, 0, 0, // Null ResumeHandle
+				3, 0, 0, 0, // Count
+				0, 0, 0, 0, // Return
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc, _ := ndr.NewEncoder(&buf, formatlabel.LEAIEEE)
+			if err := enc.Encode(tt.in); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), tt.want) {
+				t.Fatalf("encoded % x, want % x", buf.Bytes(), tt.want)
+			}
+
+			// Hidden fields are not transmitted, so they are copied to the
+			// decoded value as the client stubs do.
+			out := reflect.New(reflect.TypeOf(tt.in).Elem())
+			if f := out.Elem().FieldByName("InformationClass"); f.IsValid() {
+				f.Set(reflect.ValueOf(tt.in).Elem().FieldByName("InformationClass"))
+			}
+			if f := out.Elem().FieldByName("Size"); f.IsValid() {
+				f.Set(reflect.ValueOf(tt.in).Elem().FieldByName("Size"))
+			}
+			dec, _ := ndr.NewDecoder(&buf, formatlabel.LEAIEEE)
+			if err := dec.Decode(out.Interface()); err != nil {
+				t.Fatal(err)
+			}
+			var again bytes.Buffer
+			enc, _ = ndr.NewEncoder(&again, formatlabel.LEAIEEE)
+			if err := enc.Encode(out.Interface()); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(again.Bytes(), tt.want) {
+				t.Fatalf("decoded value %+v encoded as % x", out.Elem().Interface(), again.Bytes())
+			}
+		})
+	}
+}
+
+func dword(x DWORD) *DWORD { return &x }
+
+func TestDecodeRange(t *testing.T) {
+	// PreferedMaximumLength is limited by the range of its typedef.
+	in := []byte{0, 0, 0, 0, 0x01, 0x00, 0x04, 0x00, 0, 0, 0, 0}
+	dec, _ := ndr.NewDecoder(bytes.NewReader(in), formatlabel.LEAIEEE)
+	var req LsarEnumerateRequest
+	err := dec.Decode(&req)
+	if e, ok := err.(*ndr.DecodingError); !ok || e.Code != ndr.ValueOutOfRange {
+		t.Fatalf("Decode returned %v, want a value out of range error", err)
+	}
+}
+
+func TestEncodeNullReference(t *testing.T) {
+	var buf bytes.Buffer
+	enc, _ := ndr.NewEncoder(&buf, formatlabel.LEAIEEE)
+	err := enc.Encode(&LsarSetTrustRequest{})
+	if e, ok := err.(*ndr.EncodingError); !ok || e.Code != ndr.NullReference {
+		t.Fatalf("Encode returned %v, want a null reference error", err)
+	}
+}
+
+type server struct{}
+
+func (server) LsarQueryInformationPolicy(ctx context.Context, req *LsarQueryInformationPolicyRequest) (*LsarQueryInformationPolicyResponse, error) {
+	if req.InformationClass != PolicyAccountDomainInformation {
+		return &LsarQueryInformationPolicyResponse{Return: -1}, nil
+	}
+	return &LsarQueryInformationPolicyResponse{
+		PolicyInformation: &LSAPR_POLICY_INFORMATION{
+			PolicyAccountDomainInfo: LSAPR_POLICY_ACCOUNT_DOM_INFO{
+				DomainName: unicodeString("DOMAIN"),
+				DomainSid:  domainSid,
+			},
+		},
+	}, nil
+}
+
+func (server) LsarLookupName(ctx context.Context, req *LsarLookupNameRequest) (*LsarLookupNameResponse, error) {
+	if string(utf16(req.Name.Buffer)) != req.Domain+`\`+req.System {
+		return &LsarLookupNameResponse{Return: -1}, nil
+	}
+	return &LsarLookupNameResponse{Sid: domainSid}, nil
+}
+
+func (server) LsarGetBlob(ctx context.Context, req *LsarGetBlobRequest) (*LsarGetBlobResponse, error) {
+	return &LsarGetBlobResponse{Count: 3, Data: []byte{1, 2, 3}}, nil
+}
+
+func (server) LsarSetTrust(ctx context.Context, req *LsarSetTrustRequest) (*LsarSetTrustResponse, error) {
+	return &LsarSetTrustResponse{Previous: req.Info}, nil
+}
+
+func (server) LsarEnumerate(ctx context.Context, req *LsarEnumerateRequest) (*LsarEnumerateResponse, error) {
+	resp := &LsarEnumerateResponse{Count: DWORD(len(req.Server))}
+	if req.ResumeHandle != nil {
+		resp.ResumeHandle = dword(*req.ResumeHandle + 1)
+	}
+	return resp, nil
+}
+
+func utf16(s []WCHAR) []rune {
+	r := make([]rune, len(s))
+	for i, c := range s {
+		r[i] = rune(c)
+	}
+	return r
+}
+
+// connect returns a client whose connections are served by srv.
+func connect(srv *dcerpc.Server) *dcerpc.Client {
+	dial := dcerpc.DialerFunc(func(ctx context.Context, b dcerpc.Binding) (io.ReadWriteCloser, error) {
+		client, server := net.Pipe()
+		go srv.ServeConn(context.Background(), server)
+		return client, nil
+	})
+	return &dcerpc.Client{Dialers: map[string]dcerpc.Dialer{dcerpc.ProtSeqTCP: dial}}
+}
+
+func TestCalls(t *testing.T) {
+	var srv dcerpc.Server
+	if err := RegisterLsatestServer(&srv, server{}); err != nil {
+		t.Fatal(err)
+	}
+	c := connect(&srv)
+	defer c.Close()
+	client := NewLsatestClient(c, dcerpc.Binding{ProtSeq: dcerpc.ProtSeqTCP, NetworkAddr: "server", Endpoint: "135"})
+	ctx := context.Background()
+
+	// The discriminant of the union is taken from the request.
+	query, err := client.LsarQueryInformationPolicy(ctx, &LsarQueryInformationPolicyRequest{InformationClass: PolicyAccountDomainInformation})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := query.PolicyInformation
+	if info == nil || info.Switch != PolicyAccountDomainInformation ||
+		!reflect.DeepEqual(info.PolicyAccountDomainInfo.DomainName, unicodeString("DOMAIN")) ||
+		!reflect.DeepEqual(info.PolicyAccountDomainInfo.DomainSid, domainSid) {
+		t.Fatalf("LsarQueryInformationPolicy returned %+v", info)
+	}
+	query, err = client.LsarQueryInformationPolicy(ctx, &LsarQueryInformationPolicyRequest{InformationClass: PolicyDnsDomainInformation})
+	if err != nil || query.PolicyInformation != nil || query.Return != -1 {
+		t.Fatalf("LsarQueryInformationPolicy returned %+v, %v", query, err)
+	}
+
+	lookup, err := client.LsarLookupName(ctx, &LsarLookupNameRequest{Name: unicodeString(`D\S`), System: "S", Domain: "D"})
+	if err != nil || lookup.Return != 0 || !reflect.DeepEqual(lookup.Sid, domainSid) {
+		t.Fatalf("LsarLookupName returned %+v, %v", lookup, err)
+	}
+
+	blob, err := client.LsarGetBlob(ctx, &LsarGetBlobRequest{Size: 8})
+	if err != nil || blob.Count != 3 || !bytes.Equal(blob.Data, []byte{1, 2, 3}) {
+		t.Fatalf("LsarGetBlob returned %+v, %v", blob, err)
+	}
+
+	// The resume handle may be null in either direction.
+	enum, err := client.LsarEnumerate(ctx, &LsarEnumerateRequest{Server: "srv", PreferedMaximumLength: 100, ResumeHandle: dword(1)})
+	if err != nil || enum.Count != 3 || enum.ResumeHandle == nil || *enum.ResumeHandle != 2 {
+		t.Fatalf("LsarEnumerate returned %+v, %v", enum, err)
+	}
+	enum, err = client.LsarEnumerate(ctx, &LsarEnumerateRequest{PreferedMaximumLength: 100})
+	if err != nil || enum.Count != 0 || enum.ResumeHandle != nil {
+		t.Fatalf("LsarEnumerate returned %+v, %v", enum, err)
+	}
+
+	info2 := TRUST_INFO{Name: "N", Flat: [16]uint16{'F', 'l', 'a', 't'}, Value: VALUE{Kind: 1, Number: -5}, Sid: domainSid}
+	trust, err := client.LsarSetTrust(ctx, &LsarSetTrustRequest{Info: info2})
+	if err != nil || !reflect.DeepEqual(trust.Previous, info2) {
+		t.Fatalf("LsarSetTrust returned %+v, %v", trust, err)
+	}
+}
@@ -0,0 +1,151 @@
+// Command idl2go generates Go bindings for RPC interfaces described in the
+// DCE / RPC interface definition language.
+//
+// Usage:
+//
+//	idl2go [-pkg name] [-o file] [-I dir]... file.idl... [file.acf...]
+//
+// The declarations of each file named on the command line are translated
+// into a single Go source file:
+//
+//   - Constants, typedefs, structures, unions and enumerations become Go
+//     declarations. Field attributes are preserved as idl struct tags, which
+//     are understood by the ndr package. Fields that hold enums are marked
+//     with enum16 or v1_enum, and fields that hold characters with char.
+//     Pipes become channels of their element type.
+//   - Embedded pointers are marked with their pointer attribute, which is
+//     taken from the interface's pointer_default when they have none.
+//     Pointers to strings become Go strings, and pointers to arrays become
+//     slices. Unions that are not encapsulated hold their discriminant in a
+//     field named Switch, whose type is given by switch_type.
+//   - Context handle types embed dcerpc.ContextHandle, and are accompanied
+//     by a dcerpc.ContextType that server implementations use to validate
+//     the handles they receive. The strict_context_handle interface
+//     attribute and the type_strict_context_handle configuration attribute
+//     are recorded in it.
+//   - Each interface becomes a dcerpc.Interface variable, along with request
+//     and response structures for each of its operations. Pipe parameters
+//     follow the other fields of requests and precede the other fields of
+//     responses, in the order they are transmitted. Responses also hold the
+//     [in] parameters that the attributes of [out] parameters refer to,
+//     which are copied from the request and are not transmitted.
+//   - A client type provides a typed stub for each operation, which calls
+//     dcerpc.Handle.Invoke with the operation's number.
+//   - A server interface declares a method for each operation, and a
+//     registration function adapts implementations of it to the operation
+//     table of a dcerpc.Server. Implementations reach the call they are
+//     serving with dcerpc.CallFromContext.
+//
+// Application configuration files adjust the generated bindings without
+// changing what is transmitted, as they do for MIDL. The configuration file
+// with the same base name as an IDL file is used if it exists, and others
+// may be named on the command line. The following attributes are
+// understood:
+//
+//   - nocode and code select the operations that have client stubs. Server
+//     bindings are generated for every operation.
+//   - implicit_handle declares a package variable holding a dcerpc.Handle,
+//     and package level stubs that make calls with it. explicit_handle
+//     generates package level stubs that accept the handle as their first
+//     argument. auto_handle is the behavior of the client type and needs
+//     no code.
+//   - comm_status and fault_status return failures to communicate and
+//     faults reported by the server in an error_status_t, rather than as an
+//     error. When the status parameter is added by the configuration file,
+//     it is returned as an additional result of the client stub.
+//   - represent_as(local) on a typedef declares the fields of requests and
+//     responses with the local type. The package must provide functions
+//     named after the transmitted type, such as TFromLocal and TToLocal,
+//     that convert between them. Only parameters are converted.
+//
+// Files imported by the named files are searched for in the directory of
+// the importing file and in the directories given with -I. Their
+// declarations are used to resolve type names but are not generated, so
+// files such as ms-dtyp.idl should be named on the command line when their
+// types are needed.
+//
+// Types that cannot be resolved or transmitted, such as a type declared by an
+// imported file that was not found, are reported as errors. No code is
+// generated and idl2go exits with a non-zero status.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// includeDirs is a flag.Value that accumulates include directories.
+type includeDirs []string
+
+func (d *includeDirs) String() string {
+	return strings.Join(*d, ",")
+}
+
+func (d *includeDirs) Set(dir string) error {
+	*d = append(*d, dir)
+	return nil
+}
+
+func main() {
+	var (
+		pkg     = flag.String("pkg", "", "package name of the generated file (default: the name of the first interface)")
+		out     = flag.String("o", "", "output file (default: standard output)")
+		include includeDirs
+	)
+	flag.Var(&include, "I", "directory to search for imported files (may be repeated)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: idl2go [-pkg name] [-o file] [-I dir]... file.idl... [file.acf...]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	g := newGenerator(include)
+	var acfs []string
+	for _, path := range flag.Args() {
+		if strings.EqualFold(filepath.Ext(path), ".acf") {
+			acfs = append(acfs, path)
+			continue
+		}
+		if err := g.load(path, true); err != nil {
+			fatal(err)
+		}
+	}
+	for _, path := range acfs {
+		if err := g.configure(path); err != nil {
+			fatal(err)
+		}
+	}
+	src, err := g.generate(*pkg)
+	for _, w := range g.warnings {
+		fmt.Fprintf(os.Stderr, "idl2go: warning: %s\n", w)
+	}
+	if err != nil {
+		fatal(err)
+	}
+
+	if *out == "" {
+		os.Stdout.Write(src)
+		return
+	}
+	if err := os.WriteFile(*out, src, 0o644); err != nil {
+		fatal(err)
+	}
+}
+
+func fatal(err error) {
+	if errs, ok := err.(errorList); ok {
+		for _, e := range errs {
+			fmt.Fprintf(os.Stderr, "idl2go: %s\n", e)
+		}
+	} else {
+		fmt.Fprintf(os.Stderr, "idl2go: %v\n", err)
+	}
+	os.Exit(1)
+}
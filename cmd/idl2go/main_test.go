@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMain runs idl2go instead of the tests when the test binary is run by
+// runMain.
+func TestMain(m *testing.M) {
+	if os.Getenv("IDL2GO_TEST_MAIN") == "1" {
+		os.Args = append([]string{"idl2go"}, os.Args[1:]...)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runMain runs idl2go with the given arguments and returns its standard
+// error and exit status.
+func runMain(t *testing.T, args ...string) (stderr string, status int) {
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "IDL2GO_TEST_MAIN=1")
+	var buf bytes.Buffer
+	cmd.Stderr = &buf
+	err := cmd.Run()
+	var exit *exec.ExitError
+	switch {
+	case errors.As(err, &exit):
+		return buf.String(), exit.ExitCode()
+	case err != nil:
+		t.Fatal(err)
+	}
+	return buf.String(), 0
+}
+
+func TestMainUnresolvedType(t *testing.T) {
+	dir := t.TempDir()
+	idl := filepath.Join(dir, "lsa.idl")
+	src := `import "ms-dtyp.idl";
+[uuid(12345778-1234-abcd-ef00-0123456789ab), version(0.0)]
+interface lsa
+{
+    NTSTATUS LsarLookup([in] unsigned long Count, [in, size_is(Count)] WCHAR *Name);
+}
+`
+	if err := os.WriteFile(idl, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "lsa.go")
+	stderr, status := runMain(t, "-o", out, idl)
+	if status == 0 {
+		t.Fatal("idl2go exited with status 0")
+	}
+	for _, want := range []string{
+		"warning: imported file ms-dtyp.idl not found",
+		"LsarLookupRequestName has unknown type WCHAR",
+		"LsarLookupResponseReturn has unknown type NTSTATUS",
+	} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("idl2go did not report %q:\n%s", want, stderr)
+		}
+	}
+	if _, err := os.Stat(out); err == nil {
+		t.Error("idl2go wrote its output despite the errors")
+	}
+}
+
+func TestMainGenerate(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "acalc.go")
+	if stderr, status := runMain(t, "-o", out, filepath.Join(goldenDir, "acalc", "acalc.idl")); status != 0 {
+		t.Fatalf("idl2go exited with status %d:\n%s", status, stderr)
+	}
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile(filepath.Join(goldenDir, "acalc", "acalc.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatal("idl2go wrote code that differs from the golden file")
+	}
+}
@@ -0,0 +1,169 @@
+package dcerpc
+
+import (
+	"encoding/binary"
+
+	"github.com/gentlemanautomaton/dcerpc/ndr"
+	"github.com/gentlemanautomaton/dcerpc/pdu"
+	"github.com/gentlemanautomaton/dcerpc/protocol/coproto"
+	"github.com/gentlemanautomaton/dcerpc/uuid"
+)
+
+// ContextHandle is the wire representation of an IDL context handle. It
+// identifies state held by a server on behalf of a client, and is
+// transmitted in 20 octets.
+//
+// A handle with a nil UUID is a nil handle, which refers to no state.
+type ContextHandle struct {
+	Attributes uint32
+	UUID       uuid.UUID
+}
+
+// IsNil returns true if h is a nil handle.
+func (h ContextHandle) IsNil() bool {
+	return h.UUID.IsNil()
+}
+
+// MarshalNDR encodes h as an attributes field followed by a UUID, whose
+// integer fields are written in the integer representation of w.
+func (h ContextHandle) MarshalNDR(w ndr.Writer, s *ndr.State) error {
+	w.WriteUint32(h.Attributes)
+	w.WriteUint32(binary.BigEndian.Uint32(h.UUID[0:4]))
+	w.WriteUint16(binary.BigEndian.Uint16(h.UUID[4:6]))
+	w.WriteUint16(binary.BigEndian.Uint16(h.UUID[6:8]))
+	_, err := w.Write(h.UUID[8:16])
+	return err
+}
+
+// UnmarshalNDR decodes h from the representation written by MarshalNDR.
+func (h *ContextHandle) UnmarshalNDR(r ndr.Reader, s *ndr.State) error {
+	attrs, err := r.ReadUint32()
+	if err != nil {
+		return err
+	}
+	timeLow, err := r.ReadUint32()
+	if err != nil {
+		return err
+	}
+	timeMid, err := r.ReadUint16()
+	if err != nil {
+		return err
+	}
+	timeHigh, err := r.ReadUint16()
+	if err != nil {
+		return err
+	}
+	var u uuid.UUID
+	binary.BigEndian.PutUint32(u[0:4], timeLow)
+	binary.BigEndian.PutUint16(u[4:6], timeMid)
+	binary.BigEndian.PutUint16(u[6:8], timeHigh)
+	if err := r.ReadFull(u[8:16]); err != nil {
+		return err
+	}
+	h.Attributes, h.UUID = attrs, u
+	return nil
+}
+
+// AlignNDR returns the alignment of a context handle, which is 4 octets.
+func (h ContextHandle) AlignNDR() int {
+	return 4
+}
+
+// ContextType describes a context handle type of an interface, and how the
+// handles of that type are validated when they are received by a server.
+type ContextType struct {
+	// Name is the name of the context handle type.
+	Name string
+
+	// Strict requires handles to be used only with the interface that
+	// created them, as the strict_context_handle attribute does.
+	Strict bool
+
+	// TypeStrict requires handles to be used only as the type that they were
+	// created as, as the type_strict_context_handle attribute does.
+	TypeStrict bool
+}
+
+// ContextMismatch returns the fault that is returned when a call receives a
+// context handle that is nil, unknown to its association group, or used in a
+// way that its type does not permit. A new fault is returned each time, so
+// that operations may modify it before returning it.
+func ContextMismatch() *Fault {
+	return &Fault{Status: pdu.StatusContextMismatch}
+}
+
+// IsContextMismatch returns true if err is a context mismatch fault.
+func IsContextMismatch(err error) bool {
+	fault, ok := err.(*Fault)
+	return ok && fault.Status == pdu.StatusContextMismatch
+}
+
+// NewContext creates a context of type t that holds value, and returns the
+// handle that refers to it. The context belongs to the association group of
+// the call, and is available to later calls in the group until it is closed
+// with CloseContext. If the group is closed first, rundown is called with
+// value, unless it is nil.
+func (call *Call) NewContext(t ContextType, value interface{}, rundown func(value interface{})) (ContextHandle, error) {
+	id, err := call.Group.AddContext(&coproto.ServerContext{
+		AbstractSyntax: call.AbstractSyntax,
+		Type:           t,
+		Value:          value,
+		Rundown:        rundown,
+	})
+	if err != nil {
+		return ContextHandle{}, err
+	}
+	return ContextHandle{UUID: id}, nil
+}
+
+// Context returns the value of the context that h refers to, which is
+// expected to be of type t. It returns a ContextMismatch fault if h does not
+// refer to an active context of the call's association group, or if the
+// context cannot be used as type t by the call.
+func (call *Call) Context(t ContextType, h ContextHandle) (interface{}, error) {
+	ctx, err := call.context(t, h)
+	if err != nil {
+		return nil, err
+	}
+	return ctx.Value, nil
+}
+
+// CloseContext closes the context that h refers to and returns its value,
+// without running it down. It is validated in the same way as it is by
+// Context. The nil handle should be returned to the client in place of h.
+func (call *Call) CloseContext(t ContextType, h ContextHandle) (interface{}, error) {
+	if _, err := call.context(t, h); err != nil {
+		return nil, err
+	}
+	ctx, ok := call.Group.RemoveContext(h.UUID)
+	if !ok {
+		// The context was closed by another call.
+		return nil, ContextMismatch()
+	}
+	return ctx.Value, nil
+}
+
+// context returns the active context that h refers to, if the call may use
+// it as type t.
+func (call *Call) context(t ContextType, h ContextHandle) (*coproto.ServerContext, error) {
+	if h.IsNil() {
+		return nil, ContextMismatch()
+	}
+	ctx, ok := call.Group.Context(h.UUID)
+	if !ok {
+		return nil, ContextMismatch()
+	}
+	// The restrictions of both the type that the context was created as and
+	// the type that it is used as apply.
+	created, _ := ctx.Type.(ContextType)
+	strict := t.Strict || t.TypeStrict || created.Strict || created.TypeStrict
+	typeStrict := t.TypeStrict || created.TypeStrict
+	sameInterface := ctx.AbstractSyntax.Interface == call.AbstractSyntax.Interface && ctx.AbstractSyntax.Major() == call.AbstractSyntax.Major()
+	if strict && !sameInterface {
+		return nil, ContextMismatch()
+	}
+	if typeStrict && created.Name != t.Name {
+		return nil, ContextMismatch()
+	}
+	return ctx, nil
+}
@@ -0,0 +1,140 @@
+package dcerpc
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"testing"
+)
+
+var (
+	testCounterType = ContextType{Name: "COUNTER", TypeStrict: true}
+	testReaderType  = ContextType{Name: "READER"}
+)
+
+// testContextRequest holds the handle that a context operation is given.
+type testContextRequest struct {
+	Handle ContextHandle
+}
+
+func TestContextMismatch(t *testing.T) {
+	if ContextMismatch() == ContextMismatch() {
+		t.Fatal("ContextMismatch returned the same fault twice")
+	}
+
+	var srv Server
+	err := srv.Register(testInterface, OperationTable{
+		func(ctx context.Context, call *Call) error {
+			h, err := call.NewContext(testCounterType, 10, nil)
+			if err != nil {
+				return err
+			}
+			return call.EncodeResponse(&testContextRequest{Handle: h})
+		},
+		func(ctx context.Context, call *Call) error {
+			var req testContextRequest
+			if err := call.DecodeRequest(&req); err != nil {
+				return err
+			}
+			_, err := call.Context(testCounterType, req.Handle)
+			return err
+		},
+		func(ctx context.Context, call *Call) error {
+			var req testContextRequest
+			if err := call.DecodeRequest(&req); err != nil {
+				return err
+			}
+			_, err := call.Context(testReaderType, req.Handle)
+			if err != nil {
+				// The fault is the operation's own to modify.
+				err.(*Fault).DidNotExecute = true
+			}
+			return err
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := testClient(&srv)
+	defer c.Close()
+	h := c.Handle(testBinding, testInterface)
+	ctx := context.Background()
+	var opened testContextRequest
+	if err := h.Invoke(ctx, 0, nil, &opened); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Invoke(ctx, 1, &opened, nil); err != nil {
+		t.Fatalf("using the context returned %v", err)
+	}
+	if err := h.Invoke(ctx, 2, &opened, nil); !IsContextMismatch(err) {
+		t.Fatalf("using the context as another type returned %v", err)
+	}
+	if err := h.Invoke(ctx, 1, &testContextRequest{}, nil); !IsContextMismatch(err) {
+		t.Fatalf("using a nil handle returned %v", err)
+	}
+	if fault := ContextMismatch(); fault.DidNotExecute {
+		t.Fatal("an operation modified the faults returned to other calls")
+	}
+}
+
+func TestContextHandleAcrossConnections(t *testing.T) {
+	var srv Server
+	started, release := make(chan struct{}), make(chan struct{})
+	err := srv.Register(testInterface, OperationTable{
+		func(ctx context.Context, call *Call) error {
+			h, err := call.NewContext(testCounterType, 10, nil)
+			if err != nil {
+				return err
+			}
+			return call.EncodeResponse(&testContextRequest{Handle: h})
+		},
+		func(ctx context.Context, call *Call) error {
+			var req testContextRequest
+			if err := call.DecodeRequest(&req); err != nil {
+				return err
+			}
+			_, err := call.Context(testCounterType, req.Handle)
+			return err
+		},
+		func(ctx context.Context, call *Call) error {
+			close(started)
+			<-release
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dials int32
+	dial := testDialer(&srv)
+	c := &Client{Dialers: map[string]Dialer{ProtSeqTCP: DialerFunc(func(ctx context.Context, b Binding) (io.ReadWriteCloser, error) {
+		atomic.AddInt32(&dials, 1)
+		return dial.Dial(ctx, b)
+	})}}
+	defer c.Close()
+	h := c.Handle(testBinding, testInterface)
+	ctx := context.Background()
+	var opened testContextRequest
+	if err := h.Invoke(ctx, 0, nil, &opened); err != nil {
+		t.Fatal(err)
+	}
+
+	// Keep the first connection busy so that the context is used on a
+	// second connection in the same association group.
+	done := make(chan error, 1)
+	go func() { done <- h.Invoke(ctx, 2, nil, nil) }()
+	<-started
+	err = h.Invoke(ctx, 1, &opened, nil)
+	close(release)
+	if err != nil {
+		t.Fatalf("using the context on another connection returned %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&dials); n != 2 {
+		t.Fatalf("%d connections were dialed, want 2", n)
+	}
+}
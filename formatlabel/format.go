@@ -23,3 +23,9 @@ func (f *Format) CharRep() byte {
 func (f *Format) FloatRep() byte {
 	return f[1]
 }
+
+// Valid returns true if the integer, character and floating-point
+// representations of the format label are all defined by NDR.
+func (f *Format) Valid() bool {
+	return f.IntRep() <= LittleEndian && f.CharRep() <= EBCDIC && f.FloatRep() <= IBM
+}
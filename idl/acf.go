@@ -0,0 +1,230 @@
+package idl
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/gentlemanautomaton/dcerpc/idl/types"
+)
+
+// ParseACFFile reads and parses the application configuration file at the
+// given path.
+func ParseACFFile(path string) (*types.ACF, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseACF(path, src)
+}
+
+// ParseACF parses the source of an application configuration file. The
+// filename is recorded in the returned configuration and is used to describe
+// the position of errors.
+//
+// Attributes are recorded without interpretation. They are applied to the
+// declarations of an IDL file by Configure.
+func ParseACF(filename string, src []byte) (acf *types.ACF, err error) {
+	p, err := newParser(filename, src)
+	if err != nil {
+		return nil, err
+	}
+	defer p.recover(&err)
+	return p.acf(filename), nil
+}
+
+// acf parses the top level of an application configuration file.
+func (p *parser) acf(name string) *types.ACF {
+	acf := &types.ACF{Name: name}
+	for p.peek().kind != tokenEOF {
+		if p.skipDirective() {
+			continue
+		}
+		var attrs types.FieldAttrList
+		if p.is("[") {
+			attrs = p.attrs()
+		}
+		switch {
+		case p.is("interface"):
+			acf.Interfaces = append(acf.Interfaces, p.acfInterface(attrs))
+		case attrs != nil:
+			p.fail("expected interface, found %s", p.describe(p.peek()))
+		case p.accept("include") || p.accept("import"):
+			acf.Includes = append(acf.Includes, p.imports()...)
+		default:
+			p.fail("unexpected %s", p.describe(p.peek()))
+		}
+	}
+	return acf
+}
+
+// acfInterface parses the configuration of an interface.
+func (p *parser) acfInterface(attrs types.FieldAttrList) *types.ACFInterface {
+	p.expect("interface")
+	iface := &types.ACFInterface{Name: p.ident(), Attrs: attrs}
+	p.expect("{")
+	for !p.accept("}") {
+		if p.peek().kind == tokenEOF {
+			p.fail("unexpected end of file in interface %s", iface.Name)
+		}
+		if p.skipDirective() {
+			continue
+		}
+		switch {
+		case p.accept("include") || p.accept("import"):
+			// Included headers only matter to C compilers.
+			p.imports()
+		case p.accept("typedef"):
+			var attrs types.FieldAttrList
+			if p.is("[") {
+				attrs = p.attrs()
+			}
+			for {
+				iface.Typedefs = append(iface.Typedefs, &types.ACFTypedef{Name: p.ident(), Attrs: attrs})
+				if !p.accept(",") {
+					break
+				}
+			}
+			p.expect(";")
+		default:
+			var attrs types.FieldAttrList
+			if p.is("[") {
+				attrs = p.attrs()
+			}
+			iface.Operations = append(iface.Operations, p.acfOperation(attrs))
+		}
+	}
+	p.accept(";")
+	return iface
+}
+
+// acfOperation parses the configuration of an operation and its parameters.
+func (p *parser) acfOperation(attrs types.FieldAttrList) *types.ACFOperation {
+	op := &types.ACFOperation{Name: p.ident(), Attrs: attrs}
+	p.expect("(")
+	for !p.accept(")") {
+		if len(op.Params) > 0 {
+			p.expect(",")
+		}
+		param := &types.ACFParam{}
+		if p.is("[") {
+			param.Attrs = p.attrs()
+		}
+		param.Name = p.ident()
+		op.Params = append(op.Params, param)
+	}
+	p.expect(";")
+	return op
+}
+
+// Configure applies the attributes of an application configuration file to
+// the declarations of an IDL file, as MIDL does when it compiles them
+// together. The attributes of each configured interface, typedef, operation
+// and parameter are appended to those declared in the IDL file.
+//
+// A configured parameter that the operation does not declare is added to the
+// operation as an error_status_t pointer. It must have the comm_status or
+// fault_status attribute, and it has neither the in nor the out attribute
+// because it is never transmitted.
+//
+// An error is returned if the configuration names a declaration that the IDL
+// file does not contain, or if a status attribute is applied to something
+// other than an error_status_t.
+func Configure(f *types.File, acf *types.ACF) error {
+	for _, ai := range acf.Interfaces {
+		iface := findInterface(f, ai.Name)
+		if iface == nil {
+			return fmt.Errorf("idl: %s: interface %s is not declared in %s", acf.Name, ai.Name, f.Name)
+		}
+		iface.Attrs = append(iface.Attrs, ai.Attrs...)
+
+		for _, at := range ai.Typedefs {
+			def := findTypedef(f, iface, at.Name)
+			if def == nil {
+				return fmt.Errorf("idl: %s: type %s is not declared in %s", acf.Name, at.Name, f.Name)
+			}
+			def.Attrs = append(def.Attrs, at.Attrs...)
+		}
+
+		for _, ao := range ai.Operations {
+			op := findOperation(iface, ao.Name)
+			if op == nil {
+				return fmt.Errorf("idl: %s: operation %s is not declared by interface %s", acf.Name, ao.Name, iface.Name)
+			}
+			if isStatus(ao.Attrs) && !isErrorStatus(op.Return) {
+				return fmt.Errorf("idl: %s: operation %s must return error_status_t to have a status attribute", acf.Name, op.Name)
+			}
+			op.Attrs = append(op.Attrs, ao.Attrs...)
+
+			for _, ap := range ao.Params {
+				param := findParam(op, ap.Name)
+				if param == nil {
+					if !isStatus(ap.Attrs) {
+						return fmt.Errorf("idl: %s: parameter %s is not declared by operation %s", acf.Name, ap.Name, op.Name)
+					}
+					param = &types.Param{
+						Name: ap.Name,
+						Type: &types.Type{Kind: types.Pointer, Elem: &types.Type{Kind: types.Named, Name: "error_status_t"}},
+					}
+					op.Params = append(op.Params, param)
+				}
+				if isStatus(ap.Attrs) && (param.Type.Kind != types.Pointer || !isErrorStatus(param.Type.Elem)) {
+					return fmt.Errorf("idl: %s: parameter %s of operation %s must be an error_status_t pointer to have a status attribute", acf.Name, param.Name, op.Name)
+				}
+				param.Attrs = append(param.Attrs, ap.Attrs...)
+			}
+		}
+	}
+	return nil
+}
+
+func findInterface(f *types.File, name string) *types.Interface {
+	for _, iface := range f.Interfaces {
+		if iface.Name == name {
+			return iface
+		}
+	}
+	return nil
+}
+
+// findTypedef looks for a type declared by the interface or at the top level
+// of the file.
+func findTypedef(f *types.File, iface *types.Interface, name string) *types.Typedef {
+	for _, defs := range [][]*types.Typedef{iface.Typedefs, f.Typedefs} {
+		for _, def := range defs {
+			if def.Name == name {
+				return def
+			}
+		}
+	}
+	return nil
+}
+
+func findOperation(iface *types.Interface, name string) *types.Operation {
+	for _, op := range iface.Operations {
+		if op.Name == name {
+			return op
+		}
+	}
+	return nil
+}
+
+func findParam(op *types.Operation, name string) *types.Param {
+	for _, param := range op.Params {
+		if param.Name == name {
+			return param
+		}
+	}
+	return nil
+}
+
+// isStatus returns true if the attributes include comm_status or
+// fault_status.
+func isStatus(attrs types.FieldAttrList) bool {
+	_, comm := attrs.Lookup("comm_status")
+	_, fault := attrs.Lookup("fault_status")
+	return comm || fault
+}
+
+func isErrorStatus(t *types.Type) bool {
+	return t != nil && t.Kind == types.Named && t.Name == "error_status_t"
+}
@@ -0,0 +1,146 @@
+package idl
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gentlemanautomaton/dcerpc/idl/types"
+)
+
+const testConfigIDL = `
+[uuid(11111111-2222-3333-4444-666666666666), version(1.0)]
+interface calc
+{
+    typedef struct { long Hi; long Lo; } PAIR;
+    error_status_t Div([in] long a, [in] long b, [out] long *q);
+    void Swap([in] PAIR p, [out] PAIR *r, [out] error_status_t *st);
+    void Fail([in] long a);
+}
+`
+
+const testConfigACF = `
+/* configuration */
+[implicit_handle(handle_t hCalc)]
+interface calc
+{
+    include "local.h";
+    typedef [represent_as(Local)] PAIR;
+    [fault_status, comm_status] Div();
+    Swap([fault_status] st);
+    [nocode] Fail([comm_status] cst);
+}
+`
+
+func TestParseACF(t *testing.T) {
+	acf, err := ParseACF("calc.acf", []byte(testConfigACF))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(acf.Interfaces) != 1 {
+		t.Fatalf("parsed %d interfaces, want 1", len(acf.Interfaces))
+	}
+	iface := acf.Interfaces[0]
+	if v, _ := iface.Attrs.Lookup("implicit_handle"); iface.Name != "calc" || v != "handle_t hCalc" {
+		t.Fatalf("interface %s has attributes %v", iface.Name, iface.Attrs)
+	}
+	if len(iface.Typedefs) != 1 || iface.Typedefs[0].Name != "PAIR" || !iface.Typedefs[0].Attrs.Contains("represent_as") {
+		t.Fatalf("typedefs are %+v", iface.Typedefs)
+	}
+	if len(iface.Operations) != 3 {
+		t.Fatalf("parsed %d operations, want 3", len(iface.Operations))
+	}
+	div, swap, fail := iface.Operations[0], iface.Operations[1], iface.Operations[2]
+	if div.Name != "Div" || !div.Attrs.Contains("fault_status") || !div.Attrs.Contains("comm_status") || len(div.Params) != 0 {
+		t.Fatalf("Div is configured as %+v", div)
+	}
+	if swap.Name != "Swap" || len(swap.Params) != 1 || swap.Params[0].Name != "st" || !swap.Params[0].Attrs.Contains("fault_status") {
+		t.Fatalf("Swap is configured as %+v", swap)
+	}
+	if fail.Name != "Fail" || !fail.Attrs.Contains("nocode") || len(fail.Params) != 1 {
+		t.Fatalf("Fail is configured as %+v", fail)
+	}
+}
+
+func TestParseACFError(t *testing.T) {
+	for _, src := range []string{
+		"[nocode] typedef long X;",
+		"interface calc { Div(",
+		"interface calc { Div(a b); }",
+	} {
+		if _, err := ParseACF("bad.acf", []byte(src)); err == nil {
+			t.Errorf("%q was parsed without error", src)
+		}
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	f, err := Parse("calc.idl", []byte(testConfigIDL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	acf, err := ParseACF("calc.acf", []byte(testConfigACF))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Configure(f, acf); err != nil {
+		t.Fatal(err)
+	}
+
+	iface := f.Interfaces[0]
+	if !iface.Attrs.Contains("implicit_handle") || !iface.Attrs.Contains("uuid") {
+		t.Fatalf("interface has attributes %v", iface.Attrs)
+	}
+	if !iface.Typedefs[0].Attrs.Contains("represent_as") {
+		t.Fatalf("PAIR has attributes %v", iface.Typedefs[0].Attrs)
+	}
+	div, swap, fail := iface.Operations[0], iface.Operations[1], iface.Operations[2]
+	if !div.Attrs.Contains("fault_status") {
+		t.Fatalf("Div has attributes %v", div.Attrs)
+	}
+	if st := swap.Params[2]; !st.Attrs.Contains("fault_status") || !st.Out() {
+		t.Fatalf("st has attributes %v", st.Attrs)
+	}
+
+	// The status parameter that the configuration adds is not transmitted.
+	if len(fail.Params) != 2 {
+		t.Fatalf("Fail has %d parameters, want 2", len(fail.Params))
+	}
+	cst := fail.Params[1]
+	if cst.Name != "cst" || cst.In() || cst.Out() || !cst.Attrs.Contains("comm_status") {
+		t.Fatalf("cst is %+v", cst)
+	}
+	if cst.Type.Kind != types.Pointer || cst.Type.Elem.Name != "error_status_t" {
+		t.Fatalf("cst has type %+v", cst.Type)
+	}
+}
+
+func TestConfigureError(t *testing.T) {
+	tests := []struct {
+		name string
+		acf  string
+		want string
+	}{
+		{"interface", "interface other { }", "interface other is not declared"},
+		{"typedef", "interface calc { typedef [represent_as(L)] QUAD; }", "type QUAD is not declared"},
+		{"operation", "interface calc { Mul(); }", "operation Mul is not declared"},
+		{"parameter", "interface calc { Div([nocode] c); }", "parameter c is not declared"},
+		{"operation-status", "interface calc { [comm_status] Fail(); }", "must return error_status_t"},
+		{"parameter-status", "interface calc { Div([fault_status] a); }", "must be an error_status_t pointer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := Parse("calc.idl", []byte(testConfigIDL))
+			if err != nil {
+				t.Fatal(err)
+			}
+			acf, err := ParseACF("calc.acf", []byte(tt.acf))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = Configure(f, acf)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Configure returned %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+// Package idl parses files written in the DCE / RPC interface definition
+// language, including the Microsoft extensions accepted by MIDL, and produces
+// the abstract syntax tree described by the idl/types package.
+//
+// The parser understands the IDL files published with Microsoft's protocol
+// specifications: interface headers and their attributes, imports, constants,
+// typedefs, structures, encapsulated and non-encapsulated unions,
+// enumerations, pipes and operations with attributed parameters. Expressions,
+// such as array sizes and the values of constants, are recorded as source
+// text.
+//
+// Application configuration files, which MIDL compiles alongside IDL files,
+// are parsed by ParseACF and their attributes are applied to the
+// declarations of an IDL file by Configure.
+//
+// The language is formally specified in the "[C706] DCE 1.1: Remote Procedure
+// Call" technical standard published by the Open Group. The Microsoft
+// extensions are described in "[MS-RPCE] Remote Procedure Call Protocol
+// Extensions".
+package idl
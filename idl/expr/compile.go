@@ -0,0 +1,346 @@
+package expr
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// ErrDivideByZero is returned when an expression divides by zero.
+var ErrDivideByZero = errors.New("expr: division by zero")
+
+// FieldError is returned by Compile when an expression refers to a field that
+// the struct type does not have.
+type FieldError struct {
+	Type reflect.Type
+	Name string
+}
+
+// Error returns a description of the error.
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("expr: type %s has no field %s", e.Type, e.Name)
+}
+
+// Func is an expression that has been compiled for a struct type.
+type Func struct {
+	expr   Expr
+	eval   evalFunc
+	fields []int
+}
+
+type evalFunc func(v reflect.Value) (int64, error)
+
+// Eval evaluates the expression for v, which must be a value of the struct
+// type that the expression was compiled for.
+func (f *Func) Eval(v reflect.Value) (int64, error) {
+	return f.eval(v)
+}
+
+// Fields returns the indices of the fields of the struct type that the
+// expression refers to, in ascending order.
+func (f *Func) Fields() []int {
+	return f.fields
+}
+
+// String returns the expression in the form of source code.
+func (f *Func) String() string {
+	return f.expr.String()
+}
+
+// Compile compiles e for values of the struct type rt. Each identifier of the
+// expression refers to a field of rt. A field that is not found by its name
+// is looked up with its first letter in upper case, which is how the idl2go
+// command names fields.
+//
+// The idl2go command removes the top-level pointers of parameters, so the
+// dereference operator may be applied to a field that is not a pointer, in
+// which case it yields the value of the field. A field that is a pointer must
+// be dereferenced.
+//
+// If e refers to a field that rt does not have, a *FieldError is returned.
+func Compile(e Expr, rt reflect.Type) (*Func, error) {
+	if rt.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("expr: cannot compile %s for non-struct type %s", e, rt)
+	}
+	c := &compiler{rt: rt, fields: make(map[int]bool)}
+	eval, err := c.compile(e)
+	if err != nil {
+		return nil, err
+	}
+	f := &Func{expr: e, eval: eval}
+	for i := range c.fields {
+		f.fields = append(f.fields, i)
+	}
+	sort.Ints(f.fields)
+	return f, nil
+}
+
+// CompileString parses and compiles the source of an expression for values
+// of the struct type rt.
+func CompileString(s string, rt reflect.Type) (*Func, error) {
+	e, err := Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	return Compile(e, rt)
+}
+
+// compiler translates expressions into evaluation functions.
+type compiler struct {
+	rt     reflect.Type
+	fields map[int]bool
+}
+
+func (c *compiler) compile(e Expr) (evalFunc, error) {
+	switch e := e.(type) {
+	case *Number:
+		v := e.Value
+		return func(reflect.Value) (int64, error) { return v, nil }, nil
+	case *Ident:
+		return c.ident(e, false)
+	case *Unary:
+		if e.Op == "*" {
+			id, ok := e.X.(*Ident)
+			if !ok {
+				return nil, fmt.Errorf("expr: cannot dereference %s", e.X)
+			}
+			return c.ident(id, true)
+		}
+		x, err := c.compile(e.X)
+		if err != nil {
+			return nil, err
+		}
+		return unary(e.Op, x), nil
+	case *Binary:
+		x, err := c.compile(e.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := c.compile(e.Y)
+		if err != nil {
+			return nil, err
+		}
+		return binary(e.Op, x, y), nil
+	case *Cond:
+		cond, err := c.compile(e.Cond)
+		if err != nil {
+			return nil, err
+		}
+		then, err := c.compile(e.Then)
+		if err != nil {
+			return nil, err
+		}
+		els, err := c.compile(e.Else)
+		if err != nil {
+			return nil, err
+		}
+		return func(v reflect.Value) (int64, error) {
+			x, err := cond(v)
+			if err != nil {
+				return 0, err
+			}
+			if x != 0 {
+				return then(v)
+			}
+			return els(v)
+		}, nil
+	}
+	return nil, fmt.Errorf("expr: unsupported expression %s", e)
+}
+
+// ident compiles a field reference. If deref is true the field is
+// dereferenced if it is a pointer.
+func (c *compiler) ident(id *Ident, deref bool) (evalFunc, error) {
+	t := c.rt
+	var path [][]int
+	for i, name := range id.Path {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("expr: %s is not a struct in %s", name, id)
+		}
+		f, ok := field(t, name)
+		if !ok {
+			return nil, &FieldError{Type: t, Name: name}
+		}
+		if i == 0 {
+			c.fields[f.Index[0]] = true
+		}
+		path = append(path, f.Index)
+		t = f.Type
+	}
+
+	ptr := t.Kind() == reflect.Ptr
+	if ptr {
+		if !deref {
+			return nil, fmt.Errorf("expr: %s is a pointer and must be dereferenced", id)
+		}
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+	default:
+		return nil, fmt.Errorf("expr: %s has non-integer type %s", id, t)
+	}
+
+	return func(v reflect.Value) (int64, error) {
+		for _, index := range path {
+			for v.Kind() == reflect.Ptr {
+				if v.IsNil() {
+					return 0, fmt.Errorf("expr: nil pointer in %s", id)
+				}
+				v = v.Elem()
+			}
+			v = v.FieldByIndex(index)
+		}
+		if ptr {
+			if v.IsNil() {
+				return 0, fmt.Errorf("expr: nil pointer in %s", id)
+			}
+			v = v.Elem()
+		}
+		return intValue(v), nil
+	}, nil
+}
+
+// field looks up the field of t with the given name, or with the name with
+// its first letter in upper case.
+func field(t reflect.Type, name string) (reflect.StructField, bool) {
+	if f, ok := t.FieldByName(name); ok {
+		return f, true
+	}
+	if c := name[0]; c >= 'a' && c <= 'z' {
+		return t.FieldByName(string(c-'a'+'A') + name[1:])
+	}
+	return reflect.StructField{}, false
+}
+
+func unary(op string, x evalFunc) evalFunc {
+	var f func(int64) int64
+	switch op {
+	case "-":
+		f = func(a int64) int64 { return -a }
+	case "+":
+		f = func(a int64) int64 { return a }
+	case "!":
+		f = func(a int64) int64 { return boolValue(a == 0) }
+	case "~":
+		f = func(a int64) int64 { return ^a }
+	}
+	return func(v reflect.Value) (int64, error) {
+		a, err := x(v)
+		if err != nil {
+			return 0, err
+		}
+		return f(a), nil
+	}
+}
+
+func binary(op string, x, y evalFunc) evalFunc {
+	switch op {
+	case "&&", "||":
+		// The second operand is only evaluated when it is needed.
+		short := op == "||"
+		return func(v reflect.Value) (int64, error) {
+			a, err := x(v)
+			if err != nil {
+				return 0, err
+			}
+			if (a != 0) == short {
+				return boolValue(short), nil
+			}
+			b, err := y(v)
+			if err != nil {
+				return 0, err
+			}
+			return boolValue(b != 0), nil
+		}
+	}
+
+	var f func(a, b int64) (int64, error)
+	switch op {
+	case "+":
+		f = func(a, b int64) (int64, error) { return a + b, nil }
+	case "-":
+		f = func(a, b int64) (int64, error) { return a - b, nil }
+	case "*":
+		f = func(a, b int64) (int64, error) { return a * b, nil }
+	case "/":
+		f = func(a, b int64) (int64, error) {
+			if b == 0 {
+				return 0, ErrDivideByZero
+			}
+			return a / b, nil
+		}
+	case "%":
+		f = func(a, b int64) (int64, error) {
+			if b == 0 {
+				return 0, ErrDivideByZero
+			}
+			return a % b, nil
+		}
+	case "<<", ">>":
+		left := op == "<<"
+		f = func(a, b int64) (int64, error) {
+			if b < 0 {
+				return 0, fmt.Errorf("expr: negative shift count %d", b)
+			}
+			if left {
+				return a << uint64(b), nil
+			}
+			return a >> uint64(b), nil
+		}
+	case "&":
+		f = func(a, b int64) (int64, error) { return a & b, nil }
+	case "|":
+		f = func(a, b int64) (int64, error) { return a | b, nil }
+	case "^":
+		f = func(a, b int64) (int64, error) { return a ^ b, nil }
+	case "==":
+		f = func(a, b int64) (int64, error) { return boolValue(a == b), nil }
+	case "!=":
+		f = func(a, b int64) (int64, error) { return boolValue(a != b), nil }
+	case "<":
+		f = func(a, b int64) (int64, error) { return boolValue(a < b), nil }
+	case ">":
+		f = func(a, b int64) (int64, error) { return boolValue(a > b), nil }
+	case "<=":
+		f = func(a, b int64) (int64, error) { return boolValue(a <= b), nil }
+	case ">=":
+		f = func(a, b int64) (int64, error) { return boolValue(a >= b), nil }
+	}
+	return func(v reflect.Value) (int64, error) {
+		a, err := x(v)
+		if err != nil {
+			return 0, err
+		}
+		b, err := y(v)
+		if err != nil {
+			return 0, err
+		}
+		return f(a, b)
+	}
+}
+
+func boolValue(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// intValue returns the value of v, which must be an integer or a bool, as an
+// int64.
+func intValue(v reflect.Value) int64 {
+	switch v.Kind() {
+	case reflect.Bool:
+		return boolValue(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	}
+	return int64(v.Uint())
+}
@@ -0,0 +1,284 @@
+// Package expr parses and evaluates the expressions that appear in the
+// attributes of IDL declarations, such as the size_is(Length/2) attribute of
+// a conformant array.
+//
+// Expressions are written in the subset of C that MIDL accepts for
+// correlation attributes: integer and character constants, references to
+// fields, the member operators . and ->, the dereference operator *, and the
+// unary, arithmetic, shift, relational, bitwise, logical and conditional
+// operators. Named constants are not understood; the idl2go command replaces
+// them with their values when it generates struct tags.
+//
+// An expression is parsed once with Parse and then compiled with Compile for
+// the struct type whose fields it refers to. The compiled expression is
+// evaluated against values of that type.
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Expr is a node of a parsed expression.
+type Expr interface {
+	String() string
+}
+
+// Number is an integer or character constant.
+type Number struct {
+	Value int64
+}
+
+// Ident is a reference to a field, which may be a member of another field.
+type Ident struct {
+	Path []string
+}
+
+// Unary applies a unary operator to an operand. The dereference operator is
+// represented by "*".
+type Unary struct {
+	Op string
+	X  Expr
+}
+
+// Binary applies a binary operator to two operands.
+type Binary struct {
+	Op   string
+	X, Y Expr
+}
+
+// Cond is a conditional expression.
+type Cond struct {
+	Cond, Then, Else Expr
+}
+
+func (n *Number) String() string { return strconv.FormatInt(n.Value, 10) }
+func (i *Ident) String() string  { return strings.Join(i.Path, ".") }
+func (u *Unary) String() string  { return u.Op + u.X.String() }
+func (b *Binary) String() string { return "(" + b.X.String() + " " + b.Op + " " + b.Y.String() + ")" }
+func (c *Cond) String() string {
+	return "(" + c.Cond.String() + " ? " + c.Then.String() + " : " + c.Else.String() + ")"
+}
+
+// Error is an error encountered while parsing an expression.
+type Error struct {
+	Expr   string // The source of the expression
+	Offset int    // The offset of the error within the source
+	Msg    string
+}
+
+// Error returns a description of the error.
+func (e *Error) Error() string {
+	return fmt.Sprintf("expr: %s at offset %d of %q", e.Msg, e.Offset, e.Expr)
+}
+
+// precedence lists the binary operators from the lowest precedence to the
+// highest. The conditional operator has a lower precedence than all of them.
+var precedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"|"},
+	{"^"},
+	{"&"},
+	{"==", "!="},
+	{"<", ">", "<=", ">="},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+// operators lists the operators and delimiters, with the longest first.
+var operators = []string{
+	"->", "<<", ">>", "<=", ">=", "==", "!=", "&&", "||",
+	"+", "-", "*", "/", "%", "<", ">", "&", "|", "^", "!", "~",
+	"?", ":", "(", ")", ".",
+}
+
+// Parse parses the source of an expression.
+func Parse(s string) (e Expr, err error) {
+	p := &parser{src: s}
+	defer func() {
+		if r := recover(); r != nil {
+			perr, ok := r.(*Error)
+			if !ok {
+				panic(r)
+			}
+			e, err = nil, perr
+		}
+	}()
+	p.scan()
+	e = p.cond()
+	if p.tok != "" {
+		p.fail("unexpected %q", p.tok)
+	}
+	return e, nil
+}
+
+// parser is a recursive descent parser of expressions.
+type parser struct {
+	src string
+	off int    // Offset of the next token
+	tok string // The current token, or empty at the end of the source
+	pos int    // Offset of the current token
+}
+
+func (p *parser) fail(format string, args ...interface{}) {
+	panic(&Error{Expr: p.src, Offset: p.pos, Msg: fmt.Sprintf(format, args...)})
+}
+
+// scan advances to the next token.
+func (p *parser) scan() {
+	for p.off < len(p.src) && isSpace(p.src[p.off]) {
+		p.off++
+	}
+	p.pos = p.off
+	if p.off == len(p.src) {
+		p.tok = ""
+		return
+	}
+	c := p.src[p.off]
+	end := p.off + 1
+	switch {
+	case isIdent(c):
+		for end < len(p.src) && isIdent(p.src[end]) {
+			end++
+		}
+	case c == '\'':
+		for end < len(p.src) && p.src[end] != '\'' {
+			if p.src[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(p.src) {
+			p.fail("unterminated character constant")
+		}
+		end++
+	default:
+		end = 0
+		for _, op := range operators {
+			if strings.HasPrefix(p.src[p.off:], op) {
+				end = p.off + len(op)
+				break
+			}
+		}
+		if end == 0 {
+			p.fail("unexpected character %q", c)
+		}
+	}
+	p.tok = p.src[p.off:end]
+	p.off = end
+}
+
+func (p *parser) expect(tok string) {
+	if p.tok != tok {
+		if p.tok == "" {
+			p.fail("expected %q, found end of expression", tok)
+		}
+		p.fail("expected %q, found %q", tok, p.tok)
+	}
+	p.scan()
+}
+
+// cond parses a conditional expression.
+func (p *parser) cond() Expr {
+	e := p.binary(0)
+	if p.tok != "?" {
+		return e
+	}
+	p.scan()
+	then := p.cond()
+	p.expect(":")
+	return &Cond{Cond: e, Then: then, Else: p.cond()}
+}
+
+// binary parses a sequence of binary operators of the given level of
+// precedence or higher.
+func (p *parser) binary(level int) Expr {
+	if level == len(precedence) {
+		return p.unary()
+	}
+	x := p.binary(level + 1)
+	for contains(precedence[level], p.tok) {
+		op := p.tok
+		p.scan()
+		x = &Binary{Op: op, X: x, Y: p.binary(level + 1)}
+	}
+	return x
+}
+
+// unary parses a unary expression.
+func (p *parser) unary() Expr {
+	switch p.tok {
+	case "-", "+", "!", "~", "*":
+		op := p.tok
+		p.scan()
+		return &Unary{Op: op, X: p.unary()}
+	}
+	return p.primary()
+}
+
+// primary parses a constant, a field reference or a parenthesized
+// expression.
+func (p *parser) primary() Expr {
+	tok := p.tok
+	switch {
+	case tok == "":
+		p.fail("unexpected end of expression")
+	case tok == "(":
+		p.scan()
+		e := p.cond()
+		p.expect(")")
+		return e
+	case tok[0] == '\'':
+		v, _, _, err := strconv.UnquoteChar(tok[1:len(tok)-1], '\'')
+		if err != nil {
+			p.fail("invalid character constant %s", tok)
+		}
+		p.scan()
+		return &Number{Value: int64(v)}
+	case isDigit(tok[0]):
+		v, err := strconv.ParseUint(strings.TrimRight(tok, "uUlL"), 0, 64)
+		if err != nil {
+			p.fail("invalid number %s", tok)
+		}
+		p.scan()
+		return &Number{Value: int64(v)}
+	case isIdent(tok[0]):
+		id := &Ident{Path: []string{tok}}
+		p.scan()
+		for p.tok == "." || p.tok == "->" {
+			p.scan()
+			if p.tok == "" || !isIdent(p.tok[0]) || isDigit(p.tok[0]) {
+				p.fail("expected field name")
+			}
+			id.Path = append(id.Path, p.tok)
+			p.scan()
+		}
+		return id
+	}
+	p.fail("unexpected %q", tok)
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func isIdent(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || isDigit(c)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
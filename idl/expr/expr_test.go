@@ -0,0 +1,73 @@
+package expr
+
+import (
+	"reflect"
+	"testing"
+)
+
+type exprTest struct {
+	Count   uint32
+	Size    int16
+	pLength *uint32
+	Inner   struct{ N uint8 }
+	Enabled bool
+}
+
+func TestEval(t *testing.T) {
+	length := uint32(10)
+	v := reflect.ValueOf(exprTest{Count: 7, Size: -3, pLength: &length, Enabled: true})
+	tests := []struct {
+		expr string
+		want int64
+	}{
+		{"Count", 7},
+		{"count", 7},
+		{"Count/2", 3},
+		{"(Count + 1) * 2", 16},
+		{"Count + 1 * 2", 9},
+		{"*pLength", 10},
+		{"*Count", 7},
+		{"-Size", 3},
+		{"Count > 5 ? Count : 5", 7},
+		{"Enabled && Count == 7", 1},
+		{"Enabled || Count / 0", 1},
+		{"0x10 >> 2 | 1", 5},
+		{"~0 & 0xff", 255},
+		{"'A'", 65},
+		{"10UL % 4", 2},
+		{"Inner.N + 1", 1},
+	}
+	for _, tt := range tests {
+		f, err := CompileString(tt.expr, v.Type())
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+		got, err := f.Eval(v)
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s = %d, want %d", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	rt := reflect.TypeOf(exprTest{})
+	if _, err := CompileString("Missing + 1", rt); err == nil {
+		t.Error("expected an error for a missing field")
+	} else if _, ok := err.(*FieldError); !ok {
+		t.Errorf("missing field returned %T, want *FieldError", err)
+	}
+	for _, s := range []string{"pLength", "Count +", "(Count", "Count $ 2", "*(Count+1)"} {
+		if _, err := CompileString(s, rt); err == nil {
+			t.Errorf("%s: expected an error", s)
+		}
+	}
+	f, _ := CompileString("Count / Size", rt)
+	if _, err := f.Eval(reflect.ValueOf(exprTest{})); err != ErrDivideByZero {
+		t.Errorf("division by zero returned %v", err)
+	}
+}
@@ -0,0 +1,686 @@
+package idl
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gentlemanautomaton/dcerpc/idl/types"
+	"github.com/gentlemanautomaton/dcerpc/uuid"
+)
+
+// baseKeywords are the keywords that make up the names of base types.
+var baseKeywords = map[string]bool{
+	"unsigned": true, "signed": true, "short": true, "long": true,
+	"small": true, "hyper": true, "int": true, "char": true,
+	"wchar_t": true, "byte": true, "boolean": true, "float": true,
+	"double": true, "void": true, "handle_t": true,
+	"error_status_t": true, "__int8": true, "__int16": true,
+	"__int32": true, "__int64": true, "__int3264": true,
+}
+
+// callingConventions are the keywords that may appear between the return
+// type and name of an operation. They have no effect on the wire.
+var callingConventions = map[string]bool{
+	"__stdcall": true, "_stdcall": true, "__cdecl": true, "_cdecl": true,
+	"__fastcall": true, "__RPC_FAR": true, "__RPC_API": true,
+}
+
+// ParseFile reads and parses the IDL file at the given path.
+func ParseFile(path string) (*types.File, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(path, src)
+}
+
+// Parse parses the source of an IDL file. The filename is recorded in the
+// returned file and is used to describe the position of errors.
+//
+// Imported files are listed in the returned file but are not parsed.
+// Preprocessor directives, cpp_quote and midl_pragma are ignored.
+func Parse(filename string, src []byte) (f *types.File, err error) {
+	p, err := newParser(filename, src)
+	if err != nil {
+		return nil, err
+	}
+	defer p.recover(&err)
+	return p.file(filename), nil
+}
+
+// parser is a recursive descent parser of IDL files.
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// newParser returns a parser for the tokens of the given source.
+func newParser(filename string, src []byte) (*parser, error) {
+	s := newScanner(filename, src)
+	p := &parser{}
+	for {
+		t, err := s.next()
+		if err != nil {
+			return nil, err
+		}
+		p.tokens = append(p.tokens, t)
+		if t.kind == tokenEOF {
+			return p, nil
+		}
+	}
+}
+
+// recover stores an error raised by a production in err. Errors are raised
+// with panic within the parser so that each production need not check them.
+func (p *parser) recover(err *error) {
+	if r := recover(); r != nil {
+		e, ok := r.(*Error)
+		if !ok {
+			panic(r)
+		}
+		*err = e
+	}
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) peekAt(n int) token {
+	if p.pos+n >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.pos+n]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// is returns true if the next token has the given text.
+func (p *parser) is(text string) bool {
+	t := p.peek()
+	return t.kind != tokenString && t.kind != tokenChar && t.text == text
+}
+
+// accept consumes the next token if it has the given text.
+func (p *parser) accept(text string) bool {
+	if p.is(text) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) token {
+	if !p.is(text) {
+		p.fail("expected %q, found %s", text, p.describe(p.peek()))
+	}
+	return p.next()
+}
+
+func (p *parser) ident() string {
+	t := p.peek()
+	if t.kind != tokenIdent {
+		p.fail("expected identifier, found %s", p.describe(t))
+	}
+	return p.next().text
+}
+
+func (p *parser) str() string {
+	t := p.peek()
+	if t.kind != tokenString {
+		p.fail("expected string, found %s", p.describe(t))
+	}
+	p.next()
+	s, err := strconv.Unquote(t.text)
+	if err != nil {
+		return t.text[1 : len(t.text)-1]
+	}
+	return s
+}
+
+func (p *parser) describe(t token) string {
+	if t.kind == tokenEOF {
+		return "end of file"
+	}
+	return strconv.Quote(t.text)
+}
+
+func (p *parser) fail(format string, args ...interface{}) {
+	panic(&Error{Pos: p.peek().pos, Msg: fmt.Sprintf(format, args...)})
+}
+
+// text returns the source text of the tokens in [from, to), with a single
+// space wherever the source separated them.
+func (p *parser) text(from, to int) string {
+	var b strings.Builder
+	for i := from; i < to; i++ {
+		if i > from && p.tokens[i].start > p.tokens[i-1].end {
+			b.WriteByte(' ')
+		}
+		b.WriteString(p.tokens[i].text)
+	}
+	return b.String()
+}
+
+// until consumes tokens up to but not including the first token at the
+// outermost level of nesting that has one of the given texts, and returns
+// their source text.
+func (p *parser) until(stop ...string) string {
+	start, depth := p.pos, 0
+	for {
+		t := p.peek()
+		if t.kind == tokenEOF {
+			p.fail("unexpected end of file")
+		}
+		if t.kind == tokenPunct {
+			if depth == 0 {
+				for _, s := range stop {
+					if t.text == s {
+						return p.text(start, p.pos)
+					}
+				}
+			}
+			switch t.text {
+			case "(", "[", "{":
+				depth++
+			case ")", "]", "}":
+				depth--
+			}
+		}
+		p.next()
+	}
+}
+
+// file parses the top level of an IDL file.
+func (p *parser) file(name string) *types.File {
+	f := &types.File{Name: name}
+	for p.peek().kind != tokenEOF {
+		if p.skipDirective() {
+			continue
+		}
+		var attrs types.FieldAttrList
+		if p.is("[") {
+			attrs = p.attrs()
+		}
+		switch {
+		case p.is("interface"):
+			if iface := p.iface(attrs); iface != nil {
+				f.Interfaces = append(f.Interfaces, iface)
+			}
+		case attrs != nil:
+			p.fail("expected interface, found %s", p.describe(p.peek()))
+		case p.accept("import"):
+			f.Imports = append(f.Imports, p.imports()...)
+		case p.is("typedef"):
+			f.Typedefs = append(f.Typedefs, p.typedef()...)
+		case p.is("const"):
+			f.Consts = append(f.Consts, p.constant())
+		case p.is("struct") || p.is("union") || p.is("enum"):
+			f.Typedefs = append(f.Typedefs, &types.Typedef{Type: p.typeSpec()})
+			p.expect(";")
+		default:
+			p.fail("unexpected %s", p.describe(p.peek()))
+		}
+	}
+	return f
+}
+
+// skipDirective skips stray semicolons, cpp_quote and midl_pragma.
+func (p *parser) skipDirective() bool {
+	switch {
+	case p.accept(";"):
+	case p.is("cpp_quote") || p.is("midl_pragma"):
+		p.next()
+		for p.peek().kind == tokenIdent {
+			p.next()
+		}
+		p.expect("(")
+		p.until(")")
+		p.expect(")")
+		p.accept(";")
+	default:
+		return false
+	}
+	return true
+}
+
+// attrs parses an attribute list. The value of each attribute is the source
+// text between its parentheses.
+func (p *parser) attrs() types.FieldAttrList {
+	list := types.FieldAttrList{}
+	for p.is("[") {
+		p.next()
+		if p.accept("]") {
+			continue
+		}
+		for {
+			attr := types.FieldAttr{Type: p.ident()}
+			if p.accept("(") {
+				attr.Value = p.until(")")
+				p.expect(")")
+			}
+			list = append(list, attr)
+			if !p.accept(",") {
+				break
+			}
+		}
+		p.expect("]")
+	}
+	return list
+}
+
+// imports parses the list of files that follows the import keyword.
+func (p *parser) imports() (files []string) {
+	for {
+		files = append(files, p.str())
+		if !p.accept(",") {
+			break
+		}
+	}
+	p.expect(";")
+	return
+}
+
+// iface parses an interface. It returns nil for a forward declaration.
+func (p *parser) iface(attrs types.FieldAttrList) *types.Interface {
+	p.expect("interface")
+	iface := &types.Interface{Name: p.ident(), Attrs: attrs}
+	if p.accept(";") {
+		return nil
+	}
+	if p.accept(":") {
+		iface.Base = p.ident()
+	}
+	p.interfaceAttrs(iface)
+
+	p.expect("{")
+	var opnum uint16
+	for !p.accept("}") {
+		if p.peek().kind == tokenEOF {
+			p.fail("unexpected end of file in interface %s", iface.Name)
+		}
+		if p.skipDirective() {
+			continue
+		}
+		switch {
+		case p.accept("import"):
+			iface.Imports = append(iface.Imports, p.imports()...)
+		case p.is("typedef"):
+			iface.Typedefs = append(iface.Typedefs, p.typedef()...)
+		case p.is("const"):
+			iface.Consts = append(iface.Consts, p.constant())
+		default:
+			var attrs types.FieldAttrList
+			if p.is("[") {
+				attrs = p.attrs()
+			}
+			t := p.typeSpec()
+			if attrs == nil && (t.Kind == types.Struct || t.Kind == types.Union || t.Kind == types.Enum) && p.accept(";") {
+				iface.Typedefs = append(iface.Typedefs, &types.Typedef{Type: t})
+				continue
+			}
+			op := p.operation(attrs, t)
+			op.OpNum = opnum
+			opnum++
+			iface.Operations = append(iface.Operations, op)
+		}
+	}
+	p.accept(";")
+	return iface
+}
+
+// interfaceAttrs interprets the attributes of an interface.
+func (p *parser) interfaceAttrs(iface *types.Interface) {
+	if v, ok := iface.Attrs.Lookup("uuid"); ok {
+		u, err := uuid.Parse(strings.Trim(v, `"`))
+		if err != nil {
+			p.fail("invalid uuid %q for interface %s", v, iface.Name)
+		}
+		iface.UUID = u
+	}
+	if v, ok := iface.Attrs.Lookup("version"); ok {
+		major, minor := v, "0"
+		if i := strings.IndexByte(v, '.'); i >= 0 {
+			major, minor = v[:i], v[i+1:]
+		}
+		x, err1 := strconv.ParseUint(major, 10, 16)
+		y, err2 := strconv.ParseUint(minor, 10, 16)
+		if err1 != nil || err2 != nil {
+			p.fail("invalid version %q for interface %s", v, iface.Name)
+		}
+		iface.VersionMajor, iface.VersionMinor = uint16(x), uint16(y)
+	}
+	if v, ok := iface.Attrs.Lookup("pointer_default"); ok {
+		iface.PointerDefault = v
+	}
+}
+
+// typedef parses a type declaration, which may declare several names.
+func (p *parser) typedef() (defs []*types.Typedef) {
+	p.expect("typedef")
+	var attrs types.FieldAttrList
+	if p.is("[") {
+		attrs = p.attrs()
+	}
+	base := p.typeSpec()
+	for {
+		name, t := p.declarator(base, true)
+		defs = append(defs, &types.Typedef{Name: name, Attrs: attrs, Type: t})
+		if !p.accept(",") {
+			break
+		}
+	}
+	p.expect(";")
+	return
+}
+
+// constant parses a constant declaration.
+func (p *parser) constant() *types.Const {
+	p.expect("const")
+	c := &types.Const{Type: p.typeSpec()}
+	c.Name, c.Type = p.declarator(c.Type, true)
+	p.expect("=")
+	c.Value = p.until(";")
+	p.expect(";")
+	return c
+}
+
+// operation parses the remainder of an operation declaration after its
+// return type.
+func (p *parser) operation(attrs types.FieldAttrList, ret *types.Type) *types.Operation {
+	for callingConventions[p.peek().text] {
+		p.next()
+	}
+	for p.accept("*") {
+		ret = &types.Type{Kind: types.Pointer, Elem: ret}
+	}
+	for callingConventions[p.peek().text] {
+		p.next()
+	}
+	op := &types.Operation{Name: p.ident(), Attrs: attrs, Return: ret}
+	p.expect("(")
+	if p.is("void") && p.peekAt(1).text == ")" {
+		p.next()
+	}
+	for !p.accept(")") {
+		if len(op.Params) > 0 {
+			p.expect(",")
+		}
+		param := &types.Param{}
+		if p.is("[") {
+			param.Attrs = p.attrs()
+		}
+		param.Name, param.Type = p.declarator(p.typeSpec(), false)
+		op.Params = append(op.Params, param)
+	}
+	p.expect(";")
+	return op
+}
+
+// declarator parses a declarator, which names a declaration and may derive
+// pointer and array types from the base type. If required is false the name
+// may be omitted.
+func (p *parser) declarator(base *types.Type, required bool) (name string, t *types.Type) {
+	t = base
+	for p.is("*") || p.is("const") || callingConventions[p.peek().text] {
+		if p.next().text == "*" {
+			t = &types.Type{Kind: types.Pointer, Elem: t}
+		}
+	}
+	if required || p.peek().kind == tokenIdent {
+		name = p.ident()
+	}
+
+	// The first dimension of a multi-dimensional array is the outermost.
+	var dims []string
+	for p.accept("[") {
+		size := p.until("]")
+		p.expect("]")
+		if size == "*" {
+			size = ""
+		}
+		dims = append(dims, size)
+	}
+	for i := len(dims) - 1; i >= 0; i-- {
+		t = &types.Type{Kind: types.Array, Size: dims[i], Elem: t}
+	}
+	return
+}
+
+// typeSpec parses a type specifier.
+func (p *parser) typeSpec() *types.Type {
+	for p.accept("const") {
+	}
+	var t *types.Type
+	switch {
+	case p.accept("struct"):
+		t = p.structSpec()
+	case p.accept("union"):
+		t = p.unionSpec()
+	case p.accept("enum"):
+		t = p.enumSpec()
+	case p.accept("pipe"):
+		t = &types.Type{Kind: types.Pipe, Elem: p.typeSpec()}
+	case baseKeywords[p.peek().text] && p.peek().kind == tokenIdent:
+		var words []string
+		for baseKeywords[p.peek().text] && p.peek().kind == tokenIdent {
+			words = append(words, p.next().text)
+		}
+		t = &types.Type{Kind: types.Named, Name: baseTypeName(words)}
+	case p.peek().kind == tokenIdent:
+		t = &types.Type{Kind: types.Named, Name: p.next().text}
+	default:
+		p.fail("expected type, found %s", p.describe(p.peek()))
+	}
+	for p.accept("const") {
+	}
+	return t
+}
+
+// baseTypeName returns the canonical name of the base type described by the
+// given keywords. Redundant uses of int and signed are removed, so that
+// "long int" is named "long" and "unsigned" is named "unsigned int".
+func baseTypeName(words []string) string {
+	var unsigned, signed bool
+	var rest []string
+	for _, w := range words {
+		switch w {
+		case "unsigned":
+			unsigned = true
+		case "signed":
+			signed = true
+		default:
+			rest = append(rest, w)
+		}
+	}
+	if len(rest) > 1 {
+		filtered := rest[:0]
+		for _, w := range rest {
+			if w != "int" {
+				filtered = append(filtered, w)
+			}
+		}
+		rest = filtered
+	}
+	if len(rest) == 0 {
+		rest = []string{"int"}
+	}
+	name := strings.Join(rest, " ")
+	switch {
+	case unsigned:
+		name = "unsigned " + name
+	case signed && name == "char":
+		name = "signed char"
+	}
+	return name
+}
+
+// structSpec parses the remainder of a struct type after the struct keyword.
+func (p *parser) structSpec() *types.Type {
+	t := &types.Type{Kind: types.Struct}
+	if p.peek().kind == tokenIdent {
+		t.Tag = p.next().text
+	}
+	if !p.accept("{") {
+		if t.Tag == "" {
+			p.fail("expected struct tag or body, found %s", p.describe(p.peek()))
+		}
+		return t
+	}
+	t.Fields = []*types.Field{}
+	for !p.accept("}") {
+		var attrs types.FieldAttrList
+		if p.is("[") {
+			attrs = p.attrs()
+		}
+		base := p.typeSpec()
+		for {
+			name, ft := p.declarator(base, true)
+			t.Fields = append(t.Fields, &types.Field{Name: name, Attrs: attrs, Type: ft})
+			if !p.accept(",") {
+				break
+			}
+		}
+		p.expect(";")
+	}
+	return t
+}
+
+// unionSpec parses the remainder of a union type after the union keyword.
+func (p *parser) unionSpec() *types.Type {
+	t := &types.Type{Kind: types.Union}
+	if p.peek().kind == tokenIdent && !p.is("switch") {
+		t.Tag = p.next().text
+	}
+	if p.accept("switch") {
+		p.expect("(")
+		sw := &types.Field{}
+		sw.Name, sw.Type = p.declarator(p.typeSpec(), true)
+		p.expect(")")
+		t.Switch = sw
+		if p.peek().kind == tokenIdent {
+			t.ArmsName = p.next().text
+		}
+		p.expect("{")
+		t.Arms = p.encapsulatedArms()
+		return t
+	}
+	if !p.accept("{") {
+		if t.Tag == "" {
+			p.fail("expected union tag or body, found %s", p.describe(p.peek()))
+		}
+		return t
+	}
+	t.Arms = []*types.Arm{}
+	for !p.accept("}") {
+		arm := &types.Arm{}
+		var attrs types.FieldAttrList
+		for _, attr := range p.attrs() {
+			switch attr.Type {
+			case "case":
+				arm.Cases = append(arm.Cases, splitList(attr.Value)...)
+			case "default":
+				arm.Default = true
+			default:
+				attrs = append(attrs, attr)
+			}
+		}
+		if len(arm.Cases) == 0 && !arm.Default {
+			p.fail("expected case or default attribute for union arm")
+		}
+		if !p.accept(";") {
+			arm.Field = &types.Field{Attrs: attrs}
+			arm.Field.Name, arm.Field.Type = p.declarator(p.typeSpec(), false)
+			p.expect(";")
+		}
+		t.Arms = append(t.Arms, arm)
+	}
+	return t
+}
+
+// encapsulatedArms parses the arms of an encapsulated union, which are
+// labeled as in a C switch statement.
+func (p *parser) encapsulatedArms() []*types.Arm {
+	arms := []*types.Arm{}
+	for !p.accept("}") {
+		arm := &types.Arm{}
+		for {
+			if p.accept("case") {
+				arm.Cases = append(arm.Cases, p.until(":"))
+			} else if p.accept("default") {
+				arm.Default = true
+			} else {
+				break
+			}
+			p.expect(":")
+		}
+		if len(arm.Cases) == 0 && !arm.Default {
+			p.fail("expected case or default label, found %s", p.describe(p.peek()))
+		}
+		if !p.accept(";") {
+			arm.Field = &types.Field{}
+			if p.is("[") {
+				arm.Field.Attrs = p.attrs()
+			}
+			arm.Field.Name, arm.Field.Type = p.declarator(p.typeSpec(), false)
+			p.expect(";")
+		}
+		arms = append(arms, arm)
+	}
+	return arms
+}
+
+// enumSpec parses the remainder of an enum type after the enum keyword.
+func (p *parser) enumSpec() *types.Type {
+	t := &types.Type{Kind: types.Enum}
+	if p.peek().kind == tokenIdent {
+		t.Tag = p.next().text
+	}
+	if !p.accept("{") {
+		if t.Tag == "" {
+			p.fail("expected enum tag or body, found %s", p.describe(p.peek()))
+		}
+		return t
+	}
+	t.Enumerators = []*types.Enumerator{}
+	for !p.accept("}") {
+		e := &types.Enumerator{Name: p.ident()}
+		if p.accept("=") {
+			e.Value = p.until(",", "}")
+		}
+		t.Enumerators = append(t.Enumerators, e)
+		if !p.accept(",") {
+			p.expect("}")
+			break
+		}
+	}
+	return t
+}
+
+// splitList splits a comma separated list of expressions, ignoring commas
+// that are nested within parentheses.
+func splitList(s string) (list []string) {
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(', '[':
+			depth++
+		case ')', ']':
+			depth--
+		case ',':
+			if depth == 0 {
+				list = append(list, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(list, strings.TrimSpace(s[start:]))
+}
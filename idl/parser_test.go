@@ -0,0 +1,249 @@
+package idl
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gentlemanautomaton/dcerpc/idl/types"
+	"github.com/gentlemanautomaton/dcerpc/uuid"
+)
+
+const testParseIDL = `
+// The file holds declarations outside of the interface.
+import "wtypes.idl", "unknwn.idl";
+#define IGNORED 1
+cpp_quote("#include <windows.h>")
+const unsigned long MAX_NAME = 64;
+typedef unsigned long int DWORD, *PDWORD;
+
+[
+    uuid(12345678-1234-abcd-ef00-0123456789ab),
+    version(2.1),
+    pointer_default(unique)
+]
+interface test
+{
+    import "base.idl";
+    const short LEVEL_NAME = (1 << 2) | 1;
+
+    typedef enum _COLOR { Red, Green = 5, Blue } COLOR;
+
+    typedef struct _NAME {
+        [range(0, MAX_NAME)] DWORD Length;
+        [size_is(Length), string] wchar_t *Buffer;
+        unsigned char Hash[16], Salt[4][2];
+        struct _NAME *Next;
+    } NAME, *PNAME;
+
+    typedef [switch_type(short)] union _INFO {
+        [case(1)] long Long;
+        [case(2, LEVEL_NAME)] [unique] NAME *Name;
+        [default] ;
+    } INFO;
+
+    typedef union switch (unsigned short Kind) Value {
+        case 1:
+        case 2: hyper Big;
+        default: ;
+    } VALUE;
+
+    struct _TAGGED { small A; };
+
+    long Open([in, string] wchar_t *Name, [out] void **Handle);
+    void __stdcall Close(void);
+    [idempotent] DWORD Query(
+        [in] short Level,
+        [in, switch_is(Level)] INFO *Info,
+        [in] DWORD Count,
+        [in, out, size_is(Count)] byte Data[*],
+        [out] pipe char *Stream);
+}
+`
+
+// typeString describes t in a compact notation for comparison.
+func typeString(t *types.Type) string {
+	if t == nil {
+		return "<nil>"
+	}
+	switch t.Kind {
+	case types.Named:
+		return t.Name
+	case types.Pointer:
+		return "*" + typeString(t.Elem)
+	case types.Array:
+		return "[" + t.Size + "]" + typeString(t.Elem)
+	case types.Pipe:
+		return "pipe " + typeString(t.Elem)
+	case types.Struct:
+		var fields []string
+		for _, f := range t.Fields {
+			fields = append(fields, f.Name+" "+typeString(f.Type))
+		}
+		return fmt.Sprintf("struct %s{%s}", t.Tag, strings.Join(fields, "; "))
+	case types.Enum:
+		var values []string
+		for _, e := range t.Enumerators {
+			if e.Value != "" {
+				values = append(values, e.Name+"="+e.Value)
+			} else {
+				values = append(values, e.Name)
+			}
+		}
+		return fmt.Sprintf("enum %s{%s}", t.Tag, strings.Join(values, ", "))
+	case types.Union:
+		var arms []string
+		for _, arm := range t.Arms {
+			label := "default"
+			if !arm.Default {
+				label = strings.Join(arm.Cases, ",")
+			}
+			if arm.Field != nil {
+				label += " " + arm.Field.Name + " " + typeString(arm.Field.Type)
+			}
+			arms = append(arms, label)
+		}
+		sw := ""
+		if t.Switch != nil {
+			sw = fmt.Sprintf("switch(%s %s) %s", typeString(t.Switch.Type), t.Switch.Name, t.ArmsName)
+		}
+		return fmt.Sprintf("union %s%s{%s}", t.Tag, sw, strings.Join(arms, "; "))
+	}
+	return t.Kind.String()
+}
+
+func TestParse(t *testing.T) {
+	f, err := Parse("test.idl", []byte(testParseIDL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Name != "test.idl" || !reflect.DeepEqual(f.Imports, []string{"wtypes.idl", "unknwn.idl"}) {
+		t.Fatalf("file %s imports %v", f.Name, f.Imports)
+	}
+	if len(f.Consts) != 1 || f.Consts[0].Name != "MAX_NAME" || typeString(f.Consts[0].Type) != "unsigned long" || f.Consts[0].Value != "64" {
+		t.Fatalf("file constants are %+v", f.Consts)
+	}
+	if len(f.Typedefs) != 2 || f.Typedefs[0].Name != "DWORD" || typeString(f.Typedefs[0].Type) != "unsigned long" ||
+		f.Typedefs[1].Name != "PDWORD" || typeString(f.Typedefs[1].Type) != "*unsigned long" {
+		t.Fatalf("file typedefs are %+v", f.Typedefs)
+	}
+
+	if len(f.Interfaces) != 1 {
+		t.Fatalf("parsed %d interfaces, want 1", len(f.Interfaces))
+	}
+	iface := f.Interfaces[0]
+	if iface.Name != "test" || iface.UUID != uuid.MustParse("12345678-1234-abcd-ef00-0123456789ab") ||
+		iface.VersionMajor != 2 || iface.VersionMinor != 1 || iface.PointerDefault != "unique" {
+		t.Fatalf("interface %s has uuid %s, version %d.%d and pointer default %q", iface.Name, iface.UUID, iface.VersionMajor, iface.VersionMinor, iface.PointerDefault)
+	}
+	if !reflect.DeepEqual(iface.Imports, []string{"base.idl"}) {
+		t.Fatalf("interface imports %v", iface.Imports)
+	}
+	if len(iface.Consts) != 1 || iface.Consts[0].Value != "(1 << 2) | 1" {
+		t.Fatalf("interface constants are %+v", iface.Consts)
+	}
+
+	typedefs := []struct {
+		name string
+		attr string
+		want string
+	}{
+		{"COLOR", "", "enum _COLOR{Red, Green=5, Blue}"},
+		{"NAME", "", "struct _NAME{Length DWORD; Buffer *wchar_t; Hash [16]unsigned char; Salt [4][2]unsigned char; Next *struct _NAME{}}"},
+		{"PNAME", "", "*struct _NAME{Length DWORD; Buffer *wchar_t; Hash [16]unsigned char; Salt [4][2]unsigned char; Next *struct _NAME{}}"},
+		{"INFO", "switch_type", "union _INFO{1 Long long; 2,LEVEL_NAME Name *NAME; default}"},
+		{"VALUE", "", "union switch(unsigned short Kind) Value{1,2 Big hyper; default}"},
+		{"", "", "struct _TAGGED{A small}"},
+	}
+	if len(iface.Typedefs) != len(typedefs) {
+		t.Fatalf("parsed %d typedefs, want %d", len(iface.Typedefs), len(typedefs))
+	}
+	for i, tt := range typedefs {
+		def := iface.Typedefs[i]
+		if def.Name != tt.name || typeString(def.Type) != tt.want {
+			t.Errorf("typedef %d is %s %s, want %s %s", i, def.Name, typeString(def.Type), tt.name, tt.want)
+		}
+		if tt.attr != "" && !def.Attrs.Contains(tt.attr) {
+			t.Errorf("typedef %s has attributes %v, want %s", def.Name, def.Attrs, tt.attr)
+		}
+	}
+	name := iface.Typedefs[1].Type
+	if v, _ := name.Fields[0].Attrs.Lookup("range"); v != "0, MAX_NAME" {
+		t.Errorf("Length has range %q", v)
+	}
+	if !name.Fields[1].Attrs.Contains("size_is") || !name.Fields[1].Attrs.Contains("string") {
+		t.Errorf("Buffer has attributes %v", name.Fields[1].Attrs)
+	}
+	if arm := iface.Typedefs[3].Type.Arms[1]; !arm.Field.Attrs.Contains("unique") {
+		t.Errorf("union arm has attributes %v", arm.Field.Attrs)
+	}
+
+	operations := []struct {
+		name   string
+		ret    string
+		params []string
+	}{
+		{"Open", "long", []string{"in,string Name *wchar_t", "out Handle **void"}},
+		{"Close", "void", nil},
+		{"Query", "DWORD", []string{
+			"in Level short",
+			"in,switch_is Info *INFO",
+			"in Count DWORD",
+			"in,out,size_is Data []byte",
+			"out Stream *pipe char",
+		}},
+	}
+	if len(iface.Operations) != len(operations) {
+		t.Fatalf("parsed %d operations, want %d", len(iface.Operations), len(operations))
+	}
+	for i, tt := range operations {
+		op := iface.Operations[i]
+		if op.Name != tt.name || op.OpNum != uint16(i) || typeString(op.Return) != tt.ret {
+			t.Errorf("operation %d is %s %s with opnum %d", i, typeString(op.Return), op.Name, op.OpNum)
+			continue
+		}
+		var params []string
+		for _, param := range op.Params {
+			var attrs []string
+			for _, attr := range param.Attrs {
+				attrs = append(attrs, attr.Type)
+			}
+			params = append(params, strings.Join(attrs, ",")+" "+param.Name+" "+typeString(param.Type))
+		}
+		if !reflect.DeepEqual(params, tt.params) {
+			t.Errorf("%s has parameters %q, want %q", op.Name, params, tt.params)
+		}
+	}
+	if query := iface.Operations[2]; !query.Attrs.Contains("idempotent") || !query.Params[3].In() || !query.Params[3].Out() || query.Params[4].In() {
+		t.Errorf("Query has attributes %v", query.Attrs)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	tests := []struct {
+		src  string
+		line int
+	}{
+		{"interface test { void Op(); ", 1},
+		{"[uuid(not-a-uuid)] interface test {}", 1},
+		{"[version(1.x)] interface test {}", 1},
+		{"[uuid(12345678-1234-abcd-ef00-0123456789ab)] typedef long X;", 1},
+		{"interface test {\n  typedef union { long A; } U;\n}", 2},
+		{"interface test {\n  typedef union switch (short k) { long A; } U;\n}", 2},
+		{"interface test {\n\n  void Op(long a long b);\n}", 3},
+		{"typedef struct { long A } S;", 1},
+		{"42;", 1},
+	}
+	for _, tt := range tests {
+		_, err := Parse("bad.idl", []byte(tt.src))
+		e, ok := err.(*Error)
+		if !ok {
+			t.Errorf("%q returned %v, want a syntax error", tt.src, err)
+			continue
+		}
+		if e.Pos.Filename != "bad.idl" || e.Pos.Line != tt.line {
+			t.Errorf("%q returned an error at %s, want line %d", tt.src, e.Pos, tt.line)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package idl
+
+import (
+	"fmt"
+	"strings"
+)
+
+// tokenKind identifies the kind of a lexical token.
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenChar
+	tokenPunct
+)
+
+// token is a lexical token of an IDL file.
+type token struct {
+	kind  tokenKind
+	text  string
+	start int // Offset of the first octet of the token
+	end   int // Offset following the last octet of the token
+	pos   Position
+}
+
+// Position identifies a location within an IDL file.
+type Position struct {
+	Filename string
+	Line     int
+	Column   int
+}
+
+// String returns the position in the form file:line:column.
+func (p Position) String() string {
+	return fmt.Sprintf("%s:%d:%d", p.Filename, p.Line, p.Column)
+}
+
+// Error is a syntax error within an IDL file.
+type Error struct {
+	Pos Position
+	Msg string
+}
+
+// Error returns a description of the error and its position.
+func (e *Error) Error() string {
+	return fmt.Sprintf("idl: %s: %s", e.Pos, e.Msg)
+}
+
+// punctuation lists the operators and delimiters of the language, with the
+// longest first.
+var punctuation = []string{
+	"<<", ">>", "==", "!=", "<=", ">=", "&&", "||", "->",
+	"[", "]", "(", ")", "{", "}", ";", ",", "*", "=", ":", "<", ">",
+	"+", "-", "/", "%", "&", "|", "^", "~", "!", "?", ".",
+}
+
+// scanner splits the source of an IDL file into tokens. Comments and
+// preprocessor directives are skipped.
+type scanner struct {
+	src  string
+	off  int
+	line int
+	col  int
+	name string
+}
+
+func newScanner(filename string, src []byte) *scanner {
+	return &scanner{src: string(src), line: 1, col: 1, name: filename}
+}
+
+func (s *scanner) pos() Position {
+	return Position{Filename: s.name, Line: s.line, Column: s.col}
+}
+
+func (s *scanner) advance(n int) {
+	for i := 0; i < n && s.off < len(s.src); i++ {
+		if s.src[s.off] == '\n' {
+			s.line++
+			s.col = 1
+		} else {
+			s.col++
+		}
+		s.off++
+	}
+}
+
+// skip skips whitespace, comments and preprocessor directives.
+func (s *scanner) skip() error {
+	lineStart := s.col == 1
+	for s.off < len(s.src) {
+		c := s.src[s.off]
+		switch {
+		case c == '\n':
+			lineStart = true
+			s.advance(1)
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v':
+			s.advance(1)
+		case c == '#' && lineStart:
+			// Directives continue onto the next line when the line ends
+			// with a backslash.
+			for s.off < len(s.src) && s.src[s.off] != '\n' {
+				if s.src[s.off] == '\\' && s.off+1 < len(s.src) && s.src[s.off+1] == '\n' {
+					s.advance(1)
+				}
+				s.advance(1)
+			}
+		case strings.HasPrefix(s.src[s.off:], "//"):
+			for s.off < len(s.src) && s.src[s.off] != '\n' {
+				s.advance(1)
+			}
+		case strings.HasPrefix(s.src[s.off:], "/*"):
+			pos := s.pos()
+			end := strings.Index(s.src[s.off+2:], "*/")
+			if end < 0 {
+				return &Error{Pos: pos, Msg: "comment not terminated"}
+			}
+			s.advance(end + 4)
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// next returns the next token.
+func (s *scanner) next() (token, error) {
+	if err := s.skip(); err != nil {
+		return token{}, err
+	}
+	t := token{start: s.off, pos: s.pos()}
+	if s.off >= len(s.src) {
+		t.kind, t.end = tokenEOF, s.off
+		return t, nil
+	}
+
+	c := s.src[s.off]
+	switch {
+	case isIdentStart(c):
+		n := 1
+		for s.off+n < len(s.src) && isIdentPart(s.src[s.off+n]) {
+			n++
+		}
+		t.kind = tokenIdent
+		s.advance(n)
+	case isDigit(c):
+		// Numbers include any suffix, exponent or hexadecimal digits.
+		n := 1
+		for s.off+n < len(s.src) && (isIdentPart(s.src[s.off+n]) || s.src[s.off+n] == '.') {
+			n++
+		}
+		t.kind = tokenNumber
+		s.advance(n)
+	case c == '"' || c == '\'':
+		n := 1
+		for {
+			if s.off+n >= len(s.src) || s.src[s.off+n] == '\n' {
+				return token{}, &Error{Pos: t.pos, Msg: "literal not terminated"}
+			}
+			if s.src[s.off+n] == '\\' {
+				n += 2
+				continue
+			}
+			n++
+			if s.src[s.off+n-1] == c {
+				break
+			}
+		}
+		t.kind = tokenString
+		if c == '\'' {
+			t.kind = tokenChar
+		}
+		s.advance(n)
+	default:
+		for _, p := range punctuation {
+			if strings.HasPrefix(s.src[s.off:], p) {
+				t.kind = tokenPunct
+				s.advance(len(p))
+				break
+			}
+		}
+		if t.kind != tokenPunct {
+			return token{}, &Error{Pos: t.pos, Msg: fmt.Sprintf("unexpected character %q", c)}
+		}
+	}
+	t.end = s.off
+	t.text = s.src[t.start:t.end]
+	return t, nil
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || isDigit(c)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,42 @@
+package types
+
+// ACF represents an application configuration file, which supplies
+// attributes that affect the bindings generated for the interfaces of an IDL
+// file without changing how they are transmitted.
+type ACF struct {
+	Name string
+
+	// Includes lists the header files named by include statements.
+	Includes []string
+
+	Interfaces []*ACFInterface
+}
+
+// ACFInterface configures the interface of the same name.
+type ACFInterface struct {
+	Name       string
+	Attrs      FieldAttrList
+	Typedefs   []*ACFTypedef
+	Operations []*ACFOperation
+}
+
+// ACFTypedef configures the type declared with the same name.
+type ACFTypedef struct {
+	Name  string
+	Attrs FieldAttrList
+}
+
+// ACFOperation configures the operation of the same name.
+type ACFOperation struct {
+	Name   string
+	Attrs  FieldAttrList
+	Params []*ACFParam
+}
+
+// ACFParam configures the parameter of the same name. A parameter that is
+// not declared by the operation in the IDL file adds a status parameter to
+// the operation, which must have the comm_status or fault_status attribute.
+type ACFParam struct {
+	Name  string
+	Attrs FieldAttrList
+}
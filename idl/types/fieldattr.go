@@ -35,6 +35,22 @@ func (list FieldAttrList) Lookup(typ string) (value string, ok bool) {
 	return "", false
 }
 
+// LookupDimensions returns the values of the requested field attribute for
+// each dimension of a multi-dimensional array. The value of the attribute is
+// split at the commas that are not nested within parentheses, so that
+// size_is(MaxLength,20) describes two dimensions. A dimension without a value,
+// such as the first of size_is(,20), is returned as an empty string.
+func (list FieldAttrList) LookupDimensions(typ string) (values []string, ok bool) {
+	value, ok := list.Lookup(typ)
+	if !ok {
+		return nil, false
+	}
+	for _, v := range splitList(value) {
+		values = append(values, strings.TrimSpace(v))
+	}
+	return values, true
+}
+
 // IsConformant returns true if the field attributes indicate a conformant field.
 func (list FieldAttrList) IsConformant() bool {
 	return list.Contains("min_is", "max_is", "size_is")
@@ -52,12 +68,10 @@ type FieldAttr struct {
 }
 
 // ParseFieldAttrList parses the given field attribute list IDL string and
-// returns the parsed data as a FieldAttrList.
+// returns the parsed data as a FieldAttrList. Attributes are separated by
+// commas that are not nested within parentheses.
 func ParseFieldAttrList(attrs string) (output FieldAttrList) {
-	values := strings.Split(attrs, ",")
-	if len(values) == 0 {
-		return
-	}
+	values := splitList(attrs)
 	output = make([]FieldAttr, 0, len(values))
 	for i := 0; i < len(values); i++ {
 		attr, ok := ParseFieldAttr(strings.TrimSpace(values[i]))
@@ -70,17 +84,17 @@ func ParseFieldAttrList(attrs string) (output FieldAttrList) {
 }
 
 // ParseFieldAttr parses the given field attribute IDL string and
-// returns the parsed data as a FieldAttr.
+// returns the parsed data as a FieldAttr. An attribute without a value, such
+// as ignore, consists of its name alone.
 func ParseFieldAttr(attr string) (value FieldAttr, ok bool) {
 	var t, v string
-	switch attr {
-	case "ignore":
-		t = "ignore"
-	default:
+	if strings.IndexByte(attr, '(') < 0 {
+		t = attr
+	} else {
 		t, v = parseParenthetical(attr)
 	}
-	value = FieldAttr{t, v}
-	ok = (t != "")
+	value = FieldAttr{strings.TrimSpace(t), strings.TrimSpace(v)}
+	ok = (value.Type != "")
 	return
 }
 
@@ -100,3 +114,23 @@ func parseParenthetical(p string) (typ, value string) {
 
 	return
 }
+
+// splitList splits s at each comma that is not nested within parentheses or
+// brackets.
+func splitList(s string) (list []string) {
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(', '[':
+			depth++
+		case ')', ']':
+			depth--
+		case ',':
+			if depth == 0 {
+				list = append(list, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(list, s[start:])
+}
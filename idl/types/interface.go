@@ -2,8 +2,87 @@ package types
 
 import "github.com/gentlemanautomaton/dcerpc/uuid"
 
+// File represents a file written in the DCE / RPC interface definition
+// language.
+type File struct {
+	Name string
+
+	// Imports lists the files imported outside of any interface.
+	Imports []string
+
+	// Typedefs and Consts are the declarations made outside of any
+	// interface.
+	Typedefs []*Typedef
+	Consts   []*Const
+
+	Interfaces []*Interface
+}
+
 // Interface represents an Interface as expressed within the DCE / RPC interface
 // definition language.
 type Interface struct {
-	uuid uuid.UUID
+	Name  string
+	Attrs FieldAttrList
+
+	// UUID, VersionMajor, VersionMinor and PointerDefault are taken from the
+	// interface's attributes.
+	UUID           uuid.UUID
+	VersionMajor   uint16
+	VersionMinor   uint16
+	PointerDefault string
+
+	// Base is the name of the interface that an object interface inherits
+	// from, if any.
+	Base string
+
+	Imports    []string
+	Typedefs   []*Typedef
+	Consts     []*Const
+	Operations []*Operation
+}
+
+// Typedef represents a type declaration. Structures, unions and enumerations
+// that are declared with a tag but without a typedef are represented by a
+// Typedef without a name.
+type Typedef struct {
+	Name  string
+	Attrs FieldAttrList
+	Type  *Type
+}
+
+// Const represents a constant declaration.
+type Const struct {
+	Name  string
+	Type  *Type
+	Value string
+}
+
+// Operation represents an operation of an interface.
+type Operation struct {
+	Name  string
+	Attrs FieldAttrList
+
+	// OpNum is the operation number, which is the position of the operation
+	// within its interface.
+	OpNum uint16
+
+	Return *Type
+	Params []*Param
+}
+
+// Param represents a parameter of an operation.
+type Param struct {
+	Name  string
+	Attrs FieldAttrList
+	Type  *Type
+}
+
+// In returns true if the parameter is sent to the server.
+func (p *Param) In() bool {
+	return p.Attrs.Contains("in")
+}
+
+// Out returns true if the parameter is returned to the client.
+func (p *Param) Out() bool {
+	return p.Attrs.Contains("out")
 }
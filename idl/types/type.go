@@ -1 +1,116 @@
 package types
+
+// Kind identifies the kind of an IDL type.
+type Kind int
+
+// IDL type kinds.
+const (
+	// Named is a reference to a base type, such as "unsigned long", or to a
+	// type declared by a typedef.
+	Named Kind = iota
+	// Pointer is a pointer to its element type.
+	Pointer
+	// Array is an array of its element type.
+	Array
+	// Struct is a structure. A struct without fields refers to a struct
+	// declared elsewhere by its tag.
+	Struct
+	// Union is a discriminated union. A union without arms refers to a union
+	// declared elsewhere by its tag.
+	Union
+	// Enum is an enumeration.
+	Enum
+	// Pipe is a pipe of its element type.
+	Pipe
+)
+
+// String returns the name of the kind.
+func (k Kind) String() string {
+	switch k {
+	case Named:
+		return "named"
+	case Pointer:
+		return "pointer"
+	case Array:
+		return "array"
+	case Struct:
+		return "struct"
+	case Union:
+		return "union"
+	case Enum:
+		return "enum"
+	case Pipe:
+		return "pipe"
+	}
+	return "invalid"
+}
+
+// Type represents a type expressed within the DCE / RPC interface definition
+// language.
+type Type struct {
+	Kind Kind
+
+	// Name is the name of a Named type. Base types are named by their
+	// keywords separated by single spaces, such as "unsigned long" or
+	// "wchar_t".
+	Name string
+
+	// Tag is the optional tag of a Struct, Union or Enum.
+	Tag string
+
+	// Elem is the element type of a Pointer, Array or Pipe.
+	Elem *Type
+
+	// Size is the expression that gives the number of elements in a fixed
+	// Array. It is empty for a conformant array, which is declared with []
+	// or [*].
+	Size string
+
+	// Fields are the members of a Struct.
+	Fields []*Field
+
+	// Switch is the discriminant of an encapsulated Union, which is
+	// declared with union switch (type name). It is nil for a
+	// non-encapsulated union, which is discriminated by the switch_is
+	// attribute of the field or parameter that holds it.
+	Switch *Field
+
+	// ArmsName is the name of the member that holds the arms of an
+	// encapsulated Union.
+	ArmsName string
+
+	// Arms are the arms of a Union.
+	Arms []*Arm
+
+	// Enumerators are the values of an Enum.
+	Enumerators []*Enumerator
+}
+
+// Field represents a member of a structure or union arm.
+type Field struct {
+	Name  string
+	Attrs FieldAttrList
+	Type  *Type
+}
+
+// Arm represents an arm of a discriminated union.
+type Arm struct {
+	// Cases are the expressions of the discriminant values that select the
+	// arm.
+	Cases []string
+
+	// Default is true if the arm is selected by values without a case.
+	Default bool
+
+	// Field is the member of the arm. It is nil for an empty arm.
+	Field *Field
+}
+
+// Enumerator represents a value of an enumeration.
+type Enumerator struct {
+	Name string
+
+	// Value is the expression given for the enumerator, if any. Enumerators
+	// without a value follow the previous enumerator.
+	Value string
+}
@@ -0,0 +1,105 @@
+package namedpipe
+
+import (
+	"sync"
+
+	"github.com/gentlemanautomaton/dcerpc/pdu"
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu"
+)
+
+// maxMessageSize is the size of the buffer that messages are read into. It
+// is large enough to hold any PDU fragment.
+const maxMessageSize = 1<<16 - 1
+
+// Conn is a connection to a named pipe, which carries the PDUs of a single
+// association.
+//
+// PDUs that the server replies to, such as the last fragment of a request,
+// are written with the FSCTL_PIPE_TRANSCEIVE ioctl. The reply is buffered and
+// returned by subsequent calls to Read.
+type Conn struct {
+	session Session
+	tree    Tree
+	file    File
+
+	buf    []byte
+	unread []byte
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// NewConn returns a connection that carries PDUs over the named pipe file.
+// The file, tree and session are closed when the connection is closed;
+// either of tree and session may be nil.
+func NewConn(session Session, tree Tree, file File) *Conn {
+	return &Conn{
+		session: session,
+		tree:    tree,
+		file:    file,
+		buf:     make([]byte, maxMessageSize),
+	}
+}
+
+// Read reads data from the messages written to the pipe by the server.
+func (c *Conn) Read(p []byte) (int, error) {
+	if len(c.unread) == 0 {
+		n, err := c.file.Read(c.buf)
+		if n == 0 {
+			return 0, err
+		}
+		c.unread = c.buf[:n]
+	}
+	n := copy(p, c.unread)
+	c.unread = c.unread[n:]
+	return n, nil
+}
+
+// Write writes p to the pipe as a single message. The connection expects p
+// to hold a single PDU fragment, as written by the coproto package.
+func (c *Conn) Write(p []byte) (int, error) {
+	if len(c.unread) > 0 || !expectsReply(p) {
+		return c.file.Write(p)
+	}
+	n, err := c.file.Transceive(p, c.buf)
+	if err != nil {
+		return 0, err
+	}
+	c.unread = c.buf[:n]
+	return len(p), nil
+}
+
+// Close closes the pipe, disconnects the tree and logs off the session.
+func (c *Conn) Close() error {
+	c.closeOnce.Do(func() {
+		c.closeErr = c.file.Close()
+		if c.tree != nil {
+			if err := c.tree.Close(); c.closeErr == nil {
+				c.closeErr = err
+			}
+		}
+		if c.session != nil {
+			if err := c.session.Close(); c.closeErr == nil {
+				c.closeErr = err
+			}
+		}
+	})
+	return c.closeErr
+}
+
+// expectsReply reports whether the PDU fragment b is one that the server
+// replies to, which is true of bind and alter_context PDUs and of the last
+// fragment of a request that does not have maybe semantics.
+func expectsReply(b []byte) bool {
+	var h copdu.Header
+	if h.Unmarshal(b) != nil {
+		return false
+	}
+	switch h.PacketType {
+	case pdu.TypeBind, pdu.TypeAlterContext:
+		return true
+	case pdu.TypeRequest:
+		return h.Flags&copdu.LastFrag != 0 && h.Flags&copdu.Maybe == 0
+	}
+	return false
+}
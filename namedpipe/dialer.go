@@ -0,0 +1,81 @@
+package namedpipe
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/gentlemanautomaton/dcerpc"
+)
+
+// ErrNoClient is returned when a dialer has no SMB2 client.
+var ErrNoClient = errors.New("namedpipe: no SMB2 client")
+
+// Dialer opens named pipes for ncacn_np bindings. It implements the
+// dcerpc.Dialer interface:
+//
+//	client := dcerpc.Client{
+//		Dialers: map[string]dcerpc.Dialer{
+//			dcerpc.ProtSeqNamedPipe: &namedpipe.Dialer{Client: smb},
+//		},
+//	}
+type Dialer struct {
+	// Client establishes the SMB2 sessions that named pipes are opened
+	// with.
+	Client Client
+}
+
+// Dial opens the named pipe identified by the endpoint of b on the server
+// identified by its network address. The endpoint is a pipe name such as
+// \pipe\lsarpc.
+func (d *Dialer) Dial(ctx context.Context, b dcerpc.Binding) (io.ReadWriteCloser, error) {
+	if b.Endpoint == "" {
+		return nil, dcerpc.ErrNoEndpoint
+	}
+	return d.DialPipe(ctx, serverName(b.NetworkAddr), PipeName(b.Endpoint))
+}
+
+// DialPipe opens the named pipe with the given name on the server. The
+// name must not include the \pipe\ prefix of an endpoint.
+func (d *Dialer) DialPipe(ctx context.Context, server, name string) (*Conn, error) {
+	if d.Client == nil {
+		return nil, ErrNoClient
+	}
+	session, err := d.Client.Session(ctx, server)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := session.TreeConnect(ctx, IPC)
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	file, err := tree.Create(ctx, name)
+	if err != nil {
+		tree.Close()
+		session.Close()
+		return nil, err
+	}
+	return NewConn(session, tree, file), nil
+}
+
+// PipeName returns the name of the pipe identified by an ncacn_np endpoint,
+// which is the endpoint without its \pipe\ prefix.
+func PipeName(endpoint string) string {
+	const prefix = `\pipe\`
+	if len(endpoint) >= len(prefix) && strings.EqualFold(endpoint[:len(prefix)], prefix) {
+		return endpoint[len(prefix):]
+	}
+	return strings.TrimPrefix(endpoint, `\`)
+}
+
+// serverName returns the name of the server identified by the network
+// address of an ncacn_np binding, which may be a UNC server name.
+func serverName(addr string) string {
+	addr = strings.TrimPrefix(addr, `\\`)
+	if addr == "" {
+		return "localhost"
+	}
+	return addr
+}
@@ -0,0 +1,14 @@
+// Package namedpipe implements the ncacn_np protocol sequence, which carries
+// connection-oriented RPC associations over SMB2 named pipes.
+//
+// Named pipes are opened through an SMB2 client supplied by the caller, which
+// is described by the Client, Session, Tree and File interfaces. The
+// interfaces mirror the SMB2 operations used by the transport: a tree connect
+// to the IPC$ share, a create of the pipe, reads and writes of pipe messages
+// and the FSCTL_PIPE_TRANSCEIVE ioctl, which writes a request and reads its
+// reply in a single round trip.
+//
+// The transport is described in "[MS-RPCE] Remote Procedure Call Protocol
+// Extensions", section 2.1.1.2, and the SMB2 operations in "[MS-SMB2] Server
+// Message Block (SMB) Protocol Versions 2 and 3".
+package namedpipe
@@ -0,0 +1,206 @@
+package namedpipe_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gentlemanautomaton/dcerpc"
+	"github.com/gentlemanautomaton/dcerpc/namedpipe"
+	"github.com/gentlemanautomaton/dcerpc/security"
+	"github.com/gentlemanautomaton/dcerpc/security/ntlm"
+	"github.com/gentlemanautomaton/dcerpc/uuid"
+)
+
+var errNotFound = errors.New("STATUS_OBJECT_NAME_NOT_FOUND")
+
+// testServer is a stand-in SMB2 server that serves named pipes in process.
+type testServer struct {
+	pipes map[string]func(io.ReadWriteCloser)
+
+	sessions     int32
+	openSessions int32
+	transceives  int32
+}
+
+func (s *testServer) Session(ctx context.Context, server string) (namedpipe.Session, error) {
+	if server != "server" {
+		return nil, errors.New("STATUS_BAD_NETWORK_NAME")
+	}
+	atomic.AddInt32(&s.sessions, 1)
+	atomic.AddInt32(&s.openSessions, 1)
+	return testSession{s}, nil
+}
+
+type testSession struct{ s *testServer }
+
+func (ts testSession) TreeConnect(ctx context.Context, share string) (namedpipe.Tree, error) {
+	if share != namedpipe.IPC {
+		return nil, errNotFound
+	}
+	return testTree(ts), nil
+}
+
+func (ts testSession) Close() error {
+	atomic.AddInt32(&ts.s.openSessions, -1)
+	return nil
+}
+
+type testTree struct{ s *testServer }
+
+func (t testTree) Create(ctx context.Context, name string) (namedpipe.File, error) {
+	serve, ok := t.s.pipes[name]
+	if !ok {
+		return nil, errNotFound
+	}
+	client, server := newMessagePipe()
+	go serve(server)
+	return &testFile{messageEnd: client, s: t.s}, nil
+}
+
+func (t testTree) Close() error { return nil }
+
+// testFile is the client end of a named pipe.
+type testFile struct {
+	*messageEnd
+	s *testServer
+}
+
+func (f *testFile) Transceive(in, out []byte) (int, error) {
+	atomic.AddInt32(&f.s.transceives, 1)
+	if _, err := f.messageEnd.Write(in); err != nil {
+		return 0, err
+	}
+	return f.Read(out)
+}
+
+// messageEnd is one end of a message mode pipe. A message that is longer
+// than the buffer passed to Read is returned by several reads.
+type messageEnd struct {
+	in, out   chan []byte
+	closed    chan struct{}
+	closeOnce *sync.Once
+	pending   []byte
+}
+
+func newMessagePipe() (*messageEnd, *messageEnd) {
+	a, b := make(chan []byte, 16), make(chan []byte, 16)
+	closed, once := make(chan struct{}), new(sync.Once)
+	return &messageEnd{in: a, out: b, closed: closed, closeOnce: once},
+		&messageEnd{in: b, out: a, closed: closed, closeOnce: once}
+}
+
+func (m *messageEnd) Read(p []byte) (int, error) {
+	if len(m.pending) == 0 {
+		select {
+		case m.pending = <-m.in:
+		case <-m.closed:
+			return 0, io.EOF
+		}
+	}
+	n := copy(p, m.pending)
+	m.pending = m.pending[n:]
+	return n, nil
+}
+
+func (m *messageEnd) Write(p []byte) (int, error) {
+	select {
+	case m.out <- append([]byte(nil), p...):
+		return len(p), nil
+	case <-m.closed:
+		return 0, io.ErrClosedPipe
+	}
+}
+
+func (m *messageEnd) Close() error {
+	m.closeOnce.Do(func() { close(m.closed) })
+	return nil
+}
+
+type echo struct {
+	N    uint32
+	Data []uint16 `idl:"size_is(N)"`
+}
+
+func TestNamedPipe(t *testing.T) {
+	iface := dcerpc.Interface{UUID: uuid.MustParse("2f5f6520-ca46-1067-b319-00dd010662da"), VersionMajor: 1}
+	for _, level := range []security.Level{security.LevelNone, security.LevelPrivacy} {
+		srv := dcerpc.Server{MinAuthLevel: level}
+		if level != security.LevelNone {
+			srv.SecurityProviders = []security.Provider{&ntlm.Provider{Accounts: ntlm.AccountList{{User: "alice", Password: "wonderland"}}}}
+		}
+		srv.Register(iface, dcerpc.OperationTable{
+			func(ctx context.Context, call *dcerpc.Call) error {
+				var in echo
+				if err := call.DecodeRequest(&in); err != nil {
+					return err
+				}
+				in.Data = append(in.Data, in.Data...)
+				in.N = uint32(len(in.Data))
+				return call.EncodeResponse(in)
+			},
+		})
+		smb := &testServer{pipes: map[string]func(io.ReadWriteCloser){
+			"echo": func(conn io.ReadWriteCloser) { srv.ServeConn(context.Background(), conn) },
+		}}
+
+		client := dcerpc.Client{Dialers: map[string]dcerpc.Dialer{
+			dcerpc.ProtSeqNamedPipe: &namedpipe.Dialer{Client: smb},
+		}}
+		if level != security.LevelNone {
+			client.SecurityProvider = &ntlm.Provider{Credentials: ntlm.Credentials{User: "alice", Password: "wonderland"}}
+			client.AuthLevel = level
+		}
+		b, err := dcerpc.ParseBinding(`ncacn_np:\\server[\PIPE\echo]`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := client.Handle(b, iface)
+		for _, n := range []int{1, 3000, 20000} {
+			in := echo{N: uint32(n), Data: make([]uint16, n)}
+			for i := range in.Data {
+				in.Data[i] = uint16(i)
+			}
+			var out echo
+			if err := h.Invoke(context.Background(), 0, in, &out); err != nil {
+				t.Fatalf("level %d, %d elements: %v", level, n, err)
+			}
+			if len(out.Data) != 2*n || out.Data[n+n/2] != uint16(n/2) {
+				t.Fatalf("level %d: echoed %d elements", level, len(out.Data))
+			}
+		}
+		if smb.sessions != 1 {
+			t.Errorf("level %d: %d sessions were established", level, smb.sessions)
+		}
+		if smb.transceives == 0 {
+			t.Errorf("level %d: no transceive ioctls were issued", level)
+		}
+
+		// Pipes that are not served by the server cannot be opened.
+		b.Endpoint = `\pipe\missing`
+		if err := client.Handle(b, iface).Invoke(context.Background(), 0, echo{}, new(echo)); err != errNotFound {
+			t.Errorf("level %d: invoke on missing pipe returned %v", level, err)
+		}
+
+		client.Close()
+		if smb.openSessions != 0 {
+			t.Errorf("level %d: %d sessions were not closed", level, smb.openSessions)
+		}
+	}
+}
+
+func TestPipeName(t *testing.T) {
+	for endpoint, want := range map[string]string{
+		`\pipe\lsarpc`: "lsarpc",
+		`\PIPE\samr`:   "samr",
+		`\srvsvc`:      "srvsvc",
+		`wkssvc`:       "wkssvc",
+	} {
+		if got := namedpipe.PipeName(endpoint); got != want {
+			t.Errorf("PipeName(%q) = %q, want %q", endpoint, got, want)
+		}
+	}
+}
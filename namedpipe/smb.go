@@ -0,0 +1,63 @@
+package namedpipe
+
+import (
+	"context"
+	"io"
+)
+
+// IPC is the name of the share that provides access to named pipes.
+const IPC = "IPC$"
+
+// Client is an SMB2 client, which establishes authenticated sessions with
+// servers.
+type Client interface {
+	// Session returns an authenticated session with the given server.
+	Session(ctx context.Context, server string) (Session, error)
+}
+
+// ClientFunc is a function that implements the Client interface.
+type ClientFunc func(ctx context.Context, server string) (Session, error)
+
+// Session calls f(ctx, server).
+func (f ClientFunc) Session(ctx context.Context, server string) (Session, error) {
+	return f(ctx, server)
+}
+
+// Session is an authenticated SMB2 session.
+//
+// A named pipe connection closes its session when it is closed. Clients that
+// share a session between connections should return a Session whose Close
+// method does not log off until the last connection has been closed.
+type Session interface {
+	// TreeConnect connects to the named share of the server.
+	TreeConnect(ctx context.Context, share string) (Tree, error)
+
+	// Close logs off the session.
+	Close() error
+}
+
+// Tree is a tree connect, which provides access to a share.
+type Tree interface {
+	// Create opens the named pipe with the given name, such as "lsarpc",
+	// for reading and writing in message mode.
+	Create(ctx context.Context, name string) (File, error)
+
+	// Close disconnects from the share.
+	Close() error
+}
+
+// File is an open named pipe.
+//
+// Read reads the next message written to the pipe by the server. If the
+// message is longer than the buffer the remainder is returned by subsequent
+// calls to Read, as an SMB2 server does when it completes a read with
+// STATUS_BUFFER_OVERFLOW. Each call to Write writes a single message.
+type File interface {
+	io.ReadWriteCloser
+
+	// Transceive issues an FSCTL_PIPE_TRANSCEIVE ioctl, which writes in as
+	// a single message and reads the reply into out. It returns the number
+	// of octets read. If the reply is longer than out the remainder is
+	// returned by subsequent calls to Read.
+	Transceive(in, out []byte) (int, error)
+}
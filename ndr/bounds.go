@@ -0,0 +1,338 @@
+package ndr
+
+import (
+	"math"
+	"reflect"
+
+	"github.com/gentlemanautomaton/dcerpc/idl/expr"
+	"github.com/gentlemanautomaton/dcerpc/idl/types"
+)
+
+// boundsAttrs are the attributes that describe the bounds of conformant and
+// varying arrays.
+var boundsAttrs = []string{"min_is", "max_is", "size_is", "first_is", "last_is", "length_is"}
+
+// ArrayBounds holds the compiled expressions that describe the bounds of one
+// dimension of a conformant or varying array. Each expression is nil if the
+// array does not have the corresponding attribute.
+//
+// The expressions are evaluated against the struct that contains the array.
+type ArrayBounds struct {
+	Min, Max, Size        *expr.Func // Conformance
+	First, Last, Length   *expr.Func // Variance
+	Conformant, Varying   bool       // The dimension has conformance or variance attributes
+	conformance, variance []int      // Fields referenced by the expressions
+	typeName, fieldName   string
+}
+
+// FieldBounds holds the compiled bounds of each dimension of an array field
+// of a struct. The field is a slice, which is transmitted as a conformant,
+// varying or conformant varying array, or a fixed array with variance
+// attributes, which is transmitted as a varying array.
+//
+// Nested slices are the dimensions of a slice field, and nested arrays are the
+// dimensions of an array field. An array nested within a slice is an element
+// of the slice.
+type FieldBounds struct {
+	Dimensions []ArrayBounds // Bounds of each dimension, outermost first
+	Elem       reflect.Type  // Type of the array's elements
+	Conformant bool          // Any dimension has conformance attributes
+	Varying    bool          // Any dimension has variance attributes
+	Fixed      []int         // Length of each dimension of a fixed array
+	index      []int         // Index of the field within the struct
+}
+
+// ArrayDimensions returns the number of dimensions of rt, which must be a
+// slice or an array, and the type of its elements.
+func ArrayDimensions(rt reflect.Type) (dimensions int, elem reflect.Type) {
+	kind := rt.Kind()
+	for elem = rt; elem.Kind() == kind; elem = elem.Elem() {
+		dimensions++
+	}
+	return
+}
+
+// IsBoundedField returns true if the given field is a slice with conformance
+// or variance attributes, or an array with variance attributes.
+func IsBoundedField(rf reflect.StructField, attrs types.FieldAttrList) bool {
+	switch rf.Type.Kind() {
+	case reflect.Slice:
+		return HasBounds(attrs)
+	case reflect.Array:
+		return attrs.IsVarying()
+	}
+	return false
+}
+
+// CompileFieldBounds compiles the bounds attributes of the array field of
+// base, which are given by attrs, for each dimension of the array. Attributes
+// that list values for several dimensions, such as size_is(MaxLength,20),
+// apply their values to the dimensions in order. The conformance attributes
+// of fixed arrays are ignored.
+//
+// An error is returned if an expression cannot be compiled, including when
+// it refers to a field that base does not have, which is reported as an
+// *expr.FieldError.
+func CompileFieldBounds(base reflect.Type, field reflect.StructField, attrs types.FieldAttrList) (*FieldBounds, error) {
+	dimensions, elem := ArrayDimensions(field.Type)
+	fb := &FieldBounds{
+		Dimensions: make([]ArrayBounds, dimensions),
+		Elem:       elem,
+		index:      field.Index,
+	}
+	for d := range fb.Dimensions {
+		fb.Dimensions[d].typeName, fb.Dimensions[d].fieldName = base.Name(), field.Name
+	}
+	fixed := field.Type.Kind() == reflect.Array
+	if fixed {
+		fb.Fixed = make([]int, dimensions)
+		for d, t := 0, field.Type; d < dimensions; d, t = d+1, t.Elem() {
+			fb.Fixed[d] = t.Len()
+		}
+	}
+	for _, name := range boundsAttrs {
+		conformance := name == "min_is" || name == "max_is" || name == "size_is"
+		if conformance && fixed {
+			continue
+		}
+		values, ok := attrs.LookupDimensions(name)
+		if !ok {
+			continue
+		}
+		if len(values) > dimensions {
+			return nil, NewEncodingError(TooManyDimensions, base.Name(), field.Name, name, len(values), dimensions)
+		}
+		for d, value := range values {
+			if value == "" {
+				continue
+			}
+			b := &fb.Dimensions[d]
+			if conformance {
+				b.Conformant, fb.Conformant = true, true
+			} else {
+				b.Varying, fb.Varying = true, true
+			}
+			f, err := expr.CompileString(value, base)
+			if err != nil {
+				return nil, err
+			}
+			switch name {
+			case "min_is":
+				b.Min = f
+			case "max_is":
+				b.Max = f
+			case "size_is":
+				b.Size = f
+			case "first_is":
+				b.First = f
+			case "last_is":
+				b.Last = f
+			case "length_is":
+				b.Length = f
+			}
+			if conformance {
+				b.conformance = append(b.conformance, f.Fields()...)
+			} else {
+				b.variance = append(b.variance, f.Fields()...)
+			}
+		}
+	}
+	for d := range fb.Dimensions {
+		if fb.Dimensions[d].Last != nil && fb.Dimensions[d].Length != nil {
+			return nil, NewEncodingError(LastAndLength, base.Name(), field.Name, "", d, 0)
+		}
+	}
+	return fb, nil
+}
+
+// MaxCounts returns the maximum count of each dimension of the array for the
+// struct v that contains it. Dimensions without conformance expressions take
+// their counts from the array itself: the length of a fixed array, or the
+// greatest length of the slices of each dimension of a slice.
+func (fb *FieldBounds) MaxCounts(v reflect.Value) ([]int, error) {
+	lengths := SliceSubsets(len(fb.Dimensions), v.FieldByIndex(fb.index))
+	max := make([]int, len(fb.Dimensions))
+	for d := range fb.Dimensions {
+		var err error
+		if max[d], err = fb.Dimensions[d].MaxCount(v, lengths[d].Count); err != nil {
+			return nil, err
+		}
+	}
+	return max, nil
+}
+
+// Subsets returns the offset and count of the elements that are transmitted
+// for each dimension of the array, for the struct v that contains it. The
+// maximum counts of the dimensions are given by max. Each subset must lie
+// within its dimension, and the counts must fit in 32 bits.
+func (fb *FieldBounds) Subsets(v reflect.Value, max []int) ([]SliceSubset, error) {
+	subsets := make([]SliceSubset, len(fb.Dimensions))
+	for d := range fb.Dimensions {
+		b := &fb.Dimensions[d]
+		offset, count, err := b.Variance(v, max[d])
+		if err != nil {
+			return nil, err
+		}
+		end := int64(offset) + int64(count)
+		switch {
+		case int64(max[d]) > math.MaxUint32:
+			return nil, NewEncodingError(CountTooLarge, b.typeName, b.fieldName, "", max[d], 0)
+		case end > int64(max[d]):
+			return nil, NewEncodingError(VarianceOutOfRange, b.typeName, b.fieldName, "", int(end), max[d])
+		}
+		subsets[d] = SliceSubset{Offset: offset, Count: count}
+	}
+	return subsets, nil
+}
+
+// Check verifies the maximum counts and subsets that were received for the
+// array, for the struct v that contains it. Each subset must lie within its
+// dimension, and the values must agree with the expressions whose fields
+// precede the array in v.
+//
+// A maximum count that is not known, because the array is a varying slice,
+// is negative. It is replaced by the end of the subset.
+func (fb *FieldBounds) Check(v reflect.Value, max []int, subsets []SliceSubset) error {
+	position := fb.index[0]
+	for d := range fb.Dimensions {
+		b, end := &fb.Dimensions[d], subsets[d].Offset+subsets[d].Count
+		switch {
+		case max[d] < 0:
+			max[d] = end
+		case end > max[d]:
+			return NewDecodingError(VarianceOutOfBounds, b.typeName, b.fieldName, end, max[d])
+		}
+		if err := b.CheckMaxCount(v, position, max[d]); err != nil {
+			return err
+		}
+		if err := b.CheckVariance(v, position, max[d], subsets[d].Offset, subsets[d].Count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MaxCount returns the number of elements of the array, which is transmitted
+// as its conformance, for the struct v that contains it. If the bounds have
+// no conformance expression then n, the length of the slice, is returned.
+func (b *ArrayBounds) MaxCount(v reflect.Value, n int) (int, error) {
+	switch {
+	case b.Size != nil:
+		return b.eval(b.Size, v, NegativeSize)
+	case b.Max != nil:
+		max, err := b.eval(b.Max, v, NegativeSize)
+		if err != nil {
+			return 0, err
+		}
+		min := 0
+		if b.Min != nil {
+			if min, err = b.eval(b.Min, v, NegativeSize); err != nil {
+				return 0, err
+			}
+		}
+		if max+1 < min {
+			return 0, NewEncodingError(NegativeSize, b.typeName, b.fieldName, b.Max.String(), max+1-min, 0)
+		}
+		return max + 1 - min, nil
+	}
+	return n, nil
+}
+
+// Variance returns the offset and number of the elements of the array that
+// are transmitted, for the struct v that contains it. The maximum count of the
+// array is given by max. If the bounds have no variance expressions then
+// all max elements are transmitted.
+func (b *ArrayBounds) Variance(v reflect.Value, max int) (offset, count int, err error) {
+	if b.First != nil {
+		if offset, err = b.eval(b.First, v, NegativeLength); err != nil {
+			return 0, 0, err
+		}
+	}
+	switch {
+	case b.Length != nil:
+		count, err = b.eval(b.Length, v, NegativeLength)
+	case b.Last != nil:
+		var last int
+		if last, err = b.eval(b.Last, v, NegativeLength); err != nil {
+			return 0, 0, err
+		}
+		if last+1 < offset {
+			return 0, 0, NewEncodingError(FirstGreaterThanLast, b.typeName, b.fieldName, b.Last.String(), offset, last)
+		}
+		count = last + 1 - offset
+	default:
+		count = max - offset
+	}
+	if err == nil && count < 0 {
+		err = NewEncodingError(NegativeLength, b.typeName, b.fieldName, "", count, 0)
+	}
+	return
+}
+
+// CheckMaxCount verifies that the maximum count received for the array
+// agrees with its conformance expression, if all of the fields that the
+// expression refers to precede the array in the struct v. The array is
+// the field with the given index.
+func (b *ArrayBounds) CheckMaxCount(v reflect.Value, index int, max int) error {
+	if !b.precedes(b.conformance, index) || b.Size == nil && b.Max == nil {
+		return nil
+	}
+	want, err := b.MaxCount(v, max)
+	if err != nil {
+		return err
+	}
+	if want != max {
+		return NewDecodingError(ConformanceMismatch, b.typeName, b.fieldName, max, want)
+	}
+	return nil
+}
+
+// CheckVariance verifies that the offset and count received for the array
+// agree with its variance expressions, as CheckMaxCount does for its
+// conformance.
+func (b *ArrayBounds) CheckVariance(v reflect.Value, index int, max, offset, count int) error {
+	if !b.precedes(b.variance, index) || b.First == nil && b.Last == nil && b.Length == nil {
+		return nil
+	}
+	wantOffset, wantCount, err := b.Variance(v, max)
+	if err != nil {
+		return err
+	}
+	if b.First != nil && wantOffset != offset {
+		return NewDecodingError(OffsetMismatch, b.typeName, b.fieldName, offset, wantOffset)
+	}
+	if (b.Last != nil || b.Length != nil) && wantCount != count {
+		return NewDecodingError(LengthMismatch, b.typeName, b.fieldName, count, wantCount)
+	}
+	return nil
+}
+
+// precedes returns true if each of the given fields precedes the field with
+// the given index.
+func (b *ArrayBounds) precedes(fields []int, index int) bool {
+	for _, f := range fields {
+		if f >= index {
+			return false
+		}
+	}
+	return true
+}
+
+// eval evaluates f for v and reports a negative value with the given error
+// code.
+func (b *ArrayBounds) eval(f *expr.Func, v reflect.Value, code int) (int, error) {
+	x, err := f.Eval(v)
+	if err != nil {
+		return 0, err
+	}
+	if x < 0 {
+		return 0, NewEncodingError(code, b.typeName, b.fieldName, f.String(), int(x), 0)
+	}
+	return int(x), nil
+}
+
+// HasBounds returns true if the attributes include conformance or variance
+// attributes.
+func HasBounds(attrs types.FieldAttrList) bool {
+	return attrs.Contains(boundsAttrs...)
+}
@@ -0,0 +1,305 @@
+package ndr
+
+import (
+	"reflect"
+	"unicode/utf16"
+
+	"github.com/gentlemanautomaton/dcerpc/idl/types"
+)
+
+// IsCharField returns true if the given attributes mark a field that holds
+// characters. Go has no type that corresponds to the IDL char type, so the
+// char attribute distinguishes characters, which are translated to the
+// character representation of the format label, from octets.
+func IsCharField(attrs types.FieldAttrList) bool {
+	return attrs.Contains("char")
+}
+
+// EncChar is an NDR encoding function for a char, which is held in a uint8.
+func EncChar(w Writer, s *State, v reflect.Value) {
+	w.WriteChar(uint8(v.Uint()))
+}
+
+// DecChar is an NDR decoding function for a char, which is held in a uint8.
+func DecChar(r Reader, s *State, v reflect.Value) error {
+	x, err := r.ReadChar()
+	v.SetUint(uint64(x))
+	return err
+}
+
+// EncConformantVaryingString is an NDR encoding function for a string of
+// characters, which is encoded as a conformant and varying string. The
+// terminating null character is included in its counts. The conformance is
+// encoded in place, as it is for strings referred to by top-level pointers.
+func EncConformantVaryingString(w Writer, s *State, v reflect.Value) {
+	count := uint32(v.Len() + 1)
+	w.WriteUint32(count) // Maximum count
+	w.WriteUint32(0)     // Offset
+	w.WriteUint32(count) // Actual count
+	w.WriteString(v.String())
+	w.WriteChar(0)
+}
+
+// EncConformantVaryingWideString is an NDR encoding function for a string of
+// wide characters, which is encoded as a conformant and varying string of
+// UTF-16 code units. The terminating null character is included in its
+// counts.
+func EncConformantVaryingWideString(w Writer, s *State, v reflect.Value) {
+	units := utf16.Encode([]rune(v.String()))
+	count := uint32(len(units) + 1)
+	w.WriteUint32(count) // Maximum count
+	w.WriteUint32(0)     // Offset
+	w.WriteUint32(count) // Actual count
+	for _, u := range units {
+		w.WriteUint16(u)
+	}
+	w.WriteUint16(0)
+}
+
+// EncOpForChars returns an NDR encoding function for the given type, which
+// holds characters. The type must be a uint8, a string, or an array or slice
+// of uint8, otherwise EncOpForChars returns nil. Nested arrays and slices are
+// encoded as they are by EncOpForArray and EncOpForSlice.
+func EncOpForChars(rt reflect.Type) EncOp {
+	switch rt.Kind() {
+	case reflect.Uint8:
+		return EncChar
+	case reflect.String:
+		return EncConformantVaryingString
+	case reflect.Array:
+		length, elemOp := rt.Len(), EncOpForChars(rt.Elem())
+		if elemOp == nil {
+			return nil
+		}
+		return func(w Writer, s *State, v reflect.Value) {
+			for i := 0; i < length; i++ {
+				elemOp(w, s, v.Index(i))
+			}
+		}
+	case reflect.Slice:
+		dimensions, elem := ArrayDimensions(rt)
+		if elem.Kind() != reflect.Uint8 {
+			return nil
+		}
+		return func(w Writer, s *State, v reflect.Value) {
+			subsets := SliceSubsets(dimensions, v)
+			EncSliceHeader(w, s, v, subsets)
+			EncSliceElements(w, s, v, subsets, EncChar)
+		}
+	}
+	return nil
+}
+
+// DecOpForConformantVaryingString returns an NDR decoding function for the
+// given field, which holds a string that is encoded as a conformant and
+// varying string. The received string must be terminated by a null
+// character, which is removed.
+func DecOpForConformantVaryingString(rf reflect.StructField) DecOp {
+	return func(r Reader, s *State, v reflect.Value) error {
+		max, err := r.ReadUint32()
+		if err != nil {
+			return err
+		}
+		offset, err := r.ReadUint32()
+		if err != nil {
+			return err
+		}
+		if offset != 0 {
+			return NewDecodingError(OffsetMismatch, "", rf.Name, int(offset), 0)
+		}
+		count, err := r.ReadUint32()
+		if err != nil {
+			return err
+		}
+		if count > max {
+			return NewDecodingError(VarianceOutOfBounds, "", rf.Name, int(count), int(max))
+		}
+		if remaining, ok := r.Remaining(); ok && int64(count) > int64(remaining) {
+			return NewDecodingError(InsufficientData, "", rf.Name, int(count), remaining)
+		}
+		x, err := r.ReadString(int(count))
+		if err != nil {
+			return err
+		}
+		if count == 0 || x[count-1] != 0 {
+			return NewDecodingError(UnterminatedString, "", rf.Name, int(count), 0)
+		}
+		v.SetString(x[:count-1])
+		return nil
+	}
+}
+
+// DecOpForConformantVaryingWideString returns an NDR decoding function for the
+// given field, which holds a string of wide characters that is encoded as a
+// conformant and varying string. The received string must be terminated by a
+// null character, which is removed. Invalid UTF-16 is replaced by the Unicode
+// replacement character.
+func DecOpForConformantVaryingWideString(rf reflect.StructField) DecOp {
+	return func(r Reader, s *State, v reflect.Value) error {
+		max, err := r.ReadUint32()
+		if err != nil {
+			return err
+		}
+		offset, err := r.ReadUint32()
+		if err != nil {
+			return err
+		}
+		if offset != 0 {
+			return NewDecodingError(OffsetMismatch, "", rf.Name, int(offset), 0)
+		}
+		count, err := r.ReadUint32()
+		if err != nil {
+			return err
+		}
+		if count > max {
+			return NewDecodingError(VarianceOutOfBounds, "", rf.Name, int(count), int(max))
+		}
+		if remaining, ok := r.Remaining(); ok && int64(count)*2 > int64(remaining) {
+			return NewDecodingError(InsufficientData, "", rf.Name, int(count), remaining)
+		}
+		if count == 0 {
+			return NewDecodingError(UnterminatedString, "", rf.Name, 0, 0)
+		}
+		capacity := int(count)
+		if capacity > maxPrealloc {
+			capacity = maxPrealloc
+		}
+		units := make([]uint16, 0, capacity)
+		for i := uint32(0); i < count; i++ {
+			u, err := r.ReadUint16()
+			if err != nil {
+				return err
+			}
+			units = append(units, u)
+		}
+		if units[count-1] != 0 {
+			return NewDecodingError(UnterminatedString, "", rf.Name, int(count), 0)
+		}
+		v.SetString(string(utf16.Decode(units[:count-1])))
+		return nil
+	}
+}
+
+// EncOpForFixedString returns an NDR encoding function for the given field,
+// which must be an array of uint8 or uint16 with the string attribute. The
+// array is encoded as a varying string, whose elements up to and including
+// the first null character are transmitted.
+func EncOpForFixedString(rf reflect.StructField, narrow bool) EncOp {
+	elemOp := EncOp(EncUint16)
+	if narrow {
+		elemOp = EncChar
+	}
+	return func(w Writer, s *State, v reflect.Value) {
+		count := terminator(v)
+		if count < 0 {
+			s.AddError(NewEncodingError(UnterminatedArray, "", rf.Name, "", v.Len(), 0))
+			count = v.Len()
+		}
+		w.WriteUint32(0) // Offset
+		w.WriteUint32(uint32(count))
+		for i := 0; i < count; i++ {
+			elemOp(w, s, v.Index(i))
+		}
+	}
+}
+
+// DecOpForFixedString returns an NDR decoding function for the given field,
+// which is the counterpart of EncOpForFixedString. The received string must
+// fit within the array and be terminated by a null character. The elements
+// that follow it are zero.
+func DecOpForFixedString(rf reflect.StructField, narrow bool) DecOp {
+	elemOp := DecOp(DecUint16)
+	if narrow {
+		elemOp = DecChar
+	}
+	return func(r Reader, s *State, v reflect.Value) error {
+		subsets, err := DecSliceHeader(r, s, 1)
+		if err != nil {
+			return err
+		}
+		offset, count := subsets[0].Offset, subsets[0].Count
+		if offset != 0 {
+			return NewDecodingError(OffsetMismatch, "", rf.Name, offset, 0)
+		}
+		if count > v.Len() {
+			return NewDecodingError(VarianceOutOfBounds, "", rf.Name, count, v.Len())
+		}
+		v.Set(reflect.Zero(v.Type()))
+		for i := 0; i < count; i++ {
+			if err := elemOp(r, s, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		if count == 0 || v.Index(count-1).Uint() != 0 {
+			return NewDecodingError(UnterminatedString, "", rf.Name, count, 0)
+		}
+		return nil
+	}
+}
+
+// IsFixedString returns true if the given field is an array of uint8 or
+// uint16 with the string attribute.
+func IsFixedString(rf reflect.StructField, attrs types.FieldAttrList) bool {
+	if rf.Type.Kind() != reflect.Array || !attrs.Contains("string") {
+		return false
+	}
+	switch rf.Type.Elem().Kind() {
+	case reflect.Uint8, reflect.Uint16:
+		return true
+	}
+	return false
+}
+
+// terminator returns the number of elements of the array v up to and
+// including the first null character, or -1 if it has none.
+func terminator(v reflect.Value) int {
+	for i := 0; i < v.Len(); i++ {
+		if v.Index(i).Uint() == 0 {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// DecOpForChars returns an NDR decoding function for the given field, which
+// holds characters. The field must have a type that is accepted by
+// EncOpForChars, otherwise DecOpForChars returns nil.
+func DecOpForChars(rf reflect.StructField) DecOp {
+	if rf.Type.Kind() == reflect.String {
+		return DecOpForConformantVaryingString(rf)
+	}
+	return decOpForChars(rf.Type)
+}
+
+func decOpForChars(rt reflect.Type) DecOp {
+	switch rt.Kind() {
+	case reflect.Uint8:
+		return DecChar
+	case reflect.Array:
+		length, elemOp := rt.Len(), decOpForChars(rt.Elem())
+		if elemOp == nil {
+			return nil
+		}
+		return func(r Reader, s *State, v reflect.Value) error {
+			for i := 0; i < length; i++ {
+				if err := elemOp(r, s, v.Index(i)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	case reflect.Slice:
+		dimensions, elem := ArrayDimensions(rt)
+		if elem.Kind() != reflect.Uint8 {
+			return nil
+		}
+		return func(r Reader, s *State, v reflect.Value) error {
+			subsets, err := DecSliceHeader(r, s, dimensions)
+			if err != nil {
+				return err
+			}
+			return DecSliceElements(r, s, v, subsets, DecChar)
+		}
+	}
+	return nil
+}
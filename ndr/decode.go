@@ -0,0 +1,488 @@
+package ndr
+
+import (
+	"reflect"
+
+	"github.com/gentlemanautomaton/dcerpc/idl/types"
+)
+
+type decInstr struct {
+	op    DecOp
+	index []int
+}
+
+// DecOp represents a compiled NDR decoding operation for a particular type or
+// field. The value v must be settable.
+type DecOp func(r Reader, s *State, v reflect.Value) error
+
+// DecNoop is an NDR decoding function that does nothing.
+func DecNoop(r Reader, s *State, v reflect.Value) error { return nil }
+
+// DecOpForError returns an NDR decoding function that returns err. It takes
+// the place of a decoding function that could not be compiled, so that the
+// error is returned when a value is decoded.
+func DecOpForError(err error) DecOp {
+	return func(r Reader, s *State, v reflect.Value) error {
+		return err
+	}
+}
+
+// DecBool is an NDR decoding function for a bool.
+func DecBool(r Reader, s *State, v reflect.Value) error {
+	x, err := r.ReadBool()
+	v.SetBool(x)
+	return err
+}
+
+// DecInt8 is an NDR decoding function for an int8.
+func DecInt8(r Reader, s *State, v reflect.Value) error {
+	x, err := r.ReadInt8()
+	v.SetInt(int64(x))
+	return err
+}
+
+// DecUint8 is an NDR decoding function for a uint8.
+func DecUint8(r Reader, s *State, v reflect.Value) error {
+	x, err := r.ReadUint8()
+	v.SetUint(uint64(x))
+	return err
+}
+
+// DecInt16 is an NDR decoding function for an int16.
+func DecInt16(r Reader, s *State, v reflect.Value) error {
+	x, err := r.ReadInt16()
+	v.SetInt(int64(x))
+	return err
+}
+
+// DecUint16 is an NDR decoding function for a uint16.
+func DecUint16(r Reader, s *State, v reflect.Value) error {
+	x, err := r.ReadUint16()
+	v.SetUint(uint64(x))
+	return err
+}
+
+// DecInt32 is an NDR decoding function for an int32.
+func DecInt32(r Reader, s *State, v reflect.Value) error {
+	x, err := r.ReadInt32()
+	v.SetInt(int64(x))
+	return err
+}
+
+// DecUint32 is an NDR decoding function for a uint32.
+func DecUint32(r Reader, s *State, v reflect.Value) error {
+	x, err := r.ReadUint32()
+	v.SetUint(uint64(x))
+	return err
+}
+
+// DecInt64 is an NDR decoding function for an int64.
+func DecInt64(r Reader, s *State, v reflect.Value) error {
+	x, err := r.ReadInt64()
+	v.SetInt(x)
+	return err
+}
+
+// DecUint64 is an NDR decoding function for a uint64.
+func DecUint64(r Reader, s *State, v reflect.Value) error {
+	x, err := r.ReadUint64()
+	v.SetUint(x)
+	return err
+}
+
+// DecFloat32 is an NDR decoding function for a float32.
+func DecFloat32(r Reader, s *State, v reflect.Value) error {
+	x, err := r.ReadFloat32()
+	v.SetFloat(float64(x))
+	return err
+}
+
+// DecFloat64 is an NDR decoding function for a float64.
+func DecFloat64(r Reader, s *State, v reflect.Value) error {
+	x, err := r.ReadFloat64()
+	v.SetFloat(x)
+	return err
+}
+
+// DecOpForPrimitive returns an NDR decoding function for the given type, if it
+// represents an NDR primitive, otherwise it returns nil.
+// The mapping of NDR primitives to Go types is described in the package
+// documentation.
+func DecOpForPrimitive(rt reflect.Type) DecOp {
+	switch rt.Kind() {
+	case reflect.Bool:
+		return DecBool
+	case reflect.Int8:
+		return DecInt8
+	case reflect.Uint8:
+		return DecUint8
+	case reflect.Int16:
+		return DecInt16
+	case reflect.Uint16:
+		return DecUint16
+	case reflect.Int32:
+		return DecInt32
+	case reflect.Uint32:
+		return DecUint32
+	case reflect.Int64:
+		return DecInt64
+	case reflect.Uint64:
+		return DecUint64
+	case reflect.Float32:
+		return DecFloat32
+	case reflect.Float64:
+		return DecFloat64
+	}
+	return nil
+}
+
+// DecOpForArray returns an NDR decoding function for the given type, which
+// must be an array. Multi-dimensional arrays are decoded recursively in
+// row-major order, which matches the order in which they are encoded.
+func DecOpForArray(rt reflect.Type) DecOp {
+	length, elemOp := rt.Len(), DecOpFor(rt.Elem())
+	return func(r Reader, s *State, v reflect.Value) error {
+		for i := 0; i < length; i++ {
+			if err := elemOp(r, s, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// DecOpForSlice returns an NDR decoding function for the given type, which
+// must be a slice. The decoding function will decode the slice as a varying
+// array. Nested slices are decoded as a multi-dimensional varying array.
+func DecOpForSlice(rt reflect.Type) DecOp {
+	dimensions, elem := ArrayDimensions(rt)
+	elemOp := DecOpFor(elem)
+	return func(r Reader, s *State, v reflect.Value) error {
+		subsets, err := DecSliceHeader(r, s, dimensions)
+		if err != nil {
+			return err
+		}
+		return DecSliceElements(r, s, v, subsets, elemOp)
+	}
+}
+
+// DecOpForArrayField returns an NDR decoding function for the given field of
+// base, which must be a slice with conformance or variance attributes, or an
+// array with variance attributes. The decoding function operates on values of
+// the base type.
+//
+// The conformance of a slice, which is decoded at the start of the containing
+// struct, is retained by the decoder state. The decoding function decodes the
+// variance of each dimension, if the array is varying, and the transmitted
+// elements. The received bounds are verified against the array's attributes
+// when the fields they refer to precede the array.
+func DecOpForArrayField(base reflect.Type, field reflect.StructField, attrs types.FieldAttrList) DecOp {
+	return decOpForBoundedField(base, field, attrs, false)
+}
+
+// decOpForBoundedField returns the decoding function of DecOpForArrayField.
+// If inline is true the conformance of the array is decoded before its
+// variance, as it is for parameters and for the referents of pointers.
+func decOpForBoundedField(base reflect.Type, field reflect.StructField, attrs types.FieldAttrList, inline bool) DecOp {
+	bounds, err := CompileFieldBounds(base, field, attrs)
+	if err != nil {
+		return DecOpForError(err)
+	}
+	dimensions := len(bounds.Dimensions)
+	elemOp := DecOpFor(bounds.Elem)
+	switch {
+	case IsCharField(attrs) && bounds.Elem.Kind() == reflect.Uint8:
+		elemOp = DecChar
+	case bounds.Elem.Kind() == reflect.String:
+		elemOp = DecOpForStringPointer(field, IsCharField(attrs), UniquePointer)
+	}
+	return func(r Reader, s *State, v reflect.Value) error {
+		max := bounds.Fixed
+		if max == nil {
+			max = make([]int, dimensions)
+			for d := range max {
+				switch {
+				case !bounds.Conformant:
+					max[d] = -1
+				case inline:
+					m, err := r.ReadUint32()
+					if err != nil {
+						return err
+					}
+					max[d] = int(m)
+				default:
+					max[d] = int(s.PopConformance())
+				}
+			}
+		}
+		var subsets []SliceSubset
+		if bounds.Varying {
+			var err error
+			if subsets, err = DecSliceHeader(r, s, dimensions); err != nil {
+				return err
+			}
+		} else {
+			subsets = make([]SliceSubset, dimensions)
+			for d := range subsets {
+				subsets[d].Count = max[d]
+			}
+		}
+		if err := bounds.Check(v, max, subsets); err != nil {
+			return err
+		}
+		return DecSliceElements(r, s, v.FieldByIndex(field.Index), subsets, elemOp)
+	}
+}
+
+// DecSliceHeader is an NDR decoding function for varying array headers,
+// which declare array offsets and counts.
+func DecSliceHeader(r Reader, s *State, dimensions int) (subsets []SliceSubset, err error) {
+	subsets = make([]SliceSubset, dimensions)
+	for i := range subsets {
+		offset, err := r.ReadUint32()
+		if err != nil {
+			return nil, err
+		}
+		count, err := r.ReadUint32()
+		if err != nil {
+			return nil, err
+		}
+		subsets[i] = SliceSubset{Offset: int(offset), Count: int(count)}
+	}
+	return
+}
+
+// DecSliceElements is an NDR decoding function for varying array elements. It
+// does not decode varying array headers.
+//
+// DecSliceElements allocates a slice for each dimension with a length of the
+// offset plus the count of the subset for that dimension, so that each
+// element is stored at the index it was transmitted for. If v is an array the
+// elements are stored in it, and the subsets must lie within it.
+//
+// Every element occupies at least one octet, so a slice whose length exceeds
+// the number of octets that remain in r is rejected before it is allocated.
+// If r cannot report how many octets remain, the slice grows as its elements
+// arrive, unless its elements hold embedded pointers, in which case no more
+// than a few thousand elements are accepted.
+func DecSliceElements(r Reader, s *State, v reflect.Value, subsets []SliceSubset, elemOp DecOp) error {
+	subset := subsets[0]
+	n := subset.Offset + subset.Count
+	if subset.Offset < 0 || subset.Count < 0 || n < 0 {
+		return NewDecodingError(InsufficientData, v.Type().String(), "", n, 0)
+	}
+	if v.Kind() == reflect.Slice {
+		alloc := n
+		if remaining, ok := r.Remaining(); ok {
+			if n > remaining && v.Type().Elem().Size() > 0 {
+				return NewDecodingError(InsufficientData, v.Type().String(), "", n, remaining)
+			}
+		} else if alloc > maxPrealloc {
+			if HasReferents(v.Type().Elem()) {
+				// The referents of the elements are decoded after the
+				// array, into the elements where they were first
+				// stored, so the slice cannot grow.
+				return NewDecodingError(CountOutOfRange, v.Type().String(), "", n, maxPrealloc)
+			}
+			alloc = maxPrealloc
+		}
+		v.Set(reflect.MakeSlice(v.Type(), alloc, alloc))
+	}
+	for i := subset.Offset; i < n; i++ {
+		for i >= v.Len() {
+			// Double the length of the slice, up to its final length.
+			grow := v.Len()
+			if grow > n-v.Len() {
+				grow = n - v.Len()
+			}
+			v.Set(reflect.AppendSlice(v, reflect.MakeSlice(v.Type(), grow, grow)))
+		}
+		var err error
+		if len(subsets) > 1 {
+			err = DecSliceElements(r, s, v.Index(i), subsets[1:], elemOp)
+		} else {
+			err = elemOp(r, s, v.Index(i))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DecOpForStruct returns an NDR decoding function for the given type, which
+// must be a struct. If the struct contains conformant data its conformance
+// will be decoded before the struct members, which are aligned to the
+// alignment of the struct.
+func DecOpForStruct(rt reflect.Type) DecOp {
+	return decOpForStruct(rt, false)
+}
+
+// decOpForStruct returns an NDR decoding function for the given type, which
+// must be a struct. If hoisted is true the struct is embedded within another
+// struct, which has already decoded its conformance.
+func decOpForStruct(rt reflect.Type, hoisted bool) DecOp {
+	engine := make([]decInstr, 0, rt.NumField()+1)
+	if !hoisted && IsConformantStruct(rt) {
+		engine = append(engine, decInstr{op: DecOpForStructConformance(rt)})
+	}
+	if alignment := Alignment(rt); alignment > 1 {
+		engine = append(engine, decInstr{op: func(r Reader, s *State, v reflect.Value) error {
+			return r.Align(alignment)
+		}})
+	}
+
+	for i := 0; i < rt.NumField(); i++ {
+		if instr, ok := decInstrForField(rt, rt.Field(i), false); ok {
+			engine = append(engine, instr)
+		}
+	}
+	return func(r Reader, s *State, v reflect.Value) error {
+		for i := 0; i < len(engine); i++ {
+			instr := &engine[i]
+			if err := instr.op(r, s, v.FieldByIndex(instr.index)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// decInstrForField returns the decoding instruction for the given field of
+// base, which is the counterpart of the instruction returned by
+// encInstrForField.
+func decInstrForField(base reflect.Type, f reflect.StructField, param bool) (decInstr, bool) {
+	tag := f.Tag.Get("idl")
+	if tag == "-" {
+		return decInstr{}, false
+	}
+	attrs := types.ParseFieldAttrList(tag)
+	if !IsMarshaler(f.Type) {
+		switch {
+		case IsUnionField(f, attrs):
+			// The discriminant is verified against the struct.
+			return decInstr{op: DecOpForUnionField(base, f, attrs)}, true
+		case f.Type.Kind() == reflect.Slice && HasBounds(attrs) && IsPointerField(attrs):
+			return decInstr{op: DecOpForArrayPointer(base, f, attrs)}, true
+		case IsFixedString(f, attrs):
+			return decInstr{op: DecOpForFixedString(f, IsCharField(attrs)), index: f.Index}, true
+		case IsBoundedField(f, attrs):
+			// The bounds of the array are evaluated against the struct.
+			return decInstr{op: decOpForBoundedField(base, f, attrs, param)}, true
+		case f.Type.Kind() == reflect.String && IsPointerField(attrs):
+			return decInstr{op: DecOpForStringPointer(f, IsCharField(attrs), PointerKind(attrs)), index: f.Index}, true
+		case !param && IsConformantStruct(base) && IsConformantStruct(f.Type) && !IsUnion(f.Type):
+			// The conformance of an embedded struct is hoisted to the
+			// start of the outermost struct.
+			return decInstr{op: decOpForStruct(f.Type, true), index: f.Index}, true
+		}
+	}
+	op := DecOpForField(f)
+	return decInstr{op: op, index: f.Index}, op != nil
+}
+
+// DecOpForStructConformance returns an NDR decoding function for the
+// conformance information of the given type, which must be a conformant
+// struct. The decoded maximum counts of each dimension of the conformant
+// array are retained by the decoder state until the array is decoded.
+func DecOpForStructConformance(rt reflect.Type) DecOp {
+	f := rt.Field(rt.NumField() - 1)
+	if f.Type.Kind() == reflect.Struct {
+		return DecOpForStructConformance(f.Type)
+	}
+	dimensions, _ := ArrayDimensions(f.Type)
+	return func(r Reader, s *State, v reflect.Value) error {
+		max := make([]uint64, dimensions)
+		for d := range max {
+			m, err := r.ReadUint32()
+			if err != nil {
+				return err
+			}
+			max[d] = uint64(m)
+		}
+		s.PushConformance(max...)
+		return nil
+	}
+}
+
+// DecOpForField returns an NDR decoding function for the given field.
+func DecOpForField(rf reflect.StructField) DecOp {
+	if op := DecOpForUnmarshaler(rf.Type); op != nil {
+		return op
+	}
+	attrs := types.ParseFieldAttrList(rf.Tag.Get("idl"))
+	if size := EnumSize(attrs); size > 0 {
+		if op := DecOpForEnum(rf, size); op != nil {
+			return DecOpForRange(rf, attrs, op)
+		}
+	}
+	if IsCharField(attrs) {
+		if op := DecOpForChars(rf); op != nil {
+			return op
+		}
+	}
+	if op := DecOpForPrimitive(rf.Type); op != nil {
+		return DecOpForRange(rf, attrs, op)
+	}
+
+	switch rf.Type.Kind() {
+	case reflect.Array:
+		return DecOpForArray(rf.Type)
+	case reflect.Slice:
+		// Slices with bounds attributes are decoded by DecOpForArrayField.
+		return DecOpForSlice(rf.Type)
+	case reflect.String:
+		// Strings with pointer attributes are decoded by
+		// DecOpForStringPointer.
+		return DecOpForConformantVaryingWideString(rf)
+	case reflect.Chan:
+		if IsPipe(rf.Type) {
+			return DecOpForPipe(rf.Type)
+		}
+	case reflect.Struct:
+		if IsUnion(rf.Type) {
+			return DecOpForUnion(rf.Type)
+		}
+		return DecOpForStruct(rf.Type)
+	case reflect.Ptr:
+		if attrs.Contains("ignore") {
+			return DecNullPointer
+		}
+		return DecOpForPointer(rf.Type, PointerKind(attrs))
+	}
+	return nil
+}
+
+// DecOpFor returns an NDR decoding function for the given type.
+func DecOpFor(rt reflect.Type) DecOp {
+	if op := DecOpForUnmarshaler(rt); op != nil {
+		return op
+	}
+	if op := DecOpForPrimitive(rt); op != nil {
+		return op
+	}
+
+	switch rt.Kind() {
+	case reflect.Array:
+		return DecOpForArray(rt)
+	case reflect.Slice:
+		return DecOpForSlice(rt)
+	case reflect.String:
+		return DecOpForStringPointer(reflect.StructField{}, false, UniquePointer)
+	case reflect.Chan:
+		if IsPipe(rt) {
+			return DecOpForPipe(rt)
+		}
+	case reflect.Ptr:
+		return DecOpForPointer(rt, UniquePointer)
+	case reflect.Struct:
+		switch {
+		case IsUnion(rt):
+			return DecOpForUnion(rt)
+		case IsParamList(rt):
+			return DecOpForParams(rt)
+		}
+		return DecOpForStruct(rt)
+	}
+	return nil
+}
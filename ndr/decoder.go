@@ -0,0 +1,71 @@
+package ndr
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+
+	"github.com/gentlemanautomaton/dcerpc/formatlabel"
+)
+
+var decTypeCache = NewDecoderTypeCache()
+
+// Decoder reads NDR data from an underlying io.Reader and decodes it into Go
+// types.
+type Decoder struct {
+	mutex  sync.Mutex
+	r      Reader
+	format formatlabel.Format
+}
+
+// NewDecoder returns a new Decoder that reads from the given io.Reader with
+// the encoding represented by the provided format label.
+func NewDecoder(r io.Reader, format formatlabel.Format) (dec *Decoder, err error) {
+	dec = &Decoder{
+		r:      NewReader(r, format),
+		format: format,
+	}
+	if dec.r == nil {
+		return nil, errors.New("Invalid format label")
+	}
+	return
+}
+
+// Decode reads the next NDR-encoded value from the underlying io.Reader and
+// stores it in the value pointed to by v.
+func (dec *Decoder) Decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("ndr: Decode requires a non-nil pointer")
+	}
+	return dec.DecodeValue(rv.Elem())
+}
+
+// DecodeValue reads the next NDR-encoded value from the underlying io.Reader
+// and stores it in v, which must be settable.
+func (dec *Decoder) DecodeValue(v reflect.Value) error {
+	op := decTypeCache.Get(v.Type())
+	// TODO: Add cache pending mechanism to avoid duplication of effort
+	if op == nil {
+		op = DecOpFor(v.Type())
+		if op == nil {
+			return fmt.Errorf("ndr: unable to decode values of type %s", v.Type())
+		}
+		decTypeCache.Add(v.Type(), op)
+	}
+
+	s := NewState() // FIXME: Figure out how the caller should provide state
+
+	dec.mutex.Lock()
+	defer dec.mutex.Unlock()
+	if err := op(dec.r, s, v); err != nil {
+		return err
+	}
+	// The referents of embedded pointers follow the value.
+	if err := s.Flush(); err != nil {
+		return err
+	}
+	return s.Err()
+}
@@ -7,5 +7,71 @@
 // The specification is available at this URL:
 // http://pubs.opengroup.org/onlinepubs/9629399/toc.pdf
 //
+// The NDR primitives are mapped to Go types as follows. Named types with the
+// same underlying types are encoded in the same way.
+//
+//	boolean                         bool, one octet that is nonzero for true
+//	byte, char, unsigned small      uint8 (byte)
+//	small, signed char              int8
+//	short                           int16
+//	unsigned short, wchar_t         uint16
+//	long, int                       int32
+//	unsigned long, error_status_t   uint32
+//	hyper                           int64
+//	unsigned hyper                  uint64
+//	float                           float32
+//	double                          float64
+//
+// An enum is a named integer type whose struct fields are marked with the
+// enum16 or v1_enum attribute in their idl struct tags. Enums marked with
+// enum16 are transmitted in 2 octets and have values from 0 to 32767. Enums
+// marked with v1_enum are transmitted in 4 octets. Invalid enum values are
+// reported when they are encoded or decoded.
+//
+// The values of integer fields with a range(min,max) attribute are verified
+// when they are decoded.
+//
+// Fields that hold IDL chars are marked with the char attribute, which
+// applies to uint8 fields, arrays and slices of uint8, and strings. Their
+// characters are translated to and from the ASCII or EBCDIC character
+// representation of the format label. Fields without the char attribute hold
+// octets.
+//
+// Strings are transmitted as conformant and varying strings that are
+// terminated by a null character. Go strings hold strings of wide characters
+// in UTF-16, or of narrow characters when they are marked with char. Fixed
+// arrays of uint8 or uint16 that are marked with string are transmitted as
+// varying strings.
+//
+// Pointer fields, and string and slice fields marked with the ref, unique or
+// ptr attribute, are embedded pointers. Their referents are transmitted after
+// the value that holds them, in the order described by the specification.
+// Pointers without one of these attributes are unique pointers. Full
+// pointers to the same referent are transmitted once.
+//
+// A union is a struct whose arms are marked with case(...) or default. Its
+// first other field holds the discriminant. A union is encapsulated unless
+// the field that holds it is marked with switch_is, whose expression is then
+// the discriminant. Empty arms are fields of type struct{}.
+//
+// The parameters of an operation are held by a struct whose fields are
+// marked with in or out. Parameters are transmitted one after another with
+// the referents of each, rather than as the members of a struct. Fields
+// marked with "-" are not transmitted.
+//
+// Floating point values are transmitted in the IEEE, VAX, IBM or Cray
+// representation selected by the format label. Values that the
+// representation cannot hold, such as infinities, are reported when they are
+// encoded. Cray floating point values occupy 8 octets, even when the IDL
+// type is float.
+//
+// Pipes are represented by bidirectional channels of their element type.
+// They are transmitted in chunks of up to PipeChunkSize elements as they are
+// received from the channel, until it is closed. Decoded pipes are delivered
+// on the channel held by the field, or on a new buffered channel if it is nil.
+//
+// Types that implement NDRMarshaler and NDRUnmarshaler provide their own
+// encodings.
+//
 // This package is a work in progress and is not yet ready for production use.
 package ndr
@@ -25,11 +25,6 @@ type encInstr struct {
 	index []int
 }
 
-type encField struct {
-	Name  string
-	Index []int
-}
-
 // EncOp represents a compiled NDR encoding operation for a particular type or
 // field.
 type EncOp func(w Writer, s *State, v reflect.Value)
@@ -37,6 +32,15 @@ type EncOp func(w Writer, s *State, v reflect.Value)
 // EncNoop is an NDR encoding function that does nothing.
 func EncNoop(w Writer, s *State, v reflect.Value) {}
 
+// EncOpForError returns an NDR encoding function that reports err. It takes
+// the place of an encoding function that could not be compiled, so that the
+// error is returned when a value is encoded.
+func EncOpForError(err error) EncOp {
+	return func(w Writer, s *State, v reflect.Value) {
+		s.AddError(err)
+	}
+}
+
 // EncBytes is an NDR encoding function for a byte slice.
 func EncBytes(w Writer, s *State, v reflect.Value) {
 	w.Write(v.Bytes())
@@ -87,6 +91,20 @@ func EncUint64(w Writer, s *State, v reflect.Value) {
 	w.WriteUint64((uint64)(v.Uint()))
 }
 
+// EncFloat32 is an NDR encoding function for a float32.
+func EncFloat32(w Writer, s *State, v reflect.Value) {
+	if err := w.WriteFloat32((float32)(v.Float())); err != nil {
+		s.AddError(err)
+	}
+}
+
+// EncFloat64 is an NDR encoding function for a float64.
+func EncFloat64(w Writer, s *State, v reflect.Value) {
+	if err := w.WriteFloat64(v.Float()); err != nil {
+		s.AddError(err)
+	}
+}
+
 // EncString is an NDR encoding function for a string.
 func EncString(w Writer, s *State, v reflect.Value) {
 	w.WriteString(v.String())
@@ -100,34 +118,10 @@ func EncVaryingString(w Writer, s *State, v reflect.Value) {
 }
 
 // EncOpForArray returns an NDR encoding function for the given type, which
-// must be an array.
+// must be an array. Multi-dimensional arrays are encoded recursively in
+// row-major order, with the elements of the last dimension adjacent.
 func EncOpForArray(rt reflect.Type) EncOp {
-	// Arrays of 1 to 4 dimensions have direct implementations that operate with
-	// a single encoding function managing the iterators.
-	//
-	// Arrays of 5 or more dimensions use 2 or more encoding functions called
-	// recursively to encode the values. In such cases the calls to EncOpFor in
-	// this function result in recursive calls to EncOpForArray.
-
-	e1 := rt.Elem()
-	if e1.Kind() != reflect.Array {
-		return EncOpForArray1D(rt.Len(), EncOpFor(e1))
-	}
-	e2 := e1.Elem()
-	if e2.Kind() != reflect.Array {
-		return EncOpForArray2D(rt.Len(), e1.Len(), EncOpFor(e2))
-	}
-	e3 := e2.Elem()
-	if e3.Kind() != reflect.Array {
-		return EncOpForArray3D(rt.Len(), e1.Len(), e2.Len(), EncOpFor(e3))
-	}
-	e4 := e3.Elem()
-	return EncOpForArray4D(rt.Len(), e1.Len(), e2.Len(), e3.Len(), EncOpFor(e4))
-}
-
-// EncOpForArray1D returns an NDR encoding function for a one-dimensional array
-// with the given length and element encoding function.
-func EncOpForArray1D(length int, elemOp EncOp) EncOp {
+	length, elemOp := rt.Len(), EncOpFor(rt.Elem())
 	return func(w Writer, s *State, v reflect.Value) {
 		for i := 0; i < length; i++ {
 			elemOp(w, s, v.Index(i))
@@ -135,60 +129,14 @@ func EncOpForArray1D(length int, elemOp EncOp) EncOp {
 	}
 }
 
-// EncOpForArray2D returns an NDR encoding function for a two-dimensional array
-// with the given lengths and element encoding function.
-func EncOpForArray2D(len1, len2 int, elemOp EncOp) EncOp {
-	return func(w Writer, s *State, v reflect.Value) {
-		for i := 0; i < len1; i++ {
-			for j := 0; j < len2; j++ {
-				elemOp(w, s, v.Index(i).Index(j))
-			}
-		}
-	}
-}
-
-// EncOpForArray3D returns an NDR encoding function for a three-dimensional
-// array with the given lengths and element encoding function.
-func EncOpForArray3D(len1, len2, len3 int, elemOp EncOp) EncOp {
-	return func(w Writer, s *State, v reflect.Value) {
-		for i := 0; i < len1; i++ {
-			for j := 0; j < len2; j++ {
-				for k := 0; k < len3; k++ {
-					elemOp(w, s, v.Index(i).Index(j).Index(k))
-				}
-			}
-		}
-	}
-}
-
-// EncOpForArray4D returns an NDR encoding function for a three-dimensional
-// array with the given lengths and element encoding function.
-func EncOpForArray4D(len1, len2, len3, len4 int, elemOp EncOp) EncOp {
-	return func(w Writer, s *State, v reflect.Value) {
-		for i := 0; i < len1; i++ {
-			for j := 0; j < len2; j++ {
-				for k := 0; k < len3; k++ {
-					for m := 0; m < len4; m++ {
-						elemOp(w, s, v.Index(i).Index(j).Index(k).Index(m))
-					}
-				}
-			}
-		}
-	}
-}
-
 // EncOpForSlice returns an NDR encoding function for the given type, which
 // must be a slice. The encoding function will encode the slice as a varying
-// array.
+// array. Nested slices are encoded as a multi-dimensional varying array,
+// with the greatest length of the slices of each dimension as its count.
 //
-// For the encoding of slices within structs, use EncOpForSliceField.
+// For the encoding of slices within structs, use EncOpForArrayField.
 func EncOpForSlice(rt reflect.Type) EncOp {
-	elem := rt.Elem()
-	dimensions := 1
-	for elem.Kind() == reflect.Slice {
-		dimensions++
-		elem = elem.Elem()
-	}
+	dimensions, elem := ArrayDimensions(rt)
 	elemOp := EncOpFor(elem)
 	return func(w Writer, s *State, v reflect.Value) {
 		subsets := SliceSubsets(dimensions, v)
@@ -201,59 +149,27 @@ func EncOpForSlice(rt reflect.Type) EncOp {
 // https://msdn.microsoft.com/en-us/library/aa367081
 
 // SliceSubsets determines the maximum length of each dimension of v, which must
-// be a slice and must be of the given dimensionality.
+// be a slice or an array and must be of the given dimensionality. The offset
+// of each subset is zero.
 func SliceSubsets(dimensions int, v reflect.Value) (subsets []SliceSubset) {
-	// Visit each node in the tree to find the maximum length at each depth level.
 	subsets = make([]SliceSubset, dimensions)
-	depth, maxDepth := 0, dimensions-1
-	stack := make([]SlicePosition, 0, dimensions)
-	stack = append(stack, SlicePosition{0, v, v.Len()})
-	pos, subset := &stack[depth], &subsets[depth]
-	// Examine each slice in each dimension to determine the maximum length
-
-	// FIXME: Most of the code below is copied from the EncSliceElements function
-	//        and needs to be reworked.
-	for {
-		// This loop stops at each slice in the N-dimensional set of slices (which
-		// is effectively a tree of slices). It starts at the root slice.
-
-		if pos.index == 0 {
-			if pos.parent.IsValid() {
-				if subset.Count < pos.parentLength {
-					subset.Count = pos.parentLength
-				}
-			}
-		}
-
-		// Traverse down to the next leaf slice
-		for depth < maxDepth {
-			if pos.parent.IsValid() && pos.index < pos.parentLength {
-				depth++
-				p := pos.parent.Index(pos.index)
-				stack = append(stack, SlicePosition{0, p, p.Len()})
-			} else {
-				break
-			}
-			pos, subset = &stack[depth], &subsets[depth]
-		}
-
-		// Write all of the elements in the leaf slice
+	sliceLengths(v, subsets)
+	return
+}
 
-		// Traverse upward and forward
-		for {
-			depth--
-			if depth < 0 {
-				return
-			}
-			stack = stack[0 : len(stack)-1]
-			pos, subset = &stack[depth], &subsets[depth]
-			pos.index++
-			if pos.index < subset.Count {
-				break
-			}
-		}
+// sliceLengths visits each slice in the tree of slices rooted at v and
+// records the maximum length at each depth in subsets.
+func sliceLengths(v reflect.Value, subsets []SliceSubset) {
+	n := v.Len()
+	if n > subsets[0].Count {
+		subsets[0].Count = n
+	}
+	if len(subsets) == 1 {
+		return
+	}
+	for i := 0; i < n; i++ {
+		sliceLengths(v.Index(i), subsets[1:])
 	}
-	return
 }
 
 // EncSliceHeader is an NDR encoding function for varying array headers,
@@ -269,86 +185,60 @@ func EncSliceHeader(w Writer, s *State, v reflect.Value, subsets []SliceSubset)
 // does not encode varying array headers.
 //
 // EncSliceElements encodes all of the slice elements with the given slice
-// element encoding function. The slice may be multi-dimensional. Only the
-// subsets specified for each dimension will be encoded.
+// element encoding function. The slice may be multi-dimensional, and may
+// be an array. Only the subsets specified for each dimension will be encoded,
+// in row-major order.
 //
 // If any subset exceeds the boundary of the actual slice data, zero values
 // appropriate for the element type will be generated to fill in the place of
 // the missing range. This is done to avoid encoding malformed data.
 func EncSliceElements(w Writer, s *State, v reflect.Value, subsets []SliceSubset, elemOp EncOp) {
-	dimensions := len(subsets)
-	depth, maxDepth := 0, dimensions-1
-	stack := make([]SlicePosition, 0, dimensions)
-	stack = append(stack, SlicePosition{0, v, v.Len()})
-	pos, subset := &stack[depth], &subsets[depth]
-	for {
-		// This loop stops at each slice in the N-dimensional set of slices (which
-		// is effectively a tree of slices). It starts at the root slice.
-
-		// Traverse down to the next leaf slice
-		for depth < maxDepth {
-			depth++
-			if pos.parent.IsValid() && pos.index < pos.parentLength {
-				p := pos.parent.Index(pos.index)
-				stack = append(stack, SlicePosition{0, p, p.Len()})
-			} else {
-				stack = append(stack, SlicePosition{0, reflect.Value{}, 0})
-			}
-			pos, subset = &stack[depth], &subsets[depth]
-		}
+	elem := v.Type()
+	for range subsets {
+		elem = elem.Elem()
+	}
+	encSliceElements(w, s, v, subsets, reflect.Zero(elem), elemOp)
+}
 
-		// Write all of the elements in the leaf slice
-		start, end := subset.Offset, subset.Offset+subset.Count
-		if pos.parent.IsValid() {
-			i := start
-			// Write values for elements that are present
-			for i < pos.parentLength {
-				elemOp(w, s, pos.parent.Index(i))
-				i++
-			}
-			// Write zero-values for elements that are absent
-			for i < end {
-				// FIXME: Add error to state?
-				// TODO: Accept a zero-value element function and call it here?
-				elemOp(w, s, reflect.Value{})
-				i++
-			}
-		} else {
-			// Write zero-values for elements that are absent
-			for i := start; i < end; i++ {
-				// FIXME: Add error to state?
-				// TODO: Accept a zero-value element function and call it here?
-				elemOp(w, s, reflect.Value{})
-			}
+// encSliceElements encodes the subsets of v, which is invalid if the slice is
+// missing, and encodes zero in place of missing elements.
+func encSliceElements(w Writer, s *State, v reflect.Value, subsets []SliceSubset, zero reflect.Value, elemOp EncOp) {
+	subset := subsets[0]
+	for i := subset.Offset; i < subset.Offset+subset.Count; i++ {
+		var elem reflect.Value
+		if v.IsValid() && i < v.Len() {
+			elem = v.Index(i)
 		}
-
-		// Traverse upward and forward
-		for {
-			depth--
-			if depth < 0 {
-				return
-			}
-			stack = stack[0 : len(stack)-1]
-			pos, subset = &stack[depth], &subsets[depth]
-			pos.index++
-			if pos.index < subset.Count {
-				break
-			}
+		switch {
+		case len(subsets) > 1:
+			encSliceElements(w, s, elem, subsets[1:], zero, elemOp)
+		case elem.IsValid():
+			elemOp(w, s, elem)
+		default:
+			elemOp(w, s, zero)
 		}
 	}
 }
 
 // EncOpForStruct returns an NDR encoding function for the given type, which
 // must be a struct. If the struct contains conformant data it will be
-// encoded appropriately.
+// encoded appropriately. The members are aligned to the alignment of the
+// struct, and the referents of embedded pointers are deferred until the
+// outermost construct has been encoded.
 //
 // See section 14.3.6 of the DCE RPC publication for an overview of the
 // struct encoding rules under NDR transfer syntax.
 func EncOpForStruct(rt reflect.Type) EncOp {
-	engine := make([]encInstr, 0, rt.NumField())
-	// TODO: Add alignment op?
-	if IsConformantStruct(rt) {
-		op, index := EncOpForConformantStruct(rt)
+	return encOpForStruct(rt, false)
+}
+
+// encOpForStruct returns an NDR encoding function for the given type, which
+// must be a struct. If hoisted is true the struct is embedded within another
+// struct, which has already encoded its conformance.
+func encOpForStruct(rt reflect.Type, hoisted bool) EncOp {
+	engine := make([]encInstr, 0, rt.NumField()+2)
+	if !hoisted && IsConformantStruct(rt) {
+		op, index := EncOpForStructConformance(rt)
 		engine = append(engine, encInstr{
 			op:    op,
 			index: index,
@@ -361,12 +251,8 @@ func EncOpForStruct(rt reflect.Type) EncOp {
 	}
 
 	for i := 0; i < rt.NumField(); i++ {
-		f := rt.Field(i)
-		if op := EncOpForField(f); op != nil {
-			engine = append(engine, encInstr{
-				op:    op,
-				index: f.Index,
-			})
+		if instr, ok := encInstrForField(rt, rt.Field(i), false); ok {
+			engine = append(engine, instr)
 		}
 	}
 	return func(w Writer, s *State, v reflect.Value) {
@@ -378,6 +264,41 @@ func EncOpForStruct(rt reflect.Type) EncOp {
 	}
 }
 
+// encInstrForField returns the encoding instruction for the given field of
+// base. The instruction operates on the field, or on the base value if its
+// index is empty. If param is true the field is a parameter, whose
+// conformance is encoded in place instead of at the start of the containing
+// struct. It returns false if the field is not transmitted.
+func encInstrForField(base reflect.Type, f reflect.StructField, param bool) (encInstr, bool) {
+	tag := f.Tag.Get("idl")
+	if tag == "-" {
+		return encInstr{}, false
+	}
+	attrs := types.ParseFieldAttrList(tag)
+	if !IsMarshaler(f.Type) {
+		switch {
+		case IsUnionField(f, attrs):
+			// The discriminant is evaluated against the struct.
+			return encInstr{op: EncOpForUnionField(base, f, attrs)}, true
+		case f.Type.Kind() == reflect.Slice && HasBounds(attrs) && IsPointerField(attrs):
+			return encInstr{op: EncOpForArrayPointer(base, f, attrs)}, true
+		case IsFixedString(f, attrs):
+			return encInstr{op: EncOpForFixedString(f, IsCharField(attrs)), index: f.Index}, true
+		case IsBoundedField(f, attrs):
+			// The bounds of the array are evaluated against the struct.
+			return encInstr{op: encOpForBoundedField(base, f, attrs, param)}, true
+		case f.Type.Kind() == reflect.String && IsPointerField(attrs):
+			return encInstr{op: EncOpForStringPointer(IsCharField(attrs), PointerKind(attrs)), index: f.Index}, true
+		case !param && IsConformantStruct(base) && IsConformantStruct(f.Type) && !IsUnion(f.Type):
+			// The conformance of an embedded struct is hoisted to the
+			// start of the outermost struct.
+			return encInstr{op: encOpForStruct(f.Type, true), index: f.Index}, true
+		}
+	}
+	op := EncOpForField(f)
+	return encInstr{op: op, index: f.Index}, op != nil
+}
+
 func encOpForInstructions(engine []encInstr, alignment int) EncOp {
 	return func(w Writer, s *State, v reflect.Value) {
 		w.Align(alignment)
@@ -406,13 +327,88 @@ func encOpForConformantInstructions(engine []encInstr, alignment int, prealignme
 }
 
 // EncOpForStructAlignment returns an NDR encoding function for aligning the
-// given type, which must be a struct.
+// given type, which must be a struct, or nil if the struct does not require
+// alignment.
 func EncOpForStructAlignment(rt reflect.Type) EncOp {
-	return nil
+	alignment := Alignment(rt)
+	if alignment <= 1 {
+		return nil
+	}
+	return func(w Writer, s *State, v reflect.Value) {
+		w.Align(alignment)
+	}
+}
+
+// Alignment returns the NDR alignment of the given type in octets.
+//
+// Primitives are aligned to their size. Pointers, strings, slices and pipes
+// are aligned to at least 4 octets, which is the size of referent
+// identifiers and of conformance and variance information. Structs and
+// unions are aligned to the largest alignment of their members. Types that
+// implement NDRMarshaler or NDRUnmarshaler declare their alignment with
+// NDRAligner.
+func Alignment(rt reflect.Type) int {
+	if IsMarshaler(rt) {
+		return MarshalerAlignment(rt)
+	}
+	switch rt.Kind() {
+	case reflect.Bool, reflect.Int8, reflect.Uint8:
+		return 1
+	case reflect.Int16, reflect.Uint16:
+		return 2
+	case reflect.Int32, reflect.Uint32, reflect.Float32, reflect.Ptr, reflect.String, reflect.Chan:
+		return 4
+	case reflect.Int64, reflect.Uint64, reflect.Float64:
+		return 8
+	case reflect.Slice:
+		_, elem := ArrayDimensions(rt)
+		if a := Alignment(elem); a > 4 {
+			return a
+		}
+		return 4
+	case reflect.Array:
+		return Alignment(rt.Elem())
+	case reflect.Struct:
+		alignment := 1
+		for i := 0; i < rt.NumField(); i++ {
+			if a := FieldAlignment(rt.Field(i)); a > alignment {
+				alignment = a
+			}
+		}
+		return alignment
+	}
+	return 1
+}
+
+// FieldAlignment returns the NDR alignment of the given field in octets,
+// which depends on its attributes as well as its type.
+func FieldAlignment(rf reflect.StructField) int {
+	tag := rf.Tag.Get("idl")
+	if tag == "-" {
+		return 1
+	}
+	attrs := types.ParseFieldAttrList(tag)
+	switch {
+	case IsMarshaler(rf.Type):
+		return MarshalerAlignment(rf.Type)
+	case IsPointerField(attrs):
+		return 4
+	case rf.Type.Kind() == reflect.Array && (attrs.IsVarying() || attrs.Contains("string")):
+		if a := Alignment(rf.Type.Elem()); a > 4 {
+			return a
+		}
+		return 4
+	}
+	if size := EnumSize(attrs); size > 0 {
+		return size
+	}
+	return Alignment(rf.Type)
 }
 
 // EncOpForPrimitive returns an NDR encoding function for the given type, if it
 // represents an NDR primitive, otherwise it returns nil.
+// The mapping of NDR primitives to Go types is described in the package
+// documentation.
 func EncOpForPrimitive(rt reflect.Type) EncOp {
 	switch rt.Kind() {
 	case reflect.Bool:
@@ -433,6 +429,10 @@ func EncOpForPrimitive(rt reflect.Type) EncOp {
 		return EncInt64
 	case reflect.Uint64:
 		return EncUint64
+	case reflect.Float32:
+		return EncFloat32
+	case reflect.Float64:
+		return EncFloat64
 	}
 	return nil
 }
@@ -444,196 +444,152 @@ func EncOpForStructConformance(rt reflect.Type) (EncOp, []int) {
 	if last >= 0 {
 		f := rt.Field(last)
 		if IsConformantField(f) {
-			return EncOpForFieldConformance(f)
+			return EncOpForConformantField(rt, f)
 		}
 	}
 	return EncNoop, nil
 }
 
-// EncOpForSliceConformance returns an encoding function for NDR conformance
-// data that encodes the conformance offset for the given base type, and slice
-// type which must be a
-// slice.
-func EncOpForSliceConformance(base reflect.Type, slice reflect.Type, attrs types.FieldAttrList) EncOp {
-	min, hasMin := attrs.Lookup("min_is")
-	max, hasMax := attrs.Lookup("max_is")
-	size, hasSize := attrs.Lookup("size")
-	switch {
-	case hasMin && hasMax:
-		minField, minOk := base.FieldByName(min)
-		maxField, maxOk := base.FieldByName(max)
-		if minOk && maxOk {
-			return EncOpForMinMaxConformance(minField.Index, maxField.Index)
-		}
-		// FIXME: panic?
-	case hasSize:
-		sizeField, sizeOk := base.FieldByName(size)
-		if sizeOk {
-			return EncOpForSizeConformance(sizeField.Index)
-		}
-	case hasMin:
-		minField, minOk := base.FieldByName(min)
-		if minOk {
-			return EncOpForMinConformance(minField.Index)
-		}
-	case hasMax:
-		maxField, maxOk := base.FieldByName(max)
-		if maxOk {
-			return EncOpForMaxConformance(maxField.Index)
-		}
-	}
-	// FIXME: panic?
-	return EncNoop
-}
-
-func EncOpForMinMaxConformance(minFieldIndex []int, maxFieldIndex []int) EncOp {
-	return func(w Writer, s *State, v reflect.Value) {
-		min := v.FieldByIndex(minFieldIndex).Uint()
-		max := v.FieldByIndex(maxFieldIndex).Uint()
-		// FIXME: panic if min or max overflows a 32 bit integer?
-		w.WriteUint32((uint32)(min))
-		w.WriteUint32((uint32)(max))
+// EncOpForSliceConformance returns an encoding function for the NDR
+// conformance of the given slice field of base, as described by the slice's
+// attributes. The maximum count of each dimension is encoded. The encoding
+// function operates on values of the base type.
+func EncOpForSliceConformance(base reflect.Type, slice reflect.StructField, attrs types.FieldAttrList) EncOp {
+	bounds, err := CompileFieldBounds(base, slice, attrs)
+	if err != nil {
+		return EncOpForError(err)
 	}
-}
-
-func EncOpForMinConformance(minFieldIndex []int) EncOp {
 	return func(w Writer, s *State, v reflect.Value) {
-		min := v.FieldByIndex(minFieldIndex).Uint()
-		// FIXME: panic if min overflows a 32 bit integer?
-		w.WriteUint32((uint32)(min))
-	}
-}
-
-func EncOpForMaxConformance(maxFieldIndex []int) EncOp {
-	return func(w Writer, s *State, v reflect.Value) {
-		max := v.FieldByIndex(maxFieldIndex).Uint()
-		// FIXME: panic if max overflows a 32 bit integer?
-		w.WriteUint32((uint32)(max))
-	}
-}
-
-func EncOpForSizeConformance(sizeFieldIndex []int) EncOp {
-	return func(w Writer, s *State, v reflect.Value) {
-		size := v.FieldByIndex(sizeFieldIndex).Uint()
-		// FIXME: panic if size overflows a 32 bit integer?
-		w.WriteUint32((uint32)(size))
+		max, err := bounds.MaxCounts(v)
+		if err != nil {
+			s.AddError(err)
+			max = make([]int, len(bounds.Dimensions))
+		}
+		for _, m := range max {
+			w.WriteUint32(uint32(m))
+		}
 	}
 }
 
 // EncOpForConformantField returns an NDR conformant data encoding function for
 // the given field, which must be a conformant slice or a conformant struct.
+//
+// The returned encoding function operates on the struct member identified by
+// the returned index, which is relative to base. For conformant slices the
+// index is empty because the conformance is calculated from the other members
+// of base.
 func EncOpForConformantField(base reflect.Type, rf reflect.StructField) (EncOp, []int) {
 	attrs := types.ParseFieldAttrList(rf.Tag.Get("idl"))
 	switch rf.Type.Kind() {
 	case reflect.Slice:
 		if attrs.IsConformant() {
-			// TODO: Evaluate min_is, max_is and size_is
-			//op := encOpForConformantSlice(rf.Type, attrs)
-			return func(w Writer, s *State, v reflect.Value) {
-				return
-			}, rf.Index
+			return EncOpForSliceConformance(base, rf, attrs), nil
 		}
 	case reflect.Struct:
 		if IsConformantStruct(rf.Type) {
-			return
+			op, index := EncOpForStructConformance(rf.Type)
+			return op, append(append([]int(nil), rf.Index...), index...)
 		}
 	}
-	if attrs.IsConformant() {
-		// TODO: Look for conformant attribute data
-		return nil, nil
-	}
-	// TODO: Evaluate struct members to find the conformant member
-	return nil, nil
+	return EncNoop, nil
 }
 
 // EncOpForField returns an NDR encoding function for the given field.
 func EncOpForField(rf reflect.StructField) EncOp {
-	if op := EncOpForPrimitive(rf.Type); op != nil {
+	if op := EncOpForMarshaler(rf.Type); op != nil {
 		return op
 	}
-
 	attrs := types.ParseFieldAttrList(rf.Tag.Get("idl"))
+	if size := EnumSize(attrs); size > 0 {
+		if op := EncOpForEnum(rf, size); op != nil {
+			return op
+		}
+	}
+	if IsCharField(attrs) {
+		if op := EncOpForChars(rf.Type); op != nil {
+			return op
+		}
+	}
+	if op := EncOpForPrimitive(rf.Type); op != nil {
+		return op
+	}
 
 	switch rf.Type.Kind() {
 	case reflect.Array:
 		return EncOpForArray(rf.Type)
 	case reflect.Slice:
+		// Slices with bounds attributes are encoded by EncOpForArrayField.
 		return EncOpForSlice(rf.Type)
 	case reflect.String:
-		if !attrs.IsConformant() && !attrs.IsVarying() {
-			// Do something
+		// Strings with pointer attributes are encoded by
+		// EncOpForStringPointer.
+		return EncConformantVaryingWideString
+	case reflect.Chan:
+		if IsPipe(rf.Type) {
+			return EncOpForPipe(rf.Type)
 		}
 	case reflect.Struct:
+		if IsUnion(rf.Type) {
+			return EncOpForUnion(rf.Type)
+		}
 		return EncOpForStruct(rf.Type)
 	case reflect.Ptr:
 		if attrs.Contains("ignore") {
-			return nil
+			return EncNullPointer
 		}
+		return EncOpForPointer(rf.Type, PointerKind(attrs))
 	}
 	return nil
 }
 
-// EncOpForSliceField returns an NDR encoding function for the given type, which
-// must be a slice.
-func EncOpForSliceField(base reflect.Type, slice reflect.Type, attrs types.FieldAttrList) EncOp {
-	// FIXME: Handle multiple dimensions
-	elemOp := EncOpFor(slice.Elem()) // FIXME: Handle embedded slices as multi-dimensional data?
-	var (
-		firstFieldName, hasFirst   = attrs.Lookup("first_is")
-		lastFieldName, hasLast     = attrs.Lookup("last_is")
-		lengthFieldName, hasLength = attrs.Lookup("length_is")
-	)
-
-	// FIXME: Support expressions?
-
+// EncOpForArrayField returns an NDR encoding function for the given field of
+// base, which must be a slice with conformance or variance attributes, or an
+// array with variance attributes. The encoding function operates on values of
+// the base type, against which the attributes are evaluated.
+//
+// The conformance of a slice is encoded at the start of the containing struct
+// by EncOpForStructConformance. The encoding function encodes the variance of
+// each dimension, if the array is varying, and the transmitted elements.
+func EncOpForArrayField(base reflect.Type, field reflect.StructField, attrs types.FieldAttrList) EncOp {
+	return encOpForBoundedField(base, field, attrs, false)
+}
+
+// encOpForBoundedField returns the encoding function of EncOpForArrayField.
+// If inline is true the conformance of the array is encoded before its
+// variance, as it is for parameters and for the referents of pointers.
+func encOpForBoundedField(base reflect.Type, field reflect.StructField, attrs types.FieldAttrList, inline bool) EncOp {
+	bounds, err := CompileFieldBounds(base, field, attrs)
+	if err != nil {
+		return EncOpForError(err)
+	}
+	elemOp := EncOpFor(bounds.Elem)
 	switch {
-	case hasFirst && hasLast:
-		firstField, firstOk := base.FieldByName(firstFieldName)
-		lastField, lastOk := base.FieldByName(lastFieldName)
-		if firstOk && lastOk {
-			encOpForSliceWithFirstLast(firstField.Index, lastField.Index, elemOp)
-		} else {
-			if !firstOk {
-				panic(NewEncodingError(MissingIDLFieldRef, base.Name(), slice.Name(), firstFieldName))
-			}
-			if !lastOk {
-				panic(NewEncodingError(MissingIDLFieldRef, base.Name(), slice.Name(), lastFieldName))
-			}
-		}
-	case hasFirst && hasLength:
-	case hasLast:
-	case hasLength:
-	case hasLast && hasLength:
-		panic("attribute list includes both last_is and length_is attributes, which are mutually exclusive")
-	default:
-
-		return func(w Writer, s *State, v reflect.Value) {
-			w.WriteUint32(0)                 // Varying array offset, always zero in our case
-			w.WriteUint32((uint32)(v.Len())) // Varying array length, in number of elements
-			for e := 0; e < v.Len(); e++ {
-				elemOp(w, s, v.Index(e))
-			}
-		}
+	case IsCharField(attrs) && bounds.Elem.Kind() == reflect.Uint8:
+		elemOp = EncChar
+	case bounds.Elem.Kind() == reflect.String:
+		elemOp = EncOpForStringPointer(IsCharField(attrs), UniquePointer)
 	}
-}
-
-func encOpForSliceWithFirstLast(typeName string, sliceField, firstField, lastField encField, elemOp EncOp) EncOp {
 	return func(w Writer, s *State, v reflect.Value) {
-		first := v.FieldByIndex(firstField.Index).Uint()
-		last := v.FieldByIndex(lastField.Index).Uint()
-		// FIXME: panic if min or max overflows a 32 bit integer?
-		// FIXME: Perform bounds checking?
-		if first > last {
-			s.AddError(NewEncodingError(FirstGreaterThanLast, typeName, sliceField.Name, firstField.Name, int(first), int(last)))
-			w.WriteUint32(0)
-			w.WriteUint32(0)
-		} else {
-			w.WriteUint32((uint32)(first))
-			w.WriteUint32((uint32)(last - first + 1))
-			for e := first; e < last; e++ {
-				elemOp(w, s, v.Index(int(e)))
+		max, err := bounds.MaxCounts(v)
+		if err != nil {
+			s.AddError(err)
+			return
+		}
+		subsets, err := bounds.Subsets(v, max)
+		if err != nil {
+			s.AddError(err)
+			subsets = make([]SliceSubset, len(max))
+		}
+		if inline && bounds.Conformant {
+			for _, m := range max {
+				w.WriteUint32(uint32(m))
 			}
 		}
+		array := v.FieldByIndex(field.Index)
+		if bounds.Varying {
+			EncSliceHeader(w, s, array, subsets)
+		}
+		EncSliceElements(w, s, array, subsets, elemOp)
 	}
 }
 
@@ -643,17 +599,35 @@ func EncOpFor(rt reflect.Type) EncOp {
 	//       Perhaps they could be namelessly composed into containing structs?
 	//       Alternatively: include empty struct types in into the struct that
 	//                      signify behaviors.
+	if op := EncOpForMarshaler(rt); op != nil {
+		return op
+	}
 	if op := EncOpForPrimitive(rt); op != nil {
 		return op
 	}
 
 	switch rt.Kind() {
 	case reflect.Array:
+		return EncOpForArray(rt)
+	case reflect.Slice:
+		return EncOpForSlice(rt)
 	case reflect.String:
-		//if !attrs.IsConformant() && !attrs.IsVarying() {
-		// Do something
-		//}
+		// A string that is not held in place by a field, such as an
+		// element of an array, is referred to by a unique pointer.
+		return EncOpForStringPointer(false, UniquePointer)
+	case reflect.Chan:
+		if IsPipe(rt) {
+			return EncOpForPipe(rt)
+		}
+	case reflect.Ptr:
+		return EncOpForPointer(rt, UniquePointer)
 	case reflect.Struct:
+		switch {
+		case IsUnion(rt):
+			return EncOpForUnion(rt)
+		case IsParamList(rt):
+			return EncOpForParams(rt)
+		}
 		return EncOpForStruct(rt)
 	}
 	return nil
@@ -661,7 +635,7 @@ func EncOpFor(rt reflect.Type) EncOp {
 
 // IsConformantStruct returns true if the given type is a conformant struct.
 func IsConformantStruct(rt reflect.Type) bool {
-	if rt.Kind() != reflect.Struct {
+	if rt.Kind() != reflect.Struct || IsMarshaler(rt) {
 		return false
 	}
 	last := rt.NumField() - 1
@@ -672,12 +646,19 @@ func IsConformantStruct(rt reflect.Type) bool {
 	return false
 }
 
-// IsConformantField returns true if the given field is conformant.
+// IsConformantField returns true if the given field is conformant. Fields
+// whose types implement NDRMarshaler encode their own conformance and are not
+// conformant, nor are slices that are referred to by pointers.
 func IsConformantField(rf reflect.StructField) bool {
+	if IsMarshaler(rf.Type) {
+		return false
+	}
 	switch rf.Type.Kind() {
 	case reflect.Slice:
+		// The conformance of an array that is referred to by a pointer
+		// precedes the array.
 		attrs := types.ParseFieldAttrList(rf.Tag.Get("idl"))
-		return attrs.IsConformant()
+		return attrs.IsConformant() && !IsPointerField(attrs)
 	case reflect.Struct:
 		return IsConformantStruct(rf.Type)
 	}
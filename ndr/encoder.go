@@ -2,6 +2,7 @@ package ndr
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"reflect"
 	"sync"
@@ -34,9 +35,9 @@ func NewEncoder(w io.Writer, format formatlabel.Format) (enc *Encoder, err error
 }
 
 // Encode encodes the given value in NDR and transmits the encoded value on the
-// underlying io.Writer.
+// underlying io.Writer. If v is a pointer the value it points to is encoded.
 func (enc *Encoder) Encode(v interface{}) error {
-	return enc.EncodeValue(reflect.ValueOf(v))
+	return enc.EncodeValue(reflect.Indirect(reflect.ValueOf(v)))
 }
 
 // EncodeValue encodes the given value in NDR and transmits the encoded value
@@ -46,15 +47,22 @@ func (enc *Encoder) EncodeValue(v reflect.Value) error {
 	// TODO: Add cache pending mechanism to avoid duplication of effort
 	if op == nil {
 		op = EncOpFor(v.Type())
+		if op == nil {
+			return fmt.Errorf("ndr: unable to encode values of type %s", v.Type())
+		}
 		encTypeCache.Add(v.Type(), op)
 	}
 
-	s := State{} // FIXME: Figure out how the caller should provide state
+	s := NewState() // FIXME: Figure out how the caller should provide state
 
 	enc.mutex.Lock()
-	op(enc.w, &s, v) // TODO: Return error from op?
+	op(enc.w, s, v)
+	// The referents of embedded pointers follow the value.
+	if err := s.Flush(); err != nil {
+		s.AddError(err)
+	}
 	enc.mutex.Unlock()
-	return nil
+	return s.Err()
 }
 
 func (enc *Encoder) buildType() {
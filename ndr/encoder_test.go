@@ -1,5 +1,18 @@
 package ndr
 
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/gentlemanautomaton/dcerpc/formatlabel"
+	"github.com/gentlemanautomaton/dcerpc/idl/expr"
+	"github.com/gentlemanautomaton/dcerpc/idl/types"
+)
+
 type encTest1 struct {
 	MaxLength int
 	Length    int
@@ -12,3 +25,519 @@ type encTest2 struct {
 	Length2   int
 	Data      [][]byte `idl:"size_is(MaxLength,20),length_is(Length1,Length2)"`
 }
+
+type encTest3 struct {
+	ByteCount uint32
+	Data      []uint16 `idl:"size_is(ByteCount/2)"`
+}
+
+type encTest4 struct {
+	First uint32
+	Last  uint32
+	Data  []uint32 `idl:"first_is(First),last_is(Last)"`
+}
+
+type encTest5 struct {
+	N    uint16
+	Data [2][3]uint16 `idl:"first_is(,1),length_is(1,N)"`
+}
+
+type encTest12 struct {
+	N    uint16
+	Data []uint16 `idl:"size_is(N)"`
+}
+
+type encTest13 struct {
+	A     uint32
+	Inner encTest12
+}
+
+func TestEncodeBounds(t *testing.T) {
+	tests := []struct {
+		name string
+		in   interface{}
+		want []byte
+	}{
+		{
+			name: "expression",
+			in:   &encTest3{ByteCount: 6, Data: []uint16{7, 8, 9}},
+			want: []byte{
+				3, 0, 0, 0, // Max count
+				6, 0, 0, 0, // ByteCount
+				7, 0, 8, 0, 9, 0,
+			},
+		},
+		{
+			name: "first-last",
+			in:   &encTest4{First: 1, Last: 2, Data: []uint32{5, 6, 7, 8}},
+			want: []byte{
+				1, 0, 0, 0, // First
+				2, 0, 0, 0, // Last
+				1, 0, 0, 0, // Offset
+				2, 0, 0, 0, // Actual count
+				6, 0, 0, 0, 7, 0, 0, 0,
+			},
+		},
+		{
+			name: "fixed-varying",
+			in:   &encTest5{N: 2, Data: [2][3]uint16{{1, 2, 3}, {4, 5, 6}}},
+			want: []byte{
+				2, 0, // N
+				0, 0, // Padding
+				0, 0, 0, 0, 1, 0, 0, 0, // Offset and count of dimension 1
+				1, 0, 0, 0, 2, 0, 0, 0, // Offset and count of dimension 2
+				2, 0, 3, 0,
+			},
+		},
+		{
+			name: "embedded-conformant",
+			in:   &encTest13{A: 1, Inner: encTest12{N: 2, Data: []uint16{7, 8}}},
+			want: []byte{
+				2, 0, 0, 0, // Max count, hoisted from Inner
+				1, 0, 0, 0, // A
+				2, 0, // N
+				7, 0, 8, 0,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc, _ := NewEncoder(&buf, formatlabel.LEAIEEE)
+			if err := enc.Encode(tt.in); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), tt.want) {
+				t.Fatalf("encoded % x, want % x", buf.Bytes(), tt.want)
+			}
+
+			out := reflect.New(reflect.TypeOf(tt.in).Elem())
+			dec, _ := NewDecoder(&buf, formatlabel.LEAIEEE)
+			if err := dec.Decode(out.Interface()); err != nil {
+				t.Fatal(err)
+			}
+			var again bytes.Buffer
+			enc, _ = NewEncoder(&again, formatlabel.LEAIEEE)
+			if err := enc.Encode(out.Interface()); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(again.Bytes(), tt.want) {
+				t.Fatalf("decoded value %+v encoded as % x", out.Elem().Interface(), again.Bytes())
+			}
+		})
+	}
+}
+
+type encTest16 struct {
+	MaxLength uint32
+	First     uint32
+	Length    uint32
+	Data      []uint16 `idl:"size_is(MaxLength),first_is(First),length_is(Length)"`
+}
+
+type encTest17 struct {
+	Size uint64
+	Data []uint16 `idl:"size_is(Size),length_is(0)"`
+}
+
+func TestEncodeBoundsErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   interface{}
+		code int
+	}{
+		{"length", &encTest16{MaxLength: 2, Length: 3, Data: []uint16{1, 2}}, VarianceOutOfRange},
+		{"first", &encTest16{MaxLength: 2, First: 2, Length: 1, Data: []uint16{1, 2}}, VarianceOutOfRange},
+		{"length-uint32", &encTest16{MaxLength: 2, First: 1, Length: math.MaxUint32, Data: []uint16{1, 2}}, VarianceOutOfRange},
+		{"size-uint32", &encTest17{Size: math.MaxUint32 + 1}, CountTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc, _ := NewEncoder(&buf, formatlabel.LEAIEEE)
+			err := enc.Encode(tt.in)
+			if e, ok := err.(*EncodingError); !ok || e.Code != tt.code {
+				t.Fatalf("Encode returned %v, want code %d", err, tt.code)
+			}
+		})
+	}
+}
+
+func TestFieldBounds(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      interface{}
+		max     []int
+		subsets []SliceSubset
+	}{
+		{
+			name:    "conformant-varying",
+			in:      encTest1{MaxLength: 4, Length: 2, Data: []byte{1, 2}},
+			max:     []int{4},
+			subsets: []SliceSubset{{Offset: 0, Count: 2}},
+		},
+		{
+			name:    "multi-dimensional",
+			in:      encTest2{MaxLength: 2, Length1: 2, Length2: 3, Data: [][]byte{{1, 2, 3}, {4, 5}}},
+			max:     []int{2, 20},
+			subsets: []SliceSubset{{Offset: 0, Count: 2}, {Offset: 0, Count: 3}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := reflect.ValueOf(tt.in)
+			field, _ := v.Type().FieldByName("Data")
+			attrs := types.ParseFieldAttrList(field.Tag.Get("idl"))
+			bounds, err := CompileFieldBounds(v.Type(), field, attrs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			max, err := bounds.MaxCounts(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(max, tt.max) {
+				t.Fatalf("max counts are %v, want %v", max, tt.max)
+			}
+			subsets, err := bounds.Subsets(v, max)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(subsets, tt.subsets) {
+				t.Fatalf("subsets are %v, want %v", subsets, tt.subsets)
+			}
+		})
+	}
+}
+
+// encTest11 has an array whose size refers to a field that it does not have.
+type encTest11 struct {
+	Data []uint32 `idl:"size_is(Count)"`
+}
+
+func TestUnknownBoundsField(t *testing.T) {
+	var buf bytes.Buffer
+	enc, _ := NewEncoder(&buf, formatlabel.LEAIEEE)
+	err := enc.Encode(&encTest11{Data: []uint32{1}})
+	var ferr *expr.FieldError
+	if !errors.As(err, &ferr) {
+		t.Fatalf("Encode returned %v, want a field error", err)
+	}
+
+	in := []byte{1, 0, 0, 0, 1, 0, 0, 0}
+	dec, _ := NewDecoder(bytes.NewReader(in), formatlabel.LEAIEEE)
+	var out encTest11
+	if err := dec.Decode(&out); !errors.As(err, &ferr) {
+		t.Fatalf("Decode returned %v, want a field error", err)
+	}
+}
+
+func TestDecodeBoundsMismatch(t *testing.T) {
+	// The max count of 5 disagrees with the ByteCount of 6.
+	in := []byte{5, 0, 0, 0, 6, 0, 0, 0, 1, 0, 2, 0, 3, 0, 4, 0, 5, 0}
+	dec, _ := NewDecoder(bytes.NewReader(in), formatlabel.LEAIEEE)
+	var out encTest3
+	err := dec.Decode(&out)
+	if e, ok := err.(*DecodingError); !ok || e.Code != ConformanceMismatch {
+		t.Fatalf("Decode returned %v, want a conformance mismatch", err)
+	}
+}
+
+// encGUID is encoded as a GUID structure, with its first three fields
+// subject to byte-swapping.
+type encGUID [16]byte
+
+func (g encGUID) MarshalNDR(w Writer, s *State) error {
+	w.WriteUint32(uint32(g[0])<<24 | uint32(g[1])<<16 | uint32(g[2])<<8 | uint32(g[3]))
+	w.WriteUint16(uint16(g[4])<<8 | uint16(g[5]))
+	w.WriteUint16(uint16(g[6])<<8 | uint16(g[7]))
+	_, err := w.Write(g[8:])
+	return err
+}
+
+func (g *encGUID) UnmarshalNDR(r Reader, s *State) error {
+	a, err := r.ReadUint32()
+	if err != nil {
+		return err
+	}
+	b, err := r.ReadUint16()
+	if err != nil {
+		return err
+	}
+	c, err := r.ReadUint16()
+	if err != nil {
+		return err
+	}
+	g[0], g[1], g[2], g[3] = byte(a>>24), byte(a>>16), byte(a>>8), byte(a)
+	g[4], g[5], g[6], g[7] = byte(b>>8), byte(b), byte(c>>8), byte(c)
+	return r.ReadFull(g[8:])
+}
+
+func (g encGUID) AlignNDR() int { return 4 }
+
+type encTest7 struct {
+	Flag  uint8
+	ID    encGUID
+	IDs   []encGUID
+	Count uint16
+}
+
+func TestMarshaler(t *testing.T) {
+	id := encGUID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	in := encTest7{Flag: 1, ID: id, IDs: []encGUID{id}, Count: 2}
+	want := []byte{
+		1,       // Flag
+		0, 0, 0, // Padding
+		4, 3, 2, 1, 6, 5, 8, 7, 9, 10, 11, 12, 13, 14, 15, 16, // ID
+		0, 0, 0, 0, 1, 0, 0, 0, // Offset and count of IDs
+		4, 3, 2, 1, 6, 5, 8, 7, 9, 10, 11, 12, 13, 14, 15, 16,
+		2, 0, // Count
+	}
+	var buf bytes.Buffer
+	enc, _ := NewEncoder(&buf, formatlabel.LEAIEEE)
+	if err := enc.Encode(&in); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("encoded % x, want % x", buf.Bytes(), want)
+	}
+	var out encTest7
+	dec, _ := NewDecoder(&buf, formatlabel.LEAIEEE)
+	if err := dec.Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("decoded %+v, want %+v", out, in)
+	}
+}
+
+type encColor int
+
+type encTest8 struct {
+	Color  encColor `idl:"enum16"`
+	Kind   encColor `idl:"v1_enum"`
+	Weight uint16   `idl:"range(1,10)"`
+}
+
+func TestEnumAndRange(t *testing.T) {
+	in := encTest8{Color: 2, Kind: -1, Weight: 10}
+	want := []byte{2, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 10, 0}
+	var buf bytes.Buffer
+	enc, _ := NewEncoder(&buf, formatlabel.LEAIEEE)
+	if err := enc.Encode(&in); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("encoded % x, want % x", buf.Bytes(), want)
+	}
+	var out encTest8
+	dec, _ := NewDecoder(&buf, formatlabel.LEAIEEE)
+	if err := dec.Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if out != in {
+		t.Fatalf("decoded %+v, want %+v", out, in)
+	}
+
+	enc, _ = NewEncoder(&buf, formatlabel.LEAIEEE)
+	if err := enc.Encode(&encTest8{Color: 40000}); err == nil {
+		t.Error("encoded a 16-bit enum value of 40000")
+	}
+
+	tests := []struct {
+		in   []byte
+		code int
+	}{
+		{[]byte{0x40, 0x9c, 0, 0, 0, 0, 0, 0, 1, 0}, InvalidEnumValue},
+		{[]byte{1, 0, 0, 0, 0, 0, 0, 0, 11, 0}, ValueOutOfRange},
+		{[]byte{1, 0, 0, 0, 0, 0, 0, 0, 0, 0}, ValueOutOfRange},
+	}
+	for _, tt := range tests {
+		dec, _ := NewDecoder(bytes.NewReader(tt.in), formatlabel.LEAIEEE)
+		err := dec.Decode(&out)
+		if e, ok := err.(*DecodingError); !ok || e.Code != tt.code {
+			t.Errorf("decoding % x returned %v, want code %d", tt.in, err, tt.code)
+		}
+	}
+}
+
+type encTest14 struct {
+	Weight uint16 `idl:"range(1)"`
+}
+
+type encTest15 struct {
+	Weight uint16 `idl:"range(1,Max)"`
+}
+
+func TestMalformedRange(t *testing.T) {
+	in := []byte{1, 0}
+	dec, _ := NewDecoder(bytes.NewReader(in), formatlabel.LEAIEEE)
+	err := dec.Decode(&encTest14{})
+	if e, ok := err.(*EncodingError); !ok || e.Code != InvalidRange {
+		t.Errorf("decoding a range with one bound returned %v, want code %d", err, InvalidRange)
+	}
+	dec, _ = NewDecoder(bytes.NewReader(in), formatlabel.LEAIEEE)
+	if err := dec.Decode(&encTest15{}); err == nil {
+		t.Error("decoded a range with a bound that is not constant")
+	}
+}
+
+type encTest9 struct {
+	Initial byte `idl:"char"`
+	Raw     byte
+	Name    string  `idl:"string,char"`
+	Code    [2]byte `idl:"char"`
+}
+
+func TestEncodeEBCDIC(t *testing.T) {
+	in := encTest9{Initial: 'A', Raw: 'A', Name: "Hi", Code: [2]byte{'O', 'K'}}
+	want := []byte{
+		0xc1, 0x41, 0, 0,
+		3, 0, 0, 0, 0, 0, 0, 0, 3, 0, 0, 0, 0xc8, 0x89, 0,
+		0xd6, 0xd2,
+	}
+	format := formatlabel.New(formatlabel.LittleEndian, formatlabel.EBCDIC, formatlabel.IEEE)
+	var buf bytes.Buffer
+	enc, _ := NewEncoder(&buf, format)
+	if err := enc.Encode(&in); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("encoded % x, want % x", buf.Bytes(), want)
+	}
+	var out encTest9
+	dec, _ := NewDecoder(&buf, format)
+	if err := dec.Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if out != in {
+		t.Fatalf("decoded %+v, want %+v", out, in)
+	}
+
+	for c := 0; c < 256; c++ {
+		if b := EBCDICToASCII(ASCIIToEBCDIC(byte(c))); b != byte(c) {
+			t.Errorf("character %#02x translated to %#02x", c, b)
+		}
+	}
+
+	unterminated := []byte{'A', 'A', 0, 0, 2, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 'H', 'i', 'O', 'K'}
+	dec, _ = NewDecoder(bytes.NewReader(unterminated), formatlabel.LEAIEEE)
+	err := dec.Decode(&out)
+	if e, ok := err.(*DecodingError); !ok || e.Code != UnterminatedString {
+		t.Errorf("decoding an unterminated string returned %v", err)
+	}
+}
+
+type encTest10 struct {
+	Scale int16
+	Data  chan int32
+}
+
+func TestEncodePipe(t *testing.T) {
+	in := encTest10{Scale: 2, Data: make(chan int32)}
+	go func() {
+		for i := int32(1); i <= 3; i++ {
+			in.Data <- i
+		}
+		close(in.Data)
+	}()
+	var buf bytes.Buffer
+	enc, _ := NewEncoder(&buf, formatlabel.LEAIEEE)
+	if err := enc.Encode(&in); err != nil {
+		t.Fatal(err)
+	}
+	encoded := append([]byte(nil), buf.Bytes()...)
+
+	// Chunk boundaries depend on when the elements are sent, so the
+	// elements are checked rather than the encoding itself.
+	var out encTest10
+	dec, _ := NewDecoder(bytes.NewReader(encoded), formatlabel.LEAIEEE)
+	if err := dec.Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	var got []int32
+	for x := range out.Data {
+		got = append(got, x)
+	}
+	if out.Scale != 2 || len(got) != 3 || got[0] != 1 || got[1] != 2 || got[2] != 3 {
+		t.Fatalf("decoded scale %d and elements %v", out.Scale, got)
+	}
+
+	want := []byte{2, 0, 0, 0, 1, 0, 0, 0, 7, 0, 0, 0, 0, 0, 0, 0}
+	dec, _ = NewDecoder(bytes.NewReader(want), formatlabel.LEAIEEE)
+	out = encTest10{Data: make(chan int32)}
+	errc := make(chan error, 1)
+	go func() { errc <- dec.Decode(&out) }()
+	if x, ok := <-out.Data; !ok || x != 7 {
+		t.Fatalf("received %d, %v from the pipe", x, ok)
+	}
+	if _, ok := <-out.Data; ok {
+		t.Fatal("the pipe was not closed")
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+
+	buf.Reset()
+	if err := enc.Encode(&encTest10{Scale: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{1, 0, 0, 0, 0, 0, 0, 0}; !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("encoded an empty pipe as % x, want % x", buf.Bytes(), want)
+	}
+}
+
+// onlyReader hides the Len method of the reader it wraps, so that the number
+// of octets that remain cannot be determined.
+type onlyReader struct {
+	io.Reader
+}
+
+func TestDecodeOversizedCount(t *testing.T) {
+	// A varying slice that claims far more elements than are present.
+	payload := []byte{0, 0, 0, 0, 0xff, 0xff, 0xff, 0x7f}
+
+	var out []uint64
+	dec, _ := NewDecoder(bytes.NewReader(payload), formatlabel.LEAIEEE)
+	err := dec.Decode(&out)
+	if e, ok := err.(*DecodingError); !ok || e.Code != InsufficientData {
+		t.Errorf("decoding an oversized count returned %v", err)
+	}
+
+	dec, _ = NewDecoder(onlyReader{bytes.NewReader(payload)}, formatlabel.LEAIEEE)
+	if err := dec.Decode(&out); err == nil {
+		t.Error("decoding an oversized count from a stream succeeded")
+	}
+
+	str := []byte{'A', 'A', 0, 0, 0xff, 0xff, 0xff, 0x7f, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0x7f, 'H', 'i'}
+	var s encTest9
+	dec, _ = NewDecoder(bytes.NewReader(str), formatlabel.LEAIEEE)
+	err = dec.Decode(&s)
+	if e, ok := err.(*DecodingError); !ok || e.Code != InsufficientData {
+		t.Errorf("decoding an oversized string returned %v", err)
+	}
+	dec, _ = NewDecoder(onlyReader{bytes.NewReader(str)}, formatlabel.LEAIEEE)
+	if err := dec.Decode(&s); err == nil {
+		t.Error("decoding an oversized string from a stream succeeded")
+	}
+
+	// Slices that are decoded from a stream still receive all of their
+	// elements when they are longer than the initial allocation.
+	in := make([]uint16, 10000)
+	for i := range in {
+		in[i] = uint16(i)
+	}
+	var buf bytes.Buffer
+	enc, _ := NewEncoder(&buf, formatlabel.LEAIEEE)
+	if err := enc.Encode(&in); err != nil {
+		t.Fatal(err)
+	}
+	var got []uint16
+	dec, _ = NewDecoder(onlyReader{&buf}, formatlabel.LEAIEEE)
+	if err := dec.Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(in) || got[9999] != 9999 {
+		t.Fatalf("decoded %d elements from a stream, want %d", len(got), len(in))
+	}
+}
@@ -0,0 +1,179 @@
+package ndr
+
+import (
+	"math"
+	"reflect"
+
+	"github.com/gentlemanautomaton/dcerpc/idl/expr"
+	"github.com/gentlemanautomaton/dcerpc/idl/types"
+)
+
+// EnumSize returns the number of octets in which an enum is transmitted in
+// NDR, as selected by the given attributes. Enums marked with enum16 are
+// transmitted in 2 octets and those marked with v1_enum in 4 octets. If the
+// attributes do not mark an enum it returns 0.
+func EnumSize(attrs types.FieldAttrList) int {
+	switch {
+	case attrs.Contains("v1_enum"):
+		return 4
+	case attrs.Contains("enum16"):
+		return 2
+	}
+	return 0
+}
+
+// EncOpForEnum returns an NDR encoding function for the given field, which
+// holds an enum that is transmitted in size octets. The field must have an
+// integer type, otherwise EncOpForEnum returns nil.
+//
+// The values of 16-bit enums are limited to the range 0 to 32767. The values
+// of 32-bit enums are signed. Values that cannot be represented are reported
+// as errors and encoded as zero.
+func EncOpForEnum(rf reflect.StructField, size int) EncOp {
+	if !isInteger(rf.Type) {
+		return nil
+	}
+	min, max := enumRange(size)
+	return func(w Writer, s *State, v reflect.Value) {
+		x, ok := intValue(v)
+		if !ok || x < min || x > max {
+			s.AddError(NewEncodingError(EnumOutOfRange, "", rf.Name, "", int(x), int(max)))
+			x = 0
+		}
+		if size == 2 {
+			w.WriteUint16(uint16(x))
+		} else {
+			w.WriteInt32(int32(x))
+		}
+	}
+}
+
+// DecOpForEnum returns an NDR decoding function for the given field, which
+// holds an enum that is transmitted in size octets. The field must have an
+// integer type, otherwise DecOpForEnum returns nil. Values that are outside
+// the range of the enum, or that do not fit in the field, are reported as
+// errors.
+func DecOpForEnum(rf reflect.StructField, size int) DecOp {
+	if !isInteger(rf.Type) {
+		return nil
+	}
+	_, max := enumRange(size)
+	return func(r Reader, s *State, v reflect.Value) error {
+		var x int64
+		if size == 2 {
+			u, err := r.ReadUint16()
+			if err != nil {
+				return err
+			}
+			x = int64(u)
+		} else {
+			i, err := r.ReadInt32()
+			if err != nil {
+				return err
+			}
+			x = int64(i)
+		}
+		if x > max || !setInt(v, x) {
+			return NewDecodingError(InvalidEnumValue, "", rf.Name, int(x), int(max))
+		}
+		return nil
+	}
+}
+
+// enumRange returns the range of values of an enum that is transmitted in
+// size octets.
+func enumRange(size int) (min, max int64) {
+	if size == 2 {
+		return 0, math.MaxInt16
+	}
+	return math.MinInt32, math.MaxInt32
+}
+
+// DecOpForRange returns an NDR decoding function for the given field that
+// calls op and then enforces the field's range(min,max) attribute, which is
+// given by attrs. The bounds of the range must be constant expressions. If
+// the field does not have an integer type or a range attribute, op is
+// returned. If the range attribute is malformed, the returned function
+// reports the error.
+//
+// As with the stubs generated by MIDL, the range is enforced only when values
+// are decoded.
+func DecOpForRange(rf reflect.StructField, attrs types.FieldAttrList, op DecOp) DecOp {
+	values, ok := attrs.LookupDimensions("range")
+	if !ok || op == nil || !isInteger(rf.Type) {
+		return op
+	}
+	if len(values) != 2 {
+		return DecOpForError(NewEncodingError(InvalidRange, "", rf.Name, "", len(values), 2))
+	}
+	min, err := constValue(values[0])
+	if err != nil {
+		return DecOpForError(err)
+	}
+	max, err := constValue(values[1])
+	if err != nil {
+		return DecOpForError(err)
+	}
+	return func(r Reader, s *State, v reflect.Value) error {
+		if err := op(r, s, v); err != nil {
+			return err
+		}
+		x, ok := intValue(v)
+		switch {
+		case !ok || x > max:
+			return NewDecodingError(ValueOutOfRange, "", rf.Name, int(x), int(max))
+		case x < min:
+			return NewDecodingError(ValueOutOfRange, "", rf.Name, int(x), int(min))
+		}
+		return nil
+	}
+}
+
+// constValue evaluates a constant expression.
+func constValue(s string) (int64, error) {
+	var empty struct{}
+	f, err := expr.CompileString(s, reflect.TypeOf(empty))
+	if err != nil {
+		return 0, err
+	}
+	return f.Eval(reflect.ValueOf(empty))
+}
+
+// isInteger returns true if rt is an integer type.
+func isInteger(rt reflect.Type) bool {
+	switch rt.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// intValue returns the value of v, which must be an integer, as an int64. It
+// returns false if the value is an unsigned integer that does not fit.
+func intValue(v reflect.Value) (int64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), true
+	}
+	u := v.Uint()
+	return int64(u), u <= math.MaxInt64
+}
+
+// setInt stores x in v, which must be a settable integer. It returns false if
+// x does not fit in v.
+func setInt(v reflect.Value, x int64) bool {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.OverflowInt(x) {
+			return false
+		}
+		v.SetInt(x)
+	default:
+		if x < 0 || v.OverflowUint(uint64(x)) {
+			return false
+		}
+		v.SetUint(uint64(x))
+	}
+	return true
+}
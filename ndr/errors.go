@@ -5,6 +5,11 @@ import "fmt"
 // Compile-time encoding error codes
 const (
 	MissingIDLFieldRef = 1000 + iota
+	TooManyDimensions
+	LastAndLength
+	InvalidRange
+	MissingDiscriminant
+	Unsupported
 )
 
 // Run-time encoding error codes
@@ -14,6 +19,12 @@ const (
 	FirstGreaterThanLast
 	NegativeSize
 	NegativeLength
+	EnumOutOfRange
+	NoUnionArm
+	NullReference
+	UnterminatedArray
+	VarianceOutOfRange
+	CountTooLarge
 )
 
 // EncodingError represents an error encountered during NDR encoding.
@@ -32,6 +43,35 @@ func (e EncodingError) Error() string {
 		return fmt.Sprintf("ndr encoder error: type \"%s\" contains a varying array field \"%s\" with an invalid first index \"%d\" that is greater than its last index \"%d\"", e.TypeName, e.FieldName, e.Value, e.Limit)
 	case MissingIDLFieldRef:
 		return fmt.Sprintf("ndr encoder error: type \"%s\" does not contain the \"%s\" field, which was referenced by the IDL attributes of the \"%s\" field.", e.TypeName, e.RefFieldName, e.FieldName)
+	case TooManyDimensions:
+		return fmt.Sprintf("ndr encoder error: type \"%s\" contains an array field \"%s\" whose \"%s\" attribute lists %d dimensions, but the field has %d", e.TypeName, e.FieldName, e.RefFieldName, e.Value, e.Limit)
+	case LastAndLength:
+		return fmt.Sprintf("ndr encoder error: type \"%s\" contains an array field \"%s\" with both last_is and length_is attributes for dimension %d, which are mutually exclusive", e.TypeName, e.FieldName, e.Value+1)
+	case InvalidRange:
+		return fmt.Sprintf("ndr encoder error: field \"%s\" has a range attribute with %d values instead of %d", e.FieldName, e.Value, e.Limit)
+	case MissingDiscriminant:
+		return fmt.Sprintf("ndr encoder error: type \"%s\" is a union without a discriminant field", e.TypeName)
+	case Unsupported:
+		if e.FieldName == "" {
+			return fmt.Sprintf("ndr encoder error: type \"%s\" is %s, which the transfer syntax does not support", e.TypeName, e.RefFieldName)
+		}
+		return fmt.Sprintf("ndr encoder error: type \"%s\" contains a field \"%s\" that holds %s, which the transfer syntax does not support", e.TypeName, e.FieldName, e.RefFieldName)
+	case NoUnionArm:
+		return fmt.Sprintf("ndr encoder error: union \"%s\" has no arm for the discriminant \"%d\"", e.TypeName, e.Value)
+	case NullReference:
+		return fmt.Sprintf("ndr encoder error: type \"%s\" contains a reference pointer field \"%s\" that is nil", e.TypeName, e.FieldName)
+	case UnterminatedArray:
+		return fmt.Sprintf("ndr encoder error: type \"%s\" contains a string field \"%s\" whose %d characters are not terminated by a null character", e.TypeName, e.FieldName, e.Value)
+	case VarianceOutOfRange:
+		return fmt.Sprintf("ndr encoder error: type \"%s\" contains a varying array field \"%s\" whose transmitted elements end at \"%d\", beyond its maximum count \"%d\"", e.TypeName, e.FieldName, e.Value, e.Limit)
+	case CountTooLarge:
+		return fmt.Sprintf("ndr encoder error: type \"%s\" contains an array field \"%s\" with a count \"%d\" that cannot be transmitted in 32 bits", e.TypeName, e.FieldName, e.Value)
+	case EnumOutOfRange:
+		return fmt.Sprintf("ndr encoder error: enum field \"%s\" has a value \"%d\" that cannot be transmitted, the maximum is \"%d\"", e.FieldName, e.Value, e.Limit)
+	case NegativeSize:
+		return fmt.Sprintf("ndr encoder error: type \"%s\" contains a conformant array field \"%s\" with a negative size \"%d\"", e.TypeName, e.FieldName, e.Value)
+	case NegativeLength:
+		return fmt.Sprintf("ndr encoder error: type \"%s\" contains a varying array field \"%s\" with a negative offset or length \"%d\"", e.TypeName, e.FieldName, e.Value)
 	default:
 		return "Unknown NDR encoding error"
 	}
@@ -49,3 +89,72 @@ func NewEncodingError(code int, typeName, fieldName, refFieldName string, value,
 		Limit:        limit,
 	}
 }
+
+// Run-time decoding error codes
+const (
+	ConformanceMismatch = 3000 + iota
+	OffsetMismatch
+	LengthMismatch
+	VarianceOutOfBounds
+	InvalidEnumValue
+	ValueOutOfRange
+	UnterminatedString
+	InsufficientData
+	CountOutOfRange
+	InvalidDiscriminant
+	DiscriminantMismatch
+	UnexpectedNull
+)
+
+// DecodingError represents an error encountered during NDR decoding.
+type DecodingError struct {
+	Code      int
+	TypeName  string
+	FieldName string
+	Value     int // The value that was received
+	Limit     int // The value that was expected, or the limit that was exceeded
+}
+
+func (e DecodingError) Error() string {
+	switch e.Code {
+	case ConformanceMismatch:
+		return fmt.Sprintf("ndr decoder error: type \"%s\" contains a conformant array field \"%s\" that was received with a size of \"%d\" when its attributes require \"%d\"", e.TypeName, e.FieldName, e.Value, e.Limit)
+	case OffsetMismatch:
+		return fmt.Sprintf("ndr decoder error: type \"%s\" contains a varying array field \"%s\" that was received with an offset of \"%d\" when its attributes require \"%d\"", e.TypeName, e.FieldName, e.Value, e.Limit)
+	case LengthMismatch:
+		return fmt.Sprintf("ndr decoder error: type \"%s\" contains a varying array field \"%s\" that was received with a length of \"%d\" when its attributes require \"%d\"", e.TypeName, e.FieldName, e.Value, e.Limit)
+	case VarianceOutOfBounds:
+		return fmt.Sprintf("ndr decoder error: type \"%s\" contains a varying array field \"%s\" that was received with elements up to \"%d\" that exceed its size of \"%d\"", e.TypeName, e.FieldName, e.Value, e.Limit)
+	case InvalidEnumValue:
+		return fmt.Sprintf("ndr decoder error: enum field \"%s\" received an invalid value \"%d\"", e.FieldName, e.Value)
+	case ValueOutOfRange:
+		return fmt.Sprintf("ndr decoder error: field \"%s\" received a value \"%d\" beyond the bound \"%d\" of its range attribute", e.FieldName, e.Value, e.Limit)
+	case UnterminatedString:
+		return fmt.Sprintf("ndr decoder error: string field \"%s\" received \"%d\" characters that are not terminated by a null character", e.FieldName, e.Value)
+	case InsufficientData:
+		return fmt.Sprintf("ndr decoder error: type \"%s\" contains an array or string field \"%s\" that was received with \"%d\" elements when only \"%d\" octets remain", e.TypeName, e.FieldName, e.Value, e.Limit)
+	case CountOutOfRange:
+		return fmt.Sprintf("ndr decoder error: type \"%s\" contains an array field \"%s\" that was received with a size, offset or count that exceeds \"%d\"", e.TypeName, e.FieldName, e.Limit)
+	case InvalidDiscriminant:
+		return fmt.Sprintf("ndr decoder error: union \"%s\" received a discriminant \"%d\" that does not select any of its arms", e.TypeName, e.Value)
+	case DiscriminantMismatch:
+		return fmt.Sprintf("ndr decoder error: type \"%s\" contains a union field \"%s\" that was received with a discriminant of \"%d\" when its attributes require \"%d\"", e.TypeName, e.FieldName, e.Value, e.Limit)
+	case UnexpectedNull:
+		return fmt.Sprintf("ndr decoder error: type \"%s\" contains a reference pointer field \"%s\" that was received as a null pointer", e.TypeName, e.FieldName)
+	default:
+		return "Unknown NDR decoding error"
+	}
+}
+
+// NewDecodingError returns an error for the given error code, type name and
+// field name, along with the value that was received and the value that was
+// expected or exceeded.
+func NewDecodingError(code int, typeName, fieldName string, value, limit int) error {
+	return &DecodingError{
+		Code:      code,
+		TypeName:  typeName,
+		FieldName: fieldName,
+		Value:     value,
+		Limit:     limit,
+	}
+}
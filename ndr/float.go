@@ -0,0 +1,258 @@
+package ndr
+
+import (
+	"errors"
+	"math"
+)
+
+// The VAX, IBM and Cray floating point representations are converted to and
+// from IEEE values by the functions in this file. The conversions operate on
+// the bits of each representation as an unsigned integer whose most
+// significant bit is the sign bit. The order in which the bytes are
+// transmitted is the responsibility of the writer and reader.
+//
+// None of the representations can hold infinities. Only VAX floating point
+// has an equivalent of NaN, which is its reserved operand. Values that are
+// too large to be represented are reported with ErrFloatOverflow and are
+// replaced by the largest value of the same sign. Values that are too small
+// to be represented are replaced by zero.
+
+var (
+	// ErrFloatOverflow is returned when a floating point value is too large
+	// to be represented by a floating point representation.
+	ErrFloatOverflow = errors.New("ndr: floating point value overflows its representation")
+
+	// ErrFloatNaN is returned when a floating point value is NaN and the
+	// floating point representation has no equivalent of NaN.
+	ErrFloatNaN = errors.New("ndr: floating point representation cannot hold NaN")
+)
+
+const (
+	vaxReservedOperand32 = 1 << 31
+	vaxReservedOperand64 = 1 << 63
+	craySignBit          = 1 << 63
+	crayBias             = 0x4000 // Exponent bias of Cray floating point
+	crayMaxExponent      = 0x5fff // Largest valid exponent, unbiased 8191
+	crayMinExponent      = 0x2000 // Smallest valid exponent, unbiased -8192
+)
+
+// Float32ToVAXF returns the bits of the VAX F_floating representation of v.
+//
+// NaN is converted to the reserved operand. The range of F_floating is
+// slightly smaller than that of IEEE single precision, so the largest
+// values overflow.
+func Float32ToVAXF(v float32) (uint32, error) {
+	sign, e, m, err := vaxFields(float64(v), 24, 128, 0xff)
+	switch {
+	case err == ErrFloatNaN:
+		return vaxReservedOperand32, nil
+	case err != nil:
+		return sign<<31 | 0x7fffffff, err
+	}
+	return sign<<31 | uint32(e)<<23 | uint32(m)&(1<<23-1), nil
+}
+
+// Float32FromVAXF returns the value of the VAX F_floating representation
+// held in u. The reserved operand is converted to NaN.
+func Float32FromVAXF(u uint32) float32 {
+	return float32(vaxValue(uint64(u>>31), uint64(u>>23&0xff), uint64(u&(1<<23-1)), 24, 128))
+}
+
+// Float64ToVAXG returns the bits of the VAX G_floating representation of v.
+//
+// NaN is converted to the reserved operand. The range of G_floating is
+// slightly smaller than that of IEEE double precision, so the largest
+// values overflow.
+func Float64ToVAXG(v float64) (uint64, error) {
+	sign, e, m, err := vaxFields(v, 53, 1024, 0x7ff)
+	switch {
+	case err == ErrFloatNaN:
+		return vaxReservedOperand64, nil
+	case err != nil:
+		return uint64(sign)<<63 | 0x7fffffffffffffff, err
+	}
+	return uint64(sign)<<63 | uint64(e)<<52 | m&(1<<52-1), nil
+}
+
+// Float64FromVAXG returns the value of the VAX G_floating representation
+// held in u. The reserved operand is converted to NaN.
+func Float64FromVAXG(u uint64) float64 {
+	return vaxValue(u>>63, u>>52&0x7ff, u&(1<<52-1), 53, 1024)
+}
+
+// vaxFields returns the sign, biased exponent and significand, including its
+// hidden bit, of the VAX representation of v with the given number of bits
+// of precision, exponent bias and largest exponent.
+func vaxFields(v float64, bits int, bias, max int64) (sign uint32, e int64, m uint64, err error) {
+	if math.IsNaN(v) {
+		return 0, 0, 0, ErrFloatNaN
+	}
+	if math.Signbit(v) {
+		sign = 1
+	}
+	if math.IsInf(v, 0) {
+		return sign, 0, 0, ErrFloatOverflow
+	}
+	if v == 0 {
+		// VAX floating point has no negative zero.
+		return 0, 0, 0, nil
+	}
+	frac, exp := math.Frexp(math.Abs(v)) // frac is in [0.5, 1), as a VAX fraction is
+	m = uint64(math.RoundToEven(math.Ldexp(frac, bits)))
+	if m == 1<<uint(bits) {
+		m >>= 1
+		exp++
+	}
+	e = int64(exp) + bias
+	switch {
+	case e > max:
+		return sign, 0, 0, ErrFloatOverflow
+	case e < 1:
+		return 0, 0, 0, nil
+	}
+	return sign, e, m, nil
+}
+
+// vaxValue returns the value of the VAX representation with the given sign,
+// biased exponent and fraction, which excludes the hidden bit.
+func vaxValue(sign, e, frac uint64, bits int, bias int64) float64 {
+	if e == 0 {
+		if sign != 0 {
+			return math.NaN() // Reserved operand
+		}
+		return 0
+	}
+	v := math.Ldexp(float64(frac|1<<uint(bits-1)), int(int64(e)-bias)-bits)
+	if sign != 0 {
+		v = -v
+	}
+	return v
+}
+
+// Float32ToIBM returns the bits of the IBM hexadecimal single precision
+// representation of v. Every finite IEEE single precision value is within
+// its range, although up to three bits of precision may be lost.
+func Float32ToIBM(v float32) (uint32, error) {
+	u, err := ibmBits(float64(v), 24)
+	return uint32(u), err
+}
+
+// Float32FromIBM returns the value of the IBM hexadecimal single precision
+// representation held in u. Values beyond the range of IEEE single precision
+// are converted to infinities or zero.
+func Float32FromIBM(u uint32) float32 {
+	return float32(ibmValue(uint64(u>>31), uint64(u>>24&0x7f), uint64(u&(1<<24-1)), 24))
+}
+
+// Float64ToIBM returns the bits of the IBM hexadecimal double precision
+// representation of v. IEEE double precision values beyond 16**63 overflow.
+func Float64ToIBM(v float64) (uint64, error) {
+	return ibmBits(v, 56)
+}
+
+// Float64FromIBM returns the value of the IBM hexadecimal double precision
+// representation held in u.
+func Float64FromIBM(u uint64) float64 {
+	return ibmValue(u>>63, u>>56&0x7f, u&(1<<56-1), 56)
+}
+
+// ibmBits returns the bits of the IBM hexadecimal representation of v with a
+// fraction of the given number of bits. Values below the smallest normalized
+// value are denormalized.
+func ibmBits(v float64, bits uint) (uint64, error) {
+	if math.IsNaN(v) {
+		return 0, ErrFloatNaN
+	}
+	var sign uint64
+	if math.Signbit(v) {
+		sign = 1 << (bits + 7)
+	}
+	max := sign | (1<<(bits+7) - 1)
+	if math.IsInf(v, 0) {
+		return max, ErrFloatOverflow
+	}
+	if v == 0 {
+		return 0, nil
+	}
+	// Find the hexadecimal exponent e for which the fraction v/16**e is in
+	// [1/16, 1).
+	_, exp := math.Frexp(math.Abs(v))
+	e := exp / 4
+	if exp > 0 && exp%4 != 0 {
+		e++
+	}
+	if e < -64 {
+		e = -64 // The fraction is denormalized.
+	}
+	m := uint64(math.RoundToEven(math.Ldexp(math.Abs(v), int(bits)-4*e)))
+	if m == 1<<bits {
+		m >>= 4
+		e++
+	}
+	switch {
+	case e > 63:
+		return max, ErrFloatOverflow
+	case m == 0:
+		return 0, nil
+	}
+	return sign | uint64(e+64)<<bits | m, nil
+}
+
+// ibmValue returns the value of the IBM hexadecimal representation with the
+// given sign, biased exponent and fraction of the given number of bits.
+func ibmValue(sign, e, frac uint64, bits int) float64 {
+	v := math.Ldexp(float64(frac), 4*(int(e)-64)-bits)
+	if sign != 0 {
+		v = -v
+	}
+	return v
+}
+
+// Float64ToCray returns the bits of the Cray floating point representation
+// of v. Cray floating point has a 48-bit coefficient and an exponent range
+// that includes every IEEE value, so it only overflows for infinities.
+//
+// NDR uses the same 64-bit representation for float and double values.
+func Float64ToCray(v float64) (uint64, error) {
+	if math.IsNaN(v) {
+		return 0, ErrFloatNaN
+	}
+	var sign uint64
+	if math.Signbit(v) {
+		sign = craySignBit
+	}
+	if math.IsInf(v, 0) {
+		return sign | crayMaxExponent<<48 | (1<<48 - 1), ErrFloatOverflow
+	}
+	if v == 0 {
+		return 0, nil
+	}
+	frac, exp := math.Frexp(math.Abs(v)) // frac is in [0.5, 1), as a Cray coefficient is
+	m := uint64(math.RoundToEven(math.Ldexp(frac, 48)))
+	if m == 1<<48 {
+		m >>= 1
+		exp++
+	}
+	return sign | uint64(exp+crayBias)<<48 | m, nil
+}
+
+// Float64FromCray returns the value of the Cray floating point
+// representation held in u. Exponents beyond the valid range of Cray
+// floating point are converted to infinities or zero, as are values beyond
+// the range of IEEE double precision.
+func Float64FromCray(u uint64) float64 {
+	e, m := int(u>>48&0x7fff), u&(1<<48-1)
+	var v float64
+	switch {
+	case m == 0 || e < crayMinExponent:
+		v = 0
+	case e > crayMaxExponent:
+		v = math.Inf(1)
+	default:
+		v = math.Ldexp(float64(m), e-crayBias-48)
+	}
+	if u&craySignBit != 0 {
+		v = -v
+	}
+	return v
+}
@@ -0,0 +1,162 @@
+package ndr
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/gentlemanautomaton/dcerpc/formatlabel"
+)
+
+func TestFloat32Bits(t *testing.T) {
+	tests := []struct {
+		name string
+		to   func(float32) (uint32, error)
+		from func(uint32) float32
+		in   float32
+		bits uint32
+		err  error
+		out  float32
+	}{
+		{"vax-one", Float32ToVAXF, Float32FromVAXF, 1, 0x40800000, nil, 1},
+		{"vax-negative", Float32ToVAXF, Float32FromVAXF, -2.5, 0xc1200000, nil, -2.5},
+		{"vax-zero", Float32ToVAXF, Float32FromVAXF, 0, 0, nil, 0},
+		{"vax-negative-zero", Float32ToVAXF, Float32FromVAXF, float32(math.Copysign(0, -1)), 0, nil, 0},
+		{"vax-max", Float32ToVAXF, Float32FromVAXF, math.MaxFloat32, 0x7fffffff, ErrFloatOverflow, 1.7014117e+38},
+		{"vax-negative-inf", Float32ToVAXF, Float32FromVAXF, float32(math.Inf(-1)), 0xffffffff, ErrFloatOverflow, -1.7014117e+38},
+		{"vax-underflow", Float32ToVAXF, Float32FromVAXF, math.SmallestNonzeroFloat32, 0, nil, 0},
+		{"ibm-one", Float32ToIBM, Float32FromIBM, 1, 0x41100000, nil, 1},
+		{"ibm-negative", Float32ToIBM, Float32FromIBM, -118.625, 0xc276a000, nil, -118.625},
+		{"ibm-max", Float32ToIBM, Float32FromIBM, math.MaxFloat32, 0x60ffffff, nil, math.MaxFloat32},
+		{"ibm-inf", Float32ToIBM, Float32FromIBM, float32(math.Inf(1)), 0x7fffffff, ErrFloatOverflow, float32(math.Inf(1))},
+		{"ibm-nan", Float32ToIBM, Float32FromIBM, float32(math.NaN()), 0, ErrFloatNaN, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bits, err := tt.to(tt.in)
+			if err != tt.err {
+				t.Errorf("unexpected error: got %v, want %v", err, tt.err)
+			}
+			if bits != tt.bits {
+				t.Errorf("unexpected bits: got %#08x, want %#08x", bits, tt.bits)
+			}
+			if out := tt.from(bits); out != tt.out {
+				t.Errorf("unexpected value: got %v, want %v", out, tt.out)
+			}
+		})
+	}
+}
+
+func TestFloat64Bits(t *testing.T) {
+	tests := []struct {
+		name string
+		to   func(float64) (uint64, error)
+		from func(uint64) float64
+		in   float64
+		bits uint64
+		err  error
+		out  float64
+	}{
+		{"vax-one", Float64ToVAXG, Float64FromVAXG, 1, 0x4010000000000000, nil, 1},
+		{"vax-negative", Float64ToVAXG, Float64FromVAXG, -2.5, 0xc024000000000000, nil, -2.5},
+		{"vax-inf", Float64ToVAXG, Float64FromVAXG, math.Inf(1), 0x7fffffffffffffff, ErrFloatOverflow, 8.988465674311579e+307},
+		{"ibm-one", Float64ToIBM, Float64FromIBM, 1, 0x4110000000000000, nil, 1},
+		{"ibm-negative", Float64ToIBM, Float64FromIBM, -118.625, 0xc276a00000000000, nil, -118.625},
+		{"ibm-overflow", Float64ToIBM, Float64FromIBM, 0x1p252, 0x7fffffffffffffff, ErrFloatOverflow, 0x1p252 - 0x1p196},
+		{"cray-one", Float64ToCray, Float64FromCray, 1, 0x4001800000000000, nil, 1},
+		{"cray-negative", Float64ToCray, Float64FromCray, -2.5, 0xc002a00000000000, nil, -2.5},
+		{"cray-zero", Float64ToCray, Float64FromCray, 0, 0, nil, 0},
+		{"cray-nan", Float64ToCray, Float64FromCray, math.NaN(), 0, ErrFloatNaN, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bits, err := tt.to(tt.in)
+			if err != tt.err {
+				t.Errorf("unexpected error: got %v, want %v", err, tt.err)
+			}
+			if bits != tt.bits {
+				t.Errorf("unexpected bits: got %#016x, want %#016x", bits, tt.bits)
+			}
+			if out := tt.from(bits); out != tt.out {
+				t.Errorf("unexpected value: got %v, want %v", out, tt.out)
+			}
+		})
+	}
+}
+
+func TestVAXReservedOperand(t *testing.T) {
+	if bits, err := Float32ToVAXF(float32(math.NaN())); bits != 0x80000000 || err != nil {
+		t.Errorf("unexpected F_floating NaN: got %#08x, %v", bits, err)
+	}
+	if v := Float32FromVAXF(0x80000000); !math.IsNaN(float64(v)) {
+		t.Errorf("unexpected F_floating reserved operand: got %v, want NaN", v)
+	}
+	if bits, err := Float64ToVAXG(math.NaN()); bits != 0x8000000000000000 || err != nil {
+		t.Errorf("unexpected G_floating NaN: got %#016x, %v", bits, err)
+	}
+}
+
+type floatTest struct {
+	F float32
+	D float64
+}
+
+func TestEncodeFloat(t *testing.T) {
+	tests := []struct {
+		name   string
+		format formatlabel.Format
+		out    []byte
+	}{
+		{"be-ieee", formatlabel.BEAIEEE, []byte{
+			0xc0, 0x20, 0x00, 0x00, 0, 0, 0, 0,
+			0x3f, 0xf0, 0, 0, 0, 0, 0, 0,
+		}},
+		{"le-vax", formatlabel.New(formatlabel.LittleEndian, formatlabel.ASCII, formatlabel.VAX), []byte{
+			0x20, 0xc1, 0x00, 0x00, 0, 0, 0, 0,
+			0x10, 0x40, 0, 0, 0, 0, 0, 0,
+		}},
+		{"be-ibm", formatlabel.New(formatlabel.BigEndian, formatlabel.ASCII, formatlabel.IBM), []byte{
+			0xc1, 0x28, 0x00, 0x00, 0, 0, 0, 0,
+			0x41, 0x10, 0, 0, 0, 0, 0, 0,
+		}},
+		{"be-cray", formatlabel.New(formatlabel.BigEndian, formatlabel.ASCII, formatlabel.Cray), []byte{
+			0xc0, 0x02, 0xa0, 0, 0, 0, 0, 0,
+			0x40, 0x01, 0x80, 0, 0, 0, 0, 0,
+		}},
+	}
+	in := floatTest{F: -2.5, D: 1}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc, err := NewEncoder(&buf, tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := enc.Encode(&in); err != nil {
+				t.Fatalf("encoding failed: %v", err)
+			}
+			if !bytes.Equal(buf.Bytes(), tt.out) {
+				t.Fatalf("unexpected encoding: got % x, want % x", buf.Bytes(), tt.out)
+			}
+			var out floatTest
+			dec, err := NewDecoder(&buf, tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := dec.Decode(&out); err != nil {
+				t.Fatalf("decoding failed: %v", err)
+			}
+			if out != in {
+				t.Fatalf("unexpected round trip: got %+v, want %+v", out, in)
+			}
+		})
+	}
+}
+
+func TestEncodeFloatOverflow(t *testing.T) {
+	var buf bytes.Buffer
+	enc, _ := NewEncoder(&buf, formatlabel.New(formatlabel.LittleEndian, formatlabel.ASCII, formatlabel.VAX))
+	if err := enc.Encode(&floatTest{F: float32(math.Inf(1))}); err == nil {
+		t.Fatal("encoding an infinity as VAX succeeded, want an error")
+	}
+}
@@ -0,0 +1,109 @@
+package ndr
+
+import "reflect"
+
+// NDRMarshaler is the interface implemented by types that encode themselves
+// in NDR. It allows types such as FILETIME, SID, GUID and RPC_UNICODE_STRING
+// to have hand-tuned encodings. Encoding functions that are compiled for a
+// type that implements NDRMarshaler call its MarshalNDR method instead of
+// encoding the type by reflection.
+//
+// The same method is called by the NDR and NDR64 encoders. Primitives written
+// to w are aligned to their size by the writer.
+type NDRMarshaler interface {
+	MarshalNDR(w Writer, s *State) error
+}
+
+// NDRUnmarshaler is the interface implemented by types that decode
+// themselves from NDR. It is the counterpart of NDRMarshaler. UnmarshalNDR is
+// usually implemented with a pointer receiver, and is called on the address
+// of the value being decoded.
+type NDRUnmarshaler interface {
+	UnmarshalNDR(r Reader, s *State) error
+}
+
+// NDRAligner is the interface implemented by types that implement
+// NDRMarshaler or NDRUnmarshaler and have an alignment requirement. AlignNDR
+// returns the alignment of the type in octets, which is the largest alignment
+// of the primitives in its representation.
+//
+// The representation of the type is aligned before it is encoded or decoded,
+// and the alignment contributes to that of the structs that contain it, so
+// that custom types compose correctly inside structs. Types that do not
+// implement NDRAligner have an alignment of 1.
+type NDRAligner interface {
+	AlignNDR() int
+}
+
+var (
+	marshalerType   = reflect.TypeOf((*NDRMarshaler)(nil)).Elem()
+	unmarshalerType = reflect.TypeOf((*NDRUnmarshaler)(nil)).Elem()
+	alignerType     = reflect.TypeOf((*NDRAligner)(nil)).Elem()
+)
+
+// EncOpForMarshaler returns an NDR encoding function for the given type, if
+// it or a pointer to it implements NDRMarshaler, otherwise it returns nil.
+//
+// If only a pointer to the type implements NDRMarshaler and the encoded value
+// is not addressable, the value is copied so that its method can be called.
+func EncOpForMarshaler(rt reflect.Type) EncOp {
+	ptr := false
+	switch {
+	case rt.Implements(marshalerType):
+	case reflect.PtrTo(rt).Implements(marshalerType):
+		ptr = true
+	default:
+		return nil
+	}
+	alignment := MarshalerAlignment(rt)
+	return func(w Writer, s *State, v reflect.Value) {
+		if ptr {
+			if !v.CanAddr() {
+				c := reflect.New(rt).Elem()
+				c.Set(v)
+				v = c
+			}
+			v = v.Addr()
+		}
+		w.Align(alignment)
+		if err := v.Interface().(NDRMarshaler).MarshalNDR(w, s); err != nil {
+			s.AddError(err)
+		}
+	}
+}
+
+// DecOpForUnmarshaler returns an NDR decoding function for the given type, if
+// a pointer to it implements NDRUnmarshaler, otherwise it returns nil. The
+// decoding function must be called with addressable values.
+func DecOpForUnmarshaler(rt reflect.Type) DecOp {
+	if !reflect.PtrTo(rt).Implements(unmarshalerType) {
+		return nil
+	}
+	alignment := MarshalerAlignment(rt)
+	return func(r Reader, s *State, v reflect.Value) error {
+		if err := r.Align(alignment); err != nil {
+			return err
+		}
+		return v.Addr().Interface().(NDRUnmarshaler).UnmarshalNDR(r, s)
+	}
+}
+
+// MarshalerAlignment returns the alignment of the given type in octets, as
+// declared by its AlignNDR method. If neither the type nor a pointer to it
+// implements NDRAligner, it returns 1.
+func MarshalerAlignment(rt reflect.Type) int {
+	switch {
+	case rt.Implements(alignerType):
+		return reflect.Zero(rt).Interface().(NDRAligner).AlignNDR()
+	case reflect.PtrTo(rt).Implements(alignerType):
+		return reflect.New(rt).Interface().(NDRAligner).AlignNDR()
+	}
+	return 1
+}
+
+// IsMarshaler returns true if the given type or a pointer to it implements
+// NDRMarshaler or NDRUnmarshaler.
+func IsMarshaler(rt reflect.Type) bool {
+	pt := reflect.PtrTo(rt)
+	return rt.Implements(marshalerType) || pt.Implements(marshalerType) || pt.Implements(unmarshalerType)
+}
@@ -0,0 +1,71 @@
+package ndr
+
+import (
+	"reflect"
+
+	"github.com/gentlemanautomaton/dcerpc/idl/types"
+)
+
+// IsParamList returns true if the given type is a struct that holds the
+// parameters of an operation rather than the members of an IDL struct. Its
+// fields are marked with the in or out attribute.
+//
+// Parameters are not aligned as a struct. Each parameter is encoded with its
+// conformance in place, and is followed by the referents of the pointers it
+// contains. A parameter that is a unique or full pointer is encoded as a
+// referent identifier followed by its referent.
+func IsParamList(rt reflect.Type) bool {
+	if rt.Kind() != reflect.Struct || IsMarshaler(rt) {
+		return false
+	}
+	for i := 0; i < rt.NumField(); i++ {
+		attrs := types.ParseFieldAttrList(rt.Field(i).Tag.Get("idl"))
+		if attrs.Contains("in", "out") {
+			return true
+		}
+	}
+	return false
+}
+
+// EncOpForParams returns an NDR encoding function for the given type, which
+// must be a parameter list.
+func EncOpForParams(rt reflect.Type) EncOp {
+	engine := make([]encInstr, 0, rt.NumField())
+	for i := 0; i < rt.NumField(); i++ {
+		if instr, ok := encInstrForField(rt, rt.Field(i), true); ok {
+			engine = append(engine, instr)
+		}
+	}
+	return func(w Writer, s *State, v reflect.Value) {
+		for i := 0; i < len(engine); i++ {
+			instr := &engine[i]
+			instr.op(w, s, v.FieldByIndex(instr.index))
+			if err := s.Flush(); err != nil {
+				s.AddError(err)
+			}
+		}
+	}
+}
+
+// DecOpForParams returns an NDR decoding function for the given type, which
+// must be a parameter list.
+func DecOpForParams(rt reflect.Type) DecOp {
+	engine := make([]decInstr, 0, rt.NumField())
+	for i := 0; i < rt.NumField(); i++ {
+		if instr, ok := decInstrForField(rt, rt.Field(i), true); ok {
+			engine = append(engine, instr)
+		}
+	}
+	return func(r Reader, s *State, v reflect.Value) error {
+		for i := 0; i < len(engine); i++ {
+			instr := &engine[i]
+			if err := instr.op(r, s, v.FieldByIndex(instr.index)); err != nil {
+				return err
+			}
+			if err := s.Flush(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,145 @@
+package ndr
+
+import "reflect"
+
+// Pipes are represented by channels of their element type. A pipe is
+// transmitted as a sequence of chunks, each of which holds a count followed
+// by that many elements, and is terminated by an empty chunk. Pipes are
+// transmitted after the other [in] parameters of a call and before the other
+// [out] parameters, so structs that hold parameters should declare their
+// pipes accordingly.
+
+// PipeChunkSize is the largest number of elements transmitted in a chunk of
+// a pipe.
+const PipeChunkSize = 1024
+
+// IsPipe returns true if the given type represents a pipe, which is a
+// bidirectional channel.
+func IsPipe(rt reflect.Type) bool {
+	return rt.Kind() == reflect.Chan && rt.ChanDir() == reflect.BothDir
+}
+
+// HasPipes returns true if the given type is a pipe or a struct with pipe
+// fields.
+func HasPipes(rt reflect.Type) bool {
+	if IsPipe(rt) {
+		return true
+	}
+	if rt.Kind() != reflect.Struct {
+		return false
+	}
+	for i := 0; i < rt.NumField(); i++ {
+		if IsPipe(rt.Field(i).Type) {
+			return true
+		}
+	}
+	return false
+}
+
+// EncPipeChunks encodes the elements received from the channel v in chunks,
+// each of which is preceded by its count as written by count. Elements that
+// have already been sent are transmitted in the same chunk, up to
+// PipeChunkSize of them, so that a chunk is sent whenever the sender pauses.
+// The pipe ends when the channel is closed. A nil channel is an empty pipe.
+func EncPipeChunks(w Writer, s *State, v reflect.Value, elemOp EncOp, count func(w Writer, n int)) {
+	if !v.IsNil() {
+		chunk := make([]reflect.Value, 0, PipeChunkSize)
+		for {
+			x, ok := v.Recv()
+			if !ok {
+				break
+			}
+			chunk = append(chunk[:0], x)
+			for len(chunk) < PipeChunkSize {
+				x, ok := v.TryRecv()
+				if !ok {
+					break
+				}
+				chunk = append(chunk, x)
+			}
+			count(w, len(chunk))
+			for _, x := range chunk {
+				elemOp(w, s, x)
+			}
+		}
+	}
+	count(w, 0)
+}
+
+// DecPipeChunks decodes the chunks of a pipe, each of which is preceded by
+// its count as read by count, and sends their elements on the channel v. The
+// channel is closed when the empty chunk that terminates the pipe is decoded,
+// or when decoding fails.
+//
+// If v is nil, the elements are collected and v is set to a closed channel
+// that buffers all of them. Otherwise each element is sent as soon as it is
+// decoded, which blocks until it is received.
+func DecPipeChunks(r Reader, s *State, v reflect.Value, elemOp DecOp, count func(r Reader) (int, error)) error {
+	buffered := v.IsNil()
+	if !buffered {
+		defer v.Close()
+	}
+	var elems []reflect.Value
+	for {
+		n, err := count(r)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+		for i := 0; i < n; i++ {
+			x := reflect.New(v.Type().Elem()).Elem()
+			if err := elemOp(r, s, x); err != nil {
+				return err
+			}
+			if buffered {
+				elems = append(elems, x)
+			} else {
+				v.Send(x)
+			}
+		}
+	}
+	if buffered {
+		ch := reflect.MakeChan(v.Type(), len(elems))
+		for _, x := range elems {
+			ch.Send(x)
+		}
+		ch.Close()
+		v.Set(ch)
+	}
+	return nil
+}
+
+// EncOpForPipe returns an NDR encoding function for the given type, which
+// must be a pipe. Chunk counts are 32 bits wide.
+func EncOpForPipe(rt reflect.Type) EncOp {
+	elemOp := EncOpFor(rt.Elem())
+	if elemOp == nil {
+		return nil
+	}
+	return func(w Writer, s *State, v reflect.Value) {
+		EncPipeChunks(w, s, v, elemOp, encPipeCount)
+	}
+}
+
+// DecOpForPipe returns an NDR decoding function for the given type, which
+// must be a pipe.
+func DecOpForPipe(rt reflect.Type) DecOp {
+	elemOp := DecOpFor(rt.Elem())
+	if elemOp == nil {
+		return nil
+	}
+	return func(r Reader, s *State, v reflect.Value) error {
+		return DecPipeChunks(r, s, v, elemOp, decPipeCount)
+	}
+}
+
+func encPipeCount(w Writer, n int) {
+	w.WriteUint32(uint32(n))
+}
+
+func decPipeCount(r Reader) (int, error) {
+	n, err := r.ReadUint32()
+	return int(n), err
+}
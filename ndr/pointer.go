@@ -0,0 +1,277 @@
+package ndr
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/gentlemanautomaton/dcerpc/idl/types"
+)
+
+// Pointer kinds, which are named by the pointer attributes of IDL.
+const (
+	RefPointer    = "ref"
+	UniquePointer = "unique"
+	FullPointer   = "ptr"
+)
+
+// referentBase is the first referent identifier that is transmitted. Like
+// other implementations, identifiers start at 0x20000 and increase by 4.
+const referentBase = 0x00020000
+
+// PointerKind returns the kind of pointer that is described by the given
+// attributes. Pointers without a pointer attribute are unique pointers.
+func PointerKind(attrs types.FieldAttrList) string {
+	switch {
+	case attrs.Contains(RefPointer):
+		return RefPointer
+	case attrs.Contains(FullPointer):
+		return FullPointer
+	}
+	return UniquePointer
+}
+
+// IsPointerField returns true if the given attributes declare a field that
+// refers to its value through an embedded pointer. Slices and strings are
+// held in place unless they have a pointer attribute, and Go pointers always
+// represent IDL pointers.
+func IsPointerField(attrs types.FieldAttrList) bool {
+	return attrs.Contains(RefPointer, UniquePointer, FullPointer)
+}
+
+// referentID returns the transmitted form of a referent identifier allocated
+// by State.
+func referentID(refID uint64) uint32 {
+	return uint32(referentBase + 4*(refID-1))
+}
+
+// EncNullPointer is an NDR encoding function for a pointer that is always
+// transmitted as null, such as a pointer with the ignore attribute.
+func EncNullPointer(w Writer, s *State, v reflect.Value) {
+	w.WriteUint32(0)
+}
+
+// DecNullPointer is an NDR decoding function for a pointer whose referent is
+// not transmitted. The received pointer is discarded.
+func DecNullPointer(r Reader, s *State, v reflect.Value) error {
+	_, err := r.ReadUint32()
+	return err
+}
+
+// EncOpForPointer returns an NDR encoding function for the given type, which
+// must be a pointer, with the given kind. The function encodes the referent
+// identifier of an embedded pointer and defers the encoding of its referent.
+// A full pointer to a referent that has already been encoded refers to it
+// instead. Pointers nested within the referent are unique pointers.
+func EncOpForPointer(rt reflect.Type, kind string) EncOp {
+	var (
+		once   sync.Once
+		elemOp EncOp
+	)
+	// The referent is compiled when it is first encoded, so that types may
+	// refer to themselves.
+	compile := func() {
+		elemOp = EncOpFor(rt.Elem())
+		if elemOp == nil {
+			elemOp = EncOpForError(NewEncodingError(Unsupported, rt.Elem().String(), "", "a type without an encoding", 0, 0))
+		}
+	}
+	return func(w Writer, s *State, v reflect.Value) {
+		if v.IsNil() {
+			if kind == RefPointer {
+				s.AddError(NewEncodingError(NullReference, rt.String(), "", "", 0, 0))
+			}
+			w.WriteUint32(0)
+			return
+		}
+		if kind == FullPointer {
+			p := v.Interface()
+			registered := s.Registered(p)
+			w.WriteUint32(referentID(s.Register(p)))
+			if registered {
+				return
+			}
+		} else {
+			w.WriteUint32(referentID(s.NewReferent()))
+		}
+		s.Defer(func() error {
+			once.Do(compile)
+			elemOp(w, s, v.Elem())
+			return nil
+		})
+	}
+}
+
+// DecOpForPointer returns an NDR decoding function for the given type, which
+// must be a pointer, with the given kind. It is the counterpart of
+// EncOpForPointer. The referent is allocated when the pointer is decoded and
+// is decoded when the decoder state is flushed.
+func DecOpForPointer(rt reflect.Type, kind string) DecOp {
+	var (
+		once   sync.Once
+		elemOp DecOp
+	)
+	compile := func() {
+		elemOp = DecOpFor(rt.Elem())
+		if elemOp == nil {
+			elemOp = DecOpForError(NewEncodingError(Unsupported, rt.Elem().String(), "", "a type without an encoding", 0, 0))
+		}
+	}
+	return func(r Reader, s *State, v reflect.Value) error {
+		id, err := r.ReadUint32()
+		if err != nil {
+			return err
+		}
+		if id == 0 {
+			if kind == RefPointer {
+				return NewDecodingError(UnexpectedNull, rt.String(), "", 0, 0)
+			}
+			v.Set(reflect.Zero(rt))
+			return nil
+		}
+		if kind == FullPointer {
+			if p, ok := s.Resolve(uint64(id)); ok {
+				v.Set(reflect.ValueOf(p))
+				return nil
+			}
+		}
+		p := reflect.New(rt.Elem())
+		v.Set(p)
+		if kind == FullPointer {
+			s.Bind(uint64(id), p.Interface())
+		}
+		s.Defer(func() error {
+			once.Do(compile)
+			return elemOp(r, s, p.Elem())
+		})
+		return nil
+	}
+}
+
+// EncOpForStringPointer returns an NDR encoding function for an embedded
+// pointer of the given kind to a string, which is held in a Go string. The
+// string is encoded as a conformant and varying string of narrow characters
+// if narrow is true, or of wide characters. An empty string is transmitted
+// as a null pointer, unless the pointer is a reference pointer.
+func EncOpForStringPointer(narrow bool, kind string) EncOp {
+	str := EncOp(EncConformantVaryingWideString)
+	if narrow {
+		str = EncConformantVaryingString
+	}
+	return func(w Writer, s *State, v reflect.Value) {
+		if v.Len() == 0 && kind != RefPointer {
+			w.WriteUint32(0)
+			return
+		}
+		w.WriteUint32(referentID(s.NewReferent()))
+		s.Defer(func() error {
+			str(w, s, v)
+			return nil
+		})
+	}
+}
+
+// DecOpForStringPointer returns an NDR decoding function for the given field,
+// which holds a string that is referred to by an embedded pointer of the
+// given kind. It is the counterpart of EncOpForStringPointer. A null pointer
+// is decoded as an empty string.
+func DecOpForStringPointer(rf reflect.StructField, narrow bool, kind string) DecOp {
+	str := DecOpForConformantVaryingWideString(rf)
+	if narrow {
+		str = DecOpForConformantVaryingString(rf)
+	}
+	return func(r Reader, s *State, v reflect.Value) error {
+		id, err := r.ReadUint32()
+		if err != nil {
+			return err
+		}
+		if id == 0 {
+			if kind == RefPointer {
+				return NewDecodingError(UnexpectedNull, "", rf.Name, 0, 0)
+			}
+			v.SetString("")
+			return nil
+		}
+		s.Defer(func() error {
+			return str(r, s, v)
+		})
+		return nil
+	}
+}
+
+// EncOpForArrayPointer returns an NDR encoding function for the given field of
+// base, which must be a slice with bounds attributes and a pointer attribute.
+// The encoding function operates on values of the base type. It encodes the
+// referent identifier of the pointer and defers the encoding of the array,
+// whose conformance precedes its elements. A nil slice is transmitted as a
+// null pointer, unless the pointer is a reference pointer.
+func EncOpForArrayPointer(base reflect.Type, field reflect.StructField, attrs types.FieldAttrList) EncOp {
+	array := encOpForBoundedField(base, field, attrs, true)
+	kind := PointerKind(attrs)
+	return func(w Writer, s *State, v reflect.Value) {
+		if v.FieldByIndex(field.Index).IsNil() && kind != RefPointer {
+			w.WriteUint32(0)
+			return
+		}
+		w.WriteUint32(referentID(s.NewReferent()))
+		s.Defer(func() error {
+			array(w, s, v)
+			return nil
+		})
+	}
+}
+
+// DecOpForArrayPointer returns an NDR decoding function for the given field of
+// base, which is the counterpart of EncOpForArrayPointer. A null pointer is
+// decoded as a nil slice.
+func DecOpForArrayPointer(base reflect.Type, field reflect.StructField, attrs types.FieldAttrList) DecOp {
+	array := decOpForBoundedField(base, field, attrs, true)
+	kind := PointerKind(attrs)
+	return func(r Reader, s *State, v reflect.Value) error {
+		id, err := r.ReadUint32()
+		if err != nil {
+			return err
+		}
+		if id == 0 {
+			if kind == RefPointer {
+				return NewDecodingError(UnexpectedNull, base.Name(), field.Name, 0, 0)
+			}
+			f := v.FieldByIndex(field.Index)
+			f.Set(reflect.Zero(f.Type()))
+			return nil
+		}
+		s.Defer(func() error {
+			return array(r, s, v)
+		})
+		return nil
+	}
+}
+
+// HasReferents returns true if values of the given type may hold embedded
+// pointers, whose referents are decoded after the values that hold them.
+func HasReferents(rt reflect.Type) bool {
+	return hasReferents(rt, make(map[reflect.Type]bool))
+}
+
+func hasReferents(rt reflect.Type, visited map[reflect.Type]bool) bool {
+	if visited[rt] || IsMarshaler(rt) {
+		return false
+	}
+	visited[rt] = true
+	switch rt.Kind() {
+	case reflect.Ptr, reflect.String:
+		// Strings that are not held in place by a field are referred to by
+		// pointers.
+		return true
+	case reflect.Array, reflect.Slice:
+		return hasReferents(rt.Elem(), visited)
+	case reflect.Struct:
+		for i := 0; i < rt.NumField(); i++ {
+			f := rt.Field(i)
+			attrs := types.ParseFieldAttrList(f.Tag.Get("idl"))
+			if IsPointerField(attrs) || hasReferents(f.Type, visited) {
+				return true
+			}
+		}
+	}
+	return false
+}
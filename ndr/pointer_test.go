@@ -0,0 +1,348 @@
+package ndr
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/gentlemanautomaton/dcerpc/formatlabel"
+)
+
+type ptrTest1 struct {
+	A *uint16 `idl:"unique"`
+	B *ptrTest2
+	C uint32
+	D *uint32
+}
+
+type ptrTest2 struct {
+	N uint8
+	P *uint32
+}
+
+type ptrTest3 struct {
+	R *uint32 `idl:"ref"`
+	U *uint32
+}
+
+type ptrTest4 struct {
+	A *uint32 `idl:"ptr"`
+	B *uint32 `idl:"ptr"`
+}
+
+type ptrTest5 struct {
+	Value uint32
+	Next  *ptrTest5
+}
+
+// ptrUnicodeString is laid out like RPC_UNICODE_STRING.
+type ptrUnicodeString struct {
+	Length        uint16
+	MaximumLength uint16
+	Buffer        []uint16 `idl:"size_is(MaximumLength/2),length_is(Length/2),unique"`
+}
+
+type ptrTest6 struct {
+	Name  string `idl:"string,unique"`
+	Empty string `idl:"string,unique"`
+}
+
+type ptrTest7 struct {
+	Name [8]uint16 `idl:"string"`
+}
+
+type ptrTest8 struct {
+	A uint8
+	B ptrTest9
+}
+
+type ptrTest9 struct {
+	X uint8
+	Y uint32
+}
+
+type ptrTest10 struct {
+	Skip  uint32 `idl:"-"`
+	Value uint16
+}
+
+// unionTest is a union of a short, a long and a string, with an empty
+// default arm.
+type unionTest struct {
+	Kind  uint16
+	Short int16    `idl:"case(1)"`
+	Long  int32    `idl:"case(2,3)"`
+	Name  string   `idl:"case(4),string,unique"`
+	_     struct{} `idl:"default"`
+}
+
+type unionTest1 struct {
+	Level uint16
+	Info  unionTest `idl:"switch_is(Level)"`
+}
+
+type unionTest2 struct {
+	Level uint32
+	Info  *unionTest `idl:"switch_is(Level)"`
+}
+
+type paramTest struct {
+	N    uint32   `idl:"in"`
+	Data []uint16 `idl:"in,size_is(N)"`
+	P    *uint32  `idl:"in,unique"`
+	S    string   `idl:"in,string"`
+}
+
+func ptr16(x uint16) *uint16 { return &x }
+func ptr32(x uint32) *uint32 { return &x }
+
+func TestEncodeReferents(t *testing.T) {
+	shared := ptr32(42)
+	tests := []struct {
+		name string
+		in   interface{}
+		want []byte
+	}{
+		{
+			name: "depth-first",
+			in:   &ptrTest1{A: ptr16(5), B: &ptrTest2{N: 7, P: ptr32(9)}, C: 3, D: ptr32(11)},
+			want: []byte{
+				0, 0, 2, 0, // Referent ID of A
+				4, 0, 2, 0, // Referent ID of B
+				3, 0, 0, 0, // C
+				8, 0, 2, 0, // Referent ID of D
+				5, 0, // *A
+				0, 0, // Padding
+				7,       // B.N
+				0, 0, 0, // Padding
+				12, 0, 2, 0, // Referent ID of B.P
+				9, 0, 0, 0, // *B.P
+				11, 0, 0, 0, // *D
+			},
+		},
+		{
+			name: "null",
+			in:   &ptrTest3{R: ptr32(1)},
+			want: []byte{
+				0, 0, 2, 0, // Referent ID of R
+				0, 0, 0, 0, // Null U
+				1, 0, 0, 0, // *R
+			},
+		},
+		{
+			name: "full",
+			in:   &ptrTest4{A: shared, B: shared},
+			want: []byte{
+				0, 0, 2, 0, // Referent ID of A
+				0, 0, 2, 0, // Referent ID of B
+				42, 0, 0, 0, // *A
+			},
+		},
+		{
+			name: "recursive",
+			in:   &ptrTest5{Value: 1, Next: &ptrTest5{Value: 2, Next: &ptrTest5{Value: 3}}},
+			want: []byte{
+				1, 0, 0, 0, 0, 0, 2, 0,
+				2, 0, 0, 0, 4, 0, 2, 0,
+				3, 0, 0, 0, 0, 0, 0, 0,
+			},
+		},
+		{
+			name: "array-pointer",
+			in:   &ptrUnicodeString{Length: 4, MaximumLength: 6, Buffer: []uint16{'h', 'i'}},
+			want: []byte{
+				4, 0, // Length
+				6, 0, // MaximumLength
+				0, 0, 2, 0, // Referent ID of Buffer
+				3, 0, 0, 0, // Max count
+				0, 0, 0, 0, // Offset
+				2, 0, 0, 0, // Actual count
+				'h', 0, 'i', 0,
+			},
+		},
+		{
+			name: "string-pointer",
+			in:   &ptrTest6{Name: "hé"},
+			want: []byte{
+				0, 0, 2, 0, // Referent ID of Name
+				0, 0, 0, 0, // Null Empty
+				3, 0, 0, 0, 0, 0, 0, 0, 3, 0, 0, 0,
+				'h', 0, 0xe9, 0, 0, 0,
+			},
+		},
+		{
+			name: "fixed-string",
+			in:   &ptrTest7{Name: [8]uint16{'a', 'b'}},
+			want: []byte{
+				0, 0, 0, 0, // Offset
+				3, 0, 0, 0, // Actual count
+				'a', 0, 'b', 0, 0, 0,
+			},
+		},
+		{
+			name: "struct-alignment",
+			in:   &ptrTest8{A: 1, B: ptrTest9{X: 2, Y: 3}},
+			want: []byte{
+				1,       // A
+				0, 0, 0, // Padding
+				2,       // B.X
+				0, 0, 0, // Padding
+				3, 0, 0, 0, // B.Y
+			},
+		},
+		{
+			name: "skipped",
+			in:   &ptrTest10{Skip: 1, Value: 2},
+			want: []byte{2, 0},
+		},
+		{
+			name: "union",
+			in:   &unionTest{Kind: 2, Long: -1},
+			want: []byte{
+				2, 0, // Kind
+				0, 0, // Padding
+				0xff, 0xff, 0xff, 0xff, // Long
+			},
+		},
+		{
+			name: "union-string",
+			in:   &unionTest{Kind: 4, Name: "a"},
+			want: []byte{
+				4, 0, // Kind
+				0, 0, // Padding
+				0, 0, 2, 0, // Referent ID of Name
+				2, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0,
+				'a', 0, 0, 0,
+			},
+		},
+		{
+			name: "union-default",
+			in:   &unionTest{Kind: 9},
+			want: []byte{9, 0},
+		},
+		{
+			name: "switch-is",
+			in:   &unionTest1{Level: 1, Info: unionTest{Kind: 1, Short: 5}},
+			want: []byte{
+				1, 0, // Level
+				1, 0, // Discriminant
+				5, 0, // Short
+			},
+		},
+		{
+			name: "switch-is-pointer",
+			in:   &unionTest2{Level: 2, Info: &unionTest{Kind: 2, Long: 7}},
+			want: []byte{
+				2, 0, 0, 0, // Level
+				0, 0, 2, 0, // Referent ID of Info
+				2, 0, // Discriminant
+				0, 0, // Padding
+				7, 0, 0, 0, // Long
+			},
+		},
+		{
+			name: "params",
+			in:   &paramTest{N: 2, Data: []uint16{1, 2}, P: ptr32(9), S: "a"},
+			want: []byte{
+				2, 0, 0, 0, // N
+				2, 0, 0, 0, // Max count of Data
+				1, 0, 2, 0,
+				0, 0, 2, 0, // Referent ID of P
+				9, 0, 0, 0, // *P
+				2, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0,
+				'a', 0, 0, 0,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc, _ := NewEncoder(&buf, formatlabel.LEAIEEE)
+			if err := enc.Encode(tt.in); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), tt.want) {
+				t.Fatalf("encoded % x, want % x", buf.Bytes(), tt.want)
+			}
+
+			out := reflect.New(reflect.TypeOf(tt.in).Elem())
+			dec, _ := NewDecoder(&buf, formatlabel.LEAIEEE)
+			if err := dec.Decode(out.Interface()); err != nil {
+				t.Fatal(err)
+			}
+			var again bytes.Buffer
+			enc, _ = NewEncoder(&again, formatlabel.LEAIEEE)
+			if err := enc.Encode(out.Interface()); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(again.Bytes(), tt.want) {
+				t.Fatalf("decoded value %+v encoded as % x", out.Elem().Interface(), again.Bytes())
+			}
+		})
+	}
+}
+
+func TestDecodeReferents(t *testing.T) {
+	in := []byte{0, 0, 2, 0, 0, 0, 2, 0, 42, 0, 0, 0}
+	dec, _ := NewDecoder(bytes.NewReader(in), formatlabel.LEAIEEE)
+	var full ptrTest4
+	if err := dec.Decode(&full); err != nil {
+		t.Fatal(err)
+	}
+	if full.A == nil || full.A != full.B || *full.A != 42 {
+		t.Fatalf("decoded full pointers %p and %p", full.A, full.B)
+	}
+
+	in = []byte{3, 0, 3, 0, 7, 0, 0, 0}
+	dec, _ = NewDecoder(bytes.NewReader(in), formatlabel.LEAIEEE)
+	var union unionTest1
+	if err := dec.Decode(&union); err != nil {
+		t.Fatal(err)
+	}
+	if union.Info.Kind != 3 || union.Info.Long != 7 {
+		t.Fatalf("decoded union %+v", union.Info)
+	}
+
+	tests := []struct {
+		name string
+		in   []byte
+		out  interface{}
+		code int
+	}{
+		{"null-ref", []byte{0, 0, 0, 0, 0, 0, 0, 0}, &ptrTest3{}, UnexpectedNull},
+		{"discriminant-mismatch", []byte{1, 0, 2, 0, 5, 0, 0, 0}, &unionTest1{}, DiscriminantMismatch},
+		{"invalid-discriminant", []byte{5, 0}, &struct {
+			Kind uint16
+			Long int32 `idl:"case(2)"`
+		}{}, InvalidDiscriminant},
+	}
+	for _, tt := range tests {
+		dec, _ := NewDecoder(bytes.NewReader(tt.in), formatlabel.LEAIEEE)
+		err := dec.Decode(tt.out)
+		if e, ok := err.(*DecodingError); !ok || e.Code != tt.code {
+			t.Errorf("%s: Decode returned %v, want code %d", tt.name, err, tt.code)
+		}
+	}
+}
+
+func TestEncodeReferentErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   interface{}
+		code int
+	}{
+		{"null-ref", &ptrTest3{}, NullReference},
+		{"no-arm", &struct {
+			Kind uint16
+			Long int32 `idl:"case(2)"`
+		}{Kind: 5}, NoUnionArm},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		enc, _ := NewEncoder(&buf, formatlabel.LEAIEEE)
+		err := enc.Encode(tt.in)
+		if e, ok := err.(*EncodingError); !ok || e.Code != tt.code {
+			t.Errorf("%s: Encode returned %v, want code %d", tt.name, err, tt.code)
+		}
+	}
+}
@@ -1,26 +1,33 @@
 package ndr
 
 import (
-	"errors"
+	"bytes"
 	"io"
+	"math"
 
 	"github.com/gentlemanautomaton/dcerpc/formatlabel"
 )
 
 const readerBufLen = 16
 
+// maxPrealloc is the largest number of octets or elements that is allocated
+// for received data before it has arrived, when the amount of data that
+// remains cannot be determined.
+const maxPrealloc = 4096
+
 // A Reader is capable of reading all NDR primitive types.
 type Reader interface {
 	Offset() uint64
+	Remaining() (n int, ok bool)
 	Skip(count int) (err error)
 	Align(modulo int) (err error)
 	Read(p []byte) (n int, err error)
 	ReadFull(p []byte) (err error)
 	ReadByte() (v byte, err error)
 	ReadBool() (v bool, err error)
-	ReadASCII() (v string, err error) // FIXME: Decide whether these should write individual runes instead
-	ReadEBCDIC() (v string, err error)
-	ReadUnicode() (v string, err error)
+	ReadASCII(n int) (v string, err error) // FIXME: Decide whether these should write individual runes instead
+	ReadEBCDIC(n int) (v string, err error)
+	ReadUnicode(n int) (v string, err error)
 	ReadInt8() (v int8, err error)
 	ReadUint8() (v uint8, err error)
 
@@ -48,10 +55,17 @@ type Reader interface {
 	ReadFloat32LEIEEE() (v float32, err error)
 	ReadFloat64LEIEEE() (v float64, err error)
 
-	// TODO: Add VAX, Cray and IBM floating point representations
+	// VAX, IBM and Cray floating point representations
+	ReadFloat32VAX() (v float32, err error)
+	ReadFloat64VAX() (v float64, err error)
+	ReadFloat32IBM() (v float32, err error)
+	ReadFloat64IBM() (v float64, err error)
+	ReadFloat32Cray() (v float32, err error)
+	ReadFloat64Cray() (v float64, err error)
 
-	// Format-dependent string representations
-	ReadString() (v string, err error) // FIXME: Change to ReadCharacter instead?
+	// Format-dependent character and string representations
+	ReadChar() (v byte, err error)
+	ReadString(n int) (v string, err error)
 
 	// Format-dependent integer representations
 
@@ -82,6 +96,20 @@ func NewReader(r io.Reader, format formatlabel.Format) Reader {
 			Reader: r,
 			refs:   make(map[uintptr]uint64),
 		}}
+	case formatlabel.LEAIEEE:
+		return &readerLEAIEEE{reader{
+			Reader: r,
+			refs:   make(map[uintptr]uint64),
+		}}
+	}
+	if format.Valid() {
+		return &readerFormat{
+			reader: reader{
+				Reader: r,
+				refs:   make(map[uintptr]uint64),
+			},
+			format: format,
+		}
 	}
 	return nil
 }
@@ -102,6 +130,16 @@ func (r *reader) Offset() uint64 {
 	return r.index
 }
 
+// Remaining returns the number of octets that have not yet been read, if the
+// underlying io.Reader is able to report it, as bytes.Reader and
+// bytes.Buffer are.
+func (r *reader) Remaining() (n int, ok bool) {
+	if l, ok := r.Reader.(interface{ Len() int }); ok {
+		return l.Len(), true
+	}
+	return 0, false
+}
+
 func (r *reader) Skip(count int) (err error) {
 	// Small reads get the fast path
 	if count <= readerBufLen {
@@ -172,7 +210,7 @@ func (r *reader) ReadFull(buf []byte) (err error) {
 	n, needed := 0, len(buf)
 	for n < needed && err == nil {
 		var nn int
-		nn, err = r.Reader.Read(buf)
+		nn, err = r.Reader.Read(buf[n:])
 		n += nn
 	}
 	r.index += uint64(n)
@@ -205,20 +243,59 @@ func (r *reader) ReadBool() (v bool, err error) {
 	return true, nil
 }
 
-// TODO: Determine whether this should read individual runes instead?
-func (r *reader) ReadASCII() (v string, err error) {
-	// FIXME: Implement this
-	return
+// readBytes reads n octets. If the number of octets that remain is unknown,
+// large reads are buffered as they arrive instead of being allocated up
+// front, so that a count received from a peer cannot exhaust memory.
+func (r *reader) readBytes(n int) ([]byte, error) {
+	if n < 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if remaining, ok := r.Remaining(); ok && n > remaining {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if _, ok := r.Remaining(); ok || n <= maxPrealloc {
+		b := make([]byte, n)
+		return b, r.ReadFull(b)
+	}
+	var buf bytes.Buffer
+	read, err := io.CopyN(&buf, readerFunc(r.Read), int64(n))
+	if read < int64(n) && err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return buf.Bytes(), err
 }
 
-// TODO: Determine whether this should read individual runes instead?
-func (r *reader) ReadEBCDIC() (v string, err error) {
-	// FIXME: Implement this
-	return
+// readerFunc adapts a read function to the io.Reader interface.
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
+
+// ReadASCII reads n characters in ASCII character representation.
+func (r *reader) ReadASCII(n int) (v string, err error) {
+	b, err := r.readBytes(n)
+	if err != nil {
+		return
+	}
+	return string(b), nil
+}
+
+// ReadEBCDIC reads n characters in EBCDIC character representation and
+// returns them as ASCII.
+func (r *reader) ReadEBCDIC(n int) (v string, err error) {
+	b, err := r.readBytes(n)
+	if err != nil {
+		return
+	}
+	for i, c := range b {
+		b[i] = ebcdicToASCII[c]
+	}
+	return string(b), nil
 }
 
 // TODO: Determine whether this should read individual runes instead?
-func (r *reader) ReadUnicode() (v string, err error) {
+func (r *reader) ReadUnicode(n int) (v string, err error) {
 	// FIXME: Implement this
 	return
 }
@@ -277,7 +354,7 @@ func (r *reader) ReadUint32BE() (v uint32, err error) {
 
 func (r *reader) ReadUint64BE() (v uint64, err error) {
 	r.Align(8)
-	if err = r.ReadFull(r.buf[0:4]); err != nil {
+	if err = r.ReadFull(r.buf[0:8]); err != nil {
 		return
 	}
 	v = (uint64(r.buf[0]) << 56) |
@@ -329,7 +406,7 @@ func (r *reader) ReadUint32LE() (v uint32, err error) {
 
 func (r *reader) ReadUint64LE() (v uint64, err error) {
 	r.Align(8)
-	if err = r.ReadFull(r.buf[0:4]); err != nil {
+	if err = r.ReadFull(r.buf[0:8]); err != nil {
 		return
 	}
 	v = uint64(r.buf[0]) |
@@ -344,36 +421,85 @@ func (r *reader) ReadUint64LE() (v uint64, err error) {
 }
 
 func (r *reader) ReadFloat32BEIEEE() (v float32, err error) {
-	// TODO: Write this
-	return 0, errors.New("Not implemented")
+	u, err := r.ReadUint32BE()
+	return math.Float32frombits(u), err
 }
 
 func (r *reader) ReadFloat64BEIEEE() (v float64, err error) {
-	// TODO: Write this
-	return 0, errors.New("Not implemented")
+	u, err := r.ReadUint64BE()
+	return math.Float64frombits(u), err
 }
 
 func (r *reader) ReadFloat32LEIEEE() (v float32, err error) {
-	// TODO: Write this
-	return 0, errors.New("Not implemented")
+	u, err := r.ReadUint32LE()
+	return math.Float32frombits(u), err
 }
 
 func (r *reader) ReadFloat64LEIEEE() (v float64, err error) {
-	// TODO: Write this
-	return 0, errors.New("Not implemented")
+	u, err := r.ReadUint64LE()
+	return math.Float64frombits(u), err
+}
+
+// ReadFloat32VAX reads a value in VAX F_floating representation, which is
+// stored as two little-endian 16-bit words with the most significant word
+// first. The reserved operand is returned as NaN.
+func (r *reader) ReadFloat32VAX() (v float32, err error) {
+	u, err := r.ReadUint32LE()
+	return Float32FromVAXF(u>>16 | u<<16), err
+}
+
+// ReadFloat64VAX reads a value in VAX G_floating representation, which is
+// stored as four little-endian 16-bit words with the most significant word
+// first. The reserved operand is returned as NaN.
+func (r *reader) ReadFloat64VAX() (v float64, err error) {
+	u, err := r.ReadUint64LE()
+	return Float64FromVAXG(swapWords(u)), err
+}
+
+// ReadFloat32IBM reads a value in big-endian IBM hexadecimal single precision
+// representation.
+func (r *reader) ReadFloat32IBM() (v float32, err error) {
+	u, err := r.ReadUint32BE()
+	return Float32FromIBM(u), err
+}
+
+// ReadFloat64IBM reads a value in big-endian IBM hexadecimal double precision
+// representation.
+func (r *reader) ReadFloat64IBM() (v float64, err error) {
+	u, err := r.ReadUint64BE()
+	return Float64FromIBM(u), err
+}
+
+// ReadFloat32Cray reads a value in big-endian Cray floating point
+// representation, which occupies 8 octets. Values beyond the range of IEEE
+// single precision are returned as infinities or zero.
+func (r *reader) ReadFloat32Cray() (v float32, err error) {
+	f, err := r.ReadFloat64Cray()
+	return float32(f), err
+}
+
+// ReadFloat64Cray reads a value in big-endian Cray floating point
+// representation.
+func (r *reader) ReadFloat64Cray() (v float64, err error) {
+	u, err := r.ReadUint64BE()
+	return Float64FromCray(u), err
 }
 
 var _ = Reader((*readerBEAIEEE)(nil)) // Compile-time check for interface compliance
 
-// readerBEAIEEE writes NDR-encoded primitive data types with big-endian
+// readerBEAIEEE reads NDR-encoded primitive data types with big-endian
 // integer representation, ASCII character representation and IEEE floating
 // point representation.
 type readerBEAIEEE struct {
 	reader
 }
 
-func (r *readerBEAIEEE) ReadString() (v string, err error) {
-	return r.ReadASCII()
+func (r *readerBEAIEEE) ReadChar() (v byte, err error) {
+	return r.ReadByte()
+}
+
+func (r *readerBEAIEEE) ReadString(n int) (v string, err error) {
+	return r.ReadASCII(n)
 }
 
 func (r *readerBEAIEEE) ReadInt16() (v int16, err error) {
@@ -407,3 +533,142 @@ func (r *readerBEAIEEE) ReadFloat32() (v float32, err error) {
 func (r *readerBEAIEEE) ReadFloat64() (v float64, err error) {
 	return r.ReadFloat64BEIEEE()
 }
+
+var _ = Reader((*readerLEAIEEE)(nil)) // Compile-time check for interface compliance
+
+// readerLEAIEEE reads NDR-encoded primitive data types with little-endian
+// integer representation, ASCII character representation and IEEE floating
+// point representation.
+type readerLEAIEEE struct {
+	reader
+}
+
+func (r *readerLEAIEEE) ReadChar() (v byte, err error) {
+	return r.ReadByte()
+}
+
+func (r *readerLEAIEEE) ReadString(n int) (v string, err error) {
+	return r.ReadASCII(n)
+}
+
+func (r *readerLEAIEEE) ReadInt16() (v int16, err error) {
+	return r.ReadInt16LE()
+}
+
+func (r *readerLEAIEEE) ReadInt32() (v int32, err error) {
+	return r.ReadInt32LE()
+}
+
+func (r *readerLEAIEEE) ReadInt64() (v int64, err error) {
+	return r.ReadInt64LE()
+}
+
+func (r *readerLEAIEEE) ReadUint16() (v uint16, err error) {
+	return r.ReadUint16LE()
+}
+
+func (r *readerLEAIEEE) ReadUint32() (v uint32, err error) {
+	return r.ReadUint32LE()
+}
+
+func (r *readerLEAIEEE) ReadUint64() (v uint64, err error) {
+	return r.ReadUint64LE()
+}
+
+func (r *readerLEAIEEE) ReadFloat32() (v float32, err error) {
+	return r.ReadFloat32LEIEEE()
+}
+
+func (r *readerLEAIEEE) ReadFloat64() (v float64, err error) {
+	return r.ReadFloat64LEIEEE()
+}
+
+var _ = Reader((*readerFormat)(nil)) // Compile-time check for interface compliance
+
+// readerFormat reads NDR-encoded primitive data types with the integer,
+// character and floating point representations of its format label. It is
+// used for the formats that lack a dedicated reader.
+type readerFormat struct {
+	reader
+	format formatlabel.Format
+}
+
+func (r *readerFormat) ReadChar() (v byte, err error) {
+	if v, err = r.ReadByte(); err == nil && r.format.CharRep() == formatlabel.EBCDIC {
+		v = ebcdicToASCII[v]
+	}
+	return
+}
+
+func (r *readerFormat) ReadString(n int) (v string, err error) {
+	if r.format.CharRep() == formatlabel.EBCDIC {
+		return r.ReadEBCDIC(n)
+	}
+	return r.ReadASCII(n)
+}
+
+func (r *readerFormat) ReadInt16() (v int16, err error) {
+	u, err := r.ReadUint16()
+	return int16(u), err
+}
+
+func (r *readerFormat) ReadInt32() (v int32, err error) {
+	u, err := r.ReadUint32()
+	return int32(u), err
+}
+
+func (r *readerFormat) ReadInt64() (v int64, err error) {
+	u, err := r.ReadUint64()
+	return int64(u), err
+}
+
+func (r *readerFormat) ReadUint16() (v uint16, err error) {
+	if r.format.IntRep() == formatlabel.LittleEndian {
+		return r.ReadUint16LE()
+	}
+	return r.ReadUint16BE()
+}
+
+func (r *readerFormat) ReadUint32() (v uint32, err error) {
+	if r.format.IntRep() == formatlabel.LittleEndian {
+		return r.ReadUint32LE()
+	}
+	return r.ReadUint32BE()
+}
+
+func (r *readerFormat) ReadUint64() (v uint64, err error) {
+	if r.format.IntRep() == formatlabel.LittleEndian {
+		return r.ReadUint64LE()
+	}
+	return r.ReadUint64BE()
+}
+
+func (r *readerFormat) ReadFloat32() (v float32, err error) {
+	switch r.format.FloatRep() {
+	case formatlabel.VAX:
+		return r.ReadFloat32VAX()
+	case formatlabel.IBM:
+		return r.ReadFloat32IBM()
+	case formatlabel.Cray:
+		return r.ReadFloat32Cray()
+	}
+	if r.format.IntRep() == formatlabel.LittleEndian {
+		return r.ReadFloat32LEIEEE()
+	}
+	return r.ReadFloat32BEIEEE()
+}
+
+func (r *readerFormat) ReadFloat64() (v float64, err error) {
+	switch r.format.FloatRep() {
+	case formatlabel.VAX:
+		return r.ReadFloat64VAX()
+	case formatlabel.IBM:
+		return r.ReadFloat64IBM()
+	case formatlabel.Cray:
+		return r.ReadFloat64Cray()
+	}
+	if r.format.IntRep() == formatlabel.LittleEndian {
+		return r.ReadFloat64LEIEEE()
+	}
+	return r.ReadFloat64BEIEEE()
+}
@@ -16,6 +16,12 @@ type State struct {
 	id uint64
 	// errors is the set of errors encountered during encoding or decoding
 	errors []error
+	// conformance holds the sizes of conformant arrays that have been decoded
+	// but whose elements have not yet been decoded
+	conformance []uint64
+	// deferred holds the functions that transmit the referents of embedded
+	// pointers, which follow the construct that contains the pointers
+	deferred []func() error
 }
 
 // NewState initializes a new encoder/decoder state and returns it.
@@ -56,6 +62,69 @@ func (s *State) Register(v interface{}) (refID uint64) {
 	return
 }
 
+// Registered returns true if the given value has been assigned a referent
+// identifier by Register.
+func (s *State) Registered(v interface{}) bool {
+	s.mutex.RLock()
+	_, ok := s.ptrToRef[v]
+	s.mutex.RUnlock()
+	return ok
+}
+
+// NewReferent allocates a referent identifier that is not associated with a
+// value. It is used for unique and reference pointers, which never refer to
+// the same referent as another pointer.
+func (s *State) NewReferent() (refID uint64) {
+	s.mutex.Lock()
+	s.id++
+	refID = s.id
+	s.mutex.Unlock()
+	return
+}
+
+// Bind associates a received referent identifier with the given value, which
+// must be a pointer, so that later pointers with the same identifier may be
+// resolved to it by Resolve.
+func (s *State) Bind(refID uint64, v interface{}) {
+	s.mutex.Lock()
+	s.refToPtr[refID] = v
+	s.mutex.Unlock()
+}
+
+// Resolve returns the value bound to the given referent identifier by Bind.
+func (s *State) Resolve(refID uint64) (v interface{}, ok bool) {
+	s.mutex.RLock()
+	v, ok = s.refToPtr[refID]
+	s.mutex.RUnlock()
+	return
+}
+
+// Defer schedules f to encode or decode the referent of an embedded pointer.
+// Referents are transmitted after the outermost construct that contains their
+// pointers, which calls Flush when it is complete.
+func (s *State) Defer(f func() error) {
+	s.deferred = append(s.deferred, f)
+}
+
+// Flush calls the functions scheduled by Defer in the order they were
+// scheduled. The referents of the pointers embedded in each referent are
+// flushed before the next referent, so that each referent is followed by
+// its own referents.
+func (s *State) Flush() error {
+	pending := s.deferred
+	s.deferred = nil
+	for _, f := range pending {
+		if err := f(); err != nil {
+			s.deferred = nil
+			return err
+		}
+		if err := s.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // AddError adds the given error to the list of errors encountered in the
 // current encoding or decoding session.
 func (s *State) AddError(err error) {
@@ -63,3 +132,39 @@ func (s *State) AddError(err error) {
 	s.errors = append(s.errors, err)
 	s.mutex.Unlock()
 }
+
+// Err returns the first error encountered in the current encoding or decoding
+// session, or nil if no errors have been encountered.
+func (s *State) Err() error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if len(s.errors) == 0 {
+		return nil
+	}
+	return s.errors[0]
+}
+
+// PushConformance records the maximum counts of the dimensions of a
+// conformant array that has been decoded ahead of its elements. It is used by
+// decoders of transfer syntaxes that hoist conformance information to the
+// start of a structure.
+//
+// The counts are returned by successive calls to PopConformance in the order
+// they are given.
+func (s *State) PushConformance(counts ...uint64) {
+	for i := len(counts) - 1; i >= 0; i-- {
+		s.conformance = append(s.conformance, counts[i])
+	}
+}
+
+// PopConformance returns the next maximum count of the conformant array that
+// was most recently recorded by PushConformance.
+func (s *State) PopConformance() (size uint64) {
+	n := len(s.conformance)
+	if n == 0 {
+		return 0
+	}
+	size = s.conformance[n-1]
+	s.conformance = s.conformance[:n-1]
+	return
+}
@@ -37,3 +37,34 @@ func (c *EncoderTypeCache) Get(rt reflect.Type) (op EncOp) {
 	c.mutex.RUnlock()
 	return
 }
+
+// DecoderTypeCache represents a cache of types for which an RPC decoding
+// engine has been compiled.
+type DecoderTypeCache struct {
+	mutex sync.RWMutex
+	cache map[reflect.Type]DecOp
+}
+
+// NewDecoderTypeCache returns a new cache that is capable of storing types for
+// which and RPC decoding engine has been compiled.
+func NewDecoderTypeCache() *DecoderTypeCache {
+	return &DecoderTypeCache{
+		cache: make(map[reflect.Type]DecOp),
+	}
+}
+
+// Add will add the given decoding operation to the cache for the given type.
+func (c *DecoderTypeCache) Add(rt reflect.Type, op DecOp) {
+	c.mutex.Lock()
+	c.cache[rt] = op
+	c.mutex.Unlock()
+}
+
+// Get returns the RPC decoding op for the requested type if it exists in the
+// cache, or else nil.
+func (c *DecoderTypeCache) Get(rt reflect.Type) (op DecOp) {
+	c.mutex.RLock()
+	op = c.cache[rt]
+	c.mutex.RUnlock()
+	return
+}
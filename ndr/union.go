@@ -0,0 +1,372 @@
+package ndr
+
+import (
+	"reflect"
+
+	"github.com/gentlemanautomaton/dcerpc/idl/expr"
+	"github.com/gentlemanautomaton/dcerpc/idl/types"
+)
+
+// IsUnion returns true if the given type is a struct that holds a
+// discriminated union. The fields of a union that are marked with the case or
+// default attribute are its arms, and its other field is the discriminant.
+func IsUnion(rt reflect.Type) bool {
+	if rt.Kind() != reflect.Struct || IsMarshaler(rt) {
+		return false
+	}
+	for i := 0; i < rt.NumField(); i++ {
+		if isArm(rt.Field(i)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isArm returns true if the given field is an arm of a union.
+func isArm(rf reflect.StructField) bool {
+	return types.ParseFieldAttrList(rf.Tag.Get("idl")).Contains("case", "default")
+}
+
+// unionLayout describes the discriminant and arms of a union.
+type unionLayout struct {
+	rt        reflect.Type
+	disc      int           // Index of the discriminant field
+	arms      map[int64]int // Index of the arm selected by each case
+	def       int           // Index of the default arm, or -1
+	armAlign  []int         // Alignment of each arm
+	alignment int           // Alignment of the union
+}
+
+// compileUnion determines the layout of the given union type.
+func compileUnion(rt reflect.Type) (*unionLayout, error) {
+	l := &unionLayout{rt: rt, disc: -1, arms: make(map[int64]int), def: -1, armAlign: make([]int, rt.NumField())}
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		attrs := types.ParseFieldAttrList(f.Tag.Get("idl"))
+		switch {
+		case attrs.Contains("default"):
+			l.def = i
+		case attrs.Contains("case"):
+			values, _ := attrs.LookupDimensions("case")
+			for _, value := range values {
+				x, err := constValue(value)
+				if err != nil {
+					return nil, err
+				}
+				l.arms[x] = i
+			}
+		default:
+			if l.disc < 0 {
+				l.disc = i
+			}
+			continue
+		}
+		l.armAlign[i] = FieldAlignment(f)
+	}
+	if l.disc < 0 {
+		return nil, NewEncodingError(MissingDiscriminant, rt.Name(), "", "", 0, 0)
+	}
+	l.alignment = Alignment(rt)
+	return l, nil
+}
+
+// arm returns the index of the arm selected by the discriminant d.
+func (l *unionLayout) arm(d int64) (int, bool) {
+	if i, ok := l.arms[d]; ok {
+		return i, true
+	}
+	return l.def, l.def >= 0
+}
+
+// discriminant returns the value of the discriminant field of the union u.
+func (l *unionLayout) discriminant(u reflect.Value) int64 {
+	v := u.Field(l.disc)
+	if v.Kind() == reflect.Bool {
+		if v.Bool() {
+			return 1
+		}
+		return 0
+	}
+	x, _ := intValue(v)
+	return x
+}
+
+// unionEncoder encodes the discriminant and the selected arm of a union.
+type unionEncoder struct {
+	*unionLayout
+	discOp EncOp
+	armOps []encInstr
+}
+
+func newUnionEncoder(rt reflect.Type) (*unionEncoder, error) {
+	l, err := compileUnion(rt)
+	if err != nil {
+		return nil, err
+	}
+	u := &unionEncoder{
+		unionLayout: l,
+		discOp:      EncOpForField(rt.Field(l.disc)),
+		armOps:      make([]encInstr, rt.NumField()),
+	}
+	if u.discOp == nil {
+		return nil, NewEncodingError(MissingDiscriminant, rt.Name(), "", "", 0, 0)
+	}
+	for i := range u.armOps {
+		if i != l.disc {
+			u.armOps[i], _ = encInstrForField(rt, rt.Field(i), false)
+		}
+	}
+	return u, nil
+}
+
+// encode encodes the union v with the discriminant d, which is held by the
+// discriminant field of v.
+func (u *unionEncoder) encode(w Writer, s *State, v reflect.Value, d int64, disc reflect.Value) {
+	u.discOp(w, s, disc)
+	i, ok := u.arm(d)
+	if !ok {
+		s.AddError(NewEncodingError(NoUnionArm, u.rt.Name(), "", "", int(d), 0))
+		return
+	}
+	w.Align(u.armAlign[i])
+	if instr := &u.armOps[i]; instr.op != nil {
+		instr.op(w, s, v.FieldByIndex(instr.index))
+	}
+}
+
+// EncOpForUnion returns an NDR encoding function for the given type, which
+// must be a union. The union is encapsulated: its discriminant is taken from
+// its discriminant field. The union is aligned as a struct that holds the
+// discriminant followed by the arms, and the selected arm is aligned to its
+// own alignment.
+func EncOpForUnion(rt reflect.Type) EncOp {
+	u, err := newUnionEncoder(rt)
+	if err != nil {
+		return EncOpForError(err)
+	}
+	return func(w Writer, s *State, v reflect.Value) {
+		w.Align(u.alignment)
+		u.encode(w, s, v, u.discriminant(v), v.Field(u.disc))
+	}
+}
+
+// EncOpForUnionField returns an NDR encoding function for the given field of
+// base, which holds a union or a pointer to a union and has the switch_is
+// attribute. The encoding function operates on values of the base type,
+// against which the switch_is expression is evaluated to determine the
+// discriminant. The discriminant field of the union is not consulted.
+//
+// The discriminant is transmitted, as it is for encapsulated unions, and
+// is followed by the selected arm.
+func EncOpForUnionField(base reflect.Type, field reflect.StructField, attrs types.FieldAttrList) EncOp {
+	rt, ptr := field.Type, field.Type.Kind() == reflect.Ptr
+	if ptr {
+		rt = rt.Elem()
+	}
+	value, _ := attrs.Lookup("switch_is")
+	sw, err := expr.CompileString(value, base)
+	if err != nil {
+		return EncOpForError(err)
+	}
+	u, err := newUnionEncoder(rt)
+	if err != nil {
+		return EncOpForError(err)
+	}
+	discType := rt.Field(u.disc).Type
+	encode := func(w Writer, s *State, v, union reflect.Value) {
+		d, err := sw.Eval(v)
+		if err != nil {
+			s.AddError(err)
+			return
+		}
+		disc := reflect.New(discType).Elem()
+		if !setDiscriminant(disc, d) {
+			s.AddError(NewEncodingError(NoUnionArm, rt.Name(), field.Name, "", int(d), 0))
+			return
+		}
+		u.encode(w, s, union, d, disc)
+	}
+	if !ptr {
+		return func(w Writer, s *State, v reflect.Value) {
+			encode(w, s, v, v.FieldByIndex(field.Index))
+		}
+	}
+	kind := PointerKind(attrs)
+	return func(w Writer, s *State, v reflect.Value) {
+		p := v.FieldByIndex(field.Index)
+		if p.IsNil() {
+			if kind == RefPointer {
+				s.AddError(NewEncodingError(NullReference, base.Name(), field.Name, "", 0, 0))
+			}
+			w.WriteUint32(0)
+			return
+		}
+		w.WriteUint32(referentID(s.NewReferent()))
+		s.Defer(func() error {
+			encode(w, s, v, p.Elem())
+			return nil
+		})
+	}
+}
+
+// unionDecoder decodes the discriminant and the selected arm of a union.
+type unionDecoder struct {
+	*unionLayout
+	discOp DecOp
+	armOps []decInstr
+}
+
+func newUnionDecoder(rt reflect.Type) (*unionDecoder, error) {
+	l, err := compileUnion(rt)
+	if err != nil {
+		return nil, err
+	}
+	u := &unionDecoder{
+		unionLayout: l,
+		discOp:      DecOpForField(rt.Field(l.disc)),
+		armOps:      make([]decInstr, rt.NumField()),
+	}
+	if u.discOp == nil {
+		return nil, NewEncodingError(MissingDiscriminant, rt.Name(), "", "", 0, 0)
+	}
+	for i := range u.armOps {
+		if i != l.disc {
+			u.armOps[i], _ = decInstrForField(rt, rt.Field(i), false)
+		}
+	}
+	return u, nil
+}
+
+// decode decodes the union v, including its discriminant field. If check is
+// not nil it is called with the received discriminant before the arm is
+// decoded.
+func (u *unionDecoder) decode(r Reader, s *State, v reflect.Value, check func(d int64) error) error {
+	v.Set(reflect.Zero(v.Type()))
+	if err := u.discOp(r, s, v.Field(u.disc)); err != nil {
+		return err
+	}
+	d := u.discriminant(v)
+	if check != nil {
+		if err := check(d); err != nil {
+			return err
+		}
+	}
+	i, ok := u.arm(d)
+	if !ok {
+		return NewDecodingError(InvalidDiscriminant, u.rt.Name(), "", int(d), 0)
+	}
+	if err := r.Align(u.armAlign[i]); err != nil {
+		return err
+	}
+	if instr := &u.armOps[i]; instr.op != nil {
+		return instr.op(r, s, v.FieldByIndex(instr.index))
+	}
+	return nil
+}
+
+// DecOpForUnion returns an NDR decoding function for the given type, which
+// must be a union. It is the counterpart of EncOpForUnion.
+func DecOpForUnion(rt reflect.Type) DecOp {
+	u, err := newUnionDecoder(rt)
+	if err != nil {
+		return DecOpForError(err)
+	}
+	return func(r Reader, s *State, v reflect.Value) error {
+		if err := r.Align(u.alignment); err != nil {
+			return err
+		}
+		return u.decode(r, s, v, nil)
+	}
+}
+
+// DecOpForUnionField returns an NDR decoding function for the given field of
+// base, which is the counterpart of EncOpForUnionField. The received
+// discriminant is stored in the discriminant field of the union. It is
+// verified against the switch_is expression when the fields that the
+// expression refers to precede the union in base.
+func DecOpForUnionField(base reflect.Type, field reflect.StructField, attrs types.FieldAttrList) DecOp {
+	rt, ptr := field.Type, field.Type.Kind() == reflect.Ptr
+	if ptr {
+		rt = rt.Elem()
+	}
+	value, _ := attrs.Lookup("switch_is")
+	sw, err := expr.CompileString(value, base)
+	if err != nil {
+		return DecOpForError(err)
+	}
+	u, err := newUnionDecoder(rt)
+	if err != nil {
+		return DecOpForError(err)
+	}
+	verify := true
+	for _, f := range sw.Fields() {
+		if f >= field.Index[0] {
+			verify = false
+		}
+	}
+	decode := func(r Reader, s *State, v, union reflect.Value) error {
+		var check func(d int64) error
+		if verify {
+			check = func(d int64) error {
+				want, err := sw.Eval(v)
+				if err != nil {
+					return err
+				}
+				if d != want {
+					return NewDecodingError(DiscriminantMismatch, base.Name(), field.Name, int(d), int(want))
+				}
+				return nil
+			}
+		}
+		return u.decode(r, s, union, check)
+	}
+	if !ptr {
+		return func(r Reader, s *State, v reflect.Value) error {
+			return decode(r, s, v, v.FieldByIndex(field.Index))
+		}
+	}
+	kind := PointerKind(attrs)
+	return func(r Reader, s *State, v reflect.Value) error {
+		id, err := r.ReadUint32()
+		if err != nil {
+			return err
+		}
+		p := v.FieldByIndex(field.Index)
+		if id == 0 {
+			if kind == RefPointer {
+				return NewDecodingError(UnexpectedNull, base.Name(), field.Name, 0, 0)
+			}
+			p.Set(reflect.Zero(p.Type()))
+			return nil
+		}
+		union := reflect.New(rt)
+		p.Set(union)
+		s.Defer(func() error {
+			return decode(r, s, v, union.Elem())
+		})
+		return nil
+	}
+}
+
+// IsUnionField returns true if the given field holds a union, or a pointer to
+// a union, whose discriminant is given by a switch_is attribute.
+func IsUnionField(rf reflect.StructField, attrs types.FieldAttrList) bool {
+	if _, ok := attrs.Lookup("switch_is"); !ok {
+		return false
+	}
+	rt := rf.Type
+	if rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	return IsUnion(rt)
+}
+
+// setDiscriminant stores d in the discriminant v, which must be a settable
+// bool or integer. It returns false if d does not fit in v.
+func setDiscriminant(v reflect.Value, d int64) bool {
+	if v.Kind() == reflect.Bool {
+		v.SetBool(d != 0)
+		return d == 0 || d == 1
+	}
+	return setInt(v, d)
+}
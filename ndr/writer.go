@@ -2,6 +2,7 @@ package ndr
 
 import (
 	"io"
+	"math"
 
 	"github.com/gentlemanautomaton/dcerpc/formatlabel"
 )
@@ -48,10 +49,18 @@ type Writer interface {
 	WriteFloat32LEIEEE(v float32)
 	WriteFloat64LEIEEE(v float64)
 
-	// TODO: Add VAX, Cray and IBM floating point representations
+	// VAX, IBM and Cray floating point representations, which cannot hold
+	// every IEEE value and return an error for values they cannot represent
+	WriteFloat32VAX(v float32) error
+	WriteFloat64VAX(v float64) error
+	WriteFloat32IBM(v float32) error
+	WriteFloat64IBM(v float64) error
+	WriteFloat32Cray(v float32) error
+	WriteFloat64Cray(v float64) error
 
-	// Format-dependent string representations
-	WriteString(v string) // FIXME: Change to WriteCharacter instead?
+	// Format-dependent character and string representations
+	WriteChar(v byte)
+	WriteString(v string)
 
 	// Format-dependent integer representations
 
@@ -66,8 +75,8 @@ type Writer interface {
 	// TODO: Add Enums?
 
 	// Format-dependent floating point representations
-	WriteFloat32(v float32)
-	WriteFloat64(v float64)
+	WriteFloat32(v float32) error
+	WriteFloat64(v float64) error
 
 	// TODO: Add referent recording funtion
 	// WritePointer()
@@ -82,6 +91,20 @@ func NewWriter(w io.Writer, format formatlabel.Format) Writer {
 			Writer: w,
 			refs:   make(map[uintptr]uint64),
 		}}
+	case formatlabel.LEAIEEE:
+		return &writerLEAIEEE{writer{
+			Writer: w,
+			refs:   make(map[uintptr]uint64),
+		}}
+	}
+	if format.Valid() {
+		return &writerFormat{
+			writer: writer{
+				Writer: w,
+				refs:   make(map[uintptr]uint64),
+			},
+			format: format,
+		}
 	}
 	return nil
 }
@@ -102,6 +125,13 @@ func (w *writer) Offset() uint64 {
 	return w.index
 }
 
+// Write writes p to the underlying io.Writer and advances the offset.
+func (w *writer) Write(p []byte) (n int, err error) {
+	n, err = w.Writer.Write(p)
+	w.index += uint64(n)
+	return
+}
+
 // Align will insert zero padding until the current index of the buffer
 // matches the desired alignment (until index mod modulo == zero).
 func (w *writer) Align(modulo int) {
@@ -129,11 +159,7 @@ func (w *writer) Align(modulo int) {
 func (w *writer) WriteByte(c byte) error {
 	w.buf[0] = c
 	_, err := w.Write(w.buf[0:1])
-	if err != nil {
-		return err
-	}
-	w.index++
-	return nil
+	return err
 }
 
 // Alloc will ensure that the given number of bytes have been preallocated
@@ -159,9 +185,12 @@ func (w *writer) WriteASCII(v string) {
 	w.Write([]byte(v))
 }
 
-// TODO: Determine whether this should write individual runes instead?
+// WriteEBCDIC writes v, which must hold ASCII characters, in EBCDIC
+// character representation.
 func (w *writer) WriteEBCDIC(v string) {
-	// FIXME: Implement this
+	for i := 0; i < len(v); i++ {
+		w.WriteByte(asciiToEBCDIC[v[i]])
+	}
 }
 
 // TODO: Determine whether this should write individual runes instead?
@@ -260,19 +289,70 @@ func (w *writer) WriteUint64LE(v uint64) {
 }
 
 func (w *writer) WriteFloat32BEIEEE(v float32) {
-	// TODO: Write this
+	w.WriteUint32BE(math.Float32bits(v))
 }
 
 func (w *writer) WriteFloat64BEIEEE(v float64) {
-	// TODO: Write this
+	w.WriteUint64BE(math.Float64bits(v))
 }
 
 func (w *writer) WriteFloat32LEIEEE(v float32) {
-	// TODO: Write this
+	w.WriteUint32LE(math.Float32bits(v))
 }
 
 func (w *writer) WriteFloat64LEIEEE(v float64) {
-	// TODO: Write this
+	w.WriteUint64LE(math.Float64bits(v))
+}
+
+// WriteFloat32VAX writes v in VAX F_floating representation, which is stored
+// as two little-endian 16-bit words with the most significant word first.
+func (w *writer) WriteFloat32VAX(v float32) error {
+	u, err := Float32ToVAXF(v)
+	w.WriteUint32LE(u>>16 | u<<16)
+	return err
+}
+
+// WriteFloat64VAX writes v in VAX G_floating representation, which is stored
+// as four little-endian 16-bit words with the most significant word first.
+func (w *writer) WriteFloat64VAX(v float64) error {
+	u, err := Float64ToVAXG(v)
+	w.WriteUint64LE(swapWords(u))
+	return err
+}
+
+// WriteFloat32IBM writes v in big-endian IBM hexadecimal single precision
+// representation.
+func (w *writer) WriteFloat32IBM(v float32) error {
+	u, err := Float32ToIBM(v)
+	w.WriteUint32BE(u)
+	return err
+}
+
+// WriteFloat64IBM writes v in big-endian IBM hexadecimal double precision
+// representation.
+func (w *writer) WriteFloat64IBM(v float64) error {
+	u, err := Float64ToIBM(v)
+	w.WriteUint64BE(u)
+	return err
+}
+
+// WriteFloat32Cray writes v in big-endian Cray floating point
+// representation, which occupies 8 octets.
+func (w *writer) WriteFloat32Cray(v float32) error {
+	return w.WriteFloat64Cray(float64(v))
+}
+
+// WriteFloat64Cray writes v in big-endian Cray floating point
+// representation.
+func (w *writer) WriteFloat64Cray(v float64) error {
+	u, err := Float64ToCray(v)
+	w.WriteUint64BE(u)
+	return err
+}
+
+// swapWords reverses the order of the 16-bit words of u.
+func swapWords(u uint64) uint64 {
+	return u>>48 | u>>16&0xffff0000 | u<<16&0xffff00000000 | u<<48
 }
 
 var _ = Writer((*writerBEAIEEE)(nil)) // Compile-time check for interface compliance
@@ -284,6 +364,10 @@ type writerBEAIEEE struct {
 	writer
 }
 
+func (w *writerBEAIEEE) WriteChar(v byte) {
+	w.WriteByte(v)
+}
+
 func (w *writerBEAIEEE) WriteString(v string) {
 	w.WriteASCII(v)
 }
@@ -312,10 +396,158 @@ func (w *writerBEAIEEE) WriteUint64(v uint64) {
 	w.WriteUint64BE(v)
 }
 
-func (w *writerBEAIEEE) WriteFloat32(v float32) {
+func (w *writerBEAIEEE) WriteFloat32(v float32) error {
 	w.WriteFloat32BEIEEE(v)
+	return nil
 }
 
-func (w *writerBEAIEEE) WriteFloat64(v float64) {
+func (w *writerBEAIEEE) WriteFloat64(v float64) error {
 	w.WriteFloat64BEIEEE(v)
+	return nil
+}
+
+var _ = Writer((*writerLEAIEEE)(nil)) // Compile-time check for interface compliance
+
+// writerLEAIEEE writes NDR-encoded primitive data types with little-endian
+// integer representation, ASCII character representation and IEEE floating
+// point representation.
+type writerLEAIEEE struct {
+	writer
+}
+
+func (w *writerLEAIEEE) WriteChar(v byte) {
+	w.WriteByte(v)
+}
+
+func (w *writerLEAIEEE) WriteString(v string) {
+	w.WriteASCII(v)
+}
+
+func (w *writerLEAIEEE) WriteInt16(v int16) {
+	w.WriteInt16LE(v)
+}
+
+func (w *writerLEAIEEE) WriteInt32(v int32) {
+	w.WriteInt32LE(v)
+}
+
+func (w *writerLEAIEEE) WriteInt64(v int64) {
+	w.WriteInt64LE(v)
+}
+
+func (w *writerLEAIEEE) WriteUint16(v uint16) {
+	w.WriteUint16LE(v)
+}
+
+func (w *writerLEAIEEE) WriteUint32(v uint32) {
+	w.WriteUint32LE(v)
+}
+
+func (w *writerLEAIEEE) WriteUint64(v uint64) {
+	w.WriteUint64LE(v)
+}
+
+func (w *writerLEAIEEE) WriteFloat32(v float32) error {
+	w.WriteFloat32LEIEEE(v)
+	return nil
+}
+
+func (w *writerLEAIEEE) WriteFloat64(v float64) error {
+	w.WriteFloat64LEIEEE(v)
+	return nil
+}
+
+var _ = Writer((*writerFormat)(nil)) // Compile-time check for interface compliance
+
+// writerFormat writes NDR-encoded primitive data types with the integer,
+// character and floating point representations of its format label. It is
+// used for the formats that lack a dedicated writer.
+type writerFormat struct {
+	writer
+	format formatlabel.Format
+}
+
+func (w *writerFormat) WriteChar(v byte) {
+	if w.format.CharRep() == formatlabel.EBCDIC {
+		v = asciiToEBCDIC[v]
+	}
+	w.WriteByte(v)
+}
+
+func (w *writerFormat) WriteString(v string) {
+	if w.format.CharRep() == formatlabel.EBCDIC {
+		w.WriteEBCDIC(v)
+	} else {
+		w.WriteASCII(v)
+	}
+}
+
+func (w *writerFormat) WriteInt16(v int16) {
+	w.WriteUint16(uint16(v))
+}
+
+func (w *writerFormat) WriteInt32(v int32) {
+	w.WriteUint32(uint32(v))
+}
+
+func (w *writerFormat) WriteInt64(v int64) {
+	w.WriteUint64(uint64(v))
+}
+
+func (w *writerFormat) WriteUint16(v uint16) {
+	if w.format.IntRep() == formatlabel.LittleEndian {
+		w.WriteUint16LE(v)
+	} else {
+		w.WriteUint16BE(v)
+	}
+}
+
+func (w *writerFormat) WriteUint32(v uint32) {
+	if w.format.IntRep() == formatlabel.LittleEndian {
+		w.WriteUint32LE(v)
+	} else {
+		w.WriteUint32BE(v)
+	}
+}
+
+func (w *writerFormat) WriteUint64(v uint64) {
+	if w.format.IntRep() == formatlabel.LittleEndian {
+		w.WriteUint64LE(v)
+	} else {
+		w.WriteUint64BE(v)
+	}
+}
+
+func (w *writerFormat) WriteFloat32(v float32) error {
+	switch w.format.FloatRep() {
+	case formatlabel.VAX:
+		return w.WriteFloat32VAX(v)
+	case formatlabel.IBM:
+		return w.WriteFloat32IBM(v)
+	case formatlabel.Cray:
+		return w.WriteFloat32Cray(v)
+	}
+	if w.format.IntRep() == formatlabel.LittleEndian {
+		w.WriteFloat32LEIEEE(v)
+	} else {
+		w.WriteFloat32BEIEEE(v)
+	}
+	return nil
+}
+
+func (w *writerFormat) WriteFloat64(v float64) error {
+	switch w.format.FloatRep() {
+	case formatlabel.VAX:
+		return w.WriteFloat64VAX(v)
+	case formatlabel.IBM:
+		return w.WriteFloat64IBM(v)
+	case formatlabel.Cray:
+		return w.WriteFloat64Cray(v)
+	}
+	if w.format.IntRep() == formatlabel.LittleEndian {
+		w.WriteFloat64LEIEEE(v)
+	} else {
+		w.WriteFloat64BEIEEE(v)
+	}
+	return nil
 }
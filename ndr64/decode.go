@@ -0,0 +1,292 @@
+package ndr64
+
+import (
+	"math"
+	"reflect"
+
+	"github.com/gentlemanautomaton/dcerpc/idl/types"
+	"github.com/gentlemanautomaton/dcerpc/ndr"
+)
+
+type decInstr struct {
+	op    ndr.DecOp
+	index []int
+}
+
+// DecOpForArray returns an NDR64 decoding function for the given type, which
+// must be an array.
+func DecOpForArray(rt reflect.Type) ndr.DecOp {
+	length, elemOp := rt.Len(), DecOpFor(rt.Elem())
+	return func(r ndr.Reader, s *ndr.State, v reflect.Value) error {
+		for i := 0; i < length; i++ {
+			if err := elemOp(r, s, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// DecOpForSlice returns an NDR64 decoding function for the given type, which
+// must be a slice. The decoding function will decode the slice as a varying
+// array. Nested slices are decoded as a multi-dimensional varying array.
+func DecOpForSlice(rt reflect.Type) ndr.DecOp {
+	dimensions, elem := ndr.ArrayDimensions(rt)
+	elemOp := DecOpFor(elem)
+	return func(r ndr.Reader, s *ndr.State, v reflect.Value) error {
+		subsets, err := DecSliceHeader(r, s, dimensions)
+		if err != nil {
+			return err
+		}
+		return ndr.DecSliceElements(r, s, v, subsets, elemOp)
+	}
+}
+
+// DecSliceHeader is an NDR64 decoding function for varying array headers,
+// which declare array offsets and counts. Offsets and counts above
+// math.MaxInt32, or beyond the octets that remain in r, are rejected.
+func DecSliceHeader(r ndr.Reader, s *ndr.State, dimensions int) (subsets []ndr.SliceSubset, err error) {
+	subsets = make([]ndr.SliceSubset, dimensions)
+	for i := range subsets {
+		offset, err := r.ReadUint64()
+		if err != nil {
+			return nil, err
+		}
+		count, err := r.ReadUint64()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkCount(r, offset); err != nil {
+			return nil, err
+		}
+		if err := checkCount(r, count); err != nil {
+			return nil, err
+		}
+		subsets[i] = ndr.SliceSubset{Offset: int(offset), Count: int(count)}
+	}
+	return
+}
+
+// checkCount returns an error if the size, offset or count n of a received
+// array cannot be represented as an int on every platform, or if it exceeds
+// the number of octets that remain in r.
+func checkCount(r ndr.Reader, n uint64) error {
+	if n > math.MaxInt32 {
+		return ndr.NewDecodingError(ndr.CountOutOfRange, "", "", 0, math.MaxInt32)
+	}
+	if remaining, ok := r.Remaining(); ok && n > uint64(remaining) {
+		return ndr.NewDecodingError(ndr.InsufficientData, "", "", int(n), remaining)
+	}
+	return nil
+}
+
+// DecOpForArrayField returns an NDR64 decoding function for the given field
+// of base, which must be a slice with conformance or variance attributes, or
+// an array with variance attributes. The decoding function operates on values
+// of the base type. It decodes the variance of each dimension, if the array
+// is varying, and the transmitted elements. The received bounds are verified
+// against the array's attributes when the fields they refer to precede the
+// array.
+func DecOpForArrayField(base reflect.Type, field reflect.StructField, attrs types.FieldAttrList) ndr.DecOp {
+	bounds, err := ndr.CompileFieldBounds(base, field, attrs)
+	if err != nil {
+		return ndr.DecOpForError(err)
+	}
+	dimensions := len(bounds.Dimensions)
+	elemOp := DecOpFor(bounds.Elem)
+	return func(r ndr.Reader, s *ndr.State, v reflect.Value) error {
+		max := bounds.Fixed
+		if max == nil {
+			max = make([]int, dimensions)
+			for d := range max {
+				if bounds.Conformant {
+					max[d] = int(s.PopConformance())
+				} else {
+					max[d] = -1
+				}
+			}
+		}
+		var subsets []ndr.SliceSubset
+		if bounds.Varying {
+			var err error
+			if subsets, err = DecSliceHeader(r, s, dimensions); err != nil {
+				return err
+			}
+		} else {
+			subsets = make([]ndr.SliceSubset, dimensions)
+			for d := range subsets {
+				subsets[d].Count = max[d]
+			}
+		}
+		if err := bounds.Check(v, max, subsets); err != nil {
+			return err
+		}
+		return ndr.DecSliceElements(r, s, v.FieldByIndex(field.Index), subsets, elemOp)
+	}
+}
+
+// DecOpForStructConformance returns an NDR64 decoding function for the
+// conformance information of the given type, which must be a conformant
+// struct. The decoded maximum counts of each dimension of the conformant
+// array are retained by the decoder state until the array is decoded.
+func DecOpForStructConformance(rt reflect.Type) ndr.DecOp {
+	f := rt.Field(rt.NumField() - 1)
+	if f.Type.Kind() == reflect.Struct {
+		return DecOpForStructConformance(f.Type)
+	}
+	dimensions, _ := ndr.ArrayDimensions(f.Type)
+	return func(r ndr.Reader, s *ndr.State, v reflect.Value) error {
+		max := make([]uint64, dimensions)
+		for d := range max {
+			m, err := r.ReadUint64()
+			if err != nil {
+				return err
+			}
+			if m > math.MaxInt32 {
+				return ndr.NewDecodingError(ndr.CountOutOfRange, rt.Name(), f.Name, 0, math.MaxInt32)
+			}
+			max[d] = m
+		}
+		s.PushConformance(max...)
+		return nil
+	}
+}
+
+// DecOpForStruct returns an NDR64 decoding function for the given type, which
+// must be a struct. If the struct contains conformant data its conformance
+// will be decoded before the struct members.
+func DecOpForStruct(rt reflect.Type) ndr.DecOp {
+	body := decOpForStructMembers(rt)
+	if !ndr.IsConformantStruct(rt) {
+		return body
+	}
+	conformance := DecOpForStructConformance(rt)
+	return func(r ndr.Reader, s *ndr.State, v reflect.Value) error {
+		if err := conformance(r, s, v); err != nil {
+			return err
+		}
+		return body(r, s, v)
+	}
+}
+
+// decOpForStructMembers returns an NDR64 decoding function for the members of
+// the given type, which must be a struct. The alignment and trailing padding
+// of the struct are consumed.
+func decOpForStructMembers(rt reflect.Type) ndr.DecOp {
+	engine := make([]decInstr, 0, rt.NumField())
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		tag := f.Tag.Get("idl")
+		if tag == "-" {
+			continue
+		}
+		attrs := types.ParseFieldAttrList(tag)
+		if what := unsupported(f, attrs); what != "" {
+			engine = append(engine, decInstr{
+				op: ndr.DecOpForError(ndr.NewEncodingError(ndr.Unsupported, rt.Name(), f.Name, what, 0, 0)),
+			})
+			continue
+		}
+		if ndr.IsBoundedField(f, attrs) {
+			// The bounds of the array are evaluated against the struct.
+			engine = append(engine, decInstr{
+				op: DecOpForArrayField(rt, f, attrs),
+			})
+			continue
+		}
+		if op := DecOpForField(f); op != nil {
+			engine = append(engine, decInstr{
+				op:    op,
+				index: f.Index,
+			})
+		}
+	}
+	alignment := Alignment(rt)
+	return func(r ndr.Reader, s *ndr.State, v reflect.Value) error {
+		if err := r.Align(alignment); err != nil {
+			return err
+		}
+		for i := 0; i < len(engine); i++ {
+			instr := &engine[i]
+			if err := instr.op(r, s, v.FieldByIndex(instr.index)); err != nil {
+				return err
+			}
+		}
+		return r.Align(alignment)
+	}
+}
+
+// DecOpForField returns an NDR64 decoding function for the given field.
+func DecOpForField(rf reflect.StructField) ndr.DecOp {
+	if op := ndr.DecOpForUnmarshaler(rf.Type); op != nil {
+		return op
+	}
+	attrs := types.ParseFieldAttrList(rf.Tag.Get("idl"))
+	if ndr.EnumSize(attrs) > 0 {
+		// NDR64 transmits all enums in 4 octets.
+		if op := ndr.DecOpForEnum(rf, 4); op != nil {
+			return ndr.DecOpForRange(rf, attrs, op)
+		}
+	}
+	if op := ndr.DecOpForPrimitive(rf.Type); op != nil {
+		return ndr.DecOpForRange(rf, attrs, op)
+	}
+
+	switch rf.Type.Kind() {
+	case reflect.Array:
+		return DecOpForArray(rf.Type)
+	case reflect.Slice:
+		// Slices with bounds attributes are decoded by DecOpForArrayField.
+		return DecOpForSlice(rf.Type)
+	case reflect.Chan:
+		if ndr.IsPipe(rf.Type) {
+			return DecOpForPipe(rf.Type)
+		}
+	case reflect.Struct:
+		// The conformance of embedded structs is hoisted to the start of the
+		// outermost struct.
+		return decOpForStructMembers(rf.Type)
+	case reflect.Ptr:
+		if attrs.Contains("ignore") {
+			return decNullPointer
+		}
+	}
+	return nil
+}
+
+// decNullPointer is an NDR64 decoding function for a pointer whose referent
+// is not transmitted. The received pointer is discarded.
+func decNullPointer(r ndr.Reader, s *ndr.State, v reflect.Value) error {
+	_, err := r.ReadUint64()
+	return err
+}
+
+// DecOpFor returns an NDR64 decoding function for the given type.
+func DecOpFor(rt reflect.Type) ndr.DecOp {
+	if op := ndr.DecOpForUnmarshaler(rt); op != nil {
+		return op
+	}
+	if op := ndr.DecOpForPrimitive(rt); op != nil {
+		return op
+	}
+
+	switch rt.Kind() {
+	case reflect.Array:
+		return DecOpForArray(rt)
+	case reflect.Slice:
+		return DecOpForSlice(rt)
+	case reflect.Chan:
+		if ndr.IsPipe(rt) {
+			return DecOpForPipe(rt)
+		}
+	case reflect.Struct:
+		switch {
+		case ndr.IsUnion(rt):
+			return ndr.DecOpForError(ndr.NewEncodingError(ndr.Unsupported, rt.Name(), "", "a union", 0, 0))
+		case ndr.IsParamList(rt):
+			return ndr.DecOpForError(ndr.NewEncodingError(ndr.Unsupported, rt.Name(), "", "a parameter list", 0, 0))
+		}
+		return DecOpForStruct(rt)
+	}
+	return nil
+}
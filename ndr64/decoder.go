@@ -0,0 +1,65 @@
+package ndr64
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+
+	"github.com/gentlemanautomaton/dcerpc/formatlabel"
+	"github.com/gentlemanautomaton/dcerpc/ndr"
+)
+
+var decTypeCache = ndr.NewDecoderTypeCache()
+
+// Decoder reads NDR64 data from an underlying io.Reader and decodes it into Go
+// types.
+type Decoder struct {
+	mutex sync.Mutex
+	r     ndr.Reader
+}
+
+// NewDecoder returns a new Decoder that reads from the given io.Reader with
+// the encoding represented by the provided format label.
+func NewDecoder(r io.Reader, format formatlabel.Format) (*Decoder, error) {
+	if format != formatlabel.LEAIEEE {
+		return nil, ErrUnsupportedFormat
+	}
+	return &Decoder{
+		r: ndr.NewReader(r, format),
+	}, nil
+}
+
+// Decode reads the next NDR64-encoded value from the underlying io.Reader and
+// stores it in the value pointed to by v.
+func (dec *Decoder) Decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("ndr64: Decode requires a non-nil pointer")
+	}
+	return dec.DecodeValue(rv.Elem())
+}
+
+// DecodeValue reads the next NDR64-encoded value from the underlying
+// io.Reader and stores it in v, which must be settable.
+func (dec *Decoder) DecodeValue(v reflect.Value) error {
+	op := decTypeCache.Get(v.Type())
+	// TODO: Add cache pending mechanism to avoid duplication of effort
+	if op == nil {
+		op = DecOpFor(v.Type())
+		if op == nil {
+			return fmt.Errorf("ndr64: unable to decode values of type %s", v.Type())
+		}
+		decTypeCache.Add(v.Type(), op)
+	}
+
+	s := ndr.NewState() // FIXME: Figure out how the caller should provide state
+
+	dec.mutex.Lock()
+	defer dec.mutex.Unlock()
+	if err := op(dec.r, s, v); err != nil {
+		return err
+	}
+	return s.Err()
+}
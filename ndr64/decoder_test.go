@@ -0,0 +1,43 @@
+package ndr64
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gentlemanautomaton/dcerpc/formatlabel"
+	"github.com/gentlemanautomaton/dcerpc/ndr"
+)
+
+func TestDecodeOversizedHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		code    int
+	}{
+		{"huge-offset", []byte{
+			0, 0, 0, 0, 0, 0, 0, 0x80, // Offset
+			1, 0, 0, 0, 0, 0, 0, 0, // Count
+			1, 0,
+		}, ndr.CountOutOfRange},
+		{"huge-count", []byte{
+			0, 0, 0, 0, 0, 0, 0, 0,
+			0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0,
+			1, 0,
+		}, ndr.CountOutOfRange},
+		{"count-past-input", []byte{
+			0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 1, 0, 0, 0, 0,
+			1, 0,
+		}, ndr.InsufficientData},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out []uint16
+			dec, _ := NewDecoder(bytes.NewReader(tt.payload), formatlabel.LEAIEEE)
+			err := dec.Decode(&out)
+			if e, ok := err.(*ndr.DecodingError); !ok || e.Code != tt.code {
+				t.Fatalf("decoding returned %v, want error code %d", err, tt.code)
+			}
+		})
+	}
+}
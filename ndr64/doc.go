@@ -6,5 +6,8 @@
 // The specification is available at this URL:
 // http://msdn.microsoft.com/en-us/library/cc243560.aspx
 //
+// Values are mapped to Go types in the same way as they are by the ndr
+// package, except that enums are always transmitted in 4 octets.
+//
 // This package is a work in progress and is not yet ready for production use.
 package ndr64
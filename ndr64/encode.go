@@ -12,42 +12,159 @@ type encInstr struct {
 	index []int
 }
 
-// EncOpForSlice returns an NDR encoding function for the given type, which
-// must be a slice.
-func EncOpForSlice(rt reflect.Type) ndr.EncOp {
-	// FIXME: Handle multiple dimensions
-	elemOp := EncOpFor(rt.Elem())
+// EncOpForArray returns an NDR64 encoding function for the given type, which
+// must be an array.
+func EncOpForArray(rt reflect.Type) ndr.EncOp {
+	length, elemOp := rt.Len(), EncOpFor(rt.Elem())
 	return func(w ndr.Writer, s *ndr.State, v reflect.Value) {
-		w.WriteUint64(0)                 // Varying array offset, always zero in our case
-		w.WriteUint64((uint64)(v.Len())) // Varying array length, in number of elements
-		for e := 0; e < v.Len(); e++ {
-			elemOp(w, s, v.Index(e))
+		for i := 0; i < length; i++ {
+			elemOp(w, s, v.Index(i))
 		}
 	}
 }
 
-// EncOpForConformantStruct returns an NDR64 conformant data encoding function
-// for the given type, which must be a struct.
-func EncOpForConformantStruct(rt reflect.Type) (ndr.EncOp, []int) {
-	// TODO: Figure out a decent implementation for this in the ndr package
-	//       and then create the appropriate implementation here.
+// EncOpForSlice returns an NDR64 encoding function for the given type, which
+// must be a slice. The encoding function will encode the slice as a varying
+// array. Nested slices are encoded as a multi-dimensional varying array,
+// with the greatest length of the slices of each dimension as its count.
+func EncOpForSlice(rt reflect.Type) ndr.EncOp {
+	dimensions, elem := ndr.ArrayDimensions(rt)
+	elemOp := EncOpFor(elem)
+	return func(w ndr.Writer, s *ndr.State, v reflect.Value) {
+		subsets := ndr.SliceSubsets(dimensions, v)
+		EncSliceHeader(w, s, v, subsets)
+		ndr.EncSliceElements(w, s, v, subsets, elemOp)
+	}
+}
+
+// EncSliceHeader is an NDR64 encoding function for varying array headers,
+// which declare array offsets and counts.
+func EncSliceHeader(w ndr.Writer, s *ndr.State, v reflect.Value, subsets []ndr.SliceSubset) {
+	for _, subset := range subsets {
+		w.WriteUint64(uint64(subset.Offset))
+		w.WriteUint64(uint64(subset.Count))
+	}
+}
+
+// EncOpForStructConformance returns an NDR64 conformant data encoding function
+// for the given type, which must be a struct. The returned encoding function
+// operates on the struct member identified by the returned index.
+//
+// Conformance information is hoisted to the start of the outermost structure,
+// as it is in NDR, but each value occupies 64 bits.
+func EncOpForStructConformance(rt reflect.Type) (ndr.EncOp, []int) {
+	last := rt.NumField() - 1
+	if last < 0 {
+		return ndr.EncNoop, nil
+	}
+	f := rt.Field(last)
+	attrs := types.ParseFieldAttrList(f.Tag.Get("idl"))
+	switch f.Type.Kind() {
+	case reflect.Slice:
+		if attrs.IsConformant() {
+			return EncOpForSliceConformance(rt, f, attrs), nil
+		}
+	case reflect.Struct:
+		if ndr.IsConformantStruct(f.Type) {
+			op, index := EncOpForStructConformance(f.Type)
+			return op, append(append([]int(nil), f.Index...), index...)
+		}
+	}
 	return ndr.EncNoop, nil
 }
 
-// EncOpForStruct returns an NDR encoding function for the given type, which
-// must be a struct.
+// EncOpForSliceConformance returns an NDR64 encoding function for the
+// conformance of the given slice field of base, as described by the slice's
+// attributes. The maximum count of each dimension is encoded. The encoding
+// function operates on values of the base type.
+func EncOpForSliceConformance(base reflect.Type, slice reflect.StructField, attrs types.FieldAttrList) ndr.EncOp {
+	bounds, err := ndr.CompileFieldBounds(base, slice, attrs)
+	if err != nil {
+		return ndr.EncOpForError(err)
+	}
+	return func(w ndr.Writer, s *ndr.State, v reflect.Value) {
+		max, err := bounds.MaxCounts(v)
+		if err != nil {
+			s.AddError(err)
+			max = make([]int, len(bounds.Dimensions))
+		}
+		for _, m := range max {
+			w.WriteUint64(uint64(m))
+		}
+	}
+}
+
+// EncOpForArrayField returns an NDR64 encoding function for the given field
+// of base, which must be a slice with conformance or variance attributes, or
+// an array with variance attributes. The encoding function operates on values
+// of the base type, against which the attributes are evaluated. It encodes
+// the variance of each dimension, if the array is varying, and the
+// transmitted elements.
+func EncOpForArrayField(base reflect.Type, field reflect.StructField, attrs types.FieldAttrList) ndr.EncOp {
+	bounds, err := ndr.CompileFieldBounds(base, field, attrs)
+	if err != nil {
+		return ndr.EncOpForError(err)
+	}
+	elemOp := EncOpFor(bounds.Elem)
+	return func(w ndr.Writer, s *ndr.State, v reflect.Value) {
+		max, err := bounds.MaxCounts(v)
+		if err != nil {
+			s.AddError(err)
+			return
+		}
+		subsets, err := bounds.Subsets(v, max)
+		if err != nil {
+			s.AddError(err)
+			subsets = make([]ndr.SliceSubset, len(max))
+		}
+		array := v.FieldByIndex(field.Index)
+		if bounds.Varying {
+			EncSliceHeader(w, s, array, subsets)
+		}
+		ndr.EncSliceElements(w, s, array, subsets, elemOp)
+	}
+}
+
+// EncOpForStruct returns an NDR64 encoding function for the given type, which
+// must be a struct. If the struct contains conformant data its conformance
+// will be encoded before the struct members.
 func EncOpForStruct(rt reflect.Type) ndr.EncOp {
-	engine := make([]encInstr, 0, rt.NumField())
-	// TODO: Add alignment op?
-	if ndr.IsConformantStruct(rt) {
-		op, index := EncOpForConformantStruct(rt)
-		engine = append(engine, encInstr{
-			op:    op,
-			index: index,
-		})
+	body := encOpForStructMembers(rt)
+	if !ndr.IsConformantStruct(rt) {
+		return body
 	}
+	conformance, index := EncOpForStructConformance(rt)
+	return func(w ndr.Writer, s *ndr.State, v reflect.Value) {
+		conformance(w, s, v.FieldByIndex(index))
+		body(w, s, v)
+	}
+}
+
+// encOpForStructMembers returns an NDR64 encoding function for the members of
+// the given type, which must be a struct. The members are aligned to the
+// alignment of the struct and are followed by trailing padding.
+func encOpForStructMembers(rt reflect.Type) ndr.EncOp {
+	engine := make([]encInstr, 0, rt.NumField())
 	for i := 0; i < rt.NumField(); i++ {
 		f := rt.Field(i)
+		tag := f.Tag.Get("idl")
+		if tag == "-" {
+			continue
+		}
+		attrs := types.ParseFieldAttrList(tag)
+		if what := unsupported(f, attrs); what != "" {
+			engine = append(engine, encInstr{
+				op: ndr.EncOpForError(ndr.NewEncodingError(ndr.Unsupported, rt.Name(), f.Name, what, 0, 0)),
+			})
+			continue
+		}
+		if ndr.IsBoundedField(f, attrs) {
+			// The bounds of the array are evaluated against the struct.
+			engine = append(engine, encInstr{
+				op: EncOpForArrayField(rt, f, attrs),
+			})
+			continue
+		}
 		if op := EncOpForField(f); op != nil {
 			engine = append(engine, encInstr{
 				op:    op,
@@ -55,56 +172,150 @@ func EncOpForStruct(rt reflect.Type) ndr.EncOp {
 			})
 		}
 	}
+	alignment := Alignment(rt)
 	return func(w ndr.Writer, s *ndr.State, v reflect.Value) {
+		w.Align(alignment)
 		for i := 0; i < len(engine); i++ {
 			instr := &engine[i]
 			field := v.FieldByIndex(instr.index)
 			instr.op(w, s, field)
 		}
+		w.Align(alignment)
 	}
 }
 
-// EncOpForField returns an NDR encoding function for the given field.
+// EncOpForField returns an NDR64 encoding function for the given field.
 func EncOpForField(rf reflect.StructField) ndr.EncOp {
-	if op := ndr.EncOpForPrimitive(rf.Type); op != nil {
+	if op := ndr.EncOpForMarshaler(rf.Type); op != nil {
 		return op
 	}
-
 	attrs := types.ParseFieldAttrList(rf.Tag.Get("idl"))
+	if ndr.EnumSize(attrs) > 0 {
+		// NDR64 transmits all enums in 4 octets.
+		if op := ndr.EncOpForEnum(rf, 4); op != nil {
+			return op
+		}
+	}
+	if op := ndr.EncOpForPrimitive(rf.Type); op != nil {
+		return op
+	}
 
 	switch rf.Type.Kind() {
 	case reflect.Array:
-		return ndr.EncOpForArray(rf.Type)
+		return EncOpForArray(rf.Type)
 	case reflect.Slice:
+		// Slices with bounds attributes are encoded by EncOpForArrayField.
 		return EncOpForSlice(rf.Type)
 	case reflect.String:
 		if !attrs.IsConformant() && !attrs.IsVarying() {
 			// Do something
 		}
+	case reflect.Chan:
+		if ndr.IsPipe(rf.Type) {
+			return EncOpForPipe(rf.Type)
+		}
 	case reflect.Struct:
-		return EncOpForStruct(rf.Type)
+		// The conformance of embedded structs is hoisted to the start of the
+		// outermost struct.
+		return encOpForStructMembers(rf.Type)
 	case reflect.Ptr:
 		if attrs.Contains("ignore") {
-			return nil
+			return encNullPointer
 		}
 	}
 	return nil
 }
 
-// EncOpFor returns an NDR encoding function for the given type.
+// encNullPointer is an NDR64 encoding function for a pointer that is always
+// transmitted as null, such as a pointer with the ignore attribute.
+func encNullPointer(w ndr.Writer, s *ndr.State, v reflect.Value) {
+	w.WriteUint64(0)
+}
+
+// unsupported returns a description of the value held by the given field if
+// it is one that NDR64 cannot yet encode, or an empty string. Embedded
+// pointers, strings and unions are transmitted by NDR but not by NDR64.
+func unsupported(rf reflect.StructField, attrs types.FieldAttrList) string {
+	if ndr.IsMarshaler(rf.Type) {
+		return ""
+	}
+	switch {
+	case ndr.IsUnionField(rf, attrs), ndr.IsUnion(rf.Type):
+		return "a union"
+	case rf.Type.Kind() == reflect.Ptr && !attrs.Contains("ignore"):
+		return "a pointer"
+	case rf.Type.Kind() == reflect.Slice && ndr.IsPointerField(attrs):
+		return "a pointer"
+	case rf.Type.Kind() == reflect.String, ndr.IsFixedString(rf, attrs):
+		return "a string"
+	}
+	return ""
+}
+
+// EncOpFor returns an NDR64 encoding function for the given type.
 func EncOpFor(rt reflect.Type) ndr.EncOp {
+	if op := ndr.EncOpForMarshaler(rt); op != nil {
+		return op
+	}
 	if op := ndr.EncOpForPrimitive(rt); op != nil {
 		return op
 	}
 
 	switch rt.Kind() {
 	case reflect.Array:
+		return EncOpForArray(rt)
+	case reflect.Slice:
+		return EncOpForSlice(rt)
 	case reflect.String:
 		//if !attrs.IsConformant() && !attrs.IsVarying() {
 		// Do something
 		//}
+	case reflect.Chan:
+		if ndr.IsPipe(rt) {
+			return EncOpForPipe(rt)
+		}
 	case reflect.Struct:
+		switch {
+		case ndr.IsUnion(rt):
+			return ndr.EncOpForError(ndr.NewEncodingError(ndr.Unsupported, rt.Name(), "", "a union", 0, 0))
+		case ndr.IsParamList(rt):
+			return ndr.EncOpForError(ndr.NewEncodingError(ndr.Unsupported, rt.Name(), "", "a parameter list", 0, 0))
+		}
 		return EncOpForStruct(rt)
 	}
 	return nil
 }
+
+// Alignment returns the NDR64 alignment of the given type in octets.
+//
+// Primitives are aligned to their size. Structs are aligned to the largest
+// alignment of their members. Conformance and variance information is 64 bits
+// wide, so slices and pipes are always aligned to 8 octets. Types that implement
+// ndr.NDRMarshaler or ndr.NDRUnmarshaler declare their alignment with
+// ndr.NDRAligner.
+func Alignment(rt reflect.Type) int {
+	if ndr.IsMarshaler(rt) {
+		return ndr.MarshalerAlignment(rt)
+	}
+	switch rt.Kind() {
+	case reflect.Bool, reflect.Int8, reflect.Uint8:
+		return 1
+	case reflect.Int16, reflect.Uint16:
+		return 2
+	case reflect.Int32, reflect.Uint32, reflect.Float32:
+		return 4
+	case reflect.Int64, reflect.Uint64, reflect.Float64, reflect.Slice, reflect.Chan:
+		return 8
+	case reflect.Array:
+		return Alignment(rt.Elem())
+	case reflect.Struct:
+		alignment := 1
+		for i := 0; i < rt.NumField(); i++ {
+			if a := Alignment(rt.Field(i).Type); a > alignment {
+				alignment = a
+			}
+		}
+		return alignment
+	}
+	return 1
+}
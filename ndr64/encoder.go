@@ -1,6 +1,8 @@
 package ndr64
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"reflect"
 	"sync"
@@ -9,7 +11,11 @@ import (
 	"github.com/gentlemanautomaton/dcerpc/ndr"
 )
 
-// TODO: Store a separate type cache for each supported transfer syntax (NDR and NDR64)
+// ErrUnsupportedFormat is returned when an encoder or decoder is requested for
+// a data representation format other than little-endian, ASCII and IEEE,
+// which is the only format supported by NDR64.
+var ErrUnsupportedFormat = errors.New("ndr64: unsupported data representation format")
+
 var encTypeCache = ndr.NewEncoderTypeCache()
 
 // Encoder encodes Go types as NDR64 data and transmits them via an underlying
@@ -20,35 +26,41 @@ type Encoder struct {
 }
 
 // NewEncoder returns a new encoder that transmits NDR64-encoded values on the
-// given io.Writer. Writes are guarded by a mutex and are written atomicaly.
-func NewEncoder(w io.Writer) *Encoder {
-	return &Encoder{
-		w: ndr.NewWriter(w, formatlabel.LEAIEEE),
+// given io.Writer with the encoding represented by the provided format label.
+// Writes are guarded by a mutex and are written atomicaly.
+func NewEncoder(w io.Writer, format formatlabel.Format) (*Encoder, error) {
+	if format != formatlabel.LEAIEEE {
+		return nil, ErrUnsupportedFormat
 	}
+	return &Encoder{
+		w: ndr.NewWriter(w, format),
+	}, nil
 }
 
 // Encode encodes the given value in NDR64 and transmits the encoded value on
-// the underlying io.Writer.
+// the underlying io.Writer. If v is a pointer the value it points to is
+// encoded.
 func (enc *Encoder) Encode(v interface{}) error {
-	return enc.EncodeValue(reflect.ValueOf(v))
+	return enc.EncodeValue(reflect.Indirect(reflect.ValueOf(v)))
 }
 
 // EncodeValue encodes the given value in NDR64 and transmits the encoded value
 // on the underlying io.Writer.
 func (enc *Encoder) EncodeValue(v reflect.Value) error {
-	//enc.cache.RLock()
-
 	op := encTypeCache.Get(v.Type())
 	// TODO: Add pending mechanism to avoid duplication of effort
 	if op == nil {
-		op = ndr.EncOpFor(v.Type()) // TODO: Replace with ndr64 function call
+		op = EncOpFor(v.Type())
+		if op == nil {
+			return fmt.Errorf("ndr64: unable to encode values of type %s", v.Type())
+		}
 		encTypeCache.Add(v.Type(), op)
 	}
 
-	s := ndr.State{} // FIXME: Figure out how to handle state.
+	s := ndr.NewState() // FIXME: Figure out how the caller should provide state
 
 	enc.mutex.Lock()
-	op(enc.w, &s, v) // TOOD: Return error from op?
+	op(enc.w, s, v)
 	enc.mutex.Unlock()
-	return nil
+	return s.Err()
 }
@@ -0,0 +1,63 @@
+package ndr64
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gentlemanautomaton/dcerpc/formatlabel"
+	"github.com/gentlemanautomaton/dcerpc/ndr"
+)
+
+func TestEncodeUnsupported(t *testing.T) {
+	value := uint32(1)
+	tests := []struct {
+		name string
+		in   interface{}
+	}{
+		{"pointer", &struct{ P *uint32 }{P: &value}},
+		{"string", &struct{ S string }{S: "a"}},
+		{"array-pointer", &struct {
+			N    uint32
+			Data []uint16 `idl:"size_is(N),unique"`
+		}{}},
+		{"union", &struct {
+			Kind uint16
+			Long int32 `idl:"case(1)"`
+		}{}},
+		{"params", &struct {
+			N uint32 `idl:"in"`
+		}{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc, _ := NewEncoder(&buf, formatlabel.LEAIEEE)
+			err := enc.Encode(tt.in)
+			if e, ok := err.(*ndr.EncodingError); !ok || e.Code != ndr.Unsupported {
+				t.Fatalf("Encode returned %v, want an unsupported type error", err)
+			}
+			dec, _ := NewDecoder(bytes.NewReader(make([]byte, 16)), formatlabel.LEAIEEE)
+			err = dec.Decode(tt.in)
+			if e, ok := err.(*ndr.EncodingError); !ok || e.Code != ndr.Unsupported {
+				t.Fatalf("Decode returned %v, want an unsupported type error", err)
+			}
+		})
+	}
+}
+
+func TestEncodeSkipped(t *testing.T) {
+	in := struct {
+		Skip  uint32 `idl:"-"`
+		Value uint16
+		P     *uint32 `idl:"ignore"`
+	}{Skip: 1, Value: 2}
+	want := []byte{2, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	var buf bytes.Buffer
+	enc, _ := NewEncoder(&buf, formatlabel.LEAIEEE)
+	if err := enc.Encode(&in); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("encoded % x, want % x", buf.Bytes(), want)
+	}
+}
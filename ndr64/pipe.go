@@ -0,0 +1,41 @@
+package ndr64
+
+import (
+	"reflect"
+
+	"github.com/gentlemanautomaton/dcerpc/ndr"
+)
+
+// EncOpForPipe returns an NDR64 encoding function for the given type, which
+// must be a pipe. Pipes are transmitted in chunks as they are in NDR, but
+// chunk counts are 64 bits wide.
+func EncOpForPipe(rt reflect.Type) ndr.EncOp {
+	elemOp := EncOpFor(rt.Elem())
+	if elemOp == nil {
+		return nil
+	}
+	return func(w ndr.Writer, s *ndr.State, v reflect.Value) {
+		ndr.EncPipeChunks(w, s, v, elemOp, encPipeCount)
+	}
+}
+
+// DecOpForPipe returns an NDR64 decoding function for the given type, which
+// must be a pipe.
+func DecOpForPipe(rt reflect.Type) ndr.DecOp {
+	elemOp := DecOpFor(rt.Elem())
+	if elemOp == nil {
+		return nil
+	}
+	return func(r ndr.Reader, s *ndr.State, v reflect.Value) error {
+		return ndr.DecPipeChunks(r, s, v, elemOp, decPipeCount)
+	}
+}
+
+func encPipeCount(w ndr.Writer, n int) {
+	w.WriteUint64(uint64(n))
+}
+
+func decPipeCount(r ndr.Reader) (int, error) {
+	n, err := r.ReadUint64()
+	return int(n), err
+}
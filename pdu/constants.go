@@ -57,13 +57,23 @@ const (
 	// connection-oriented protocol.
 	TypeAlterContextResp
 
+	// TypeAuth3 indicates an rpc_auth_3 packet in the connection-oriented
+	// protocol, as specified by the MS-RPCE extensions.
+	TypeAuth3
+
 	// TypeShutdown indicates a shutdown packet in the connection-oriented
 	// protocol.
 	TypeShutdown
 
 	// TypeCancelCO indicates a cancel packet in the connection-oriented protocol.
 	TypeCancelCO
+
 	// TypeOrphaned indicates an orphaned packet in the connection-oriented
 	// protocol.
 	TypeOrphaned
+
+	// TypeRTS indicates an rts packet in the connection-oriented protocol,
+	// which is used by the RPC over HTTP protocol to manage the virtual
+	// connection that carries an association.
+	TypeRTS
 )
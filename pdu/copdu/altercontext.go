@@ -1,6 +1,21 @@
 package copdu
 
+import "github.com/gentlemanautomaton/dcerpc/pdu"
+
 // AlterContext represents an alter_context PDU in the connection-oriented
 // protocol. It is sent from the client to the server. Its format is identical
 // to Bind.
 type AlterContext Bind
+
+// PacketType returns the packet type of an alter_context PDU.
+func (a *AlterContext) PacketType() uint8 {
+	return pdu.TypeAlterContext
+}
+
+func (a *AlterContext) encode(e *encoder) {
+	(*Bind)(a).encode(e)
+}
+
+func (a *AlterContext) decode(d *decoder) {
+	(*Bind)(a).decode(d)
+}
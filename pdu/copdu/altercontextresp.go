@@ -0,0 +1,21 @@
+package copdu
+
+import "github.com/gentlemanautomaton/dcerpc/pdu"
+
+// AlterContextResp represents an alter_context_resp PDU in the
+// connection-oriented protocol. It is sent from the server to the client in
+// response to an alter_context PDU. Its format is identical to BindAck.
+type AlterContextResp BindAck
+
+// PacketType returns the packet type of an alter_context_resp PDU.
+func (a *AlterContextResp) PacketType() uint8 {
+	return pdu.TypeAlterContextResp
+}
+
+func (a *AlterContextResp) encode(e *encoder) {
+	(*BindAck)(a).encode(e)
+}
+
+func (a *AlterContextResp) decode(d *decoder) {
+	(*BindAck)(a).decode(d)
+}
@@ -0,0 +1,168 @@
+package copdu
+
+import (
+	"errors"
+	"io"
+
+	"github.com/gentlemanautomaton/dcerpc/pdu"
+)
+
+// AuthTrailerLength is the encoded length of the sec_trailer that precedes
+// the authentication value of a PDU.
+const AuthTrailerLength = 8
+
+// ErrInvalidAuth is returned when the auth verifier of a PDU is malformed.
+var ErrInvalidAuth = errors.New("copdu: invalid auth verifier")
+
+// AuthVerifier is the optional authentication verifier that follows the body
+// of a PDU. It consists of a sec_trailer followed by an authentication value,
+// the length of which is recorded in the AuthLength field of the header.
+//
+// The fields of the sec_trailer are described in section 13.2.6.1 of the
+// DCE RPC publication and in section 2.2.2.11 of the MS-RPCE publication.
+type AuthVerifier struct {
+	// Type identifies the authentication service.
+	Type uint8
+
+	// Level is the authentication level.
+	Level uint8
+
+	// PadLength is the number of padding octets inserted between the body and
+	// the sec_trailer. It is calculated automatically when the PDU is
+	// marshaled.
+	PadLength uint8
+
+	_ uint8 // Reserved
+
+	// ContextID identifies the security context within the association.
+	ContextID uint32
+
+	// Value holds the authentication token or signature.
+	Value []byte
+}
+
+// stubBody is implemented by the bodies of PDUs that carry stub data.
+type stubBody interface {
+	stubData() []byte
+}
+
+func (r *Request) stubData() []byte  { return r.Stub }
+func (r *Response) stubData() []byte { return r.Stub }
+func (f *Fault) stubData() []byte    { return f.Stub }
+
+// encodeAuth pads the PDU and appends the auth verifier to it.
+//
+// For PDUs that carry stub data the padding aligns the sec_trailer to a
+// 16-octet boundary relative to the start of the stub data. For all other
+// PDUs it aligns the sec_trailer to a 4-octet boundary.
+func encodeAuth(e *encoder, body Body, a *AuthVerifier) {
+	var pad int
+	if sb, ok := body.(stubBody); ok {
+		pad = (16 - len(sb.stubData())%16) % 16
+	} else {
+		pad = (4 - len(e.buf)%4) % 4
+	}
+	for i := 0; i < pad; i++ {
+		e.uint8(0)
+	}
+	a.PadLength = uint8(pad)
+	e.uint8(a.Type)
+	e.uint8(a.Level)
+	e.uint8(a.PadLength)
+	e.uint8(0)
+	e.uint32(a.ContextID)
+	e.bytes(a.Value)
+	e.header.AuthLength = uint16(len(a.Value))
+}
+
+// AuthLayout describes the location of the protected regions within a
+// marshaled PDU that carries an auth verifier. Each field is an offset from
+// the start of the PDU.
+type AuthLayout struct {
+	Stub    int // The start of the stub data, or Pad if there is none
+	Pad     int // The start of the auth padding
+	Trailer int // The start of the sec_trailer
+	Value   int // The start of the authentication value
+	End     int // The end of the PDU
+}
+
+// Layout returns the layout of the auth verifier within b, which must hold a
+// complete PDU fragment.
+func Layout(b []byte) (layout AuthLayout, err error) {
+	var h Header
+	if err := h.Unmarshal(b); err != nil {
+		return layout, err
+	}
+	layout.End = int(h.FragLength)
+	layout.Value = layout.End - int(h.AuthLength)
+	layout.Trailer = layout.Value - AuthTrailerLength
+	if h.AuthLength == 0 || layout.End > len(b) || layout.Trailer < HeaderLength {
+		return layout, ErrInvalidAuth
+	}
+	layout.Pad = layout.Trailer - int(b[layout.Trailer+2])
+	layout.Stub = layout.Pad
+	switch h.PacketType {
+	case pdu.TypeRequest:
+		layout.Stub = HeaderLength + 8
+		if h.Flags&ObjectUUID != 0 {
+			layout.Stub += 16
+		}
+	case pdu.TypeResponse:
+		layout.Stub = HeaderLength + 8
+	case pdu.TypeFault:
+		layout.Stub = HeaderLength + 16
+	}
+	if layout.Stub > layout.Pad || layout.Pad < HeaderLength {
+		return layout, ErrInvalidAuth
+	}
+	return layout, nil
+}
+
+// decodeAuth decodes the auth verifier at the end of the PDU and limits the
+// body of the PDU so that it excludes the auth padding.
+func decodeAuth(d *decoder) *AuthVerifier {
+	trailer := d.end - int(d.header.AuthLength) - AuthTrailerLength
+	if trailer < HeaderLength {
+		d.err = ErrInvalidAuth
+		return nil
+	}
+	b := d.buf[trailer:d.end]
+	a := &AuthVerifier{
+		Type:      b[0],
+		Level:     b[1],
+		PadLength: b[2],
+		ContextID: d.order.Uint32(b[4:8]),
+		Value:     append([]byte(nil), b[AuthTrailerLength:]...),
+	}
+	d.end = trailer - int(a.PadLength)
+	if d.end < HeaderLength {
+		d.err = ErrInvalidAuth
+		return nil
+	}
+	return a
+}
+
+// ReadFragment reads the binary representation of a single PDU fragment from
+// r without unmarshaling it.
+func ReadFragment(r io.Reader) ([]byte, error) {
+	var hdr [HeaderLength]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	var h Header
+	if err := h.Unmarshal(hdr[:]); err != nil {
+		return nil, err
+	}
+	if h.FragLength < HeaderLength {
+		return nil, ErrTruncated
+	}
+	b := make([]byte, h.FragLength)
+	copy(b, hdr[:])
+	if _, err := io.ReadFull(r, b[HeaderLength:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return b, nil
+}
@@ -0,0 +1,29 @@
+package copdu
+
+import "github.com/gentlemanautomaton/dcerpc/pdu"
+
+// Auth3 represents an rpc_auth_3 PDU in the connection-oriented protocol. It
+// is sent by the client to deliver the final leg of a three-leg
+// authentication exchange. The server does not respond to it.
+//
+// The body of the PDU consists of padding; the authentication token is
+// carried by its auth verifier.
+type Auth3 struct {
+	_ [4]uint8 // Padding
+}
+
+// PacketType returns the packet type of an rpc_auth_3 PDU.
+func (a *Auth3) PacketType() uint8 {
+	return pdu.TypeAuth3
+}
+
+func (a *Auth3) encode(e *encoder) {
+	e.uint32(0)
+}
+
+func (a *Auth3) decode(d *decoder) {
+	// Some implementations omit the padding, so it is not required.
+	if d.end-d.off >= 4 {
+		d.skip(4)
+	}
+}
@@ -0,0 +1,116 @@
+package copdu
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/gentlemanautomaton/dcerpc/formatlabel"
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationcontext"
+)
+
+// testAuthPDUs are PDUs with auth verifiers and their encodings.
+var testAuthPDUs = []struct {
+	name   string
+	pdu    PDU
+	want   []byte
+	layout AuthLayout
+}{
+	{
+		// The sec_trailer is aligned to 16 octets from the start of the
+		// stub data.
+		name: "request",
+		pdu: PDU{
+			Header: Header{Flags: FirstFrag | LastFrag, Format: formatlabel.LEAIEEE, CallID: 2},
+			Body:   &Request{AllocHint: 5, PresContextID: 1, OpNum: 3, Stub: []byte{1, 2, 3, 4, 5}},
+			Auth:   &AuthVerifier{Type: 0x0a, Level: 6, ContextID: 7, Value: []byte{0xaa, 0xbb, 0xcc, 0xdd}},
+		},
+		want: []byte{
+			0x05, 0x00, 0x00, 0x03, 0x10, 0x00, 0x00, 0x00, // Header
+			0x34, 0x00, 0x04, 0x00, 0x02, 0x00, 0x00, 0x00,
+			0x05, 0x00, 0x00, 0x00, 0x01, 0x00, 0x03, 0x00, // Alloc hint, context ID and opnum
+			0x01, 0x02, 0x03, 0x04, 0x05, // Stub data
+			0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // Auth padding
+			0x0a, 0x06, 0x0b, 0x00, 0x07, 0x00, 0x00, 0x00, // sec_trailer
+			0xaa, 0xbb, 0xcc, 0xdd, // Auth value
+		},
+		layout: AuthLayout{Stub: 24, Pad: 29, Trailer: 40, Value: 48, End: 52},
+	},
+	{
+		// The sec_trailer of a PDU without stub data is aligned to 4
+		// octets.
+		name: "bind_nak",
+		pdu: PDU{
+			Header: Header{Flags: FirstFrag | LastFrag, Format: formatlabel.LEAIEEE, CallID: 1},
+			Body:   &BindNak{RejectReason: presentationcontext.ReasonNotSpecified, Versions: []Version{{Major: 5}}},
+			Auth:   &AuthVerifier{Type: 0x0a, Level: 2, ContextID: 1, Value: []byte{0xaa, 0xbb}},
+		},
+		want: []byte{
+			0x05, 0x00, 0x0d, 0x03, 0x10, 0x00, 0x00, 0x00, // Header
+			0x22, 0x00, 0x02, 0x00, 0x01, 0x00, 0x00, 0x00,
+			0x00, 0x00, 0x01, 0x05, 0x00, // Reject reason and versions
+			0x00, 0x00, 0x00, // Auth padding
+			0x0a, 0x02, 0x03, 0x00, 0x01, 0x00, 0x00, 0x00, // sec_trailer
+			0xaa, 0xbb, // Auth value
+		},
+		layout: AuthLayout{Stub: 21, Pad: 21, Trailer: 24, Value: 32, End: 34},
+	},
+}
+
+func TestAuthVerifier(t *testing.T) {
+	for _, tt := range testAuthPDUs {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := tt.pdu.Marshal()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, tt.want) {
+				t.Fatalf("marshaled % x, want % x", b, tt.want)
+			}
+
+			layout, err := Layout(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if layout != tt.layout {
+				t.Fatalf("layout is %+v, want %+v", layout, tt.layout)
+			}
+
+			var p PDU
+			if err := p.Unmarshal(b); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(p.Body, tt.pdu.Body) || !reflect.DeepEqual(p.Auth, tt.pdu.Auth) {
+				t.Fatalf("unmarshaled %+v with %+v, want %+v with %+v", p.Body, p.Auth, tt.pdu.Body, tt.pdu.Auth)
+			}
+		})
+	}
+}
+
+func TestAuthVerifierInvalid(t *testing.T) {
+	request := testAuthPDUs[0].want
+	tests := []struct {
+		name   string
+		mangle func(b []byte)
+	}{
+		// The padding extends into the request header.
+		{"pad-length", func(b []byte) { b[42] = 20 }},
+		// The padding extends into the common header.
+		{"pad-length-header", func(b []byte) { b[42] = 40 }},
+		// The auth value is longer than the fragment.
+		{"auth-length", func(b []byte) { b[10] = 0x40 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := append([]byte(nil), request...)
+			tt.mangle(b)
+			if _, err := Layout(b); err != ErrInvalidAuth {
+				t.Errorf("Layout returned %v, want %v", err, ErrInvalidAuth)
+			}
+			var p PDU
+			if err := p.Unmarshal(b); err == nil {
+				t.Errorf("unmarshaled %+v with %+v", p.Body, p.Auth)
+			}
+		})
+	}
+}
@@ -1,12 +1,14 @@
 package copdu
 
-import "github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationcontext"
+import (
+	"github.com/gentlemanautomaton/dcerpc/pdu"
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationcontext"
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationsyntax"
+)
 
 // Bind represents a bind PDU in the connection-oriented protocol. It is sent
 // from the client to the server.
 type Bind struct {
-	// TODO: Decide whether we include the header here or not
-
 	// MaxTransmitFrag is the maximum fragment size the client would like to
 	// transmit.
 	MaxTransmitFrag uint16
@@ -22,6 +24,62 @@ type Bind struct {
 	// Elements is a variable-length ordered list of supported presentation
 	// syntaxes that the client is offering for negotiation.
 	Elements presentationcontext.List
+}
+
+// PacketType returns the packet type of a bind PDU.
+func (b *Bind) PacketType() uint8 {
+	return pdu.TypeBind
+}
+
+func (b *Bind) encode(e *encoder) {
+	e.uint16(b.MaxTransmitFrag)
+	e.uint16(b.MaxReceiveFrag)
+	e.uint32(b.AssocGroupID)
+	encodeList(e, &b.Elements)
+}
+
+func (b *Bind) decode(d *decoder) {
+	b.MaxTransmitFrag = d.uint16()
+	b.MaxReceiveFrag = d.uint16()
+	b.AssocGroupID = d.uint32()
+	decodeList(d, &b.Elements)
+}
+
+func encodeList(e *encoder, list *presentationcontext.List) {
+	e.uint8(uint8(len(list.Elements)))
+	e.uint8(0)
+	e.uint16(0)
+	for i := range list.Elements {
+		elem := &list.Elements[i]
+		e.uint16(uint16(elem.ID))
+		e.uint8(uint8(len(elem.TransferSyntaxes)))
+		e.uint8(0)
+		e.syntax(elem.AbstractSyntax)
+		for _, ts := range elem.TransferSyntaxes {
+			e.syntax(ts)
+		}
+	}
+}
 
-	// TODO: Handle optional auth verifier, probably as a separate struct or something.
+func decodeList(d *decoder, list *presentationcontext.List) {
+	list.NumElements = d.uint8()
+	d.skip(3)
+	if d.err != nil {
+		return
+	}
+	list.Elements = make([]presentationcontext.Element, list.NumElements)
+	for i := range list.Elements {
+		elem := &list.Elements[i]
+		elem.ID = presentationcontext.ID(d.uint16())
+		elem.NumTransferSyntaxes = d.uint8()
+		d.skip(1)
+		elem.AbstractSyntax = d.syntax()
+		if d.err != nil {
+			return
+		}
+		elem.TransferSyntaxes = make([]presentationsyntax.ID, elem.NumTransferSyntaxes)
+		for t := range elem.TransferSyntaxes {
+			elem.TransferSyntaxes[t] = d.syntax()
+		}
+	}
 }
@@ -1,12 +1,13 @@
 package copdu
 
-import "github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationcontext"
+import (
+	"github.com/gentlemanautomaton/dcerpc/pdu"
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationcontext"
+)
 
 // BindAck represents a bind acknowledgment PDU in the connection-oriented
 // protocol. It is sent from the server to the client.
 type BindAck struct {
-	// TODO: Decide whether we include the header here or not
-
 	// MaxTransmitFrag is the negotiated maximum fragment size selected by the
 	// server.
 	MaxTransmitFrag uint16
@@ -19,12 +20,64 @@ type BindAck struct {
 	// associated with.
 	AssocGroupID uint32
 
-	// TODO: Add secondary address field
-
-	// TODO: Align(4)
+	// SecondaryAddress is the optional secondary address of the server, which
+	// is typically the port or pipe on which it is listening.
+	SecondaryAddress string
 
 	// Results contains the results of the presentation context negotiation.
 	Results presentationcontext.ResultList
+}
+
+// PacketType returns the packet type of a bind_ack PDU.
+func (b *BindAck) PacketType() uint8 {
+	return pdu.TypeBindAck
+}
+
+func (b *BindAck) encode(e *encoder) {
+	e.uint16(b.MaxTransmitFrag)
+	e.uint16(b.MaxReceiveFrag)
+	e.uint32(b.AssocGroupID)
+	if b.SecondaryAddress == "" {
+		e.uint16(0)
+	} else {
+		e.uint16(uint16(len(b.SecondaryAddress) + 1))
+		e.bytes([]byte(b.SecondaryAddress))
+		e.uint8(0)
+	}
+	e.align(4)
+	e.uint8(uint8(len(b.Results.Results)))
+	e.uint8(0)
+	e.uint16(0)
+	for i := range b.Results.Results {
+		result := &b.Results.Results[i]
+		e.uint16(uint16(result.Result))
+		e.uint16(uint16(result.Reason))
+		e.syntax(result.TransferSyntax)
+	}
+}
 
-	// TODO: Handle optional auth verifier, probably as a separate struct or something.
+func (b *BindAck) decode(d *decoder) {
+	b.MaxTransmitFrag = d.uint16()
+	b.MaxReceiveFrag = d.uint16()
+	b.AssocGroupID = d.uint32()
+	if n := int(d.uint16()); n > 0 {
+		addr := d.bytes(n)
+		if len(addr) > 0 && addr[len(addr)-1] == 0 {
+			addr = addr[:len(addr)-1]
+		}
+		b.SecondaryAddress = string(addr)
+	}
+	d.align(4)
+	b.Results.NumResults = d.uint8()
+	d.skip(3)
+	if d.err != nil {
+		return
+	}
+	b.Results.Results = make([]presentationcontext.ResultElement, b.Results.NumResults)
+	for i := range b.Results.Results {
+		result := &b.Results.Results[i]
+		result.Result = presentationcontext.Result(d.uint16())
+		result.Reason = presentationcontext.Reason(d.uint16())
+		result.TransferSyntax = d.syntax()
+	}
 }
@@ -1,14 +1,59 @@
 package copdu
 
-import "github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationcontext"
+import (
+	"github.com/gentlemanautomaton/dcerpc/pdu"
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationcontext"
+)
 
 // BindNak represents a bind rejection PDU in the connection-oriented
 // protocol. It is sent from the server to the client.
 type BindNak struct {
-	// TODO: Decide whether we include the header here or not
-
 	// RejectReason indicates why the binding was rejected.
 	RejectReason presentationcontext.Reason
 
-	// TODO: Add array of protocol versions supported
+	// Versions is the list of protocol versions supported by the server.
+	Versions []Version
+}
+
+// Reasons for rejecting a bind, which are carried by bind_nak PDUs. These are
+// distinct from the reasons for rejecting a presentation context.
+const (
+	RejectReasonNotSpecified              presentationcontext.Reason = 0
+	RejectTemporaryCongestion             presentationcontext.Reason = 1
+	RejectLocalLimitExceeded              presentationcontext.Reason = 2
+	RejectProtocolVersionNotSupported     presentationcontext.Reason = 4
+	RejectAuthenticationTypeNotRecognized presentationcontext.Reason = 8
+	RejectInvalidChecksum                 presentationcontext.Reason = 9
+)
+
+// Version identifies a version of the connection-oriented protocol.
+type Version struct {
+	Major uint8
+	Minor uint8
+}
+
+// PacketType returns the packet type of a bind_nak PDU.
+func (b *BindNak) PacketType() uint8 {
+	return pdu.TypeBindNak
+}
+
+func (b *BindNak) encode(e *encoder) {
+	e.uint16(uint16(b.RejectReason))
+	e.uint8(uint8(len(b.Versions)))
+	for _, v := range b.Versions {
+		e.uint8(v.Major)
+		e.uint8(v.Minor)
+	}
+}
+
+func (b *BindNak) decode(d *decoder) {
+	b.RejectReason = presentationcontext.Reason(d.uint16())
+	n := int(d.uint8())
+	if d.err != nil {
+		return
+	}
+	b.Versions = make([]Version, 0, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		b.Versions = append(b.Versions, Version{Major: d.uint8(), Minor: d.uint8()})
+	}
 }
@@ -1,8 +1,16 @@
 package copdu
 
+import "github.com/gentlemanautomaton/dcerpc/pdu"
+
 // Cancel represents a cancellation PDU in the connection-oriented protocol.
 type Cancel struct {
-	// TODO: Decide whether we include the header here or not
+}
 
-	// TODO: Handle optional auth verifier, probably as a separate struct or something.
+// PacketType returns the packet type of a cancel PDU.
+func (c *Cancel) PacketType() uint8 {
+	return pdu.TypeCancelCO
 }
+
+func (c *Cancel) encode(e *encoder) {}
+
+func (c *Cancel) decode(d *decoder) {}
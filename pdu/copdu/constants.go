@@ -9,6 +9,11 @@ const (
 	// PendingCancel indicates that a cancellation was pending when the PDU was
 	// sent.
 	PendingCancel = 0x04
+	// SupportHeaderSign indicates that the sender supports signing of the PDU
+	// header and sec_trailer. It shares its value with PendingCancel and is
+	// only meaningful in bind, bind_ack, alter_context and
+	// alter_context_resp PDUs.
+	SupportHeaderSign = 0x04
 	// ConcurrentMultiplexing indicates that the underlying connection supports
 	// concurrent multiplexing.
 	ConcurrentMultiplexing = 0x10
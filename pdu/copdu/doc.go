@@ -3,5 +3,6 @@
 // Call" technical standard.
 //
 // The structures defined in this package are suitable for serialization via
-// the ndr package.
+// the ndr package. Complete PDUs can also be marshaled directly to and from
+// their wire representation with the PDU type.
 package copdu
@@ -0,0 +1,162 @@
+package copdu
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/gentlemanautomaton/dcerpc/formatlabel"
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationsyntax"
+	"github.com/gentlemanautomaton/dcerpc/uuid"
+)
+
+// ErrTruncated is returned when a PDU is shorter than its contents require.
+var ErrTruncated = errors.New("copdu: truncated protocol data unit")
+
+// ByteOrder returns the byte order used for multi-octet integers by the
+// given format label.
+func ByteOrder(format formatlabel.Format) binary.ByteOrder {
+	if format.IntRep() == formatlabel.LittleEndian {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}
+
+// encoder appends PDU fields to a buffer. Alignment is calculated relative to
+// the start of the buffer, which is the start of the PDU header.
+type encoder struct {
+	header *Header
+	order  binary.ByteOrder
+	buf    []byte
+}
+
+func (e *encoder) align(modulo int) {
+	for len(e.buf)%modulo != 0 {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *encoder) uint8(v uint8) {
+	e.buf = append(e.buf, v)
+}
+
+func (e *encoder) uint16(v uint16) {
+	var b [2]byte
+	e.order.PutUint16(b[:], v)
+	e.buf = append(e.buf, b[:]...)
+}
+
+func (e *encoder) uint32(v uint32) {
+	var b [4]byte
+	e.order.PutUint32(b[:], v)
+	e.buf = append(e.buf, b[:]...)
+}
+
+func (e *encoder) bytes(v []byte) {
+	e.buf = append(e.buf, v...)
+}
+
+// uuid appends u in its NDR representation, in which the first three fields
+// are integers that follow the byte order of the format label.
+func (e *encoder) uuid(u uuid.UUID) {
+	e.uint32(binary.BigEndian.Uint32(u[0:4]))
+	e.uint16(binary.BigEndian.Uint16(u[4:6]))
+	e.uint16(binary.BigEndian.Uint16(u[6:8]))
+	e.bytes(u[8:16])
+}
+
+func (e *encoder) syntax(id presentationsyntax.ID) {
+	e.uuid(id.Interface)
+	e.uint32(id.Version)
+}
+
+// decoder consumes PDU fields from a buffer. The first error encountered is
+// retained and all subsequent reads return zero values.
+type decoder struct {
+	header *Header
+	order  binary.ByteOrder
+	buf    []byte // Entire PDU, including the header
+	end    int    // Offset of the end of the PDU body
+	off    int    // Current read offset
+	err    error
+}
+
+func (d *decoder) need(n int) bool {
+	if d.err != nil {
+		return false
+	}
+	if d.off+n > d.end {
+		d.err = ErrTruncated
+		return false
+	}
+	return true
+}
+
+func (d *decoder) align(modulo int) {
+	if m := d.off % modulo; m != 0 {
+		d.skip(modulo - m)
+	}
+}
+
+func (d *decoder) skip(n int) {
+	if d.need(n) {
+		d.off += n
+	}
+}
+
+func (d *decoder) uint8() (v uint8) {
+	if d.need(1) {
+		v = d.buf[d.off]
+		d.off++
+	}
+	return
+}
+
+func (d *decoder) uint16() (v uint16) {
+	if d.need(2) {
+		v = d.order.Uint16(d.buf[d.off:])
+		d.off += 2
+	}
+	return
+}
+
+func (d *decoder) uint32() (v uint32) {
+	if d.need(4) {
+		v = d.order.Uint32(d.buf[d.off:])
+		d.off += 4
+	}
+	return
+}
+
+func (d *decoder) bytes(n int) (v []byte) {
+	if d.need(n) {
+		v = make([]byte, n)
+		copy(v, d.buf[d.off:])
+		d.off += n
+	}
+	return
+}
+
+// remaining returns a copy of the unread portion of the PDU body.
+func (d *decoder) remaining() []byte {
+	if d.err != nil || d.off >= d.end {
+		return nil
+	}
+	return d.bytes(d.end - d.off)
+}
+
+func (d *decoder) uuid() (u uuid.UUID) {
+	binary.BigEndian.PutUint32(u[0:4], d.uint32())
+	binary.BigEndian.PutUint16(u[4:6], d.uint16())
+	binary.BigEndian.PutUint16(u[6:8], d.uint16())
+	if d.need(8) {
+		copy(u[8:16], d.buf[d.off:])
+		d.off += 8
+	}
+	return
+}
+
+func (d *decoder) syntax() (id presentationsyntax.ID) {
+	id.Interface = d.uuid()
+	id.Version = d.uint32()
+	return
+}
@@ -1,11 +1,12 @@
 package copdu
 
-import "github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationcontext"
+import (
+	"github.com/gentlemanautomaton/dcerpc/pdu"
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationcontext"
+)
 
 // Fault represents a fault PDU in the connection-oriented protocol.
 type Fault struct {
-	// TODO: Decide whether we include the header here or not
-
 	// AllocHint is an optional suggested buffer size provided by the sender of
 	// a fragmented PDU series. When used, it indiciates the amount of memory
 	// required to hold the entire series of fragmented requests in a contiguous
@@ -32,7 +33,32 @@ type Fault struct {
 
 	_ [4]uint8 // Reserved / 8-octet alignment
 
-	// TODO: Add stub data, 8-octet aligned
+	// Stub is the optional stub data of the fault, which begins on an 8-octet
+	// boundary. It is only present for application errors.
+	Stub []byte
+}
+
+// PacketType returns the packet type of a fault PDU.
+func (f *Fault) PacketType() uint8 {
+	return pdu.TypeFault
+}
+
+func (f *Fault) encode(e *encoder) {
+	e.uint32(f.AllocHint)
+	e.uint16(uint16(f.PresContextID))
+	e.uint8(f.CancelCount)
+	e.uint8(0)
+	e.uint32(f.Status)
+	e.uint32(0)
+	e.bytes(f.Stub)
+}
 
-	// TODO: Handle optional auth verifier, probably as a separate struct or something.
+func (f *Fault) decode(d *decoder) {
+	f.AllocHint = d.uint32()
+	f.PresContextID = presentationcontext.ID(d.uint16())
+	f.CancelCount = d.uint8()
+	d.skip(1)
+	f.Status = d.uint32()
+	d.skip(4)
+	f.Stub = d.remaining()
 }
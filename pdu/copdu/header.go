@@ -1,6 +1,18 @@
 package copdu
 
-import "github.com/gentlemanautomaton/dcerpc/formatlabel"
+import (
+	"errors"
+
+	"github.com/gentlemanautomaton/dcerpc/formatlabel"
+)
+
+// HeaderLength is the encoded length of the common header of all
+// connection-oriented protocol data units.
+const HeaderLength = 16
+
+// ErrUnsupportedVersion is returned when a PDU carries a protocol version
+// other than 5.
+var ErrUnsupportedVersion = errors.New("copdu: unsupported protocol version")
 
 // Header represents the common header data shared by all connection-oriented
 // protocol data units.
@@ -18,3 +30,37 @@ type Header struct {
 	AuthLength   uint16 // Byte order depends on format
 	CallID       uint32 // Byte order depends on format
 }
+
+// Marshal marshals the header as a binary representation stored in p. If
+// len(p) is less than HeaderLength, Marshal will panic.
+func (h *Header) Marshal(p []byte) {
+	order := ByteOrder(h.Format)
+	p[0] = h.VersionMajor
+	p[1] = h.VersionMinor
+	p[2] = h.PacketType
+	p[3] = h.Flags
+	copy(p[4:8], h.Format[:])
+	order.PutUint16(p[8:10], h.FragLength)
+	order.PutUint16(p[10:12], h.AuthLength)
+	order.PutUint32(p[12:16], h.CallID)
+}
+
+// Unmarshal unmarshals the header from the binary representation stored in p.
+func (h *Header) Unmarshal(p []byte) error {
+	if len(p) < HeaderLength {
+		return ErrTruncated
+	}
+	h.VersionMajor = p[0]
+	h.VersionMinor = p[1]
+	h.PacketType = p[2]
+	h.Flags = p[3]
+	copy(h.Format[:], p[4:8])
+	order := ByteOrder(h.Format)
+	h.FragLength = order.Uint16(p[8:10])
+	h.AuthLength = order.Uint16(p[10:12])
+	h.CallID = order.Uint32(p[12:16])
+	if h.VersionMajor != 5 {
+		return ErrUnsupportedVersion
+	}
+	return nil
+}
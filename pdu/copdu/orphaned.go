@@ -1,8 +1,16 @@
 package copdu
 
+import "github.com/gentlemanautomaton/dcerpc/pdu"
+
 // Orphaned represents an orphaned PDU in the connection-oriented protocol.
 type Orphaned struct {
-	// TODO: Decide whether we include the header here or not
+}
 
-	// TODO: Handle optional auth verifier, probably as a separate struct or something.
+// PacketType returns the packet type of an orphaned PDU.
+func (o *Orphaned) PacketType() uint8 {
+	return pdu.TypeOrphaned
 }
+
+func (o *Orphaned) encode(e *encoder) {}
+
+func (o *Orphaned) decode(d *decoder) {}
@@ -0,0 +1,151 @@
+package copdu
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/gentlemanautomaton/dcerpc/pdu"
+)
+
+// MinFragmentBufferSize is the initial capacity of buffers allocated for
+// marshaling PDUs.
+const MinFragmentBufferSize = 1024
+
+// ErrFragmentTooLarge is returned when a PDU exceeds the maximum encodable
+// fragment length.
+var ErrFragmentTooLarge = errors.New("copdu: fragment length exceeds 65535 octets")
+
+// Body is implemented by the type-specific portion of each connection-oriented
+// protocol data unit.
+type Body interface {
+	// PacketType returns the type of PDU that the body belongs to.
+	PacketType() uint8
+
+	encode(e *encoder)
+	decode(d *decoder)
+}
+
+// PDU is a complete connection-oriented protocol data unit, which consists of
+// a common header followed by a type-specific body and an optional auth
+// verifier.
+type PDU struct {
+	Header Header
+	Body   Body
+	Auth   *AuthVerifier
+}
+
+// Marshal returns the binary representation of the PDU. The version, packet
+// type, fragment length and authentication length of the header are filled
+// in automatically, as is the pad length of the auth verifier.
+func (p *PDU) Marshal() ([]byte, error) {
+	p.Header.VersionMajor = 5
+	p.Header.PacketType = p.Body.PacketType()
+	e := encoder{
+		header: &p.Header,
+		order:  ByteOrder(p.Header.Format),
+		buf:    make([]byte, HeaderLength, MinFragmentBufferSize),
+	}
+	p.Body.encode(&e)
+	if p.Auth != nil {
+		encodeAuth(&e, p.Body, p.Auth)
+	} else {
+		p.Header.AuthLength = 0
+	}
+	if len(e.buf) > 0xffff {
+		return nil, ErrFragmentTooLarge
+	}
+	p.Header.FragLength = uint16(len(e.buf))
+	p.Header.Marshal(e.buf)
+	return e.buf, nil
+}
+
+// Unmarshal unmarshals a PDU from its binary representation stored in b.
+func (p *PDU) Unmarshal(b []byte) error {
+	if err := p.Header.Unmarshal(b); err != nil {
+		return err
+	}
+	if int(p.Header.FragLength) > len(b) || p.Header.FragLength < HeaderLength {
+		return ErrTruncated
+	}
+	body, err := NewBody(p.Header.PacketType)
+	if err != nil {
+		return err
+	}
+	d := decoder{
+		header: &p.Header,
+		order:  ByteOrder(p.Header.Format),
+		buf:    b,
+		end:    int(p.Header.FragLength),
+		off:    HeaderLength,
+	}
+	var auth *AuthVerifier
+	if p.Header.AuthLength > 0 {
+		if auth = decodeAuth(&d); d.err != nil {
+			return d.err
+		}
+	}
+	body.decode(&d)
+	if d.err != nil {
+		return d.err
+	}
+	p.Body = body
+	p.Auth = auth
+	return nil
+}
+
+// Read reads a single PDU from r.
+func Read(r io.Reader) (*PDU, error) {
+	b, err := ReadFragment(r)
+	if err != nil {
+		return nil, err
+	}
+	p := new(PDU)
+	if err := p.Unmarshal(b); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Write marshals p and writes it to w in a single call.
+func Write(w io.Writer, p *PDU) error {
+	b, err := p.Marshal()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// NewBody returns an empty PDU body for the given packet type.
+func NewBody(packetType uint8) (Body, error) {
+	switch packetType {
+	case pdu.TypeRequest:
+		return new(Request), nil
+	case pdu.TypeResponse:
+		return new(Response), nil
+	case pdu.TypeFault:
+		return new(Fault), nil
+	case pdu.TypeBind:
+		return new(Bind), nil
+	case pdu.TypeBindAck:
+		return new(BindAck), nil
+	case pdu.TypeBindNak:
+		return new(BindNak), nil
+	case pdu.TypeAlterContext:
+		return new(AlterContext), nil
+	case pdu.TypeAlterContextResp:
+		return new(AlterContextResp), nil
+	case pdu.TypeAuth3:
+		return new(Auth3), nil
+	case pdu.TypeShutdown:
+		return new(Shutdown), nil
+	case pdu.TypeCancelCO:
+		return new(Cancel), nil
+	case pdu.TypeOrphaned:
+		return new(Orphaned), nil
+	case pdu.TypeRTS:
+		return new(RTS), nil
+	}
+	return nil, fmt.Errorf("copdu: unsupported packet type %d", packetType)
+}
@@ -0,0 +1,87 @@
+package presentationcontext
+
+import (
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationsyntax"
+	"github.com/gentlemanautomaton/dcerpc/uuid"
+)
+
+// Features is a bitmask of the features negotiated at bind time as described
+// in section 3.3.1.5.3 of the MS-RPCE publication.
+type Features uint16
+
+const (
+	// SecurityContextMultiplexing indicates that multiple security contexts
+	// may be used on a single association.
+	SecurityContextMultiplexing Features = 0x01
+
+	// KeepConnectionOnOrphan indicates that the connection will remain open
+	// after an orphaned PDU is received.
+	KeepConnectionOnOrphan Features = 0x02
+)
+
+// featureNegotiationPrefix holds the first 8 octets of the bind time feature
+// negotiation pseudo transfer syntax. The remaining 8 octets carry the
+// feature bitmask.
+var featureNegotiationPrefix = [8]byte{0x6c, 0xb7, 0x1c, 0x2c, 0x98, 0x12, 0x45, 0x40}
+
+// FeatureNegotiationSyntax returns the bind time feature negotiation pseudo
+// transfer syntax that proposes the given features.
+func FeatureNegotiationSyntax(features Features) presentationsyntax.ID {
+	var u uuid.UUID
+	copy(u[0:8], featureNegotiationPrefix[:])
+	u[8] = byte(features)
+	u[9] = byte(features >> 8)
+	return presentationsyntax.New(u, 1, 0)
+}
+
+// ParseFeatureNegotiationSyntax returns the features proposed by the given
+// transfer syntax if it is the bind time feature negotiation pseudo transfer
+// syntax.
+func ParseFeatureNegotiationSyntax(id presentationsyntax.ID) (features Features, ok bool) {
+	u := id.Interface
+	for i := range featureNegotiationPrefix {
+		if u[i] != featureNegotiationPrefix[i] {
+			return 0, false
+		}
+	}
+	return Features(u[8]) | Features(u[9])<<8, true
+}
+
+// FeatureNegotiation returns a presentation context element that proposes
+// the given features. Bind time feature negotiation elements must be included
+// in bind PDUs only.
+func FeatureNegotiation(id ID, abstract presentationsyntax.ID, features Features) Element {
+	return Element{
+		ID:                  id,
+		NumTransferSyntaxes: 1,
+		AbstractSyntax:      abstract,
+		TransferSyntaxes:    []presentationsyntax.ID{FeatureNegotiationSyntax(features)},
+	}
+}
+
+// Features returns the features proposed by the element if it is a bind time
+// feature negotiation element.
+func (e *Element) Features() (features Features, ok bool) {
+	if len(e.TransferSyntaxes) != 1 {
+		return 0, false
+	}
+	return ParseFeatureNegotiationSyntax(e.TransferSyntaxes[0])
+}
+
+// FeatureAck returns the result of a bind time feature negotiation, which
+// acknowledges the given features.
+func FeatureAck(features Features) ResultElement {
+	return ResultElement{
+		Result: NegotiateAck,
+		Reason: Reason(features),
+	}
+}
+
+// Features returns the features acknowledged by the result if it is the
+// result of a bind time feature negotiation.
+func (r *ResultElement) Features() (features Features, ok bool) {
+	if r.Result != NegotiateAck {
+		return 0, false
+	}
+	return Features(r.Reason), true
+}
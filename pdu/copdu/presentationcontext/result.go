@@ -14,4 +14,9 @@ const (
 	// ProviderRejection indicates that the proposed presentation context was rejected
 	// by the provider.
 	ProviderRejection
+
+	// NegotiateAck indicates that a bind time feature negotiation was
+	// acknowledged. The reason field of the result carries the bitmask of
+	// features supported by the server.
+	NegotiateAck
 )
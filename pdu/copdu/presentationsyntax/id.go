@@ -1,9 +1,31 @@
 package presentationsyntax
 
-import "github.com/nu7hatch/gouuid"
+import "github.com/gentlemanautomaton/dcerpc/uuid"
 
 // ID contains the interface UUID and version of a presentation syntax.
+//
+// The major version is stored in the 16 least significant bits of Version
+// and the minor version is stored in the 16 most significant bits.
 type ID struct {
 	Interface uuid.UUID
 	Version   uint32
 }
+
+// New returns a presentation syntax identifier for the given interface UUID
+// and version.
+func New(u uuid.UUID, major, minor uint16) ID {
+	return ID{
+		Interface: u,
+		Version:   uint32(major) | uint32(minor)<<16,
+	}
+}
+
+// Major returns the major version of the presentation syntax.
+func (id ID) Major() uint16 {
+	return uint16(id.Version)
+}
+
+// Minor returns the minor version of the presentation syntax.
+func (id ID) Minor() uint16 {
+	return uint16(id.Version >> 16)
+}
@@ -1,11 +1,13 @@
 package copdu
 
-import "github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationcontext"
+import (
+	"github.com/gentlemanautomaton/dcerpc/pdu"
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationcontext"
+	"github.com/gentlemanautomaton/dcerpc/uuid"
+)
 
 // Request represents a request PDU in the connection-oriented protocol.
 type Request struct {
-	// TODO: Decide whether we include the header here or not
-
 	// AllocHint is an optional suggested buffer size provided by the sender of
 	// a fragmented PDU series. When used, it indiciates the amount of memory
 	// required to hold the entire series of fragmented requests in a contiguous
@@ -21,9 +23,40 @@ type Request struct {
 	// the RPC interface on the server.
 	OpNum uint16
 
-	// TODO: Handle optional object ID field
+	// Object is the optional object UUID of the request. It is present on the
+	// wire only when the ObjectUUID flag has been set in the header, which is
+	// done automatically when Object is not nil.
+	Object uuid.UUID
+
+	// Stub is the stub data of the request, which begins on an 8-octet
+	// boundary.
+	Stub []byte
+}
+
+// PacketType returns the packet type of a request PDU.
+func (r *Request) PacketType() uint8 {
+	return pdu.TypeRequest
+}
 
-	// TODO: Insert stub data, 8-octet aligned
+func (r *Request) encode(e *encoder) {
+	e.uint32(r.AllocHint)
+	e.uint16(uint16(r.PresContextID))
+	e.uint16(r.OpNum)
+	if !r.Object.IsNil() {
+		e.header.Flags |= ObjectUUID
+		e.uuid(r.Object)
+	} else {
+		e.header.Flags &^= ObjectUUID
+	}
+	e.bytes(r.Stub)
+}
 
-	// TODO: Handle optional auth verifier, probably as a separate struct or something.
+func (r *Request) decode(d *decoder) {
+	r.AllocHint = d.uint32()
+	r.PresContextID = presentationcontext.ID(d.uint16())
+	r.OpNum = d.uint16()
+	if d.header.Flags&ObjectUUID != 0 {
+		r.Object = d.uuid()
+	}
+	r.Stub = d.remaining()
 }
@@ -1,11 +1,12 @@
 package copdu
 
-import "github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationcontext"
+import (
+	"github.com/gentlemanautomaton/dcerpc/pdu"
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationcontext"
+)
 
 // Response represents a response PDU in the connection-oriented protocol.
 type Response struct {
-	// TODO: Decide whether we include the header here or not
-
 	// AllocHint is an optional suggested buffer size provided by the sender of
 	// a fragmented PDU series. When used, it indiciates the amount of memory
 	// required to hold the entire series of fragmented requests in a contiguous
@@ -23,7 +24,28 @@ type Response struct {
 
 	_ uint8 // Reserved
 
-	// TODO: Insert stub data, 8-octet aligned
+	// Stub is the stub data of the response, which begins on an 8-octet
+	// boundary.
+	Stub []byte
+}
+
+// PacketType returns the packet type of a response PDU.
+func (r *Response) PacketType() uint8 {
+	return pdu.TypeResponse
+}
+
+func (r *Response) encode(e *encoder) {
+	e.uint32(r.AllocHint)
+	e.uint16(uint16(r.PresContextID))
+	e.uint8(r.CancelCount)
+	e.uint8(0)
+	e.bytes(r.Stub)
+}
 
-	// TODO: Handle optional auth verifier, probably as a separate struct or something.
+func (r *Response) decode(d *decoder) {
+	r.AllocHint = d.uint32()
+	r.PresContextID = presentationcontext.ID(d.uint16())
+	r.CancelCount = d.uint8()
+	d.skip(1)
+	r.Stub = d.remaining()
 }
@@ -0,0 +1,195 @@
+package copdu
+
+import (
+	"errors"
+	"net"
+
+	"github.com/gentlemanautomaton/dcerpc/pdu"
+	"github.com/gentlemanautomaton/dcerpc/uuid"
+)
+
+// ErrInvalidRTS is returned when an RTS PDU carries a command that is not
+// recognized.
+var ErrInvalidRTS = errors.New("copdu: invalid rts command")
+
+// RTS flags, which describe the purpose of an RTS PDU.
+const (
+	// RTSFlagNone indicates that the PDU has no special purpose.
+	RTSFlagNone = 0x0000
+	// RTSFlagPing indicates that the PDU is a ping that keeps a channel
+	// alive.
+	RTSFlagPing = 0x0001
+	// RTSFlagOtherCmd indicates that the PDU carries a command that is not
+	// part of connection establishment or channel recycling, such as a flow
+	// control acknowledgement.
+	RTSFlagOtherCmd = 0x0002
+	// RTSFlagRecycleChannel indicates that the PDU is part of a channel
+	// recycling sequence.
+	RTSFlagRecycleChannel = 0x0004
+	// RTSFlagInChannel indicates that the PDU applies to the IN channel.
+	RTSFlagInChannel = 0x0008
+	// RTSFlagOutChannel indicates that the PDU applies to the OUT channel.
+	RTSFlagOutChannel = 0x0010
+	// RTSFlagEOF indicates that the PDU is the last one sent on a channel.
+	RTSFlagEOF = 0x0020
+	// RTSFlagEcho indicates that the PDU is an echo request or response,
+	// which is used by clients to probe a proxy.
+	RTSFlagEcho = 0x0040
+)
+
+// RTSCommandType identifies the type of a command carried by an RTS PDU.
+type RTSCommandType uint32
+
+// RTS command types.
+const (
+	RTSReceiveWindowSize     RTSCommandType = 0
+	RTSFlowControlAck        RTSCommandType = 1
+	RTSConnectionTimeout     RTSCommandType = 2
+	RTSCookie                RTSCommandType = 3
+	RTSChannelLifetime       RTSCommandType = 4
+	RTSClientKeepalive       RTSCommandType = 5
+	RTSVersion               RTSCommandType = 6
+	RTSEmpty                 RTSCommandType = 7
+	RTSPadding               RTSCommandType = 8
+	RTSNegativeANCE          RTSCommandType = 9
+	RTSANCE                  RTSCommandType = 10
+	RTSClientAddress         RTSCommandType = 11
+	RTSAssociationGroupID    RTSCommandType = 12
+	RTSDestination           RTSCommandType = 13
+	RTSPingTrafficSentNotify RTSCommandType = 14
+)
+
+// Forwarding destinations carried by RTSDestination commands.
+const (
+	RTSDestinationClient   = 0
+	RTSDestinationInProxy  = 1
+	RTSDestinationServer   = 2
+	RTSDestinationOutProxy = 3
+)
+
+// rtsClientAddressPadding is the number of padding octets that follow the
+// address of a client address command.
+const rtsClientAddressPadding = 12
+
+// RTSCommand is a command carried by an RTS PDU. Only the fields that apply
+// to the command's type are encoded.
+type RTSCommand struct {
+	Type RTSCommandType
+
+	// Value is the value of ReceiveWindowSize, ConnectionTimeout,
+	// ChannelLifetime, ClientKeepalive, Version, Destination and
+	// PingTrafficSentNotify commands.
+	Value uint32
+
+	// Cookie is the cookie of Cookie and AssociationGroupID commands and
+	// the channel cookie of FlowControlAck commands.
+	Cookie uuid.UUID
+
+	// BytesReceived and AvailableWindow are the acknowledgement carried by
+	// FlowControlAck commands.
+	BytesReceived   uint32
+	AvailableWindow uint32
+
+	// Address is the address of ClientAddress commands, which is either an
+	// IPv4 or an IPv6 address.
+	Address net.IP
+
+	// Padding is the number of padding octets of Padding commands.
+	Padding uint32
+}
+
+// RTS represents an rts PDU in the connection-oriented protocol. RTS PDUs are
+// exchanged by the clients, proxies and servers of the RPC over HTTP protocol
+// to manage the IN and OUT channels of a virtual connection. They are never
+// passed to the RPC protocol itself.
+//
+// RTS PDUs are described in "[MS-RPCH] Remote Procedure Call over HTTP
+// Protocol", section 2.2.3.
+type RTS struct {
+	Flags    uint16
+	Commands []RTSCommand
+}
+
+// PacketType returns the packet type of an rts PDU.
+func (r *RTS) PacketType() uint8 {
+	return pdu.TypeRTS
+}
+
+// Command returns the first command of the given type carried by the PDU.
+func (r *RTS) Command(t RTSCommandType) (cmd RTSCommand, ok bool) {
+	for _, cmd := range r.Commands {
+		if cmd.Type == t {
+			return cmd, true
+		}
+	}
+	return RTSCommand{}, false
+}
+
+func (r *RTS) encode(e *encoder) {
+	e.uint16(r.Flags)
+	e.uint16(uint16(len(r.Commands)))
+	for i := range r.Commands {
+		cmd := &r.Commands[i]
+		e.uint32(uint32(cmd.Type))
+		switch cmd.Type {
+		case RTSReceiveWindowSize, RTSConnectionTimeout, RTSChannelLifetime, RTSClientKeepalive, RTSVersion, RTSDestination, RTSPingTrafficSentNotify:
+			e.uint32(cmd.Value)
+		case RTSFlowControlAck:
+			e.uint32(cmd.BytesReceived)
+			e.uint32(cmd.AvailableWindow)
+			e.uuid(cmd.Cookie)
+		case RTSCookie, RTSAssociationGroupID:
+			e.uuid(cmd.Cookie)
+		case RTSPadding:
+			e.uint32(cmd.Padding)
+			e.bytes(make([]byte, cmd.Padding))
+		case RTSClientAddress:
+			if ip := cmd.Address.To4(); ip != nil {
+				e.uint32(0)
+				e.bytes(ip)
+			} else {
+				e.uint32(1)
+				e.bytes(cmd.Address.To16())
+			}
+			e.bytes(make([]byte, rtsClientAddressPadding))
+		}
+	}
+}
+
+func (r *RTS) decode(d *decoder) {
+	r.Flags = d.uint16()
+	n := int(d.uint16())
+	r.Commands = nil
+	for i := 0; i < n && d.err == nil; i++ {
+		cmd := RTSCommand{Type: RTSCommandType(d.uint32())}
+		switch cmd.Type {
+		case RTSReceiveWindowSize, RTSConnectionTimeout, RTSChannelLifetime, RTSClientKeepalive, RTSVersion, RTSDestination, RTSPingTrafficSentNotify:
+			cmd.Value = d.uint32()
+		case RTSFlowControlAck:
+			cmd.BytesReceived = d.uint32()
+			cmd.AvailableWindow = d.uint32()
+			cmd.Cookie = d.uuid()
+		case RTSCookie, RTSAssociationGroupID:
+			cmd.Cookie = d.uuid()
+		case RTSPadding:
+			cmd.Padding = d.uint32()
+			d.skip(int(cmd.Padding))
+		case RTSClientAddress:
+			switch d.uint32() {
+			case 0:
+				cmd.Address = net.IP(d.bytes(net.IPv4len))
+			case 1:
+				cmd.Address = net.IP(d.bytes(net.IPv6len))
+			default:
+				d.err = ErrInvalidRTS
+			}
+			d.skip(rtsClientAddressPadding)
+		case RTSEmpty, RTSNegativeANCE, RTSANCE:
+		default:
+			d.err = ErrInvalidRTS
+		}
+		if d.err == nil {
+			r.Commands = append(r.Commands, cmd)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package copdu
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/gentlemanautomaton/dcerpc/formatlabel"
+	"github.com/gentlemanautomaton/dcerpc/uuid"
+)
+
+var (
+	testCookie1 = uuid.MustParse("00112233-4455-6677-8899-aabbccddeeff")
+	testCookie2 = uuid.MustParse("ffeeddcc-bbaa-9988-7766-554433221100")
+)
+
+func TestRTS(t *testing.T) {
+	tests := []struct {
+		name string
+		rts  RTS
+		want []byte
+	}{
+		{
+			name: "conn-a1",
+			rts: RTS{Commands: []RTSCommand{
+				{Type: RTSVersion, Value: 1},
+				{Type: RTSCookie, Cookie: testCookie1},
+				{Type: RTSCookie, Cookie: testCookie2},
+				{Type: RTSReceiveWindowSize, Value: 0x10000},
+			}},
+			want: []byte{
+				0x05, 0x00, 0x14, 0x03, 0x10, 0x00, 0x00, 0x00, // Header
+				0x4c, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x04, 0x00, // Flags and command count
+				0x06, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, // Version
+				0x03, 0x00, 0x00, 0x00, // Virtual connection cookie
+				0x33, 0x22, 0x11, 0x00, 0x55, 0x44, 0x77, 0x66, 0x88, 0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff,
+				0x03, 0x00, 0x00, 0x00, // OUT channel cookie
+				0xcc, 0xdd, 0xee, 0xff, 0xaa, 0xbb, 0x88, 0x99, 0x77, 0x66, 0x55, 0x44, 0x33, 0x22, 0x11, 0x00,
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, // Receive window size
+			},
+		},
+		{
+			name: "conn-b1",
+			rts: RTS{Commands: []RTSCommand{
+				{Type: RTSVersion, Value: 1},
+				{Type: RTSCookie, Cookie: testCookie1},
+				{Type: RTSCookie, Cookie: testCookie2},
+				{Type: RTSChannelLifetime, Value: 0x40000000},
+				{Type: RTSClientKeepalive, Value: 300000},
+				{Type: RTSAssociationGroupID, Cookie: testCookie1},
+			}},
+			want: []byte{
+				0x05, 0x00, 0x14, 0x03, 0x10, 0x00, 0x00, 0x00, // Header
+				0x68, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x06, 0x00, // Flags and command count
+				0x06, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, // Version
+				0x03, 0x00, 0x00, 0x00, // Virtual connection cookie
+				0x33, 0x22, 0x11, 0x00, 0x55, 0x44, 0x77, 0x66, 0x88, 0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff,
+				0x03, 0x00, 0x00, 0x00, // IN channel cookie
+				0xcc, 0xdd, 0xee, 0xff, 0xaa, 0xbb, 0x88, 0x99, 0x77, 0x66, 0x55, 0x44, 0x33, 0x22, 0x11, 0x00,
+				0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x40, // Channel lifetime
+				0x05, 0x00, 0x00, 0x00, 0xe0, 0x93, 0x04, 0x00, // Client keepalive
+				0x0c, 0x00, 0x00, 0x00, // Association group ID
+				0x33, 0x22, 0x11, 0x00, 0x55, 0x44, 0x77, 0x66, 0x88, 0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff,
+			},
+		},
+		{
+			name: "out-r1-a3",
+			rts: RTS{Flags: RTSFlagRecycleChannel, Commands: []RTSCommand{
+				{Type: RTSVersion, Value: 1},
+				{Type: RTSCookie, Cookie: testCookie1},
+				{Type: RTSCookie, Cookie: testCookie2},
+				{Type: RTSCookie, Cookie: testCookie1},
+				{Type: RTSReceiveWindowSize, Value: 0x10000},
+			}},
+			want: []byte{
+				0x05, 0x00, 0x14, 0x03, 0x10, 0x00, 0x00, 0x00, // Header
+				0x60, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x04, 0x00, 0x05, 0x00, // Flags and command count
+				0x06, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, // Version
+				0x03, 0x00, 0x00, 0x00, // Virtual connection cookie
+				0x33, 0x22, 0x11, 0x00, 0x55, 0x44, 0x77, 0x66, 0x88, 0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff,
+				0x03, 0x00, 0x00, 0x00, // Predecessor channel cookie
+				0xcc, 0xdd, 0xee, 0xff, 0xaa, 0xbb, 0x88, 0x99, 0x77, 0x66, 0x55, 0x44, 0x33, 0x22, 0x11, 0x00,
+				0x03, 0x00, 0x00, 0x00, // Successor channel cookie
+				0x33, 0x22, 0x11, 0x00, 0x55, 0x44, 0x77, 0x66, 0x88, 0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff,
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, // Receive window size
+			},
+		},
+		{
+			name: "flow-control-ack",
+			rts: RTS{Flags: RTSFlagOtherCmd, Commands: []RTSCommand{
+				{Type: RTSDestination, Value: RTSDestinationOutProxy},
+				{Type: RTSFlowControlAck, BytesReceived: 0x1234, AvailableWindow: 0x8000, Cookie: testCookie2},
+			}},
+			want: []byte{
+				0x05, 0x00, 0x14, 0x03, 0x10, 0x00, 0x00, 0x00, // Header
+				0x38, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x02, 0x00, 0x02, 0x00, // Flags and command count
+				0x0d, 0x00, 0x00, 0x00, 0x03, 0x00, 0x00, 0x00, // Destination
+				0x01, 0x00, 0x00, 0x00, // Flow control ack
+				0x34, 0x12, 0x00, 0x00, 0x00, 0x80, 0x00, 0x00,
+				0xcc, 0xdd, 0xee, 0xff, 0xaa, 0xbb, 0x88, 0x99, 0x77, 0x66, 0x55, 0x44, 0x33, 0x22, 0x11, 0x00,
+			},
+		},
+		{
+			name: "eof",
+			rts:  RTS{Flags: RTSFlagEOF | RTSFlagInChannel, Commands: []RTSCommand{{Type: RTSANCE}}},
+			want: []byte{
+				0x05, 0x00, 0x14, 0x03, 0x10, 0x00, 0x00, 0x00, // Header
+				0x18, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x28, 0x00, 0x01, 0x00, // Flags and command count
+				0x0a, 0x00, 0x00, 0x00, // ANCE
+			},
+		},
+		{
+			name: "padding",
+			rts:  RTS{Commands: []RTSCommand{{Type: RTSPadding, Padding: 4}}},
+			want: []byte{
+				0x05, 0x00, 0x14, 0x03, 0x10, 0x00, 0x00, 0x00, // Header
+				0x20, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x01, 0x00, // Flags and command count
+				0x08, 0x00, 0x00, 0x00, 0x04, 0x00, 0x00, 0x00, // Padding
+				0x00, 0x00, 0x00, 0x00,
+			},
+		},
+		{
+			name: "conn-c2",
+			rts: RTS{Commands: []RTSCommand{
+				{Type: RTSVersion, Value: 1},
+				{Type: RTSReceiveWindowSize, Value: 0x10000},
+				{Type: RTSConnectionTimeout, Value: 120000},
+			}},
+			want: []byte{
+				0x05, 0x00, 0x14, 0x03, 0x10, 0x00, 0x00, 0x00, // Header
+				0x2c, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x03, 0x00, // Flags and command count
+				0x06, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, // Version
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, // Receive window size
+				0x02, 0x00, 0x00, 0x00, 0xc0, 0xd4, 0x01, 0x00, // Connection timeout
+			},
+		},
+		{
+			name: "ping",
+			rts:  RTS{Flags: RTSFlagPing},
+			want: []byte{
+				0x05, 0x00, 0x14, 0x03, 0x10, 0x00, 0x00, 0x00, // Header
+				0x14, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x01, 0x00, 0x00, 0x00, // Flags and command count
+			},
+		},
+		{
+			name: "client-address-ipv4",
+			rts:  RTS{Commands: []RTSCommand{{Type: RTSClientAddress, Address: net.IP{10, 0, 0, 1}}}},
+			want: []byte{
+				0x05, 0x00, 0x14, 0x03, 0x10, 0x00, 0x00, 0x00, // Header
+				0x2c, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x01, 0x00, // Flags and command count
+				0x0b, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // Client address, IPv4
+				0x0a, 0x00, 0x00, 0x01,
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // Padding
+			},
+		},
+		{
+			name: "client-address-ipv6",
+			rts:  RTS{Commands: []RTSCommand{{Type: RTSClientAddress, Address: net.IPv6loopback}}},
+			want: []byte{
+				0x05, 0x00, 0x14, 0x03, 0x10, 0x00, 0x00, 0x00, // Header
+				0x38, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x01, 0x00, // Flags and command count
+				0x0b, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, // Client address, IPv6
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01,
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // Padding
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := PDU{
+				Header: Header{Flags: FirstFrag | LastFrag, Format: formatlabel.LEAIEEE},
+				Body:   &tt.rts,
+			}
+			b, err := p.Marshal()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, tt.want) {
+				t.Fatalf("marshaled % x, want % x", b, tt.want)
+			}
+
+			var got PDU
+			if err := got.Unmarshal(b); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got.Body, &tt.rts) {
+				t.Fatalf("unmarshaled %+v, want %+v", got.Body, &tt.rts)
+			}
+		})
+	}
+}
+
+func TestRTSInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		body []byte
+	}{
+		{"command-type", []byte{0x00, 0x00, 0x01, 0x00, 0x0f, 0x00, 0x00, 0x00}},
+		{"address-type", []byte{0x00, 0x00, 0x01, 0x00, 0x0b, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00}},
+		{"truncated", []byte{0x00, 0x00, 0x02, 0x00, 0x06, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := []byte{0x05, 0x00, 0x14, 0x03, 0x10, 0x00, 0x00, 0x00, byte(HeaderLength + len(tt.body)), 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+			b = append(b, tt.body...)
+			var p PDU
+			if err := p.Unmarshal(b); err == nil {
+				t.Fatalf("unmarshaled %+v", p.Body)
+			}
+		})
+	}
+}
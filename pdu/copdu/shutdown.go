@@ -1,8 +1,18 @@
 package copdu
 
+import "github.com/gentlemanautomaton/dcerpc/pdu"
+
 // Shutdown represents a shutdown PDU in the connection-oriented protocol. It is
 // sent from the server to the client to request that the client end the
 // connection and release any allocated resources.
 type Shutdown struct {
-	// TODO: Decide whether we include the header here or not
 }
+
+// PacketType returns the packet type of a shutdown PDU.
+func (s *Shutdown) PacketType() uint8 {
+	return pdu.TypeShutdown
+}
+
+func (s *Shutdown) encode(e *encoder) {}
+
+func (s *Shutdown) decode(d *decoder) {}
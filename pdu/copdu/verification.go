@@ -0,0 +1,196 @@
+package copdu
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+
+	"github.com/gentlemanautomaton/dcerpc/formatlabel"
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationcontext"
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationsyntax"
+)
+
+// ErrInvalidVerificationTrailer is returned when the verification trailer of
+// a request is malformed.
+var ErrInvalidVerificationTrailer = errors.New("copdu: invalid verification trailer")
+
+// VerificationSignature identifies the start of a verification trailer.
+var VerificationSignature = [8]byte{0x8a, 0xe3, 0x13, 0x71, 0x02, 0xf4, 0x36, 0x71}
+
+// VerificationCommandType identifies the type of a command carried by a
+// verification trailer.
+type VerificationCommandType uint16
+
+// Verification trailer command types.
+const (
+	// VerificationBitmask1 carries a bitmask of client capabilities.
+	VerificationBitmask1 VerificationCommandType = 0x0001
+	// VerificationPContext carries the abstract and transfer syntax of the
+	// presentation context of the request.
+	VerificationPContext VerificationCommandType = 0x0002
+	// VerificationHeader2 carries a copy of selected fields of the request
+	// header.
+	VerificationHeader2 VerificationCommandType = 0x0003
+)
+
+// Verification trailer command flags, which share the command field with the
+// command type.
+const (
+	verificationCommandMask = 0x3fff
+	verificationCommandEnd  = 0x4000
+	verificationMustProcess = 0x8000
+)
+
+// ClientSupportsHeaderSigning is set in the bitmask of a VerificationBitmask1
+// command when the client supports header signing.
+const ClientSupportsHeaderSigning = 0x00000001
+
+// VerificationCommand is a command carried by a verification trailer. Only
+// the fields that apply to the command's type are encoded.
+type VerificationCommand struct {
+	Type VerificationCommandType
+
+	// MustProcess indicates that the receiver must reject the request if it
+	// does not understand the command.
+	MustProcess bool
+
+	// Bitmask is the value of a Bitmask1 command.
+	Bitmask uint32
+
+	// AbstractSyntax and TransferSyntax are the values of a PContext
+	// command.
+	AbstractSyntax presentationsyntax.ID
+	TransferSyntax presentationsyntax.ID
+
+	// PacketType, Format, CallID, ContextID and OpNum are the values of a
+	// Header2 command.
+	PacketType uint8
+	Format     formatlabel.Format
+	CallID     uint32
+	ContextID  presentationcontext.ID
+	OpNum      uint16
+
+	// Data holds the value of a command of an unrecognized type.
+	Data []byte
+}
+
+// VerificationTrailer is the rpc_sec_verification_trailer that may be
+// appended to the stub data of a request. It allows the server to verify
+// parts of the request that are not protected by the security context of the
+// call.
+//
+// The verification trailer is defined in MS-RPCE section 2.2.2.13. It is
+// always encoded in little-endian byte order.
+type VerificationTrailer struct {
+	Commands []VerificationCommand
+}
+
+// Command returns the first command of type t in the trailer.
+func (vt *VerificationTrailer) Command(t VerificationCommandType) (cmd VerificationCommand, ok bool) {
+	for _, cmd := range vt.Commands {
+		if cmd.Type == t {
+			return cmd, true
+		}
+	}
+	return VerificationCommand{}, false
+}
+
+// Append appends the trailer to the stub data and returns the result. The
+// stub data is padded so that the trailer starts at a multiple of four
+// octets.
+func (vt *VerificationTrailer) Append(stub []byte) []byte {
+	e := encoder{order: binary.LittleEndian, buf: stub}
+	e.align(4)
+	e.bytes(VerificationSignature[:])
+	for i, cmd := range vt.Commands {
+		command := uint16(cmd.Type) & verificationCommandMask
+		if i == len(vt.Commands)-1 {
+			command |= verificationCommandEnd
+		}
+		if cmd.MustProcess {
+			command |= verificationMustProcess
+		}
+		e.uint16(command)
+		length := len(e.buf)
+		e.uint16(0)
+		switch cmd.Type {
+		case VerificationBitmask1:
+			e.uint32(cmd.Bitmask)
+		case VerificationPContext:
+			e.syntax(cmd.AbstractSyntax)
+			e.syntax(cmd.TransferSyntax)
+		case VerificationHeader2:
+			e.uint8(cmd.PacketType)
+			e.uint8(0)
+			e.uint16(0)
+			e.bytes(cmd.Format[:])
+			e.uint32(cmd.CallID)
+			e.uint16(uint16(cmd.ContextID))
+			e.uint16(cmd.OpNum)
+		default:
+			e.bytes(cmd.Data)
+		}
+		e.order.PutUint16(e.buf[length:], uint16(len(e.buf)-length-2))
+	}
+	return e.buf
+}
+
+// SplitVerificationTrailer locates the verification trailer at the end of
+// the stub data of a request. It returns the stub data that precedes the
+// trailer and the trailer itself. If the stub data does not end with a
+// verification trailer it is returned unmodified with a nil trailer.
+func SplitVerificationTrailer(stub []byte) ([]byte, *VerificationTrailer, error) {
+	start := -1
+	for off := (len(stub) - len(VerificationSignature)) &^ 3; off >= 0; off -= 4 {
+		if bytes.Equal(stub[off:off+len(VerificationSignature)], VerificationSignature[:]) {
+			start = off
+			break
+		}
+	}
+	if start < 0 {
+		return stub, nil, nil
+	}
+
+	d := decoder{order: binary.LittleEndian, buf: stub, end: len(stub), off: start + len(VerificationSignature)}
+	vt := new(VerificationTrailer)
+	for {
+		command := d.uint16()
+		length := int(d.uint16())
+		if d.err != nil || d.off+length > d.end {
+			return nil, nil, ErrInvalidVerificationTrailer
+		}
+		cmd := VerificationCommand{
+			Type:        VerificationCommandType(command & verificationCommandMask),
+			MustProcess: command&verificationMustProcess != 0,
+		}
+		body := decoder{order: d.order, buf: d.buf, end: d.off + length, off: d.off}
+		switch cmd.Type {
+		case VerificationBitmask1:
+			cmd.Bitmask = body.uint32()
+		case VerificationPContext:
+			cmd.AbstractSyntax = body.syntax()
+			cmd.TransferSyntax = body.syntax()
+		case VerificationHeader2:
+			cmd.PacketType = body.uint8()
+			body.skip(3)
+			copy(cmd.Format[:], body.bytes(4))
+			cmd.CallID = body.uint32()
+			cmd.ContextID = presentationcontext.ID(body.uint16())
+			cmd.OpNum = body.uint16()
+		default:
+			cmd.Data = body.remaining()
+		}
+		if body.err != nil || body.off != body.end {
+			return nil, nil, ErrInvalidVerificationTrailer
+		}
+		d.off += length
+		vt.Commands = append(vt.Commands, cmd)
+		if command&verificationCommandEnd != 0 {
+			break
+		}
+	}
+	if d.off != d.end {
+		return nil, nil, ErrInvalidVerificationTrailer
+	}
+	return stub[:start], vt, nil
+}
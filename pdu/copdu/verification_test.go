@@ -0,0 +1,87 @@
+package copdu
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/gentlemanautomaton/dcerpc/formatlabel"
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationsyntax"
+	"github.com/gentlemanautomaton/dcerpc/uuid"
+)
+
+var (
+	testAbstract = presentationsyntax.New(uuid.MustParse("12345678-1234-abcd-ef00-0123456789ab"), 1, 0)
+	testTransfer = presentationsyntax.New(uuid.MustParse("8a885d04-1ceb-11c9-9fe8-08002b104860"), 2, 0)
+)
+
+func TestVerificationTrailer(t *testing.T) {
+	vt := &VerificationTrailer{Commands: []VerificationCommand{
+		{Type: VerificationBitmask1, Bitmask: ClientSupportsHeaderSigning},
+		{Type: VerificationPContext, MustProcess: true, AbstractSyntax: testAbstract, TransferSyntax: testTransfer},
+		{Type: VerificationHeader2, MustProcess: true, Format: formatlabel.LEAIEEE, CallID: 7, ContextID: 1, OpNum: 5},
+	}}
+	want := []byte{
+		1, 2, 3, 0, // Stub data and padding
+		0x8a, 0xe3, 0x13, 0x71, 0x02, 0xf4, 0x36, 0x71, // Signature
+		0x01, 0x00, 0x04, 0x00, // Bitmask1
+		0x01, 0x00, 0x00, 0x00,
+		0x02, 0x80, 0x28, 0x00, // PContext, must process
+		0x78, 0x56, 0x34, 0x12, 0x34, 0x12, 0xcd, 0xab, 0xef, 0x00, 0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0x01, 0x00, 0x00, 0x00,
+		0x04, 0x5d, 0x88, 0x8a, 0xeb, 0x1c, 0xc9, 0x11, 0x9f, 0xe8, 0x08, 0x00, 0x2b, 0x10, 0x48, 0x60, 0x02, 0x00, 0x00, 0x00,
+		0x03, 0xc0, 0x10, 0x00, // Header2, must process, end
+		0x00, 0x00, 0x00, 0x00, // Packet type and reserved
+		0x10, 0x00, 0x00, 0x00, // Format label
+		0x07, 0x00, 0x00, 0x00, // Call ID
+		0x01, 0x00, 0x05, 0x00, // Context ID and opnum
+	}
+	b := vt.Append([]byte{1, 2, 3})
+	if !bytes.Equal(b, want) {
+		t.Fatalf("trailer encoded as % x, want % x", b, want)
+	}
+
+	stub, got, err := SplitVerificationTrailer(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stub, want[:4]) {
+		t.Fatalf("stub data is % x, want % x", stub, want[:4])
+	}
+	if !reflect.DeepEqual(got, vt) {
+		t.Fatalf("trailer decoded as %+v, want %+v", got, vt)
+	}
+	if cmd, ok := got.Command(VerificationHeader2); !ok || cmd.CallID != 7 {
+		t.Fatalf("Header2 command is %+v, %v", cmd, ok)
+	}
+
+	stub, got, err = SplitVerificationTrailer(want[:4])
+	if err != nil || got != nil || !bytes.Equal(stub, want[:4]) {
+		t.Fatalf("stub data without a trailer split into % x, %+v, %v", stub, got, err)
+	}
+}
+
+func TestVerificationTrailerInvalid(t *testing.T) {
+	vt := &VerificationTrailer{Commands: []VerificationCommand{
+		{Type: VerificationBitmask1, Bitmask: ClientSupportsHeaderSigning},
+	}}
+	valid := vt.Append(nil)
+	tests := []struct {
+		name   string
+		mangle func(b []byte) []byte
+	}{
+		{"truncated", func(b []byte) []byte { return b[:len(b)-1] }},
+		{"no-command", func(b []byte) []byte { return b[:8] }},
+		{"long-command", func(b []byte) []byte { b[10] = 8; return b }},
+		{"short-command", func(b []byte) []byte { b[10] = 2; return b }},
+		{"unterminated", func(b []byte) []byte { b[9] = 0; return b }},
+		{"trailing-data", func(b []byte) []byte { return append(b, 0, 0, 0, 0) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := tt.mangle(append([]byte(nil), valid...))
+			if _, _, err := SplitVerificationTrailer(b); err != ErrInvalidVerificationTrailer {
+				t.Fatalf("splitting % x returned %v, want %v", b, err, ErrInvalidVerificationTrailer)
+			}
+		})
+	}
+}
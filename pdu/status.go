@@ -0,0 +1,270 @@
+package pdu
+
+// Fault status codes, as defined in appendix E of the DCE 1.1: Remote
+// Procedure Call technical standard. These values are carried in the status
+// field of fault and reject packets in both the connection-oriented and
+// connectionless protocols.
+const (
+	// StatusCommFailure indicates that the server was unable to communicate
+	// with the client.
+	//
+	// nca_s_comm_failure
+	StatusCommFailure = 0x1C010001
+
+	// StatusOpRangeError indicates that the requested operation number is out
+	// of range for the interface.
+	//
+	// nca_s_op_rng_error
+	StatusOpRangeError = 0x1C010002
+
+	// StatusUnknownInterface indicates that the server does not export the
+	// requested interface.
+	//
+	// nca_s_unk_if
+	StatusUnknownInterface = 0x1C010003
+
+	// StatusWrongBootTime indicates that the client's notion of the server's
+	// boot time is incorrect.
+	//
+	// nca_s_wrong_boot_time
+	StatusWrongBootTime = 0x1C010006
+
+	// StatusYouCrashed indicates that the server believes the client has
+	// restarted.
+	//
+	// nca_s_you_crashed
+	StatusYouCrashed = 0x1C010009
+
+	// StatusProtocolError indicates that a protocol error was detected.
+	//
+	// nca_s_proto_error
+	StatusProtocolError = 0x1C01000B
+
+	// StatusOutArgsTooBig indicates that the output parameters of the
+	// operation exceed their declared maximum size.
+	//
+	// nca_s_out_args_too_big
+	StatusOutArgsTooBig = 0x1C010013
+
+	// StatusServerTooBusy indicates that the server is too busy to handle the
+	// call.
+	//
+	// nca_s_server_too_busy
+	StatusServerTooBusy = 0x1C010014
+
+	// StatusUnsupportedType indicates that the server does not implement the
+	// requested operation for the type of the object.
+	//
+	// nca_s_unsupported_type
+	StatusUnsupportedType = 0x1C010017
+
+	// StatusIntDivByZero indicates an integer division by zero.
+	//
+	// nca_s_fault_int_div_by_zero
+	StatusIntDivByZero = 0x1C000001
+
+	// StatusAddrError indicates an addressing error.
+	//
+	// nca_s_fault_addr_error
+	StatusAddrError = 0x1C000002
+
+	// StatusFPDivByZero indicates a floating point division by zero.
+	//
+	// nca_s_fault_fp_div_zero
+	StatusFPDivByZero = 0x1C000003
+
+	// StatusFPUnderflow indicates a floating point underflow.
+	//
+	// nca_s_fault_fp_underflow
+	StatusFPUnderflow = 0x1C000004
+
+	// StatusFPOverflow indicates a floating point overflow.
+	//
+	// nca_s_fault_fp_overflow
+	StatusFPOverflow = 0x1C000005
+
+	// StatusInvalidTag indicates that a discriminated union carried an
+	// invalid tag.
+	//
+	// nca_s_fault_invalid_tag
+	StatusInvalidTag = 0x1C000006
+
+	// StatusInvalidBound indicates that an array bound was invalid.
+	//
+	// nca_s_fault_invalid_bound
+	StatusInvalidBound = 0x1C000007
+
+	// StatusCancel indicates that the call was cancelled.
+	//
+	// nca_s_fault_cancel
+	StatusCancel = 0x1C00000D
+
+	// StatusIllegalInstruction indicates that an illegal instruction was
+	// executed.
+	//
+	// nca_s_fault_ill_inst
+	StatusIllegalInstruction = 0x1C00000E
+
+	// StatusFPError indicates an unspecified floating point error.
+	//
+	// nca_s_fault_fp_error
+	StatusFPError = 0x1C00000F
+
+	// StatusIntOverflow indicates an integer overflow.
+	//
+	// nca_s_fault_int_overflow
+	StatusIntOverflow = 0x1C000010
+
+	// StatusUnspecified indicates an unspecified fault.
+	//
+	// nca_s_fault_unspec
+	StatusUnspecified = 0x1C000012
+
+	// StatusPipeEmpty indicates that a pipe was empty.
+	//
+	// nca_s_fault_pipe_empty
+	StatusPipeEmpty = 0x1C000014
+
+	// StatusPipeClosed indicates that a pipe was closed.
+	//
+	// nca_s_fault_pipe_closed
+	StatusPipeClosed = 0x1C000015
+
+	// StatusPipeOrder indicates that pipes were processed out of order.
+	//
+	// nca_s_fault_pipe_order
+	StatusPipeOrder = 0x1C000016
+
+	// StatusPipeDiscipline indicates that a pipe was used in violation of
+	// its discipline.
+	//
+	// nca_s_fault_pipe_discipline
+	StatusPipeDiscipline = 0x1C000017
+
+	// StatusPipeCommError indicates a communication error on a pipe.
+	//
+	// nca_s_fault_pipe_comm_error
+	StatusPipeCommError = 0x1C000018
+
+	// StatusPipeMemory indicates that there was insufficient memory to
+	// process a pipe.
+	//
+	// nca_s_fault_pipe_memory
+	StatusPipeMemory = 0x1C000019
+
+	// StatusContextMismatch indicates that a context handle was invalid or
+	// did not match the interface.
+	//
+	// nca_s_fault_context_mismatch
+	StatusContextMismatch = 0x1C00001A
+
+	// StatusRemoteNoMemory indicates that the server ran out of memory.
+	//
+	// nca_s_fault_remote_no_memory
+	StatusRemoteNoMemory = 0x1C00001B
+
+	// StatusInvalidPresContextID indicates that the presentation context
+	// referenced by a request has not been negotiated.
+	//
+	// nca_s_invalid_pres_context_id
+	StatusInvalidPresContextID = 0x1C00001C
+
+	// StatusUnsupportedAuthnLevel indicates that the requested authentication
+	// level is not supported.
+	//
+	// nca_s_unsupported_authn_level
+	StatusUnsupportedAuthnLevel = 0x1C00001D
+
+	// StatusInvalidChecksum indicates that a signature was invalid.
+	//
+	// nca_s_invalid_checksum
+	StatusInvalidChecksum = 0x1C00001F
+
+	// StatusInvalidCRC indicates that a CRC was invalid.
+	//
+	// nca_s_invalid_crc
+	StatusInvalidCRC = 0x1C000020
+
+	// StatusUserDefined indicates a user-defined fault.
+	//
+	// nca_s_fault_user_defined
+	StatusUserDefined = 0x1C000021
+
+	// StatusCodesetConvError indicates a character set conversion error.
+	//
+	// nca_s_fault_codeset_conv_error
+	StatusCodesetConvError = 0x1C000023
+
+	// StatusObjectNotFound indicates that the requested object was not found.
+	//
+	// nca_s_fault_object_not_found
+	StatusObjectNotFound = 0x1C000024
+
+	// StatusNoClientStub indicates that the client stub was not available.
+	//
+	// nca_s_fault_no_client_stub
+	StatusNoClientStub = 0x1C000025
+)
+
+// Fault status codes defined by the "[MS-RPCE] Remote Procedure Call Protocol
+// Extensions" publication.
+const (
+	// StatusAccessDenied indicates that the caller was denied access.
+	StatusAccessDenied = 0x00000005
+
+	// StatusNDR indicates that stub data could not be unmarshaled.
+	StatusNDR = 0x000006F7
+
+	// StatusSecurityPackageError indicates that a security package reported an
+	// error.
+	StatusSecurityPackageError = 0x00000721
+)
+
+var statusText = map[uint32]string{
+	StatusCommFailure:           "communication failure",
+	StatusOpRangeError:          "operation number out of range",
+	StatusUnknownInterface:      "unknown interface",
+	StatusWrongBootTime:         "wrong boot time",
+	StatusYouCrashed:            "client restart detected",
+	StatusProtocolError:         "protocol error",
+	StatusOutArgsTooBig:         "output arguments too big",
+	StatusServerTooBusy:         "server too busy",
+	StatusUnsupportedType:       "unsupported type",
+	StatusIntDivByZero:          "integer division by zero",
+	StatusAddrError:             "address error",
+	StatusFPDivByZero:           "floating point division by zero",
+	StatusFPUnderflow:           "floating point underflow",
+	StatusFPOverflow:            "floating point overflow",
+	StatusInvalidTag:            "invalid union tag",
+	StatusInvalidBound:          "invalid array bound",
+	StatusCancel:                "call cancelled",
+	StatusIllegalInstruction:    "illegal instruction",
+	StatusFPError:               "floating point error",
+	StatusIntOverflow:           "integer overflow",
+	StatusUnspecified:           "unspecified fault",
+	StatusPipeEmpty:             "pipe empty",
+	StatusPipeClosed:            "pipe closed",
+	StatusPipeOrder:             "pipe order",
+	StatusPipeDiscipline:        "pipe discipline",
+	StatusPipeCommError:         "pipe communication error",
+	StatusPipeMemory:            "pipe memory",
+	StatusContextMismatch:       "context handle mismatch",
+	StatusRemoteNoMemory:        "server out of memory",
+	StatusInvalidPresContextID:  "invalid presentation context",
+	StatusUnsupportedAuthnLevel: "unsupported authentication level",
+	StatusInvalidChecksum:       "invalid checksum",
+	StatusInvalidCRC:            "invalid CRC",
+	StatusUserDefined:           "user defined fault",
+	StatusCodesetConvError:      "codeset conversion error",
+	StatusObjectNotFound:        "object not found",
+	StatusNoClientStub:          "no client stub",
+	StatusAccessDenied:          "access denied",
+	StatusNDR:                   "stub data could not be unmarshaled",
+	StatusSecurityPackageError:  "security package error",
+}
+
+// StatusText returns a short description of the given fault status code. It
+// returns an empty string if the code is unknown.
+func StatusText(status uint32) string {
+	return statusText[status]
+}
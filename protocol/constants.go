@@ -0,0 +1,42 @@
+package protocol
+
+// Protocol identifiers, which are the first octet of the protocol identifier
+// of each floor in a protocol tower. They are defined in appendix I of the
+// DCE 1.1: Remote Procedure Call technical standard and in the MS-RPCE
+// extensions.
+const (
+	// IdentifierTCP identifies the TCP transport. Its address data is a
+	// big-endian 16-bit port number.
+	IdentifierTCP = 0x07
+
+	// IdentifierUDP identifies the UDP transport. Its address data is a
+	// big-endian 16-bit port number.
+	IdentifierUDP = 0x08
+
+	// IdentifierIP identifies the IP network protocol. Its address data is a
+	// 4 octet IPv4 address.
+	IdentifierIP = 0x09
+
+	// IdentifierConnectionless identifies the connectionless RPC protocol.
+	IdentifierConnectionless = 0x0a
+
+	// IdentifierConnectionOriented identifies the connection-oriented RPC
+	// protocol.
+	IdentifierConnectionOriented = 0x0b
+
+	// IdentifierUUID identifies an abstract or transfer syntax by its UUID and
+	// major version. Its address data is the minor version.
+	IdentifierUUID = 0x0d
+
+	// IdentifierNamedPipe identifies a named pipe endpoint. Its address data
+	// is a null-terminated pipe name.
+	IdentifierNamedPipe = 0x0f
+
+	// IdentifierNetBIOS identifies a NetBIOS host. Its address data is a
+	// null-terminated host name.
+	IdentifierNetBIOS = 0x11
+
+	// IdentifierHTTP identifies the RPC over HTTP transport. Its address data
+	// is a big-endian 16-bit port number.
+	IdentifierHTTP = 0x1f
+)
@@ -1,6 +1,78 @@
 package coproto
 
+import (
+	"io"
+
+	"github.com/gentlemanautomaton/dcerpc/formatlabel"
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationcontext"
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationsyntax"
+	"github.com/gentlemanautomaton/dcerpc/uuid"
+)
+
 // Call represents a single remote procedure call in the connection-oriented
 // protocol.
+//
+// The stub data of the request and response is carried as opaque octets. It
+// is the responsibility of the layer above to marshal and unmarshal the stub
+// data according to the transfer syntax of the call.
 type Call struct {
+	// ID is the call identifier, which is unique within an association.
+	ID uint32
+
+	// ContextID identifies the presentation context that the call was made
+	// within.
+	ContextID presentationcontext.ID
+
+	// AbstractSyntax identifies the interface of the presentation context.
+	AbstractSyntax presentationsyntax.ID
+
+	// TransferSyntax identifies the transfer syntax of the presentation
+	// context, which determines the encoding of the stub data.
+	TransferSyntax presentationsyntax.ID
+
+	// OpNum is the operation number within the interface.
+	OpNum uint16
+
+	// Object is the optional object UUID of the call.
+	Object uuid.UUID
+
+	// RequestFormat is the format label of the request stub data.
+	RequestFormat formatlabel.Format
+
+	// Request holds the stub data of the request.
+	Request []byte
+
+	// ResponseFormat is the format label of the response stub data.
+	ResponseFormat formatlabel.Format
+
+	// Response holds the stub data of the response.
+	Response []byte
+
+	// RequestStream, if it is not nil, is called by a client to write stub
+	// data that follows Request. The data is transmitted in fragments as it
+	// is written, which allows [in] pipes to be sent without buffering them.
+	RequestStream func(w io.Writer) error
+
+	// ResponseStream, if it is not nil, is called by a client with a reader
+	// of the response stub data, which receives its fragments as they are
+	// read, instead of storing it in Response. This allows [out] pipes to be
+	// consumed incrementally. ResponseFormat is set before it is called.
+	ResponseStream func(r io.Reader) error
+
+	// AuthContextID selects the security context that protects a call made
+	// by a client. Zero selects the context established by
+	// Client.Authenticate, and other IDs are returned by
+	// Client.SecurityContext.
+	AuthContextID uint32
+
+	// Auth describes the security context that protected the call. It is nil
+	// if the call was not authenticated.
+	Auth *Auth
+
+	// Group is the association group of the server that received the call,
+	// which holds the contexts that the call may use. It is nil for calls
+	// made by a client.
+	Group *ServerGroup
+
+	auth *authContext // The security context of a call received by a server
 }
@@ -1,29 +1,802 @@
 package coproto
 
-import "sync"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/gentlemanautomaton/dcerpc/formatlabel"
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu"
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationcontext"
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationsyntax"
+	"github.com/gentlemanautomaton/dcerpc/security"
+)
+
+var (
+	// ErrClientClosed is returned when a call is made on a client that has
+	// been closed.
+	ErrClientClosed = errors.New("coproto: client closed")
+
+	// ErrBindRejected is returned when the server rejects the association
+	// with a bind_nak PDU.
+	ErrBindRejected = errors.New("coproto: bind rejected by server")
+
+	// ErrMultiplexingNotNegotiated is returned when an additional security
+	// context is requested on an association that did not agree to security
+	// context multiplexing during bind time feature negotiation.
+	ErrMultiplexingNotNegotiated = errors.New("coproto: security context multiplexing was not negotiated")
+
+	// ErrUnknownSecurityContext is returned when a call selects a security
+	// context that has not been established on the association.
+	ErrUnknownSecurityContext = errors.New("coproto: unknown security context")
+)
+
+// RejectionError is returned when the server rejects a proposed presentation
+// context.
+type RejectionError struct {
+	Result presentationcontext.Result
+	Reason presentationcontext.Reason
+}
+
+// Error returns a description of the rejection.
+func (e *RejectionError) Error() string {
+	return fmt.Sprintf("coproto: presentation context rejected (result %d, reason %d)", e.Result, e.Reason)
+}
 
 // Client is a connection-oriented protocol client. It represents the client
 // side of an RPC association.
 //
 // Each client is capabale of making one RPC call at a time.
 type Client struct {
-	mutex sync.Mutex
-	group *ClientGroup
+	mutex  sync.Mutex
+	group  *ClientGroup
+	conn   io.ReadWriteCloser
+	format formatlabel.Format
+	closed bool
+
+	// Negotiated association state
+	bound         bool
+	assocGroupID  uint32
+	maxXmit       uint16
+	maxRecv       uint16
+	nextCallID    uint32
+	nextContextID presentationcontext.ID
+	contexts      []presentationContext
+	features      presentationcontext.Features
+	headerSign    bool
+	auth          *authContext   // The context established by Authenticate
+	auths         []*authContext // All established contexts
+	nextAuthID    uint32
+	active        *authContext // The context protecting the current call
+}
+
+// NewClient returns a client for the association carried by conn. The
+// association will be established when the first presentation context is
+// negotiated.
+func NewClient(conn io.ReadWriteCloser) *Client {
+	return &Client{
+		conn:       conn,
+		format:     formatlabel.LEAIEEE,
+		maxXmit:    MinSupportedFragmentSize,
+		maxRecv:    MinSupportedFragmentSize,
+		nextCallID: 1,
+		nextAuthID: 1,
+	}
+}
+
+// Authenticate configures the client to establish a security context with
+// the server using the given provider. The security context will be
+// established when the association is bound, so Authenticate must be called
+// before the first presentation context is negotiated.
+//
+// The target identifies the server to the security provider and is usually
+// its network address.
+func (c *Client) Authenticate(provider security.Provider, target string, level security.Level) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.bound || c.auth != nil {
+		return errors.New("coproto: client must be authenticated before it is bound")
+	}
+	auth, err := newClientAuth(provider, target, level)
+	if err != nil {
+		return err
+	}
+	c.auth, c.active = auth, auth
+	return nil
+}
+
+// SecurityContext returns the ID of a security context on the association
+// that was established with the given provider, target and level. Calls are
+// protected by the context when its ID is stored in Call.AuthContextID. The
+// context established by Authenticate has an ID of zero.
+//
+// If no such context exists, an additional context is established with
+// alter_context PDUs. Additional contexts require the association to have
+// agreed to security context multiplexing during bind time feature
+// negotiation, otherwise ErrMultiplexingNotNegotiated is returned. Providers
+// are compared with ==.
+func (c *Client) SecurityContext(ctx context.Context, provider security.Provider, target string, level security.Level) (id uint32, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return 0, ErrClientClosed
+	}
+	if !c.bound {
+		return 0, errors.New("coproto: security context requested before a presentation context was negotiated")
+	}
+	for _, auth := range c.auths {
+		if auth.provider == provider && auth.target == target && auth.Level == level {
+			return auth.ContextID, nil
+		}
+	}
+	if len(c.auths) > 0 && c.features&presentationcontext.SecurityContextMultiplexing == 0 {
+		return 0, ErrMultiplexingNotNegotiated
+	}
+
+	auth, err := newClientAuth(provider, target, level)
+	if err != nil {
+		return 0, err
+	}
+	auth.ContextID = c.nextAuthID
+	c.nextAuthID++
+
+	// The alter_context PDUs propose a presentation context that has already
+	// been accepted, so that they only serve to establish the security
+	// context.
+	var elements []presentationcontext.Element
+	if len(c.contexts) > 0 {
+		pc := &c.contexts[0]
+		elements = append(elements, presentationcontext.Element{
+			ID:                  pc.id,
+			NumTransferSyntaxes: 1,
+			AbstractSyntax:      pc.abstractSyntax,
+			TransferSyntaxes:    []presentationsyntax.ID{pc.transferSyntax},
+		})
+	}
+	stop := c.watch(ctx)
+	_, err = c.bind(presentationcontext.List{
+		NumElements: uint8(len(elements)),
+		Elements:    elements,
+	}, auth)
+	if stop() {
+		return 0, ctx.Err()
+	}
+	if err != nil {
+		c.abort()
+		return 0, err
+	}
+	return auth.ContextID, nil
+}
+
+// Negotiate returns a presentation context for the given abstract syntax that
+// uses one of the given transfer syntaxes, which are listed in order of
+// preference.
+//
+// If a suitable context has already been negotiated on the association it
+// will be returned. Otherwise a new context will be proposed in a bind PDU if
+// the association has not been established, or in an alter_context PDU if it
+// has.
+func (c *Client) Negotiate(ctx context.Context, abstract presentationsyntax.ID, transfer []presentationsyntax.ID) (id presentationcontext.ID, syntax presentationsyntax.ID, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return 0, presentationsyntax.ID{}, ErrClientClosed
+	}
+
+	for _, ts := range transfer {
+		for i := range c.contexts {
+			pc := &c.contexts[i]
+			if pc.abstractSyntax == abstract && pc.transferSyntax == ts {
+				return pc.id, pc.transferSyntax, nil
+			}
+		}
+	}
+
+	id = c.nextContextID
+	elements := []presentationcontext.Element{{
+		ID:                  id,
+		NumTransferSyntaxes: uint8(len(transfer)),
+		AbstractSyntax:      abstract,
+		TransferSyntaxes:    transfer,
+	}}
+	if !c.bound {
+		// Bind time feature negotiation is only permitted in bind PDUs.
+		elements = append(elements, presentationcontext.FeatureNegotiation(id+1, abstract, SupportedFeatures))
+	}
+
+	auth := c.auth
+	if auth != nil && auth.established {
+		auth = nil
+	}
+	stop := c.watch(ctx)
+	results, err := c.bind(presentationcontext.List{
+		NumElements: uint8(len(elements)),
+		Elements:    elements,
+	}, auth)
+	if stop() {
+		return 0, presentationsyntax.ID{}, ctx.Err()
+	}
+	if err == nil && len(results) != len(elements) {
+		err = errors.New("coproto: client received a presentation context result list of the wrong length")
+	}
+	if err != nil {
+		c.abort()
+		return 0, presentationsyntax.ID{}, err
+	}
+	c.nextContextID += presentationcontext.ID(len(elements))
+
+	for i := 1; i < len(results); i++ {
+		if features, ok := results[i].Features(); ok {
+			c.features = features & SupportedFeatures
+		}
+	}
+
+	result := results[0]
+
+	if result.Result != presentationcontext.Acceptance {
+		return 0, presentationsyntax.ID{}, &RejectionError{Result: result.Result, Reason: result.Reason}
+	}
+	c.contexts = append(c.contexts, presentationContext{
+		id:             id,
+		abstractSyntax: abstract,
+		transferSyntax: result.TransferSyntax,
+	})
+	return id, result.TransferSyntax, nil
 }
 
-// Close will release any resources allocated by the client.
+// Invoke sends the request stub data of the call to the server and waits for
+// its response. The call must be made within a presentation context that was
+// returned by Negotiate. The ID of the call will be assigned by the client.
+//
+// The call is protected by the security context selected by its
+// AuthContextID, which is described by call.Auth when Invoke returns.
+//
+// If the server responds with a fault, Invoke returns a *Fault. If ctx is
+// cancelled before the response is received the association will be closed.
+func (c *Client) Invoke(ctx context.Context, call *Call) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return ErrClientClosed
+	}
+	if !c.bound {
+		return errors.New("coproto: call made before a presentation context was negotiated")
+	}
+
+	auth, err := c.callAuth(call.AuthContextID)
+	if err != nil {
+		return err
+	}
+	call.Auth = nil
+	if auth != nil {
+		a := auth.Auth
+		call.Auth = &a
+	}
+	c.active = auth
+	defer func() { c.active = c.auth }()
+
+	call.ID = c.nextCallID
+	c.nextCallID++
+	call.RequestFormat = c.format
+
+	stop := c.watch(ctx)
+	err = c.sendRequest(call)
+	if err == nil {
+		err = c.receiveResponse(call)
+	}
+	if stop() {
+		return ctx.Err()
+	}
+	if err != nil {
+		if _, ok := err.(*Fault); !ok {
+			c.abort()
+		}
+	}
+	return err
+}
+
+// Close closes the underlying connection of the association and releases any
+// resources allocated by the client.
 //
 // The client will remove itself from the group when it is closed.
-func (c *Client) Close() {
+func (c *Client) Close() error {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
-	if c.group == nil {
-		return // Already closed
+	if c.closed {
+		return nil // Already closed
+	}
+	c.closed = true
+	if c.group != nil {
+		c.group.remove(c)
+	}
+	return c.conn.Close()
+}
+
+// Features returns the features that were agreed upon by bind time feature
+// negotiation when the association was established.
+func (c *Client) Features() presentationcontext.Features {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.features
+}
+
+// HeaderSigning reports whether the client and server agreed to sign the
+// header and sec_trailer of protected PDUs when the association was
+// established.
+func (c *Client) HeaderSigning() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.headerSign
+}
+
+// Format returns the format label of the data representation used by the
+// client when marshaling request stub data.
+func (c *Client) Format() formatlabel.Format {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.format
+}
+
+// SetFormat changes the format label of the data representation used by the
+// client when marshaling PDUs and request stub data. Servers convert from the
+// format label of each request, so clients are free to use their native data
+// representation. It takes effect with the next call.
+func (c *Client) SetFormat(format formatlabel.Format) error {
+	if !format.Valid() {
+		return errors.New("coproto: invalid format label")
 	}
-	c.group.remove(c)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.format = format
+	return nil
 }
 
 // Group returns the group that the client is a member of.
 func (c *Client) Group() *ClientGroup {
 	return c.group
 }
+
+// abort closes the association after an unrecoverable error. The caller must
+// hold the client's mutex.
+func (c *Client) abort() {
+	if c.closed {
+		return
+	}
+	c.closed = true
+	if c.group != nil {
+		c.group.remove(c)
+	}
+	c.conn.Close()
+}
+
+// watch closes the association if ctx is cancelled before the returned stop
+// function is called. The stop function reports whether the association was
+// closed because of the cancellation.
+func (c *Client) watch(ctx context.Context) (stop func() bool) {
+	done := make(chan struct{})
+	cancelled := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.conn.Close()
+			cancelled <- true
+		case <-done:
+			cancelled <- false
+		}
+	}()
+	return func() bool {
+		close(done)
+		if <-cancelled {
+			c.abort()
+			return true
+		}
+		return false
+	}
+}
+
+// callAuth returns the established security context with the given ID. An
+// ID of zero selects the context established by Authenticate, if any. The
+// caller must hold the client's mutex.
+func (c *Client) callAuth(id uint32) (*authContext, error) {
+	for _, auth := range c.auths {
+		if auth.ContextID == id {
+			return auth, nil
+		}
+	}
+	if id == 0 && (c.auth == nil || !c.auth.established) {
+		return nil, nil
+	}
+	return nil, ErrUnknownSecurityContext
+}
+
+// bind proposes the given presentation context list to the server and
+// returns the results. If auth is not nil the exchange that establishes the
+// security context is carried out as part of the bind, continuing with
+// alter_context or rpc_auth_3 PDUs as necessary. The context is added to the
+// client's established contexts once it is complete. The caller must hold
+// the client's mutex.
+func (c *Client) bind(elements presentationcontext.List, auth *authContext) (results []presentationcontext.ResultElement, err error) {
+	var verifier *copdu.AuthVerifier
+	if auth != nil {
+		token, done, err := auth.client.InitContext(nil)
+		if err != nil {
+			return nil, err
+		}
+		auth.done = done
+		verifier = auth.verifier(token)
+	}
+
+	body := c.bindBody(elements)
+	p, err := c.exchange(body, verifier)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp := p.Body.(type) {
+	case *copdu.BindAck:
+		if c.bound {
+			return nil, errors.New("coproto: client received an unexpected bind_ack")
+		}
+		c.bound = true
+		c.maxXmit = negotiateFragmentSize(resp.MaxTransmitFrag)
+		c.maxRecv = negotiateFragmentSize(resp.MaxReceiveFrag)
+		c.assocGroupID = resp.AssocGroupID
+		if c.group != nil {
+			c.group.bound(resp.AssocGroupID)
+		}
+		c.headerSign = p.Header.Flags&copdu.SupportHeaderSign != 0
+		results = resp.Results.Results
+	case *copdu.AlterContextResp:
+		if !c.bound {
+			return nil, errors.New("coproto: client received an unexpected alter_context_resp")
+		}
+		results = resp.Results.Results
+	case *copdu.BindNak:
+		if bind, ok := body.(*copdu.Bind); ok && c.group != nil && bind.AssocGroupID != 0 {
+			c.group.rejected(bind.AssocGroupID)
+		}
+		return nil, ErrBindRejected
+	default:
+		return nil, errors.New("coproto: client received an unexpected packet type")
+	}
+
+	if auth != nil {
+		auth.headerSign = c.headerSign
+		defer func() {
+			if err == nil {
+				c.auths = append(c.auths, auth)
+			}
+		}()
+	}
+	for auth != nil && !auth.established {
+		if auth.done {
+			auth.established = true
+			break
+		}
+		if p.Auth == nil {
+			return nil, errors.New("coproto: server did not continue the authentication exchange")
+		}
+		token, done, err := auth.client.InitContext(p.Auth.Value)
+		if err != nil {
+			return nil, err
+		}
+		auth.done = done
+		if done {
+			auth.established = true
+			if len(token) > 0 {
+				err = c.write(&copdu.PDU{
+					Header: c.header(c.nextCallID, copdu.FirstFrag|copdu.LastFrag),
+					Body:   &copdu.Auth3{},
+					Auth:   auth.verifier(token),
+				})
+				c.nextCallID++
+			}
+			return results, err
+		}
+		if p, err = c.exchange(c.bindBody(elements), auth.verifier(token)); err != nil {
+			return nil, err
+		}
+		if _, ok := p.Body.(*copdu.AlterContextResp); !ok {
+			return nil, errors.New("coproto: client received an unexpected packet type")
+		}
+	}
+	return results, nil
+}
+
+// bindBody returns a bind PDU body that proposes the given presentation
+// context list if the association has not been established, otherwise it
+// returns an alter_context PDU body.
+func (c *Client) bindBody(elements presentationcontext.List) copdu.Body {
+	if c.bound {
+		return &copdu.AlterContext{
+			MaxTransmitFrag: c.maxXmit,
+			MaxReceiveFrag:  c.maxRecv,
+			AssocGroupID:    c.assocGroupID,
+			Elements:        elements,
+		}
+	}
+	return &copdu.Bind{
+		MaxTransmitFrag: MaxFragmentSize,
+		MaxReceiveFrag:  MaxFragmentSize,
+		AssocGroupID:    c.groupID(),
+		Elements:        elements,
+	}
+}
+
+// exchange sends a PDU with the given body and auth verifier and returns the
+// response of the server.
+func (c *Client) exchange(body copdu.Body, verifier *copdu.AuthVerifier) (*copdu.PDU, error) {
+	callID := c.nextCallID
+	c.nextCallID++
+	flags := uint8(copdu.FirstFrag | copdu.LastFrag)
+	if _, ok := body.(*copdu.Bind); ok {
+		flags |= copdu.SupportHeaderSign
+	}
+	err := c.write(&copdu.PDU{
+		Header: c.header(callID, flags),
+		Body:   body,
+		Auth:   verifier,
+	})
+	if err != nil {
+		return nil, err
+	}
+	p, err := c.read()
+	if err != nil {
+		return nil, err
+	}
+	if p.Header.CallID != callID {
+		return nil, errors.New("coproto: client received a response with an unexpected call ID")
+	}
+	return p, nil
+}
+
+// sendRequest transmits the request stub data of the call, fragmenting it as
+// necessary. Calls protected at the integrity level or higher are followed by
+// a verification trailer.
+func (c *Client) sendRequest(call *Call) error {
+	overhead := copdu.HeaderLength + 8
+	if !call.Object.IsNil() {
+		overhead += 16
+	}
+	max := int(c.maxXmit) - overhead
+	if size := c.active.signatureSize(); size > 0 {
+		// Keep the stub data of each fragment aligned so that only the last
+		// fragment requires auth padding.
+		max = (max - size) &^ 15
+	}
+	if call.RequestStream != nil {
+		return c.streamRequest(call, max)
+	}
+	stub := call.Request
+	if c.active.verifies() {
+		stub = c.verificationTrailer(call).Append(stub[:len(stub):len(stub)])
+	}
+	total := len(stub)
+	flags := uint8(copdu.FirstFrag)
+	for {
+		n := len(stub)
+		if n > max {
+			n = max
+		} else {
+			flags |= copdu.LastFrag
+		}
+		err := c.send(call.ID, flags, &copdu.Request{
+			AllocHint:     uint32(total),
+			PresContextID: call.ContextID,
+			OpNum:         call.OpNum,
+			Object:        call.Object,
+			Stub:          stub[:n],
+		})
+		if err != nil || flags&copdu.LastFrag != 0 {
+			return err
+		}
+		stub = stub[n:]
+		flags = 0
+	}
+}
+
+// streamRequest transmits the request stub data of the call that is written
+// by its RequestStream function, sending a fragment each time more than max
+// octets are pending. The total length of the stub data is unknown when the
+// first fragment is sent, so no allocation hint is given.
+func (c *Client) streamRequest(call *Call, max int) error {
+	w := &requestWriter{
+		c:     c,
+		call:  call,
+		max:   max,
+		flags: copdu.FirstFrag,
+		buf:   append([]byte(nil), call.Request...),
+	}
+	if err := call.RequestStream(w); err != nil {
+		return err
+	}
+	if w.err != nil {
+		return w.err
+	}
+	if c.active.verifies() {
+		// Every fragment that has been sent holds a multiple of 16 octets,
+		// so the alignment of the trailer is preserved.
+		w.buf = c.verificationTrailer(call).Append(w.buf)
+	}
+	return w.send(w.buf, copdu.LastFrag)
+}
+
+// requestWriter fragments request stub data as it is written.
+type requestWriter struct {
+	c     *Client
+	call  *Call
+	max   int
+	flags uint8
+	buf   []byte
+	err   error
+}
+
+func (w *requestWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	w.buf = append(w.buf, p...)
+	for len(w.buf) > w.max {
+		if err := w.send(w.buf[:w.max], 0); err != nil {
+			w.err = err
+			return 0, err
+		}
+		w.buf = append(w.buf[:0], w.buf[w.max:]...)
+	}
+	return len(p), nil
+}
+
+// send transmits stub as the next fragment of the request with the given
+// additional flags.
+func (w *requestWriter) send(stub []byte, flags uint8) error {
+	err := w.c.send(w.call.ID, w.flags|flags, &copdu.Request{
+		PresContextID: w.call.ContextID,
+		OpNum:         w.call.OpNum,
+		Object:        w.call.Object,
+		Stub:          stub,
+	})
+	w.flags = 0
+	return err
+}
+
+// receiveResponse receives and reassembles the response stub data of the
+// call, or passes it to the call's ResponseStream function as it is
+// received.
+func (c *Client) receiveResponse(call *Call) error {
+	call.Response = nil
+	resp, last, err := c.readResponse(call, true)
+	if err != nil {
+		return err
+	}
+	if call.ResponseStream != nil {
+		r := &responseReader{c: c, call: call, stub: resp.Stub, last: last}
+		if err := call.ResponseStream(r); err != nil {
+			return err
+		}
+		if r.err != nil {
+			return r.err
+		}
+		// Discard any stub data that was not read.
+		for !r.last {
+			if _, r.last, err = c.readResponse(call, false); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	call.Response = make([]byte, 0, allocHint(resp.AllocHint, c.maxRecv))
+	call.Response = append(call.Response, resp.Stub...)
+	for !last {
+		if resp, last, err = c.readResponse(call, false); err != nil {
+			return err
+		}
+		call.Response = append(call.Response, resp.Stub...)
+	}
+	return nil
+}
+
+// readResponse reads the next fragment of the response to the call. The
+// format label of the first fragment is recorded as the call's response
+// format, and must be shared by the fragments that follow it. A fault is
+// returned as a *Fault.
+func (c *Client) readResponse(call *Call, first bool) (resp *copdu.Response, last bool, err error) {
+	p, err := c.read()
+	if err != nil {
+		return nil, false, err
+	}
+	if p.Header.CallID != call.ID {
+		return nil, false, errors.New("coproto: client received a response with an unexpected call ID")
+	}
+	switch body := p.Body.(type) {
+	case *copdu.Response:
+		if first {
+			call.ResponseFormat = p.Header.Format
+		} else if p.Header.Format != call.ResponseFormat {
+			return nil, false, errors.New("coproto: client received response fragments with differing format labels")
+		}
+		return body, p.Header.Flags&copdu.LastFrag != 0, nil
+	case *copdu.Fault:
+		return nil, false, &Fault{
+			Status:        body.Status,
+			DidNotExecute: p.Header.Flags&copdu.DidNotExecute != 0,
+			Stub:          body.Stub,
+		}
+	default:
+		return nil, false, errors.New("coproto: client received an unexpected packet type")
+	}
+}
+
+// responseReader reads response stub data as its fragments are received.
+type responseReader struct {
+	c    *Client
+	call *Call
+	stub []byte
+	last bool
+	err  error
+}
+
+func (r *responseReader) Read(p []byte) (int, error) {
+	for len(r.stub) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.last {
+			return 0, io.EOF
+		}
+		resp, last, err := r.c.readResponse(r.call, false)
+		if err != nil {
+			r.err = err
+			return 0, err
+		}
+		r.stub, r.last = resp.Stub, last
+	}
+	n := copy(p, r.stub)
+	r.stub = r.stub[n:]
+	return n, nil
+}
+
+func (c *Client) send(callID uint32, flags uint8, body copdu.Body) error {
+	return c.write(&copdu.PDU{
+		Header: c.header(callID, flags),
+		Body:   body,
+	})
+}
+
+func (c *Client) header(callID uint32, flags uint8) copdu.Header {
+	return copdu.Header{
+		Flags:  flags,
+		Format: c.format,
+		CallID: callID,
+	}
+}
+
+// write marshals p, protecting it with the security context of the current
+// call if necessary, and writes it to the connection.
+func (c *Client) write(p *copdu.PDU) error {
+	b, err := c.active.marshal(p)
+	if err != nil {
+		return err
+	}
+	_, err = c.conn.Write(b)
+	return err
+}
+
+// read reads the next PDU from the connection, verifying it with the
+// security context of the current call if necessary.
+func (c *Client) read() (*copdu.PDU, error) {
+	b, err := copdu.ReadFragment(c.conn)
+	if err != nil {
+		return nil, err
+	}
+	return c.active.unmarshal(b)
+}
+
+// groupID returns the association group ID to request when binding.
+func (c *Client) groupID() uint32 {
+	if c.group == nil {
+		return 0
+	}
+	return c.group.ID()
+}
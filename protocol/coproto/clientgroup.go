@@ -16,13 +16,44 @@ type ClientGroup struct {
 
 	mutex   sync.RWMutex
 	clients []*Client
-	active  uint // How many active contexts are there?
+	idle    []*Client // Clients that are not currently allocated
+	active  uint      // How many active contexts are there?
+}
+
+// ID returns the association group ID assigned by the server. It returns zero
+// if no client in the group has been bound.
+func (group *ClientGroup) ID() uint32 {
+	group.mutex.RLock()
+	defer group.mutex.RUnlock()
+	return group.id
+}
+
+// bound records the association group ID assigned by the server when the
+// first client in the group is bound. Clients that are bound later will
+// request the same association group.
+func (group *ClientGroup) bound(id uint32) {
+	group.mutex.Lock()
+	defer group.mutex.Unlock()
+	if group.id == 0 {
+		group.id = id
+	}
+}
+
+// rejected forgets the association group ID if the server rejected a bind
+// that requested it, so that the next client will start a new group.
+func (group *ClientGroup) rejected(id uint32) {
+	group.mutex.Lock()
+	defer group.mutex.Unlock()
+	if group.id == id {
+		group.id = 0
+	}
 }
 
 // add will add the client to the group.
 func (group *ClientGroup) add(client *Client) {
 	group.mutex.Lock()
 	defer group.mutex.Unlock()
+	client.group = group
 	group.clients = append(group.clients, client)
 	return
 }
@@ -36,6 +67,37 @@ func (group *ClientGroup) remove(client *Client) {
 			group.clients = append(group.clients[:i], group.clients[i+1:]...)
 		}
 	}
+	for i := 0; i < len(group.idle); i++ {
+		if group.idle[i] == client {
+			group.idle = append(group.idle[:i], group.idle[i+1:]...)
+		}
+	}
+}
+
+// take will remove an idle client from the group and return it. It returns
+// nil if there are no idle clients.
+func (group *ClientGroup) take() *Client {
+	group.mutex.Lock()
+	defer group.mutex.Unlock()
+	n := len(group.idle)
+	if n == 0 {
+		return nil
+	}
+	client := group.idle[n-1]
+	group.idle = group.idle[:n-1]
+	return client
+}
+
+// release will return client to the group's list of idle clients.
+func (group *ClientGroup) release(client *Client) {
+	group.mutex.Lock()
+	defer group.mutex.Unlock()
+	for i := 0; i < len(group.clients); i++ {
+		if group.clients[i] == client {
+			group.idle = append(group.idle, client)
+			return
+		}
+	}
 }
 
 // activate will increment the number of active contexts within the client
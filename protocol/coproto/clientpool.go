@@ -1,6 +1,14 @@
 package coproto
 
-import "sync"
+import (
+	"context"
+	"sync"
+)
+
+// DialFunc establishes a new connection and returns a client for it. The
+// client may be configured, such as by calling Authenticate, before it is
+// returned.
+type DialFunc func(ctx context.Context) (*Client, error)
 
 // ClientPool manages a pool of clients.
 type ClientPool struct {
@@ -11,8 +19,65 @@ type ClientPool struct {
 // Allocate will return an existing client from the pool if one is available,
 // otherwise it will attempt to allocate a new client and return it.
 //
-// TODO: Receive and process the endpoint address as a parameter.
-func (pool *ClientPool) Allocate() (client *Client) {
-	// FIXME: Write this
-	return nil
+// Clients are pooled by address, which identifies the server endpoint. If a
+// new client is needed, dial will be called to establish its connection.
+//
+// The caller must return the client to the pool by calling Release when it
+// has finished using it.
+func (pool *ClientPool) Allocate(ctx context.Context, address string, dial DialFunc) (client *Client, err error) {
+	group := pool.group(address)
+	if client = group.take(); client != nil {
+		return client, nil
+	}
+
+	if client, err = dial(ctx); err != nil {
+		return nil, err
+	}
+	group.add(client)
+	return client, nil
+}
+
+// Release returns client to the pool so that it may be allocated again. If
+// the client has been closed it will be discarded.
+func (pool *ClientPool) Release(client *Client) {
+	client.mutex.Lock()
+	closed, group := client.closed, client.group
+	client.mutex.Unlock()
+	if closed || group == nil {
+		return
+	}
+	group.release(client)
+}
+
+// Close closes all of the clients in the pool.
+func (pool *ClientPool) Close() {
+	pool.mutex.Lock()
+	groups := pool.groups
+	pool.groups = nil
+	pool.mutex.Unlock()
+
+	for _, group := range groups {
+		group.mutex.RLock()
+		clients := append([]*Client(nil), group.clients...)
+		group.mutex.RUnlock()
+		for _, client := range clients {
+			client.Close()
+		}
+	}
+}
+
+// group returns the client group for address, creating it if necessary.
+func (pool *ClientPool) group(address string) *ClientGroup {
+	key := clientGroupKey{address: address}
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	if group, ok := pool.groups[key]; ok {
+		return group
+	}
+	if pool.groups == nil {
+		pool.groups = make(map[clientGroupKey]*ClientGroup)
+	}
+	group := new(ClientGroup)
+	pool.groups[key] = group
+	return group
 }
@@ -0,0 +1,105 @@
+package coproto
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationsyntax"
+)
+
+// poolDialer dials servers in a server pool over in-memory pipes.
+type poolDialer struct {
+	pool    ServerPool
+	servers []*Server
+}
+
+func (d *poolDialer) dial(ctx context.Context) (*Client, error) {
+	cconn, sconn := net.Pipe()
+	server := d.pool.NewServer(sconn, &testHandler{})
+	go server.Serve(context.Background())
+	d.servers = append(d.servers, server)
+	return NewClient(cconn), nil
+}
+
+func (d *poolDialer) close() {
+	for _, server := range d.servers {
+		server.Close()
+	}
+}
+
+// allocate allocates a client from pool and binds it.
+func (d *poolDialer) allocate(pool *ClientPool) (*Client, error) {
+	client, err := pool.Allocate(context.Background(), "test", d.dial)
+	if err != nil {
+		return nil, err
+	}
+	_, _, err = client.Negotiate(context.Background(), testAbstract, []presentationsyntax.ID{testTransfer})
+	return client, err
+}
+
+func TestClientPoolGroup(t *testing.T) {
+	var d poolDialer
+	defer d.close()
+	var pool ClientPool
+	defer pool.Close()
+
+	client1, err := d.allocate(&pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	group := d.servers[0].Group()
+	if group == nil || group.ID() == 0 {
+		t.Fatal("server did not assign an association group")
+	}
+
+	// The first client is still allocated, so a second connection is
+	// dialed. It must join the group assigned to the first.
+	client2, err := d.allocate(&pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.servers) != 2 {
+		t.Fatalf("%d connections were dialed, want 2", len(d.servers))
+	}
+	if d.servers[1].Group() != group {
+		t.Fatalf("second connection joined group %#x, want %#x", d.servers[1].Group().ID(), group.ID())
+	}
+
+	pool.Release(client1)
+	if client, err := d.allocate(&pool); err != nil || client != client1 {
+		t.Fatalf("released client was not reused: %v", err)
+	}
+	pool.Release(client1)
+	pool.Release(client2)
+}
+
+func TestClientPoolGroupClosed(t *testing.T) {
+	var d poolDialer
+	defer d.close()
+	var pool ClientPool
+	defer pool.Close()
+
+	client, err := d.allocate(&pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	group := d.servers[0].Group()
+	closed := make(chan struct{})
+	group.OnClose(func() { close(closed) })
+	client.Close()
+	d.servers[0].Close()
+	<-closed
+
+	// The server rejects the closed group, after which the pool starts a
+	// new one.
+	if _, err := d.allocate(&pool); err != ErrBindRejected {
+		t.Fatalf("binding to a closed group returned %v, want %v", err, ErrBindRejected)
+	}
+	if _, err := d.allocate(&pool); err != nil {
+		t.Fatal(err)
+	}
+	if g := d.servers[2].Group(); g == nil || g == group {
+		t.Fatal("client did not start a new association group")
+	}
+}
@@ -1,6 +1,10 @@
 package coproto
 
-import "time"
+import (
+	"time"
+
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationcontext"
+)
 
 const (
 	// MaxBackoff is the maximum allowable time between retries.
@@ -19,4 +23,22 @@ const (
 	//
 	// CONST_MUST_RCV_FRAG_SIZE
 	MinSupportedFragmentSize = 1432
+
+	// MaxFragmentSize is the largest fragment size that will be proposed or
+	// accepted by this implementation.
+	MaxFragmentSize = 5840
+
+	// AllocHintFragments limits the memory that is allocated for the stub
+	// data of a call before it arrives. The alloc_hint of a request or
+	// response is advisory, and is honored only up to this many fragments of
+	// the negotiated size.
+	AllocHintFragments = 16
+
+	// DefaultMaxRequestSize is the largest request stub data that a server
+	// accepts for a call, unless it is configured otherwise.
+	DefaultMaxRequestSize = 16 << 20
 )
+
+// SupportedFeatures is the set of bind time features that will be proposed or
+// acknowledged by this implementation.
+const SupportedFeatures = presentationcontext.SecurityContextMultiplexing | presentationcontext.KeepConnectionOnOrphan
@@ -0,0 +1,30 @@
+package coproto
+
+import (
+	"fmt"
+
+	"github.com/gentlemanautomaton/dcerpc/pdu"
+)
+
+// Fault is an error that describes a fault condition reported by the server
+// side of an association.
+type Fault struct {
+	// Status is the fault status code. It is zero for application errors
+	// that are described by the stub data.
+	Status uint32
+
+	// DidNotExecute is true if the server indicated that the remote
+	// procedure was not executed.
+	DidNotExecute bool
+
+	// Stub holds the stub data that describes an application error.
+	Stub []byte
+}
+
+// Error returns a description of the fault.
+func (f *Fault) Error() string {
+	if text := pdu.StatusText(f.Status); text != "" {
+		return fmt.Sprintf("rpc fault 0x%08x: %s", f.Status, text)
+	}
+	return fmt.Sprintf("rpc fault 0x%08x", f.Status)
+}
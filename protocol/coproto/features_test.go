@@ -0,0 +1,132 @@
+package coproto
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationcontext"
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationsyntax"
+	"github.com/gentlemanautomaton/dcerpc/uuid"
+)
+
+// featurePrefix is the wire representation of the first 8 octets of the bind
+// time feature negotiation pseudo transfer syntax.
+var featurePrefix = []byte{0x2c, 0x1c, 0xb7, 0x6c, 0x12, 0x98, 0x40, 0x45}
+
+func TestFeatureNegotiationSyntax(t *testing.T) {
+	id := presentationcontext.FeatureNegotiationSyntax(presentationcontext.SecurityContextMultiplexing | presentationcontext.KeepConnectionOnOrphan)
+	if want := uuid.MustParse("6cb71c2c-9812-4540-0300-000000000000"); id.Interface != want || id.Major() != 1 || id.Minor() != 0 {
+		t.Fatalf("FeatureNegotiationSyntax returned %v", id)
+	}
+	if features, ok := presentationcontext.ParseFeatureNegotiationSyntax(id); !ok || features != 3 {
+		t.Fatalf("ParseFeatureNegotiationSyntax returned %#x, %t", features, ok)
+	}
+	if _, ok := presentationcontext.ParseFeatureNegotiationSyntax(testTransfer); ok {
+		t.Fatal("ParseFeatureNegotiationSyntax accepted the NDR transfer syntax")
+	}
+
+	ack := presentationcontext.FeatureAck(presentationcontext.KeepConnectionOnOrphan)
+	if ack.Result != 3 || ack.Reason != 2 {
+		t.Fatalf("FeatureAck returned result %d and reason %d", ack.Result, ack.Reason)
+	}
+	if features, ok := ack.Features(); !ok || features != presentationcontext.KeepConnectionOnOrphan {
+		t.Fatalf("Features returned %#x, %t", features, ok)
+	}
+	accepted := presentationcontext.ResultElement{Result: presentationcontext.Acceptance}
+	if _, ok := accepted.Features(); ok {
+		t.Fatal("Features accepted the result of an ordinary presentation context")
+	}
+}
+
+// recordConn records the PDUs written by a client.
+type recordConn struct {
+	net.Conn
+	mutex sync.Mutex
+	pdus  [][]byte
+}
+
+func (c *recordConn) Write(b []byte) (int, error) {
+	c.mutex.Lock()
+	c.pdus = append(c.pdus, append([]byte(nil), b...))
+	c.mutex.Unlock()
+	return c.Conn.Write(b)
+}
+
+func TestFeatureNegotiation(t *testing.T) {
+	cconn, sconn := net.Pipe()
+	server := NewServer(sconn, &testHandler{})
+	go server.Serve(context.Background())
+
+	conn := &recordConn{Conn: cconn}
+	client := NewClient(conn)
+	defer client.Close()
+	id, _, err := client.Negotiate(context.Background(), testAbstract, []presentationsyntax.ID{testTransfer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := client.Features(); f != SupportedFeatures {
+		t.Fatalf("client agreed to features %#x, want %#x", f, SupportedFeatures)
+	}
+	call := Call{ContextID: id, Request: []byte{1}}
+	if err := client.Invoke(context.Background(), &call); err != nil {
+		t.Fatal(err)
+	}
+	if f := server.Features(); f != SupportedFeatures {
+		t.Fatalf("server agreed to features %#x, want %#x", f, SupportedFeatures)
+	}
+
+	// Features are only proposed in the bind PDU, not when further
+	// presentation contexts are negotiated with alter_context.
+	other := presentationsyntax.New(uuid.MustParse("87654321-1234-abcd-ef00-0123456789ab"), 1, 0)
+	if _, _, err := client.Negotiate(context.Background(), other, []presentationsyntax.ID{testTransfer}); err != nil {
+		t.Fatal(err)
+	}
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	var bind, alter int
+	for _, pdu := range conn.pdus {
+		switch pdu[2] {
+		case 11:
+			bind++
+			if !bytes.Contains(pdu, featurePrefix) {
+				t.Error("bind PDU does not propose features")
+			}
+		case 14:
+			alter++
+			if bytes.Contains(pdu, featurePrefix) {
+				t.Error("alter_context PDU proposes features")
+			}
+		}
+	}
+	if bind != 1 || alter != 1 {
+		t.Fatalf("client sent %d bind and %d alter_context PDUs", bind, alter)
+	}
+}
+
+func TestFeatureNegotiationUnsupported(t *testing.T) {
+	cconn, sconn := net.Pipe()
+	// The proposal is altered so that the server does not recognize it and
+	// accepts it as an ordinary presentation context, as a server that does
+	// not implement feature negotiation would.
+	client := NewClient(&tamperConn{Conn: cconn, tamper: func(b []byte) {
+		if i := bytes.Index(b, featurePrefix); i >= 0 && b[2] == 11 {
+			b[i] ^= 0xff
+		}
+	}})
+	defer client.Close()
+	server := NewServer(sconn, &testHandler{})
+	go server.Serve(context.Background())
+
+	if _, _, err := client.Negotiate(context.Background(), testAbstract, []presentationsyntax.ID{testTransfer}); err != nil {
+		t.Fatal(err)
+	}
+	if f := client.Features(); f != 0 {
+		t.Fatalf("client agreed to features %#x without an acknowledgement", f)
+	}
+	if f := server.Features(); f != 0 {
+		t.Fatalf("server agreed to features %#x", f)
+	}
+}
@@ -0,0 +1,117 @@
+package coproto
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+
+	"github.com/gentlemanautomaton/dcerpc/formatlabel"
+	"github.com/gentlemanautomaton/dcerpc/ndr"
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationsyntax"
+)
+
+type formatRequest struct {
+	Scale  float64
+	Name   string `idl:"string,char"`
+	Length uint32
+	Values []int32 `idl:"size_is(Length)"`
+}
+
+type formatResponse struct {
+	Sum float64
+}
+
+// formatHandler decodes each request in the data representation of its
+// format label and responds with the scaled sum of its values.
+type formatHandler struct {
+	testHandler
+}
+
+func (h *formatHandler) ServeCall(ctx context.Context, call *Call) error {
+	dec, err := ndr.NewDecoder(bytes.NewReader(call.Request), call.RequestFormat)
+	if err != nil {
+		return err
+	}
+	var req formatRequest
+	if err := dec.Decode(&req); err != nil {
+		return err
+	}
+	var resp formatResponse
+	for _, v := range req.Values {
+		resp.Sum += float64(v) * req.Scale
+	}
+	if req.Name != "sum" {
+		resp.Sum = -1
+	}
+	var buf bytes.Buffer
+	enc, err := ndr.NewEncoder(&buf, call.ResponseFormat)
+	if err != nil {
+		return err
+	}
+	if err := enc.Encode(&resp); err != nil {
+		return err
+	}
+	call.Response = buf.Bytes()
+	return nil
+}
+
+func TestReceiverMakesRight(t *testing.T) {
+	formats := []formatlabel.Format{
+		formatlabel.LEAIEEE,
+		formatlabel.BEAIEEE,
+		formatlabel.New(formatlabel.BigEndian, formatlabel.EBCDIC, formatlabel.IBM),
+		formatlabel.New(formatlabel.LittleEndian, formatlabel.ASCII, formatlabel.VAX),
+		formatlabel.New(formatlabel.BigEndian, formatlabel.ASCII, formatlabel.Cray),
+	}
+
+	// Each request spans several fragments.
+	req := formatRequest{Scale: 0.5, Name: "sum", Length: 1000}
+	var want float64
+	for i := int32(0); i < 1000; i++ {
+		req.Values = append(req.Values, i-500)
+		want += float64(i-500) * 0.5
+	}
+
+	for _, format := range formats {
+		cconn, sconn := net.Pipe()
+		server := NewServer(sconn, &formatHandler{})
+		go server.Serve(context.Background())
+
+		client := NewClient(cconn)
+		defer client.Close()
+		if err := client.SetFormat(format); err != nil {
+			t.Fatal(err)
+		}
+		id, _, err := client.Negotiate(context.Background(), testAbstract, []presentationsyntax.ID{testTransfer})
+		if err != nil {
+			t.Fatalf("format %v: %v", format, err)
+		}
+
+		var buf bytes.Buffer
+		enc, _ := ndr.NewEncoder(&buf, format)
+		if err := enc.Encode(&req); err != nil {
+			t.Fatal(err)
+		}
+		call := Call{ContextID: id, Request: buf.Bytes()}
+		if err := client.Invoke(context.Background(), &call); err != nil {
+			t.Fatalf("format %v: %v", format, err)
+		}
+		if call.ResponseFormat != formatlabel.LEAIEEE {
+			t.Errorf("format %v: response has format %v", format, call.ResponseFormat)
+		}
+		var resp formatResponse
+		dec, _ := ndr.NewDecoder(bytes.NewReader(call.Response), call.ResponseFormat)
+		if err := dec.Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Sum != want {
+			t.Errorf("format %v: server computed %v, want %v", format, resp.Sum, want)
+		}
+	}
+
+	client := NewClient(nil)
+	if err := client.SetFormat(formatlabel.New(2, formatlabel.ASCII, formatlabel.IEEE)); err == nil {
+		t.Error("client accepted an invalid format label")
+	}
+}
@@ -0,0 +1,193 @@
+package coproto
+
+import (
+	"errors"
+
+	"github.com/gentlemanautomaton/dcerpc/pdu"
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu"
+	"github.com/gentlemanautomaton/dcerpc/security"
+)
+
+var (
+	// ErrUnprotected is returned when a PDU that should have been protected
+	// by the security context of an association is received without an auth
+	// verifier.
+	ErrUnprotected = errors.New("coproto: received an unprotected PDU on an authenticated association")
+
+	// ErrAuthMismatch is returned when the auth verifier of a received PDU
+	// does not match the security context of the association.
+	ErrAuthMismatch = errors.New("coproto: auth verifier does not match the security context")
+)
+
+// Auth describes the security context of an authenticated association.
+type Auth struct {
+	Type      security.Type
+	Level     security.Level
+	ContextID uint32
+	Context   security.Context
+}
+
+// authContext tracks the establishment and use of a security context on an
+// association.
+type authContext struct {
+	Auth
+	provider    security.Provider
+	target      string
+	client      security.ClientContext
+	server      security.ServerContext
+	done        bool // The local side of the context is complete
+	established bool // Both sides of the context are complete
+	headerSign  bool // Signatures cover the PDU header and sec_trailer
+}
+
+func newClientAuth(provider security.Provider, target string, level security.Level) (*authContext, error) {
+	sc, err := provider.NewClientContext(target, level)
+	if err != nil {
+		return nil, err
+	}
+	return &authContext{
+		Auth: Auth{
+			Type:    provider.Type(),
+			Level:   level,
+			Context: sc,
+		},
+		provider: provider,
+		target:   target,
+		client:   sc,
+	}, nil
+}
+
+func newServerAuth(provider security.Provider, verifier *copdu.AuthVerifier) (*authContext, error) {
+	level := security.Level(verifier.Level)
+	sc, err := provider.NewServerContext(level)
+	if err != nil {
+		return nil, err
+	}
+	return &authContext{
+		Auth: Auth{
+			Type:      provider.Type(),
+			Level:     level,
+			ContextID: verifier.ContextID,
+			Context:   sc,
+		},
+		server: sc,
+	}, nil
+}
+
+// verifier returns an auth verifier that carries the given value.
+func (a *authContext) verifier(value []byte) *copdu.AuthVerifier {
+	return &copdu.AuthVerifier{
+		Type:      uint8(a.Type),
+		Level:     uint8(a.Level),
+		ContextID: a.ContextID,
+		Value:     value,
+	}
+}
+
+// protects reports whether request, response and fault PDUs must be
+// protected by the context.
+func (a *authContext) protects() bool {
+	return a != nil && a.established && a.Level.Signed()
+}
+
+// signatureSize returns the number of octets added to each protected PDU
+// for its sec_trailer and signature.
+func (a *authContext) signatureSize() int {
+	if !a.protects() {
+		return 0
+	}
+	return copdu.AuthTrailerLength + a.Context.SignatureSize()
+}
+
+// marshal returns the binary representation of p. If p carries stub data and
+// the context protects it, it will be signed or sealed.
+//
+// The signature covers the stub data, the auth padding and the sec_trailer.
+// If header signing was negotiated it also covers the PDU header. When the
+// context is sealed the stub data and auth padding are encrypted.
+func (a *authContext) marshal(p *copdu.PDU) ([]byte, error) {
+	if !a.protects() || !carriesStub(p.Body.PacketType()) {
+		return p.Marshal()
+	}
+	p.Auth = a.verifier(make([]byte, a.Context.SignatureSize()))
+	b, err := p.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	layout, err := copdu.Layout(b)
+	if err != nil {
+		return nil, err
+	}
+	msg := a.signed(b, layout)
+	var signature []byte
+	if a.Level.Sealed() {
+		signature, err = a.Context.Seal(msg, b[layout.Stub:layout.Trailer])
+	} else {
+		signature, err = a.Context.Sign(msg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(signature) != layout.End-layout.Value {
+		return nil, errors.New("coproto: security provider returned a signature of unexpected length")
+	}
+	copy(b[layout.Value:], signature)
+	return b, nil
+}
+
+// unmarshal unmarshals the PDU stored in b. If the PDU carries stub data and
+// the context protects it, its signature is verified and its stub data is
+// decrypted as necessary.
+func (a *authContext) unmarshal(b []byte) (*copdu.PDU, error) {
+	p := new(copdu.PDU)
+	if a.protects() {
+		var h copdu.Header
+		if err := h.Unmarshal(b); err != nil {
+			return nil, err
+		}
+		if carriesStub(h.PacketType) {
+			if h.AuthLength == 0 {
+				return nil, ErrUnprotected
+			}
+			layout, err := copdu.Layout(b)
+			if err != nil {
+				return nil, err
+			}
+			trailer := b[layout.Trailer:layout.Value]
+			if security.Type(trailer[0]) != a.Type || security.Level(trailer[1]) != a.Level || copdu.ByteOrder(h.Format).Uint32(trailer[4:8]) != a.ContextID {
+				return nil, ErrAuthMismatch
+			}
+			msg, signature := a.signed(b, layout), b[layout.Value:layout.End]
+			if a.Level.Sealed() {
+				err = a.Context.Unseal(msg, b[layout.Stub:layout.Trailer], signature)
+			} else {
+				err = a.Context.Verify(msg, signature)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := p.Unmarshal(b); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// signed returns the region of the marshaled PDU b that is covered by its
+// signature.
+func (a *authContext) signed(b []byte, layout copdu.AuthLayout) []byte {
+	if a.headerSign {
+		return b[:layout.Value]
+	}
+	return b[layout.Stub:layout.Value]
+}
+
+// carriesStub returns true if PDUs of the given type carry stub data.
+func carriesStub(packetType uint8) bool {
+	switch packetType {
+	case pdu.TypeRequest, pdu.TypeResponse, pdu.TypeFault:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,321 @@
+package coproto
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/gentlemanautomaton/dcerpc/pdu"
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu"
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationcontext"
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationsyntax"
+	"github.com/gentlemanautomaton/dcerpc/security"
+	"github.com/gentlemanautomaton/dcerpc/uuid"
+)
+
+var (
+	testAbstract = presentationsyntax.New(uuid.MustParse("12345678-1234-abcd-ef00-0123456789ab"), 1, 0)
+	testTransfer = presentationsyntax.New(uuid.MustParse("8a885d04-1ceb-11c9-9fe8-08002b104860"), 2, 0)
+)
+
+// testProvider is a security provider that signs with HMAC-SHA256 using a
+// fixed key and establishes its contexts in a single leg.
+type testProvider struct{}
+
+func (testProvider) Type() security.Type { return 0xfe }
+
+func (testProvider) NewClientContext(target string, level security.Level) (security.ClientContext, error) {
+	return testContext{}, nil
+}
+
+func (testProvider) NewServerContext(level security.Level) (security.ServerContext, error) {
+	return testContext{}, nil
+}
+
+type testContext struct{}
+
+func (testContext) InitContext(input []byte) ([]byte, bool, error) {
+	return []byte("hello"), true, nil
+}
+
+func (testContext) AcceptContext(input []byte) ([]byte, bool, error) {
+	return nil, true, nil
+}
+
+func (testContext) SignatureSize() int { return 16 }
+
+func (testContext) Sign(msg []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, []byte("key"))
+	mac.Write(msg)
+	return mac.Sum(nil)[:16], nil
+}
+
+func (c testContext) Verify(msg, signature []byte) error {
+	expected, _ := c.Sign(msg)
+	if !hmac.Equal(expected, signature) {
+		return security.ErrInvalidSignature
+	}
+	return nil
+}
+
+func (c testContext) Seal(msg, data []byte) ([]byte, error) {
+	signature, err := c.Sign(msg)
+	for i := range data {
+		data[i] ^= 0xa5
+	}
+	return signature, err
+}
+
+func (c testContext) Unseal(msg, data, signature []byte) error {
+	for i := range data {
+		data[i] ^= 0xa5
+	}
+	return c.Verify(msg, signature)
+}
+
+// testHandler accepts every presentation context and echoes the request stub
+// data of each call.
+type testHandler struct {
+	mutex sync.Mutex
+	calls []Call
+}
+
+func (h *testHandler) Negotiate(element *presentationcontext.Element) presentationcontext.ResultElement {
+	return presentationcontext.ResultElement{
+		Result:         presentationcontext.Acceptance,
+		TransferSyntax: element.TransferSyntaxes[0],
+	}
+}
+
+func (h *testHandler) ServeCall(ctx context.Context, call *Call) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.calls = append(h.calls, *call)
+	call.Response = call.Request
+	return nil
+}
+
+func (h *testHandler) SecurityProvider(t security.Type) security.Provider {
+	return testProvider{}
+}
+
+// tamperConn modifies the PDUs written by a client before the server
+// receives them.
+type tamperConn struct {
+	net.Conn
+	tamper func(b []byte)
+}
+
+func (c *tamperConn) Write(b []byte) (int, error) {
+	b = append([]byte(nil), b...)
+	c.tamper(b)
+	return c.Conn.Write(b)
+}
+
+func TestHeaderSigning(t *testing.T) {
+	const opnumOffset = copdu.HeaderLength + 6
+
+	tests := []struct {
+		name       string
+		level      security.Level
+		headerSign bool // Whether the client offers header signing
+		tamper     int  // The offset of the octet to modify in requests
+		detected   bool // Whether the signature of the request is invalid
+		downgraded bool // Whether the verification trailer rejects the call
+	}{
+		{"header-integrity", security.LevelIntegrity, true, opnumOffset, true, false},
+		{"header-privacy", security.LevelPrivacy, true, opnumOffset, true, false},
+		{"header-unsigned", security.LevelIntegrity, false, opnumOffset, false, true},
+		{"header-unsigned-connect", security.LevelConnect, false, opnumOffset, false, false},
+		{"stub-integrity", security.LevelIntegrity, true, copdu.HeaderLength + 8, true, false},
+		{"stub-unsigned", security.LevelIntegrity, false, copdu.HeaderLength + 8, true, false},
+		{"none", security.LevelIntegrity, true, -1, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cconn, sconn := net.Pipe()
+			conn := &tamperConn{Conn: cconn, tamper: func(b []byte) {
+				var h copdu.Header
+				if err := h.Unmarshal(b); err != nil {
+					return
+				}
+				switch h.PacketType {
+				case pdu.TypeBind:
+					if !tt.headerSign {
+						b[3] &^= copdu.SupportHeaderSign
+					}
+				case pdu.TypeRequest:
+					if tt.tamper >= 0 {
+						b[tt.tamper] ^= 0x01
+					}
+				}
+			}}
+
+			var handler testHandler
+			server := NewServer(sconn, &handler)
+			served := make(chan error, 1)
+			go func() { served <- server.Serve(context.Background()) }()
+
+			client := NewClient(conn)
+			defer client.Close()
+			if err := client.Authenticate(testProvider{}, "server", tt.level); err != nil {
+				t.Fatal(err)
+			}
+			id, _, err := client.Negotiate(context.Background(), testAbstract, []presentationsyntax.ID{testTransfer})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if client.HeaderSigning() != tt.headerSign || server.HeaderSigning() != tt.headerSign {
+				t.Fatalf("header signing negotiated as %t by the client and %t by the server, want %t", client.HeaderSigning(), server.HeaderSigning(), tt.headerSign)
+			}
+
+			stub := []byte("0123456789abcdef")
+			call := Call{ContextID: id, OpNum: 2, Request: append([]byte(nil), stub...)}
+			err = client.Invoke(context.Background(), &call)
+			if tt.detected {
+				if err == nil {
+					t.Fatal("tampered request was accepted")
+				}
+				if err := <-served; err != security.ErrInvalidSignature {
+					t.Fatalf("server returned %v, want %v", err, security.ErrInvalidSignature)
+				}
+				if len(handler.calls) != 0 {
+					t.Fatal("tampered request was dispatched")
+				}
+				return
+			}
+			if tt.downgraded {
+				// The verification trailer reveals that the offer of header
+				// signing was removed from the bind.
+				if fault, ok := err.(*Fault); !ok || fault.Status != pdu.StatusAccessDenied {
+					t.Fatalf("invoke returned %v, want an access denied fault", err)
+				}
+				if len(handler.calls) != 0 {
+					t.Fatal("downgraded request was dispatched")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(call.Response, stub) {
+				t.Fatalf("response %q, want %q", call.Response, stub)
+			}
+			// An undetected modification of the header reaches the handler.
+			opnum := uint16(2)
+			if tt.tamper == opnumOffset {
+				opnum ^= 0x01
+			}
+			if handler.calls[0].OpNum != opnum {
+				t.Fatalf("opnum %d, want %d", handler.calls[0].OpNum, opnum)
+			}
+		})
+	}
+}
+
+func TestSecurityContextMultiplexing(t *testing.T) {
+	cconn, sconn := net.Pipe()
+	handler := &testHandler{}
+	server := NewServer(sconn, handler)
+	go server.Serve(context.Background())
+
+	client := NewClient(cconn)
+	defer client.Close()
+	if err := client.Authenticate(testProvider{}, "server", security.LevelIntegrity); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	id, _, err := client.Negotiate(ctx, testAbstract, []presentationsyntax.ID{testTransfer})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The context established by Authenticate is reused.
+	if authID, err := client.SecurityContext(ctx, testProvider{}, "server", security.LevelIntegrity); err != nil || authID != 0 {
+		t.Fatalf("SecurityContext returned %d, %v for the bind context", authID, err)
+	}
+	privacy, err := client.SecurityContext(ctx, testProvider{}, "server", security.LevelPrivacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if privacy == 0 {
+		t.Fatal("additional security context was given the ID of the bind context")
+	}
+	if again, err := client.SecurityContext(ctx, testProvider{}, "server", security.LevelPrivacy); err != nil || again != privacy {
+		t.Fatalf("SecurityContext returned %d, %v, want %d", again, err, privacy)
+	}
+
+	// Each call is protected by the context it selects.
+	tests := []struct {
+		authID uint32
+		level  security.Level
+	}{
+		{0, security.LevelIntegrity},
+		{privacy, security.LevelPrivacy},
+		{0, security.LevelIntegrity},
+	}
+	for i, tt := range tests {
+		// The verification trailer is aligned to 4 octets, so shorter stub
+		// data would be received with the alignment padding.
+		call := Call{ContextID: id, AuthContextID: tt.authID, Request: bytes.Repeat([]byte{byte(i)}, 4)}
+		if err := client.Invoke(ctx, &call); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(call.Response, call.Request) {
+			t.Fatalf("call %d: unexpected response % x", i, call.Response)
+		}
+		if call.Auth == nil || call.Auth.ContextID != tt.authID || call.Auth.Level != tt.level {
+			t.Fatalf("call %d: client protected the call with %+v", i, call.Auth)
+		}
+		handler.mutex.Lock()
+		received := handler.calls[len(handler.calls)-1].Auth
+		handler.mutex.Unlock()
+		if received == nil || received.ContextID != tt.authID || received.Level != tt.level {
+			t.Fatalf("call %d: server received the call with %+v", i, received)
+		}
+	}
+
+	call := Call{ContextID: id, AuthContextID: 99}
+	if err := client.Invoke(ctx, &call); err != ErrUnknownSecurityContext {
+		t.Fatalf("Invoke returned %v, want %v", err, ErrUnknownSecurityContext)
+	}
+}
+
+func TestSecurityContextMultiplexingNotNegotiated(t *testing.T) {
+	cconn, sconn := net.Pipe()
+	server := NewServer(sconn, &testHandler{})
+	go server.Serve(context.Background())
+
+	// The client's proposal is altered so that it only proposes to keep the
+	// connection on orphaned PDUs.
+	client := NewClient(&tamperConn{Conn: cconn, tamper: func(b []byte) {
+		if i := bytes.Index(b, featurePrefix); i >= 0 && b[2] == 11 {
+			b[i+8] = byte(presentationcontext.KeepConnectionOnOrphan)
+		}
+	}})
+	defer client.Close()
+	if err := client.Authenticate(testProvider{}, "server", security.LevelIntegrity); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	id, _, err := client.Negotiate(ctx, testAbstract, []presentationsyntax.ID{testTransfer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := client.Features(); f != presentationcontext.KeepConnectionOnOrphan {
+		t.Fatalf("client agreed to features %#x", f)
+	}
+	if _, err := client.SecurityContext(ctx, testProvider{}, "server", security.LevelPrivacy); err != ErrMultiplexingNotNegotiated {
+		t.Fatalf("SecurityContext returned %v, want %v", err, ErrMultiplexingNotNegotiated)
+	}
+
+	// The association remains usable with the bind context.
+	call := Call{ContextID: id, Request: []byte{1}}
+	if err := client.Invoke(ctx, &call); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,12 +1,635 @@
 package coproto
 
-import "sync"
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/gentlemanautomaton/dcerpc/formatlabel"
+	"github.com/gentlemanautomaton/dcerpc/pdu"
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu"
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationcontext"
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationsyntax"
+	"github.com/gentlemanautomaton/dcerpc/security"
+)
+
+// ErrServerClosed is returned by Server.Serve after the server has been
+// closed.
+var ErrServerClosed = errors.New("coproto: server closed")
+
+// Handler services the calls received by the server side of an association.
+type Handler interface {
+	// Negotiate returns the result of negotiating the given presentation
+	// context element, which was proposed by the client in a bind or
+	// alter_context PDU.
+	Negotiate(element *presentationcontext.Element) presentationcontext.ResultElement
+
+	// ServeCall executes the given call and stores its response stub data in
+	// call.Response. If ServeCall returns a *Fault it will be transmitted to
+	// the client. Any other error will be reported as an unspecified fault.
+	ServeCall(ctx context.Context, call *Call) error
+}
+
+// SecurityHandler is implemented by handlers that accept authenticated
+// associations.
+type SecurityHandler interface {
+	// SecurityProvider returns the security provider for the given
+	// authentication type, or nil if the type is not supported.
+	SecurityProvider(t security.Type) security.Provider
+}
+
+// presentationContext is a presentation context that has been accepted on an
+// association.
+type presentationContext struct {
+	id             presentationcontext.ID
+	abstractSyntax presentationsyntax.ID
+	transferSyntax presentationsyntax.ID
+}
 
 // Server is a connection-oriented protocol server. It represents the server
 // side of an RPC association.
 //
 // Each server is capabale of handling one RPC call at a time.
 type Server struct {
-	mutex sync.Mutex
-	group *ServerGroup
+	mutex   sync.Mutex
+	pool    *ServerPool
+	group   *ServerGroup
+	conn    io.ReadWriteCloser
+	handler Handler
+	format  formatlabel.Format
+	closed  bool
+
+	// Negotiated association state
+	bound      bool
+	maxXmit    uint16
+	maxRecv    uint16
+	contexts   map[presentationcontext.ID]presentationContext
+	features   presentationcontext.Features
+	headerSign bool
+	auth       *authContext            // The context established at bind time
+	auths      map[uint32]*authContext // All contexts, by context ID
+
+	// The call that is currently being received
+	call *Call
+
+	// The call whose request fragments are discarded because its request
+	// is too large
+	rejected *Call
+
+	maxRequest int // The largest request stub data that will be accepted
+}
+
+// NewServer returns a server for the association carried by conn. Calls
+// received on the association will be serviced by handler.
+//
+// The server's association group is not shared with other servers. Servers
+// whose associations may be grouped are created by ServerPool.NewServer.
+func NewServer(conn io.ReadWriteCloser, handler Handler) *Server {
+	return &Server{
+		pool:     new(ServerPool),
+		conn:     conn,
+		handler:  handler,
+		format:   formatlabel.LEAIEEE,
+		maxXmit:  MinSupportedFragmentSize,
+		maxRecv:  MinSupportedFragmentSize,
+		contexts: make(map[presentationcontext.ID]presentationContext),
+		auths:    make(map[uint32]*authContext),
+
+		maxRequest: DefaultMaxRequestSize,
+	}
+}
+
+// SetMaxRequestSize sets the largest request stub data that the server
+// accepts for a call. Calls with larger requests are rejected with a
+// remote_no_memory fault. If n is not positive, DefaultMaxRequestSize is
+// used. It must be called before Serve.
+func (s *Server) SetMaxRequestSize(n int) {
+	if n <= 0 {
+		n = DefaultMaxRequestSize
+	}
+	s.maxRequest = n
+}
+
+// Serve receives and processes PDUs until the connection is closed or an
+// unrecoverable protocol error occurs. If ctx is cancelled the connection will
+// be closed.
+func (s *Server) Serve(ctx context.Context) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.Close()
+		case <-done:
+		}
+	}()
+
+	for {
+		p, auth, err := s.read()
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			s.Close()
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if err := s.handle(ctx, p, auth); err != nil {
+			s.Close()
+			return err
+		}
+	}
+}
+
+// Close closes the underlying connection of the association and removes the
+// server from its association group.
+func (s *Server) Close() error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.closed = true
+	err := s.conn.Close()
+	group := s.group
+	s.mutex.Unlock()
+	if group != nil {
+		group.remove(s)
+	}
+	return err
+}
+
+// Features returns the features that were agreed upon by bind time feature
+// negotiation when the association was established.
+func (s *Server) Features() presentationcontext.Features {
+	return s.features
+}
+
+// HeaderSigning reports whether the client and server agreed to sign the
+// header and sec_trailer of protected PDUs when the association was
+// established.
+func (s *Server) HeaderSigning() bool {
+	return s.headerSign
+}
+
+// Group returns the association group that the server is a member of. It
+// returns nil until the server has received a bind.
+func (s *Server) Group() *ServerGroup {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.group
+}
+
+// join adds the server to the association group with the given ID, or to a
+// new group if id is zero. It returns false if there is no such group.
+func (s *Server) join(id uint32) bool {
+	group := s.pool.join(id, s)
+	if group == nil {
+		return false
+	}
+	s.mutex.Lock()
+	s.group = group
+	closed := s.closed
+	s.mutex.Unlock()
+	if closed {
+		// The server was closed while it was joining the group.
+		group.remove(s)
+	}
+	return true
+}
+
+func (s *Server) isClosed() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.closed
+}
+
+// handle processes the PDU p, which was verified with the security context
+// auth.
+func (s *Server) handle(ctx context.Context, p *copdu.PDU, auth *authContext) error {
+	switch body := p.Body.(type) {
+	case *copdu.Bind:
+		return s.handleBind(&p.Header, body, p.Auth)
+	case *copdu.AlterContext:
+		return s.handleAlterContext(&p.Header, body, p.Auth)
+	case *copdu.Auth3:
+		return s.handleAuth3(p.Auth)
+	case *copdu.Request:
+		return s.handleRequest(ctx, &p.Header, body, auth)
+	case *copdu.Orphaned:
+		// The client has abandoned the call that is being received.
+		if s.call != nil && s.call.ID == p.Header.CallID {
+			s.call = nil
+		}
+		return nil
+	case *copdu.Cancel:
+		// Calls are executed synchronously, so there is nothing to cancel.
+		return nil
+	}
+	return errors.New("coproto: server received an unexpected packet type")
+}
+
+func (s *Server) handleBind(h *copdu.Header, bind *copdu.Bind, verifier *copdu.AuthVerifier) error {
+	if s.bound {
+		return errors.New("coproto: server received more than one bind")
+	}
+	if h.VersionMinor > 1 {
+		return s.send(nil, h.CallID, copdu.FirstFrag|copdu.LastFrag, &copdu.BindNak{
+			RejectReason: presentationcontext.ReasonNotSpecified,
+			Versions:     []copdu.Version{{Major: 5, Minor: 0}, {Major: 5, Minor: 1}},
+		})
+	}
+
+	// Header signing is supported whenever the client offers it.
+	s.headerSign = h.Flags&copdu.SupportHeaderSign != 0
+
+	var token []byte
+	if verifier != nil {
+		auth, reason, err := s.beginAuth(verifier)
+		if err == nil {
+			token, err = s.continueAuth(auth, verifier)
+			reason = copdu.RejectInvalidChecksum
+		}
+		if err != nil {
+			delete(s.auths, verifier.ContextID)
+			return s.send(nil, h.CallID, copdu.FirstFrag|copdu.LastFrag, &copdu.BindNak{
+				RejectReason: reason,
+			})
+		}
+		s.auth = auth
+	}
+
+	// Join the association group requested by the client, or allocate a
+	// new one.
+	if !s.join(bind.AssocGroupID) {
+		return s.send(nil, h.CallID, copdu.FirstFrag|copdu.LastFrag, &copdu.BindNak{
+			RejectReason: copdu.RejectReasonNotSpecified,
+		})
+	}
+
+	s.maxXmit = negotiateFragmentSize(bind.MaxReceiveFrag)
+	s.maxRecv = negotiateFragmentSize(bind.MaxTransmitFrag)
+	s.bound = true
+
+	flags := uint8(copdu.FirstFrag | copdu.LastFrag)
+	if s.headerSign {
+		flags |= copdu.SupportHeaderSign
+	}
+
+	return s.write(nil, &copdu.PDU{
+		Header: s.header(h.CallID, flags),
+		Body: &copdu.BindAck{
+			MaxTransmitFrag: s.maxXmit,
+			MaxReceiveFrag:  s.maxRecv,
+			AssocGroupID:    s.group.id,
+			Results:         s.negotiate(&bind.Elements, true),
+		},
+		Auth: s.authVerifier(verifier, token),
+	})
+}
+
+func (s *Server) handleAlterContext(h *copdu.Header, alter *copdu.AlterContext, verifier *copdu.AuthVerifier) error {
+	if !s.bound {
+		return errors.New("coproto: server received alter_context before bind")
+	}
+	var token []byte
+	if verifier != nil {
+		auth, ok := s.auths[verifier.ContextID]
+		switch {
+		case ok && auth.established:
+			return errors.New("coproto: server received an auth verifier for an established security context")
+		case !ok && len(s.auths) > 0 && s.features&presentationcontext.SecurityContextMultiplexing == 0:
+			return ErrMultiplexingNotNegotiated
+		case !ok:
+			// The client is establishing an additional security context.
+			var err error
+			if auth, _, err = s.beginAuth(verifier); err != nil {
+				return err
+			}
+		}
+		var err error
+		if token, err = s.continueAuth(auth, verifier); err != nil {
+			return err
+		}
+	}
+	return s.write(nil, &copdu.PDU{
+		Header: s.header(h.CallID, copdu.FirstFrag|copdu.LastFrag),
+		Body: &copdu.AlterContextResp{
+			MaxTransmitFrag: s.maxXmit,
+			MaxReceiveFrag:  s.maxRecv,
+			AssocGroupID:    s.group.id,
+			Results:         s.negotiate(&alter.Elements, false),
+		},
+		Auth: s.authVerifier(verifier, token),
+	})
+}
+
+func (s *Server) handleAuth3(verifier *copdu.AuthVerifier) error {
+	if verifier == nil {
+		return errors.New("coproto: server received an unexpected rpc_auth_3")
+	}
+	auth, ok := s.auths[verifier.ContextID]
+	if !ok || auth.established {
+		return errors.New("coproto: server received an unexpected rpc_auth_3")
+	}
+	if _, err := s.continueAuth(auth, verifier); err != nil {
+		return err
+	}
+	if !auth.established {
+		return errors.New("coproto: security context was not established by rpc_auth_3")
+	}
+	return nil
+}
+
+// beginAuth creates the server side of the security context requested by
+// the client and adds it to the association. If the context cannot be
+// created it returns the reason that the bind should be rejected.
+func (s *Server) beginAuth(verifier *copdu.AuthVerifier) (*authContext, presentationcontext.Reason, error) {
+	sh, ok := s.handler.(SecurityHandler)
+	if !ok {
+		return nil, copdu.RejectAuthenticationTypeNotRecognized, errors.New("coproto: server does not support authentication")
+	}
+	provider := sh.SecurityProvider(security.Type(verifier.Type))
+	if provider == nil {
+		return nil, copdu.RejectAuthenticationTypeNotRecognized, errors.New("coproto: unsupported authentication type")
+	}
+	auth, err := newServerAuth(provider, verifier)
+	if err != nil {
+		return nil, copdu.RejectReasonNotSpecified, err
+	}
+	auth.headerSign = s.headerSign
+	s.auths[auth.ContextID] = auth
+	return auth, 0, nil
+}
+
+// continueAuth passes the token carried by verifier to the server side of the
+// security context and returns the token to be sent to the client.
+func (s *Server) continueAuth(auth *authContext, verifier *copdu.AuthVerifier) (token []byte, err error) {
+	if security.Type(verifier.Type) != auth.Type || verifier.ContextID != auth.ContextID {
+		return nil, ErrAuthMismatch
+	}
+	token, done, err := auth.server.AcceptContext(verifier.Value)
+	if err != nil {
+		return nil, err
+	}
+	if done {
+		auth.done = true
+		auth.established = true
+	}
+	return token, nil
+}
+
+// authVerifier returns the auth verifier to send in response to a PDU that
+// carried the given verifier.
+func (s *Server) authVerifier(received *copdu.AuthVerifier, token []byte) *copdu.AuthVerifier {
+	if received == nil {
+		return nil
+	}
+	auth, ok := s.auths[received.ContextID]
+	if !ok {
+		return nil
+	}
+	return auth.verifier(token)
+}
+
+// negotiate asks the handler to evaluate each of the proposed presentation
+// context elements and records the contexts that are accepted. Bind time
+// feature negotiation elements are acknowledged if bind is true.
+func (s *Server) negotiate(list *presentationcontext.List, bind bool) (results presentationcontext.ResultList) {
+	results.Results = make([]presentationcontext.ResultElement, len(list.Elements))
+	for i := range list.Elements {
+		elem := &list.Elements[i]
+		if features, ok := elem.Features(); ok && bind {
+			s.features = features & SupportedFeatures
+			results.Results[i] = presentationcontext.FeatureAck(s.features)
+			continue
+		}
+		result := s.handler.Negotiate(elem)
+		if result.Result == presentationcontext.Acceptance {
+			s.contexts[elem.ID] = presentationContext{
+				id:             elem.ID,
+				abstractSyntax: elem.AbstractSyntax,
+				transferSyntax: result.TransferSyntax,
+			}
+		}
+		results.Results[i] = result
+	}
+	results.NumResults = uint8(len(results.Results))
+	return
+}
+
+func (s *Server) handleRequest(ctx context.Context, h *copdu.Header, req *copdu.Request, auth *authContext) error {
+	if !s.bound {
+		return errors.New("coproto: server received request before bind")
+	}
+
+	if s.rejected != nil && s.rejected.ID == h.CallID {
+		return s.reject(h)
+	}
+
+	if h.Flags&copdu.FirstFrag != 0 {
+		pc, ok := s.contexts[req.PresContextID]
+		if !ok {
+			s.call = nil
+			return s.sendFault(auth, h.CallID, req.PresContextID, &Fault{
+				Status:        pdu.StatusUnknownInterface,
+				DidNotExecute: true,
+			})
+		}
+		s.call = &Call{
+			ID:             h.CallID,
+			ContextID:      req.PresContextID,
+			AbstractSyntax: pc.abstractSyntax,
+			TransferSyntax: pc.transferSyntax,
+			OpNum:          req.OpNum,
+			Object:         req.Object,
+			RequestFormat:  h.Format,
+			Request:        make([]byte, 0, allocHint(req.AllocHint, s.maxRecv)),
+			Group:          s.group,
+			auth:           auth,
+		}
+		if auth != nil && auth.established {
+			a := auth.Auth
+			s.call.Auth = &a
+		}
+	}
+
+	call := s.call
+	if call == nil || call.ID != h.CallID {
+		return errors.New("coproto: server received a request fragment out of sequence")
+	}
+	if h.Format != call.RequestFormat {
+		// The stub data of a call is reassembled before it is decoded, so
+		// all of its fragments must share a data representation.
+		return errors.New("coproto: server received request fragments with differing format labels")
+	}
+	if auth != call.auth {
+		return ErrAuthMismatch
+	}
+	if len(call.Request)+len(req.Stub) > s.maxRequest {
+		// Reject the call without reassembling the rest of it.
+		s.call, s.rejected = nil, call
+		call.Request = nil
+		return s.reject(h)
+	}
+	call.Request = append(call.Request, req.Stub...)
+
+	if h.Flags&copdu.LastFrag == 0 {
+		return nil
+	}
+	s.call = nil
+
+	call.ResponseFormat = s.format
+	if call.auth.verifies() {
+		if fault := s.verify(call); fault != nil {
+			return s.sendFault(call.auth, call.ID, call.ContextID, fault)
+		}
+	}
+	if err := s.handler.ServeCall(ctx, call); err != nil {
+		fault, ok := err.(*Fault)
+		if !ok {
+			fault = &Fault{Status: pdu.StatusUnspecified}
+		}
+		return s.sendFault(call.auth, call.ID, call.ContextID, fault)
+	}
+	return s.sendResponse(call)
+}
+
+// reject discards a request fragment of a call whose request is too large.
+// The fault is sent when the last fragment has been received, as the client
+// does not expect a response before then.
+func (s *Server) reject(h *copdu.Header) error {
+	if h.Flags&copdu.LastFrag == 0 {
+		return nil
+	}
+	call := s.rejected
+	s.rejected = nil
+	return s.sendFault(call.auth, call.ID, call.ContextID, &Fault{
+		Status:        pdu.StatusRemoteNoMemory,
+		DidNotExecute: true,
+	})
+}
+
+// sendResponse transmits the response stub data of the call, fragmenting it
+// as necessary.
+func (s *Server) sendResponse(call *Call) error {
+	const overhead = copdu.HeaderLength + 8
+	stub, total := call.Response, len(call.Response)
+	max := int(s.maxXmit) - overhead
+	if size := call.auth.signatureSize(); size > 0 {
+		// Keep the stub data of each fragment aligned so that only the last
+		// fragment requires auth padding.
+		max = (max - size) &^ 15
+	}
+	flags := uint8(copdu.FirstFrag)
+	for {
+		n := len(stub)
+		if n > max {
+			n = max
+		} else {
+			flags |= copdu.LastFrag
+		}
+		err := s.send(call.auth, call.ID, flags, &copdu.Response{
+			AllocHint:     uint32(total),
+			PresContextID: call.ContextID,
+			Stub:          stub[:n],
+		})
+		if err != nil || flags&copdu.LastFrag != 0 {
+			return err
+		}
+		stub = stub[n:]
+		flags = 0
+	}
+}
+
+func (s *Server) sendFault(auth *authContext, callID uint32, contextID presentationcontext.ID, fault *Fault) error {
+	flags := uint8(copdu.FirstFrag | copdu.LastFrag)
+	if fault.DidNotExecute {
+		flags |= copdu.DidNotExecute
+	}
+	return s.send(auth, callID, flags, &copdu.Fault{
+		AllocHint:     uint32(len(fault.Stub)),
+		PresContextID: contextID,
+		Status:        fault.Status,
+		Stub:          fault.Stub,
+	})
+}
+
+func (s *Server) send(auth *authContext, callID uint32, flags uint8, body copdu.Body) error {
+	return s.write(auth, &copdu.PDU{
+		Header: s.header(callID, flags),
+		Body:   body,
+	})
+}
+
+func (s *Server) header(callID uint32, flags uint8) copdu.Header {
+	return copdu.Header{
+		Flags:  flags,
+		Format: s.format,
+		CallID: callID,
+	}
+}
+
+// write marshals p, protecting it with the security context auth if
+// necessary, and writes it to the connection.
+func (s *Server) write(auth *authContext, p *copdu.PDU) error {
+	b, err := auth.marshal(p)
+	if err != nil {
+		return err
+	}
+	_, err = s.conn.Write(b)
+	return err
+}
+
+// read reads the next PDU from the connection, verifying it with the
+// security context selected by its sec_trailer if necessary. PDUs without
+// an auth verifier belong to the context established at bind time. The
+// context is returned along with the PDU.
+func (s *Server) read() (*copdu.PDU, *authContext, error) {
+	b, err := copdu.ReadFragment(s.conn)
+	if err != nil {
+		return nil, nil, err
+	}
+	auth := s.auth
+	var h copdu.Header
+	if err := h.Unmarshal(b); err != nil {
+		return nil, nil, err
+	}
+	if carriesStub(h.PacketType) && h.AuthLength > 0 {
+		layout, err := copdu.Layout(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		id := copdu.ByteOrder(h.Format).Uint32(b[layout.Trailer+4:])
+		if auth = s.auths[id]; auth == nil || !auth.established {
+			return nil, nil, ErrAuthMismatch
+		}
+	}
+	p, err := auth.unmarshal(b)
+	return p, auth, err
+}
+
+// allocHint returns the capacity to allocate for stub data whose size is
+// declared by the given alloc_hint, which is limited to AllocHintFragments
+// fragments of size maxFrag.
+func allocHint(hint uint32, maxFrag uint16) int {
+	if limit := uint32(maxFrag) * AllocHintFragments; hint > limit {
+		return int(limit)
+	}
+	return int(hint)
+}
+
+// negotiateFragmentSize returns the fragment size to use given the size that
+// was proposed by the other party.
+func negotiateFragmentSize(proposed uint16) uint16 {
+	switch {
+	case proposed < MinSupportedFragmentSize:
+		return MinSupportedFragmentSize
+	case proposed > MaxFragmentSize:
+		return MaxFragmentSize
+	}
+	return proposed
 }
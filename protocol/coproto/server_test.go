@@ -0,0 +1,83 @@
+package coproto
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+
+	"github.com/gentlemanautomaton/dcerpc/pdu"
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationsyntax"
+)
+
+func TestMaxRequestSize(t *testing.T) {
+	cconn, sconn := net.Pipe()
+	handler := &testHandler{}
+	server := NewServer(sconn, handler)
+	server.SetMaxRequestSize(4000)
+	go server.Serve(context.Background())
+
+	client := NewClient(cconn)
+	defer client.Close()
+	id, _, err := client.Negotiate(context.Background(), testAbstract, []presentationsyntax.ID{testTransfer})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The oversized request spans several fragments, which are discarded.
+	call := Call{ContextID: id, Request: make([]byte, 10000)}
+	err = client.Invoke(context.Background(), &call)
+	if f, ok := err.(*Fault); !ok || f.Status != pdu.StatusRemoteNoMemory || !f.DidNotExecute {
+		t.Fatalf("oversized request returned %v", err)
+	}
+	if len(handler.calls) != 0 {
+		t.Fatal("oversized request was served")
+	}
+
+	// The association remains usable.
+	call = Call{ContextID: id, Request: bytes.Repeat([]byte{7}, 4000)}
+	if err := client.Invoke(context.Background(), &call); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(call.Response, call.Request) {
+		t.Fatal("request of the maximum size was not echoed")
+	}
+}
+
+func TestAllocHint(t *testing.T) {
+	if n := allocHint(100, MinSupportedFragmentSize); n != 100 {
+		t.Errorf("small alloc_hint was limited to %d", n)
+	}
+	if n := allocHint(0xffffffff, MinSupportedFragmentSize); n != MinSupportedFragmentSize*AllocHintFragments {
+		t.Errorf("large alloc_hint was limited to %d", n)
+	}
+}
+
+func TestResponseAllocHint(t *testing.T) {
+	cconn, sconn := net.Pipe()
+	// The server declares an alloc_hint of 4 GB for each response.
+	conn := &tamperConn{Conn: sconn, tamper: func(b []byte) {
+		if len(b) >= 20 && b[2] == 2 {
+			copy(b[16:20], []byte{0xff, 0xff, 0xff, 0xff})
+		}
+	}}
+	server := NewServer(conn, &testHandler{})
+	go server.Serve(context.Background())
+
+	client := NewClient(cconn)
+	defer client.Close()
+	id, _, err := client.Negotiate(context.Background(), testAbstract, []presentationsyntax.ID{testTransfer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := Call{ContextID: id, Request: []byte{1, 2, 3, 4}}
+	if err := client.Invoke(context.Background(), &call); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(call.Response, call.Request) {
+		t.Fatalf("unexpected response % x", call.Response)
+	}
+	if c := cap(call.Response); c > MaxFragmentSize*AllocHintFragments {
+		t.Fatalf("client allocated %d octets for the response", c)
+	}
+}
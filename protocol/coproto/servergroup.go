@@ -1,12 +1,185 @@
 package coproto
 
-import "sync"
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationsyntax"
+	"github.com/gentlemanautomaton/dcerpc/uuid"
+)
+
+// ErrGroupClosed is returned when a context is added to a server group whose
+// associations have all been closed.
+var ErrGroupClosed = errors.New("coproto: association group closed")
+
+// ServerContext is the server side state of a context handle. It belongs to
+// the association group of the call that created it, and may be used by any
+// association in the group.
+type ServerContext struct {
+	// AbstractSyntax identifies the interface of the call that created the
+	// context.
+	AbstractSyntax presentationsyntax.ID
+
+	// Type describes the context handle type that the context was created
+	// as. It is defined by the layer above.
+	Type interface{}
+
+	// Value is the state held by the server for the context.
+	Value interface{}
+
+	// Rundown, if it is not nil, is called with Value when the association
+	// group is closed while the context is still active.
+	Rundown func(value interface{})
+}
 
 // ServerGroup manages the server side of an association group.
+//
+// The group holds the contexts created by calls received on its associations.
+// When the last association in the group is closed, the group waits for the
+// grace period of its pool for another association to join it. If none does,
+// the contexts that remain are run down and the group is closed.
 type ServerGroup struct {
-	id uint
+	id   uint32
+	pool *ServerPool
+
+	mutex    sync.RWMutex
+	servers  []*Server
+	contexts map[uuid.UUID]*ServerContext // The active contexts
+	hooks    []func()                     // Called when the group is closed
+	idle     uint                         // Incremented whenever the last server leaves
+	timer    *time.Timer                  // Expires the group at the end of its grace period
+	closed   bool
+}
+
+// ID returns the association group ID, which is sent to clients so that
+// their new associations may join the group.
+func (group *ServerGroup) ID() uint32 {
+	return group.id
+}
+
+// AddContext adds ctx to the group and returns the UUID that identifies it.
+// It returns ErrGroupClosed if the group has been closed.
+func (group *ServerGroup) AddContext(ctx *ServerContext) (uuid.UUID, error) {
+	group.mutex.Lock()
+	defer group.mutex.Unlock()
+	if group.closed {
+		return uuid.Nil, ErrGroupClosed
+	}
+	id := uuid.New()
+	group.contexts[id] = ctx
+	return id, nil
+}
+
+// Context returns the context identified by id, if it is active within the
+// group.
+func (group *ServerGroup) Context(id uuid.UUID) (ctx *ServerContext, ok bool) {
+	group.mutex.RLock()
+	defer group.mutex.RUnlock()
+	ctx, ok = group.contexts[id]
+	return ctx, ok
+}
+
+// RemoveContext removes the context identified by id from the group without
+// running it down, and returns it. It returns false if the context is not
+// active within the group.
+func (group *ServerGroup) RemoveContext(id uuid.UUID) (ctx *ServerContext, ok bool) {
+	group.mutex.Lock()
+	defer group.mutex.Unlock()
+	ctx, ok = group.contexts[id]
+	delete(group.contexts, id)
+	return ctx, ok
+}
+
+// Active returns the number of active contexts within the group.
+func (group *ServerGroup) Active() int {
+	group.mutex.RLock()
+	defer group.mutex.RUnlock()
+	return len(group.contexts)
+}
+
+// OnClose registers f to be called when the group is closed, after its
+// contexts have been run down. If the group has already been closed, f is
+// called immediately.
+func (group *ServerGroup) OnClose(f func()) {
+	group.mutex.Lock()
+	if !group.closed {
+		group.hooks = append(group.hooks, f)
+		group.mutex.Unlock()
+		return
+	}
+	group.mutex.Unlock()
+	f()
+}
+
+// add will add the server to the group. It returns false if the group has
+// been closed.
+func (group *ServerGroup) add(server *Server) bool {
+	group.mutex.Lock()
+	defer group.mutex.Unlock()
+	if group.closed {
+		return false
+	}
+	if group.timer != nil {
+		// The group was waiting out its grace period.
+		group.timer.Stop()
+		group.timer = nil
+	}
+	group.servers = append(group.servers, server)
+	return true
+}
+
+// remove will remove server from the group. When the last server is removed
+// the group is expired, either immediately or at the end of the grace period
+// of its pool.
+func (group *ServerGroup) remove(server *Server) {
+	group.mutex.Lock()
+	for i := 0; i < len(group.servers); i++ {
+		if group.servers[i] == server {
+			group.servers = append(group.servers[:i], group.servers[i+1:]...)
+		}
+	}
+	if len(group.servers) > 0 || group.closed {
+		group.mutex.Unlock()
+		return
+	}
+	group.idle++
+	idle, grace := group.idle, group.pool.GracePeriod
+	if grace > 0 {
+		group.timer = time.AfterFunc(grace, func() { group.expire(idle) })
+		group.mutex.Unlock()
+		return
+	}
+	group.mutex.Unlock()
+	group.expire(idle)
+}
+
+// expire closes the group if it has had no servers since it became idle for
+// the given time, removes it from its pool and runs down its contexts.
+func (group *ServerGroup) expire(idle uint) {
+	// Holding the pool's lock prevents servers from joining the group while
+	// it is closed.
+	group.pool.mutex.Lock()
+	group.mutex.Lock()
+	if group.closed || group.idle != idle || len(group.servers) > 0 {
+		group.mutex.Unlock()
+		group.pool.mutex.Unlock()
+		return
+	}
+	group.closed = true
+	group.timer = nil
+	contexts, hooks := group.contexts, group.hooks
+	group.contexts, group.hooks = nil, nil
+	group.mutex.Unlock()
+	delete(group.pool.groups, group.id)
+	group.pool.mutex.Unlock()
 
-	mutex   sync.RWMutex
-	servers []*Server
-	active  uint // How many active contexts are there?
+	for _, ctx := range contexts {
+		if ctx.Rundown != nil {
+			ctx.Rundown(ctx.Value)
+		}
+	}
+	for _, hook := range hooks {
+		hook()
+	}
 }
@@ -0,0 +1,177 @@
+package coproto
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationsyntax"
+)
+
+// bindPooled creates a server in pool and binds a client to it, requesting
+// the association group with the given ID.
+func bindPooled(pool *ServerPool, groupID uint32) (*Client, *Server, error) {
+	cconn, sconn := net.Pipe()
+	server := pool.NewServer(sconn, &testHandler{})
+	go server.Serve(context.Background())
+
+	client := NewClient(cconn)
+	if groupID != 0 {
+		client.group = &ClientGroup{id: groupID}
+	}
+	_, _, err := client.Negotiate(context.Background(), testAbstract, []presentationsyntax.ID{testTransfer})
+	if err != nil {
+		client.Close()
+	}
+	return client, server, err
+}
+
+// rundownRecorder records the values of contexts that have been run down.
+type rundownRecorder struct {
+	mutex  sync.Mutex
+	values []interface{}
+}
+
+func (r *rundownRecorder) rundown(value interface{}) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.values = append(r.values, value)
+}
+
+func (r *rundownRecorder) count() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return len(r.values)
+}
+
+func TestServerGroupRundown(t *testing.T) {
+	var pool ServerPool
+	client, server, err := bindPooled(&pool, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	group := server.Group()
+	if group == nil || group.ID() == 0 || client.assocGroupID != group.ID() {
+		t.Fatalf("client was not told the association group ID")
+	}
+
+	var r rundownRecorder
+	closed, err := group.AddContext(&ServerContext{Value: 1, Rundown: r.rundown})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := group.AddContext(&ServerContext{Value: 2, Rundown: r.rundown}); err != nil {
+		t.Fatal(err)
+	}
+	if ctx, ok := group.Context(closed); !ok || ctx.Value != 1 {
+		t.Fatalf("context lookup returned %v, %v", ctx, ok)
+	}
+	if _, ok := group.RemoveContext(closed); !ok {
+		t.Fatal("context could not be removed")
+	}
+	if _, ok := group.Context(closed); ok {
+		t.Fatal("removed context is still active")
+	}
+	if n := group.Active(); n != 1 {
+		t.Fatalf("group has %d active contexts, want 1", n)
+	}
+	hooked := make(chan struct{})
+	group.OnClose(func() { close(hooked) })
+
+	client.Close()
+	server.Close()
+	<-hooked
+	if r.count() != 1 || r.values[0] != 2 {
+		t.Fatalf("contexts run down: %v, want [2]", r.values)
+	}
+	if _, err := group.AddContext(&ServerContext{}); err != ErrGroupClosed {
+		t.Fatalf("adding a context to a closed group returned %v", err)
+	}
+	if _, ok := pool.Group(group.ID()); ok {
+		t.Fatal("closed group is still in the pool")
+	}
+	server.Close()
+	if r.count() != 1 {
+		t.Fatal("contexts were run down more than once")
+	}
+}
+
+func TestServerGroupJoin(t *testing.T) {
+	pool := ServerPool{GracePeriod: 50 * time.Millisecond}
+	client1, server1, err := bindPooled(&pool, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	group := server1.Group()
+	var r rundownRecorder
+	if _, err := group.AddContext(&ServerContext{Value: 1, Rundown: r.rundown}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A second association joins the group and keeps it open.
+	client2, server2, err := bindPooled(&pool, group.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server2.Group() != group || client2.assocGroupID != group.ID() {
+		t.Fatal("second association did not join the group")
+	}
+	client1.Close()
+	server1.Close()
+
+	// The group survives its last association for the grace period, and
+	// another association may rejoin it in the meantime.
+	client2.Close()
+	server2.Close()
+	client3, server3, err := bindPooled(&pool, group.ID())
+	if err != nil {
+		t.Fatalf("rejoining the group during its grace period: %v", err)
+	}
+	if server3.Group() != group {
+		t.Fatal("third association did not rejoin the group")
+	}
+	time.Sleep(2 * pool.GracePeriod)
+	if r.count() != 0 {
+		t.Fatal("contexts were run down while the group had an association")
+	}
+
+	closed := make(chan struct{})
+	group.OnClose(func() { close(closed) })
+	client3.Close()
+	server3.Close()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("group was not closed after its grace period")
+	}
+	if r.count() != 1 {
+		t.Fatalf("%d contexts were run down, want 1", r.count())
+	}
+
+	if _, _, err := bindPooled(&pool, group.ID()); err == nil {
+		t.Fatal("association joined a closed group")
+	}
+}
+
+func TestServerGroupIDs(t *testing.T) {
+	var pool ServerPool
+	ids := make(map[uint32]bool)
+	sequential := 0
+	var last uint32
+	for i := 0; i < 32; i++ {
+		group := pool.join(0, &Server{})
+		id := group.ID()
+		if id == 0 || ids[id] {
+			t.Fatalf("group %d has ID %#x, which is zero or in use", i, id)
+		}
+		if id == last+1 {
+			sequential++
+		}
+		ids[id], last = true, id
+	}
+	if sequential > 1 {
+		t.Fatalf("%d of the group IDs followed the previous ID", sequential)
+	}
+}
@@ -0,0 +1,83 @@
+package coproto
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/gentlemanautomaton/dcerpc/uuid"
+)
+
+// ServerPool manages the association groups of servers that share an
+// endpoint. Clients may join new associations to the groups of existing ones
+// by sending the group ID in their bind PDUs.
+//
+// The zero value is a pool with no groups, which is ready for use.
+type ServerPool struct {
+	// GracePeriod is how long a group waits for a new association to join
+	// it after its last association is closed, before its contexts are run
+	// down. If it is zero, groups are closed as soon as they are empty. It
+	// must not be changed after the pool has been used.
+	GracePeriod time.Duration
+
+	mutex  sync.Mutex
+	groups map[uint32]*ServerGroup
+}
+
+// NewServer returns a server for the association carried by conn, which will
+// be serviced by handler. The server joins or creates a group of the pool
+// when it receives a bind.
+func (pool *ServerPool) NewServer(conn io.ReadWriteCloser, handler Handler) *Server {
+	s := NewServer(conn, handler)
+	s.pool = pool
+	return s
+}
+
+// Group returns the group with the given ID, if it is open.
+func (pool *ServerPool) Group(id uint32) (group *ServerGroup, ok bool) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	group, ok = pool.groups[id]
+	return group, ok
+}
+
+// join adds server to the group with the given ID and returns the group. If
+// id is zero a new group is created for the server. It returns nil if there
+// is no open group with the given ID.
+func (pool *ServerPool) join(id uint32, server *Server) *ServerGroup {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	if id != 0 {
+		if group, ok := pool.groups[id]; ok && group.add(server) {
+			return group
+		}
+		return nil
+	}
+	for id == 0 || pool.groups[id] != nil {
+		id = newGroupID()
+	}
+	group := &ServerGroup{
+		id:       id,
+		pool:     pool,
+		contexts: make(map[uuid.UUID]*ServerContext),
+	}
+	if pool.groups == nil {
+		pool.groups = make(map[uint32]*ServerGroup)
+	}
+	pool.groups[id] = group
+	group.add(server)
+	return group
+}
+
+// newGroupID returns a random association group ID. IDs are random so that a
+// client cannot guess the ID of another client's group and join it to use its
+// contexts. The ID may be zero or in use, which the caller must check.
+func newGroupID() uint32 {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return binary.LittleEndian.Uint32(b[:])
+}
@@ -0,0 +1,60 @@
+package coproto
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationsyntax"
+)
+
+func TestStreamedCall(t *testing.T) {
+	cconn, sconn := net.Pipe()
+	handler := &testHandler{}
+	server := NewServer(sconn, handler)
+	go server.Serve(context.Background())
+
+	client := NewClient(cconn)
+	defer client.Close()
+	id, _, err := client.Negotiate(context.Background(), testAbstract, []presentationsyntax.ID{testTransfer})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The streamed stub data spans many fragments in each direction.
+	want := []byte{1, 2, 3, 4}
+	for i := 0; i < 100000; i++ {
+		want = append(want, byte(i))
+	}
+	var got []byte
+	call := Call{
+		ContextID: id,
+		Request:   want[:4],
+		RequestStream: func(w io.Writer) error {
+			for b := want[4:]; len(b) > 0; b = b[100:] {
+				if _, err := w.Write(b[:100]); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		ResponseStream: func(r io.Reader) (err error) {
+			got, err = io.ReadAll(r)
+			return err
+		},
+	}
+	if err := client.Invoke(context.Background(), &call); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("received %d octets of stub data, want %d", len(got), len(want))
+	}
+	if call.Response != nil {
+		t.Errorf("streamed response was also stored in the call")
+	}
+	if len(handler.calls) != 1 || !bytes.Equal(handler.calls[0].Request, want) {
+		t.Errorf("server did not receive the streamed request")
+	}
+}
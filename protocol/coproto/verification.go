@@ -0,0 +1,86 @@
+package coproto
+
+import (
+	"github.com/gentlemanautomaton/dcerpc/pdu"
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu"
+	"github.com/gentlemanautomaton/dcerpc/security"
+)
+
+// verifies reports whether requests protected by the context carry a
+// verification trailer.
+func (a *authContext) verifies() bool {
+	return a.protects() && a.Level >= security.LevelIntegrity
+}
+
+// verificationTrailer returns the verification trailer for the call, which
+// binds the request to its presentation context and header. The client always
+// supports header signing, and says so.
+func (c *Client) verificationTrailer(call *Call) *copdu.VerificationTrailer {
+	vt := &copdu.VerificationTrailer{
+		Commands: []copdu.VerificationCommand{{
+			Type:    copdu.VerificationBitmask1,
+			Bitmask: copdu.ClientSupportsHeaderSigning,
+		}},
+	}
+	for _, pc := range c.contexts {
+		if pc.id == call.ContextID {
+			vt.Commands = append(vt.Commands, copdu.VerificationCommand{
+				Type:           copdu.VerificationPContext,
+				MustProcess:    true,
+				AbstractSyntax: pc.abstractSyntax,
+				TransferSyntax: pc.transferSyntax,
+			})
+			break
+		}
+	}
+	vt.Commands = append(vt.Commands, copdu.VerificationCommand{
+		Type:        copdu.VerificationHeader2,
+		MustProcess: true,
+		PacketType:  pdu.TypeRequest,
+		Format:      c.format,
+		CallID:      call.ID,
+		ContextID:   call.ContextID,
+		OpNum:       call.OpNum,
+	})
+	return vt
+}
+
+// verify removes the verification trailer from the request stub data of the
+// call and checks that it agrees with the call. It returns a fault if the
+// call should be rejected.
+func (s *Server) verify(call *Call) *Fault {
+	stub, vt, err := copdu.SplitVerificationTrailer(call.Request)
+	if err != nil {
+		return &Fault{Status: pdu.StatusAccessDenied, DidNotExecute: true}
+	}
+	if vt == nil {
+		return nil
+	}
+	call.Request = stub
+
+	for _, cmd := range vt.Commands {
+		ok := true
+		switch cmd.Type {
+		case copdu.VerificationBitmask1:
+			// A client that supports header signing always offers it, so
+			// if it was not negotiated the offer was removed in transit.
+			if cmd.Bitmask&copdu.ClientSupportsHeaderSigning != 0 && !s.headerSign {
+				ok = false
+			}
+		case copdu.VerificationPContext:
+			ok = cmd.AbstractSyntax == call.AbstractSyntax && cmd.TransferSyntax == call.TransferSyntax
+		case copdu.VerificationHeader2:
+			ok = cmd.PacketType == pdu.TypeRequest &&
+				cmd.Format == call.RequestFormat &&
+				cmd.CallID == call.ID &&
+				cmd.ContextID == call.ContextID &&
+				cmd.OpNum == call.OpNum
+		default:
+			ok = !cmd.MustProcess
+		}
+		if !ok {
+			return &Fault{Status: pdu.StatusAccessDenied, DidNotExecute: true}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package coproto
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gentlemanautomaton/dcerpc/formatlabel"
+	"github.com/gentlemanautomaton/dcerpc/pdu"
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu"
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationsyntax"
+	"github.com/gentlemanautomaton/dcerpc/uuid"
+)
+
+func TestVerify(t *testing.T) {
+	other := presentationsyntax.New(uuid.MustParse("12345678-1234-abcd-ef00-0123456789ac"), 1, 0)
+	tests := []struct {
+		name   string
+		mangle func(cmds []copdu.VerificationCommand) []copdu.VerificationCommand
+		ok     bool
+	}{
+		{"valid", nil, true},
+		{"pcontext-interface", func(cmds []copdu.VerificationCommand) []copdu.VerificationCommand {
+			cmds[1].AbstractSyntax = other
+			return cmds
+		}, false},
+		{"pcontext-transfer-syntax", func(cmds []copdu.VerificationCommand) []copdu.VerificationCommand {
+			cmds[1].TransferSyntax = other
+			return cmds
+		}, false},
+		{"header2-ptype", func(cmds []copdu.VerificationCommand) []copdu.VerificationCommand {
+			cmds[2].PacketType = pdu.TypeResponse
+			return cmds
+		}, false},
+		{"header2-format", func(cmds []copdu.VerificationCommand) []copdu.VerificationCommand {
+			cmds[2].Format = formatlabel.BEAIEEE
+			return cmds
+		}, false},
+		{"header2-call-id", func(cmds []copdu.VerificationCommand) []copdu.VerificationCommand {
+			cmds[2].CallID++
+			return cmds
+		}, false},
+		{"header2-context-id", func(cmds []copdu.VerificationCommand) []copdu.VerificationCommand {
+			cmds[2].ContextID++
+			return cmds
+		}, false},
+		{"header2-opnum", func(cmds []copdu.VerificationCommand) []copdu.VerificationCommand {
+			cmds[2].OpNum++
+			return cmds
+		}, false},
+		{"unknown-optional", func(cmds []copdu.VerificationCommand) []copdu.VerificationCommand {
+			return append(cmds, copdu.VerificationCommand{Type: 0x3f, Data: []byte{1, 2, 3, 4}})
+		}, true},
+		{"unknown-must-process", func(cmds []copdu.VerificationCommand) []copdu.VerificationCommand {
+			return append(cmds, copdu.VerificationCommand{Type: 0x3f, MustProcess: true})
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			call, vt := testVerifiedCall()
+			if tt.mangle != nil {
+				vt.Commands = tt.mangle(vt.Commands)
+			}
+			stub := call.Request
+			call.Request = vt.Append(append([]byte(nil), stub...))
+			s := &Server{headerSign: true}
+			fault := s.verify(call)
+			switch {
+			case tt.ok && fault != nil:
+				t.Fatalf("verify returned fault %#x", fault.Status)
+			case tt.ok && !bytes.Equal(call.Request, stub):
+				t.Fatalf("stub data is % x, want % x", call.Request, stub)
+			case !tt.ok && (fault == nil || fault.Status != pdu.StatusAccessDenied || !fault.DidNotExecute):
+				t.Fatalf("verify returned %+v, want an access denied fault", fault)
+			}
+		})
+	}
+}
+
+func TestVerifyHeaderSigning(t *testing.T) {
+	// A client that supports header signing always offers it, so it must
+	// have been negotiated.
+	call, vt := testVerifiedCall()
+	call.Request = vt.Append(call.Request)
+	s := &Server{}
+	if fault := s.verify(call); fault == nil {
+		t.Fatal("verify accepted a request whose header signing offer was removed")
+	}
+}
+
+func TestVerifyMalformed(t *testing.T) {
+	call, vt := testVerifiedCall()
+	b := vt.Append(call.Request)
+	tests := []struct {
+		name    string
+		request []byte
+	}{
+		{"truncated", b[:len(b)-2]},
+		{"no-command", b[:4+len(copdu.VerificationSignature)]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			call.Request = tt.request
+			s := &Server{headerSign: true}
+			if fault := s.verify(call); fault == nil || fault.Status != pdu.StatusAccessDenied {
+				t.Fatalf("verify returned %+v, want an access denied fault", fault)
+			}
+		})
+	}
+}
+
+// testVerifiedCall returns a call and the verification trailer that a
+// client would append to its stub data.
+func testVerifiedCall() (*Call, *copdu.VerificationTrailer) {
+	call := &Call{
+		ID:             7,
+		ContextID:      1,
+		AbstractSyntax: testAbstract,
+		TransferSyntax: testTransfer,
+		OpNum:          5,
+		RequestFormat:  formatlabel.LEAIEEE,
+		Request:        []byte{1, 2, 3, 4},
+	}
+	vt := &copdu.VerificationTrailer{Commands: []copdu.VerificationCommand{
+		{Type: copdu.VerificationBitmask1, Bitmask: copdu.ClientSupportsHeaderSigning},
+		{Type: copdu.VerificationPContext, MustProcess: true, AbstractSyntax: testAbstract, TransferSyntax: testTransfer},
+		{
+			Type:        copdu.VerificationHeader2,
+			MustProcess: true,
+			PacketType:  pdu.TypeRequest,
+			Format:      formatlabel.LEAIEEE,
+			CallID:      7,
+			ContextID:   1,
+			OpNum:       5,
+		},
+	}}
+	return call, vt
+}
@@ -2,9 +2,14 @@ package protocol
 
 import (
 	"encoding/binary"
+	"errors"
 	"io"
 )
 
+// ErrMalformedTower is returned when a binary representation of a protocol
+// tower or floor cannot be unmarshaled.
+var ErrMalformedTower = errors.New("protocol: malformed protocol tower")
+
 // Floor represents a floor in the protocol tower. It describes one
 // layer of the protocol stack.
 type Floor struct {
@@ -28,6 +33,32 @@ func (f Floor) Marshal(p []byte) {
 	copyWithLength(f.AddressData, p) // Right-hand side (value)
 }
 
+// Unmarshal unmarshals the protocol floor from the binary representation
+// stored in p. It returns the number of bytes consumed.
+func (f *Floor) Unmarshal(p []byte) (n int, err error) {
+	lhs, n1, err := readWithLength(p)
+	if err != nil {
+		return 0, err
+	}
+	rhs, n2, err := readWithLength(p[n1:])
+	if err != nil {
+		return 0, err
+	}
+	f.ProtocolIdentifier = lhs
+	f.AddressData = rhs
+	return n1 + n2, nil
+}
+
+// Protocol returns the first octet of the protocol identifier, which
+// identifies the protocol of the floor. It returns zero if the protocol
+// identifier is empty.
+func (f Floor) Protocol() byte {
+	if len(f.ProtocolIdentifier) == 0 {
+		return 0
+	}
+	return f.ProtocolIdentifier[0]
+}
+
 // EncodedLength returns the total number of bytes required to encode f.
 func (f Floor) EncodedLength() int {
 	return 4 + len(f.ProtocolIdentifier) + len(f.AddressData)
@@ -37,3 +68,16 @@ func copyWithLength(from []byte, to []byte) {
 	binary.LittleEndian.PutUint16(to[0:2], uint16(len(from)))
 	copy(to[2:], from)
 }
+
+func readWithLength(from []byte) (data []byte, n int, err error) {
+	if len(from) < 2 {
+		return nil, 0, ErrMalformedTower
+	}
+	length := int(binary.LittleEndian.Uint16(from[0:2]))
+	if len(from) < 2+length {
+		return nil, 0, ErrMalformedTower
+	}
+	data = make([]byte, length)
+	copy(data, from[2:2+length])
+	return data, 2 + length, nil
+}
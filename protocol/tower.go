@@ -33,6 +33,26 @@ func (t Tower) Marshal(p []byte) {
 	}
 }
 
+// Unmarshal unmarshals the protocol tower from the binary representation
+// stored in p.
+func (t *Tower) Unmarshal(p []byte) error {
+	if len(p) < 2 {
+		return ErrMalformedTower
+	}
+	count := int(binary.LittleEndian.Uint16(p[0:2]))
+	floors := make(Tower, count)
+	offset := 2
+	for i := range floors {
+		n, err := floors[i].Unmarshal(p[offset:])
+		if err != nil {
+			return err
+		}
+		offset += n
+	}
+	*t = floors
+	return nil
+}
+
 // EncodedLength returns the total number of bytes required to marshal t.
 func (t Tower) EncodedLength() (length int) {
 	// 2-byte floor count plus the sum of all floors
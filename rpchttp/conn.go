@@ -0,0 +1,441 @@
+package rpchttp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu"
+	"github.com/gentlemanautomaton/dcerpc/uuid"
+)
+
+var (
+	// ErrClosed is returned when a virtual connection is used after it has
+	// been closed.
+	ErrClosed = errors.New("rpchttp: virtual connection closed")
+
+	// ErrProtocol is returned when the proxy sends an RTS PDU that is not
+	// valid in the state of the virtual connection.
+	ErrProtocol = errors.New("rpchttp: protocol violation by proxy")
+)
+
+// StatusError is returned when the proxy rejects a channel request.
+type StatusError struct {
+	Method string
+	Status string
+}
+
+// Error returns a description of the rejection.
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("rpchttp: proxy rejected %s request: %s", e.Method, e.Status)
+}
+
+// inChannel is an RPC_IN_DATA request, whose body carries the PDUs sent by
+// the client.
+type inChannel struct {
+	cookie  uuid.UUID
+	conn    net.Conn
+	written uint32 // Octets of the body that have been written
+}
+
+// outChannel is an RPC_OUT_DATA request, whose response carries the PDUs
+// sent by the server.
+type outChannel struct {
+	cookie uuid.UUID
+	conn   net.Conn
+	body   io.Reader
+}
+
+// Conn is a virtual connection, which carries the PDUs of a single
+// association over an IN channel and an OUT channel.
+//
+// Write must not be called concurrently with itself, nor Read with itself.
+type Conn struct {
+	target *target
+	vc     uuid.UUID // Virtual connection cookie
+
+	// inMutex serializes writes to the IN channel. It must be held along
+	// with mutex to replace the channel.
+	inMutex sync.Mutex
+	in      *inChannel
+
+	mutex sync.Mutex
+	cond  sync.Cond
+	err   error
+	out   *outChannel // The OUT channel being read
+	next  *outChannel // The successor of the OUT channel being read
+
+	// Flow control of the IN channel.
+	inCookie   uuid.UUID
+	peerWindow uint32 // Receive window of the proxy
+	sent       uint32 // Flow controlled octets sent on the IN channel
+	limit      uint32 // Octets that may be sent before an acknowledgement
+
+	// Flow control of the OUT channel.
+	queue      [][]byte // Received fragments that have not been read
+	queued     uint32   // Octets of the fragments in the queue
+	current    []byte   // Unread portion of the fragment being read
+	received   uint32   // Flow controlled octets received on the OUT channel
+	advertised uint32   // Octets that the proxy may send before an acknowledgement
+}
+
+// dial establishes a virtual connection to t.
+func dial(ctx context.Context, t *target) (*Conn, error) {
+	c := &Conn{target: t, vc: uuid.New()}
+	c.cond.L = &c.mutex
+
+	// The proxy does not respond on the OUT channel until both channels have
+	// been opened, so they are opened concurrently.
+	type result struct {
+		out *outChannel
+		err error
+	}
+	opened := make(chan result, 1)
+	go func() {
+		out, err := c.openOut(ctx, uuid.Nil)
+		opened <- result{out, err}
+	}()
+	in, err := c.openIn(ctx, uuid.Nil)
+	r := <-opened
+	if err == nil {
+		err = r.err
+	}
+	if err != nil {
+		if in != nil {
+			in.conn.Close()
+		}
+		if r.out != nil {
+			r.out.conn.Close()
+		}
+		return nil, err
+	}
+
+	// The proxy responds with CONN/A3 and CONN/C2, which carries the size of
+	// its receive window.
+	for {
+		b, err := copdu.ReadFragment(r.out.body)
+		if err == nil {
+			var rts *copdu.RTS
+			if rts, err = unmarshalRTS(b); err == nil && rts == nil {
+				err = ErrProtocol
+			}
+			if err == nil {
+				cmd, ok := rts.Command(copdu.RTSReceiveWindowSize)
+				if !ok {
+					continue
+				}
+				c.peerWindow = cmd.Value
+			}
+		}
+		if err != nil {
+			in.conn.Close()
+			r.out.conn.Close()
+			return nil, err
+		}
+		break
+	}
+
+	c.in, c.inCookie, c.limit = in, in.cookie, c.peerWindow
+	c.out, c.advertised = r.out, t.window
+	go c.receive(r.out)
+	return c, nil
+}
+
+// openIn opens an IN channel. If predecessor is not nil, the channel
+// replaces the IN channel with that cookie.
+func (c *Conn) openIn(ctx context.Context, predecessor uuid.UUID) (*inChannel, error) {
+	in := &inChannel{cookie: uuid.New()}
+	var rts []byte
+	if predecessor.IsNil() {
+		// CONN/B1
+		rts = marshalRTS(copdu.RTSFlagNone,
+			value(copdu.RTSVersion, rtsVersion),
+			cookie(copdu.RTSCookie, c.vc),
+			cookie(copdu.RTSCookie, in.cookie),
+			value(copdu.RTSChannelLifetime, c.target.lifetime),
+			value(copdu.RTSClientKeepalive, clientKeepalive),
+			cookie(copdu.RTSAssociationGroupID, uuid.New()),
+		)
+	} else {
+		rts = marshalRTS(copdu.RTSFlagRecycleChannel,
+			value(copdu.RTSVersion, rtsVersion),
+			cookie(copdu.RTSCookie, c.vc),
+			cookie(copdu.RTSCookie, predecessor),
+			cookie(copdu.RTSCookie, in.cookie),
+		)
+	}
+	conn, err := c.target.request(ctx, "RPC_IN_DATA", c.target.lifetime, rts)
+	if err != nil {
+		return nil, err
+	}
+	in.conn, in.written = conn, uint32(len(rts))
+	return in, nil
+}
+
+// openOut opens an OUT channel. If predecessor is not nil, the channel
+// replaces the OUT channel with that cookie.
+func (c *Conn) openOut(ctx context.Context, predecessor uuid.UUID) (*outChannel, error) {
+	out := &outChannel{cookie: uuid.New()}
+	var rts []byte
+	if predecessor.IsNil() {
+		// CONN/A1
+		rts = marshalRTS(copdu.RTSFlagNone,
+			value(copdu.RTSVersion, rtsVersion),
+			cookie(copdu.RTSCookie, c.vc),
+			cookie(copdu.RTSCookie, out.cookie),
+			value(copdu.RTSReceiveWindowSize, c.target.window),
+		)
+	} else {
+		rts = marshalRTS(copdu.RTSFlagRecycleChannel,
+			value(copdu.RTSVersion, rtsVersion),
+			cookie(copdu.RTSCookie, c.vc),
+			cookie(copdu.RTSCookie, predecessor),
+			cookie(copdu.RTSCookie, out.cookie),
+			value(copdu.RTSReceiveWindowSize, c.target.window),
+		)
+	}
+	conn, err := c.target.request(ctx, "RPC_OUT_DATA", uint32(len(rts)), rts)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err == nil && resp.StatusCode != http.StatusOK {
+		err = &StatusError{Method: "RPC_OUT_DATA", Status: resp.Status}
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	out.conn, out.body = conn, resp.Body
+	return out, nil
+}
+
+// Read reads data from the PDUs received on the OUT channel.
+func (c *Conn) Read(p []byte) (int, error) {
+	c.mutex.Lock()
+	for len(c.current) == 0 {
+		if len(c.queue) > 0 {
+			c.current = c.queue[0]
+			c.queue = c.queue[1:]
+			c.queued -= uint32(len(c.current))
+			continue
+		}
+		if c.err != nil {
+			err := c.err
+			c.mutex.Unlock()
+			return 0, err
+		}
+		c.cond.Wait()
+	}
+	n := copy(p, c.current)
+	c.current = c.current[n:]
+	ack := c.ack()
+	c.mutex.Unlock()
+
+	if ack != nil {
+		if err := c.writeRTS(ack); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Write writes a PDU to the IN channel. It blocks until the proxy's receive
+// window has room for p.
+func (c *Conn) Write(p []byte) (int, error) {
+	n := uint32(len(p))
+	c.mutex.Lock()
+	for c.err == nil && c.sent+n > c.limit {
+		c.cond.Wait()
+	}
+	err := c.err
+	c.mutex.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	c.inMutex.Lock()
+	defer c.inMutex.Unlock()
+	if err := c.reserve(n); err != nil {
+		return 0, c.fail(err)
+	}
+	c.mutex.Lock()
+	c.sent += n
+	c.mutex.Unlock()
+	if _, err := c.in.conn.Write(p); err != nil {
+		return 0, c.fail(err)
+	}
+	c.in.written += n
+	return len(p), nil
+}
+
+// writeRTS writes an RTS PDU to the IN channel. RTS PDUs are not subject to
+// flow control.
+func (c *Conn) writeRTS(b []byte) error {
+	c.inMutex.Lock()
+	defer c.inMutex.Unlock()
+	if err := c.reserve(uint32(len(b))); err != nil {
+		return c.fail(err)
+	}
+	if _, err := c.in.conn.Write(b); err != nil {
+		return c.fail(err)
+	}
+	c.in.written += uint32(len(b))
+	return nil
+}
+
+// reserve replaces the IN channel with a successor if it does not have room
+// for n octets and the RTS PDUs that end the channel. The caller must hold
+// c.inMutex.
+func (c *Conn) reserve(n uint32) error {
+	if c.in.written+n+eofLength+minPaddingLength <= c.target.lifetime {
+		return nil
+	}
+
+	next, err := c.openIn(context.Background(), c.in.cookie)
+	if err != nil {
+		return err
+	}
+
+	// The proxy reads the remainder of the old channel before it reads from
+	// its successor. The old channel is padded to its content length so
+	// that the request is complete.
+	old := c.in
+	end := eof(copdu.RTSFlagInChannel)
+	end = append(end, padding(int(c.target.lifetime-old.written)-len(end))...)
+	_, err = old.conn.Write(end)
+	old.conn.Close()
+	if err != nil {
+		next.conn.Close()
+		return err
+	}
+
+	c.mutex.Lock()
+	c.in, c.inCookie, c.sent, c.limit = next, next.cookie, 0, c.peerWindow
+	err = c.err
+	c.mutex.Unlock()
+	if err != nil {
+		next.conn.Close()
+	}
+	return err
+}
+
+// receive reads PDUs from the OUT channel until the virtual connection is
+// closed or fails. Data PDUs are queued for Read and RTS PDUs are processed.
+func (c *Conn) receive(out *outChannel) {
+	for {
+		b, err := copdu.ReadFragment(out.body)
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		rts, err := unmarshalRTS(b)
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		if rts == nil {
+			c.mutex.Lock()
+			c.queue = append(c.queue, b)
+			c.queued += uint32(len(b))
+			c.received += uint32(len(b))
+			c.cond.Broadcast()
+			ack := c.ack()
+			c.mutex.Unlock()
+			if ack != nil {
+				c.writeRTS(ack)
+			}
+			continue
+		}
+
+		switch {
+		case rts.Flags&copdu.RTSFlagPing != 0:
+			// Keep-alive traffic from the proxy.
+		case rts.Flags&copdu.RTSFlagRecycleChannel != 0:
+			// The proxy has asked for the OUT channel to be replaced. Data
+			// continues to arrive on the old channel until it ends.
+			next, err := c.openOut(context.Background(), out.cookie)
+			if err != nil {
+				c.fail(err)
+				return
+			}
+			c.mutex.Lock()
+			c.next = next
+			c.mutex.Unlock()
+		case rts.Flags&copdu.RTSFlagEOF != 0:
+			c.mutex.Lock()
+			next := c.next
+			if next != nil {
+				c.out, c.next = next, nil
+				c.received, c.advertised = 0, c.target.window-min(c.queued, c.target.window)
+			}
+			c.mutex.Unlock()
+			out.conn.Close()
+			if next == nil {
+				c.fail(ErrProtocol)
+				return
+			}
+			out = next
+		default:
+			if ack, ok := rts.Command(copdu.RTSFlowControlAck); ok {
+				c.mutex.Lock()
+				if ack.Cookie == c.inCookie {
+					c.limit = ack.BytesReceived + ack.AvailableWindow
+					c.cond.Broadcast()
+				}
+				c.mutex.Unlock()
+			}
+		}
+	}
+}
+
+// ack returns a flow control acknowledgement for the OUT channel if the
+// receive window has grown by at least half of its size since the last
+// acknowledgement. The caller must hold c.mutex.
+func (c *Conn) ack() []byte {
+	if c.err != nil {
+		return nil
+	}
+	window := c.target.window
+	available := window - min(c.queued, window)
+	if c.received+available-c.advertised < window/2 {
+		return nil
+	}
+	c.advertised = c.received + available
+	return marshalRTS(copdu.RTSFlagOtherCmd,
+		value(copdu.RTSDestination, copdu.RTSDestinationOutProxy),
+		flowControlAck(c.out.cookie, c.received, available),
+	)
+}
+
+// fail closes the virtual connection because of err, which is returned.
+func (c *Conn) fail(err error) error {
+	c.mutex.Lock()
+	if c.err != nil {
+		err = c.err
+		c.mutex.Unlock()
+		return err
+	}
+	c.err = err
+	c.cond.Broadcast()
+	in, out, next := c.in, c.out, c.next
+	c.mutex.Unlock()
+
+	in.conn.Close()
+	out.conn.Close()
+	if next != nil {
+		next.conn.Close()
+	}
+	return err
+}
+
+// Close closes the channels of the virtual connection.
+func (c *Conn) Close() error {
+	c.fail(ErrClosed)
+	return nil
+}
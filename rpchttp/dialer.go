@@ -0,0 +1,203 @@
+package rpchttp
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/gentlemanautomaton/dcerpc"
+)
+
+// Defaults used by dialers.
+const (
+	// DefaultChannelLifetime is the default content length of IN channels.
+	DefaultChannelLifetime = 1 << 30
+
+	// DefaultReceiveWindowSize is the default size of the window of data
+	// that the proxy may send on an OUT channel before it must wait for an
+	// acknowledgement.
+	DefaultReceiveWindowSize = 1 << 16
+
+	// DefaultServerPort is the port of the RPC server that the proxy
+	// connects to if a binding does not specify an endpoint.
+	DefaultServerPort = "593"
+
+	// minChannelLifetime is the smallest IN channel content length that can
+	// carry a fragment of the largest size along with the RTS PDUs that
+	// begin and end the channel.
+	minChannelLifetime = 1 << 17
+)
+
+// clientKeepalive is the keep-alive interval, in milliseconds, that is
+// advertised to the proxy.
+const clientKeepalive = 300000
+
+// Dialer establishes virtual connections for ncacn_http bindings. It
+// implements the dcerpc.Dialer interface:
+//
+//	client := dcerpc.Client{
+//		Dialers: map[string]dcerpc.Dialer{
+//			dcerpc.ProtSeqHTTP: &rpchttp.Dialer{},
+//		},
+//	}
+//
+// The proxy is identified by the RpcProxy option of a binding, which holds
+// its host name and an optional port. If the option is absent the network
+// address of the binding is used as the proxy. For example:
+//
+//	ncacn_http:server[593,RpcProxy=gateway.example.com:443]
+type Dialer struct {
+	// DialContext establishes the TCP connections to the proxy. If it is nil
+	// a net.Dialer is used.
+	DialContext func(ctx context.Context, network, address string) (net.Conn, error)
+
+	// TLSConfig is the TLS configuration used to connect to the proxy. If it
+	// is nil the default configuration is used.
+	TLSConfig *tls.Config
+
+	// PlainHTTP causes the dialer to connect to the proxy without TLS.
+	PlainHTTP bool
+
+	// Header holds additional headers sent with each channel request, such
+	// as the Authorization header required by the proxy.
+	Header http.Header
+
+	// ChannelLifetime is the content length of IN channels, which limits the
+	// number of octets that can be sent on each channel before it is
+	// replaced. If it is zero DefaultChannelLifetime is used.
+	ChannelLifetime uint32
+
+	// ReceiveWindowSize is the size of the receive window of OUT channels.
+	// If it is zero DefaultReceiveWindowSize is used.
+	ReceiveWindowSize uint32
+}
+
+// Dial establishes a virtual connection to the RPC server identified by b
+// through an RPC proxy.
+func (d *Dialer) Dial(ctx context.Context, b dcerpc.Binding) (io.ReadWriteCloser, error) {
+	proxy := b.Options["RpcProxy"]
+	if proxy == "" {
+		proxy = b.NetworkAddr
+	}
+	server := b.NetworkAddr
+	if server == "" {
+		server = "localhost"
+	}
+	port := b.Endpoint
+	if port == "" {
+		port = DefaultServerPort
+	}
+	return d.DialProxy(ctx, proxy, net.JoinHostPort(server, port))
+}
+
+// DialProxy establishes a virtual connection to the RPC server at the
+// given host and port through the proxy at the given host and optional
+// port.
+func (d *Dialer) DialProxy(ctx context.Context, proxy, server string) (*Conn, error) {
+	t, err := d.target(proxy, server)
+	if err != nil {
+		return nil, err
+	}
+	return dial(ctx, t)
+}
+
+func (d *Dialer) target(proxy, server string) (*target, error) {
+	host, port, err := net.SplitHostPort(proxy)
+	if err != nil {
+		host, port = proxy, "443"
+		if d.PlainHTTP {
+			port = "80"
+		}
+	}
+	serverHost, serverPort, err := net.SplitHostPort(server)
+	if err != nil {
+		return nil, err
+	}
+	t := &target{
+		dialer:   d,
+		address:  net.JoinHostPort(host, port),
+		host:     host,
+		path:     fmt.Sprintf("/rpc/rpcproxy.dll?%s:%s", serverHost, serverPort),
+		lifetime: d.ChannelLifetime,
+		window:   d.ReceiveWindowSize,
+	}
+	if t.lifetime == 0 {
+		t.lifetime = DefaultChannelLifetime
+	} else if t.lifetime < minChannelLifetime {
+		t.lifetime = minChannelLifetime
+	}
+	if t.window == 0 {
+		t.window = DefaultReceiveWindowSize
+	}
+	if !d.PlainHTTP {
+		if d.TLSConfig != nil {
+			t.tls = d.TLSConfig.Clone()
+		} else {
+			t.tls = new(tls.Config)
+		}
+		if t.tls.ServerName == "" {
+			t.tls.ServerName = host
+		}
+	}
+	return t, nil
+}
+
+// target identifies the proxy and RPC server of a virtual connection.
+type target struct {
+	dialer   *Dialer
+	address  string // Address of the proxy
+	host     string // Host name of the proxy
+	path     string // Request path, which identifies the RPC server
+	tls      *tls.Config
+	lifetime uint32
+	window   uint32
+}
+
+// request connects to the proxy and sends the header of a channel request
+// with the given method and content length, followed by body. It returns the
+// connection, which carries the remainder of the request body and the
+// response.
+func (t *target) request(ctx context.Context, method string, length uint32, body []byte) (net.Conn, error) {
+	dial := t.dialer.DialContext
+	if dial == nil {
+		dial = new(net.Dialer).DialContext
+	}
+	conn, err := dial(ctx, "tcp", t.address)
+	if err != nil {
+		return nil, err
+	}
+	if t.tls != nil {
+		tlsConn := tls.Client(conn, t.tls)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	header := t.dialer.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	header.Set("Accept", "application/rpc")
+	header.Set("User-Agent", "MSRPC")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Pragma", "no-cache")
+	header.Set("Connection", "Keep-Alive")
+	header.Set("Content-Length", fmt.Sprint(length))
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s %s HTTP/1.1\r\nHost: %s\r\n", method, t.path, t.host)
+	header.Write(&b)
+	b.WriteString("\r\n")
+	b.Write(body)
+	if _, err := conn.Write(b.Bytes()); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
@@ -0,0 +1,15 @@
+// Package rpchttp implements the ncacn_http protocol sequence, which carries
+// connection-oriented RPC associations over HTTP through an RPC proxy.
+//
+// Version 2 of the RPC over HTTP protocol is implemented. Each association is
+// carried by a virtual connection that consists of two HTTP requests made to
+// the proxy: an IN channel, which is an RPC_IN_DATA request whose body carries
+// PDUs sent by the client, and an OUT channel, which is an RPC_OUT_DATA request
+// whose response carries PDUs sent by the server. The channels are managed
+// with RTS PDUs, which establish the virtual connection, acknowledge the
+// receipt of data for flow control and replace channels that have reached
+// the end of their lifetime.
+//
+// The protocol is described in "[MS-RPCH] Remote Procedure Call over HTTP
+// Protocol".
+package rpchttp
@@ -0,0 +1,434 @@
+package rpchttp
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gentlemanautomaton/dcerpc"
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu"
+	"github.com/gentlemanautomaton/dcerpc/security"
+	"github.com/gentlemanautomaton/dcerpc/security/ntlm"
+	"github.com/gentlemanautomaton/dcerpc/uuid"
+)
+
+// testProxy is a stand-in RPC proxy that serves the RPC_IN_DATA and
+// RPC_OUT_DATA verbs and forwards the PDUs of each virtual connection to an
+// RPC server in process. Its channels are short lived so that they are
+// recycled frequently.
+type testProxy struct {
+	t           *testing.T
+	serve       func(io.ReadWriteCloser)
+	window      uint32 // Receive window of IN channels
+	outLifetime uint32 // Content length of OUT channels
+
+	mutex sync.Mutex
+	conns map[uuid.UUID]*proxyConn
+
+	recycledIn  int32
+	recycledOut int32
+}
+
+// proxyConn is a virtual connection served by the proxy.
+type proxyConn struct {
+	p      *testProxy
+	server net.Conn
+
+	inReady  chan struct{}
+	outs     chan *proxyOut // OUT channels, in order
+	ins      chan *proxyIn  // Successors of the IN channel
+	rts      chan []byte    // RTS PDUs to send on the OUT channel
+	acks     chan copdu.RTSCommand
+	closed   chan struct{}
+	shutdown sync.Once
+
+	// The loops close these when they exit and no longer use the channels
+	// of the HTTP handlers.
+	readDone  chan struct{}
+	writeDone chan struct{}
+}
+
+type proxyOut struct {
+	cookie uuid.UUID
+	window uint32
+	w      http.ResponseWriter
+	done   chan struct{}
+}
+
+type proxyIn struct {
+	cookie uuid.UUID
+	body   io.Reader
+	done   chan struct{}
+}
+
+func (p *testProxy) conn(vc uuid.UUID) *proxyConn {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if c, ok := p.conns[vc]; ok {
+		return c
+	}
+	client, server := net.Pipe()
+	c := &proxyConn{
+		p:       p,
+		server:  client,
+		inReady: make(chan struct{}),
+		outs:    make(chan *proxyOut, 1),
+		ins:     make(chan *proxyIn, 1),
+		rts:     make(chan []byte, 16),
+		acks:    make(chan copdu.RTSCommand, 16),
+		closed:  make(chan struct{}),
+
+		readDone:  make(chan struct{}),
+		writeDone: make(chan struct{}),
+	}
+	p.conns[vc] = c
+	go p.serve(server)
+	go c.writeLoop()
+	return c
+}
+
+func (c *proxyConn) close() {
+	c.shutdown.Do(func() {
+		close(c.closed)
+		c.server.Close()
+	})
+}
+
+func (p *testProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.RawQuery != "127.0.0.1:593" {
+		http.Error(w, "unexpected server "+r.URL.RawQuery, http.StatusBadRequest)
+		return
+	}
+	b, err := copdu.ReadFragment(r.Body)
+	if err != nil {
+		p.t.Error(err)
+		return
+	}
+	rts, err := unmarshalRTS(b)
+	if err != nil || rts == nil || len(rts.Commands) < 4 {
+		p.t.Errorf("%s: invalid initial PDU: %v", r.Method, err)
+		return
+	}
+	c := p.conn(rts.Commands[1].Cookie)
+	recycle := rts.Flags&copdu.RTSFlagRecycleChannel != 0
+	switch r.Method {
+	case "RPC_OUT_DATA":
+		out := &proxyOut{w: w, done: make(chan struct{})}
+		if recycle {
+			atomic.AddInt32(&p.recycledOut, 1)
+			out.cookie, out.window = rts.Commands[3].Cookie, rts.Commands[4].Value
+		} else {
+			out.cookie, out.window = rts.Commands[2].Cookie, rts.Commands[3].Value
+			select {
+			case <-c.inReady:
+			case <-c.closed:
+				return
+			}
+		}
+		c.outs <- out
+		select {
+		case <-out.done:
+		case <-c.writeDone:
+		}
+	case "RPC_IN_DATA":
+		in := &proxyIn{body: r.Body, done: make(chan struct{})}
+		if recycle {
+			atomic.AddInt32(&p.recycledIn, 1)
+			in.cookie = rts.Commands[3].Cookie
+			c.ins <- in
+		} else {
+			in.cookie = rts.Commands[2].Cookie
+			close(c.inReady)
+			go func() {
+				defer close(c.readDone)
+				c.readLoop(in)
+			}()
+		}
+		select {
+		case <-in.done:
+		case <-c.readDone:
+		}
+	default:
+		http.Error(w, "unsupported method", http.StatusMethodNotAllowed)
+	}
+}
+
+// readLoop forwards the PDUs received on the IN channels to the server.
+func (c *proxyConn) readLoop(in *proxyIn) {
+	defer c.close()
+	var received, acked uint32
+	for {
+		b, err := copdu.ReadFragment(in.body)
+		if err != nil {
+			close(in.done)
+			return
+		}
+		rts, err := unmarshalRTS(b)
+		if err != nil {
+			c.p.t.Error(err)
+			return
+		}
+		if rts == nil {
+			received += uint32(len(b))
+			if received > acked+c.p.window {
+				c.p.t.Errorf("client sent %d octets with a window of %d", received-acked, c.p.window)
+			}
+			if _, err := c.server.Write(b); err != nil {
+				return
+			}
+			if received-acked >= c.p.window/2 {
+				acked = received
+				c.rts <- marshalRTS(copdu.RTSFlagOtherCmd, flowControlAck(in.cookie, received, c.p.window))
+			}
+			continue
+		}
+		switch {
+		case rts.Flags&copdu.RTSFlagEOF != 0:
+			// The channel has been replaced. The remainder is padding.
+			io.Copy(io.Discard, in.body)
+			close(in.done)
+			select {
+			case in = <-c.ins:
+			case <-c.closed:
+				return
+			}
+			received, acked = 0, 0
+		default:
+			if ack, ok := rts.Command(copdu.RTSFlowControlAck); ok {
+				c.acks <- ack
+			}
+		}
+	}
+}
+
+// writeLoop sends the PDUs received from the server on the OUT channels.
+func (c *proxyConn) writeLoop() {
+	defer close(c.writeDone)
+	defer c.close()
+	frags := make(chan []byte)
+	go func() {
+		for {
+			b, err := copdu.ReadFragment(c.server)
+			if err != nil {
+				close(frags)
+				return
+			}
+			frags <- b
+		}
+	}()
+
+	var out *proxyOut
+	select {
+	case out = <-c.outs:
+	case <-c.closed:
+		return
+	}
+	var written, sent, limit uint32
+	start := func() {
+		out.w.Header().Set("Content-Length", strconv.Itoa(int(c.p.outLifetime)))
+		out.w.WriteHeader(http.StatusOK)
+		written, sent, limit = 0, 0, out.window
+	}
+	write := func(b []byte) bool {
+		if _, err := out.w.Write(b); err != nil {
+			return false
+		}
+		out.w.(http.Flusher).Flush()
+		written += uint32(len(b))
+		return true
+	}
+	// reserve recycles the OUT channel if it does not have room for n more
+	// octets.
+	reserve := func(n uint32) bool {
+		recycle := marshalRTS(copdu.RTSFlagRecycleChannel, value(copdu.RTSDestination, copdu.RTSDestinationClient))
+		if written+n+uint32(len(recycle))+eofLength+minPaddingLength <= c.p.outLifetime {
+			return true
+		}
+		if !write(recycle) {
+			return false
+		}
+		var next *proxyOut
+		select {
+		case next = <-c.outs:
+		case <-c.closed:
+			return false
+		}
+		end := eof(copdu.RTSFlagOutChannel)
+		end = append(end, padding(int(c.p.outLifetime-written)-len(end))...)
+		if !write(end) {
+			return false
+		}
+		close(out.done)
+		out = next
+		start()
+		return true
+	}
+
+	start()
+	// CONN/A3 and CONN/C2
+	write(marshalRTS(copdu.RTSFlagNone, value(copdu.RTSConnectionTimeout, 120000)))
+	write(marshalRTS(copdu.RTSFlagNone,
+		value(copdu.RTSVersion, rtsVersion),
+		value(copdu.RTSReceiveWindowSize, c.p.window),
+		value(copdu.RTSConnectionTimeout, 120000),
+	))
+
+	var pending []byte
+	for {
+		var source chan []byte
+		if pending == nil {
+			source = frags
+		}
+		select {
+		case b, ok := <-source:
+			if !ok {
+				return
+			}
+			pending = b
+		case b := <-c.rts:
+			if !reserve(uint32(len(b))) || !write(b) {
+				return
+			}
+		case ack := <-c.acks:
+			if ack.Cookie == out.cookie {
+				limit = ack.BytesReceived + ack.AvailableWindow
+			}
+		case <-c.closed:
+			return
+		}
+		if pending != nil && sent+uint32(len(pending)) <= limit {
+			if !reserve(uint32(len(pending))) {
+				return
+			}
+			if sent+uint32(len(pending)) > limit {
+				continue
+			}
+			if !write(pending) {
+				return
+			}
+			sent += uint32(len(pending))
+			pending = nil
+		}
+	}
+}
+
+type echo struct {
+	N    uint32
+	Data []uint16 `idl:"size_is(N)"`
+}
+
+func TestVirtualConnection(t *testing.T) {
+	iface := dcerpc.Interface{UUID: uuid.MustParse("4b324fc8-1670-01d3-1278-5a47bf6ee188"), VersionMajor: 3}
+	for _, level := range []security.Level{security.LevelNone, security.LevelPrivacy} {
+		srv := dcerpc.Server{MinAuthLevel: level}
+		if level != security.LevelNone {
+			srv.SecurityProviders = []security.Provider{&ntlm.Provider{Accounts: ntlm.AccountList{{User: "alice", Password: "wonderland"}}}}
+		}
+		srv.Register(iface, dcerpc.OperationTable{
+			func(ctx context.Context, call *dcerpc.Call) error {
+				var in echo
+				if err := call.DecodeRequest(&in); err != nil {
+					return err
+				}
+				return call.EncodeResponse(in)
+			},
+		})
+		proxy := &testProxy{
+			t:           t,
+			serve:       func(conn io.ReadWriteCloser) { srv.ServeConn(context.Background(), conn) },
+			window:      8192,
+			outLifetime: 48 * 1024,
+			conns:       make(map[uuid.UUID]*proxyConn),
+		}
+		ts := httptest.NewTLSServer(proxy)
+		roots := x509.NewCertPool()
+		roots.AddCert(ts.Certificate())
+
+		client := dcerpc.Client{Dialers: map[string]dcerpc.Dialer{
+			dcerpc.ProtSeqHTTP: &Dialer{
+				TLSConfig:         &tls.Config{RootCAs: roots},
+				ReceiveWindowSize: 8192,
+				ChannelLifetime:   minChannelLifetime,
+			},
+		}}
+		if level != security.LevelNone {
+			client.SecurityProvider = &ntlm.Provider{Credentials: ntlm.Credentials{User: "alice", Password: "wonderland"}}
+			client.AuthLevel = level
+		}
+		b, err := dcerpc.ParseBinding("ncacn_http:127.0.0.1[593,RpcProxy=" + ts.Listener.Addr().String() + "]")
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := client.Handle(b, iface)
+		for i, n := range []int{1, 5000, 30000, 30000, 30000, 7} {
+			in := echo{N: uint32(n), Data: make([]uint16, n)}
+			for j := range in.Data {
+				in.Data[j] = uint16(i + j)
+			}
+			var out echo
+			if err := h.Invoke(context.Background(), 0, in, &out); err != nil {
+				t.Fatalf("level %d, call %d: %v", level, i, err)
+			}
+			if len(out.Data) != n || out.Data[n-1] != uint16(i+n-1) {
+				t.Fatalf("level %d, call %d: echoed %d elements", level, i, len(out.Data))
+			}
+		}
+		client.Close()
+		ts.Close()
+
+		if len(proxy.conns) != 1 {
+			t.Errorf("level %d: %d virtual connections were established", level, len(proxy.conns))
+		}
+		if proxy.recycledIn == 0 || proxy.recycledOut == 0 {
+			t.Errorf("level %d: %d IN and %d OUT channels were recycled", level, proxy.recycledIn, proxy.recycledOut)
+		}
+	}
+}
+
+func TestRejectedChannel(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "RPC_IN_DATA" {
+			io.Copy(io.Discard, r.Body)
+		}
+		http.Error(w, "access denied", http.StatusUnauthorized)
+	}))
+	defer ts.Close()
+	d := Dialer{PlainHTTP: true, ChannelLifetime: minChannelLifetime}
+	_, err := d.DialProxy(context.Background(), ts.Listener.Addr().String(), "server:593")
+	if err, ok := err.(*StatusError); !ok || !strings.Contains(err.Status, "401") {
+		t.Fatalf("dial returned %v", err)
+	}
+}
+
+func TestPadding(t *testing.T) {
+	for _, n := range []int{0, minPaddingLength, 100, 0xffff, 0xffff + 10, 0x20000} {
+		b := padding(n)
+		if len(b) != n {
+			t.Fatalf("padding of %d octets is %d octets", n, len(b))
+		}
+		r := bytes.NewReader(b)
+		for r.Len() > 0 {
+			frag, err := copdu.ReadFragment(r)
+			if err != nil {
+				t.Fatalf("padding of %d octets: %v", n, err)
+			}
+			rts, err := unmarshalRTS(frag)
+			if err != nil || rts == nil {
+				t.Fatalf("padding of %d octets holds %+v, %v", n, rts, err)
+			}
+			if cmd, ok := rts.Command(copdu.RTSPadding); !ok || int(cmd.Padding) != len(frag)-minPaddingLength {
+				t.Fatalf("padding of %d octets holds %+v", n, rts)
+			}
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package rpchttp
+
+import (
+	"github.com/gentlemanautomaton/dcerpc/formatlabel"
+	"github.com/gentlemanautomaton/dcerpc/pdu"
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu"
+	"github.com/gentlemanautomaton/dcerpc/uuid"
+)
+
+// rtsVersion is the version of the RPC over HTTP protocol carried by the
+// Version command of RTS PDUs.
+const rtsVersion = 1
+
+// Octet lengths of the RTS PDUs that are written at the end of a channel.
+const (
+	eofLength        = copdu.HeaderLength + 4 + 4 // One ANCE command
+	minPaddingLength = copdu.HeaderLength + 4 + 8 // One empty Padding command
+)
+
+// marshalRTS returns the binary representation of an RTS PDU with the given
+// flags and commands.
+func marshalRTS(flags uint16, commands ...copdu.RTSCommand) []byte {
+	p := copdu.PDU{
+		Header: copdu.Header{
+			Flags:  copdu.FirstFrag | copdu.LastFrag,
+			Format: formatlabel.LEAIEEE,
+		},
+		Body: &copdu.RTS{Flags: flags, Commands: commands},
+	}
+	b, err := p.Marshal()
+	if err != nil {
+		// RTS PDUs are small enough that this cannot happen.
+		panic(err)
+	}
+	return b
+}
+
+// unmarshalRTS returns the RTS PDU stored in the fragment b, or nil if b is
+// not an RTS PDU.
+func unmarshalRTS(b []byte) (*copdu.RTS, error) {
+	var h copdu.Header
+	if err := h.Unmarshal(b); err != nil {
+		return nil, err
+	}
+	if h.PacketType != pdu.TypeRTS {
+		return nil, nil
+	}
+	var p copdu.PDU
+	if err := p.Unmarshal(b); err != nil {
+		return nil, err
+	}
+	return p.Body.(*copdu.RTS), nil
+}
+
+func value(t copdu.RTSCommandType, v uint32) copdu.RTSCommand {
+	return copdu.RTSCommand{Type: t, Value: v}
+}
+
+func cookie(t copdu.RTSCommandType, c uuid.UUID) copdu.RTSCommand {
+	return copdu.RTSCommand{Type: t, Cookie: c}
+}
+
+// flowControlAck returns a FlowControlAck command that acknowledges the
+// receipt of data on the channel identified by channel.
+func flowControlAck(channel uuid.UUID, received, available uint32) copdu.RTSCommand {
+	return copdu.RTSCommand{
+		Type:            copdu.RTSFlowControlAck,
+		Cookie:          channel,
+		BytesReceived:   received,
+		AvailableWindow: available,
+	}
+}
+
+// eof returns the RTS PDU that is written as the last PDU of data on a
+// channel that is being replaced by its successor. It announces that a new
+// channel has been established.
+func eof(channelFlag uint16) []byte {
+	return marshalRTS(copdu.RTSFlagEOF|channelFlag, copdu.RTSCommand{Type: copdu.RTSANCE})
+}
+
+// padding returns RTS PDUs with a total length of n, which fill the remainder
+// of a channel's content length. n must be zero or at least
+// minPaddingLength.
+func padding(n int) []byte {
+	var b []byte
+	for n > 0 {
+		size := n
+		if size > 0xffff {
+			size = 0xffff
+		}
+		if rest := n - size; rest > 0 && rest < minPaddingLength {
+			size = n - minPaddingLength
+		}
+		b = append(b, marshalRTS(copdu.RTSFlagNone, copdu.RTSCommand{
+			Type:    copdu.RTSPadding,
+			Padding: uint32(size - minPaddingLength),
+		})...)
+		n -= size
+	}
+	return b
+}
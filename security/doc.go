@@ -0,0 +1,7 @@
+// Package security defines the interfaces implemented by security providers
+// that authenticate RPC associations and protect the PDUs exchanged on them.
+//
+// Security providers are described in section 13.2 of the "DCE 1.1: Remote
+// Procedure Call" technical standard and in section 2.2.1.1.7 of
+// "[MS-RPCE] Remote Procedure Call Protocol Extensions".
+package security
@@ -0,0 +1,62 @@
+package kerberos
+
+import (
+	"encoding/asn1"
+	"errors"
+	"strings"
+)
+
+// Credentials identify a client principal and hold the secret used to obtain
+// tickets for it.
+type Credentials struct {
+	Realm    string
+	User     string  // The components of the principal name separated by '/'
+	Password string  // The password of the principal
+	Keytab   *Keytab // Holds the principal's keys if Password is empty
+}
+
+// key returns the client's long-term key, as described by the ETYPE-INFO2
+// entries in padata. If etype is non-zero the key must be of that type.
+func (c *Credentials) key(padata []paData, etype int32) (encryptionKey, error) {
+	var entries []etypeInfo2Entry
+	for _, pa := range padata {
+		if pa.Type == paETypeInfo2 {
+			if _, err := asn1.Unmarshal(pa.Value, &entries); err != nil {
+				return encryptionKey{}, err
+			}
+		}
+	}
+
+	chosen := etype
+	salt := c.Realm + strings.Replace(c.User, "/", "", -1)
+	var params []byte
+	for _, entry := range entries {
+		if etype != 0 && entry.EType != etype {
+			continue
+		}
+		if _, err := etypeFor(entry.EType); err != nil {
+			continue
+		}
+		chosen, params = entry.EType, entry.S2KParams
+		if entry.Salt != "" {
+			salt = entry.Salt
+		}
+		break
+	}
+	e, err := etypeFor(chosen)
+	if err != nil {
+		return encryptionKey{}, err
+	}
+
+	if c.Password == "" && c.Keytab != nil {
+		if key, ok := c.Keytab.key(c.User, c.Realm, 0, chosen); ok {
+			return key, nil
+		}
+		return encryptionKey{}, errors.New("kerberos: keytab does not hold a key for the client")
+	}
+	key, err := e.StringToKey(c.Password, salt, params)
+	if err != nil {
+		return encryptionKey{}, err
+	}
+	return encryptionKey{KeyType: chosen, KeyValue: key}, nil
+}
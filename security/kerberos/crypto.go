@@ -0,0 +1,437 @@
+package kerberos
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/rc4"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+
+	"github.com/gentlemanautomaton/dcerpc/security/ntlm"
+)
+
+// Encryption types.
+const (
+	AES128CTSHMACSHA196 int32 = 17 // aes128-cts-hmac-sha1-96
+	AES256CTSHMACSHA196 int32 = 18 // aes256-cts-hmac-sha1-96
+	RC4HMAC             int32 = 23 // rc4-hmac
+)
+
+// Checksum types.
+const (
+	cksumHMACSHA196AES128 = 15
+	cksumHMACSHA196AES256 = 16
+	cksumHMACMD5          = -138
+	cksumGSSAPI           = 0x8003
+)
+
+// Key usage numbers.
+const (
+	usageASReqTimestamp      = 1
+	usageTicket              = 2
+	usageASRepEncPart        = 3
+	usageTGSReqChecksum      = 6
+	usageTGSReqAuthenticator = 7
+	usageTGSRepEncPart       = 8
+	usageAPReqAuthenticator  = 11
+	usageAPRepEncPart        = 12
+	usageAcceptorSeal        = 22
+	usageAcceptorSign        = 23
+	usageInitiatorSeal       = 24
+	usageInitiatorSign       = 25
+)
+
+var (
+	// ErrUnsupportedEType is returned when a message is protected by an
+	// encryption type that is not supported.
+	ErrUnsupportedEType = errors.New("kerberos: unsupported encryption type")
+
+	// ErrIntegrity is returned when the integrity check of an encrypted
+	// message fails.
+	ErrIntegrity = errors.New("kerberos: integrity check failed")
+)
+
+// defaultETypes are the encryption types requested by clients, in order of
+// preference.
+var defaultETypes = []int32{AES256CTSHMACSHA196, AES128CTSHMACSHA196, RC4HMAC}
+
+// etype is an encryption type, as described in RFC 3961.
+type etype interface {
+	// ID returns the encryption type number.
+	ID() int32
+
+	// KeySize returns the size of keys in octets.
+	KeySize() int
+
+	// StringToKey derives a key from a password and salt.
+	StringToKey(password, salt string, params []byte) ([]byte, error)
+
+	// Encrypt encrypts plaintext with key for the given usage.
+	Encrypt(key []byte, usage uint32, plaintext []byte) ([]byte, error)
+
+	// Decrypt decrypts and verifies ciphertext with key for the given usage.
+	Decrypt(key []byte, usage uint32, ciphertext []byte) ([]byte, error)
+
+	// ChecksumType returns the keyed checksum type associated with the
+	// encryption type.
+	ChecksumType() int32
+
+	// Checksum returns the keyed checksum of data for the given usage.
+	Checksum(key []byte, usage uint32, data []byte) []byte
+}
+
+// etypeFor returns the encryption type with the given number.
+func etypeFor(id int32) (etype, error) {
+	switch id {
+	case AES128CTSHMACSHA196:
+		return aesCTS{id: id, size: 16, cksum: cksumHMACSHA196AES128}, nil
+	case AES256CTSHMACSHA196:
+		return aesCTS{id: id, size: 32, cksum: cksumHMACSHA196AES256}, nil
+	case RC4HMAC:
+		return rc4HMAC{}, nil
+	}
+	return nil, ErrUnsupportedEType
+}
+
+// encrypt encrypts plaintext with key, returning the result as an
+// EncryptedData structure.
+func encrypt(key encryptionKey, usage uint32, plaintext []byte, kvno int) (encryptedData, error) {
+	e, err := etypeFor(key.KeyType)
+	if err != nil {
+		return encryptedData{}, err
+	}
+	c, err := e.Encrypt(key.KeyValue, usage, plaintext)
+	if err != nil {
+		return encryptedData{}, err
+	}
+	return encryptedData{EType: key.KeyType, KVNO: kvno, Cipher: c}, nil
+}
+
+// decrypt decrypts data with key.
+func decrypt(key encryptionKey, usage uint32, data encryptedData) ([]byte, error) {
+	if data.EType != key.KeyType {
+		return nil, ErrUnsupportedEType
+	}
+	e, err := etypeFor(key.KeyType)
+	if err != nil {
+		return nil, err
+	}
+	return e.Decrypt(key.KeyValue, usage, data.Cipher)
+}
+
+// randomKey returns a new random key of the given encryption type.
+func randomKey(id int32) (encryptionKey, error) {
+	e, err := etypeFor(id)
+	if err != nil {
+		return encryptionKey{}, err
+	}
+	k := make([]byte, e.KeySize())
+	if _, err := rand.Read(k); err != nil {
+		return encryptionKey{}, err
+	}
+	return encryptionKey{KeyType: id, KeyValue: k}, nil
+}
+
+// aesCTS implements the aes128-cts-hmac-sha1-96 and aes256-cts-hmac-sha1-96
+// encryption types described in RFC 3962.
+type aesCTS struct {
+	id    int32
+	size  int
+	cksum int32
+}
+
+func (e aesCTS) ID() int32           { return e.id }
+func (e aesCTS) KeySize() int        { return e.size }
+func (e aesCTS) ChecksumType() int32 { return e.cksum }
+
+func (e aesCTS) StringToKey(password, salt string, params []byte) ([]byte, error) {
+	iterations := 4096
+	if len(params) == 4 {
+		iterations = int(binary.BigEndian.Uint32(params))
+	}
+	tkey, err := pbkdf2.Key(sha1.New, password, []byte(salt), iterations, e.size)
+	if err != nil {
+		return nil, err
+	}
+	return e.derive(tkey, []byte("kerberos"))
+}
+
+// derive implements the DK function of RFC 3961, which derives a key from a
+// base key and a constant.
+func (e aesCTS) derive(key, constant []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, e.size+aes.BlockSize)
+	k := nfold(constant, aes.BlockSize)
+	for len(out) < e.size {
+		next := make([]byte, aes.BlockSize)
+		block.Encrypt(next, k)
+		out = append(out, next...)
+		k = next
+	}
+	return out[:e.size], nil
+}
+
+// usageKey derives the key for the given usage and purpose, which is 0xAA
+// for encryption, 0x55 for integrity and 0x99 for checksums.
+func (e aesCTS) usageKey(key []byte, usage uint32, purpose byte) ([]byte, error) {
+	var constant [5]byte
+	binary.BigEndian.PutUint32(constant[:], usage)
+	constant[4] = purpose
+	return e.derive(key, constant[:])
+}
+
+func (e aesCTS) Encrypt(key []byte, usage uint32, plaintext []byte) ([]byte, error) {
+	confounder := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(confounder); err != nil {
+		return nil, err
+	}
+	return e.encrypt(key, usage, confounder, plaintext)
+}
+
+func (e aesCTS) encrypt(key []byte, usage uint32, confounder, plaintext []byte) ([]byte, error) {
+	ke, err := e.usageKey(key, usage, 0xAA)
+	if err != nil {
+		return nil, err
+	}
+	ki, err := e.usageKey(key, usage, 0x55)
+	if err != nil {
+		return nil, err
+	}
+	msg := append(append([]byte(nil), confounder...), plaintext...)
+	mac := hmacSHA1(ki, msg)[:12]
+	c, err := encryptCTS(ke, msg)
+	if err != nil {
+		return nil, err
+	}
+	return append(c, mac...), nil
+}
+
+func (e aesCTS) Decrypt(key []byte, usage uint32, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < aes.BlockSize+12 {
+		return nil, ErrIntegrity
+	}
+	ke, err := e.usageKey(key, usage, 0xAA)
+	if err != nil {
+		return nil, err
+	}
+	ki, err := e.usageKey(key, usage, 0x55)
+	if err != nil {
+		return nil, err
+	}
+	c, mac := ciphertext[:len(ciphertext)-12], ciphertext[len(ciphertext)-12:]
+	msg, err := decryptCTS(ke, c)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(mac, hmacSHA1(ki, msg)[:12]) {
+		return nil, ErrIntegrity
+	}
+	return msg[aes.BlockSize:], nil
+}
+
+func (e aesCTS) Checksum(key []byte, usage uint32, data []byte) []byte {
+	kc, err := e.usageKey(key, usage, 0x99)
+	if err != nil {
+		return nil
+	}
+	return hmacSHA1(kc, data)[:12]
+}
+
+// encryptCTS encrypts msg with AES in CBC mode with ciphertext stealing and
+// a zero initialization vector, as described in RFC 3962.
+func encryptCTS(key, msg []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	n := len(msg)
+	if n < aes.BlockSize {
+		return nil, errors.New("kerberos: message too short for ciphertext stealing")
+	}
+	padded := make([]byte, (n+aes.BlockSize-1)/aes.BlockSize*aes.BlockSize)
+	copy(padded, msg)
+	cipher.NewCBCEncrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(padded, padded)
+	if len(padded) > aes.BlockSize {
+		// Swap the last two blocks and truncate the result.
+		last := len(padded) - aes.BlockSize
+		prev := last - aes.BlockSize
+		swapped := append(append(append([]byte(nil), padded[:prev]...), padded[last:]...), padded[prev:last]...)
+		padded = swapped
+	}
+	return padded[:n], nil
+}
+
+// decryptCTS reverses encryptCTS.
+func decryptCTS(key, c []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	n := len(c)
+	if n < aes.BlockSize {
+		return nil, ErrIntegrity
+	}
+	iv := make([]byte, aes.BlockSize)
+	if n == aes.BlockSize {
+		out := make([]byte, n)
+		block.Decrypt(out, c)
+		return out, nil
+	}
+	blocks := (n + aes.BlockSize - 1) / aes.BlockSize
+	prev := (blocks - 2) * aes.BlockSize
+	last := (blocks - 1) * aes.BlockSize
+	r := n - last
+
+	// The second to last block of the ciphertext was produced from the final
+	// block of plaintext. Decrypting it reveals the stolen ciphertext octets.
+	d := make([]byte, aes.BlockSize)
+	block.Decrypt(d, c[prev:last])
+	lastBlock := append(append([]byte(nil), c[last:]...), d[r:]...)
+
+	buf := make([]byte, 0, blocks*aes.BlockSize)
+	buf = append(buf, c[:prev]...)
+	buf = append(buf, lastBlock...)
+	buf = append(buf, c[prev:last]...)
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(buf, buf)
+	return buf[:n], nil
+}
+
+// nfold implements the n-fold function of RFC 3961, which stretches or
+// shrinks in to n octets.
+func nfold(in []byte, n int) []byte {
+	inBits, outBits := len(in)*8, n*8
+	lcm := inBits * outBits / gcd(inBits, outBits)
+
+	// Concatenate copies of the input, each rotated right by a further 13
+	// bits, until the length is a multiple of the output size.
+	buf := make([]byte, 0, lcm/8)
+	for i := 0; i < lcm/inBits; i++ {
+		buf = append(buf, rotateRight(in, 13*i)...)
+	}
+
+	// Add the output sized blocks with ones' complement addition.
+	out := make([]byte, n)
+	for i := 0; i < len(buf); i += n {
+		carry := 0
+		for j := n - 1; j >= 0; j-- {
+			sum := int(out[j]) + int(buf[i+j]) + carry
+			out[j], carry = byte(sum), sum>>8
+		}
+		// The carry out of the most significant octet wraps around.
+		for carry != 0 {
+			for j := n - 1; j >= 0 && carry != 0; j-- {
+				sum := int(out[j]) + carry
+				out[j], carry = byte(sum), sum>>8
+			}
+		}
+	}
+	return out
+}
+
+// rotateRight returns b rotated right by the given number of bits.
+func rotateRight(b []byte, bits int) []byte {
+	n := len(b) * 8
+	out := make([]byte, len(b))
+	for i := 0; i < n; i++ {
+		src := (i - bits%n + n) % n
+		if b[src/8]&(0x80>>uint(src%8)) != 0 {
+			out[i/8] |= 0x80 >> uint(i%8)
+		}
+	}
+	return out
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// rc4HMAC implements the rc4-hmac encryption type described in RFC 4757.
+type rc4HMAC struct{}
+
+func (rc4HMAC) ID() int32           { return RC4HMAC }
+func (rc4HMAC) KeySize() int        { return 16 }
+func (rc4HMAC) ChecksumType() int32 { return cksumHMACMD5 }
+
+// StringToKey returns the NT hash of password. The salt is not used.
+func (rc4HMAC) StringToKey(password, salt string, params []byte) ([]byte, error) {
+	return ntlm.NTHash(password), nil
+}
+
+// msUsage translates a key usage number into the message type used by
+// RFC 4757.
+func msUsage(usage uint32) []byte {
+	switch usage {
+	case usageASRepEncPart, 9: // AS-REP and TGS-REP with a subkey
+		usage = 8
+	case usageAcceptorSign:
+		usage = 13
+	}
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], usage)
+	return b[:]
+}
+
+func (e rc4HMAC) Encrypt(key []byte, usage uint32, plaintext []byte) ([]byte, error) {
+	confounder := make([]byte, 8)
+	if _, err := rand.Read(confounder); err != nil {
+		return nil, err
+	}
+	k1 := hmacMD5(key, msUsage(usage))
+	msg := append(confounder, plaintext...)
+	sum := hmacMD5(k1, msg)
+	k3 := hmacMD5(k1, sum)
+	c, _ := rc4.NewCipher(k3)
+	c.XORKeyStream(msg, msg)
+	return append(sum, msg...), nil
+}
+
+func (e rc4HMAC) Decrypt(key []byte, usage uint32, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < 16+8 {
+		return nil, ErrIntegrity
+	}
+	k1 := hmacMD5(key, msUsage(usage))
+	sum := ciphertext[:16]
+	k3 := hmacMD5(k1, sum)
+	msg := make([]byte, len(ciphertext)-16)
+	c, _ := rc4.NewCipher(k3)
+	c.XORKeyStream(msg, ciphertext[16:])
+	if !hmac.Equal(sum, hmacMD5(k1, msg)) {
+		return nil, ErrIntegrity
+	}
+	return msg[8:], nil
+}
+
+func (e rc4HMAC) Checksum(key []byte, usage uint32, data []byte) []byte {
+	ksign := hmacMD5(key, []byte("signaturekey\x00"))
+	h := md5.New()
+	h.Write(msUsage(usage))
+	h.Write(data)
+	return hmacMD5(ksign, h.Sum(nil))
+}
+
+func hmacSHA1(key []byte, data ...[]byte) []byte {
+	h := hmac.New(sha1.New, key)
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+func hmacMD5(key []byte, data ...[]byte) []byte {
+	h := hmac.New(md5.New, key)
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
@@ -0,0 +1,436 @@
+package kerberos
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rc4"
+	"encoding/asn1"
+	"encoding/binary"
+	"sync"
+
+	"github.com/gentlemanautomaton/dcerpc/security"
+)
+
+// OID is the object identifier of the Kerberos V5 GSS-API mechanism.
+var OID = asn1.ObjectIdentifier{1, 2, 840, 113554, 1, 2, 2}
+
+// Token identifiers of context establishment tokens.
+const (
+	tokAPReq = 0x0100
+	tokAPRep = 0x0200
+)
+
+// Flags carried by the GSS-API checksum of an authenticator.
+const (
+	gssMutual    = 0x0002
+	gssReplay    = 0x0004
+	gssSequence  = 0x0008
+	gssConf      = 0x0010
+	gssInteg     = 0x0020
+	gssDCEStyle  = 0x1000
+	gssCksumSize = 24
+)
+
+// Flags carried by RFC 4121 per-message tokens.
+const (
+	tokenSentByAcceptor = 0x01
+	tokenSealed         = 0x02
+	tokenAcceptorSubkey = 0x04
+)
+
+// Sizes of the per-message tokens produced by a context.
+const (
+	aesMICSize  = 16 + 12
+	aesWrapRRC  = 16 + 12
+	aesWrapSize = 16 + aesWrapRRC + 16
+	rc4MICSize  = 24
+	rc4WrapSize = 32
+)
+
+// frame wraps a context establishment token in the framing described by
+// section 3.1 of RFC 2743.
+func frame(tokID uint16, body []byte) []byte {
+	oid, _ := asn1.Marshal(OID)
+	inner := make([]byte, 0, len(oid)+2+len(body))
+	inner = append(inner, oid...)
+	inner = append(inner, byte(tokID>>8), byte(tokID))
+	inner = append(inner, body...)
+	b, _ := asn1.Marshal(asn1.RawValue{Class: asn1.ClassApplication, Tag: 0, IsCompound: true, Bytes: inner})
+	return b
+}
+
+// unframe returns the body of a framed context establishment token.
+func unframe(tokID uint16, b []byte) ([]byte, error) {
+	var raw asn1.RawValue
+	if _, err := asn1.Unmarshal(b, &raw); err != nil || raw.Class != asn1.ClassApplication || raw.Tag != 0 {
+		return nil, security.ErrInvalidToken
+	}
+	var oid asn1.ObjectIdentifier
+	rest, err := asn1.Unmarshal(raw.Bytes, &oid)
+	if err != nil || !oid.Equal(OID) || len(rest) < 2 || binary.BigEndian.Uint16(rest) != tokID {
+		return nil, security.ErrInvalidToken
+	}
+	return rest[2:], nil
+}
+
+// gssChecksum returns the checksum carried by the authenticator of an
+// initial context token, as described in section 4.1.1 of RFC 4121.
+func gssChecksum(flags uint32) checksum {
+	b := make([]byte, gssCksumSize)
+	binary.LittleEndian.PutUint32(b, 16) // Length of the channel binding
+	binary.LittleEndian.PutUint32(b[20:], flags)
+	return checksum{CksumType: cksumGSSAPI, Checksum: b}
+}
+
+// session protects messages with an established Kerberos context. It
+// implements security.Context with the per-message tokens described by
+// RFC 4121, or by RFC 4757 when the context key is an rc4-hmac key.
+//
+// Tokens are produced in the DCE style used by MS-RPCE: the stub data is
+// sealed in place and the remainder of the token forms the signature.
+type session struct {
+	mutex sync.Mutex
+
+	established    bool
+	initiator      bool
+	acceptorSubkey bool
+	sealed         bool
+	key            encryptionKey
+	e              etype
+	sendSeq        uint64
+	recvSeq        uint64
+
+	// Keys derived for the aes encryption types.
+	signKey, verifyKey         []byte
+	sealEncKey, sealIntKey     []byte
+	unsealEncKey, unsealIntKey []byte
+}
+
+// init prepares the session to protect messages with key.
+func (s *session) init(key encryptionKey, initiator, acceptorSubkey bool, level security.Level, sendSeq, recvSeq uint64) error {
+	e, err := etypeFor(key.KeyType)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.key, s.e = key, e
+	s.initiator, s.acceptorSubkey, s.sealed = initiator, acceptorSubkey, level.Sealed()
+	s.sendSeq, s.recvSeq = sendSeq, recvSeq
+
+	if aes, ok := e.(aesCTS); ok {
+		sendSign, recvSign := uint32(usageInitiatorSign), uint32(usageAcceptorSign)
+		sendSeal, recvSeal := uint32(usageInitiatorSeal), uint32(usageAcceptorSeal)
+		if !initiator {
+			sendSign, recvSign = recvSign, sendSign
+			sendSeal, recvSeal = recvSeal, sendSeal
+		}
+		derive := func(usage uint32, purpose byte) []byte {
+			if err == nil {
+				var k []byte
+				k, err = aes.usageKey(key.KeyValue, usage, purpose)
+				return k
+			}
+			return nil
+		}
+		s.signKey = derive(sendSign, 0x99)
+		s.verifyKey = derive(recvSign, 0x99)
+		s.sealEncKey = derive(sendSeal, 0xAA)
+		s.sealIntKey = derive(sendSeal, 0x55)
+		s.unsealEncKey = derive(recvSeal, 0xAA)
+		s.unsealIntKey = derive(recvSeal, 0x55)
+		if err != nil {
+			return err
+		}
+	}
+	s.established = true
+	return nil
+}
+
+// SignatureSize returns the size of the tokens produced by the session.
+func (s *session) SignatureSize() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	rc4 := s.key.KeyType == RC4HMAC
+	switch {
+	case rc4 && s.sealed:
+		return rc4WrapSize
+	case rc4:
+		return rc4MICSize
+	case s.sealed:
+		return aesWrapSize
+	}
+	return aesMICSize
+}
+
+// tokenFlags returns the flags of the tokens sent by the session.
+func (s *session) tokenFlags(sealed bool) byte {
+	var flags byte
+	if !s.initiator {
+		flags |= tokenSentByAcceptor
+	}
+	if sealed {
+		flags |= tokenSealed
+	}
+	if s.acceptorSubkey {
+		flags |= tokenAcceptorSubkey
+	}
+	return flags
+}
+
+// header returns the header of an RFC 4121 token.
+func (s *session) header(tokID uint16, flags byte, rrc uint16, seq uint64) []byte {
+	h := make([]byte, 16)
+	binary.BigEndian.PutUint16(h, tokID)
+	h[2] = flags
+	for i := 3; i < 8; i++ {
+		h[i] = 0xff
+	}
+	if tokID == 0x0504 {
+		h[4], h[5] = 0, 0 // EC
+		binary.BigEndian.PutUint16(h[6:], rrc)
+	}
+	binary.BigEndian.PutUint64(h[8:], seq)
+	return h
+}
+
+// checkHeader verifies that the header of a received RFC 4121 token matches
+// the expected token identifier, flags and sequence number.
+func (s *session) checkHeader(h []byte, tokID uint16, sealed bool) error {
+	flags := s.tokenFlags(sealed) ^ tokenSentByAcceptor
+	if binary.BigEndian.Uint16(h) != tokID || h[2] != flags || h[3] != 0xff {
+		return security.ErrInvalidSignature
+	}
+	if binary.BigEndian.Uint64(h[8:]) != s.recvSeq {
+		return security.ErrInvalidSignature
+	}
+	return nil
+}
+
+// Sign returns a MIC token for msg.
+func (s *session) Sign(msg []byte) ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.established {
+		return nil, security.ErrContextIncomplete
+	}
+	seq := s.sendSeq
+	s.sendSeq++
+	if s.key.KeyType == RC4HMAC {
+		return s.rc4Sign(msg, seq), nil
+	}
+	h := s.header(0x0404, s.tokenFlags(false), 0, seq)
+	return append(h, hmacSHA1(s.signKey, msg, h)[:12]...), nil
+}
+
+// Verify checks that signature is a valid MIC token for msg.
+func (s *session) Verify(msg, signature []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.established {
+		return security.ErrContextIncomplete
+	}
+	if s.key.KeyType == RC4HMAC {
+		if err := s.rc4Verify(msg, signature); err != nil {
+			return err
+		}
+		s.recvSeq++
+		return nil
+	}
+	if len(signature) != aesMICSize {
+		return security.ErrInvalidSignature
+	}
+	h := signature[:16]
+	if err := s.checkHeader(h, 0x0404, false); err != nil {
+		return err
+	}
+	if !hmac.Equal(signature[16:], hmacSHA1(s.verifyKey, msg, h)[:12]) {
+		return security.ErrInvalidSignature
+	}
+	s.recvSeq++
+	return nil
+}
+
+// Seal encrypts data in place and returns the remainder of a wrap token,
+// whose integrity protection covers all of msg.
+func (s *session) Seal(msg, data []byte) ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.established {
+		return nil, security.ErrContextIncomplete
+	}
+	seq := s.sendSeq
+	s.sendSeq++
+	if s.key.KeyType == RC4HMAC {
+		return s.rc4Seal(msg, data, seq)
+	}
+
+	// The token is the header followed by the encrypted confounder, data
+	// and header copy, and then the checksum, rotated right by RRC octets
+	// so that the encrypted data ends the token.
+	h := s.header(0x0504, s.tokenFlags(true), aesWrapRRC, seq)
+	inner := s.header(0x0504, s.tokenFlags(true), 0, seq)
+	confounder := make([]byte, 16)
+	if _, err := rand.Read(confounder); err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, 0, 32+len(data))
+	plaintext = append(append(append(plaintext, confounder...), data...), inner...)
+	c, err := encryptCTS(s.sealEncKey, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	c = append(c, hmacSHA1(s.sealIntKey, confounder, msg, inner)[:12]...)
+	rotated := make([]byte, 0, len(c))
+	rotated = append(append(rotated, c[len(c)-aesWrapRRC:]...), c[:len(c)-aesWrapRRC]...)
+
+	sig := append(h, rotated[:aesWrapSize-16]...)
+	copy(data, rotated[aesWrapSize-16:])
+	return sig, nil
+}
+
+// Unseal decrypts data in place and checks the integrity of msg.
+func (s *session) Unseal(msg, data, signature []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.established {
+		return security.ErrContextIncomplete
+	}
+	if s.key.KeyType == RC4HMAC {
+		if err := s.rc4Unseal(msg, data, signature); err != nil {
+			return err
+		}
+		s.recvSeq++
+		return nil
+	}
+	if len(signature) != aesWrapSize {
+		return security.ErrInvalidSignature
+	}
+	h := signature[:16]
+	if err := s.checkHeader(h, 0x0504, true); err != nil {
+		return err
+	}
+	if binary.BigEndian.Uint16(h[6:]) != aesWrapRRC {
+		return security.ErrInvalidSignature
+	}
+	rotated := append(append([]byte(nil), signature[16:]...), data...)
+	c := make([]byte, 0, len(rotated))
+	c = append(append(c, rotated[aesWrapRRC:]...), rotated[:aesWrapRRC]...)
+	mac := c[len(c)-12:]
+	plaintext, err := decryptCTS(s.unsealEncKey, c[:len(c)-12])
+	if err != nil {
+		return security.ErrInvalidSignature
+	}
+	confounder, inner := plaintext[:16], plaintext[len(plaintext)-16:]
+	expected := append([]byte(nil), h...)
+	expected[6], expected[7] = 0, 0
+	if !bytes.Equal(inner, expected) {
+		return security.ErrInvalidSignature
+	}
+	copy(data, plaintext[16:len(plaintext)-16])
+	if !hmac.Equal(mac, hmacSHA1(s.unsealIntKey, confounder, msg, inner)[:12]) {
+		return security.ErrInvalidSignature
+	}
+	s.recvSeq++
+	return nil
+}
+
+// rc4Sign returns an RFC 4757 MIC token for msg.
+func (s *session) rc4Sign(msg []byte, seq uint64) []byte {
+	h := []byte{0x01, 0x01, 0x11, 0x00, 0xff, 0xff, 0xff, 0xff}
+	sum := s.rc4Checksum(15, h, nil, msg)
+	return append(append(h, s.rc4SeqNumber(sum, seq, s.initiator)...), sum...)
+}
+
+// rc4Verify checks that signature is a valid RFC 4757 MIC token for msg.
+func (s *session) rc4Verify(msg, signature []byte) error {
+	if len(signature) != rc4MICSize || !bytes.Equal(signature[:8], []byte{0x01, 0x01, 0x11, 0x00, 0xff, 0xff, 0xff, 0xff}) {
+		return security.ErrInvalidSignature
+	}
+	sum := signature[16:24]
+	if !bytes.Equal(signature[8:16], s.rc4SeqNumber(sum, s.recvSeq, !s.initiator)) {
+		return security.ErrInvalidSignature
+	}
+	if !hmac.Equal(sum, s.rc4Checksum(15, signature[:8], nil, msg)) {
+		return security.ErrInvalidSignature
+	}
+	return nil
+}
+
+// rc4Seal encrypts data in place and returns an RFC 4757 wrap token for
+// msg without its data.
+func (s *session) rc4Seal(msg, data []byte, seq uint64) ([]byte, error) {
+	h := []byte{0x02, 0x01, 0x11, 0x00, 0x10, 0x00, 0xff, 0xff}
+	confounder := make([]byte, 8)
+	if _, err := rand.Read(confounder); err != nil {
+		return nil, err
+	}
+	sum := s.rc4Checksum(13, h, confounder, msg)
+	c := s.rc4Cipher(seq)
+	c.XORKeyStream(confounder, confounder)
+	c.XORKeyStream(data, data)
+	sig := append(append(h, s.rc4SeqNumber(sum, seq, s.initiator)...), sum...)
+	return append(sig, confounder...), nil
+}
+
+// rc4Unseal decrypts data in place and checks the RFC 4757 wrap token for
+// msg.
+func (s *session) rc4Unseal(msg, data, signature []byte) error {
+	if len(signature) != rc4WrapSize || !bytes.Equal(signature[:8], []byte{0x02, 0x01, 0x11, 0x00, 0x10, 0x00, 0xff, 0xff}) {
+		return security.ErrInvalidSignature
+	}
+	sum := signature[16:24]
+	if !bytes.Equal(signature[8:16], s.rc4SeqNumber(sum, s.recvSeq, !s.initiator)) {
+		return security.ErrInvalidSignature
+	}
+	confounder := append([]byte(nil), signature[24:32]...)
+	c := s.rc4Cipher(s.recvSeq)
+	c.XORKeyStream(confounder, confounder)
+	c.XORKeyStream(data, data)
+	if !hmac.Equal(sum, s.rc4Checksum(13, signature[:8], confounder, msg)) {
+		return security.ErrInvalidSignature
+	}
+	return nil
+}
+
+// rc4Checksum computes the checksum of an RFC 4757 token.
+func (s *session) rc4Checksum(usage uint32, header, confounder, msg []byte) []byte {
+	ksign := hmacMD5(s.key.KeyValue, []byte("signaturekey\x00"))
+	var u [4]byte
+	binary.LittleEndian.PutUint32(u[:], usage)
+	h := md5.New()
+	h.Write(u[:])
+	h.Write(header)
+	h.Write(confounder)
+	h.Write(msg)
+	return hmacMD5(ksign, h.Sum(nil))[:8]
+}
+
+// rc4SeqNumber returns the encrypted sequence number of an RFC 4757 token.
+func (s *session) rc4SeqNumber(sum []byte, seq uint64, initiator bool) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint32(b, uint32(seq))
+	if !initiator {
+		copy(b[4:], []byte{0xff, 0xff, 0xff, 0xff})
+	}
+	kseq := hmacMD5(hmacMD5(s.key.KeyValue, make([]byte, 4)), sum)
+	c, _ := rc4.NewCipher(kseq)
+	c.XORKeyStream(b, b)
+	return b
+}
+
+// rc4Cipher returns the cipher used to encrypt the data of an RFC 4757 wrap
+// token with the given sequence number.
+func (s *session) rc4Cipher(seq uint64) *rc4.Cipher {
+	klocal := make([]byte, len(s.key.KeyValue))
+	for i, b := range s.key.KeyValue {
+		klocal[i] = b ^ 0xf0
+	}
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(seq))
+	kcrypt := hmacMD5(hmacMD5(klocal, make([]byte, 4)), b[:])
+	c, _ := rc4.NewCipher(kcrypt)
+	return c
+}
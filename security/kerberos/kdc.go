@@ -0,0 +1,313 @@
+package kerberos
+
+import (
+	"crypto/rand"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"time"
+)
+
+// ticketLifetime is the lifetime requested for tickets.
+const ticketLifetime = 10 * time.Hour
+
+// ErrNoKDC is returned when a client needs to contact a KDC but none has been
+// configured for the realm.
+var ErrNoKDC = errors.New("kerberos: no KDC is configured for the realm")
+
+// Error is a KRB-ERROR message returned by a KDC.
+type Error struct {
+	Code int32
+	Text string
+}
+
+func (e *Error) Error() string {
+	if e.Text != "" {
+		return fmt.Sprintf("kerberos: KDC returned error %d: %s", e.Code, e.Text)
+	}
+	return fmt.Sprintf("kerberos: KDC returned error %d", e.Code)
+}
+
+// KDC sends requests to the key distribution center of a realm.
+type KDC interface {
+	// Exchange sends the DER encoded request to the KDC of the given realm
+	// and returns its DER encoded reply.
+	Exchange(realm string, req []byte) ([]byte, error)
+}
+
+// KDCFunc is a function that implements the KDC interface.
+type KDCFunc func(realm string, req []byte) ([]byte, error)
+
+// Exchange calls f(realm, req).
+func (f KDCFunc) Exchange(realm string, req []byte) ([]byte, error) {
+	return f(realm, req)
+}
+
+// NetKDC is a KDC that sends requests over TCP. It maps realm names to the
+// host:port addresses of their KDCs.
+type NetKDC map[string]string
+
+// Exchange sends req to the KDC of realm over TCP.
+func (m NetKDC) Exchange(realm string, req []byte) ([]byte, error) {
+	addr, ok := m[realm]
+	if !ok {
+		return nil, ErrNoKDC
+	}
+	conn, err := net.DialTimeout("tcp", addr, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	// Each message is preceded by its length.
+	msg := make([]byte, 4+len(req))
+	binary.BigEndian.PutUint32(msg, uint32(len(req)))
+	copy(msg[4:], req)
+	if _, err := conn.Write(msg); err != nil {
+		return nil, err
+	}
+	var length [4]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(length[:])
+	if n > 1<<20 {
+		return nil, errors.New("kerberos: KDC reply is too large")
+	}
+	reply := make([]byte, n)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// credential is a ticket and its session key.
+type credential struct {
+	ticket  []byte // The DER encoded ticket
+	key     encryptionKey
+	crealm  string
+	cname   principalName
+	endTime time.Time
+}
+
+// asExchange obtains a ticket for service from the authentication service,
+// using pre-authentication if the KDC requires it.
+func asExchange(kdc KDC, creds *Credentials, service string, now time.Time) (*credential, error) {
+	till, _ := kerberosTime(now.Add(ticketLifetime))
+	req := kdcReq{
+		PVNO:    pvno,
+		MsgType: tagASReq,
+		ReqBody: kdcReqBody{
+			KDCOptions: flags(),
+			CName:      newPrincipalName(creds.User),
+			Realm:      creds.Realm,
+			SName:      newPrincipalName(service),
+			Till:       till,
+			Nonce:      nonce(),
+			EType:      defaultETypes,
+		},
+	}
+	reply, kerr, err := sendKDCReq(kdc, creds.Realm, &req, tagASReq)
+	if err != nil {
+		return nil, err
+	}
+
+	var key encryptionKey
+	if kerr != nil {
+		if kerr.ErrorCode != errPreauthRequired {
+			return nil, kerr.err()
+		}
+		// Prove knowledge of the client's key by encrypting a timestamp
+		// with the key described by the KDC.
+		var methods []paData
+		if _, err := asn1.Unmarshal(kerr.EData, &methods); err != nil {
+			return nil, err
+		}
+		if key, err = creds.key(methods, 0); err != nil {
+			return nil, err
+		}
+		ts, usec := kerberosTime(now)
+		pa, err := marshal(paEncTSEnc{PATimestamp: ts, PAUSec: usec}, 0)
+		if err != nil {
+			return nil, err
+		}
+		data, err := encrypt(key, usageASReqTimestamp, pa, 0)
+		if err != nil {
+			return nil, err
+		}
+		if pa, err = marshal(data, 0); err != nil {
+			return nil, err
+		}
+		req.PAData = []paData{{Type: paEncTS, Value: pa}}
+		if reply, kerr, err = sendKDCReq(kdc, creds.Realm, &req, tagASReq); err != nil {
+			return nil, err
+		}
+		if kerr != nil {
+			return nil, kerr.err()
+		}
+	}
+
+	var rep kdcRep
+	if err := unmarshal(reply, &rep, tagASRep); err != nil {
+		return nil, err
+	}
+	if key.KeyValue == nil {
+		if key, err = creds.key(rep.PAData, rep.EncPart.EType); err != nil {
+			return nil, err
+		}
+	}
+	return readKDCRep(&rep, key, usageASRepEncPart, req.ReqBody.Nonce)
+}
+
+// tgsExchange obtains a ticket for service from the ticket granting service,
+// using the ticket granting ticket tgt.
+func tgsExchange(kdc KDC, tgt *credential, realm, service string, now time.Time) (*credential, error) {
+	till, _ := kerberosTime(now.Add(ticketLifetime))
+	req := kdcReq{
+		PVNO:    pvno,
+		MsgType: tagTGSReq,
+		ReqBody: kdcReqBody{
+			KDCOptions: flags(),
+			Realm:      realm,
+			SName:      newPrincipalName(service),
+			Till:       till,
+			Nonce:      nonce(),
+			EType:      defaultETypes,
+		},
+	}
+	body, err := marshal(req.ReqBody, 0)
+	if err != nil {
+		return nil, err
+	}
+	e, err := etypeFor(tgt.key.KeyType)
+	if err != nil {
+		return nil, err
+	}
+	sum := checksum{
+		CksumType: e.ChecksumType(),
+		Checksum:  e.Checksum(tgt.key.KeyValue, usageTGSReqChecksum, body),
+	}
+	ap, err := newAPReq(tgt, usageTGSReqAuthenticator, flags(), func(a *authenticator) {
+		a.Cksum = sum
+	}, now)
+	if err != nil {
+		return nil, err
+	}
+	req.PAData = []paData{{Type: paTGSReq, Value: ap}}
+
+	reply, kerr, err := sendKDCReq(kdc, realm, &req, tagTGSReq)
+	if err != nil {
+		return nil, err
+	}
+	if kerr != nil {
+		return nil, kerr.err()
+	}
+	var rep kdcRep
+	if err := unmarshal(reply, &rep, tagTGSRep); err != nil {
+		return nil, err
+	}
+	return readKDCRep(&rep, tgt.key, usageTGSRepEncPart, req.ReqBody.Nonce)
+}
+
+// newAPReq returns a DER encoded AP-REQ that presents the ticket of cred.
+// The authenticator may be customized by the given function before it is
+// encrypted with the key usage.
+func newAPReq(cred *credential, usage uint32, options asn1.BitString, customize func(*authenticator), now time.Time) ([]byte, error) {
+	ctime, cusec := kerberosTime(now)
+	a := authenticator{
+		AVNO:   pvno,
+		CRealm: cred.crealm,
+		CName:  cred.cname,
+		CUSec:  cusec,
+		CTime:  ctime,
+	}
+	if customize != nil {
+		customize(&a)
+	}
+	b, err := marshal(a, tagAuthenticator)
+	if err != nil {
+		return nil, err
+	}
+	data, err := encrypt(cred.key, usage, b, 0)
+	if err != nil {
+		return nil, err
+	}
+	return marshal(apReq{
+		PVNO:          pvno,
+		MsgType:       tagAPReq,
+		APOptions:     options,
+		Ticket:        explicit(3, cred.ticket),
+		Authenticator: data,
+	}, tagAPReq)
+}
+
+// sendKDCReq sends req to the KDC of realm. If the KDC replies with an error
+// message it is returned as kerr.
+func sendKDCReq(kdc KDC, realm string, req *kdcReq, tag int) (reply []byte, kerr *krbError, err error) {
+	if kdc == nil {
+		return nil, nil, ErrNoKDC
+	}
+	b, err := marshal(*req, tag)
+	if err != nil {
+		return nil, nil, err
+	}
+	if reply, err = kdc.Exchange(realm, b); err != nil {
+		return nil, nil, err
+	}
+	if applicationTag(reply) == tagKRBError {
+		kerr = new(krbError)
+		if err := unmarshal(reply, kerr, tagKRBError); err != nil {
+			return nil, nil, err
+		}
+		return nil, kerr, nil
+	}
+	return reply, nil, nil
+}
+
+// readKDCRep decrypts the encrypted part of rep with key and returns the
+// credential that it describes.
+func readKDCRep(rep *kdcRep, key encryptionKey, usage uint32, nonce int) (*credential, error) {
+	b, err := decrypt(key, usage, rep.EncPart)
+	if err != nil {
+		return nil, err
+	}
+	// Some KDCs use the tag for an encrypted AS-REP part in TGS-REP
+	// messages and vice versa, so either is accepted.
+	tag := applicationTag(b)
+	if tag != tagEncASRepPart && tag != tagEncTGSRepPart {
+		return nil, errors.New("kerberos: invalid encrypted KDC reply")
+	}
+	var part encKDCRepPart
+	if err := unmarshal(b, &part, tag); err != nil {
+		return nil, err
+	}
+	if part.Nonce != nonce {
+		return nil, errors.New("kerberos: KDC reply does not match the request")
+	}
+	return &credential{
+		ticket:  rep.Ticket.Bytes,
+		key:     part.Key,
+		crealm:  rep.CRealm,
+		cname:   rep.CName,
+		endTime: part.EndTime,
+	}, nil
+}
+
+// err returns the error described by e.
+func (e *krbError) err() error {
+	return &Error{Code: e.ErrorCode, Text: e.EText}
+}
+
+// nonce returns a random nonce.
+func nonce() int {
+	n, err := rand.Int(rand.Reader, big.NewInt(1<<31-1))
+	if err != nil {
+		return int(time.Now().UnixNano() & 0x7fffffff)
+	}
+	return int(n.Int64())
+}
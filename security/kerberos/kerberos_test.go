@@ -0,0 +1,475 @@
+package kerberos
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gentlemanautomaton/dcerpc/security"
+)
+
+func TestNFold(t *testing.T) {
+	tests := []struct {
+		in  string
+		n   int
+		out string
+	}{
+		{"012345", 8, "be072631276b1955"},
+		{"password", 7, "78a07b6caf85fa"},
+		{"Rough Consensus, and Running Code", 8, "bb6ed30870b7f0e0"},
+		{"kerberos", 16, "6b65726265726f737b9b5b2b93132b93"},
+	}
+	for _, test := range tests {
+		if got := hex.EncodeToString(nfold([]byte(test.in), test.n)); got != test.out {
+			t.Errorf("nfold(%q, %d) = %s, want %s", test.in, test.n, got, test.out)
+		}
+	}
+}
+
+// TestStringToKey checks key derivation against the test vectors in
+// appendix B of RFC 3962.
+func TestStringToKey(t *testing.T) {
+	tests := []struct {
+		etype      int32
+		iterations []byte
+		out        string
+	}{
+		{AES128CTSHMACSHA196, []byte{0, 0, 0, 1}, "42263c6e89f4fc28b8df68ee09799f15"},
+		{AES256CTSHMACSHA196, []byte{0, 0, 0, 1}, "fe697b52bc0d3ce14432ba036a92e65bbb52280990a2fa27883998d72af30161"},
+		{AES128CTSHMACSHA196, []byte{0, 0, 0, 2}, "c651bf29e2300ac27fa469d693bdda13"},
+	}
+	for _, test := range tests {
+		e, err := etypeFor(test.etype)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := e.StringToKey("password", "ATHENA.MIT.EDUraeburn", test.iterations)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := hex.EncodeToString(key); got != test.out {
+			t.Errorf("etype %d: got %s, want %s", test.etype, got, test.out)
+		}
+	}
+}
+
+// TestCTS checks ciphertext stealing against the test vectors in appendix B
+// of RFC 3962.
+func TestCTS(t *testing.T) {
+	key := []byte("chicken teriyaki")
+	tests := []struct {
+		in, out string
+	}{
+		{"I would like the ", "c6353568f2bf8cb4d8a580362da7ff7f97"},
+		{"I would like the General Gau's ", "fc00783e0efdb2c1d445d4c8eff7ed2297687268d6ecccc0c07b25e25ecfe5"},
+		{"I would like the General Gau's C", "39312523a78662d5be7fcbcc98ebf5a897687268d6ecccc0c07b25e25ecfe584"},
+	}
+	for _, test := range tests {
+		c, err := encryptCTS(key, []byte(test.in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := hex.EncodeToString(c); got != test.out {
+			t.Errorf("encrypt %q: got %s, want %s", test.in, got, test.out)
+		}
+		p, err := decryptCTS(key, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(p) != test.in {
+			t.Errorf("decrypt: got %q, want %q", p, test.in)
+		}
+	}
+}
+
+func TestEncrypt(t *testing.T) {
+	plaintext := []byte("a message that spans more than one block")
+	for _, id := range defaultETypes {
+		key, err := randomKey(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := encrypt(key, usageTicket, plaintext, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := decrypt(key, usageTicket, data)
+		if err != nil {
+			t.Fatalf("etype %d: %v", id, err)
+		}
+		if !bytes.Equal(out, plaintext) {
+			t.Fatalf("etype %d: got %q", id, out)
+		}
+		if _, err := decrypt(key, usageAPRepEncPart, data); err != ErrIntegrity {
+			t.Fatalf("etype %d: decrypt with the wrong usage returned %v", id, err)
+		}
+	}
+}
+
+func TestKeytab(t *testing.T) {
+	var kt Keytab
+	if err := kt.AddPassword("host/server.example.com", "EXAMPLE.COM", "secret", 3); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseKeytab(kt.Marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed.Entries) != len(kt.Entries) {
+		t.Fatalf("parsed %d entries, want %d", len(parsed.Entries), len(kt.Entries))
+	}
+	for i, e := range parsed.Entries {
+		want := kt.Entries[i]
+		if e.Principal != want.Principal || e.Realm != want.Realm || e.KVNO != want.KVNO || e.EType != want.EType || !bytes.Equal(e.Key, want.Key) || e.Timestamp.Unix() != want.Timestamp.Unix() {
+			t.Errorf("entry %d: got %+v, want %+v", i, e, want)
+		}
+	}
+	if _, ok := parsed.key("HOST/server.example.com", "example.com", 0, RC4HMAC); !ok {
+		t.Error("key lookup failed")
+	}
+}
+
+// testKDC is a stand-in KDC that issues tickets for a single realm. It
+// requires clients to pre-authenticate.
+type testKDC struct {
+	realm    string
+	users    map[string]string
+	krbtgt   encryptionKey
+	services *Keytab
+}
+
+func newTestKDC(t *testing.T, realm string, services *Keytab) *testKDC {
+	krbtgt, err := randomKey(AES256CTSHMACSHA196)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testKDC{
+		realm:    realm,
+		users:    map[string]string{"alice": "wonderland"},
+		krbtgt:   krbtgt,
+		services: services,
+	}
+}
+
+func (k *testKDC) Exchange(realm string, req []byte) ([]byte, error) {
+	if realm != k.realm {
+		return nil, errors.New("unknown realm")
+	}
+	switch applicationTag(req) {
+	case tagASReq:
+		return k.as(req)
+	case tagTGSReq:
+		return k.tgs(req)
+	}
+	return nil, errors.New("unexpected request")
+}
+
+func (k *testKDC) as(b []byte) ([]byte, error) {
+	var req kdcReq
+	if err := unmarshal(b, &req, tagASReq); err != nil {
+		return nil, err
+	}
+	user := req.ReqBody.CName.String()
+	password, ok := k.users[user]
+	if !ok {
+		return k.error(6) // KDC_ERR_C_PRINCIPAL_UNKNOWN
+	}
+	salt := k.realm + user
+	e, _ := etypeFor(req.ReqBody.EType[0])
+	userKey, err := e.StringToKey(password, salt, nil)
+	if err != nil {
+		return nil, err
+	}
+	key := encryptionKey{KeyType: e.ID(), KeyValue: userKey}
+
+	var ts []byte
+	for _, pa := range req.PAData {
+		if pa.Type == paEncTS {
+			ts = pa.Value
+		}
+	}
+	if ts == nil {
+		info, _ := marshal([]etypeInfo2Entry{{EType: e.ID(), Salt: salt}}, 0)
+		edata, _ := marshal([]paData{{Type: paETypeInfo2, Value: info}}, 0)
+		return k.errorWithData(errPreauthRequired, edata)
+	}
+	var data encryptedData
+	if _, err := asn1.Unmarshal(ts, &data); err != nil {
+		return nil, err
+	}
+	if _, err := decrypt(key, usageASReqTimestamp, data); err != nil {
+		return k.error(errPreauthFailed)
+	}
+	return k.issue(&req, tagASRep, tagEncASRepPart, key, usageASRepEncPart, k.krbtgt, 1)
+}
+
+func (k *testKDC) tgs(b []byte) ([]byte, error) {
+	var req kdcReq
+	if err := unmarshal(b, &req, tagTGSReq); err != nil {
+		return nil, err
+	}
+	var ap apReq
+	if len(req.PAData) != 1 || req.PAData[0].Type != paTGSReq {
+		return nil, errors.New("missing PA-TGS-REQ")
+	}
+	if err := unmarshal(req.PAData[0].Value, &ap, tagAPReq); err != nil {
+		return nil, err
+	}
+	var tgt ticket
+	if err := unmarshal(ap.Ticket.Bytes, &tgt, tagTicket); err != nil {
+		return nil, err
+	}
+	plain, err := decrypt(k.krbtgt, usageTicket, tgt.EncPart)
+	if err != nil {
+		return nil, err
+	}
+	var part encTicketPart
+	if err := unmarshal(plain, &part, tagEncTicketPart); err != nil {
+		return nil, err
+	}
+	if plain, err = decrypt(part.Key, usageTGSReqAuthenticator, ap.Authenticator); err != nil {
+		return nil, err
+	}
+	var a authenticator
+	if err := unmarshal(plain, &a, tagAuthenticator); err != nil {
+		return nil, err
+	}
+	body, _ := marshal(req.ReqBody, 0)
+	e, _ := etypeFor(part.Key.KeyType)
+	if a.Cksum.CksumType != e.ChecksumType() || !bytes.Equal(a.Cksum.Checksum, e.Checksum(part.Key.KeyValue, usageTGSReqChecksum, body)) {
+		return nil, errors.New("bad request checksum")
+	}
+	req.ReqBody.CName, req.ReqBody.Realm = part.CName, part.CRealm
+
+	var serviceKey encryptionKey
+	var kvno uint32
+	for _, entry := range k.services.Entries {
+		if entry.Principal == req.ReqBody.SName.String() {
+			serviceKey, kvno = encryptionKey{KeyType: entry.EType, KeyValue: entry.Key}, entry.KVNO
+			break
+		}
+	}
+	if serviceKey.KeyValue == nil {
+		return k.error(7) // KDC_ERR_S_PRINCIPAL_UNKNOWN
+	}
+	return k.issue(&req, tagTGSRep, tagEncTGSRepPart, part.Key, usageTGSRepEncPart, serviceKey, int(kvno))
+}
+
+// issue returns a reply that grants the client a ticket encrypted with
+// serviceKey. The reply is encrypted with replyKey.
+func (k *testKDC) issue(req *kdcReq, tag, partTag int, replyKey encryptionKey, usage uint32, serviceKey encryptionKey, kvno int) ([]byte, error) {
+	sessionKey, err := randomKey(serviceKey.KeyType)
+	if err != nil {
+		return nil, err
+	}
+	now, _ := kerberosTime(time.Now())
+	end := now.Add(time.Hour)
+	tp, err := marshal(encTicketPart{
+		Flags:     flags(),
+		Key:       sessionKey,
+		CRealm:    k.realm,
+		CName:     req.ReqBody.CName,
+		AuthTime:  now,
+		EndTime:   end,
+		Transited: transitedEncoding{Contents: []byte{}},
+	}, tagEncTicketPart)
+	if err != nil {
+		return nil, err
+	}
+	enc, err := encrypt(serviceKey, usageTicket, tp, kvno)
+	if err != nil {
+		return nil, err
+	}
+	tkt, err := marshal(ticket{TktVNO: pvno, Realm: k.realm, SName: req.ReqBody.SName, EncPart: enc}, tagTicket)
+	if err != nil {
+		return nil, err
+	}
+	rp, err := marshal(encKDCRepPart{
+		Key:      sessionKey,
+		LastReq:  []lastReq{{LRValue: now}},
+		Nonce:    req.ReqBody.Nonce,
+		Flags:    flags(),
+		AuthTime: now,
+		EndTime:  end,
+		SRealm:   k.realm,
+		SName:    req.ReqBody.SName,
+	}, partTag)
+	if err != nil {
+		return nil, err
+	}
+	encPart, err := encrypt(replyKey, usage, rp, 0)
+	if err != nil {
+		return nil, err
+	}
+	return marshal(kdcRep{
+		PVNO:    pvno,
+		MsgType: tag,
+		CRealm:  k.realm,
+		CName:   req.ReqBody.CName,
+		Ticket:  explicit(5, tkt),
+		EncPart: encPart,
+	}, tag)
+}
+
+func (k *testKDC) error(code int32) ([]byte, error) {
+	return k.errorWithData(code, nil)
+}
+
+func (k *testKDC) errorWithData(code int32, edata []byte) ([]byte, error) {
+	now, _ := kerberosTime(time.Now())
+	return marshal(krbError{
+		PVNO:      pvno,
+		MsgType:   tagKRBError,
+		STime:     now,
+		ErrorCode: code,
+		Realm:     k.realm,
+		SName:     newPrincipalName("krbtgt/" + k.realm),
+		EData:     edata,
+	}, tagKRBError)
+}
+
+// establish runs the DCE style context establishment exchange.
+func establish(t *testing.T, client, server *Provider, level security.Level) (security.ClientContext, security.ServerContext, error) {
+	t.Helper()
+	cc, err := client.NewClientContext("server.example.com", level)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc, err := server.NewServerContext(level)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, done, err := cc.InitContext(nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if done {
+		t.Fatal("client context completed after AP-REQ")
+	}
+	rep, done, err := sc.AcceptContext(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if done {
+		t.Fatal("server context completed before the third leg")
+	}
+	final, done, err := cc.InitContext(rep)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !done {
+		t.Fatal("client context did not complete")
+	}
+	if _, done, err = sc.AcceptContext(final); err != nil {
+		return nil, nil, err
+	}
+	if !done {
+		t.Fatal("server context did not complete")
+	}
+	return cc, sc, nil
+}
+
+func TestContext(t *testing.T) {
+	for _, etype := range defaultETypes {
+		for _, level := range []security.Level{security.LevelIntegrity, security.LevelPrivacy} {
+			var kt Keytab
+			if err := kt.AddPassword("host/server.example.com", "EXAMPLE.COM", "service secret", 2, etype); err != nil {
+				t.Fatal(err)
+			}
+			kdc := newTestKDC(t, "EXAMPLE.COM", &kt)
+
+			// The server only has access to a serialized keytab.
+			serverKeytab, err := ParseKeytab(kt.Marshal())
+			if err != nil {
+				t.Fatal(err)
+			}
+			server := &Provider{Keytab: serverKeytab}
+			client := &Provider{
+				Credentials: Credentials{Realm: "EXAMPLE.COM", User: "alice", Password: "wonderland"},
+				KDC:         kdc,
+			}
+			cc, sc, err := establish(t, client, server, level)
+			if err != nil {
+				t.Fatalf("etype %d: %v", etype, err)
+			}
+			if got := sc.(interface{ Client() string }).Client(); got != "alice@EXAMPLE.COM" {
+				t.Errorf("client = %q", got)
+			}
+			exercise(t, cc, sc, level)
+			exercise(t, sc, cc, level)
+		}
+	}
+}
+
+// exercise protects messages sent from a to b.
+func exercise(t *testing.T, a, b security.Context, level security.Level) {
+	t.Helper()
+	for i := 0; i < 3; i++ {
+		for _, n := range []int{16, 48, 21} {
+			plaintext := bytes.Repeat([]byte{byte(i), byte(n)}, 8+n)
+			msg := append([]byte(nil), plaintext...)
+			data := msg[8 : 8+n]
+			var sig []byte
+			var err error
+			if level.Sealed() {
+				sig, err = a.Seal(msg, data)
+			} else {
+				sig, err = a.Sign(msg)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(sig) != a.SignatureSize() {
+				t.Fatalf("signature is %d octets, want %d", len(sig), a.SignatureSize())
+			}
+			if level.Sealed() {
+				if bytes.Equal(msg, plaintext) {
+					t.Fatal("data was not encrypted")
+				}
+				err = b.Unseal(msg, data, sig)
+			} else {
+				err = b.Verify(msg, sig)
+			}
+			if err != nil {
+				t.Fatalf("message %d of %d octets: %v", i, n, err)
+			}
+			if !bytes.Equal(msg, plaintext) {
+				t.Fatal("data was not decrypted")
+			}
+		}
+	}
+
+	// A tampered message must be rejected.
+	msg := []byte("a tampered message that is long enough")
+	sig, err := a.Sign(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg[0] ^= 1
+	if err := b.Verify(msg, sig); err != security.ErrInvalidSignature {
+		t.Fatalf("verify of tampered message returned %v", err)
+	}
+}
+
+func TestContextWrongKey(t *testing.T) {
+	var kdcKeytab, serverKeytab Keytab
+	kdcKeytab.AddPassword("host/server.example.com", "EXAMPLE.COM", "current", 2)
+	serverKeytab.AddPassword("host/server.example.com", "EXAMPLE.COM", "stale", 2)
+	client := &Provider{
+		Credentials: Credentials{Realm: "EXAMPLE.COM", User: "alice", Password: "wonderland"},
+		KDC:         newTestKDC(t, "EXAMPLE.COM", &kdcKeytab),
+	}
+	if _, _, err := establish(t, client, &Provider{Keytab: &serverKeytab}, security.LevelIntegrity); err != ErrIntegrity {
+		t.Fatalf("got %v, want %v", err, ErrIntegrity)
+	}
+
+	client.Credentials.Password = "wrong"
+	client.tickets = nil
+	_, _, err := establish(t, client, &Provider{Keytab: &kdcKeytab}, security.LevelIntegrity)
+	if kerr, ok := err.(*Error); !ok || kerr.Code != errPreauthFailed {
+		t.Fatalf("got %v, want a preauthentication failure", err)
+	}
+}
@@ -0,0 +1,206 @@
+package kerberos
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrInvalidKeytab is returned when a keytab cannot be parsed.
+var ErrInvalidKeytab = errors.New("kerberos: invalid keytab")
+
+// keytabVersion identifies version 2 of the MIT keytab file format.
+const keytabVersion = 0x0502
+
+// Keytab holds the long-term keys of one or more principals. Servers use a
+// keytab to decrypt the tickets presented by clients.
+//
+// Keytabs are stored in the file format used by MIT Kerberos.
+type Keytab struct {
+	Entries []KeytabEntry
+}
+
+// KeytabEntry is a key for a principal in a keytab.
+type KeytabEntry struct {
+	Principal string // The components of the principal name separated by '/'
+	Realm     string
+	Timestamp time.Time
+	KVNO      uint32
+	EType     int32
+	Key       []byte
+}
+
+// AddPassword derives keys for principal from password and adds them to the
+// keytab. If no encryption types are given keys are added for all of the
+// supported encryption types.
+//
+// Keys are derived with the default salt, which is the realm followed by
+// the components of the principal name.
+func (kt *Keytab) AddPassword(principal, realm, password string, kvno uint32, etypes ...int32) error {
+	if len(etypes) == 0 {
+		etypes = defaultETypes
+	}
+	salt := realm + strings.Replace(principal, "/", "", -1)
+	for _, id := range etypes {
+		e, err := etypeFor(id)
+		if err != nil {
+			return err
+		}
+		key, err := e.StringToKey(password, salt, nil)
+		if err != nil {
+			return err
+		}
+		kt.Entries = append(kt.Entries, KeytabEntry{
+			Principal: principal,
+			Realm:     realm,
+			Timestamp: time.Now(),
+			KVNO:      kvno,
+			EType:     id,
+			Key:       key,
+		})
+	}
+	return nil
+}
+
+// key returns the key for the given principal, key version and encryption
+// type. If kvno is zero the key with the highest version is returned.
+func (kt *Keytab) key(principal, realm string, kvno uint32, etype int32) (encryptionKey, bool) {
+	var found *KeytabEntry
+	for i := range kt.Entries {
+		e := &kt.Entries[i]
+		if e.EType != etype || !strings.EqualFold(e.Realm, realm) || !strings.EqualFold(e.Principal, principal) {
+			continue
+		}
+		if kvno != 0 && e.KVNO != kvno {
+			continue
+		}
+		if found == nil || e.KVNO > found.KVNO {
+			found = e
+		}
+	}
+	if found == nil {
+		return encryptionKey{}, false
+	}
+	return encryptionKey{KeyType: found.EType, KeyValue: found.Key}, true
+}
+
+// ParseKeytab parses a keytab stored in the MIT keytab file format.
+func ParseKeytab(b []byte) (*Keytab, error) {
+	if len(b) < 2 || binary.BigEndian.Uint16(b) != keytabVersion {
+		return nil, ErrInvalidKeytab
+	}
+	b = b[2:]
+	kt := new(Keytab)
+	for len(b) > 0 {
+		if len(b) < 4 {
+			return nil, ErrInvalidKeytab
+		}
+		size := int32(binary.BigEndian.Uint32(b))
+		b = b[4:]
+		if size < 0 {
+			// A hole left by a deleted entry.
+			if int(-size) > len(b) {
+				return nil, ErrInvalidKeytab
+			}
+			b = b[-size:]
+			continue
+		}
+		if int(size) > len(b) {
+			return nil, ErrInvalidKeytab
+		}
+		entry, err := parseKeytabEntry(b[:size])
+		if err != nil {
+			return nil, err
+		}
+		kt.Entries = append(kt.Entries, entry)
+		b = b[size:]
+	}
+	return kt, nil
+}
+
+func parseKeytabEntry(b []byte) (e KeytabEntry, err error) {
+	r := keytabReader{b: b}
+	count := int(r.uint16())
+	e.Realm = string(r.data())
+	components := make([]string, count)
+	for i := range components {
+		components[i] = string(r.data())
+	}
+	e.Principal = strings.Join(components, "/")
+	r.uint32() // Name type
+	e.Timestamp = time.Unix(int64(r.uint32()), 0)
+	e.KVNO = uint32(r.uint8())
+	e.EType = int32(r.uint16())
+	e.Key = r.data()
+	if r.err != nil {
+		return KeytabEntry{}, r.err
+	}
+	if len(r.b) >= 4 {
+		// The 32-bit key version supersedes the 8-bit one.
+		if kvno := r.uint32(); kvno != 0 {
+			e.KVNO = kvno
+		}
+	}
+	return e, nil
+}
+
+// Marshal returns the keytab in the MIT keytab file format.
+func (kt *Keytab) Marshal() []byte {
+	b := make([]byte, 2, 64*len(kt.Entries))
+	binary.BigEndian.PutUint16(b, keytabVersion)
+	for i := range kt.Entries {
+		e := &kt.Entries[i]
+		components := strings.Split(e.Principal, "/")
+		var entry []byte
+		entry = appendUint16(entry, uint16(len(components)))
+		entry = appendData(entry, []byte(e.Realm))
+		for _, c := range components {
+			entry = appendData(entry, []byte(c))
+		}
+		entry = appendUint32(entry, uint32(principalNameType(components)))
+		entry = appendUint32(entry, uint32(e.Timestamp.Unix()))
+		entry = append(entry, uint8(e.KVNO))
+		entry = appendUint16(entry, uint16(e.EType))
+		entry = appendData(entry, e.Key)
+		entry = appendUint32(entry, e.KVNO)
+
+		b = appendUint32(b, uint32(len(entry)))
+		b = append(b, entry...)
+	}
+	return b
+}
+
+type keytabReader struct {
+	b   []byte
+	err error
+}
+
+func (r *keytabReader) next(n int) []byte {
+	if r.err != nil || len(r.b) < n {
+		r.err = ErrInvalidKeytab
+		return make([]byte, n)
+	}
+	p := r.b[:n]
+	r.b = r.b[n:]
+	return p
+}
+
+func (r *keytabReader) uint8() uint8   { return r.next(1)[0] }
+func (r *keytabReader) uint16() uint16 { return binary.BigEndian.Uint16(r.next(2)) }
+func (r *keytabReader) uint32() uint32 { return binary.BigEndian.Uint32(r.next(4)) }
+func (r *keytabReader) data() []byte {
+	return append([]byte(nil), r.next(int(r.uint16()))...)
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendData(b, data []byte) []byte {
+	return append(appendUint16(b, uint16(len(data))), data...)
+}
@@ -0,0 +1,330 @@
+package kerberos
+
+import (
+	"encoding/asn1"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Message types and the application tags that identify them.
+const (
+	tagTicket        = 1
+	tagAuthenticator = 2
+	tagEncTicketPart = 3
+	tagASReq         = 10
+	tagASRep         = 11
+	tagTGSReq        = 12
+	tagTGSRep        = 13
+	tagAPReq         = 14
+	tagAPRep         = 15
+	tagEncASRepPart  = 25
+	tagEncTGSRepPart = 26
+	tagEncAPRepPart  = 27
+	tagKRBError      = 30
+)
+
+// Principal name types.
+const (
+	nameTypePrincipal = 1
+	nameTypeSrvInst   = 2
+	nameTypeSrvHost   = 3
+)
+
+// Pre-authentication data types.
+const (
+	paTGSReq     = 1
+	paEncTS      = 2
+	paETypeInfo2 = 19
+)
+
+// Error codes carried by KRB-ERROR messages.
+const (
+	errPreauthFailed   = 24
+	errPreauthRequired = 25
+)
+
+// APOptions flags.
+const apOptionMutualRequired = 2
+
+// pvno is the version of the protocol.
+const pvno = 5
+
+type principalName struct {
+	NameType   int32    `asn1:"explicit,tag:0"`
+	NameString []string `asn1:"explicit,tag:1"`
+}
+
+type encryptedData struct {
+	EType  int32  `asn1:"explicit,tag:0"`
+	KVNO   int    `asn1:"optional,explicit,tag:1"`
+	Cipher []byte `asn1:"explicit,tag:2"`
+}
+
+type encryptionKey struct {
+	KeyType  int32  `asn1:"explicit,tag:0"`
+	KeyValue []byte `asn1:"explicit,tag:1"`
+}
+
+type checksum struct {
+	CksumType int32  `asn1:"explicit,tag:0"`
+	Checksum  []byte `asn1:"explicit,tag:1"`
+}
+
+type paData struct {
+	Type  int32  `asn1:"explicit,tag:1"`
+	Value []byte `asn1:"explicit,tag:2"`
+}
+
+type paEncTSEnc struct {
+	PATimestamp time.Time `asn1:"generalized,explicit,tag:0"`
+	PAUSec      int       `asn1:"optional,explicit,tag:1"`
+}
+
+type etypeInfo2Entry struct {
+	EType     int32  `asn1:"explicit,tag:0"`
+	Salt      string `asn1:"optional,explicit,tag:1"`
+	S2KParams []byte `asn1:"optional,explicit,tag:2"`
+}
+
+type ticket struct {
+	TktVNO  int           `asn1:"explicit,tag:0"`
+	Realm   string        `asn1:"explicit,tag:1"`
+	SName   principalName `asn1:"explicit,tag:2"`
+	EncPart encryptedData `asn1:"explicit,tag:3"`
+}
+
+type transitedEncoding struct {
+	TRType   int32  `asn1:"explicit,tag:0"`
+	Contents []byte `asn1:"explicit,tag:1"`
+}
+
+type encTicketPart struct {
+	Flags     asn1.BitString    `asn1:"explicit,tag:0"`
+	Key       encryptionKey     `asn1:"explicit,tag:1"`
+	CRealm    string            `asn1:"explicit,tag:2"`
+	CName     principalName     `asn1:"explicit,tag:3"`
+	Transited transitedEncoding `asn1:"explicit,tag:4"`
+	AuthTime  time.Time         `asn1:"generalized,explicit,tag:5"`
+	StartTime time.Time         `asn1:"generalized,optional,explicit,tag:6"`
+	EndTime   time.Time         `asn1:"generalized,explicit,tag:7"`
+	RenewTill time.Time         `asn1:"generalized,optional,explicit,tag:8"`
+}
+
+type kdcReqBody struct {
+	KDCOptions asn1.BitString `asn1:"explicit,tag:0"`
+	CName      principalName  `asn1:"optional,explicit,tag:1"`
+	Realm      string         `asn1:"explicit,tag:2"`
+	SName      principalName  `asn1:"optional,explicit,tag:3"`
+	From       time.Time      `asn1:"generalized,optional,explicit,tag:4"`
+	Till       time.Time      `asn1:"generalized,explicit,tag:5"`
+	RTime      time.Time      `asn1:"generalized,optional,explicit,tag:6"`
+	Nonce      int            `asn1:"explicit,tag:7"`
+	EType      []int32        `asn1:"explicit,tag:8"`
+}
+
+type kdcReq struct {
+	PVNO    int        `asn1:"explicit,tag:1"`
+	MsgType int        `asn1:"explicit,tag:2"`
+	PAData  []paData   `asn1:"optional,explicit,tag:3"`
+	ReqBody kdcReqBody `asn1:"explicit,tag:4"`
+}
+
+type kdcRep struct {
+	PVNO    int           `asn1:"explicit,tag:0"`
+	MsgType int           `asn1:"explicit,tag:1"`
+	PAData  []paData      `asn1:"optional,explicit,tag:2"`
+	CRealm  string        `asn1:"explicit,tag:3"`
+	CName   principalName `asn1:"explicit,tag:4"`
+	Ticket  asn1.RawValue `asn1:"explicit,tag:5"`
+	EncPart encryptedData `asn1:"explicit,tag:6"`
+}
+
+type lastReq struct {
+	LRType  int32     `asn1:"explicit,tag:0"`
+	LRValue time.Time `asn1:"generalized,explicit,tag:1"`
+}
+
+type encKDCRepPart struct {
+	Key       encryptionKey  `asn1:"explicit,tag:0"`
+	LastReq   []lastReq      `asn1:"explicit,tag:1"`
+	Nonce     int            `asn1:"explicit,tag:2"`
+	KeyExp    time.Time      `asn1:"generalized,optional,explicit,tag:3"`
+	Flags     asn1.BitString `asn1:"explicit,tag:4"`
+	AuthTime  time.Time      `asn1:"generalized,explicit,tag:5"`
+	StartTime time.Time      `asn1:"generalized,optional,explicit,tag:6"`
+	EndTime   time.Time      `asn1:"generalized,explicit,tag:7"`
+	RenewTill time.Time      `asn1:"generalized,optional,explicit,tag:8"`
+	SRealm    string         `asn1:"explicit,tag:9"`
+	SName     principalName  `asn1:"explicit,tag:10"`
+}
+
+type apReq struct {
+	PVNO          int            `asn1:"explicit,tag:0"`
+	MsgType       int            `asn1:"explicit,tag:1"`
+	APOptions     asn1.BitString `asn1:"explicit,tag:2"`
+	Ticket        asn1.RawValue  `asn1:"explicit,tag:3"`
+	Authenticator encryptedData  `asn1:"explicit,tag:4"`
+}
+
+type authenticator struct {
+	AVNO      int           `asn1:"explicit,tag:0"`
+	CRealm    string        `asn1:"explicit,tag:1"`
+	CName     principalName `asn1:"explicit,tag:2"`
+	Cksum     checksum      `asn1:"optional,explicit,tag:3"`
+	CUSec     int           `asn1:"explicit,tag:4"`
+	CTime     time.Time     `asn1:"generalized,explicit,tag:5"`
+	SubKey    encryptionKey `asn1:"optional,explicit,tag:6"`
+	SeqNumber int64         `asn1:"optional,explicit,tag:7"`
+}
+
+type apRep struct {
+	PVNO    int           `asn1:"explicit,tag:0"`
+	MsgType int           `asn1:"explicit,tag:1"`
+	EncPart encryptedData `asn1:"explicit,tag:2"`
+}
+
+type encAPRepPart struct {
+	CTime     time.Time     `asn1:"generalized,explicit,tag:0"`
+	CUSec     int           `asn1:"explicit,tag:1"`
+	SubKey    encryptionKey `asn1:"optional,explicit,tag:2"`
+	SeqNumber int64         `asn1:"optional,explicit,tag:3"`
+}
+
+type krbError struct {
+	PVNO      int           `asn1:"explicit,tag:0"`
+	MsgType   int           `asn1:"explicit,tag:1"`
+	CTime     time.Time     `asn1:"generalized,optional,explicit,tag:2"`
+	CUSec     int           `asn1:"optional,explicit,tag:3"`
+	STime     time.Time     `asn1:"generalized,explicit,tag:4"`
+	SUSec     int           `asn1:"explicit,tag:5"`
+	ErrorCode int32         `asn1:"explicit,tag:6"`
+	CRealm    string        `asn1:"optional,explicit,tag:7"`
+	CName     principalName `asn1:"optional,explicit,tag:8"`
+	Realm     string        `asn1:"explicit,tag:9"`
+	SName     principalName `asn1:"explicit,tag:10"`
+	EText     string        `asn1:"optional,explicit,tag:11"`
+	EData     []byte        `asn1:"optional,explicit,tag:12"`
+}
+
+// newPrincipalName returns the principal name with the given components,
+// which are separated by '/'.
+func newPrincipalName(name string) principalName {
+	components := strings.Split(name, "/")
+	return principalName{NameType: principalNameType(components), NameString: components}
+}
+
+// principalNameType returns the name type of a principal name with the
+// given components.
+func principalNameType(components []string) int32 {
+	if len(components) > 1 {
+		return nameTypeSrvInst
+	}
+	return nameTypePrincipal
+}
+
+// String returns the components of the name separated by '/'.
+func (p principalName) String() string {
+	return strings.Join(p.NameString, "/")
+}
+
+// marshal returns the DER encoding of v. If tag is non-zero v is wrapped in
+// an explicit application tag.
+//
+// Kerberos strings are encoded as GeneralString, which encoding/asn1 does
+// not produce, so the string elements of the encoding are retagged.
+func marshal(v interface{}, tag int) ([]byte, error) {
+	params := ""
+	if tag != 0 {
+		params = "application,explicit,tag:" + strconv.Itoa(tag)
+	}
+	b, err := asn1.MarshalWithParams(v, params)
+	if err != nil {
+		return nil, err
+	}
+	retagStrings(b)
+	return b, nil
+}
+
+// unmarshal parses the DER encoding in b into v. If tag is non-zero the
+// encoding must be wrapped in an explicit application tag that matches it.
+func unmarshal(b []byte, v interface{}, tag int) error {
+	if tag == 0 {
+		_, err := asn1.Unmarshal(b, v)
+		return err
+	}
+	var raw asn1.RawValue
+	if _, err := asn1.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	if raw.Class != asn1.ClassApplication || raw.Tag != tag {
+		return asn1.StructuralError{Msg: "unexpected application tag"}
+	}
+	_, err := asn1.Unmarshal(raw.Bytes, v)
+	return err
+}
+
+// applicationTag returns the application tag of the DER encoded message in
+// b, or -1 if it does not have one.
+func applicationTag(b []byte) int {
+	var raw asn1.RawValue
+	if _, err := asn1.Unmarshal(b, &raw); err != nil || raw.Class != asn1.ClassApplication {
+		return -1
+	}
+	return raw.Tag
+}
+
+// explicit returns a raw value that wraps the DER encoding in b with an
+// explicit context-specific tag.
+func explicit(tag int, b []byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: tag, IsCompound: true, Bytes: b}
+}
+
+// retagStrings walks the DER encoding in b and changes the tags of its
+// PrintableString and UTF8String elements to GeneralString.
+func retagStrings(b []byte) {
+	for len(b) > 0 {
+		if len(b) < 2 {
+			return
+		}
+		tag, hdr, length := b[0], 2, int(b[1])
+		if length&0x80 != 0 {
+			n := length & 0x7f
+			if n > 4 || len(b) < 2+n {
+				return
+			}
+			length = 0
+			for _, c := range b[2 : 2+n] {
+				length = length<<8 | int(c)
+			}
+			hdr += n
+		}
+		if length > len(b)-hdr {
+			return
+		}
+		switch {
+		case tag&0x20 != 0:
+			retagStrings(b[hdr : hdr+length])
+		case tag == asn1.TagPrintableString || tag == asn1.TagUTF8String:
+			b[0] = asn1.TagGeneralString
+		}
+		b = b[hdr+length:]
+	}
+}
+
+// flags returns a 32-bit Kerberos flags bit string with the given bits set.
+// Bit zero is the most significant bit.
+func flags(bits ...int) asn1.BitString {
+	b := asn1.BitString{Bytes: make([]byte, 4), BitLength: 32}
+	for _, bit := range bits {
+		b.Bytes[bit/8] |= 0x80 >> uint(bit%8)
+	}
+	return b
+}
+
+// kerberosTime returns t truncated to the precision of a KerberosTime, along
+// with its microseconds.
+func kerberosTime(t time.Time) (time.Time, int) {
+	t = t.UTC()
+	return t.Truncate(time.Second), t.Nanosecond() / 1000
+}
@@ -0,0 +1,390 @@
+package kerberos
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gentlemanautomaton/dcerpc/security"
+)
+
+// MaxClockSkew is the maximum difference between the clocks of a client and
+// server that is tolerated when authenticators are verified.
+const MaxClockSkew = 5 * time.Minute
+
+var (
+	// ErrNoKeytab is returned when a server context is requested from a
+	// provider without a keytab.
+	ErrNoKeytab = errors.New("kerberos: provider has no keytab")
+
+	// ErrNoKey is returned when a server's keytab does not hold the key
+	// needed to decrypt a ticket.
+	ErrNoKey = errors.New("kerberos: keytab does not hold the key for the ticket")
+
+	// ErrClockSkew is returned when the time in an authenticator is too far
+	// from the time of the server.
+	ErrClockSkew = errors.New("kerberos: clock skew too great")
+
+	// ErrTicketExpired is returned when a ticket is not valid at the current
+	// time.
+	ErrTicketExpired = errors.New("kerberos: ticket is not valid")
+
+	// ErrMutualAuthFailed is returned when the AP-REP message received by a
+	// client does not match its AP-REQ message.
+	ErrMutualAuthFailed = errors.New("kerberos: mutual authentication failed")
+)
+
+// Provider is the Kerberos security provider. It implements the DCE style
+// of the Kerberos V5 GSS-API mechanism used by MS-RPCE, in which mutual
+// authentication is completed by a third leg sent from the client.
+//
+// The same provider may be used by clients, which obtain tickets from the
+// KDC with its Credentials, and by servers, which decrypt tickets with the
+// keys in its Keytab.
+type Provider struct {
+	// Credentials authenticate the client side of associations.
+	Credentials Credentials
+
+	// KDC is used by clients to obtain tickets.
+	KDC KDC
+
+	// ServicePrincipal returns the name of the service principal of the
+	// given target. If it is nil "host/" followed by the target is used.
+	ServicePrincipal func(target string) string
+
+	// Keytab holds the keys used by the server side of associations to
+	// decrypt tickets.
+	Keytab *Keytab
+
+	mutex   sync.Mutex
+	tickets map[string]*credential
+}
+
+// Type returns security.TypeGSSKerberos.
+func (p *Provider) Type() security.Type {
+	return security.TypeGSSKerberos
+}
+
+// NewClientContext returns a context that authenticates to the service
+// principal of target.
+func (p *Provider) NewClientContext(target string, level security.Level) (security.ClientContext, error) {
+	service := "host/" + target
+	if p.ServicePrincipal != nil {
+		service = p.ServicePrincipal(target)
+	}
+	return &clientContext{provider: p, service: service, level: level}, nil
+}
+
+// NewServerContext returns a context that accepts tickets that can be
+// decrypted with the provider's keytab.
+func (p *Provider) NewServerContext(level security.Level) (security.ServerContext, error) {
+	if p.Keytab == nil {
+		return nil, ErrNoKeytab
+	}
+	return &serverContext{provider: p, level: level}, nil
+}
+
+// ticket returns a ticket for service, which is obtained from the KDC if no
+// valid ticket is cached.
+func (p *Provider) ticket(service string) (*credential, error) {
+	now := time.Now()
+	realm := p.Credentials.Realm
+	tgs := "krbtgt/" + realm
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if cred := p.cached(service, now); cred != nil {
+		return cred, nil
+	}
+	tgt := p.cached(tgs, now)
+	if tgt == nil {
+		var err error
+		if tgt, err = asExchange(p.KDC, &p.Credentials, tgs, now); err != nil {
+			return nil, err
+		}
+		p.cache(tgs, tgt)
+	}
+	cred, err := tgsExchange(p.KDC, tgt, realm, service, now)
+	if err != nil {
+		return nil, err
+	}
+	p.cache(service, cred)
+	return cred, nil
+}
+
+func (p *Provider) cached(service string, now time.Time) *credential {
+	cred := p.tickets[strings.ToLower(service)]
+	if cred == nil || now.Add(MaxClockSkew).After(cred.endTime) {
+		return nil
+	}
+	return cred
+}
+
+func (p *Provider) cache(service string, cred *credential) {
+	if p.tickets == nil {
+		p.tickets = make(map[string]*credential)
+	}
+	p.tickets[strings.ToLower(service)] = cred
+}
+
+// clientContext is the client side of a Kerberos context.
+type clientContext struct {
+	session
+	provider *Provider
+	service  string
+	level    security.Level
+	cred     *credential
+	ctime    time.Time
+	cusec    int
+	seq      uint32
+	state    int
+}
+
+// InitContext returns an AP-REQ message when called with a nil input. When
+// called with the server's AP-REP message it verifies the server and
+// returns the AP-REP message that completes the DCE style exchange.
+func (c *clientContext) InitContext(input []byte) (output []byte, done bool, err error) {
+	switch c.state {
+	case 0:
+		output, err = c.apReq()
+	case 1:
+		output, err = c.apRep(input)
+		done = true
+	default:
+		err = security.ErrInvalidToken
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	c.state++
+	return output, done, nil
+}
+
+func (c *clientContext) apReq() ([]byte, error) {
+	cred, err := c.provider.ticket(c.service)
+	if err != nil {
+		return nil, err
+	}
+	subkey, err := randomKey(cred.key.KeyType)
+	if err != nil {
+		return nil, err
+	}
+	if c.seq, err = randomSeq(); err != nil {
+		return nil, err
+	}
+	gssFlags := uint32(gssMutual | gssReplay | gssSequence | gssDCEStyle)
+	if c.level.Signed() {
+		gssFlags |= gssInteg
+	}
+	if c.level.Sealed() {
+		gssFlags |= gssConf
+	}
+	now := time.Now()
+	c.cred = cred
+	c.ctime, c.cusec = kerberosTime(now)
+	ap, err := newAPReq(cred, usageAPReqAuthenticator, flags(apOptionMutualRequired), func(a *authenticator) {
+		a.Cksum = gssChecksum(gssFlags)
+		a.SubKey = subkey
+		a.SeqNumber = int64(c.seq)
+	}, now)
+	if err != nil {
+		return nil, err
+	}
+	return frame(tokAPReq, ap), nil
+}
+
+func (c *clientContext) apRep(input []byte) ([]byte, error) {
+	body, err := unframe(tokAPRep, input)
+	if err != nil {
+		return nil, err
+	}
+	var rep apRep
+	if err := unmarshal(body, &rep, tagAPRep); err != nil {
+		return nil, err
+	}
+	b, err := decrypt(c.cred.key, usageAPRepEncPart, rep.EncPart)
+	if err != nil {
+		return nil, ErrMutualAuthFailed
+	}
+	var part encAPRepPart
+	if err := unmarshal(b, &part, tagEncAPRepPart); err != nil {
+		return nil, err
+	}
+	if !part.CTime.Equal(c.ctime) || part.CUSec != c.cusec || part.SubKey.KeyValue == nil {
+		return nil, ErrMutualAuthFailed
+	}
+
+	// Complete the exchange by returning the server's sequence number.
+	ctime, cusec := kerberosTime(time.Now())
+	reply, err := newAPRep(c.cred.key, encAPRepPart{CTime: ctime, CUSec: cusec, SeqNumber: part.SeqNumber})
+	if err != nil {
+		return nil, err
+	}
+	if err := c.session.init(part.SubKey, true, true, c.level, uint64(c.seq), uint64(part.SeqNumber)); err != nil {
+		return nil, err
+	}
+	return frame(tokAPRep, reply), nil
+}
+
+// serverContext is the server side of a Kerberos context.
+type serverContext struct {
+	session
+	provider   *Provider
+	level      security.Level
+	sessionKey encryptionKey
+	subkey     encryptionKey
+	seq        uint32
+	clientSeq  uint32
+	client     string
+	state      int
+}
+
+// AcceptContext verifies the client's AP-REQ message and returns an AP-REP
+// message. It then verifies the AP-REP message that completes the DCE style
+// exchange.
+func (s *serverContext) AcceptContext(input []byte) (output []byte, done bool, err error) {
+	switch s.state {
+	case 0:
+		output, done, err = s.apReq(input)
+	case 1:
+		err = s.apRep(input)
+		done = true
+	default:
+		err = security.ErrInvalidToken
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	s.state++
+	return output, done, nil
+}
+
+func (s *serverContext) apReq(input []byte) (output []byte, done bool, err error) {
+	body, err := unframe(tokAPReq, input)
+	if err != nil {
+		return nil, false, err
+	}
+	var req apReq
+	if err := unmarshal(body, &req, tagAPReq); err != nil {
+		return nil, false, err
+	}
+	var t ticket
+	if err := unmarshal(req.Ticket.Bytes, &t, tagTicket); err != nil {
+		return nil, false, err
+	}
+	key, ok := s.provider.Keytab.key(t.SName.String(), t.Realm, uint32(t.EncPart.KVNO), t.EncPart.EType)
+	if !ok {
+		return nil, false, ErrNoKey
+	}
+	b, err := decrypt(key, usageTicket, t.EncPart)
+	if err != nil {
+		return nil, false, err
+	}
+	var part encTicketPart
+	if err := unmarshal(b, &part, tagEncTicketPart); err != nil {
+		return nil, false, err
+	}
+	now := time.Now()
+	start := part.StartTime
+	if start.IsZero() {
+		start = part.AuthTime
+	}
+	if now.Add(MaxClockSkew).Before(start) || now.Add(-MaxClockSkew).After(part.EndTime) {
+		return nil, false, ErrTicketExpired
+	}
+
+	if b, err = decrypt(part.Key, usageAPReqAuthenticator, req.Authenticator); err != nil {
+		return nil, false, err
+	}
+	var a authenticator
+	if err := unmarshal(b, &a, tagAuthenticator); err != nil {
+		return nil, false, err
+	}
+	if a.CRealm != part.CRealm || a.CName.String() != part.CName.String() {
+		return nil, false, security.ErrInvalidToken
+	}
+	if skew := now.Sub(a.CTime); skew > MaxClockSkew || skew < -MaxClockSkew {
+		return nil, false, ErrClockSkew
+	}
+	if a.Cksum.CksumType != cksumGSSAPI || len(a.Cksum.Checksum) < gssCksumSize {
+		return nil, false, security.ErrInvalidToken
+	}
+	gssFlags := binary.LittleEndian.Uint32(a.Cksum.Checksum[20:])
+	if gssFlags&gssMutual == 0 || gssFlags&gssDCEStyle == 0 {
+		return nil, false, errors.New("kerberos: client did not request DCE style mutual authentication")
+	}
+
+	s.sessionKey = part.Key
+	s.clientSeq = uint32(a.SeqNumber)
+	s.client = a.CName.String() + "@" + a.CRealm
+	if s.subkey, err = randomKey(part.Key.KeyType); err != nil {
+		return nil, false, err
+	}
+	if s.seq, err = randomSeq(); err != nil {
+		return nil, false, err
+	}
+	rep, err := newAPRep(part.Key, encAPRepPart{
+		CTime:     a.CTime,
+		CUSec:     a.CUSec,
+		SubKey:    s.subkey,
+		SeqNumber: int64(s.seq),
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return frame(tokAPRep, rep), false, nil
+}
+
+func (s *serverContext) apRep(input []byte) error {
+	body, err := unframe(tokAPRep, input)
+	if err != nil {
+		return err
+	}
+	var rep apRep
+	if err := unmarshal(body, &rep, tagAPRep); err != nil {
+		return err
+	}
+	b, err := decrypt(s.sessionKey, usageAPRepEncPart, rep.EncPart)
+	if err != nil {
+		return err
+	}
+	var part encAPRepPart
+	if err := unmarshal(b, &part, tagEncAPRepPart); err != nil {
+		return err
+	}
+	if uint32(part.SeqNumber) != s.seq {
+		return ErrMutualAuthFailed
+	}
+	return s.session.init(s.subkey, false, true, s.level, uint64(s.seq), uint64(s.clientSeq))
+}
+
+// Client returns the name of the authenticated client principal, including
+// its realm.
+func (s *serverContext) Client() string {
+	return s.client
+}
+
+// newAPRep returns a DER encoded AP-REP message that carries part.
+func newAPRep(key encryptionKey, part encAPRepPart) ([]byte, error) {
+	b, err := marshal(part, tagEncAPRepPart)
+	if err != nil {
+		return nil, err
+	}
+	data, err := encrypt(key, usageAPRepEncPart, b, 0)
+	if err != nil {
+		return nil, err
+	}
+	return marshal(apRep{PVNO: pvno, MsgType: tagAPRep, EncPart: data}, tagAPRep)
+}
+
+// randomSeq returns a random initial sequence number.
+func randomSeq() (uint32, error) {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(b[:]) & 0x3fffffff, nil
+}
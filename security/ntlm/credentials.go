@@ -0,0 +1,84 @@
+package ntlm
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf16"
+)
+
+// ErrUnknownAccount is returned by an AccountSource when it has no
+// credentials for an account.
+var ErrUnknownAccount = errors.New("ntlm: unknown account")
+
+// Credentials identify an account and hold the secret used to authenticate
+// it. Either a password or the NT hash of the password may be supplied.
+type Credentials struct {
+	Domain   string
+	User     string
+	Password string
+	Hash     []byte // The NT hash of the password, used if Password is empty
+}
+
+// ntHash returns the NT hash of the account's password.
+func (c *Credentials) ntHash() []byte {
+	if c.Password == "" && c.Hash != nil {
+		return c.Hash
+	}
+	return NTHash(c.Password)
+}
+
+// NTHash returns the NT hash of password, which is the MD4 digest of its
+// UTF-16LE encoding.
+func NTHash(password string) []byte {
+	sum := md4(unicode(password))
+	return sum[:]
+}
+
+// AccountSource supplies the NT hashes of the accounts that may authenticate
+// to a server.
+type AccountSource interface {
+	// NTHash returns the NT hash of the given account's password. It
+	// returns ErrUnknownAccount if the account does not exist.
+	NTHash(domain, user string) ([]byte, error)
+}
+
+// AccountList is an AccountSource that holds a fixed list of credentials.
+// User and domain names are compared without regard to case. An entry with
+// an empty domain matches any domain.
+type AccountList []Credentials
+
+// NTHash returns the NT hash of the first entry in the list that matches the
+// given account.
+func (list AccountList) NTHash(domain, user string) ([]byte, error) {
+	for i := range list {
+		c := &list[i]
+		if !strings.EqualFold(c.User, user) {
+			continue
+		}
+		if c.Domain != "" && !strings.EqualFold(c.Domain, domain) {
+			continue
+		}
+		return c.ntHash(), nil
+	}
+	return nil, ErrUnknownAccount
+}
+
+// unicode returns the UTF-16LE encoding of s.
+func unicode(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, len(u)*2)
+	for i, c := range u {
+		b[i*2] = byte(c)
+		b[i*2+1] = byte(c >> 8)
+	}
+	return b
+}
+
+// fromUnicode returns the string represented by the UTF-16LE encoded b.
+func fromUnicode(b []byte) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = uint16(b[i*2]) | uint16(b[i*2+1])<<8
+	}
+	return string(utf16.Decode(u))
+}
@@ -0,0 +1,206 @@
+package ntlm
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rc4"
+	"encoding/binary"
+	"strings"
+	"sync"
+
+	"github.com/gentlemanautomaton/dcerpc/security"
+)
+
+// signatureSize is the size of the message signatures produced when
+// extended session security is in use.
+const signatureSize = 16
+
+// Magic constants used to derive signing and sealing keys.
+const (
+	clientSigningMagic = "session key to client-to-server signing key magic constant\x00"
+	serverSigningMagic = "session key to server-to-client signing key magic constant\x00"
+	clientSealingMagic = "session key to client-to-server sealing key magic constant\x00"
+	serverSealingMagic = "session key to server-to-client sealing key magic constant\x00"
+)
+
+func hmacMD5(key []byte, data ...[]byte) []byte {
+	h := hmac.New(md5.New, key)
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+func md5Sum(data ...[]byte) []byte {
+	h := md5.New()
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+// ntowfv2 returns the NTLMv2 response key for an account, given the NT hash
+// of its password.
+func ntowfv2(hash []byte, user, domain string) []byte {
+	return hmacMD5(hash, unicode(strings.ToUpper(user)+domain))
+}
+
+// ntlmv2Response computes the NTLMv2 response to the server challenge, along
+// with the session base key. The client blob is the portion of the response
+// that follows the NTProofStr, as described by the NTLMv2_CLIENT_CHALLENGE
+// structure.
+func ntlmv2Response(key []byte, serverChallenge [8]byte, blob []byte) (response, sessionBaseKey []byte) {
+	proof := hmacMD5(key, serverChallenge[:], blob)
+	response = append(proof, blob...)
+	return response, hmacMD5(key, proof)
+}
+
+// clientBlob returns an NTLMv2_CLIENT_CHALLENGE structure.
+func clientBlob(timestamp uint64, clientChallenge [8]byte, info []byte) []byte {
+	b := make([]byte, 28, 28+len(info)+4)
+	b[0], b[1] = 1, 1 // RespType and HiRespType
+	binary.LittleEndian.PutUint64(b[8:], timestamp)
+	copy(b[16:24], clientChallenge[:])
+	b = append(b, info...)
+	return append(b, 0, 0, 0, 0)
+}
+
+// lmv2Response computes the LMv2 response to the server challenge.
+func lmv2Response(key []byte, serverChallenge, clientChallenge [8]byte) []byte {
+	return append(hmacMD5(key, serverChallenge[:], clientChallenge[:]), clientChallenge[:]...)
+}
+
+// rc4Crypt returns data encrypted with a fresh RC4 cipher for key.
+func rc4Crypt(key, data []byte) []byte {
+	c, err := rc4.NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+	out := make([]byte, len(data))
+	c.XORKeyStream(out, data)
+	return out
+}
+
+// session holds the keys and state used to protect messages once a context
+// has been established. It implements security.Context.
+type session struct {
+	mutex sync.Mutex
+
+	established bool
+
+	sendSignKey []byte
+	recvSignKey []byte
+	sendSeal    *rc4.Cipher
+	recvSeal    *rc4.Cipher
+	sendSeq     uint32
+	recvSeq     uint32
+}
+
+// init derives the session's keys from the exported session key. Clients
+// send with the client-to-server keys and servers with the server-to-client
+// keys.
+func (s *session) init(exportedSessionKey []byte, client bool) {
+	clientSign := md5Sum(exportedSessionKey, []byte(clientSigningMagic))
+	serverSign := md5Sum(exportedSessionKey, []byte(serverSigningMagic))
+	clientSeal, _ := rc4.NewCipher(md5Sum(exportedSessionKey, []byte(clientSealingMagic)))
+	serverSeal, _ := rc4.NewCipher(md5Sum(exportedSessionKey, []byte(serverSealingMagic)))
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if client {
+		s.sendSignKey, s.recvSignKey = clientSign, serverSign
+		s.sendSeal, s.recvSeal = clientSeal, serverSeal
+	} else {
+		s.sendSignKey, s.recvSignKey = serverSign, clientSign
+		s.sendSeal, s.recvSeal = serverSeal, clientSeal
+	}
+	s.established = true
+}
+
+// SignatureSize returns the size of the signatures produced by the session.
+func (s *session) SignatureSize() int {
+	return signatureSize
+}
+
+// Sign returns a signature for msg.
+func (s *session) Sign(msg []byte) ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.established {
+		return nil, security.ErrContextIncomplete
+	}
+	sig := mac(s.sendSignKey, s.sendSeal, s.sendSeq, msg)
+	s.sendSeq++
+	return sig, nil
+}
+
+// Verify checks that signature is valid for msg.
+func (s *session) Verify(msg, signature []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.established {
+		return security.ErrContextIncomplete
+	}
+	expected := mac(s.recvSignKey, s.recvSeal, s.recvSeq, msg)
+	s.recvSeq++
+	if !hmac.Equal(expected, signature) {
+		return security.ErrInvalidSignature
+	}
+	return nil
+}
+
+// Seal encrypts data in place and returns a signature for msg. The signature
+// is computed over the plaintext, but its checksum is encrypted after data so
+// that both share the sealing key stream.
+func (s *session) Seal(msg, data []byte) ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.established {
+		return nil, security.ErrContextIncomplete
+	}
+	checksum := hmacMD5(s.sendSignKey, seqBytes(s.sendSeq), msg)[:8]
+	s.sendSeal.XORKeyStream(data, data)
+	sig := signatureFor(s.sendSeal, s.sendSeq, checksum)
+	s.sendSeq++
+	return sig, nil
+}
+
+// Unseal decrypts data in place and checks that signature is valid for msg.
+func (s *session) Unseal(msg, data, signature []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.established {
+		return security.ErrContextIncomplete
+	}
+	s.recvSeal.XORKeyStream(data, data)
+	checksum := hmacMD5(s.recvSignKey, seqBytes(s.recvSeq), msg)[:8]
+	expected := signatureFor(s.recvSeal, s.recvSeq, checksum)
+	s.recvSeq++
+	if !hmac.Equal(expected, signature) {
+		return security.ErrInvalidSignature
+	}
+	return nil
+}
+
+// mac computes the signature of msg with extended session security and key
+// exchange, as described in section 3.4.4.2 of MS-NLMP.
+func mac(signKey []byte, seal *rc4.Cipher, seq uint32, msg []byte) []byte {
+	checksum := hmacMD5(signKey, seqBytes(seq), msg)[:8]
+	return signatureFor(seal, seq, checksum)
+}
+
+// signatureFor encrypts checksum with the sealing key stream and returns an
+// NTLMSSP_MESSAGE_SIGNATURE structure that carries it.
+func signatureFor(seal *rc4.Cipher, seq uint32, checksum []byte) []byte {
+	sig := make([]byte, signatureSize)
+	binary.LittleEndian.PutUint32(sig, 1) // Version
+	seal.XORKeyStream(sig[4:12], checksum)
+	binary.LittleEndian.PutUint32(sig[12:], seq)
+	return sig
+}
+
+func seqBytes(seq uint32) []byte {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], seq)
+	return b[:]
+}
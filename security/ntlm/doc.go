@@ -0,0 +1,13 @@
+// Package ntlm implements the NTLM security provider, which authenticates RPC
+// associations with the NTLMv2 protocol.
+//
+// The provider negotiates extended session security and a 128-bit session
+// key exchange, which are used to sign and seal PDUs at the packet integrity
+// and packet privacy authentication levels. Both the client and server sides
+// of the protocol are implemented, so associations can be authenticated
+// without a domain controller when the server is given the NT hashes of its
+// accounts.
+//
+// The protocol is described in "[MS-NLMP] NT LAN Manager (NTLM)
+// Authentication Protocol".
+package ntlm
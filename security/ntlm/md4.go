@@ -0,0 +1,64 @@
+package ntlm
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// md4 returns the MD4 digest of data, as described in RFC 1320.
+//
+// MD4 is required to compute the NT hash of a password. It is not suitable
+// for any other purpose.
+func md4(data []byte) [16]byte {
+	s := [4]uint32{0x67452301, 0xefcdab89, 0x98badcfe, 0x10325476}
+
+	n := len(data)
+	msg := make([]byte, (n+8)/64*64+64)
+	copy(msg, data)
+	msg[n] = 0x80
+	binary.LittleEndian.PutUint64(msg[len(msg)-8:], uint64(n)<<3)
+
+	var x [16]uint32
+	for len(msg) > 0 {
+		for i := range x {
+			x[i] = binary.LittleEndian.Uint32(msg[i*4:])
+		}
+		a, b, c, d := s[0], s[1], s[2], s[3]
+
+		// Round 1
+		for _, i := range [16]uint{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15} {
+			f := (b & c) | (^b & d)
+			a, b, c, d = d, bits.RotateLeft32(a+f+x[i], md4Shift1[i%4]), b, c
+		}
+
+		// Round 2
+		for j, i := range [16]uint{0, 4, 8, 12, 1, 5, 9, 13, 2, 6, 10, 14, 3, 7, 11, 15} {
+			g := (b & c) | (b & d) | (c & d)
+			a, b, c, d = d, bits.RotateLeft32(a+g+x[i]+0x5a827999, md4Shift2[j%4]), b, c
+		}
+
+		// Round 3
+		for j, i := range [16]uint{0, 8, 4, 12, 2, 10, 6, 14, 1, 9, 5, 13, 3, 11, 7, 15} {
+			h := b ^ c ^ d
+			a, b, c, d = d, bits.RotateLeft32(a+h+x[i]+0x6ed9eba1, md4Shift3[j%4]), b, c
+		}
+
+		s[0] += a
+		s[1] += b
+		s[2] += c
+		s[3] += d
+		msg = msg[64:]
+	}
+
+	var sum [16]byte
+	for i, v := range s {
+		binary.LittleEndian.PutUint32(sum[i*4:], v)
+	}
+	return sum
+}
+
+var (
+	md4Shift1 = [4]int{3, 7, 11, 19}
+	md4Shift2 = [4]int{3, 5, 9, 13}
+	md4Shift3 = [4]int{3, 9, 11, 15}
+)
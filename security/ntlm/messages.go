@@ -0,0 +1,272 @@
+package ntlm
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/gentlemanautomaton/dcerpc/security"
+)
+
+var signature = []byte("NTLMSSP\x00")
+
+// Message types.
+const (
+	typeNegotiate    = 1
+	typeChallenge    = 2
+	typeAuthenticate = 3
+)
+
+// Negotiation flags.
+const (
+	flagUnicode                 = 0x00000001
+	flagRequestTarget           = 0x00000004
+	flagSign                    = 0x00000010
+	flagSeal                    = 0x00000020
+	flagNTLM                    = 0x00000200
+	flagAlwaysSign              = 0x00008000
+	flagTargetTypeDomain        = 0x00010000
+	flagExtendedSessionSecurity = 0x00080000
+	flagTargetInfo              = 0x00800000
+	flag128                     = 0x20000000
+	flagKeyExchange             = 0x40000000
+	flag56                      = 0x80000000
+)
+
+// AV pair identifiers, which label the attributes of the target information
+// carried by challenge messages.
+const (
+	avEOL             = 0x0000
+	avNbComputerName  = 0x0001
+	avNbDomainName    = 0x0002
+	avDNSComputerName = 0x0003
+	avDNSDomainName   = 0x0004
+	avFlags           = 0x0006
+	avTimestamp       = 0x0007
+	avTargetName      = 0x0009
+)
+
+// avFlagMIC is set in the avFlags attribute of an NTLMv2 response when the
+// authenticate message includes a message integrity code.
+const avFlagMIC = 0x00000002
+
+// Field offsets within messages.
+const (
+	negotiateLength     = 32
+	challengePayload    = 56
+	authenticateMIC     = 72
+	authenticatePayload = 88
+)
+
+type negotiateMessage struct {
+	Flags uint32
+}
+
+func (m *negotiateMessage) Marshal() []byte {
+	b := make([]byte, negotiateLength)
+	copy(b, signature)
+	binary.LittleEndian.PutUint32(b[8:], typeNegotiate)
+	binary.LittleEndian.PutUint32(b[12:], m.Flags)
+	// The domain and workstation fields are empty.
+	binary.LittleEndian.PutUint32(b[20:], negotiateLength)
+	binary.LittleEndian.PutUint32(b[28:], negotiateLength)
+	return b
+}
+
+func (m *negotiateMessage) Unmarshal(b []byte) error {
+	if err := checkHeader(b, typeNegotiate, 16); err != nil {
+		return err
+	}
+	m.Flags = binary.LittleEndian.Uint32(b[12:])
+	return nil
+}
+
+type challengeMessage struct {
+	TargetName      string
+	Flags           uint32
+	ServerChallenge [8]byte
+	TargetInfo      []byte
+}
+
+func (m *challengeMessage) Marshal() []byte {
+	name := unicode(m.TargetName)
+	b := make([]byte, challengePayload, challengePayload+len(name)+len(m.TargetInfo))
+	copy(b, signature)
+	binary.LittleEndian.PutUint32(b[8:], typeChallenge)
+	b = appendField(b, 12, name)
+	binary.LittleEndian.PutUint32(b[20:], m.Flags)
+	copy(b[24:32], m.ServerChallenge[:])
+	b = appendField(b, 40, m.TargetInfo)
+	return b
+}
+
+func (m *challengeMessage) Unmarshal(b []byte) (err error) {
+	if err := checkHeader(b, typeChallenge, 48); err != nil {
+		return err
+	}
+	name, err := readField(b, 12)
+	if err != nil {
+		return err
+	}
+	m.TargetName = fromUnicode(name)
+	m.Flags = binary.LittleEndian.Uint32(b[20:])
+	copy(m.ServerChallenge[:], b[24:32])
+	m.TargetInfo, err = readField(b, 40)
+	return err
+}
+
+type authenticateMessage struct {
+	LmChallengeResponse       []byte
+	NtChallengeResponse       []byte
+	DomainName                string
+	UserName                  string
+	Workstation               string
+	EncryptedRandomSessionKey []byte
+	Flags                     uint32
+	MIC                       [16]byte
+}
+
+func (m *authenticateMessage) Marshal() []byte {
+	b := make([]byte, authenticatePayload)
+	copy(b, signature)
+	binary.LittleEndian.PutUint32(b[8:], typeAuthenticate)
+	b = appendField(b, 12, m.LmChallengeResponse)
+	b = appendField(b, 20, m.NtChallengeResponse)
+	b = appendField(b, 28, unicode(m.DomainName))
+	b = appendField(b, 36, unicode(m.UserName))
+	b = appendField(b, 44, unicode(m.Workstation))
+	b = appendField(b, 52, m.EncryptedRandomSessionKey)
+	binary.LittleEndian.PutUint32(b[60:], m.Flags)
+	copy(b[authenticateMIC:], m.MIC[:])
+	return b
+}
+
+func (m *authenticateMessage) Unmarshal(b []byte) (err error) {
+	if err := checkHeader(b, typeAuthenticate, authenticatePayload); err != nil {
+		return err
+	}
+	if m.LmChallengeResponse, err = readField(b, 12); err != nil {
+		return err
+	}
+	if m.NtChallengeResponse, err = readField(b, 20); err != nil {
+		return err
+	}
+	var s []byte
+	if s, err = readField(b, 28); err != nil {
+		return err
+	}
+	m.DomainName = fromUnicode(s)
+	if s, err = readField(b, 36); err != nil {
+		return err
+	}
+	m.UserName = fromUnicode(s)
+	if s, err = readField(b, 44); err != nil {
+		return err
+	}
+	m.Workstation = fromUnicode(s)
+	if m.EncryptedRandomSessionKey, err = readField(b, 52); err != nil {
+		return err
+	}
+	m.Flags = binary.LittleEndian.Uint32(b[60:])
+	copy(m.MIC[:], b[authenticateMIC:])
+	return nil
+}
+
+// checkHeader verifies that b holds a message of the given type that is at
+// least min octets long.
+func checkHeader(b []byte, messageType uint32, min int) error {
+	if len(b) < min || !bytes.Equal(b[:8], signature) || binary.LittleEndian.Uint32(b[8:]) != messageType {
+		return security.ErrInvalidToken
+	}
+	return nil
+}
+
+// appendField appends value to the payload of the message in b and records
+// its length and offset in the field descriptor at the given offset.
+func appendField(b []byte, offset int, value []byte) []byte {
+	binary.LittleEndian.PutUint16(b[offset:], uint16(len(value)))
+	binary.LittleEndian.PutUint16(b[offset+2:], uint16(len(value)))
+	binary.LittleEndian.PutUint32(b[offset+4:], uint32(len(b)))
+	return append(b, value...)
+}
+
+// readField returns the value described by the field descriptor at the given
+// offset of the message in b.
+func readField(b []byte, offset int) ([]byte, error) {
+	length := int(binary.LittleEndian.Uint16(b[offset:]))
+	start := int(binary.LittleEndian.Uint32(b[offset+4:]))
+	if length == 0 {
+		return nil, nil
+	}
+	if start > len(b) || length > len(b)-start {
+		return nil, security.ErrInvalidToken
+	}
+	return append([]byte(nil), b[start:start+length]...), nil
+}
+
+// avPair is an attribute of the target information carried by challenge
+// messages and NTLMv2 responses.
+type avPair struct {
+	ID    uint16
+	Value []byte
+}
+
+// avPairs is a list of attributes.
+type avPairs []avPair
+
+// Lookup returns the value of the attribute with the given identifier.
+func (list avPairs) Lookup(id uint16) ([]byte, bool) {
+	for _, pair := range list {
+		if pair.ID == id {
+			return pair.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Set sets the value of the attribute with the given identifier, adding it
+// to the list if necessary.
+func (list *avPairs) Set(id uint16, value []byte) {
+	for i := range *list {
+		if (*list)[i].ID == id {
+			(*list)[i].Value = value
+			return
+		}
+	}
+	*list = append(*list, avPair{ID: id, Value: value})
+}
+
+// Marshal returns the binary representation of the list, which is
+// terminated by an avEOL attribute.
+func (list avPairs) Marshal() []byte {
+	var b []byte
+	for _, pair := range list {
+		b = appendAVPair(b, pair.ID, pair.Value)
+	}
+	return appendAVPair(b, avEOL, nil)
+}
+
+// Unmarshal parses the list stored in b.
+func (list *avPairs) Unmarshal(b []byte) error {
+	*list = nil
+	for {
+		if len(b) < 4 {
+			return security.ErrInvalidToken
+		}
+		id, length := binary.LittleEndian.Uint16(b), int(binary.LittleEndian.Uint16(b[2:]))
+		if id == avEOL {
+			return nil
+		}
+		if length > len(b)-4 {
+			return security.ErrInvalidToken
+		}
+		*list = append(*list, avPair{ID: id, Value: b[4 : 4+length]})
+		b = b[4+length:]
+	}
+}
+
+func appendAVPair(b []byte, id uint16, value []byte) []byte {
+	var h [4]byte
+	binary.LittleEndian.PutUint16(h[:], id)
+	binary.LittleEndian.PutUint16(h[2:], uint16(len(value)))
+	return append(append(b, h[:]...), value...)
+}
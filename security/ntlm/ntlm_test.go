@@ -0,0 +1,172 @@
+package ntlm
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/gentlemanautomaton/dcerpc/security"
+)
+
+func TestMD4(t *testing.T) {
+	tests := []struct {
+		in, out string
+	}{
+		{"", "31d6cfe0d16ae931b73c59d7e0c089c0"},
+		{"a", "bde52cb31de33e46245e05fbdbd6fb24"},
+		{"abc", "a448017aaf21d8525fc10ae87aa6729d"},
+		{"message digest", "d9130a8164549fe818874806e1c7014b"},
+		{"12345678901234567890123456789012345678901234567890123456789012345678901234567890", "e33b4ddc9c38f2199c3e7b164fcc0536"},
+	}
+	for _, test := range tests {
+		sum := md4([]byte(test.in))
+		if got := hex.EncodeToString(sum[:]); got != test.out {
+			t.Errorf("md4(%q) = %s, want %s", test.in, got, test.out)
+		}
+	}
+}
+
+// TestNTOWFv2 checks key derivation against the sample data in section
+// 4.2.4 of MS-NLMP.
+func TestNTOWFv2(t *testing.T) {
+	hash := NTHash("Password")
+	if got, want := hex.EncodeToString(hash), "a4f49c406510bdcab6824ee7c30fd852"; got != want {
+		t.Fatalf("NTHash = %s, want %s", got, want)
+	}
+	key := ntowfv2(hash, "User", "Domain")
+	if got, want := hex.EncodeToString(key), "0c868a403bfd7a93a3001ef22ef02e3f"; got != want {
+		t.Fatalf("NTOWFv2 = %s, want %s", got, want)
+	}
+}
+
+// TestNTLMv2Response checks the response computation against the sample data
+// in section 4.2.4 of MS-NLMP.
+func TestNTLMv2Response(t *testing.T) {
+	key := ntowfv2(NTHash("Password"), "User", "Domain")
+	info := avPairs{
+		{ID: avNbDomainName, Value: unicode("Domain")},
+		{ID: avNbComputerName, Value: unicode("Server")},
+	}
+	serverChallenge := [8]byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef}
+	clientChallenge := [8]byte{0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0xaa}
+	response, sessionBaseKey := ntlmv2Response(key, serverChallenge, clientBlob(0, clientChallenge, info.Marshal()))
+	if got, want := hex.EncodeToString(response[:16]), "68cd0ab851e51c96aabc927bebef6a1c"; got != want {
+		t.Errorf("NTProofStr = %s, want %s", got, want)
+	}
+	if got, want := hex.EncodeToString(sessionBaseKey), "8de40ccadbc14a82f15cb0ad0de95ca3"; got != want {
+		t.Errorf("SessionBaseKey = %s, want %s", got, want)
+	}
+	lm := lmv2Response(key, serverChallenge, clientChallenge)
+	if got, want := hex.EncodeToString(lm), "86c35097ac9cec102554764a57cccc19aaaaaaaaaaaaaaaa"; got != want {
+		t.Errorf("LMv2 response = %s, want %s", got, want)
+	}
+}
+
+func establish(t *testing.T, client, server *Provider, level security.Level) (security.ClientContext, security.ServerContext, error) {
+	t.Helper()
+	cc, err := client.NewClientContext("server", level)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc, err := server.NewServerContext(level)
+	if err != nil {
+		t.Fatal(err)
+	}
+	negotiate, done, err := cc.InitContext(nil)
+	if err != nil || done {
+		t.Fatalf("negotiate: %v %v", done, err)
+	}
+	challenge, done, err := sc.AcceptContext(negotiate)
+	if err != nil || done {
+		t.Fatalf("challenge: %v %v", done, err)
+	}
+	authenticate, done, err := cc.InitContext(challenge)
+	if err != nil || !done {
+		t.Fatalf("authenticate: %v %v", done, err)
+	}
+	if _, done, err = sc.AcceptContext(authenticate); err != nil {
+		return cc, sc, err
+	}
+	if !done {
+		t.Fatal("server context was not established")
+	}
+	return cc, sc, nil
+}
+
+func TestContext(t *testing.T) {
+	server := &Provider{
+		DomainName:   "DOMAIN",
+		ComputerName: "SERVER",
+		Accounts: AccountList{
+			{Domain: "DOMAIN", User: "alice", Password: "Secret1"},
+			{User: "bob", Hash: NTHash("Secret2")},
+		},
+	}
+	clients := []*Provider{
+		{Credentials: Credentials{Domain: "DOMAIN", User: "Alice", Password: "Secret1"}},
+		{Credentials: Credentials{Domain: "OTHER", User: "bob", Hash: NTHash("Secret2")}},
+	}
+	for _, client := range clients {
+		cc, sc, err := establish(t, client, server, security.LevelPrivacy)
+		if err != nil {
+			t.Fatalf("%s: %v", client.Credentials.User, err)
+		}
+
+		// Messages flow in both directions, each with its own sequence.
+		for i := 0; i < 3; i++ {
+			msg := []byte("client to server")
+			sig, err := cc.Sign(msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := sc.Verify(msg, sig); err != nil {
+				t.Fatalf("verify %d: %v", i, err)
+			}
+			msg = []byte("server to client")
+			if sig, err = sc.Sign(msg); err != nil {
+				t.Fatal(err)
+			}
+			if err := cc.Verify(msg, sig); err != nil {
+				t.Fatalf("verify %d: %v", i, err)
+			}
+		}
+
+		plaintext := []byte("header|sealed portion|trailer")
+		msg := append([]byte(nil), plaintext...)
+		data := msg[7:21]
+		sig, err := cc.Seal(msg, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Equal(msg, plaintext) {
+			t.Fatal("seal did not encrypt the data")
+		}
+		if err := sc.Unseal(msg, data, sig); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(msg, plaintext) {
+			t.Fatalf("unsealed %q, want %q", msg, plaintext)
+		}
+
+		// A tampered message must be rejected.
+		msg = []byte("tamper")
+		sig, _ = sc.Sign(msg)
+		msg[0] ^= 1
+		if err := cc.Verify(msg, sig); err != security.ErrInvalidSignature {
+			t.Fatalf("verify of tampered message returned %v", err)
+		}
+	}
+}
+
+func TestContextWrongPassword(t *testing.T) {
+	server := &Provider{Accounts: AccountList{{User: "alice", Password: "right"}}}
+	for _, creds := range []Credentials{
+		{User: "alice", Password: "wrong"},
+		{User: "mallory", Password: "right"},
+	} {
+		client := &Provider{Credentials: creds}
+		if _, _, err := establish(t, client, server, security.LevelIntegrity); err != ErrAuthenticationFailed {
+			t.Errorf("%s: got %v, want %v", creds.User, err, ErrAuthenticationFailed)
+		}
+	}
+}
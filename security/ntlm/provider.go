@@ -0,0 +1,296 @@
+package ntlm
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/gentlemanautomaton/dcerpc/security"
+)
+
+var (
+	// ErrNegotiationFailed is returned when the peer does not support the
+	// features required by the provider, which are NTLMv2 with extended
+	// session security, key exchange and 128-bit keys.
+	ErrNegotiationFailed = errors.New("ntlm: peer does not support the required features")
+
+	// ErrAuthenticationFailed is returned when a client's response to the
+	// server challenge is not valid.
+	ErrAuthenticationFailed = errors.New("ntlm: authentication failed")
+
+	// ErrNoAccounts is returned when a server context is requested from a
+	// provider without an account source.
+	ErrNoAccounts = errors.New("ntlm: provider has no account source")
+)
+
+// supportedFlags are the negotiation flags that may be agreed upon by
+// contexts created by the provider.
+const supportedFlags = flagUnicode | flagRequestTarget | flagSign | flagSeal | flagNTLM |
+	flagAlwaysSign | flagExtendedSessionSecurity | flagTargetInfo | flag128 |
+	flagKeyExchange | flag56
+
+// requiredFlags are the negotiation flags that must be agreed upon by both
+// sides of a context.
+const requiredFlags = flagUnicode | flagNTLM | flagExtendedSessionSecurity | flag128 | flagKeyExchange
+
+// Provider is the NTLM security provider.
+//
+// The same provider may be used by clients, which authenticate with its
+// Credentials, and by servers, which verify clients against its Accounts.
+type Provider struct {
+	// Credentials authenticate the client side of associations.
+	Credentials Credentials
+
+	// Workstation is the name of the client machine, which is reported to
+	// servers.
+	Workstation string
+
+	// Accounts supplies the credentials of the clients that may
+	// authenticate to the server side of associations.
+	Accounts AccountSource
+
+	// DomainName and ComputerName are the NetBIOS names of the server's
+	// domain and machine, which are reported to clients.
+	DomainName   string
+	ComputerName string
+}
+
+// Type returns security.TypeWinNT.
+func (p *Provider) Type() security.Type {
+	return security.TypeWinNT
+}
+
+// NewClientContext returns a context that authenticates to target with the
+// provider's credentials.
+func (p *Provider) NewClientContext(target string, level security.Level) (security.ClientContext, error) {
+	return &clientContext{provider: p, target: target, level: level}, nil
+}
+
+// NewServerContext returns a context that verifies clients with the
+// provider's account source.
+func (p *Provider) NewServerContext(level security.Level) (security.ServerContext, error) {
+	if p.Accounts == nil {
+		return nil, ErrNoAccounts
+	}
+	return &serverContext{provider: p, level: level}, nil
+}
+
+// levelFlags returns the negotiation flags needed to protect messages at the
+// given level.
+func levelFlags(level security.Level) uint32 {
+	var flags uint32
+	if level.Signed() {
+		flags |= flagSign
+	}
+	if level.Sealed() {
+		flags |= flagSeal
+	}
+	return flags
+}
+
+// clientContext is the client side of an NTLM context.
+type clientContext struct {
+	session
+	provider  *Provider
+	target    string
+	level     security.Level
+	negotiate []byte
+	done      bool
+}
+
+// InitContext returns a negotiate message when called with a nil input and
+// an authenticate message when called with the server's challenge message.
+func (c *clientContext) InitContext(input []byte) (output []byte, done bool, err error) {
+	switch {
+	case c.done:
+		return nil, false, security.ErrInvalidToken
+	case c.negotiate == nil:
+		m := negotiateMessage{Flags: supportedFlags&^(flagSign|flagSeal) | levelFlags(c.level)}
+		c.negotiate = m.Marshal()
+		return c.negotiate, false, nil
+	}
+
+	var challenge challengeMessage
+	if err := challenge.Unmarshal(input); err != nil {
+		return nil, false, err
+	}
+	flags := challenge.Flags & supportedFlags
+	if flags&requiredFlags != requiredFlags || flags&levelFlags(c.level) != levelFlags(c.level) {
+		return nil, false, ErrNegotiationFailed
+	}
+
+	var info avPairs
+	if err := info.Unmarshal(challenge.TargetInfo); err != nil {
+		return nil, false, err
+	}
+	timestamp, hasTimestamp := info.Lookup(avTimestamp)
+	var ts uint64
+	if hasTimestamp && len(timestamp) == 8 {
+		ts = binary.LittleEndian.Uint64(timestamp)
+	} else {
+		ts = filetime(time.Now())
+	}
+	info.Set(avFlags, uint32Bytes(avFlagMIC))
+	if c.target != "" {
+		info.Set(avTargetName, unicode("host/"+c.target))
+	}
+
+	var clientChallenge [8]byte
+	if _, err := rand.Read(clientChallenge[:]); err != nil {
+		return nil, false, err
+	}
+
+	creds := &c.provider.Credentials
+	key := ntowfv2(creds.ntHash(), creds.User, creds.Domain)
+	nt, sessionBaseKey := ntlmv2Response(key, challenge.ServerChallenge, clientBlob(ts, clientChallenge, info.Marshal()))
+	lm := make([]byte, 24)
+	if !hasTimestamp {
+		lm = lmv2Response(key, challenge.ServerChallenge, clientChallenge)
+	}
+
+	m := authenticateMessage{
+		LmChallengeResponse: lm,
+		NtChallengeResponse: nt,
+		DomainName:          creds.Domain,
+		UserName:            creds.User,
+		Workstation:         c.provider.Workstation,
+		Flags:               flags,
+	}
+	exportedSessionKey := make([]byte, 16)
+	if _, err := rand.Read(exportedSessionKey); err != nil {
+		return nil, false, err
+	}
+	m.EncryptedRandomSessionKey = rc4Crypt(sessionBaseKey, exportedSessionKey)
+
+	output = m.Marshal()
+	mic := hmacMD5(exportedSessionKey, c.negotiate, input, output)
+	copy(output[authenticateMIC:], mic)
+
+	c.session.init(exportedSessionKey, true)
+	c.done = true
+	return output, true, nil
+}
+
+// serverContext is the server side of an NTLM context.
+type serverContext struct {
+	session
+	provider        *Provider
+	level           security.Level
+	negotiate       []byte
+	challenge       []byte
+	flags           uint32
+	serverChallenge [8]byte
+	done            bool
+}
+
+// AcceptContext returns a challenge message in response to the client's
+// negotiate message and verifies the client's authenticate message.
+func (s *serverContext) AcceptContext(input []byte) (output []byte, done bool, err error) {
+	switch {
+	case s.done:
+		return nil, false, security.ErrInvalidToken
+	case s.negotiate == nil:
+		return s.acceptNegotiate(input)
+	}
+	return s.acceptAuthenticate(input)
+}
+
+func (s *serverContext) acceptNegotiate(input []byte) ([]byte, bool, error) {
+	var negotiate negotiateMessage
+	if err := negotiate.Unmarshal(input); err != nil {
+		return nil, false, err
+	}
+	flags := negotiate.Flags & supportedFlags
+	if flags&requiredFlags != requiredFlags {
+		return nil, false, ErrNegotiationFailed
+	}
+	s.flags = flags | levelFlags(s.level) | flagTargetInfo | flagTargetTypeDomain
+	if _, err := rand.Read(s.serverChallenge[:]); err != nil {
+		return nil, false, err
+	}
+	info := avPairs{
+		{ID: avNbDomainName, Value: unicode(s.provider.DomainName)},
+		{ID: avNbComputerName, Value: unicode(s.provider.ComputerName)},
+		{ID: avTimestamp, Value: uint64Bytes(filetime(time.Now()))},
+	}
+	m := challengeMessage{
+		TargetName:      s.provider.DomainName,
+		Flags:           s.flags,
+		ServerChallenge: s.serverChallenge,
+		TargetInfo:      info.Marshal(),
+	}
+	s.negotiate = append([]byte(nil), input...)
+	s.challenge = m.Marshal()
+	return s.challenge, false, nil
+}
+
+func (s *serverContext) acceptAuthenticate(input []byte) ([]byte, bool, error) {
+	var m authenticateMessage
+	if err := m.Unmarshal(input); err != nil {
+		return nil, false, err
+	}
+	if len(m.NtChallengeResponse) < 16+28 {
+		// NTLMv1 and anonymous authentication are not supported.
+		return nil, false, ErrAuthenticationFailed
+	}
+	flags := m.Flags & s.flags
+	if flags&requiredFlags != requiredFlags || flags&levelFlags(s.level) != levelFlags(s.level) {
+		return nil, false, ErrNegotiationFailed
+	}
+
+	hash, err := s.provider.Accounts.NTHash(m.DomainName, m.UserName)
+	if err == ErrUnknownAccount {
+		return nil, false, ErrAuthenticationFailed
+	} else if err != nil {
+		return nil, false, err
+	}
+	key := ntowfv2(hash, m.UserName, m.DomainName)
+	proof, blob := m.NtChallengeResponse[:16], m.NtChallengeResponse[16:]
+	expected, sessionBaseKey := ntlmv2Response(key, s.serverChallenge, blob)
+	if !hmac.Equal(proof, expected[:16]) {
+		return nil, false, ErrAuthenticationFailed
+	}
+
+	if len(m.EncryptedRandomSessionKey) != 16 {
+		return nil, false, security.ErrInvalidToken
+	}
+	exportedSessionKey := rc4Crypt(sessionBaseKey, m.EncryptedRandomSessionKey)
+
+	var info avPairs
+	if err := info.Unmarshal(blob[28:]); err != nil {
+		return nil, false, err
+	}
+	if v, ok := info.Lookup(avFlags); ok && len(v) == 4 && binary.LittleEndian.Uint32(v)&avFlagMIC != 0 {
+		msg := append([]byte(nil), input...)
+		for i := 0; i < 16; i++ {
+			msg[authenticateMIC+i] = 0
+		}
+		if !hmac.Equal(m.MIC[:], hmacMD5(exportedSessionKey, s.negotiate, s.challenge, msg)) {
+			return nil, false, ErrAuthenticationFailed
+		}
+	}
+
+	s.session.init(exportedSessionKey, false)
+	s.done = true
+	return nil, true, nil
+}
+
+// filetime returns t as the number of 100 nanosecond intervals since
+// January 1, 1601 UTC.
+func filetime(t time.Time) uint64 {
+	return uint64(t.UnixNano()/100) + 116444736000000000
+}
+
+func uint32Bytes(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, v)
+	return b
+}
+
+func uint64Bytes(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, v)
+	return b
+}
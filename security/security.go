@@ -0,0 +1,119 @@
+package security
+
+import "errors"
+
+var (
+	// ErrInvalidToken is returned when a security token cannot be processed.
+	ErrInvalidToken = errors.New("security: invalid token")
+
+	// ErrInvalidSignature is returned when the signature of a message cannot
+	// be verified.
+	ErrInvalidSignature = errors.New("security: invalid signature")
+
+	// ErrContextIncomplete is returned when a security context is used to
+	// protect messages before it has been established.
+	ErrContextIncomplete = errors.New("security: context has not been established")
+)
+
+// Type identifies an authentication service.
+type Type uint8
+
+// Authentication services.
+const (
+	TypeNone         Type = 0x00 // RPC_C_AUTHN_NONE
+	TypeGSSNegotiate Type = 0x09 // RPC_C_AUTHN_GSS_NEGOTIATE (SPNEGO)
+	TypeWinNT        Type = 0x0A // RPC_C_AUTHN_WINNT (NTLM)
+	TypeGSSSchannel  Type = 0x0E // RPC_C_AUTHN_GSS_SCHANNEL
+	TypeGSSKerberos  Type = 0x10 // RPC_C_AUTHN_GSS_KERBEROS
+	TypeNetlogon     Type = 0x44 // RPC_C_AUTHN_NETLOGON
+	TypeDefault      Type = 0xFF // RPC_C_AUTHN_DEFAULT
+)
+
+// Level is an authentication level, which determines the degree to which
+// the PDUs exchanged on an association are protected.
+type Level uint8
+
+// Authentication levels.
+const (
+	LevelDefault   Level = 0 // RPC_C_AUTHN_LEVEL_DEFAULT
+	LevelNone      Level = 1 // RPC_C_AUTHN_LEVEL_NONE
+	LevelConnect   Level = 2 // RPC_C_AUTHN_LEVEL_CONNECT
+	LevelCall      Level = 3 // RPC_C_AUTHN_LEVEL_CALL
+	LevelPacket    Level = 4 // RPC_C_AUTHN_LEVEL_PKT
+	LevelIntegrity Level = 5 // RPC_C_AUTHN_LEVEL_PKT_INTEGRITY
+	LevelPrivacy   Level = 6 // RPC_C_AUTHN_LEVEL_PKT_PRIVACY
+)
+
+// Signed reports whether PDUs exchanged at level l carry a signature.
+//
+// In the connection-oriented protocol the call and packet levels are
+// treated as packet integrity.
+func (l Level) Signed() bool {
+	return l >= LevelCall
+}
+
+// Sealed reports whether the stub data of PDUs exchanged at level l is
+// encrypted.
+func (l Level) Sealed() bool {
+	return l >= LevelPrivacy
+}
+
+// Provider is a security provider for a particular authentication service.
+type Provider interface {
+	// Type returns the authentication service implemented by the provider.
+	Type() Type
+
+	// NewClientContext returns a security context for the client side of an
+	// association with the given target, which is usually the network
+	// address of the server.
+	NewClientContext(target string, level Level) (ClientContext, error)
+
+	// NewServerContext returns a security context for the server side of an
+	// association.
+	NewServerContext(level Level) (ServerContext, error)
+}
+
+// Context is a security context shared by a client and server. Once it has
+// been established it is used to protect the PDUs exchanged between them.
+//
+// Implementations are not required to be safe for concurrent use.
+type Context interface {
+	// SignatureSize returns the size of the signatures produced by Sign and
+	// Seal.
+	SignatureSize() int
+
+	// Sign returns a signature for msg.
+	Sign(msg []byte) (signature []byte, err error)
+
+	// Verify checks that signature is valid for msg.
+	Verify(msg, signature []byte) error
+
+	// Seal encrypts data in place and returns a signature for msg, which is
+	// computed before data is encrypted. The data must be a subslice of msg.
+	Seal(msg, data []byte) (signature []byte, err error)
+
+	// Unseal decrypts data in place and checks that signature is valid for
+	// msg once data has been decrypted. The data must be a subslice of msg.
+	Unseal(msg, data, signature []byte) error
+}
+
+// ClientContext is the client side of a security context.
+type ClientContext interface {
+	Context
+
+	// InitContext processes the token received from the server, which is nil
+	// for the first call, and returns the token to be sent to the server. It
+	// returns true when the context has been established, in which case the
+	// output token may still need to be delivered to the server.
+	InitContext(input []byte) (output []byte, done bool, err error)
+}
+
+// ServerContext is the server side of a security context.
+type ServerContext interface {
+	Context
+
+	// AcceptContext processes the token received from the client and returns
+	// the token to be sent to the client. It returns true when the context
+	// has been established.
+	AcceptContext(input []byte) (output []byte, done bool, err error)
+}
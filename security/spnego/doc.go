@@ -0,0 +1,10 @@
+// Package spnego implements the SPNEGO security provider, which negotiates
+// the security mechanism used to authenticate an RPC association.
+//
+// The provider negotiates between Kerberos and NTLM, allowing clients to fall
+// back to NTLM when a Kerberos ticket cannot be obtained and servers to
+// accept whichever of the two their clients support.
+//
+// The protocol is described in RFC 4178 and in "[MS-SPNG] Simple and
+// Protected GSS-API Negotiation Mechanism (SPNEGO) Extension".
+package spnego
@@ -0,0 +1,379 @@
+package spnego
+
+import (
+	"encoding/asn1"
+	"errors"
+
+	"github.com/gentlemanautomaton/dcerpc/security"
+	"github.com/gentlemanautomaton/dcerpc/security/kerberos"
+)
+
+var (
+	// ErrNoMechanism is returned when the client and server have no
+	// mechanism in common.
+	ErrNoMechanism = errors.New("spnego: no mechanism is supported by both peers")
+
+	// ErrRejected is returned when the peer rejects the negotiation.
+	ErrRejected = errors.New("spnego: negotiation rejected by peer")
+
+	// ErrInvalidMIC is returned when the mechListMIC of the peer cannot be
+	// verified, which indicates that the mechanism list has been tampered
+	// with.
+	ErrInvalidMIC = errors.New("spnego: invalid mechanism list MIC")
+)
+
+// Mechanism object identifiers.
+var (
+	oidMSKerberos = asn1.ObjectIdentifier{1, 2, 840, 48018, 1, 2, 2}
+	oidKerberos   = kerberos.OID
+	oidNTLM       = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 2, 10}
+)
+
+// mechOIDs returns the object identifiers of the mechanism implemented by
+// provider, in order of preference. It returns nil if the mechanism cannot
+// be negotiated.
+func mechOIDs(provider security.Provider) []asn1.ObjectIdentifier {
+	switch provider.Type() {
+	case security.TypeGSSKerberos:
+		return []asn1.ObjectIdentifier{oidMSKerberos, oidKerberos}
+	case security.TypeWinNT:
+		return []asn1.ObjectIdentifier{oidNTLM}
+	}
+	return nil
+}
+
+// Provider is the SPNEGO security provider.
+type Provider struct {
+	// Mechanisms are the security providers that may be negotiated, in order
+	// of preference. Kerberos and NTLM providers are supported.
+	Mechanisms []security.Provider
+}
+
+// Type returns security.TypeGSSNegotiate.
+func (p *Provider) Type() security.Type {
+	return security.TypeGSSNegotiate
+}
+
+// NewClientContext returns a context that negotiates a mechanism with the
+// server and authenticates to target with it.
+func (p *Provider) NewClientContext(target string, level security.Level) (security.ClientContext, error) {
+	return &clientContext{provider: p, target: target, level: level}, nil
+}
+
+// NewServerContext returns a context that accepts any of the provider's
+// mechanisms.
+func (p *Provider) NewServerContext(level security.Level) (security.ServerContext, error) {
+	return &serverContext{provider: p, level: level}, nil
+}
+
+// lookup returns the provider's mechanism with the given object identifier.
+func (p *Provider) lookup(oid asn1.ObjectIdentifier) security.Provider {
+	for _, mech := range p.Mechanisms {
+		for _, id := range mechOIDs(mech) {
+			if id.Equal(oid) {
+				return mech
+			}
+		}
+	}
+	return nil
+}
+
+// mechanism is the negotiated mechanism of a context, which protects
+// messages once it has been established.
+type mechanism struct {
+	ctx         security.Context
+	established bool
+}
+
+func (m *mechanism) context() (security.Context, error) {
+	if !m.established {
+		return nil, security.ErrContextIncomplete
+	}
+	return m.ctx, nil
+}
+
+// SignatureSize returns the signature size of the negotiated mechanism.
+func (m *mechanism) SignatureSize() int {
+	if m.ctx == nil {
+		return 0
+	}
+	return m.ctx.SignatureSize()
+}
+
+// Sign signs msg with the negotiated mechanism.
+func (m *mechanism) Sign(msg []byte) ([]byte, error) {
+	ctx, err := m.context()
+	if err != nil {
+		return nil, err
+	}
+	return ctx.Sign(msg)
+}
+
+// Verify verifies msg with the negotiated mechanism.
+func (m *mechanism) Verify(msg, signature []byte) error {
+	ctx, err := m.context()
+	if err != nil {
+		return err
+	}
+	return ctx.Verify(msg, signature)
+}
+
+// Seal seals msg with the negotiated mechanism.
+func (m *mechanism) Seal(msg, data []byte) ([]byte, error) {
+	ctx, err := m.context()
+	if err != nil {
+		return nil, err
+	}
+	return ctx.Seal(msg, data)
+}
+
+// Unseal unseals msg with the negotiated mechanism.
+func (m *mechanism) Unseal(msg, data, signature []byte) error {
+	ctx, err := m.context()
+	if err != nil {
+		return err
+	}
+	return ctx.Unseal(msg, data, signature)
+}
+
+// clientContext is the client side of an SPNEGO context.
+type clientContext struct {
+	mechanism
+	provider  *Provider
+	target    string
+	level     security.Level
+	mechTypes []byte // The DER encoding of the proposed mechanism list
+	oids      []asn1.ObjectIdentifier
+	mechs     []security.Provider // The mechanism of each proposed OID
+	oid       asn1.ObjectIdentifier
+	client    security.ClientContext
+	mechDone  bool
+	sentMIC   bool
+	started   bool
+	responded bool
+	done      bool
+}
+
+// InitContext returns a NegTokenInit message that proposes the provider's
+// mechanisms when called with a nil input, then processes the server's
+// NegTokenResp messages.
+func (c *clientContext) InitContext(input []byte) (output []byte, done bool, err error) {
+	switch {
+	case c.done:
+		return nil, false, security.ErrInvalidToken
+	case !c.started:
+		c.started = true
+		return c.init()
+	}
+
+	resp, err := unmarshalResp(input)
+	if err != nil {
+		return nil, false, err
+	}
+	if resp.NegState == stateReject {
+		return nil, false, ErrRejected
+	}
+
+	first := !c.responded
+	c.responded = true
+
+	var token []byte
+	if resp.SupportedMech != nil && !resp.SupportedMech.Equal(c.oid) {
+		// The server selected a different mechanism than the one that the
+		// optimistic token was produced by, so start again with it.
+		if !first {
+			return nil, false, security.ErrInvalidToken
+		}
+		if err := c.start(resp.SupportedMech); err != nil {
+			return nil, false, err
+		}
+		if token, c.mechDone, err = c.client.InitContext(nil); err != nil {
+			return nil, false, err
+		}
+	} else if !c.mechDone {
+		if c.client == nil {
+			return nil, false, security.ErrInvalidToken
+		}
+		if token, c.mechDone, err = c.client.InitContext(resp.ResponseToken); err != nil {
+			return nil, false, err
+		}
+	}
+	c.established = c.mechDone
+
+	if resp.MechListMIC != nil {
+		if !c.mechDone {
+			return nil, false, security.ErrInvalidToken
+		}
+		if err := c.ctx.Verify(c.mechTypes, resp.MechListMIC); err != nil {
+			return nil, false, ErrInvalidMIC
+		}
+		if resp.NegState == stateAcceptCompleted && c.sentMIC {
+			c.done = true
+			return token, true, nil
+		}
+	}
+	if resp.NegState == stateAcceptCompleted && token == nil && !c.sentMIC {
+		return nil, false, ErrInvalidMIC
+	}
+
+	reply := negTokenResp{NegState: stateAcceptIncomplete, ResponseToken: token}
+	if c.mechDone && !c.sentMIC {
+		if reply.MechListMIC, err = c.ctx.Sign(c.mechTypes); err != nil {
+			return nil, false, err
+		}
+		c.sentMIC = true
+	}
+	output, err = marshalResp(&reply)
+	return output, false, err
+}
+
+// init proposes the provider's mechanisms, with an optimistic token for the
+// first mechanism that can produce one. Mechanisms that fail to produce a
+// token, such as Kerberos when no ticket can be obtained, are not proposed.
+func (c *clientContext) init() (output []byte, done bool, err error) {
+	var token []byte
+	var firstErr error
+	for _, mech := range c.provider.Mechanisms {
+		oids := mechOIDs(mech)
+		if oids == nil {
+			continue
+		}
+		if c.client == nil {
+			ctx, err := mech.NewClientContext(c.target, c.level)
+			if err == nil {
+				token, c.mechDone, err = ctx.InitContext(nil)
+			}
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			c.client, c.ctx, c.oid = ctx, ctx, oids[0]
+		}
+		for _, oid := range oids {
+			c.oids = append(c.oids, oid)
+			c.mechs = append(c.mechs, mech)
+		}
+	}
+	if c.client == nil {
+		if firstErr != nil {
+			return nil, false, firstErr
+		}
+		return nil, false, ErrNoMechanism
+	}
+	if c.mechTypes, err = asn1.Marshal(c.oids); err != nil {
+		return nil, false, err
+	}
+	output, err = marshalInit(&negTokenInit{MechTypes: c.oids, MechToken: token})
+	return output, false, err
+}
+
+// start creates a context for the proposed mechanism with the given object
+// identifier.
+func (c *clientContext) start(oid asn1.ObjectIdentifier) error {
+	for i, id := range c.oids {
+		if !id.Equal(oid) {
+			continue
+		}
+		ctx, err := c.mechs[i].NewClientContext(c.target, c.level)
+		if err != nil {
+			return err
+		}
+		c.client, c.ctx, c.oid = ctx, ctx, oid
+		return nil
+	}
+	return ErrNoMechanism
+}
+
+// serverContext is the server side of an SPNEGO context.
+type serverContext struct {
+	mechanism
+	provider  *Provider
+	level     security.Level
+	mechTypes []byte
+	server    security.ServerContext
+	mechDone  bool
+	done      bool
+}
+
+// AcceptContext selects a mechanism from the client's NegTokenInit message
+// and then passes the tokens carried by subsequent messages to it.
+func (s *serverContext) AcceptContext(input []byte) (output []byte, done bool, err error) {
+	if s.done {
+		return nil, false, security.ErrInvalidToken
+	}
+	if s.server == nil {
+		return s.accept(input)
+	}
+	resp, err := unmarshalResp(input)
+	if err != nil {
+		return nil, false, err
+	}
+	var token []byte
+	if !s.mechDone {
+		if token, s.mechDone, err = s.server.AcceptContext(resp.ResponseToken); err != nil {
+			return nil, false, err
+		}
+	}
+	return s.respond(nil, token, resp.MechListMIC)
+}
+
+func (s *serverContext) accept(input []byte) (output []byte, done bool, err error) {
+	init, err := unmarshalInit(input)
+	if err != nil {
+		return nil, false, err
+	}
+	var selected asn1.ObjectIdentifier
+	var mech security.Provider
+	for _, oid := range init.MechTypes {
+		if mech = s.provider.lookup(oid); mech != nil {
+			selected = oid
+			break
+		}
+	}
+	if mech == nil {
+		output, _ = marshalResp(&negTokenResp{NegState: stateReject})
+		return output, false, ErrNoMechanism
+	}
+	if s.mechTypes, err = asn1.Marshal(init.MechTypes); err != nil {
+		return nil, false, err
+	}
+	if s.server, err = mech.NewServerContext(s.level); err != nil {
+		return nil, false, err
+	}
+	s.ctx = s.server
+
+	// The optimistic token can only be used if it was produced by the
+	// selected mechanism.
+	var token []byte
+	if init.MechToken != nil && selected.Equal(init.MechTypes[0]) {
+		if token, s.mechDone, err = s.server.AcceptContext(init.MechToken); err != nil {
+			return nil, false, err
+		}
+	}
+	return s.respond(selected, token, init.MechListMIC)
+}
+
+// respond returns the NegTokenResp message that carries token. Once the
+// mechanism has been established the mechanism list MICs are exchanged.
+func (s *serverContext) respond(selected asn1.ObjectIdentifier, token, mic []byte) (output []byte, done bool, err error) {
+	resp := negTokenResp{NegState: stateAcceptIncomplete, SupportedMech: selected, ResponseToken: token}
+	if s.mechDone {
+		s.established = true
+		if mic == nil {
+			resp.NegState = stateRequestMIC
+		} else {
+			if err := s.ctx.Verify(s.mechTypes, mic); err != nil {
+				return nil, false, ErrInvalidMIC
+			}
+			if resp.MechListMIC, err = s.ctx.Sign(s.mechTypes); err != nil {
+				return nil, false, err
+			}
+			resp.NegState = stateAcceptCompleted
+			s.done = true
+		}
+	}
+	output, err = marshalResp(&resp)
+	return output, s.done, err
+}
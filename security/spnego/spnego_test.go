@@ -0,0 +1,183 @@
+package spnego
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"errors"
+	"testing"
+
+	"github.com/gentlemanautomaton/dcerpc/security"
+	"github.com/gentlemanautomaton/dcerpc/security/kerberos"
+	"github.com/gentlemanautomaton/dcerpc/security/ntlm"
+)
+
+// establish runs the legs of a context until both sides are done.
+func establish(t *testing.T, client, server *Provider, level security.Level) (security.ClientContext, security.ServerContext, error) {
+	t.Helper()
+	cc, err := client.NewClientContext("host/server.example.com", level)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc, err := server.NewServerContext(level)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var token []byte
+	var clientDone, serverDone bool
+	for legs := 0; !clientDone || !serverDone; legs++ {
+		if legs > 8 {
+			t.Fatal("negotiation did not complete")
+		}
+		if token, clientDone, err = cc.InitContext(token); err != nil {
+			return cc, sc, err
+		}
+		if clientDone && len(token) == 0 {
+			break
+		}
+		if token, serverDone, err = sc.AcceptContext(token); err != nil {
+			return cc, sc, err
+		}
+	}
+	if !serverDone {
+		t.Fatal("server context was not established")
+	}
+	return cc, sc, nil
+}
+
+var errNoKDC = errors.New("kdc unreachable")
+
+// fakeKerberos proposes Kerberos with a token that no server can accept.
+type fakeKerberos struct{}
+
+func (fakeKerberos) Type() security.Type { return security.TypeGSSKerberos }
+
+func (fakeKerberos) NewClientContext(target string, level security.Level) (security.ClientContext, error) {
+	return fakeContext{}, nil
+}
+
+func (fakeKerberos) NewServerContext(level security.Level) (security.ServerContext, error) {
+	return nil, errors.New("not implemented")
+}
+
+type fakeContext struct{ security.Context }
+
+func (fakeContext) InitContext(input []byte) ([]byte, bool, error) {
+	return []byte("optimistic"), false, nil
+}
+
+func TestNegotiate(t *testing.T) {
+	credentials := ntlm.Credentials{Domain: "EXAMPLE", User: "alice", Password: "wonderland"}
+	server := &Provider{Mechanisms: []security.Provider{
+		&kerberos.Provider{},
+		&ntlm.Provider{Accounts: ntlm.AccountList{credentials}},
+	}}
+	tests := []struct {
+		name   string
+		client []security.Provider
+	}{
+		{"ntlm", []security.Provider{&ntlm.Provider{Credentials: credentials}}},
+		{"fallback", []security.Provider{
+			&kerberos.Provider{
+				Credentials: kerberos.Credentials{Realm: "EXAMPLE.COM", User: "alice", Password: "wonderland"},
+				KDC: kerberos.KDCFunc(func(realm string, req []byte) ([]byte, error) {
+					return nil, errNoKDC
+				}),
+			},
+			&ntlm.Provider{Credentials: credentials},
+		}},
+		{"counter proposal", []security.Provider{fakeKerberos{}, &ntlm.Provider{Credentials: credentials}}},
+	}
+	for _, test := range tests {
+		for _, level := range []security.Level{security.LevelIntegrity, security.LevelPrivacy} {
+			server := server
+			if test.name == "counter proposal" {
+				server = &Provider{Mechanisms: server.Mechanisms[1:]}
+			}
+			cc, sc, err := establish(t, &Provider{Mechanisms: test.client}, server, level)
+			if err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+			msg := []byte("header|sealed portion|trailer")
+			plaintext := append([]byte(nil), msg...)
+			data := msg[7:21]
+			sig, err := cc.Seal(msg, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(sig) != cc.SignatureSize() {
+				t.Fatalf("%s: signature is %d octets, want %d", test.name, len(sig), cc.SignatureSize())
+			}
+			if err := sc.Unseal(msg, data, sig); err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+			if !bytes.Equal(msg, plaintext) {
+				t.Fatalf("%s: unsealed %q, want %q", test.name, msg, plaintext)
+			}
+			if sig, err = sc.Sign(msg); err != nil {
+				t.Fatal(err)
+			}
+			if err := cc.Verify(msg, sig); err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+		}
+	}
+}
+
+func TestNegotiateFailure(t *testing.T) {
+	server := &Provider{Mechanisms: []security.Provider{
+		&ntlm.Provider{Accounts: ntlm.AccountList{{User: "alice", Password: "wonderland"}}},
+	}}
+
+	// The client has no mechanism in common with the server.
+	client := &Provider{Mechanisms: []security.Provider{fakeKerberos{}}}
+	if _, _, err := establish(t, client, server, security.LevelIntegrity); err != ErrNoMechanism {
+		t.Errorf("no common mechanism: %v", err)
+	}
+
+	// Every mechanism of the client fails to produce a token.
+	client = &Provider{Mechanisms: []security.Provider{&kerberos.Provider{
+		KDC: kerberos.KDCFunc(func(realm string, req []byte) ([]byte, error) {
+			return nil, errNoKDC
+		}),
+	}}}
+	if _, _, err := establish(t, client, server, security.LevelIntegrity); err == nil {
+		t.Error("negotiation succeeded without a usable mechanism")
+	}
+
+	// The inner mechanism rejects the credentials.
+	client = &Provider{Mechanisms: []security.Provider{
+		&ntlm.Provider{Credentials: ntlm.Credentials{User: "alice", Password: "looking glass"}},
+	}}
+	if _, _, err := establish(t, client, server, security.LevelIntegrity); err == nil {
+		t.Error("negotiation succeeded with the wrong password")
+	}
+}
+
+func TestTokens(t *testing.T) {
+	init := negTokenInit{MechTypes: []asn1.ObjectIdentifier{oidMSKerberos, oidNTLM}, MechToken: []byte("token")}
+	b, err := marshalInit(&init)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := unmarshalInit(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.MechTypes) != 2 || !got.MechTypes[1].Equal(oidNTLM) || string(got.MechToken) != "token" {
+		t.Fatalf("init = %+v", got)
+	}
+
+	for _, state := range []asn1.Enumerated{stateAbsent, stateAcceptCompleted, stateRequestMIC} {
+		resp := negTokenResp{NegState: state, SupportedMech: oidNTLM, MechListMIC: []byte("mic")}
+		if b, err = marshalResp(&resp); err != nil {
+			t.Fatal(err)
+		}
+		got, err := unmarshalResp(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.NegState != state || !got.SupportedMech.Equal(oidNTLM) || string(got.MechListMIC) != "mic" {
+			t.Fatalf("resp = %+v", got)
+		}
+	}
+}
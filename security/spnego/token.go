@@ -0,0 +1,83 @@
+package spnego
+
+import (
+	"encoding/asn1"
+
+	"github.com/gentlemanautomaton/dcerpc/security"
+)
+
+// OID is the object identifier of the SPNEGO pseudo-mechanism.
+var OID = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 2}
+
+// Negotiation states carried by NegTokenResp messages.
+const (
+	stateAbsent           = -1
+	stateAcceptCompleted  = 0
+	stateAcceptIncomplete = 1
+	stateReject           = 2
+	stateRequestMIC       = 3
+)
+
+type negTokenInit struct {
+	MechTypes   []asn1.ObjectIdentifier `asn1:"explicit,tag:0"`
+	ReqFlags    asn1.BitString          `asn1:"optional,explicit,tag:1"`
+	MechToken   []byte                  `asn1:"optional,explicit,tag:2"`
+	MechListMIC []byte                  `asn1:"optional,explicit,tag:3"`
+}
+
+type negTokenResp struct {
+	NegState      asn1.Enumerated       `asn1:"optional,explicit,tag:0,default:-1"`
+	SupportedMech asn1.ObjectIdentifier `asn1:"optional,explicit,tag:1"`
+	ResponseToken []byte                `asn1:"optional,explicit,tag:2"`
+	MechListMIC   []byte                `asn1:"optional,explicit,tag:3"`
+}
+
+// marshalInit returns the initial context token that carries t.
+func marshalInit(t *negTokenInit) ([]byte, error) {
+	oid, err := asn1.Marshal(OID)
+	if err != nil {
+		return nil, err
+	}
+	inner, err := asn1.MarshalWithParams(*t, "explicit,tag:0")
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(asn1.RawValue{
+		Class:      asn1.ClassApplication,
+		Tag:        0,
+		IsCompound: true,
+		Bytes:      append(oid, inner...),
+	})
+}
+
+// unmarshalInit parses an initial context token.
+func unmarshalInit(b []byte) (*negTokenInit, error) {
+	var raw asn1.RawValue
+	if _, err := asn1.Unmarshal(b, &raw); err != nil || raw.Class != asn1.ClassApplication || raw.Tag != 0 {
+		return nil, security.ErrInvalidToken
+	}
+	var oid asn1.ObjectIdentifier
+	rest, err := asn1.Unmarshal(raw.Bytes, &oid)
+	if err != nil || !oid.Equal(OID) {
+		return nil, security.ErrInvalidToken
+	}
+	t := new(negTokenInit)
+	if _, err := asn1.UnmarshalWithParams(rest, t, "explicit,tag:0"); err != nil {
+		return nil, security.ErrInvalidToken
+	}
+	return t, nil
+}
+
+// marshalResp returns the subsequent context token that carries t.
+func marshalResp(t *negTokenResp) ([]byte, error) {
+	return asn1.MarshalWithParams(*t, "explicit,tag:1")
+}
+
+// unmarshalResp parses a subsequent context token.
+func unmarshalResp(b []byte) (*negTokenResp, error) {
+	t := new(negTokenResp)
+	if _, err := asn1.UnmarshalWithParams(b, t, "explicit,tag:1"); err != nil {
+		return nil, security.ErrInvalidToken
+	}
+	return t, nil
+}
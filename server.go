@@ -1,9 +1,299 @@
 package dcerpc
 
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gentlemanautomaton/dcerpc/pdu"
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationcontext"
+	"github.com/gentlemanautomaton/dcerpc/protocol/coproto"
+	"github.com/gentlemanautomaton/dcerpc/security"
+	"github.com/gentlemanautomaton/dcerpc/transfersyntax"
+)
+
+// ErrInterfaceRegistered is returned when an interface with the same UUID and
+// major version has already been registered with a server.
+var ErrInterfaceRegistered = errors.New("dcerpc: interface already registered")
+
+// Operation is a handler for a single operation of an RPC interface.
+//
+// The operation should unmarshal its input parameters from the request stub
+// data of the call and store its marshaled output parameters in the response
+// stub data of the call, which is most easily accomplished with the
+// DecodeRequest and EncodeResponse methods of the call. If the operation
+// returns a *coproto.Fault it will be transmitted to the client.
+type Operation func(ctx context.Context, call *Call) error
+
+// OperationTable is a table of operation handlers for an interface, indexed
+// by operation number. Nil entries are treated as unimplemented operations.
+type OperationTable []Operation
+
+// Call is a remote procedure call received by a server.
+type Call struct {
+	*coproto.Call
+
+	// Interface is the registered interface that the call was made on.
+	Interface Interface
+
+	// Syntax is the transfer syntax that was negotiated for the call's
+	// presentation context.
+	Syntax transfersyntax.Syntax
+}
+
+// callKey is the context key of the call being served.
+type callKey struct{}
+
+// CallFromContext returns the call that is being served with ctx, which is
+// passed to the operations of a server. It allows the implementations of
+// generated server interfaces to reach the call, for example to look up the
+// contexts referred to by context handles.
+func CallFromContext(ctx context.Context) (call *Call, ok bool) {
+	call, ok = ctx.Value(callKey{}).(*Call)
+	return call, ok
+}
+
+// DecodeRequest unmarshals the request stub data of the call into v, which
+// must be a pointer, using the negotiated transfer syntax. The stub data is
+// converted from the data representation of the request's format label, so
+// clients may use any representation that NDR defines.
+//
+// The request is received in full before the call is served, so the
+// elements of [in] pipes are delivered on buffered channels, unless the
+// caller supplies channels that it receives from concurrently.
+func (call *Call) DecodeRequest(v interface{}) error {
+	dec, err := call.Syntax.NewDecoder(bytes.NewReader(call.Request), call.RequestFormat)
+	if err != nil {
+		return err
+	}
+	return dec.Decode(v)
+}
+
+// EncodeResponse marshals v with the negotiated transfer syntax and stores it
+// as the response stub data of the call. The elements of [out] pipes are
+// received from their channels until they are closed.
+func (call *Call) EncodeResponse(v interface{}) error {
+	var buf bytes.Buffer
+	enc, err := call.Syntax.NewEncoder(&buf, call.ResponseFormat)
+	if err != nil {
+		return err
+	}
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	call.Response = buf.Bytes()
+	return nil
+}
+
+// registration is an interface that has been registered with a server.
+type registration struct {
+	iface Interface
+	ops   OperationTable
+}
+
 // Server is a DCE / RPC server that is capable of receiving procedure calls
 // from a remote client.
 //
 // Server implements the server side of the protocol described in the
 // "DCE 1.1: Remote Procedure Call" technical standard.
 type Server struct {
+	// TransferSyntaxes is the list of transfer syntaxes supported by the
+	// server. If it is empty the NDR transfer syntax will be supported.
+	TransferSyntaxes []transfersyntax.Syntax
+
+	// TransferSyntaxPolicy selects the transfer syntax of each presentation
+	// context from those proposed by the client. If it is nil the
+	// transfersyntax.PreferClient policy will be used.
+	TransferSyntaxPolicy transfersyntax.Policy
+
+	// SecurityProviders is the list of security providers that clients may
+	// use to authenticate. If it is empty only unauthenticated associations
+	// are accepted.
+	SecurityProviders []security.Provider
+
+	// MinAuthLevel is the minimum authentication level of calls accepted by
+	// the server. Calls made at a lower level fail with an access denied
+	// fault.
+	MinAuthLevel security.Level
+
+	// GroupGracePeriod is how long the contexts of an association group are
+	// kept after its last association is closed, so that the client may
+	// reconnect and continue to use them. If it is zero, contexts are run
+	// down as soon as the last association is closed.
+	GroupGracePeriod time.Duration
+
+	// MaxRequestSize is the largest request stub data that the server
+	// accepts for a call. Larger requests are rejected with a
+	// remote_no_memory fault. If it is zero, coproto.DefaultMaxRequestSize
+	// is used.
+	MaxRequestSize int
+
+	mutex  sync.RWMutex
+	ifaces []registration
+	groups *coproto.ServerPool
+}
+
+// Register registers an interface with the server. Calls received for the
+// interface will be dispatched to the operation in ops that matches the
+// operation number of the call.
+func (s *Server) Register(iface Interface, ops OperationTable) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i := range s.ifaces {
+		existing := &s.ifaces[i].iface
+		if existing.UUID == iface.UUID && existing.VersionMajor == iface.VersionMajor {
+			return ErrInterfaceRegistered
+		}
+	}
+	s.ifaces = append(s.ifaces, registration{iface: iface, ops: ops})
+	return nil
+}
+
+// Unregister removes an interface from the server.
+func (s *Server) Unregister(iface Interface) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i := range s.ifaces {
+		existing := &s.ifaces[i].iface
+		if existing.UUID == iface.UUID && existing.VersionMajor == iface.VersionMajor {
+			s.ifaces = append(s.ifaces[:i], s.ifaces[i+1:]...)
+			return
+		}
+	}
+}
+
+// Serve accepts connections from l and services each of them in its own
+// goroutine. Serve returns when l returns an error from Accept.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.ServeConn(ctx, conn)
+	}
+}
+
+// ServeConn services the association carried by conn until the connection is
+// closed or ctx is cancelled. The association may join the association group
+// of another of the server's connections, and share its contexts.
+func (s *Server) ServeConn(ctx context.Context, conn io.ReadWriteCloser) error {
+	server := s.pool().NewServer(conn, serverHandler{s})
+	server.SetMaxRequestSize(s.MaxRequestSize)
+	return server.Serve(ctx)
+}
+
+// pool returns the pool that holds the association groups of the server's
+// connections.
+func (s *Server) pool() *coproto.ServerPool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.groups == nil {
+		s.groups = &coproto.ServerPool{GracePeriod: s.GroupGracePeriod}
+	}
+	return s.groups
+}
+
+// lookup returns the registered interface that is compatible with the given
+// abstract syntax. A registered interface is compatible if its major version
+// matches and its minor version is greater than or equal to that requested.
+func (s *Server) lookup(iface Interface) (reg registration, ok bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for i := range s.ifaces {
+		r := &s.ifaces[i]
+		if r.iface.UUID == iface.UUID && r.iface.VersionMajor == iface.VersionMajor && r.iface.VersionMinor >= iface.VersionMinor {
+			return *r, true
+		}
+	}
+	return registration{}, false
+}
+
+func (s *Server) transferSyntaxes() []transfersyntax.Syntax {
+	if len(s.TransferSyntaxes) == 0 {
+		return []transfersyntax.Syntax{transfersyntax.NDR}
+	}
+	return s.TransferSyntaxes
+}
+
+func (s *Server) transferSyntaxPolicy() transfersyntax.Policy {
+	if s.TransferSyntaxPolicy == nil {
+		return transfersyntax.PreferClient
+	}
+	return s.TransferSyntaxPolicy
+}
+
+// serverHandler adapts a Server to the coproto.Handler interface.
+type serverHandler struct {
+	s *Server
+}
+
+// Negotiate accepts a presentation context if its abstract syntax matches a
+// registered interface and the server's transfer syntax policy selects one of
+// its transfer syntaxes.
+func (h serverHandler) Negotiate(elem *presentationcontext.Element) presentationcontext.ResultElement {
+	iface := Interface{
+		UUID:         elem.AbstractSyntax.Interface,
+		VersionMajor: elem.AbstractSyntax.Major(),
+		VersionMinor: elem.AbstractSyntax.Minor(),
+	}
+	if _, ok := h.s.lookup(iface); !ok {
+		return presentationcontext.ResultElement{
+			Result: presentationcontext.ProviderRejection,
+			Reason: presentationcontext.AbstractSyntaxNotSupported,
+		}
+	}
+	if syntax, ok := h.s.transferSyntaxPolicy()(elem.TransferSyntaxes, h.s.transferSyntaxes()); ok {
+		return presentationcontext.ResultElement{
+			Result:         presentationcontext.Acceptance,
+			TransferSyntax: syntax.ID(),
+		}
+	}
+	return presentationcontext.ResultElement{
+		Result: presentationcontext.ProviderRejection,
+		Reason: presentationcontext.ProposedTransferSyntaxesNotSupported,
+	}
+}
+
+// SecurityProvider returns the server's security provider for the given
+// authentication type.
+func (h serverHandler) SecurityProvider(t security.Type) security.Provider {
+	for _, provider := range h.s.SecurityProviders {
+		if provider.Type() == t {
+			return provider
+		}
+	}
+	return nil
+}
+
+// ServeCall dispatches the call to the operation of the registered interface
+// that matches its operation number.
+func (h serverHandler) ServeCall(ctx context.Context, call *coproto.Call) error {
+	// Calls that do not meet the minimum authentication level learn nothing
+	// about the interfaces and operations of the server.
+	if h.s.MinAuthLevel > security.LevelNone && (call.Auth == nil || call.Auth.Level < h.s.MinAuthLevel) {
+		return &coproto.Fault{Status: pdu.StatusAccessDenied, DidNotExecute: true}
+	}
+	reg, ok := h.s.lookup(Interface{
+		UUID:         call.AbstractSyntax.Interface,
+		VersionMajor: call.AbstractSyntax.Major(),
+		VersionMinor: call.AbstractSyntax.Minor(),
+	})
+	if !ok {
+		// The interface was unregistered after it was negotiated.
+		return &coproto.Fault{Status: pdu.StatusUnknownInterface, DidNotExecute: true}
+	}
+	if int(call.OpNum) >= len(reg.ops) || reg.ops[call.OpNum] == nil {
+		return &coproto.Fault{Status: pdu.StatusOpRangeError, DidNotExecute: true}
+	}
+	syntax, ok := transfersyntax.Lookup(call.TransferSyntax, h.s.transferSyntaxes()...)
+	if !ok {
+		return &coproto.Fault{Status: pdu.StatusUnsupportedType, DidNotExecute: true}
+	}
+	c := &Call{Call: call, Interface: reg.iface, Syntax: syntax}
+	return reg.ops[call.OpNum](context.WithValue(ctx, callKey{}, c), c)
 }
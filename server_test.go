@@ -0,0 +1,322 @@
+package dcerpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/gentlemanautomaton/dcerpc/pdu"
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationcontext"
+	"github.com/gentlemanautomaton/dcerpc/protocol/coproto"
+	"github.com/gentlemanautomaton/dcerpc/security"
+	"github.com/gentlemanautomaton/dcerpc/transfersyntax"
+	"github.com/gentlemanautomaton/dcerpc/uuid"
+)
+
+var testInterface = Interface{
+	UUID:         uuid.MustParse("12345678-1234-abcd-ef00-0123456789ab"),
+	VersionMajor: 1,
+}
+
+// testBinding is the binding of the server that a test client connects to.
+var testBinding = Binding{ProtSeq: ProtSeqTCP, NetworkAddr: "server", Endpoint: "135"}
+
+// testProvider is a security provider that signs with HMAC-SHA256 using a
+// fixed key and establishes its contexts in a single leg.
+type testProvider struct{}
+
+func (testProvider) Type() security.Type { return 0xfe }
+
+func (testProvider) NewClientContext(target string, level security.Level) (security.ClientContext, error) {
+	return testContext{}, nil
+}
+
+func (testProvider) NewServerContext(level security.Level) (security.ServerContext, error) {
+	return testContext{}, nil
+}
+
+type testContext struct{}
+
+func (testContext) InitContext(input []byte) ([]byte, bool, error) {
+	return []byte("hello"), true, nil
+}
+
+func (testContext) AcceptContext(input []byte) ([]byte, bool, error) {
+	return nil, true, nil
+}
+
+func (testContext) SignatureSize() int { return 16 }
+
+func (testContext) Sign(msg []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, []byte("key"))
+	mac.Write(msg)
+	return mac.Sum(nil)[:16], nil
+}
+
+func (c testContext) Verify(msg, signature []byte) error {
+	expected, _ := c.Sign(msg)
+	if !hmac.Equal(expected, signature) {
+		return security.ErrInvalidSignature
+	}
+	return nil
+}
+
+func (c testContext) Seal(msg, data []byte) ([]byte, error) {
+	signature, err := c.Sign(msg)
+	for i := range data {
+		data[i] ^= 0xa5
+	}
+	return signature, err
+}
+
+func (c testContext) Unseal(msg, data, signature []byte) error {
+	for i := range data {
+		data[i] ^= 0xa5
+	}
+	return c.Verify(msg, signature)
+}
+
+// testDialer returns a dialer that connects clients to srv through an
+// in-memory pipe.
+func testDialer(srv *Server) Dialer {
+	return DialerFunc(func(ctx context.Context, b Binding) (io.ReadWriteCloser, error) {
+		client, server := net.Pipe()
+		go func() {
+			srv.ServeConn(context.Background(), server)
+			server.Close()
+		}()
+		return client, nil
+	})
+}
+
+// testClient returns a client that connects to srv.
+func testClient(srv *Server) *Client {
+	return &Client{Dialers: map[string]Dialer{ProtSeqTCP: testDialer(srv)}}
+}
+
+// testEcho is an operation that echoes the request stub data.
+func testEcho(ctx context.Context, call *Call) error {
+	call.Response = call.Request
+	return nil
+}
+
+func TestRegister(t *testing.T) {
+	var srv Server
+	if err := srv.Register(testInterface, OperationTable{testEcho}); err != nil {
+		t.Fatal(err)
+	}
+	minor := testInterface
+	minor.VersionMinor = 1
+	if err := srv.Register(minor, OperationTable{testEcho}); err != ErrInterfaceRegistered {
+		t.Fatalf("Register returned %v, want %v", err, ErrInterfaceRegistered)
+	}
+	major := testInterface
+	major.VersionMajor = 2
+	if err := srv.Register(major, OperationTable{testEcho}); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.Unregister(testInterface)
+	if err := srv.Register(testInterface, OperationTable{testEcho}); err != nil {
+		t.Fatalf("Register after Unregister returned %v", err)
+	}
+}
+
+func TestNegotiateInterface(t *testing.T) {
+	var srv Server
+	iface := testInterface
+	iface.VersionMinor = 2
+	if err := srv.Register(iface, OperationTable{testEcho}); err != nil {
+		t.Fatal(err)
+	}
+	unknown := testInterface
+	unknown.UUID = uuid.MustParse("87654321-1234-abcd-ef00-0123456789ab")
+
+	tests := []struct {
+		name  string
+		iface Interface
+		ok    bool
+	}{
+		{name: "exact", iface: iface, ok: true},
+		{name: "older-minor", iface: testInterface, ok: true},
+		{name: "newer-minor", iface: Interface{UUID: iface.UUID, VersionMajor: 1, VersionMinor: 3}},
+		{name: "other-major", iface: Interface{UUID: iface.UUID, VersionMajor: 2}},
+		{name: "unknown", iface: unknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testClient(&srv)
+			defer c.Close()
+			err := c.Handle(testBinding, tt.iface).Invoke(context.Background(), 0, nil, nil)
+			if tt.ok {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if e, ok := err.(*coproto.RejectionError); !ok || e.Reason != presentationcontext.AbstractSyntaxNotSupported {
+				t.Fatalf("Invoke returned %v, want an abstract syntax rejection", err)
+			}
+		})
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	var srv Server
+	op := func(n byte) Operation {
+		return func(ctx context.Context, call *Call) error {
+			if c, ok := CallFromContext(ctx); !ok || c != call {
+				t.Errorf("CallFromContext returned %v, %t", c, ok)
+			}
+			if call.Interface.UUID != testInterface.UUID {
+				t.Errorf("call made on interface %s", call.Interface.UUID)
+			}
+			call.Response = append([]byte{n}, call.Request...)
+			return nil
+		}
+	}
+	fail := func(ctx context.Context, call *Call) error {
+		return &Fault{Status: pdu.StatusAccessDenied}
+	}
+	if err := srv.Register(testInterface, OperationTable{op(0), nil, op(2), fail}); err != nil {
+		t.Fatal(err)
+	}
+	c := testClient(&srv)
+	defer c.Close()
+	h := c.Handle(testBinding, testInterface)
+
+	tests := []struct {
+		name   string
+		opnum  uint16
+		want   []byte
+		status uint32
+	}{
+		{name: "first", opnum: 0, want: []byte{0, 1, 2, 3, 4}},
+		{name: "third", opnum: 2, want: []byte{2, 1, 2, 3, 4}},
+		{name: "unimplemented", opnum: 1, status: pdu.StatusOpRangeError},
+		{name: "out-of-range", opnum: 4, status: pdu.StatusOpRangeError},
+		{name: "fault", opnum: 3, status: pdu.StatusAccessDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			call := coproto.Call{OpNum: tt.opnum, Request: []byte{1, 2, 3, 4}}
+			err := h.Call(context.Background(), &call)
+			if tt.status != 0 {
+				if fault, ok := err.(*Fault); !ok || fault.Status != tt.status {
+					t.Fatalf("Call returned %v, want status %#x", err, tt.status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(call.Response, tt.want) {
+				t.Fatalf("response % x, want % x", call.Response, tt.want)
+			}
+		})
+	}
+
+	// Calls on an interface that is unregistered after it was negotiated
+	// are rejected.
+	srv.Unregister(testInterface)
+	call := coproto.Call{OpNum: 0}
+	err := h.Call(context.Background(), &call)
+	if fault, ok := err.(*Fault); !ok || fault.Status != pdu.StatusUnknownInterface {
+		t.Fatalf("Call after Unregister returned %v, want status %#x", err, pdu.StatusUnknownInterface)
+	}
+}
+
+func TestMinAuthLevel(t *testing.T) {
+	srv := &Server{
+		SecurityProviders: []security.Provider{testProvider{}},
+		MinAuthLevel:      security.LevelIntegrity,
+	}
+	if err := srv.Register(testInterface, OperationTable{testEcho}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		provider security.Provider
+		level    security.Level
+		opnum    uint16
+		status   uint32
+	}{
+		{name: "unauthenticated", opnum: 0, status: pdu.StatusAccessDenied},
+		{name: "unauthenticated-bad-opnum", opnum: 5, status: pdu.StatusAccessDenied},
+		{name: "connect", provider: testProvider{}, level: security.LevelConnect, opnum: 0, status: pdu.StatusAccessDenied},
+		{name: "connect-bad-opnum", provider: testProvider{}, level: security.LevelConnect, opnum: 5, status: pdu.StatusAccessDenied},
+		{name: "integrity", provider: testProvider{}, level: security.LevelIntegrity, opnum: 0},
+		{name: "integrity-bad-opnum", provider: testProvider{}, level: security.LevelIntegrity, opnum: 5, status: pdu.StatusOpRangeError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testClient(srv)
+			c.SecurityProvider, c.AuthLevel = tt.provider, tt.level
+			defer c.Close()
+			err := c.Handle(testBinding, testInterface).Invoke(context.Background(), tt.opnum, nil, nil)
+			if tt.status == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if fault, ok := err.(*Fault); !ok || fault.Status != tt.status {
+				t.Fatalf("Invoke returned %v, want status %#x", err, tt.status)
+			}
+		})
+	}
+}
+
+func TestTransferSyntaxNegotiation(t *testing.T) {
+	both := []transfersyntax.Syntax{transfersyntax.NDR64, transfersyntax.NDR}
+	tests := []struct {
+		name      string
+		supported []transfersyntax.Syntax
+		policy    transfersyntax.Policy
+		proposed  []transfersyntax.Syntax
+		want      transfersyntax.Syntax
+	}{
+		{name: "default", want: transfersyntax.NDR},
+		{name: "default-server", proposed: both, want: transfersyntax.NDR},
+		{name: "prefer-client", supported: []transfersyntax.Syntax{transfersyntax.NDR, transfersyntax.NDR64}, proposed: both, want: transfersyntax.NDR64},
+		{name: "prefer-server", supported: []transfersyntax.Syntax{transfersyntax.NDR, transfersyntax.NDR64}, policy: transfersyntax.PreferServer, proposed: both, want: transfersyntax.NDR},
+		{name: "unsupported", supported: []transfersyntax.Syntax{transfersyntax.NDR64}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &Server{TransferSyntaxes: tt.supported, TransferSyntaxPolicy: tt.policy}
+			var got transfersyntax.Syntax
+			err := srv.Register(testInterface, OperationTable{func(ctx context.Context, call *Call) error {
+				got = call.Syntax
+				return call.EncodeResponse(&struct{ Value uint32 }{Value: 7})
+			}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := testClient(srv)
+			defer c.Close()
+			iface := testInterface
+			iface.TransferSyntaxes = tt.proposed
+
+			var out struct{ Value uint32 }
+			err = c.Handle(testBinding, iface).Invoke(context.Background(), 0, nil, &out)
+			if tt.want == nil {
+				if e, ok := err.(*coproto.RejectionError); !ok || e.Reason != presentationcontext.ProposedTransferSyntaxesNotSupported {
+					t.Fatalf("Invoke returned %v, want a transfer syntax rejection", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want || out.Value != 7 {
+				t.Fatalf("call used %v and returned %d, want %v", got, out.Value, tt.want)
+			}
+		})
+	}
+}
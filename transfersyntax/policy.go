@@ -0,0 +1,34 @@
+package transfersyntax
+
+import "github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationsyntax"
+
+// Policy selects the transfer syntax for a presentation context from those
+// proposed by a client. The proposed syntaxes are listed in the client's
+// order of preference and the supported syntaxes are listed in the server's
+// order of preference. Policy returns false if none of the proposed syntaxes
+// are acceptable.
+type Policy func(proposed []presentationsyntax.ID, supported []Syntax) (Syntax, bool)
+
+// PreferClient is a policy that selects the first proposed transfer syntax
+// that is supported.
+func PreferClient(proposed []presentationsyntax.ID, supported []Syntax) (Syntax, bool) {
+	for _, id := range proposed {
+		if syntax, ok := Lookup(id, supported...); ok {
+			return syntax, true
+		}
+	}
+	return nil, false
+}
+
+// PreferServer is a policy that selects the first supported transfer syntax
+// that was proposed.
+func PreferServer(proposed []presentationsyntax.ID, supported []Syntax) (Syntax, bool) {
+	for _, syntax := range supported {
+		for _, id := range proposed {
+			if syntax.ID() == id {
+				return syntax, true
+			}
+		}
+	}
+	return nil, false
+}
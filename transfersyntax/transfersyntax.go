@@ -1,19 +1,130 @@
 package transfersyntax
 
-import "github.com/gentlemanautomaton/dcerpc/uuid"
+import (
+	"encoding/binary"
+	"io"
 
+	"github.com/gentlemanautomaton/dcerpc/formatlabel"
+	"github.com/gentlemanautomaton/dcerpc/ndr"
+	"github.com/gentlemanautomaton/dcerpc/ndr64"
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationsyntax"
+	"github.com/gentlemanautomaton/dcerpc/uuid"
+)
+
+// ProtocolIdentifier is the left-hand side of the protocol tower floor that
+// identifies a transfer syntax.
 type ProtocolIdentifier []byte // TODO: Move and define. Move to core package?
 
 // Syntax represents a DCE / RPC transfer syntax.
 type Syntax interface {
 	ProtocolIdentifier() ProtocolIdentifier
 	UUID() uuid.UUID
+	ID() presentationsyntax.ID
+
+	// NewEncoder returns an encoder that writes values to w in the transfer
+	// syntax, using the given format label.
+	NewEncoder(w io.Writer, format formatlabel.Format) (Encoder, error)
+
+	// NewDecoder returns a decoder that reads values from r in the transfer
+	// syntax, using the given format label.
+	NewDecoder(r io.Reader, format formatlabel.Format) (Decoder, error)
+}
+
+// Encoder encodes values in a transfer syntax.
+type Encoder interface {
+	Encode(v interface{}) error
+}
+
+// Decoder decodes values in a transfer syntax.
+type Decoder interface {
+	Decode(v interface{}) error
+}
+
+var (
+	ndrID   = presentationsyntax.New(uuid.MustParse("8a885d04-1ceb-11c9-9fe8-08002b104860"), 2, 0)
+	ndr64ID = presentationsyntax.New(uuid.MustParse("71710533-beba-4937-8319-b5dbef9ccc36"), 1, 0)
+)
+
+type ndrSyntax struct {
 }
 
-type ndr struct {
+// NDR is the network data representation transfer syntax specified by the
+// "DCE 1.1: Remote Procedure Call" technical standard.
+var NDR Syntax = ndrSyntax{}
+
+func (ndrSyntax) ProtocolIdentifier() ProtocolIdentifier { return protocolIdentifier(ndrID) }
+func (ndrSyntax) UUID() uuid.UUID                        { return ndrID.Interface }
+func (ndrSyntax) ID() presentationsyntax.ID              { return ndrID }
+
+func (ndrSyntax) NewEncoder(w io.Writer, format formatlabel.Format) (Encoder, error) {
+	enc, err := ndr.NewEncoder(w, format)
+	if err != nil {
+		return nil, err
+	}
+	return enc, nil
 }
 
-var NDR = ndr{}
+func (ndrSyntax) NewDecoder(r io.Reader, format formatlabel.Format) (Decoder, error) {
+	dec, err := ndr.NewDecoder(r, format)
+	if err != nil {
+		return nil, err
+	}
+	return dec, nil
+}
+
+type ndr64Syntax struct {
+}
+
+// NDR64 is the 64-bit network data representation transfer syntax specified
+// by the "[MS-RPCE] Remote Procedure Call Protocol Extensions" publication.
+var NDR64 Syntax = ndr64Syntax{}
+
+func (ndr64Syntax) ProtocolIdentifier() ProtocolIdentifier { return protocolIdentifier(ndr64ID) }
+func (ndr64Syntax) UUID() uuid.UUID                        { return ndr64ID.Interface }
+func (ndr64Syntax) ID() presentationsyntax.ID              { return ndr64ID }
+
+func (ndr64Syntax) NewEncoder(w io.Writer, format formatlabel.Format) (Encoder, error) {
+	enc, err := ndr64.NewEncoder(w, format)
+	if err != nil {
+		return nil, err
+	}
+	return enc, nil
+}
+
+func (ndr64Syntax) NewDecoder(r io.Reader, format formatlabel.Format) (Decoder, error) {
+	dec, err := ndr64.NewDecoder(r, format)
+	if err != nil {
+		return nil, err
+	}
+	return dec, nil
+}
+
+// Lookup returns the transfer syntax with the given identifier from syntaxes.
+// If syntaxes is empty the transfer syntaxes implemented by this package are
+// searched.
+func Lookup(id presentationsyntax.ID, syntaxes ...Syntax) (Syntax, bool) {
+	if len(syntaxes) == 0 {
+		syntaxes = []Syntax{NDR, NDR64}
+	}
+	for _, syntax := range syntaxes {
+		if syntax.ID() == id {
+			return syntax, true
+		}
+	}
+	return nil, false
+}
 
-type ndr64 struct {
+// protocolIdentifier returns the tower floor protocol identifier for the
+// given syntax, which consists of the UUID protocol identifier octet followed
+// by the little-endian UUID and major version.
+func protocolIdentifier(id presentationsyntax.ID) ProtocolIdentifier {
+	p := make(ProtocolIdentifier, 19)
+	p[0] = 0x0d
+	u := id.Interface
+	binary.LittleEndian.PutUint32(p[1:5], binary.BigEndian.Uint32(u[0:4]))
+	binary.LittleEndian.PutUint16(p[5:7], binary.BigEndian.Uint16(u[4:6]))
+	binary.LittleEndian.PutUint16(p[7:9], binary.BigEndian.Uint16(u[6:8]))
+	copy(p[9:17], u[8:16])
+	binary.LittleEndian.PutUint16(p[17:19], id.Major())
+	return p
 }
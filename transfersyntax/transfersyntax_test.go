@@ -0,0 +1,123 @@
+package transfersyntax
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/gentlemanautomaton/dcerpc/formatlabel"
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationsyntax"
+)
+
+func TestProtocolIdentifier(t *testing.T) {
+	tests := []struct {
+		name   string
+		syntax Syntax
+		want   ProtocolIdentifier
+	}{
+		{"ndr", NDR, ProtocolIdentifier{
+			0x0d,
+			0x04, 0x5d, 0x88, 0x8a, 0xeb, 0x1c, 0xc9, 0x11,
+			0x9f, 0xe8, 0x08, 0x00, 0x2b, 0x10, 0x48, 0x60,
+			0x02, 0x00,
+		}},
+		{"ndr64", NDR64, ProtocolIdentifier{
+			0x0d,
+			0x33, 0x05, 0x71, 0x71, 0xba, 0xbe, 0x37, 0x49,
+			0x83, 0x19, 0xb5, 0xdb, 0xef, 0x9c, 0xcc, 0x36,
+			0x01, 0x00,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.syntax.ProtocolIdentifier(); !bytes.Equal(got, tt.want) {
+				t.Fatalf("ProtocolIdentifier returned % x, want % x", got, tt.want)
+			}
+			if tt.syntax.ID().Interface != tt.syntax.UUID() {
+				t.Fatalf("ID %v does not match UUID %v", tt.syntax.ID(), tt.syntax.UUID())
+			}
+		})
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	// The conformance of the array is hoisted to the start of the struct,
+	// where NDR64 transmits it in 64 bits.
+	type value struct {
+		N    uint32
+		Data []uint16 `idl:"size_is(N)"`
+	}
+	in := value{N: 2, Data: []uint16{3, 4}}
+	tests := []struct {
+		name   string
+		syntax Syntax
+		want   []byte
+	}{
+		{"ndr", NDR, []byte{2, 0, 0, 0, 2, 0, 0, 0, 3, 0, 4, 0}},
+		{"ndr64", NDR64, []byte{2, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 3, 0, 4, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc, err := tt.syntax.NewEncoder(&buf, formatlabel.LEAIEEE)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := enc.Encode(&in); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), tt.want) {
+				t.Fatalf("encoded % x, want % x", buf.Bytes(), tt.want)
+			}
+			dec, err := tt.syntax.NewDecoder(&buf, formatlabel.LEAIEEE)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out value
+			if err := dec.Decode(&out); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(out, in) {
+				t.Fatalf("decoded %+v", out)
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	if syntax, ok := Lookup(NDR64.ID()); !ok || syntax != NDR64 {
+		t.Fatalf("Lookup returned %v, %t", syntax, ok)
+	}
+	if syntax, ok := Lookup(NDR.ID(), NDR64); ok {
+		t.Fatalf("Lookup returned %v from a list without it", syntax)
+	}
+	if _, ok := Lookup(presentationsyntax.ID{}); ok {
+		t.Fatal("Lookup found the nil syntax")
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	both := []presentationsyntax.ID{NDR64.ID(), NDR.ID()}
+	tests := []struct {
+		name      string
+		policy    Policy
+		proposed  []presentationsyntax.ID
+		supported []Syntax
+		want      Syntax
+	}{
+		{"client", PreferClient, both, []Syntax{NDR, NDR64}, NDR64},
+		{"server", PreferServer, both, []Syntax{NDR, NDR64}, NDR},
+		{"client-one", PreferClient, both, []Syntax{NDR}, NDR},
+		{"server-one", PreferServer, both, []Syntax{NDR64}, NDR64},
+		{"client-none", PreferClient, []presentationsyntax.ID{NDR64.ID()}, []Syntax{NDR}, nil},
+		{"server-none", PreferServer, []presentationsyntax.ID{NDR64.ID()}, []Syntax{NDR}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			syntax, ok := tt.policy(tt.proposed, tt.supported)
+			if ok != (tt.want != nil) || syntax != tt.want {
+				t.Fatalf("policy selected %v, %t, want %v", syntax, ok, tt.want)
+			}
+		})
+	}
+}
@@ -1 +1,33 @@
 package dcerpc
+
+import (
+	"github.com/gentlemanautomaton/dcerpc/pdu/copdu/presentationsyntax"
+	"github.com/gentlemanautomaton/dcerpc/transfersyntax"
+	"github.com/gentlemanautomaton/dcerpc/uuid"
+)
+
+// Interface identifies an RPC interface by its UUID and version.
+type Interface struct {
+	UUID         uuid.UUID
+	VersionMajor uint16
+	VersionMinor uint16
+
+	// TransferSyntaxes is the list of transfer syntaxes that a client will
+	// propose for the interface, in order of preference. If it is empty the
+	// NDR transfer syntax will be proposed.
+	TransferSyntaxes []transfersyntax.Syntax
+}
+
+// SyntaxID returns the abstract syntax identifier of the interface.
+func (iface Interface) SyntaxID() presentationsyntax.ID {
+	return presentationsyntax.New(iface.UUID, iface.VersionMajor, iface.VersionMinor)
+}
+
+// transferSyntaxes returns the transfer syntaxes to propose for the
+// interface.
+func (iface Interface) transferSyntaxes() []transfersyntax.Syntax {
+	if len(iface.TransferSyntaxes) == 0 {
+		return []transfersyntax.Syntax{transfersyntax.NDR}
+	}
+	return iface.TransferSyntaxes
+}
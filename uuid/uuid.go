@@ -1,8 +1,89 @@
 package uuid
 
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+)
+
 // TODO: Decide whether to continue rolling our own package for this here or
 // instead to use one of the existing UUID packages floating around.
 
 // UUID represents a 16 byte universally unique identifier as used by the
 // Distributed Computing Environment.
+//
+// The bytes are stored in the order in which they appear in the string
+// representation of the UUID. The first three fields are integers and are
+// subject to byte-swapping when encoded with a little-endian format label.
 type UUID [16]byte
+
+// Nil is the nil UUID, which has all 128 bits set to zero.
+var Nil UUID
+
+// ErrInvalidFormat is returned when a UUID string cannot be parsed.
+var ErrInvalidFormat = errors.New("uuid: invalid format")
+
+// Parse parses a UUID from its string representation, which is of the form
+// xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx. Surrounding braces are permitted.
+func Parse(s string) (u UUID, err error) {
+	if len(s) == 38 && s[0] == '{' && s[37] == '}' {
+		s = s[1:37]
+	}
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return Nil, ErrInvalidFormat
+	}
+	var buf [32]byte
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == '-' {
+			continue
+		}
+		buf[n] = s[i]
+		n++
+	}
+	if _, err = hex.Decode(u[:], buf[:]); err != nil {
+		return Nil, ErrInvalidFormat
+	}
+	return
+}
+
+// New returns a random (version 4) UUID.
+func New() (u UUID) {
+	if _, err := rand.Read(u[:]); err != nil {
+		panic(err)
+	}
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return
+}
+
+// MustParse parses a UUID from its string representation. It panics if s
+// cannot be parsed. It is intended for the initialization of package-level
+// variables.
+func MustParse(s string) UUID {
+	u, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+// String returns the string representation of the UUID.
+func (u UUID) String() string {
+	var buf [36]byte
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+	return string(buf[:])
+}
+
+// IsNil returns true if u is the nil UUID.
+func (u UUID) IsNil() bool {
+	return u == Nil
+}